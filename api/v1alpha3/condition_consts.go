@@ -0,0 +1,33 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import clusterv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+const (
+	// MachineHealthyCondition reports the result of the health check of the machine container, it is
+	// only set on machines with a health check.
+	MachineHealthyCondition clusterv1alpha3.ConditionType = "MachineHealthy"
+
+	// HealthCheckStartingReason (Severity=Info) is used while the machine container did not pass its
+	// health check yet, and did not fail it enough times to be unhealthy.
+	HealthCheckStartingReason = "HealthCheckStarting"
+
+	// HealthCheckFailedReason (Severity=Error) is used when the machine container failed its health
+	// check the configured number of times in a row, or is not running.
+	HealthCheckFailedReason = "HealthCheckFailed"
+)
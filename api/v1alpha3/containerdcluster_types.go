@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha3
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	clusterv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
@@ -50,6 +51,53 @@ type ContainerdClusterSpec struct {
 	// LoadBalancer allows defining configurations for the cluster load balancer.
 	// +optional
 	LoadBalancer ContainerdLoadBalancer `json:"loadBalancer,omitempty"`
+
+	// RegistryCredentialsRef is a reference to a Secret of type kubernetes.io/dockerconfigjson,
+	// in the same namespace as the ContainerdCluster, holding the credentials used to pull
+	// images from private registries.
+	// +optional
+	RegistryCredentialsRef *corev1.LocalObjectReference `json:"registryCredentialsRef,omitempty"`
+
+	// RegistryMirrors configures the endpoints used to pull images from registries, e.g. to
+	// redirect kindest image pulls to an internal mirror. They take precedence over the
+	// registry hosts configuration of the controller.
+	// +optional
+	RegistryMirrors []RegistryMirror `json:"registryMirrors,omitempty"`
+
+	// HostAliases are entries added to the /etc/hosts file of the machines, next to the entries of
+	// the load balancer and of the other machines of the cluster, so that hosts can be reached by
+	// name without an external DNS.
+	// +optional
+	HostAliases []HostAlias `json:"hostAliases,omitempty"`
+}
+
+// HostAlias maps an IP address to host names in the /etc/hosts file of the machines.
+type HostAlias struct {
+	// IP is the IP address of the hosts.
+	IP string `json:"ip"`
+
+	// Hostnames are the names of the hosts at the IP address.
+	// +kubebuilder:validation:MinItems=1
+	Hostnames []string `json:"hostnames"`
+}
+
+// RegistryMirror configures the endpoints used to pull images from a registry.
+type RegistryMirror struct {
+	// Registry is the registry host the mirror applies to, e.g. "docker.io".
+	Registry string `json:"registry"`
+
+	// Endpoints are the mirror endpoints tried in order before the registry itself,
+	// e.g. "https://mirror.example.com:5000".
+	// +optional
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	// Insecure allows plain HTTP for endpoints without a scheme and skips TLS certificate verification.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// CACert is a PEM encoded CA bundle used to verify the endpoints and the registry.
+	// +optional
+	CACert string `json:"caCert,omitempty"`
 }
 
 // ContainerdLoadBalancer allows defining configurations for the cluster load balancer.
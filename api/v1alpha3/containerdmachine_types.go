@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha3
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	clusterv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
@@ -29,6 +30,17 @@ const (
 	// MachineFinalizer allows ReconcileContainerdMachine to clean up resources associated with AWSMachine before
 	// removing it from the apiserver.
 	MachineFinalizer = "containerdmachine.infrastructure.cluster.x-k8s.io"
+
+	// FrozenAnnotation freezes the processes of the machine container when set to "true", e.g. to
+	// simulate a node outage or save resources without losing the node state, and thaws them when
+	// removed. Only provisioned machines are frozen.
+	FrozenAnnotation = "containerdmachine.infrastructure.cluster.x-k8s.io/frozen"
+)
+
+// Operating systems of the machines.
+const (
+	LinuxOS   = "linux"
+	WindowsOS = "windows"
 )
 
 // ContainerdMachineSpec defines the desired state of ContainerdMachine
@@ -52,15 +64,229 @@ type ContainerdMachineSpec struct {
 
 	// ExtraMounts describes additional mount points for the node container
 	// These may be used to bind a hostPath
+	// A mount at /var, /tmp, /run or /lib/modules replaces the one the node containers get by
+	// default, like in kind: /var as a volume, /tmp and /run as tmpfs, and /lib/modules read-only
+	// from the host.
 	// +optional
 	ExtraMounts []Mount `json:"extraMounts,omitempty"`
 
+	// Snapshotter is the containerd snapshotter used to create the machine container filesystem.
+	// Hosts that cannot run overlayfs, e.g. because the containerd root is itself on overlayfs,
+	// can use native instead. If not set, the containerd default snapshotter is used.
+	// +kubebuilder:validation:Enum=overlayfs;native;zfs;btrfs;stargz
+	// +optional
+	Snapshotter string `json:"snapshotter,omitempty"`
+
+	// OS is the operating system of the machine, to simulate hybrid Linux and Windows workload
+	// clusters. Windows machines run Windows containers with the runhcs runtime, by default for the
+	// windows/amd64 platform. Windows containers cannot be attached to HNS networks yet, so Windows
+	// machines fail to be created. If not set, the machine is a Linux machine.
+	// +kubebuilder:validation:Enum=linux;windows
+	// +optional
+	OS string `json:"os,omitempty"`
+
+	// Platform is the platform of the machine image to pull, in the os/arch[/variant] format,
+	// e.g. "linux/arm64". If not set, the platform of the host running containerd is used, or
+	// windows/amd64 for Windows machines.
+	// +optional
+	Platform string `json:"platform,omitempty"`
+
+	// RuntimeHandler is the containerd runtime the machine container runs with, like the handler of a
+	// Kubernetes RuntimeClass: "runc", "kata", "gvisor" or "runhcs", or the name of a containerd shim,
+	// e.g. "io.containerd.kata-qemu.v2". The runtime must be installed on the host. If not set, the
+	// containerd default runtime is used, or runhcs for Windows machines.
+	// +optional
+	RuntimeHandler string `json:"runtimeHandler,omitempty"`
+
+	// HostSelector selects the containerd hosts the machine can be scheduled onto by their labels,
+	// when the provider is configured with a pool of hosts. The machine is also only scheduled onto
+	// the hosts of the failure domain of its Machine, if it has one. If not set, any host can be chosen.
+	// +optional
+	HostSelector *metav1.LabelSelector `json:"hostSelector,omitempty"`
+
+	// Resources limits the host resources the machine container can use, so that a workload cluster
+	// cannot starve the host or the other clusters. It is applied when the machine container is created.
+	// +optional
+	Resources *MachineResources `json:"resources,omitempty"`
+
+	// HealthCheck configures the probe run periodically against the machine container, reported by
+	// the MachineHealthy condition. It is applied when the machine container is created.
+	// +optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// Devices are the devices of the host exposed in the machine container, e.g. /dev/kvm or /dev/fuse,
+	// with the device cgroup rules allowing their use, so that device plugins or virtualization can be
+	// tested in the workload cluster. The devices must exist on the host. They are applied when the
+	// machine container is created. Not supported by Windows machines.
+	// +optional
+	Devices []Device `json:"devices,omitempty"`
+
+	// CDIDevices are the fully qualified names of the Container Device Interface devices injected into
+	// the machine container, e.g. "nvidia.com/gpu=all" or "amd.com/gpu=0", to pass GPUs through to the
+	// workload cluster. The CDI specs of the devices, with their device nodes, driver library mounts
+	// and hooks, must be generated on the host by the vendor tools, e.g. nvidia-ctk cdi generate.
+	// They are applied when the machine container is created. Not supported by Windows machines.
+	// +optional
+	CDIDevices []string `json:"cdiDevices,omitempty"`
+
+	// Sysctls are the kernel parameters set in the machine container, e.g. "net.ipv4.ip_forward": "1"
+	// or "net.netfilter.nf_conntrack_max": "1048576". Only the sysctls namespaced per container can be
+	// set: net.*, fs.mqueue.* and the IPC kernel.shm*, kernel.msg* and kernel.sem ones. The others,
+	// like fs.inotify.max_user_watches, are shared by all the containers and must be set on the host.
+	// They are applied when the machine container is created. Not supported by Windows machines.
+	// +optional
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+
+	// Ulimits are the resource limits of the processes of the machine container, e.g. to raise the
+	// nofile limit the kubelet and the pods of busy nodes run into. They are applied when the machine
+	// container is created. Not supported by Windows machines.
+	// +optional
+	Ulimits []Ulimit `json:"ulimits,omitempty"`
+
+	// Entrypoint replaces the entrypoint of the machine image, e.g. to use a node image with another
+	// init or to wrap it in a debugger. The command of the image is dropped unless Command is set.
+	// It is applied when the machine container is created.
+	// +optional
+	Entrypoint []string `json:"entrypoint,omitempty"`
+
+	// Command replaces the command of the machine image, passed as arguments to the entrypoint.
+	// It is applied when the machine container is created.
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// ExtraArgs are appended to the arguments of the process of the machine container, after the
+	// command. They are applied when the machine container is created.
+	// +optional
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+
+	// Hooks are OCI hooks the runtime runs on the host when the machine container comes and goes, e.g.
+	// for custom network plumbing or audit logging. They are applied when the machine container is
+	// created. Not supported by Windows machines.
+	// +optional
+	Hooks *MachineHooks `json:"hooks,omitempty"`
+
 	// Bootstrapped is true when the kubeadm bootstrapping has been run
 	// against this machine
 	// +optional
 	Bootstrapped bool `json:"bootstrapped,omitempty"`
 }
 
+// MachineResources limits the host resources a machine container can use. Unset limits are not enforced.
+type MachineResources struct {
+	// CPUs is the CPU time the machine can use, in CPUs, e.g. "2" or "500m".
+	// +optional
+	CPUs *resource.Quantity `json:"cpus,omitempty"`
+
+	// Memory is the memory the machine can use, without swap, e.g. "4Gi".
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+
+	// Pids is the number of processes the machine can run.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Pids *int64 `json:"pids,omitempty"`
+}
+
+// Device is a device of the host exposed in a machine container.
+type Device struct {
+	// HostPath is the path of the character or block device on the host, e.g. "/dev/kvm".
+	// +kubebuilder:validation:Pattern=`^/`
+	HostPath string `json:"hostPath"`
+
+	// ContainerPath is the path of the device in the machine container. Defaults to HostPath.
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	ContainerPath string `json:"containerPath,omitempty"`
+
+	// Permissions are the cgroup permissions of the machine on the device, a combination of r (read),
+	// w (write) and m (mknod). Defaults to "rwm".
+	// +kubebuilder:validation:Pattern=`^[rwm]{1,3}$`
+	// +optional
+	Permissions string `json:"permissions,omitempty"`
+}
+
+// Ulimit is a resource limit of the processes of a machine container.
+type Ulimit struct {
+	// Name is the name of the limit, as used by ulimit, e.g. "nofile", "nproc" or "memlock".
+	// +kubebuilder:validation:Enum=as;core;cpu;data;fsize;locks;memlock;msgqueue;nice;nofile;nproc;rss;rtprio;rttime;sigpending;stack
+	Name string `json:"name"`
+
+	// Soft is the limit enforced on the processes.
+	// +kubebuilder:validation:Minimum=0
+	Soft int64 `json:"soft"`
+
+	// Hard is the ceiling the processes can raise the soft limit to. Defaults to Soft.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Hard *int64 `json:"hard,omitempty"`
+}
+
+// MachineHooks are the OCI hooks of a machine container.
+type MachineHooks struct {
+	// Prestart hooks run after the namespaces of the machine container are created, before its init
+	// starts.
+	// +optional
+	Prestart []Hook `json:"prestart,omitempty"`
+
+	// Poststop hooks run after the machine container is stopped and deleted.
+	// +optional
+	Poststop []Hook `json:"poststop,omitempty"`
+}
+
+// Hook is a binary of the host run by the OCI runtime, with the state of the container as JSON on its
+// standard input.
+type Hook struct {
+	// Path is the absolute path of the binary on the host.
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path"`
+
+	// Args are the arguments of the binary, including argv[0].
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// Env are the environment variables of the binary, in the KEY=value format.
+	// +optional
+	Env []string `json:"env,omitempty"`
+
+	// Timeout is how long the binary can run, in whole seconds. If not set, it is not limited.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// HealthCheck configures the probe run against a machine container. Exactly one of Exec and TCPPort
+// must be set.
+type HealthCheck struct {
+	// Exec is a command run in the machine container, the probe succeeds if it exits with code 0,
+	// e.g. ["curl", "-sf", "http://localhost:10248/healthz"] to check the kubelet.
+	// +optional
+	Exec []string `json:"exec,omitempty"`
+
+	// TCPPort is a port of the machine container, the probe succeeds if it accepts connections.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	TCPPort int32 `json:"tcpPort,omitempty"`
+
+	// Interval is the time between two probes. Defaults to 10s.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Timeout is the time after which a probe fails. Defaults to 5s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Retries is the number of consecutive failed probes after which the machine is unhealthy.
+	// Defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
+
+	// StartPeriod is the time after the machine container started during which failed probes are
+	// not counted, e.g. while the node bootstraps.
+	// +optional
+	StartPeriod *metav1.Duration `json:"startPeriod,omitempty"`
+}
+
 // Mount specifies a host volume to mount into a container.
 // This is a simplified version of kind v1alpha4.Mount types.
 type Mount struct {
@@ -72,11 +298,42 @@ type Mount struct {
 	// follow the symlink and mount the real destination to container.
 	HostPath string `json:"hostPath,omitempty"`
 
+	// Volume is the name of a named volume of the cluster to mount instead of a host path. The
+	// volume is created on first use and outlives the machine container, e.g. so that the etcd
+	// data of a machine persists across the recreation of its container for upgrade testing.
+	// +optional
+	Volume string `json:"volume,omitempty"`
+
 	// If set, the mount is read-only.
 	// +optional
 	Readonly bool `json:"readOnly,omitempty"`
 }
 
+// ResourceUsage is the resource usage of a machine container, read from its cgroup.
+type ResourceUsage struct {
+	// CPU is the CPU time used by the machine container since it started.
+	CPU metav1.Duration `json:"cpu"`
+
+	// Memory is the memory used by the machine container, excluding the reclaimable page cache.
+	Memory resource.Quantity `json:"memory"`
+
+	// MemoryLimit is the memory limit of the machine container, unset if it has none.
+	// +optional
+	MemoryLimit *resource.Quantity `json:"memoryLimit,omitempty"`
+
+	// IORead is the amount of data read from block devices by the machine container.
+	IORead resource.Quantity `json:"ioRead"`
+
+	// IOWrite is the amount of data written to block devices by the machine container.
+	IOWrite resource.Quantity `json:"ioWrite"`
+
+	// Processes is the number of processes running in the machine container.
+	Processes int64 `json:"processes"`
+
+	// LastUpdated is the time the resource usage was read.
+	LastUpdated metav1.Time `json:"lastUpdated"`
+}
+
 // ContainerdMachineStatus defines the observed state of ContainerdMachine
 type ContainerdMachineStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -90,6 +347,24 @@ type ContainerdMachineStatus struct {
 	// +optional
 	LoadBalancerConfigured bool `json:"loadBalancerConfigured,omitempty"`
 
+	// Host is the containerd host the machine was scheduled onto, when the provider is configured
+	// with a pool of hosts. The machine stays on it for its whole life.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// RestartCount is the number of times the machine container was restarted after exiting.
+	// +optional
+	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// Frozen is true when the processes of the machine container are frozen, see FrozenAnnotation.
+	// +optional
+	Frozen bool `json:"frozen,omitempty"`
+
+	// ResourceUsage is the resource usage of the machine container, refreshed periodically while the
+	// machine is provisioned.
+	// +optional
+	ResourceUsage *ResourceUsage `json:"resourceUsage,omitempty"`
+
 	// Addresses contains the associated addresses for the docker machine.
 	// +optional
 	Addresses []clusterv1alpha3.MachineAddress `json:"addresses,omitempty"`
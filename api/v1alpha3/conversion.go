@@ -0,0 +1,156 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+)
+
+// ConvertTo converts this ContainerdCluster to the hub version (v1beta1).
+func (src *ContainerdCluster) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1.ContainerdCluster)
+	if err := convert(src, dst); err != nil {
+		return err
+	}
+
+	// Restore the fields of the hub version that this version does not have.
+	restored := &infrav1.ContainerdCluster{}
+	if ok, err := utilconversion.UnmarshalData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.IPFamily = restored.Spec.IPFamily
+	dst.Spec.Network = restored.Spec.Network
+	dst.Spec.LoadBalancer.Port = restored.Spec.LoadBalancer.Port
+	dst.Spec.LoadBalancer.BackendPort = restored.Spec.LoadBalancer.BackendPort
+	dst.Spec.LoadBalancer.Frontends = restored.Spec.LoadBalancer.Frontends
+	dst.Spec.ImageRepository = restored.Spec.ImageRepository
+	dst.Spec.RegistryHostsRef = restored.Spec.RegistryHostsRef
+	dst.Spec.ImagePullSecrets = restored.Spec.ImagePullSecrets
+	dst.Spec.LoadBalancer.CustomConfigTemplate = restored.Spec.LoadBalancer.CustomConfigTemplate
+	dst.Spec.LoadBalancer.ExternallyManaged = restored.Spec.LoadBalancer.ExternallyManaged
+	dst.Spec.LoadBalancer.Type = restored.Spec.LoadBalancer.Type
+	dst.Spec.LoadBalancer.HostAddress = restored.Spec.LoadBalancer.HostAddress
+	dst.Status.LoadBalancerBackends = restored.Status.LoadBalancerBackends
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1beta1) to this version.
+func (dst *ContainerdCluster) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1.ContainerdCluster)
+	if err := convert(src, dst); err != nil {
+		return err
+	}
+
+	// Preserve the hub version in an annotation, for the fields that this version does not have.
+	return utilconversion.MarshalData(src, dst)
+}
+
+// ConvertTo converts this ContainerdClusterList to the hub version (v1beta1).
+func (src *ContainerdClusterList) ConvertTo(dstRaw conversion.Hub) error {
+	return convert(src, dstRaw.(*infrav1.ContainerdClusterList))
+}
+
+// ConvertFrom converts from the hub version (v1beta1) to this version.
+func (dst *ContainerdClusterList) ConvertFrom(srcRaw conversion.Hub) error {
+	return convert(srcRaw.(*infrav1.ContainerdClusterList), dst)
+}
+
+// ConvertTo converts this ContainerdMachine to the hub version (v1beta1).
+func (src *ContainerdMachine) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1.ContainerdMachine)
+	if err := convert(src, dst); err != nil {
+		return err
+	}
+
+	// Restore the fields of the hub version that this version does not have.
+	restored := &infrav1.ContainerdMachine{}
+	if ok, err := utilconversion.UnmarshalData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.ImagePullSecrets = restored.Spec.ImagePullSecrets
+	dst.Spec.ExtraPortMappings = restored.Spec.ExtraPortMappings
+	dst.Spec.StaticIP = restored.Spec.StaticIP
+	dst.Spec.MACAddress = restored.Spec.MACAddress
+	dst.Spec.IsolationProfile = restored.Spec.IsolationProfile
+	dst.Spec.KubeletExtraArgs = restored.Spec.KubeletExtraArgs
+	dst.Spec.KubeletConfigPatch = restored.Spec.KubeletConfigPatch
+	dst.Spec.NodeLabels = restored.Spec.NodeLabels
+	dst.Spec.NodeAnnotations = restored.Spec.NodeAnnotations
+	dst.Spec.NodeTaints = restored.Spec.NodeTaints
+	dst.Spec.Drain = restored.Spec.Drain
+	restoreMounts(dst.Spec.ExtraMounts, restored.Spec.ExtraMounts)
+	dst.Status.ContainerID = restored.Status.ContainerID
+	dst.Status.ContainerState = restored.Status.ContainerState
+	dst.Status.ImagePulled = restored.Status.ImagePulled
+	dst.Status.BootstrapExitCode = restored.Status.BootstrapExitCode
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1beta1) to this version.
+func (dst *ContainerdMachine) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1.ContainerdMachine)
+	if err := convert(src, dst); err != nil {
+		return err
+	}
+
+	// Preserve the hub version in an annotation, for the fields that this version does not have.
+	return utilconversion.MarshalData(src, dst)
+}
+
+// ConvertTo converts this ContainerdMachineList to the hub version (v1beta1).
+func (src *ContainerdMachineList) ConvertTo(dstRaw conversion.Hub) error {
+	return convert(src, dstRaw.(*infrav1.ContainerdMachineList))
+}
+
+// ConvertFrom converts from the hub version (v1beta1) to this version.
+func (dst *ContainerdMachineList) ConvertFrom(srcRaw conversion.Hub) error {
+	return convert(srcRaw.(*infrav1.ContainerdMachineList), dst)
+}
+
+// restoreMounts restores the type and the propagation of the mounts, which this version does not have,
+// of the mounts still at the same path.
+func restoreMounts(mounts, restored []infrav1.Mount) {
+	for i := range mounts {
+		if i < len(restored) && mounts[i].ContainerPath == restored[i].ContainerPath {
+			mounts[i].Type = restored[i].Type
+			mounts[i].Propagation = restored[i].Propagation
+		}
+	}
+}
+
+// convert converts the object between the v1alpha3 and v1beta1 versions, whose schemas are the same
+// but for the fields added in v1beta1, which are dropped: the Cluster API types they embed, the
+// conditions, failure domains and addresses, moved to v1beta1 with the same fields. The API version
+// and kind of the destination are kept.
+func convert(src, dst runtime.Object) error {
+	gvk := dst.GetObjectKind().GroupVersionKind()
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return err
+	}
+	dst.GetObjectKind().SetGroupVersionKind(gvk)
+	return nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+)
+
+func TestContainerdClusterConversion(t *testing.T) {
+	g := NewWithT(t)
+
+	src := &ContainerdCluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "ContainerdCluster"},
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"},
+		Spec: ContainerdClusterSpec{
+			ControlPlaneEndpoint: APIEndpoint{Host: "172.18.0.2", Port: 6443},
+			FailureDomains:       clusterv1alpha3.FailureDomains{"fd1": {ControlPlane: true}},
+		},
+		Status: ContainerdClusterStatus{
+			Ready:      true,
+			Conditions: clusterv1alpha3.Conditions{{Type: "Ready", Status: corev1.ConditionTrue}},
+		},
+	}
+
+	hub := &infrav1.ContainerdCluster{TypeMeta: metav1.TypeMeta{APIVersion: infrav1.GroupVersion.String(), Kind: "ContainerdCluster"}}
+	g.Expect(src.ConvertTo(hub)).To(Succeed())
+	g.Expect(hub.APIVersion).To(Equal(infrav1.GroupVersion.String()))
+	g.Expect(hub.Spec.ControlPlaneEndpoint.Port).To(Equal(6443))
+	g.Expect(hub.Spec.FailureDomains["fd1"].ControlPlane).To(BeTrue())
+	g.Expect(hub.Status.Conditions).To(HaveLen(1))
+
+	dst := &ContainerdCluster{TypeMeta: src.TypeMeta}
+	g.Expect(dst.ConvertFrom(hub)).To(Succeed())
+	g.Expect(dst.Annotations).To(HaveKey(utilconversion.DataAnnotation))
+	dst.Annotations = nil
+	g.Expect(dst).To(Equal(src))
+}
+
+func TestContainerdClusterConversionRestoresHubFields(t *testing.T) {
+	g := NewWithT(t)
+
+	hub := &infrav1.ContainerdCluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: infrav1.GroupVersion.String(), Kind: "ContainerdCluster"},
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"},
+		Spec: infrav1.ContainerdClusterSpec{
+			IPFamily:         infrav1.IPv6IPFamily,
+			Network:          &infrav1.ContainerdNetwork{NodeSubnet: "10.90.0.0/24,fd00:10:90::/64", MTU: 1400},
+			ImageRepository:  "registry.example.com/mirror",
+			RegistryHostsRef: &corev1.LocalObjectReference{Name: "registry-hosts"},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-credentials"}},
+			LoadBalancer: infrav1.ContainerdLoadBalancer{
+				Type:                 infrav1.NginxLoadBalancerType,
+				Port:                 7443,
+				ExternallyManaged:    true,
+				CustomConfigTemplate: "frontend control-plane\n  bind *:{{ .ControlPlanePort }}\n",
+				Frontends:            []infrav1.LoadBalancerFrontend{{Name: "konnectivity", Port: 8132, BackendPort: 8132}},
+			},
+		},
+		Status: infrav1.ContainerdClusterStatus{
+			LoadBalancerBackends: []string{"172.18.0.3:6443"},
+		},
+	}
+
+	spoke := &ContainerdCluster{TypeMeta: metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "ContainerdCluster"}}
+	g.Expect(spoke.ConvertFrom(hub)).To(Succeed())
+
+	restored := &infrav1.ContainerdCluster{TypeMeta: hub.TypeMeta}
+	g.Expect(spoke.ConvertTo(restored)).To(Succeed())
+	g.Expect(restored.Annotations).ToNot(HaveKey(utilconversion.DataAnnotation))
+	g.Expect(restored.Spec.IPFamily).To(Equal(hub.Spec.IPFamily))
+	g.Expect(restored.Spec.Network).To(Equal(hub.Spec.Network))
+	g.Expect(restored.Spec.LoadBalancer).To(Equal(hub.Spec.LoadBalancer))
+	g.Expect(restored.Spec.ImageRepository).To(Equal(hub.Spec.ImageRepository))
+	g.Expect(restored.Spec.RegistryHostsRef).To(Equal(hub.Spec.RegistryHostsRef))
+	g.Expect(restored.Spec.ImagePullSecrets).To(Equal(hub.Spec.ImagePullSecrets))
+	g.Expect(restored.Status.LoadBalancerBackends).To(Equal(hub.Status.LoadBalancerBackends))
+}
+
+func TestContainerdMachineConversion(t *testing.T) {
+	g := NewWithT(t)
+
+	providerID := "containerd://default/cluster-md-0"
+	src := &ContainerdMachine{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "ContainerdMachine"},
+		ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+		Spec: ContainerdMachineSpec{
+			ProviderID:  &providerID,
+			CustomImage: "kindest/node:v1.23.3",
+			ExtraMounts: []Mount{{ContainerPath: "/var/lib/data", HostPath: "/data"}},
+		},
+		Status: ContainerdMachineStatus{
+			Ready:     true,
+			Addresses: []clusterv1alpha3.MachineAddress{{Type: clusterv1alpha3.MachineInternalIP, Address: "172.18.0.3"}},
+		},
+	}
+
+	hub := &infrav1.ContainerdMachine{}
+	g.Expect(src.ConvertTo(hub)).To(Succeed())
+	g.Expect(*hub.Spec.ProviderID).To(Equal(providerID))
+	g.Expect(hub.Status.Addresses).To(HaveLen(1))
+
+	dst := &ContainerdMachine{TypeMeta: src.TypeMeta}
+	g.Expect(dst.ConvertFrom(hub)).To(Succeed())
+	g.Expect(dst.Annotations).To(HaveKey(utilconversion.DataAnnotation))
+	dst.Annotations = nil
+	g.Expect(dst).To(Equal(src))
+
+	list := &ContainerdMachineList{Items: []ContainerdMachine{*src}}
+	hubList := &infrav1.ContainerdMachineList{}
+	g.Expect(list.ConvertTo(hubList)).To(Succeed())
+	g.Expect(hubList.Items).To(HaveLen(1))
+	g.Expect(hubList.Items[0].Spec.CustomImage).To(Equal(src.Spec.CustomImage))
+}
+
+func TestFuzzyConversion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	g := NewWithT(t)
+	g.Expect(AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	t.Run("for ContainerdCluster", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme: scheme,
+		Hub:    &infrav1.ContainerdCluster{},
+		Spoke:  &ContainerdCluster{},
+	}))
+
+	t.Run("for ContainerdMachine", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme: scheme,
+		Hub:    &infrav1.ContainerdMachine{},
+		Spoke:  &ContainerdMachine{},
+	}))
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+// Conditions and condition Reasons for the ContainerdCluster object.
+
+const (
+	// LoadBalancerAvailableCondition documents the availability of the container implementing the
+	// load balancer of the cluster.
+	LoadBalancerAvailableCondition clusterv1.ConditionType = "LoadBalancerAvailable"
+
+	// LoadBalancerProvisioningFailedReason (Severity=Warning) documents a ContainerdCluster controller
+	// detecting an error while provisioning the container implementing the load balancer; those kind
+	// of errors are usually transient and failed provisioning are automatically re-tried by the
+	// controller.
+	LoadBalancerProvisioningFailedReason = "LoadBalancerProvisioningFailed"
+
+	// LoadBalancerNotRunningReason (Severity=Warning) documents a ContainerdCluster controller
+	// detecting the container implementing the load balancer is not running, e.g. while it is
+	// restarted.
+	LoadBalancerNotRunningReason = "LoadBalancerNotRunning"
+)
+
+// Conditions and condition Reasons for the ContainerdMachine object.
+
+const (
+	// ImagePulledCondition documents the pull of the image of the container hosting the machine
+	// onto its host.
+	ImagePulledCondition clusterv1.ConditionType = "ImagePulled"
+
+	// WaitingForClusterInfrastructureReason (Severity=Info) documents a ContainerdMachine waiting for
+	// the cluster infrastructure to be ready before starting to create the container hosting it.
+	WaitingForClusterInfrastructureReason = "WaitingForClusterInfrastructure"
+
+	// WaitingForBootstrapDataReason (Severity=Info) documents a ContainerdMachine waiting for the
+	// bootstrap script to be ready before starting to create the container hosting it.
+	WaitingForBootstrapDataReason = "WaitingForBootstrapData"
+
+	// ImagePullingReason (Severity=Info) documents a ContainerdMachine pulling the image of the
+	// machine, the condition message holding the progress of the pull.
+	ImagePullingReason = "ImagePulling"
+
+	// ImagePullFailedReason (Severity=Warning) documents a ContainerdMachine controller detecting an
+	// error while pulling the image of the machine; those kind of errors are usually transient, e.g.
+	// a registry not reachable, and failed pulls are automatically re-tried by the controller.
+	ImagePullFailedReason = "ImagePullFailed"
+)
+
+const (
+	// ContainerProvisionedCondition documents the status of the provisioning of the container
+	// hosting a ContainerdMachine.
+	ContainerProvisionedCondition clusterv1.ConditionType = "ContainerProvisioned"
+
+	// ContainerProvisioningFailedReason (Severity=Warning) documents a ContainerdMachine controller
+	// detecting an error while provisioning the container hosting the machine; those kind of errors
+	// are usually transient and failed provisioning are automatically re-tried by the controller.
+	ContainerProvisioningFailedReason = "ContainerProvisioningFailed"
+
+	// ContainerDeletedReason (Severity=Error) documents a ContainerdMachine controller detecting the
+	// container hosting the machine has been deleted unexpectedly.
+	ContainerDeletedReason = "ContainerDeleted"
+)
+
+const (
+	// BootstrapExecSucceededCondition provides an observation of the ContainerdMachine bootstrap
+	// process. It is set based on successful execution of bootstrap commands and on the existence of
+	// the /run/cluster-api/bootstrap-success.complete file.
+	// The condition gets generated after ContainerProvisionedCondition is True.
+	//
+	// NOTE as a difference from other providers, container provisioning and bootstrap are directly
+	// managed by the ContainerdMachine controller (not by cloud-init).
+	BootstrapExecSucceededCondition clusterv1.ConditionType = "BootstrapExecSucceeded"
+
+	// BootstrappingReason documents (Severity=Info) a ContainerdMachine currently executing the
+	// bootstrap script that creates the Kubernetes node on the newly provisioned machine container.
+	BootstrappingReason = "Bootstrapping"
+
+	// BootstrapFailedReason documents (Severity=Warning) a ContainerdMachine controller detecting an
+	// error while bootstrapping the Kubernetes node on the machine just provisioned; those kind of
+	// errors are usually transient and failed bootstrap are automatically re-tried by the controller.
+	BootstrapFailedReason = "BootstrapFailed"
+)
+
+const (
+	// NodeProvisionedCondition documents the registration of the node of the ContainerdMachine in the
+	// workload cluster, with the provider ID of the machine set on it.
+	// The condition gets generated after BootstrapExecSucceededCondition is True.
+	NodeProvisionedCondition clusterv1.ConditionType = "NodeProvisioned"
+)
+
+const (
+	// MachineHealthyCondition reports the result of the health check of the machine container, it is
+	// only set on machines with a health check.
+	MachineHealthyCondition clusterv1.ConditionType = "MachineHealthy"
+
+	// HealthCheckStartingReason (Severity=Info) is used while the machine container did not pass its
+	// health check yet, and did not fail it enough times to be unhealthy.
+	HealthCheckStartingReason = "HealthCheckStarting"
+
+	// HealthCheckFailedReason (Severity=Error) is used when the machine container failed its health
+	// check the configured number of times in a row, or is not running.
+	HealthCheckFailedReason = "HealthCheckFailed"
+
+	// NodeMetadataAppliedCondition reports whether the node labels, annotations and taints of the
+	// machine were applied to its node in the workload cluster, it is only set on machines with some.
+	NodeMetadataAppliedCondition clusterv1.ConditionType = "NodeMetadataApplied"
+
+	// WaitingForNodeReason (Severity=Info) is used while the node of the machine did not register in
+	// the workload cluster yet, so that its provider ID or its node metadata cannot be set.
+	WaitingForNodeReason = "WaitingForNode"
+)
+
+const (
+	// NodeDrainedCondition reports the drain of the node of a deleted machine before its container is
+	// deleted, it is only set on machines with a drain.
+	NodeDrainedCondition clusterv1.ConditionType = "NodeDrained"
+
+	// NodeDrainTimeoutReason (Severity=Warning) is used when the pods of the node were not all evicted
+	// within the drain timeout, and the machine container is deleted anyway.
+	NodeDrainTimeoutReason = "NodeDrainTimeout"
+)
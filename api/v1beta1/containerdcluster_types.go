@@ -0,0 +1,410 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+const (
+	// ClusterFinalizer allows ContainerdClusterReconciler to clean up resources associated with ContainerdCluster before
+	// removing it from the apiserver.
+	ClusterFinalizer = "containerdcluster.infrastructure.cluster.x-k8s.io"
+)
+
+// FailureDomainHostAttribute is the attribute of a failure domain naming the containerd host of the
+// pool its machines are placed on.
+const FailureDomainHostAttribute = "host"
+
+// ContainerdClusterSpec defines the desired state of ContainerdCluster
+type ContainerdClusterSpec struct {
+	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+
+	// ControlPlaneEndpoint represents the endpoint used to communicate with the control plane.
+	// +optional
+	ControlPlaneEndpoint APIEndpoint `json:"controlPlaneEndpoint"`
+
+	// FailureDomains are not usulaly defined on the spec.
+	// The containerd provider is special since failure domains don't mean anything in a local environment.
+	// Instead, the docker cluster controller will simply copy these into the Status and allow the Cluster API
+	// controllers to do what they will with the defined failure domains.
+	// With a pool of containerd hosts, the machines of a failure domain are placed on the hosts its
+	// attributes select: the host named by the "host" attribute and the hosts with the other
+	// attributes as labels. The machines of a failure domain without attributes are placed on the
+	// hosts of the failure domain of the same name in the hosts configuration. The failure domains of
+	// the hosts are the failure domains of the cluster if none is set.
+	// +optional
+	FailureDomains clusterv1.FailureDomains `json:"failureDomains,omitempty"`
+
+	// LoadBalancer allows defining configurations for the cluster load balancer.
+	// +optional
+	LoadBalancer ContainerdLoadBalancer `json:"loadBalancer,omitempty"`
+
+	// RegistryCredentialsRef is a reference to a Secret of type kubernetes.io/dockerconfigjson,
+	// in the same namespace as the ContainerdCluster, holding the credentials used to pull
+	// images from private registries.
+	// +optional
+	RegistryCredentialsRef *corev1.LocalObjectReference `json:"registryCredentialsRef,omitempty"`
+
+	// ImagePullSecrets are references to Secrets of type kubernetes.io/dockerconfigjson, in the
+	// same namespace as the ContainerdCluster, holding credentials used both to pull the images of
+	// the machines on the hosts and by the kubelet of the machines, from /var/lib/kubelet/config.json.
+	// The credentials of a registry in a later Secret take precedence, and over the ones of the
+	// RegistryCredentialsRef.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// RegistryMirrors configures the endpoints used to pull images from registries, e.g. to
+	// redirect kindest image pulls to an internal mirror. They take precedence over the
+	// registry hosts configuration of the controller.
+	// +optional
+	RegistryMirrors []RegistryMirror `json:"registryMirrors,omitempty"`
+
+	// RegistryHostsRef is a reference to a ConfigMap, in the same namespace as the ContainerdCluster,
+	// of the containerd registry hosts configuration of the machines, so that the images pulled in the
+	// workload cluster also use the mirrors. Each key is the directory of a registry host under
+	// /etc/containerd/certs.d, e.g. "docker.io", "_default" or "localhost_5000_" for localhost:5000,
+	// and its value the hosts.toml written in it. It is written into the machines before they are
+	// bootstrapped, and updated when it changes. The containerd of the machine image must read the
+	// certs.d directory, with the config_path of its CRI registry configuration.
+	// +optional
+	RegistryHostsRef *corev1.LocalObjectReference `json:"registryHostsRef,omitempty"`
+
+	// ImageRepository replaces the registry of the images of the machines, of the load balancer and
+	// preloaded into the machines, e.g. so that air-gapped clusters pull everything from an internal
+	// registry. The images keep their path in the repository, with "registry.example.com/mirror"
+	// "kindest/node:v1.23.3" is pulled as "registry.example.com/mirror/kindest/node:v1.23.3". The
+	// image repository of the load balancer takes precedence over it.
+	// +optional
+	ImageRepository string `json:"imageRepository,omitempty"`
+
+	// HostAliases are entries added to the /etc/hosts file of the machines, next to the entries of
+	// the load balancer and of the other machines of the cluster, so that hosts can be reached by
+	// name without an external DNS.
+	// +optional
+	HostAliases []HostAlias `json:"hostAliases,omitempty"`
+
+	// IPFamily is the IP family of the cluster. The machines of IPv6 and dual-stack clusters get an
+	// IPv4 and an IPv6 address, the IPv6 one is used by the nodes and for the control plane endpoint
+	// of IPv6 clusters. The family of the pod and service CIDRs of the Cluster by default.
+	// +optional
+	IPFamily IPFamily `json:"ipFamily,omitempty"`
+
+	// Network configures a CNI network dedicated to the cluster its machines are attached to,
+	// instead of the network shared by the clusters of the host.
+	// +optional
+	Network *ContainerdNetwork `json:"network,omitempty"`
+}
+
+// IPFamily is the IP family of the addresses of the nodes and of the services of a cluster.
+// +kubebuilder:validation:Enum=IPv4;IPv6;DualStack
+type IPFamily string
+
+const (
+	// IPv4IPFamily is the family of the clusters with IPv4 addresses only.
+	IPv4IPFamily IPFamily = "IPv4"
+	// IPv6IPFamily is the family of the clusters with IPv6 addresses only.
+	IPv6IPFamily IPFamily = "IPv6"
+	// DualStackIPFamily is the family of the clusters with both IPv4 and IPv6 addresses, IPv4 first.
+	DualStackIPFamily IPFamily = "DualStack"
+)
+
+// ContainerdNetwork configures the bridge network of the machines of a cluster.
+type ContainerdNetwork struct {
+	// Name is the name of the CNI network, "capc-<namespace>-<name>" of the ContainerdCluster by
+	// default. A CNI configuration of the same name on the hosts takes precedence over the one
+	// created by the controller.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9][a-zA-Z0-9_.\-]*$`
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Bridge is the name of the bridge device of the network on the hosts, derived from the name of
+	// the network by default.
+	// +kubebuilder:validation:MaxLength=15
+	// +optional
+	Bridge string `json:"bridge,omitempty"`
+
+	// NodeSubnet is the subnet the addresses of the machines are allocated from, e.g. "10.90.0.0/24",
+	// or the comma-separated IPv4 and IPv6 subnets of IPv6 and dual-stack clusters, e.g.
+	// "10.90.0.0/24,fd00:10:90::/64".
+	NodeSubnet string `json:"nodeSubnet"`
+
+	// PodSubnet is the subnet of the pods of the cluster, or the comma-separated IPv4 and IPv6
+	// subnets of dual-stack clusters. It must not overlap the node subnet.
+	// +optional
+	PodSubnet string `json:"podSubnet,omitempty"`
+
+	// ServiceSubnet is the subnet of the services of the cluster, or the comma-separated IPv4 and
+	// IPv6 subnets of dual-stack clusters. It must not overlap the node subnet nor the pod subnet.
+	// +optional
+	ServiceSubnet string `json:"serviceSubnet,omitempty"`
+
+	// MTU is the MTU of the bridge and of the interfaces of the machines, the default of the hosts
+	// if not set.
+	// +kubebuilder:validation:Minimum=576
+	// +optional
+	MTU int32 `json:"mtu,omitempty"`
+}
+
+// HostAlias maps an IP address to host names in the /etc/hosts file of the machines.
+type HostAlias struct {
+	// IP is the IP address of the hosts.
+	IP string `json:"ip"`
+
+	// Hostnames are the names of the hosts at the IP address.
+	// +kubebuilder:validation:MinItems=1
+	Hostnames []string `json:"hostnames"`
+}
+
+// RegistryMirror configures the endpoints used to pull images from a registry.
+type RegistryMirror struct {
+	// Registry is the registry host the mirror applies to, e.g. "docker.io".
+	Registry string `json:"registry"`
+
+	// Endpoints are the mirror endpoints tried in order before the registry itself,
+	// e.g. "https://mirror.example.com:5000".
+	// +optional
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	// Insecure allows plain HTTP for endpoints without a scheme and skips TLS certificate verification.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// CACert is a PEM encoded CA bundle used to verify the endpoints and the registry.
+	// +optional
+	CACert string `json:"caCert,omitempty"`
+}
+
+// ContainerdLoadBalancer allows defining configurations for the cluster load balancer.
+type ContainerdLoadBalancer struct {
+	// Type is the implementation of the load balancer, haproxy by default.
+	// +optional
+	Type LoadBalancerType `json:"type,omitempty"`
+
+	// ImageMeta allows customizing the image used for the cluster load balancer.
+	ImageMeta `json:",inline"`
+
+	// Port is the port the load balancer listens on for the API servers, 6443 by default.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// BackendPort is the port of the API servers on the control plane machines, 6443 by default.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	BackendPort int32 `json:"backendPort,omitempty"`
+
+	// HostAddress is the address of the host of the load balancer container, e.g. the address of the
+	// host on the network of the clients of the cluster, to publish the control plane endpoint on.
+	// The Port of the load balancer is then published on the port of the ControlPlaneEndpoint of the
+	// host if it is set, its host being the HostAddress, or else on a free port reserved when the
+	// container is created, the ControlPlaneEndpoint being set to the HostAddress and that port. A
+	// port of the host is used by the control plane endpoint of a single cluster. Without it, the
+	// ControlPlaneEndpoint is set to the address of the load balancer container on the machine
+	// network.
+	// +optional
+	HostAddress string `json:"hostAddress,omitempty"`
+
+	// Frontends are additional ports the load balancer listens on, forwarding the connections to
+	// other services of the cluster, e.g. an ingress controller or the konnectivity server. The ports
+	// of the load balancer are published when its container is created.
+	// +optional
+	Frontends []LoadBalancerFrontend `json:"frontends,omitempty"`
+
+	// CustomConfigTemplate is a Go template replacing the default haproxy.cfg, or nginx.conf, of the
+	// load balancer, e.g. to tune its timeouts, add a stats endpoint or log the connections. The template is
+	// executed with the ControlPlanePort, the BackendServers of the API servers by node name, IPv6,
+	// and the Frontends with their Name, Port and BackendServers. It is applied when the
+	// configuration of the load balancer is next updated, as control plane machines join or leave.
+	// +optional
+	CustomConfigTemplate string `json:"customConfigTemplate,omitempty"`
+
+	// ExternallyManaged is true when the load balancer of the cluster is provided by the user, e.g.
+	// to front the cluster with an existing load balancer: no load balancer container is created,
+	// the control plane endpoint of the cluster is required and the load balancer forwards it to
+	// the BackendPort of the control plane machines, listed in the status of the cluster. The
+	// image, port, frontends and config template of the load balancer are not used.
+	// +optional
+	ExternallyManaged bool `json:"externallyManaged,omitempty"`
+}
+
+// IsExternallyManaged returns true if the load balancer of the cluster is not managed by the provider,
+// its control plane endpoint being set by the user.
+func (lb ContainerdLoadBalancer) IsExternallyManaged() bool {
+	return lb.ExternallyManaged || lb.Type == NoneLoadBalancerType
+}
+
+// LoadBalancerType is the implementation of the load balancer of a cluster.
+// +kubebuilder:validation:Enum=haproxy;nginx;kube-vip;none
+type LoadBalancerType string
+
+const (
+	// HAProxyLoadBalancerType runs haproxy in a container of the cluster.
+	HAProxyLoadBalancerType LoadBalancerType = "haproxy"
+	// NginxLoadBalancerType runs nginx, proxying TCP streams, in a container of the cluster.
+	NginxLoadBalancerType LoadBalancerType = "nginx"
+	// KubeVIPLoadBalancerType runs kube-vip as a static pod of the control plane machines, announcing
+	// the IP address of the control plane endpoint from the leader. The address is set by the user,
+	// a free address of the network of the machines, and the port of the endpoint is the port of
+	// the API servers. There is no load balancer container and no frontends.
+	KubeVIPLoadBalancerType LoadBalancerType = "kube-vip"
+	// NoneLoadBalancerType runs no load balancer, the load balancer of the control plane endpoint is
+	// externally managed.
+	NoneLoadBalancerType LoadBalancerType = "none"
+)
+
+// DefaultAPIServerPort is the port the load balancer listens on, and the port of the API servers it
+// forwards to, if none is set.
+const DefaultAPIServerPort = 6443
+
+// LoadBalancerBackendRole is the role of the machines a load balancer frontend forwards to.
+// +kubebuilder:validation:Enum=control-plane;worker
+type LoadBalancerBackendRole string
+
+const (
+	// ControlPlaneBackendRole forwards the connections to the control plane machines.
+	ControlPlaneBackendRole LoadBalancerBackendRole = "control-plane"
+	// WorkerBackendRole forwards the connections to the worker machines.
+	WorkerBackendRole LoadBalancerBackendRole = "worker"
+)
+
+// LoadBalancerFrontend is a port of the load balancer forwarding TCP connections to a port of the
+// machines of the cluster.
+type LoadBalancerFrontend struct {
+	// Name is the name of the frontend in the load balancer configuration, control-plane and
+	// kube-apiservers are reserved.
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// Port is the port the load balancer listens on.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+
+	// HostPort is the port of the host the port of the load balancer is published on, a free port is
+	// allocated if not set.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	HostPort int32 `json:"hostPort,omitempty"`
+
+	// BackendPort is the port of the machines the connections are forwarded to.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	BackendPort int32 `json:"backendPort"`
+
+	// BackendRole is the role of the machines the connections are forwarded to, control-plane by
+	// default.
+	// +optional
+	BackendRole LoadBalancerBackendRole `json:"backendRole,omitempty"`
+}
+
+// ImageMeta allows customizing the image used for components that are not
+// originated from the Kubernetes/Kubernetes release process.
+type ImageMeta struct {
+	// ImageRepository sets the container registry to pull the load balancer image from.
+	// if not set, the repository of the load balancer type is used: "kindest" for haproxy,
+	// "docker.io/library" for nginx and "ghcr.io/kube-vip" for kube-vip.
+	// +optional
+	ImageRepository string `json:"imageRepository,omitempty"`
+
+	// ImageTag allows to specify a tag for the load balancer image.
+	// if not set, the tag of the load balancer type is used: "v20210715-a6da3463" for haproxy,
+	// "1.23.1-alpine" for nginx and "v0.5.0" for kube-vip.
+	// +optional
+	ImageTag string `json:"imageTag,omitempty"`
+}
+
+// ContainerdClusterStatus defines the observed state of ContainerdCluster
+type ContainerdClusterStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+	// Ready denotes that the docker cluster (infrastructure) is ready.
+	Ready bool `json:"ready"`
+
+	// FailureDomains don't mean much in CAPC since it's all local, but we can see how the rest of cluster API
+	// will use this if we populate it.
+	FailureDomains clusterv1.FailureDomains `json:"failureDomains,omitempty"`
+
+	// LoadBalancerBackends are the addresses of the API servers of the control plane machines, that
+	// an externally managed load balancer is expected to forward the control plane endpoint to.
+	// +optional
+	LoadBalancerBackends []string `json:"loadBalancerBackends,omitempty"`
+
+	// Conditions defines current service state of the ContainerdCluster.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// APIEndpoint represents a reachable Kubernetes API endpoint.
+type APIEndpoint struct {
+	// Host is the hostname on which the API server is serving.
+	Host string `json:"host"`
+
+	// Port is the port on which the API server is serving.
+	Port int `json:"port"`
+}
+
+// IsZero returns true if neither the host nor the port of the endpoint are set.
+func (e APIEndpoint) IsZero() bool {
+	return e.Host == "" && e.Port == 0
+}
+
+// GetConditions returns the set of conditions for this object.
+func (c *ContainerdCluster) GetConditions() clusterv1.Conditions {
+	return c.Status.Conditions
+}
+
+// SetConditions sets the conditions on this object.
+func (c *ContainerdCluster) SetConditions(conditions clusterv1.Conditions) {
+	c.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// ContainerdCluster is the Schema for the containerdclusters API
+type ContainerdCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ContainerdClusterSpec   `json:"spec,omitempty"`
+	Status ContainerdClusterStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ContainerdClusterList contains a list of ContainerdCluster
+type ContainerdClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ContainerdCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ContainerdCluster{}, &ContainerdClusterList{})
+}
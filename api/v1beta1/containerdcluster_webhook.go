@@ -0,0 +1,460 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	refdocker "github.com/containerd/containerd/reference/docker"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// maxBridgeNameLength is the maximum length of the name of a network interface on Linux.
+const maxBridgeNameLength = 15
+
+var (
+	// anchoredTagRegexp matches the tags of image references.
+	anchoredTagRegexp = regexp.MustCompile(`^` + refdocker.TagRegexp.String() + `$`)
+	// networkNameRegexp matches the valid names of CNI networks.
+	networkNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-]*$`)
+)
+
+// SetupWebhookWithManager registers the conversion and validation webhooks of ContainerdCluster with
+// the manager.
+func (c *ContainerdCluster) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(c).Complete()
+}
+
+//+kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-containerdcluster,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=containerdclusters,versions=v1beta1,name=validation.containerdcluster.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1;v1beta1
+
+var _ webhook.Validator = &ContainerdCluster{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
+func (c *ContainerdCluster) ValidateCreate() error {
+	return c.validate(nil)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+func (c *ContainerdCluster) ValidateUpdate(old runtime.Object) error {
+	oldCluster, ok := old.(*ContainerdCluster)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a ContainerdCluster but got a %T", old))
+	}
+	return c.validate(oldCluster)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+func (c *ContainerdCluster) ValidateDelete() error {
+	return nil
+}
+
+// validate returns an error listing the invalid fields of the spec, and the immutable fields changed
+// since the old version if it is set.
+func (c *ContainerdCluster) validate(old *ContainerdCluster) error {
+	specPath := field.NewPath("spec")
+	allErrs := c.Spec.validate(specPath)
+
+	// The control plane endpoint is set once, by the user or by the controller of the load balancer,
+	// the machines join the cluster through it.
+	if old != nil && !old.Spec.ControlPlaneEndpoint.IsZero() && c.Spec.ControlPlaneEndpoint != old.Spec.ControlPlaneEndpoint {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("controlPlaneEndpoint"), c.Spec.ControlPlaneEndpoint, "field is immutable once set"))
+	}
+	// The machines are attached to the network when they are created, it cannot change under them.
+	if old != nil && !reflect.DeepEqual(c.Spec.Network, old.Spec.Network) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("network"), c.Spec.Network, "field is immutable"))
+	}
+	if old != nil && c.Spec.IPFamily != old.Spec.IPFamily {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("ipFamily"), c.Spec.IPFamily, "field is immutable"))
+	}
+	if old != nil && c.Spec.LoadBalancer.ExternallyManaged != old.Spec.LoadBalancer.ExternallyManaged {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("loadBalancer", "externallyManaged"), c.Spec.LoadBalancer.ExternallyManaged, "field is immutable"))
+	}
+	if old != nil && c.Spec.LoadBalancer.Type != old.Spec.LoadBalancer.Type {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("loadBalancer", "type"), c.Spec.LoadBalancer.Type, "field is immutable"))
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ContainerdCluster").GroupKind(), c.Name, allErrs)
+}
+
+// validate returns the errors of the invalid fields of the spec.
+func (s *ContainerdClusterSpec) validate(path *field.Path) field.ErrorList {
+	allErrs := s.ControlPlaneEndpoint.validate(path.Child("controlPlaneEndpoint"))
+	allErrs = append(allErrs, s.LoadBalancer.validate(path.Child("loadBalancer"))...)
+	switch {
+	case s.LoadBalancer.IsExternallyManaged():
+		allErrs = append(allErrs, s.validateExternalLoadBalancer(path)...)
+	case s.LoadBalancer.Type == KubeVIPLoadBalancerType:
+		allErrs = append(allErrs, s.validateKubeVIPLoadBalancer(path)...)
+	}
+	if s.LoadBalancer.HostAddress != "" {
+		allErrs = append(allErrs, s.validateLoadBalancerHostAddress(path)...)
+	}
+	allErrs = append(allErrs, ImageMeta{ImageRepository: s.ImageRepository}.validate(path)...)
+	allErrs = append(allErrs, validateImagePullSecrets(path.Child("imagePullSecrets"), s.ImagePullSecrets)...)
+	allErrs = append(allErrs, s.validateFailureDomains(path.Child("failureDomains"))...)
+	for i, alias := range s.HostAliases {
+		allErrs = append(allErrs, alias.validate(path.Child("hostAliases").Index(i))...)
+	}
+	if s.Network != nil {
+		allErrs = append(allErrs, s.Network.validate(path.Child("network"), s.IPFamily)...)
+	}
+	return allErrs
+}
+
+// validateExternalLoadBalancer returns the errors of an externally managed load balancer without
+// control plane endpoint, or with the settings of the load balancer container.
+func (s *ContainerdClusterSpec) validateExternalLoadBalancer(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if s.ControlPlaneEndpoint.IsZero() {
+		allErrs = append(allErrs, field.Required(path.Child("controlPlaneEndpoint"), "the control plane endpoint is required with an externally managed load balancer"))
+	}
+	lbPath := path.Child("loadBalancer")
+	const msg = "must not be set with an externally managed load balancer"
+	if s.LoadBalancer.ImageRepository != "" {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("imageRepository"), msg))
+	}
+	if s.LoadBalancer.ImageTag != "" {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("imageTag"), msg))
+	}
+	if s.LoadBalancer.Port != 0 {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("port"), msg))
+	}
+	if len(s.LoadBalancer.Frontends) > 0 {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("frontends"), msg))
+	}
+	if s.LoadBalancer.CustomConfigTemplate != "" {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("customConfigTemplate"), msg))
+	}
+	if s.LoadBalancer.HostAddress != "" {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("hostAddress"), msg))
+	}
+	return allErrs
+}
+
+// validateKubeVIPLoadBalancer returns the errors of a kube-vip load balancer without a control plane
+// endpoint on an IP address and the port of the API servers, or with the settings of a load balancer
+// container.
+func (s *ContainerdClusterSpec) validateKubeVIPLoadBalancer(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	endpointPath := path.Child("controlPlaneEndpoint")
+	if s.ControlPlaneEndpoint.IsZero() {
+		allErrs = append(allErrs, field.Required(endpointPath, "the control plane endpoint is required with a kube-vip load balancer"))
+	} else {
+		if net.ParseIP(s.ControlPlaneEndpoint.Host) == nil {
+			allErrs = append(allErrs, field.Invalid(endpointPath.Child("host"), s.ControlPlaneEndpoint.Host, "must be an IP address with a kube-vip load balancer"))
+		}
+		backendPort := s.LoadBalancer.BackendPort
+		if backendPort == 0 {
+			backendPort = DefaultAPIServerPort
+		}
+		if s.ControlPlaneEndpoint.Port != int(backendPort) {
+			allErrs = append(allErrs, field.Invalid(endpointPath.Child("port"), s.ControlPlaneEndpoint.Port, fmt.Sprintf("must be the port of the API servers, %d, with a kube-vip load balancer", backendPort)))
+		}
+	}
+	lbPath := path.Child("loadBalancer")
+	const msg = "must not be set with a kube-vip load balancer"
+	if s.LoadBalancer.Port != 0 {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("port"), msg))
+	}
+	if len(s.LoadBalancer.Frontends) > 0 {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("frontends"), msg))
+	}
+	if s.LoadBalancer.CustomConfigTemplate != "" {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("customConfigTemplate"), msg))
+	}
+	if s.LoadBalancer.HostAddress != "" {
+		allErrs = append(allErrs, field.Forbidden(lbPath.Child("hostAddress"), msg))
+	}
+	return allErrs
+}
+
+// validateLoadBalancerHostAddress returns the errors of an invalid host address of the load balancer
+// container, or of a control plane endpoint on another host.
+func (s *ContainerdClusterSpec) validateLoadBalancerHostAddress(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	hostAddress := s.LoadBalancer.HostAddress
+	if net.ParseIP(hostAddress) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(hostAddress) {
+			allErrs = append(allErrs, field.Invalid(path.Child("loadBalancer", "hostAddress"), hostAddress, "must be an IP address or a DNS name: "+msg))
+		}
+	}
+	if !s.ControlPlaneEndpoint.IsZero() && s.ControlPlaneEndpoint.Host != hostAddress {
+		allErrs = append(allErrs, field.Invalid(path.Child("controlPlaneEndpoint", "host"), s.ControlPlaneEndpoint.Host, "must be the host address of the load balancer"))
+	}
+	return allErrs
+}
+
+// validate returns the errors of an endpoint set without a valid host or port.
+func (e APIEndpoint) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if e.IsZero() {
+		return nil
+	}
+	if e.Host == "" {
+		allErrs = append(allErrs, field.Required(path.Child("host"), "the host of the endpoint is required with its port"))
+	} else if net.ParseIP(e.Host) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(e.Host) {
+			allErrs = append(allErrs, field.Invalid(path.Child("host"), e.Host, "must be an IP address or a DNS name: "+msg))
+		}
+	}
+	for _, msg := range validation.IsValidPortNum(e.Port) {
+		allErrs = append(allErrs, field.Invalid(path.Child("port"), e.Port, msg))
+	}
+	return allErrs
+}
+
+// validate returns the errors of an invalid type, image, port or config template of the load balancer, and
+// of frontends with the same name or listening on the same port.
+func (lb ContainerdLoadBalancer) validate(path *field.Path) field.ErrorList {
+	allErrs := lb.ImageMeta.validate(path)
+	switch lb.Type {
+	case "", HAProxyLoadBalancerType, NginxLoadBalancerType, KubeVIPLoadBalancerType, NoneLoadBalancerType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("type"), lb.Type, []string{string(HAProxyLoadBalancerType),
+			string(NginxLoadBalancerType), string(KubeVIPLoadBalancerType), string(NoneLoadBalancerType)}))
+	}
+	if lb.ExternallyManaged && lb.Type != "" && lb.Type != NoneLoadBalancerType {
+		allErrs = append(allErrs, field.Invalid(path.Child("externallyManaged"), lb.ExternallyManaged, "must not be set with a load balancer of type "+string(lb.Type)))
+	}
+	for _, port := range []struct {
+		name  string
+		value int32
+	}{{"port", lb.Port}, {"backendPort", lb.BackendPort}} {
+		if port.value == 0 {
+			continue
+		}
+		for _, msg := range validation.IsValidPortNum(int(port.value)) {
+			allErrs = append(allErrs, field.Invalid(path.Child(port.name), port.value, msg))
+		}
+	}
+
+	if lb.CustomConfigTemplate != "" {
+		if _, err := template.New("loadbalancer-config").Parse(lb.CustomConfigTemplate); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("customConfigTemplate"), lb.CustomConfigTemplate, err.Error()))
+		}
+	}
+
+	controlPlanePort := lb.Port
+	if controlPlanePort == 0 {
+		controlPlanePort = DefaultAPIServerPort
+	}
+	names := map[string]bool{}
+	ports := map[int32]bool{controlPlanePort: true}
+	for i, frontend := range lb.Frontends {
+		frontendPath := path.Child("frontends").Index(i)
+		for _, msg := range validation.IsDNS1123Label(frontend.Name) {
+			allErrs = append(allErrs, field.Invalid(frontendPath.Child("name"), frontend.Name, msg))
+		}
+		if frontend.Name == "control-plane" || frontend.Name == "kube-apiservers" {
+			allErrs = append(allErrs, field.Invalid(frontendPath.Child("name"), frontend.Name, "name is reserved for the API servers"))
+		}
+		if names[frontend.Name] {
+			allErrs = append(allErrs, field.Duplicate(frontendPath.Child("name"), frontend.Name))
+		}
+		names[frontend.Name] = true
+		for _, msg := range validation.IsValidPortNum(int(frontend.Port)) {
+			allErrs = append(allErrs, field.Invalid(frontendPath.Child("port"), frontend.Port, msg))
+		}
+		if ports[frontend.Port] {
+			allErrs = append(allErrs, field.Duplicate(frontendPath.Child("port"), frontend.Port))
+		}
+		ports[frontend.Port] = true
+		if frontend.HostPort != 0 {
+			for _, msg := range validation.IsValidPortNum(int(frontend.HostPort)) {
+				allErrs = append(allErrs, field.Invalid(frontendPath.Child("hostPort"), frontend.HostPort, msg))
+			}
+		}
+		for _, msg := range validation.IsValidPortNum(int(frontend.BackendPort)) {
+			allErrs = append(allErrs, field.Invalid(frontendPath.Child("backendPort"), frontend.BackendPort, msg))
+		}
+		switch frontend.BackendRole {
+		case "", ControlPlaneBackendRole, WorkerBackendRole:
+		default:
+			allErrs = append(allErrs, field.NotSupported(frontendPath.Child("backendRole"), frontend.BackendRole,
+				[]string{string(ControlPlaneBackendRole), string(WorkerBackendRole)}))
+		}
+	}
+	return allErrs
+}
+
+// validate returns the errors of an image repository or tag that make an invalid image reference.
+func (m ImageMeta) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if m.ImageRepository != "" {
+		if _, err := refdocker.ParseNormalizedNamed(m.ImageRepository); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("imageRepository"), m.ImageRepository, err.Error()))
+		}
+	}
+	if m.ImageTag != "" && !anchoredTagRegexp.MatchString(m.ImageTag) {
+		allErrs = append(allErrs, field.Invalid(path.Child("imageTag"), m.ImageTag, "must be a valid image tag"))
+	}
+	return allErrs
+}
+
+// validate returns the errors of an invalid network name or subnet, of subnets of another IP family
+// than the cluster, and of subnets overlapping. The machines of IPv6 clusters may have IPv4
+// addresses, e.g. to reach IPv4 registries.
+func (n *ContainerdNetwork) validate(path *field.Path, ipFamily IPFamily) field.ErrorList {
+	var allErrs field.ErrorList
+	if n.Name != "" && !networkNameRegexp.MatchString(n.Name) {
+		allErrs = append(allErrs, field.Invalid(path.Child("name"), n.Name, "must be a valid CNI network name"))
+	}
+	if len(n.Bridge) > maxBridgeNameLength {
+		allErrs = append(allErrs, field.TooLong(path.Child("bridge"), n.Bridge, maxBridgeNameLength))
+	}
+
+	var subnets []*net.IPNet
+	for _, subnet := range []struct {
+		name, value string
+		families    []IPFamily
+	}{
+		{name: "nodeSubnet", value: n.NodeSubnet, families: map[IPFamily][]IPFamily{
+			IPv4IPFamily:      {IPv4IPFamily},
+			IPv6IPFamily:      {IPv6IPFamily, DualStackIPFamily},
+			DualStackIPFamily: {DualStackIPFamily},
+		}[ipFamily]},
+		{name: "podSubnet", value: n.PodSubnet, families: []IPFamily{ipFamily}},
+		{name: "serviceSubnet", value: n.ServiceSubnet, families: []IPFamily{ipFamily}},
+	} {
+		subnetPath := path.Child(subnet.name)
+		if subnet.value == "" {
+			if subnet.name == "nodeSubnet" {
+				allErrs = append(allErrs, field.Required(subnetPath, "the subnet of the machines is required"))
+			}
+			continue
+		}
+		ipNets, family, err := parseSubnets(subnet.value)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(subnetPath, subnet.value, err.Error()))
+			continue
+		}
+		if ipFamily != "" && !containsIPFamily(subnet.families, family) {
+			allErrs = append(allErrs, field.Invalid(subnetPath, subnet.value, fmt.Sprintf("must be of the %s IP family of the cluster", ipFamily)))
+		}
+		for _, ipNet := range ipNets {
+			for _, other := range subnets {
+				if ipNet.Contains(other.IP) || other.Contains(ipNet.IP) {
+					allErrs = append(allErrs, field.Invalid(subnetPath, subnet.value, fmt.Sprintf("must not overlap %s", other)))
+				}
+			}
+		}
+		subnets = append(subnets, ipNets...)
+	}
+	return allErrs
+}
+
+// parseSubnets parses comma-separated subnets, at most one per IP family, and returns them with
+// the family they make.
+func parseSubnets(value string) ([]*net.IPNet, IPFamily, error) {
+	var ipNets []*net.IPNet
+	var ipv4, ipv6 bool
+	for _, cidr := range strings.Split(value, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, "", fmt.Errorf("must be a valid CIDR or comma-separated IPv4 and IPv6 CIDRs")
+		}
+		if ipNet.IP.To4() != nil {
+			if ipv4 {
+				return nil, "", fmt.Errorf("must have at most one IPv4 CIDR")
+			}
+			ipv4 = true
+		} else {
+			if ipv6 {
+				return nil, "", fmt.Errorf("must have at most one IPv6 CIDR")
+			}
+			ipv6 = true
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	switch {
+	case ipv4 && ipv6:
+		return ipNets, DualStackIPFamily, nil
+	case ipv6:
+		return ipNets, IPv6IPFamily, nil
+	default:
+		return ipNets, IPv4IPFamily, nil
+	}
+}
+
+// containsIPFamily returns whether the family is one of the given families.
+func containsIPFamily(families []IPFamily, family IPFamily) bool {
+	for _, f := range families {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFailureDomains returns the errors of failure domains whose name is not a valid label value,
+// as the machine containers are labeled with it and the hosts of a pool are matched against it, and
+// of attributes that cannot select the hosts of the failure domain.
+func (s *ContainerdClusterSpec) validateFailureDomains(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for name := range s.FailureDomains {
+		if name == "" {
+			allErrs = append(allErrs, field.Invalid(path, name, "the name of a failure domain is required"))
+			continue
+		}
+		for _, msg := range validation.IsValidLabelValue(name) {
+			allErrs = append(allErrs, field.Invalid(path.Key(name), name, msg))
+		}
+		attributesPath := path.Key(name).Child("attributes")
+		for key, value := range s.FailureDomains[name].Attributes {
+			if key == FailureDomainHostAttribute {
+				for _, msg := range validation.IsDNS1123Subdomain(value) {
+					allErrs = append(allErrs, field.Invalid(attributesPath.Key(key), value, msg))
+				}
+				continue
+			}
+			for _, msg := range validation.IsQualifiedName(key) {
+				allErrs = append(allErrs, field.Invalid(attributesPath, key, msg))
+			}
+			for _, msg := range validation.IsValidLabelValue(value) {
+				allErrs = append(allErrs, field.Invalid(attributesPath.Key(key), value, msg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validate returns the errors of an alias without a valid IP address or with an invalid host name.
+func (a HostAlias) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if net.ParseIP(a.IP) == nil {
+		allErrs = append(allErrs, field.Invalid(path.Child("ip"), a.IP, "must be a valid IP address"))
+	}
+	for i, hostname := range a.Hostnames {
+		for _, msg := range validation.IsDNS1123Subdomain(hostname) {
+			allErrs = append(allErrs, field.Invalid(path.Child("hostnames").Index(i), hostname, msg))
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func TestContainerdClusterValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    ContainerdClusterSpec
+		wantErr bool
+	}{
+		{
+			name: "empty spec",
+		},
+		{
+			name: "valid spec",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "cp.example.com", Port: 6443},
+				LoadBalancer:         ContainerdLoadBalancer{ImageMeta: ImageMeta{ImageRepository: "registry.example.com/kindest", ImageTag: "v20210715-a6da3463"}},
+				FailureDomains:       clusterv1.FailureDomains{"fd1": {ControlPlane: true}},
+				HostAliases:          []HostAlias{{IP: "10.0.0.1", Hostnames: []string{"registry.local"}}},
+				Network:              &ContainerdNetwork{NodeSubnet: "10.90.0.0/24", PodSubnet: "192.168.0.0/16", ServiceSubnet: "10.128.0.0/12", MTU: 1400},
+			},
+		},
+		{
+			name:    "endpoint without host",
+			spec:    ContainerdClusterSpec{ControlPlaneEndpoint: APIEndpoint{Port: 6443}},
+			wantErr: true,
+		},
+		{
+			name:    "endpoint with invalid host",
+			spec:    ContainerdClusterSpec{ControlPlaneEndpoint: APIEndpoint{Host: "cp_example", Port: 6443}},
+			wantErr: true,
+		},
+		{
+			name:    "endpoint with invalid port",
+			spec:    ContainerdClusterSpec{ControlPlaneEndpoint: APIEndpoint{Host: "172.18.0.2", Port: 70000}},
+			wantErr: true,
+		},
+		{
+			name: "externally managed load balancer",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "cp.example.com", Port: 6443},
+				LoadBalancer:         ContainerdLoadBalancer{ExternallyManaged: true, BackendPort: 6444},
+			},
+		},
+		{
+			name:    "externally managed load balancer without endpoint",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{ExternallyManaged: true}},
+			wantErr: true,
+		},
+		{
+			name: "externally managed load balancer with frontends",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "cp.example.com", Port: 6443},
+				LoadBalancer: ContainerdLoadBalancer{
+					ExternallyManaged: true,
+					Frontends:         []LoadBalancerFrontend{{Name: "ingress", Port: 443, BackendPort: 30443}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "load balancer of type none",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "cp.example.com", Port: 6443},
+				LoadBalancer:         ContainerdLoadBalancer{Type: NoneLoadBalancerType},
+			},
+		},
+		{
+			name:    "load balancer of type none without endpoint",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{Type: NoneLoadBalancerType}},
+			wantErr: true,
+		},
+		{
+			name: "externally managed nginx load balancer",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "cp.example.com", Port: 6443},
+				LoadBalancer:         ContainerdLoadBalancer{Type: NginxLoadBalancerType, ExternallyManaged: true},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported load balancer type",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{Type: "envoy"}},
+			wantErr: true,
+		},
+		{
+			name: "kube-vip load balancer",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "172.18.0.200", Port: 6443},
+				LoadBalancer:         ContainerdLoadBalancer{Type: KubeVIPLoadBalancerType},
+			},
+		},
+		{
+			name:    "kube-vip load balancer without endpoint",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{Type: KubeVIPLoadBalancerType}},
+			wantErr: true,
+		},
+		{
+			name: "kube-vip load balancer with DNS endpoint",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "cp.example.com", Port: 6443},
+				LoadBalancer:         ContainerdLoadBalancer{Type: KubeVIPLoadBalancerType},
+			},
+			wantErr: true,
+		},
+		{
+			name: "kube-vip load balancer with endpoint on another port",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "172.18.0.200", Port: 7443},
+				LoadBalancer:         ContainerdLoadBalancer{Type: KubeVIPLoadBalancerType},
+			},
+			wantErr: true,
+		},
+		{
+			name: "load balancer config template",
+			spec: ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{
+				CustomConfigTemplate: "frontend control-plane\n  bind *:{{ .ControlPlanePort }}\n",
+			}},
+		},
+		{
+			name:    "invalid load balancer config template",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{CustomConfigTemplate: "bind *:{{ .ControlPlanePort"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid load balancer image repository",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{ImageMeta: ImageMeta{ImageRepository: "Registry.example.com/Kindest"}}},
+			wantErr: true,
+		},
+		{
+			name: "load balancer host address",
+			spec: ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{HostAddress: "192.168.1.10"}},
+		},
+		{
+			name: "load balancer host address with endpoint",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "capc.example.com", Port: 16443},
+				LoadBalancer:         ContainerdLoadBalancer{HostAddress: "capc.example.com"},
+			},
+		},
+		{
+			name:    "invalid load balancer host address",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{HostAddress: "Host_1"}},
+			wantErr: true,
+		},
+		{
+			name: "endpoint on another host than the load balancer",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "192.168.1.11", Port: 16443},
+				LoadBalancer:         ContainerdLoadBalancer{HostAddress: "192.168.1.10"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "externally managed load balancer with host address",
+			spec: ContainerdClusterSpec{
+				ControlPlaneEndpoint: APIEndpoint{Host: "192.168.1.10", Port: 6443},
+				LoadBalancer:         ContainerdLoadBalancer{ExternallyManaged: true, HostAddress: "192.168.1.10"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "image pull secrets",
+			spec: ContainerdClusterSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-credentials"}}},
+		},
+		{
+			name:    "image pull secret without name",
+			spec:    ContainerdClusterSpec{ImagePullSecrets: []corev1.LocalObjectReference{{}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid load balancer image tag",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{ImageMeta: ImageMeta{ImageTag: "v1:latest"}}},
+			wantErr: true,
+		},
+		{
+			name: "load balancer with frontends",
+			spec: ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{Port: 7443, BackendPort: 6443, Frontends: []LoadBalancerFrontend{
+				{Name: "konnectivity", Port: 8132, BackendPort: 8132},
+				{Name: "ingress", Port: 443, HostPort: 8443, BackendPort: 30443, BackendRole: WorkerBackendRole},
+			}}},
+		},
+		{
+			name:    "load balancer with invalid port",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{BackendPort: 70000}},
+			wantErr: true,
+		},
+		{
+			name:    "load balancer frontend with reserved name",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{Frontends: []LoadBalancerFrontend{{Name: "control-plane", Port: 8132, BackendPort: 8132}}}},
+			wantErr: true,
+		},
+		{
+			name: "load balancer frontends with the same name",
+			spec: ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{Frontends: []LoadBalancerFrontend{
+				{Name: "ingress", Port: 80, BackendPort: 30080},
+				{Name: "ingress", Port: 443, BackendPort: 30443},
+			}}},
+			wantErr: true,
+		},
+		{
+			name:    "load balancer frontend on the control plane port",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{Frontends: []LoadBalancerFrontend{{Name: "apiserver", Port: 6443, BackendPort: 6443}}}},
+			wantErr: true,
+		},
+		{
+			name:    "load balancer frontend with invalid backend role",
+			spec:    ContainerdClusterSpec{LoadBalancer: ContainerdLoadBalancer{Frontends: []LoadBalancerFrontend{{Name: "ingress", Port: 443, BackendPort: 30443, BackendRole: "etcd"}}}},
+			wantErr: true,
+		},
+		{
+			name: "image repository",
+			spec: ContainerdClusterSpec{ImageRepository: "registry.example.com:5000/mirror"},
+		},
+		{
+			name:    "invalid image repository",
+			spec:    ContainerdClusterSpec{ImageRepository: "registry.example.com/Mirror"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid failure domain name",
+			spec:    ContainerdClusterSpec{FailureDomains: clusterv1.FailureDomains{"zone a": {}}},
+			wantErr: true,
+		},
+		{
+			name: "failure domains of hosts",
+			spec: ContainerdClusterSpec{FailureDomains: clusterv1.FailureDomains{
+				"fd1": {ControlPlane: true, Attributes: map[string]string{FailureDomainHostAttribute: "lab-1"}},
+				"fd2": {Attributes: map[string]string{"topology.example.com/rack": "rack-b"}},
+			}},
+		},
+		{
+			name:    "failure domain with invalid host label",
+			spec:    ContainerdClusterSpec{FailureDomains: clusterv1.FailureDomains{"fd1": {Attributes: map[string]string{"rack": "rack b"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid host alias",
+			spec:    ContainerdClusterSpec{HostAliases: []HostAlias{{IP: "10.0.0", Hostnames: []string{"registry.local"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "network without node subnet",
+			spec:    ContainerdClusterSpec{Network: &ContainerdNetwork{Name: "capc-test"}},
+			wantErr: true,
+		},
+		{
+			name:    "network with invalid name",
+			spec:    ContainerdClusterSpec{Network: &ContainerdNetwork{Name: "capc/test", NodeSubnet: "10.90.0.0/24"}},
+			wantErr: true,
+		},
+		{
+			name:    "network with too long bridge name",
+			spec:    ContainerdClusterSpec{Network: &ContainerdNetwork{Bridge: "capc-bridge-too-long", NodeSubnet: "10.90.0.0/24"}},
+			wantErr: true,
+		},
+		{
+			name:    "network with invalid pod subnet",
+			spec:    ContainerdClusterSpec{Network: &ContainerdNetwork{NodeSubnet: "10.90.0.0/24", PodSubnet: "192.168.0.0"}},
+			wantErr: true,
+		},
+		{
+			name: "dual-stack network",
+			spec: ContainerdClusterSpec{IPFamily: DualStackIPFamily, Network: &ContainerdNetwork{
+				NodeSubnet: "10.90.0.0/24,fd00:10:90::/64", PodSubnet: "192.168.0.0/16,fd00:100:96::/48", ServiceSubnet: "10.128.0.0/12,fd00:100:64::/108",
+			}},
+		},
+		{
+			name: "IPv6 network with IPv4 node subnet",
+			spec: ContainerdClusterSpec{IPFamily: IPv6IPFamily, Network: &ContainerdNetwork{
+				NodeSubnet: "10.90.0.0/24,fd00:10:90::/64", PodSubnet: "fd00:100:96::/48", ServiceSubnet: "fd00:100:64::/108",
+			}},
+		},
+		{
+			name:    "IPv6 network with IPv4 pod subnet",
+			spec:    ContainerdClusterSpec{IPFamily: IPv6IPFamily, Network: &ContainerdNetwork{NodeSubnet: "fd00:10:90::/64", PodSubnet: "192.168.0.0/16"}},
+			wantErr: true,
+		},
+		{
+			name:    "dual-stack network without IPv6 node subnet",
+			spec:    ContainerdClusterSpec{IPFamily: DualStackIPFamily, Network: &ContainerdNetwork{NodeSubnet: "10.90.0.0/24"}},
+			wantErr: true,
+		},
+		{
+			name:    "network with two subnets of the same family",
+			spec:    ContainerdClusterSpec{Network: &ContainerdNetwork{NodeSubnet: "10.90.0.0/24,10.91.0.0/24"}},
+			wantErr: true,
+		},
+		{
+			name:    "network with overlapping subnets",
+			spec:    ContainerdClusterSpec{Network: &ContainerdNetwork{NodeSubnet: "10.90.0.0/24", ServiceSubnet: "10.0.0.0/8"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := &ContainerdCluster{Spec: tt.spec}
+			if tt.wantErr {
+				g.Expect(c.ValidateCreate()).NotTo(Succeed())
+			} else {
+				g.Expect(c.ValidateCreate()).To(Succeed())
+			}
+		})
+	}
+}
+
+func TestContainerdClusterValidateUpdate(t *testing.T) {
+	g := NewWithT(t)
+
+	old := &ContainerdCluster{}
+	c := old.DeepCopy()
+	c.Spec.ControlPlaneEndpoint = APIEndpoint{Host: "172.18.0.2", Port: 6443}
+	g.Expect(c.ValidateUpdate(old)).To(Succeed())
+
+	old = c.DeepCopy()
+	c.Spec.ControlPlaneEndpoint.Port = 7443
+	g.Expect(c.ValidateUpdate(old)).NotTo(Succeed())
+
+	c = old.DeepCopy()
+	c.Spec.LoadBalancer.ImageTag = "v20220607-9a4d8d2a"
+	g.Expect(c.ValidateUpdate(old)).To(Succeed())
+
+	c = old.DeepCopy()
+	c.Spec.Network = &ContainerdNetwork{NodeSubnet: "10.90.0.0/24"}
+	g.Expect(c.ValidateUpdate(old)).NotTo(Succeed())
+
+	c = old.DeepCopy()
+	c.Spec.IPFamily = IPv6IPFamily
+	g.Expect(c.ValidateUpdate(old)).NotTo(Succeed())
+
+	c = old.DeepCopy()
+	c.Spec.LoadBalancer.ExternallyManaged = true
+	g.Expect(c.ValidateUpdate(old)).NotTo(Succeed())
+
+	c = old.DeepCopy()
+	c.Spec.LoadBalancer.Type = NginxLoadBalancerType
+	g.Expect(c.ValidateUpdate(old)).NotTo(Succeed())
+}
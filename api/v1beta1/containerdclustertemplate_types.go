@@ -0,0 +1,64 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// ContainerdClusterTemplateSpec defines the desired state of ContainerdClusterTemplate.
+type ContainerdClusterTemplateSpec struct {
+	// Template describes the ContainerdClusters created from the template.
+	Template ContainerdClusterTemplateResource `json:"template"`
+}
+
+// ContainerdClusterTemplateResource describes the data needed to create a ContainerdCluster from a
+// template, e.g. for the infrastructure cluster of a ClusterClass.
+type ContainerdClusterTemplateResource struct {
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	ObjectMeta clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the specification of the desired behavior of the cluster.
+	Spec ContainerdClusterSpec `json:"spec"`
+}
+
+//+kubebuilder:object:root=true
+
+// ContainerdClusterTemplate is the Schema for the containerdclustertemplates API
+type ContainerdClusterTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ContainerdClusterTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ContainerdClusterTemplateList contains a list of ContainerdClusterTemplate
+type ContainerdClusterTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ContainerdClusterTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ContainerdClusterTemplate{}, &ContainerdClusterTemplateList{})
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the validation webhook of ContainerdClusterTemplate with the manager.
+func (c *ContainerdClusterTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(c).Complete()
+}
+
+//+kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-containerdclustertemplate,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=containerdclustertemplates,versions=v1beta1,name=validation.containerdclustertemplate.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1;v1beta1
+
+var _ webhook.Validator = &ContainerdClusterTemplate{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
+func (c *ContainerdClusterTemplate) ValidateCreate() error {
+	allErrs := c.Spec.Template.Spec.validate(field.NewPath("spec", "template", "spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ContainerdClusterTemplate").GroupKind(), c.Name, allErrs)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type. The spec of
+// the template is immutable, a ClusterClass is rebased onto a new template to change its clusters.
+func (c *ContainerdClusterTemplate) ValidateUpdate(old runtime.Object) error {
+	oldTemplate, ok := old.(*ContainerdClusterTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a ContainerdClusterTemplate but got a %T", old))
+	}
+	if !reflect.DeepEqual(c.Spec.Template.Spec, oldTemplate.Spec.Template.Spec) {
+		return apierrors.NewInvalid(GroupVersion.WithKind("ContainerdClusterTemplate").GroupKind(), c.Name, field.ErrorList{
+			field.Invalid(field.NewPath("spec", "template", "spec"), c.Spec.Template.Spec, "field is immutable"),
+		})
+	}
+	return nil
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+func (c *ContainerdClusterTemplate) ValidateDelete() error {
+	return nil
+}
@@ -0,0 +1,657 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+const (
+	// MachineFinalizer allows ReconcileContainerdMachine to clean up resources associated with AWSMachine before
+	// removing it from the apiserver.
+	MachineFinalizer = "containerdmachine.infrastructure.cluster.x-k8s.io"
+
+	// FrozenAnnotation freezes the processes of the machine container when set to "true", e.g. to
+	// simulate a node outage or save resources without losing the node state, and thaws them when
+	// removed. Only provisioned machines are frozen.
+	FrozenAnnotation = "containerdmachine.infrastructure.cluster.x-k8s.io/frozen"
+
+	// ProviderIDPrefix prefixes the name of the machine container in the provider ID of the machine
+	// and of its node.
+	ProviderIDPrefix = "containerd:////"
+
+	// DefaultImageName is the image of the machines, without a custom image, tagged with the
+	// Kubernetes version of the machine.
+	DefaultImageName = "kindest/node"
+)
+
+// Operating systems of the machines.
+const (
+	LinuxOS   = "linux"
+	WindowsOS = "windows"
+)
+
+// ContainerdMachineSpec defines the desired state of ContainerdMachine
+type ContainerdMachineSpec struct {
+	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+
+	// ProviderID will be the container name in ProviderID format (containerd:////<containername>)
+	// +optional
+	ProviderID *string `json:"providerID,omitempty"`
+
+	// CustomImage allows customizing the container image that is used for
+	// running the machine. It defaults to the kindest/node image of the Kubernetes version of the
+	// machine.
+	// +optional
+	CustomImage string `json:"customImage,omitempty"`
+
+	// PreLoadImages allows to pre-load images in a newly created machine. This can be used to
+	// speed up tests by avoiding e.g. to download CNI images on all the containers. An image is a
+	// reference pulled on the host, or the path on the host of an image archive, oci-archive:///path
+	// or docker-archive:///path, imported into the machine without any registry under the image names
+	// recorded in the archive.
+	// +optional
+	PreLoadImages []string `json:"preLoadImages,omitempty"`
+
+	// ImagePullSecrets are references to Secrets of type kubernetes.io/dockerconfigjson, in the
+	// same namespace as the ContainerdMachine, holding credentials used to pull the image of the
+	// machine and by its kubelet. They take precedence over the ImagePullSecrets of the
+	// ContainerdCluster.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// ExtraMounts describes additional mount points for the node container
+	// These may be used to bind a hostPath
+	// A mount at /var, /tmp, /run or /lib/modules replaces the one the node containers get by
+	// default, like in kind: /var as a volume, /tmp and /run as tmpfs, and /lib/modules read-only
+	// from the host.
+	// +optional
+	ExtraMounts []Mount `json:"extraMounts,omitempty"`
+
+	// ExtraPortMappings publishes ports of the machine container on the host, like in kind, e.g. so
+	// that the NodePort services and ingress controllers of the workload cluster are reachable from
+	// the host. They are applied when the machine container is created.
+	// +optional
+	ExtraPortMappings []PortMapping `json:"extraPortMappings,omitempty"`
+
+	// StaticIP is the IP of the machine container on the network of the cluster, requested from its
+	// host-local IPAM instead of a free one, so that the node keeps its IP when its container is
+	// recreated, e.g. for the etcd peer certificates or a load balancer configured outside of the
+	// cluster. It must be a free address of the subnet of the network of its IP family, the address of
+	// the other family of a dual-stack network is allocated as usual. It is applied when the machine
+	// container is created. Not supported by Windows machines.
+	// +optional
+	StaticIP string `json:"staticIP,omitempty"`
+
+	// MACAddress is the MAC address of the interface of the machine container on the network of the
+	// cluster, set by its bridge plugin instead of a random one. It is applied when the machine
+	// container is created. Not supported by Windows machines.
+	// +optional
+	MACAddress string `json:"macAddress,omitempty"`
+
+	// Snapshotter is the containerd snapshotter used to create the machine container filesystem.
+	// Hosts that cannot run overlayfs, e.g. because the containerd root is itself on overlayfs,
+	// can use native instead. If not set, the containerd default snapshotter is used.
+	// +kubebuilder:validation:Enum=overlayfs;native;zfs;btrfs;stargz
+	// +optional
+	Snapshotter string `json:"snapshotter,omitempty"`
+
+	// OS is the operating system of the machine, to simulate hybrid Linux and Windows workload
+	// clusters. Windows machines run Windows containers with the runhcs runtime, by default for the
+	// windows/amd64 platform. Windows containers cannot be attached to HNS networks yet, so Windows
+	// machines fail to be created. If not set, the machine is a Linux machine.
+	// +kubebuilder:validation:Enum=linux;windows
+	// +optional
+	OS string `json:"os,omitempty"`
+
+	// Platform is the platform of the machine image to pull, in the os/arch[/variant] format,
+	// e.g. "linux/arm64". If not set, the platform of the host running containerd is used, or
+	// windows/amd64 for Windows machines.
+	// +optional
+	Platform string `json:"platform,omitempty"`
+
+	// RuntimeHandler is the containerd runtime the machine container runs with, like the handler of a
+	// Kubernetes RuntimeClass: "runc", "kata", "gvisor" or "runhcs", or the name of a containerd shim,
+	// e.g. "io.containerd.kata-qemu.v2". The runtime must be installed on the host. If not set, the
+	// containerd default runtime is used, or runhcs for Windows machines.
+	// +optional
+	RuntimeHandler string `json:"runtimeHandler,omitempty"`
+
+	// HostSelector selects the containerd hosts the machine can be scheduled onto by their labels,
+	// when the provider is configured with a pool of hosts. The machine is also only scheduled onto
+	// the hosts of the failure domain of its Machine, if it has one. If not set, any host can be chosen.
+	// +optional
+	HostSelector *metav1.LabelSelector `json:"hostSelector,omitempty"`
+
+	// Resources limits the host resources the machine container can use, so that a workload cluster
+	// cannot starve the host or the other clusters. It is applied when the machine container is created.
+	// +optional
+	Resources *MachineResources `json:"resources,omitempty"`
+
+	// HealthCheck configures the probe run periodically against the machine container, reported by
+	// the MachineHealthy condition. It is applied when the machine container is created.
+	// +optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// Devices are the devices of the host exposed in the machine container, e.g. /dev/kvm or /dev/fuse,
+	// with the device cgroup rules allowing their use, so that device plugins or virtualization can be
+	// tested in the workload cluster. The devices must exist on the host. They are applied when the
+	// machine container is created. Not supported by Windows machines.
+	// +optional
+	Devices []Device `json:"devices,omitempty"`
+
+	// CDIDevices are the fully qualified names of the Container Device Interface devices injected into
+	// the machine container, e.g. "nvidia.com/gpu=all" or "amd.com/gpu=0", to pass GPUs through to the
+	// workload cluster. The CDI specs of the devices, with their device nodes, driver library mounts
+	// and hooks, must be generated on the host by the vendor tools, e.g. nvidia-ctk cdi generate.
+	// They are applied when the machine container is created. Not supported by Windows machines.
+	// +optional
+	CDIDevices []string `json:"cdiDevices,omitempty"`
+
+	// Sysctls are the kernel parameters set in the machine container, e.g. "net.ipv4.ip_forward": "1"
+	// or "net.netfilter.nf_conntrack_max": "1048576". Only the sysctls namespaced per container can be
+	// set: net.*, fs.mqueue.* and the IPC kernel.shm*, kernel.msg* and kernel.sem ones. The others,
+	// like fs.inotify.max_user_watches, are shared by all the containers and must be set on the host.
+	// They are applied when the machine container is created. Not supported by Windows machines.
+	// +optional
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+
+	// Ulimits are the resource limits of the processes of the machine container, e.g. to raise the
+	// nofile limit the kubelet and the pods of busy nodes run into. They are applied when the machine
+	// container is created. Not supported by Windows machines.
+	// +optional
+	Ulimits []Ulimit `json:"ulimits,omitempty"`
+
+	// Entrypoint replaces the entrypoint of the machine image, e.g. to use a node image with another
+	// init or to wrap it in a debugger. The command of the image is dropped unless Command is set.
+	// It is applied when the machine container is created.
+	// +optional
+	Entrypoint []string `json:"entrypoint,omitempty"`
+
+	// Command replaces the command of the machine image, passed as arguments to the entrypoint.
+	// It is applied when the machine container is created.
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// ExtraArgs are appended to the arguments of the process of the machine container, after the
+	// command. They are applied when the machine container is created.
+	// +optional
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+
+	// Hooks are OCI hooks the runtime runs on the host when the machine container comes and goes, e.g.
+	// for custom network plumbing or audit logging. They are applied when the machine container is
+	// created. Not supported by Windows machines.
+	// +optional
+	Hooks *MachineHooks `json:"hooks,omitempty"`
+
+	// IsolationProfile restricts the privileges of the machine container and of the commands run in
+	// it, which are privileged by default. It is applied when the machine container is created. Not
+	// supported by Windows machines.
+	// +optional
+	IsolationProfile *IsolationProfile `json:"isolationProfile,omitempty"`
+
+	// KubeletExtraArgs are extra flags of the kubelet of the machine by name, without the leading
+	// dashes, e.g. "eviction-hard": "memory.available<200Mi". They are written to the environment
+	// file of the kubelet before the machine is bootstrapped, and take precedence over the flags set
+	// by kubeadm. The values cannot contain whitespace.
+	// +optional
+	KubeletExtraArgs map[string]string `json:"kubeletExtraArgs,omitempty"`
+
+	// KubeletConfigPatch is a strategic merge patch, in YAML or JSON, of the KubeletConfiguration kubeadm
+	// writes for the kubelet of the machine, e.g. to set its evictionHard thresholds or featureGates.
+	// It is written before the machine is bootstrapped and applied by kubeadm with its
+	// kubeletconfiguration patch target, which requires kubeadm v1.25 or later. It replaces the
+	// patches directory of the kubeadm configuration of the machine.
+	// +optional
+	KubeletConfigPatch string `json:"kubeletConfigPatch,omitempty"`
+
+	// NodeLabels are set on the node of the machine in the workload cluster once it is provisioned.
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+
+	// NodeAnnotations are set on the node of the machine in the workload cluster once it is provisioned.
+	// +optional
+	NodeAnnotations map[string]string `json:"nodeAnnotations,omitempty"`
+
+	// NodeTaints are added to the node of the machine in the workload cluster once it is provisioned,
+	// replacing the taints of the node with the same key and effect.
+	// +optional
+	NodeTaints []corev1.Taint `json:"nodeTaints,omitempty"`
+
+	// Drain cordons and drains the node of the machine in the workload cluster before the machine
+	// container is deleted, evicting its pods like on the removal of a real node. If not set, the
+	// container is deleted without draining the node, besides the drain of the Machine controller.
+	// +optional
+	Drain *NodeDrain `json:"drain,omitempty"`
+
+	// Bootstrapped is true when the kubeadm bootstrapping has been run
+	// against this machine
+	// +optional
+	Bootstrapped bool `json:"bootstrapped,omitempty"`
+}
+
+// MachineResources limits the host resources a machine container can use. Unset limits are not enforced.
+type MachineResources struct {
+	// CPUs is the CPU time the machine can use, in CPUs, e.g. "2" or "500m".
+	// +optional
+	CPUs *resource.Quantity `json:"cpus,omitempty"`
+
+	// Memory is the memory the machine can use, without swap, e.g. "4Gi".
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+
+	// Pids is the number of processes the machine can run.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Pids *int64 `json:"pids,omitempty"`
+}
+
+// Device is a device of the host exposed in a machine container.
+type Device struct {
+	// HostPath is the path of the character or block device on the host, e.g. "/dev/kvm".
+	// +kubebuilder:validation:Pattern=`^/`
+	HostPath string `json:"hostPath"`
+
+	// ContainerPath is the path of the device in the machine container. Defaults to HostPath.
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	ContainerPath string `json:"containerPath,omitempty"`
+
+	// Permissions are the cgroup permissions of the machine on the device, a combination of r (read),
+	// w (write) and m (mknod). Defaults to "rwm".
+	// +kubebuilder:validation:Pattern=`^[rwm]{1,3}$`
+	// +optional
+	Permissions string `json:"permissions,omitempty"`
+}
+
+// Ulimit is a resource limit of the processes of a machine container.
+type Ulimit struct {
+	// Name is the name of the limit, as used by ulimit, e.g. "nofile", "nproc" or "memlock".
+	// +kubebuilder:validation:Enum=as;core;cpu;data;fsize;locks;memlock;msgqueue;nice;nofile;nproc;rss;rtprio;rttime;sigpending;stack
+	Name string `json:"name"`
+
+	// Soft is the limit enforced on the processes.
+	// +kubebuilder:validation:Minimum=0
+	Soft int64 `json:"soft"`
+
+	// Hard is the ceiling the processes can raise the soft limit to. Defaults to Soft.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Hard *int64 `json:"hard,omitempty"`
+}
+
+// MachineHooks are the OCI hooks of a machine container.
+type MachineHooks struct {
+	// Prestart hooks run after the namespaces of the machine container are created, before its init
+	// starts.
+	// +optional
+	Prestart []Hook `json:"prestart,omitempty"`
+
+	// Poststop hooks run after the machine container is stopped and deleted.
+	// +optional
+	Poststop []Hook `json:"poststop,omitempty"`
+}
+
+// Hook is a binary of the host run by the OCI runtime, with the state of the container as JSON on its
+// standard input.
+type Hook struct {
+	// Path is the absolute path of the binary on the host.
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path"`
+
+	// Args are the arguments of the binary, including argv[0].
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// Env are the environment variables of the binary, in the KEY=value format.
+	// +optional
+	Env []string `json:"env,omitempty"`
+
+	// Timeout is how long the binary can run, in whole seconds. If not set, it is not limited.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// HealthCheck configures the probe run against a machine container. Exactly one of Exec and TCPPort
+// must be set.
+type HealthCheck struct {
+	// Exec is a command run in the machine container, the probe succeeds if it exits with code 0,
+	// e.g. ["curl", "-sf", "http://localhost:10248/healthz"] to check the kubelet.
+	// +optional
+	Exec []string `json:"exec,omitempty"`
+
+	// TCPPort is a port of the machine container, the probe succeeds if it accepts connections.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	TCPPort int32 `json:"tcpPort,omitempty"`
+
+	// Interval is the time between two probes. Defaults to 10s.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Timeout is the time after which a probe fails. Defaults to 5s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Retries is the number of consecutive failed probes after which the machine is unhealthy.
+	// Defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
+
+	// StartPeriod is the time after the machine container started during which failed probes are
+	// not counted, e.g. while the node bootstraps.
+	// +optional
+	StartPeriod *metav1.Duration `json:"startPeriod,omitempty"`
+}
+
+// Mount specifies a host volume to mount into a container.
+// This is a simplified version of kind v1alpha4.Mount types.
+type Mount struct {
+	// Path of the mount within the container.
+	ContainerPath string `json:"containerPath,omitempty"`
+
+	// Type is the type of the mount: bind mounts the HostPath, volume the named Volume and tmpfs
+	// an empty memory backed filesystem. It defaults to volume if Volume is set, else to bind.
+	// +optional
+	Type MountType `json:"type,omitempty"`
+
+	// Path of the mount on the host. If the hostPath doesn't exist, then runtimes
+	// should report error. If the hostpath is a symbolic link, runtimes should
+	// follow the symlink and mount the real destination to container.
+	HostPath string `json:"hostPath,omitempty"`
+
+	// Volume is the name of a named volume of the cluster to mount instead of a host path. The
+	// volume is created on first use and outlives the machine container, e.g. so that the etcd
+	// data of a machine persists across the recreation of its container for upgrade testing.
+	// +optional
+	Volume string `json:"volume,omitempty"`
+
+	// If set, the mount is read-only.
+	// +optional
+	Readonly bool `json:"readOnly,omitempty"`
+
+	// Propagation is the propagation of the mounts under a bind or volume mount: rprivate, the
+	// default, propagates none, rslave the mounts of the host into the machine, and rshared the
+	// mounts both ways, e.g. for the volumes a CSI driver of the machine mounts for containers
+	// nested in it. The host path must be on a shared mount for rshared and rslave.
+	// +optional
+	Propagation MountPropagation `json:"propagation,omitempty"`
+}
+
+// MountType is the type of a mount of a machine.
+// +kubebuilder:validation:Enum=bind;tmpfs;volume
+type MountType string
+
+const (
+	// BindMountType mounts a path of the host.
+	BindMountType MountType = "bind"
+	// TmpfsMountType mounts an empty memory backed filesystem.
+	TmpfsMountType MountType = "tmpfs"
+	// VolumeMountType mounts a named volume of the cluster.
+	VolumeMountType MountType = "volume"
+)
+
+// MountPropagation is the propagation of the mounts under a mount between the host and a machine.
+// +kubebuilder:validation:Enum=rprivate;rshared;rslave
+type MountPropagation string
+
+const (
+	// PrivateMountPropagation propagates no mounts, the default.
+	PrivateMountPropagation MountPropagation = "rprivate"
+	// SharedMountPropagation propagates the mounts of the host into the machine and back.
+	SharedMountPropagation MountPropagation = "rshared"
+	// SlaveMountPropagation propagates the mounts of the host into the machine only.
+	SlaveMountPropagation MountPropagation = "rslave"
+)
+
+// MountType returns the type of the mount, the one of its spec or else volume for a named volume
+// and bind for a host path.
+func (m Mount) MountType() MountType {
+	switch {
+	case m.Type != "":
+		return m.Type
+	case m.Volume != "":
+		return VolumeMountType
+	default:
+		return BindMountType
+	}
+}
+
+// IsolationMode is how much of the host privileges a machine container gets.
+// +kubebuilder:validation:Enum=Privileged;Baseline;Custom
+type IsolationMode string
+
+const (
+	// PrivilegedIsolation runs the machine container with all the capabilities and host devices, like
+	// kind nodes.
+	PrivilegedIsolation IsolationMode = "Privileged"
+	// BaselineIsolation runs the machine container with the default capabilities of containerd and
+	// the ones a node needs, CAP_SYS_ADMIN, CAP_NET_ADMIN and CAP_SYS_RESOURCE, without the host
+	// devices.
+	BaselineIsolation IsolationMode = "Baseline"
+	// CustomIsolation runs the machine container with the capabilities of the profile only, without
+	// the host devices.
+	CustomIsolation IsolationMode = "Custom"
+)
+
+// NodeDrain configures the drain of the node of a machine before its container is deleted.
+type NodeDrain struct {
+	// Timeout is how long the node is drained before the machine container is deleted anyway, e.g.
+	// when a PodDisruptionBudget blocks the eviction of its pods. If not set, the node is drained
+	// until all its pods are evicted.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// GracePeriodSeconds is the termination grace period of the evicted pods. If not set, the grace
+	// period of each pod is used.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	GracePeriodSeconds *int32 `json:"gracePeriodSeconds,omitempty"`
+}
+
+// IsolationProfile restricts the privileges of a machine container. The commands run in the machine
+// container get at most its capabilities.
+type IsolationProfile struct {
+	// Mode is how much of the host privileges the machine container gets, Privileged by default.
+	// +optional
+	Mode IsolationMode `json:"mode,omitempty"`
+
+	// Capabilities are the capabilities of Custom machine containers, or the ones added to the
+	// capabilities of Baseline machine containers, e.g. "CAP_SYS_PTRACE".
+	// +optional
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// SeccompProfile is "Unconfined", "RuntimeDefault" or the path of a seccomp profile file on the
+	// host of the controller. Privileged machine containers are unconfined and the others use the
+	// runtime default if not set.
+	// +optional
+	SeccompProfile string `json:"seccompProfile,omitempty"`
+
+	// AppArmorProfile is the name of an AppArmor profile loaded on the host of the machine container,
+	// which is unconfined if not set.
+	// +optional
+	AppArmorProfile string `json:"appArmorProfile,omitempty"`
+}
+
+// PortMappingProtocol is the protocol of a port mapping.
+// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+type PortMappingProtocol string
+
+const (
+	// PortMappingProtocolTCP maps a TCP port.
+	PortMappingProtocolTCP PortMappingProtocol = "TCP"
+	// PortMappingProtocolUDP maps a UDP port.
+	PortMappingProtocolUDP PortMappingProtocol = "UDP"
+	// PortMappingProtocolSCTP maps an SCTP port.
+	PortMappingProtocolSCTP PortMappingProtocol = "SCTP"
+)
+
+// PortMapping specifies a port of a container published on the host.
+// This is a simplified version of kind v1alpha4.PortMapping types.
+type PortMapping struct {
+	// ContainerPort is the port in the container.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	ContainerPort int32 `json:"containerPort"`
+
+	// HostPort is the port on the host, a free port is allocated if not set. A host port can only be
+	// published by one container, the machines of a template with a host port must run on different
+	// hosts.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	HostPort int32 `json:"hostPort,omitempty"`
+
+	// ListenAddress is the address of the host the port is published on, all the addresses if not set.
+	// +optional
+	ListenAddress string `json:"listenAddress,omitempty"`
+
+	// Protocol is the protocol of the port, TCP by default.
+	// +optional
+	Protocol PortMappingProtocol `json:"protocol,omitempty"`
+}
+
+// ResourceUsage is the resource usage of a machine container, read from its cgroup.
+type ResourceUsage struct {
+	// CPU is the CPU time used by the machine container since it started.
+	CPU metav1.Duration `json:"cpu"`
+
+	// Memory is the memory used by the machine container, excluding the reclaimable page cache.
+	Memory resource.Quantity `json:"memory"`
+
+	// MemoryLimit is the memory limit of the machine container, unset if it has none.
+	// +optional
+	MemoryLimit *resource.Quantity `json:"memoryLimit,omitempty"`
+
+	// IORead is the amount of data read from block devices by the machine container.
+	IORead resource.Quantity `json:"ioRead"`
+
+	// IOWrite is the amount of data written to block devices by the machine container.
+	IOWrite resource.Quantity `json:"ioWrite"`
+
+	// Processes is the number of processes running in the machine container.
+	Processes int64 `json:"processes"`
+
+	// LastUpdated is the time the resource usage was read.
+	LastUpdated metav1.Time `json:"lastUpdated"`
+}
+
+// ContainerdMachineStatus defines the observed state of ContainerdMachine
+type ContainerdMachineStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+	// Ready denotes that the machine (docker container) is ready
+	// +optional
+	Ready bool `json:"ready"`
+
+	// LoadBalancerConfigured denotes that the machine has been
+	// added to the load balancer
+	// +optional
+	LoadBalancerConfigured bool `json:"loadBalancerConfigured,omitempty"`
+
+	// Host is the containerd host the machine was scheduled onto, when the provider is configured
+	// with a pool of hosts. The machine stays on it for its whole life.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// ContainerID is the ID of the container hosting the machine in the containerd namespace of the
+	// cluster.
+	// +optional
+	ContainerID string `json:"containerID,omitempty"`
+
+	// ContainerState is the state of the task of the container hosting the machine, e.g. "running"
+	// or "stopped".
+	// +optional
+	ContainerState string `json:"containerState,omitempty"`
+
+	// ImagePulled is true once the image of the machine has been pulled onto its host.
+	// +optional
+	ImagePulled bool `json:"imagePulled,omitempty"`
+
+	// BootstrapExitCode is the exit code of the last bootstrap of the machine: 0 when it succeeded,
+	// the exit code of the failed bootstrap command otherwise. It is not set until the bootstrap ran,
+	// or when the bootstrap failed without a command exiting, e.g. on a timeout.
+	// +optional
+	BootstrapExitCode *int32 `json:"bootstrapExitCode,omitempty"`
+
+	// RestartCount is the number of times the machine container was restarted after exiting.
+	// +optional
+	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// Frozen is true when the processes of the machine container are frozen, see FrozenAnnotation.
+	// +optional
+	Frozen bool `json:"frozen,omitempty"`
+
+	// ResourceUsage is the resource usage of the machine container, refreshed periodically while the
+	// machine is provisioned.
+	// +optional
+	ResourceUsage *ResourceUsage `json:"resourceUsage,omitempty"`
+
+	// Addresses contains the associated addresses for the docker machine.
+	// +optional
+	Addresses []clusterv1.MachineAddress `json:"addresses,omitempty"`
+
+	// Conditions defines current service state of the DockerMachine.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// ContainerdMachine is the Schema for the containerdmachines API
+type ContainerdMachine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ContainerdMachineSpec   `json:"spec,omitempty"`
+	Status ContainerdMachineStatus `json:"status,omitempty"`
+}
+
+// GetConditions returns the set of conditions for this object.
+func (c *ContainerdMachine) GetConditions() clusterv1.Conditions {
+	return c.Status.Conditions
+}
+
+// SetConditions sets the conditions on this object.
+func (c *ContainerdMachine) SetConditions(conditions clusterv1.Conditions) {
+	c.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// ContainerdMachineList contains a list of ContainerdMachine
+type ContainerdMachineList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ContainerdMachine `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ContainerdMachine{}, &ContainerdMachineList{})
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/container"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the conversion and defaulting webhooks of ContainerdMachine with
+// the manager.
+func (c *ContainerdMachine) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(c).
+		WithDefaulter(&containerdMachineDefaulter{Client: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:verbs=create;update,path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-containerdmachine,mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=containerdmachines,versions=v1beta1,name=default.containerdmachine.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1;v1beta1
+
+// containerdMachineDefaulter defaults the ContainerdMachines, with the Machines owning them.
+type containerdMachineDefaulter struct {
+	Client client.Reader
+}
+
+var _ webhook.CustomDefaulter = &containerdMachineDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type. The custom
+// image defaults to the image of the Kubernetes version of the Machine owning the ContainerdMachine.
+// The ContainerdMachines are created before their Machine, the image is defaulted once the Machine
+// controller sets the owner reference.
+func (d *containerdMachineDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	c, ok := obj.(*ContainerdMachine)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a ContainerdMachine but got a %T", obj))
+	}
+	c.defaultSpec()
+
+	if c.Spec.CustomImage != "" || !c.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	machine, err := d.ownerMachine(ctx, c)
+	if err != nil {
+		return err
+	}
+	if machine != nil && machine.Spec.Version != nil {
+		c.Spec.CustomImage = MachineImage(*machine.Spec.Version)
+	}
+	return nil
+}
+
+// ownerMachine returns the Machine owning the ContainerdMachine, nil if it has no owner Machine yet.
+func (d *containerdMachineDefaulter) ownerMachine(ctx context.Context, c *ContainerdMachine) (*clusterv1.Machine, error) {
+	for _, ref := range c.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Kind != "Machine" || gv.Group != clusterv1.GroupVersion.Group {
+			continue
+		}
+		machine := &clusterv1.Machine{}
+		if err := d.Client.Get(ctx, client.ObjectKey{Namespace: c.Namespace, Name: ref.Name}, machine); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return machine, nil
+	}
+	return nil, nil
+}
+
+// defaultSpec normalizes the paths of the extra mounts, and completes a provider ID set to the name of
+// the machine container with the provider ID prefix.
+func (c *ContainerdMachine) defaultSpec() {
+	for i := range c.Spec.ExtraMounts {
+		mount := &c.Spec.ExtraMounts[i]
+		if mount.ContainerPath != "" {
+			mount.ContainerPath = filepath.Clean(mount.ContainerPath)
+		}
+		if mount.HostPath != "" {
+			mount.HostPath = filepath.Clean(mount.HostPath)
+		}
+	}
+
+	if c.Spec.ProviderID != nil && *c.Spec.ProviderID != "" && !strings.Contains(*c.Spec.ProviderID, "://") {
+		providerID := ProviderIDPrefix + *c.Spec.ProviderID
+		c.Spec.ProviderID = &providerID
+	}
+}
+
+// MachineImage returns the image of the machines of the Kubernetes version, e.g. kindest/node:v1.23.3.
+func MachineImage(version string) string {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return fmt.Sprintf("%s:%s", DefaultImageName, container.SemverToOCIImageTag(version))
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestContainerdMachineDefault(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	version := "1.23.3+build.1"
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-md-0-abcde", Namespace: "default"},
+		Spec:       clusterv1.MachineSpec{Version: &version},
+	}
+	d := &containerdMachineDefaulter{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(machine).Build()}
+
+	providerID := "cluster-md-0-abcde"
+	c := &ContainerdMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-md-0-abcde", Namespace: "default"},
+		Spec: ContainerdMachineSpec{
+			ProviderID:  &providerID,
+			ExtraMounts: []Mount{{ContainerPath: "/var/lib/data/", HostPath: "/data/../srv//data"}, {ContainerPath: "/cache", Volume: "cache"}},
+		},
+	}
+	g.Expect(d.Default(context.Background(), c)).To(Succeed())
+	g.Expect(*c.Spec.ProviderID).To(Equal("containerd:////cluster-md-0-abcde"))
+	g.Expect(c.Spec.ExtraMounts).To(Equal([]Mount{{ContainerPath: "/var/lib/data", HostPath: "/srv/data"}, {ContainerPath: "/cache", Volume: "cache"}}))
+	// The Machine is not known before it owns the ContainerdMachine.
+	g.Expect(c.Spec.CustomImage).To(BeEmpty())
+
+	c.OwnerReferences = []metav1.OwnerReference{{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine", Name: machine.Name}}
+	g.Expect(d.Default(context.Background(), c)).To(Succeed())
+	g.Expect(c.Spec.CustomImage).To(Equal("kindest/node:v1.23.3_build.1"))
+	g.Expect(*c.Spec.ProviderID).To(Equal("containerd:////cluster-md-0-abcde"))
+
+	// A custom image is kept.
+	c.Spec.CustomImage = "example.com/node:v1.23.3"
+	g.Expect(d.Default(context.Background(), c)).To(Succeed())
+	g.Expect(c.Spec.CustomImage).To(Equal("example.com/node:v1.23.3"))
+}
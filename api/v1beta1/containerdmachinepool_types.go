@@ -0,0 +1,162 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// MachinePoolFinalizer allows ContainerdMachinePoolReconciler to clean up the containers of the
+	// instances of the pool before removing it from the apiserver.
+	MachinePoolFinalizer = "containerdmachinepool.infrastructure.cluster.x-k8s.io"
+)
+
+// ContainerdMachinePoolMachineTemplate defines the machine containers of the instances of a pool.
+type ContainerdMachinePoolMachineTemplate struct {
+	// CustomImage allows customizing the container image that is used for running the machine.
+	// +optional
+	CustomImage string `json:"customImage,omitempty"`
+
+	// PreLoadImages allows to pre-load images in a newly created machine. This can be used to
+	// speed up tests by avoiding e.g. to download CNI images on all the containers. Like for
+	// ContainerdMachines, an image can be an oci-archive:// or docker-archive:// archive of the host.
+	// +optional
+	PreLoadImages []string `json:"preLoadImages,omitempty"`
+
+	// ImagePullSecrets are references to Secrets of type kubernetes.io/dockerconfigjson, in the
+	// same namespace as the ContainerdMachinePool, holding credentials used to pull the image of the
+	// instances and by their kubelet. They take precedence over the ImagePullSecrets of the
+	// ContainerdCluster.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// ExtraMounts describes additional mount points for the node container.
+	// These may be used to bind a hostPath.
+	// +optional
+	ExtraMounts []Mount `json:"extraMounts,omitempty"`
+
+	// Resources limits the host resources the machine containers of the instances can use. It is
+	// applied when the machine containers are created.
+	// +optional
+	Resources *MachineResources `json:"resources,omitempty"`
+}
+
+// ContainerdMachinePoolSpec defines the desired state of ContainerdMachinePool.
+type ContainerdMachinePoolSpec struct {
+	// Template contains the details used to build the machine containers of the instances of the pool.
+	// +optional
+	Template ContainerdMachinePoolMachineTemplate `json:"template"`
+
+	// ProviderID is the identification ID of the pool.
+	// +optional
+	ProviderID string `json:"providerID,omitempty"`
+
+	// ProviderIDList are the identification IDs of the instances of the pool, set by the controller.
+	// +optional
+	ProviderIDList []string `json:"providerIDList,omitempty"`
+}
+
+// ContainerdMachinePoolInstanceStatus defines the observed state of an instance of the pool.
+type ContainerdMachinePoolInstanceStatus struct {
+	// Addresses contains the associated addresses for the machine.
+	// +optional
+	Addresses []clusterv1.MachineAddress `json:"addresses,omitempty"`
+
+	// InstanceName is the name of the machine of the instance.
+	// +optional
+	InstanceName string `json:"instanceName,omitempty"`
+
+	// Version defines the Kubernetes version for the instance.
+	// +optional
+	Version *string `json:"version,omitempty"`
+
+	// ProviderID is the provider identification of the instance, set once it is bootstrapped.
+	// +optional
+	ProviderID *string `json:"providerID,omitempty"`
+
+	// Ready denotes that the instance is bootstrapped and its node has its provider ID.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// Bootstrapped is true when the kubeadm bootstrapping has been run against the instance.
+	// +optional
+	Bootstrapped bool `json:"bootstrapped,omitempty"`
+}
+
+// ContainerdMachinePoolStatus defines the observed state of ContainerdMachinePool.
+type ContainerdMachinePoolStatus struct {
+	// Ready denotes that all the instances of the pool are ready.
+	// +optional
+	Ready bool `json:"ready"`
+
+	// Replicas is the most recently observed number of instances of the pool.
+	// +optional
+	Replicas int32 `json:"replicas"`
+
+	// ObservedGeneration is the latest generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Instances contains the status of each instance of the pool.
+	// +optional
+	Instances []ContainerdMachinePoolInstanceStatus `json:"instances,omitempty"`
+
+	// Conditions defines current service state of the ContainerdMachinePool.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// GetConditions returns the set of conditions for this object.
+func (c *ContainerdMachinePool) GetConditions() clusterv1.Conditions {
+	return c.Status.Conditions
+}
+
+// SetConditions sets the conditions on this object.
+func (c *ContainerdMachinePool) SetConditions(conditions clusterv1.Conditions) {
+	c.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas",description="Number of instances of the pool"
+//+kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="All the instances of the pool are ready"
+
+// ContainerdMachinePool is the Schema for the containerdmachinepools API
+type ContainerdMachinePool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ContainerdMachinePoolSpec   `json:"spec,omitempty"`
+	Status ContainerdMachinePoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ContainerdMachinePoolList contains a list of ContainerdMachinePool
+type ContainerdMachinePoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ContainerdMachinePool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ContainerdMachinePool{}, &ContainerdMachinePoolList{})
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// ContainerdMachineTemplateSpec defines the desired state of ContainerdMachineTemplate.
+type ContainerdMachineTemplateSpec struct {
+	// Template describes the ContainerdMachines created from the template.
+	Template ContainerdMachineTemplateResource `json:"template"`
+}
+
+// ContainerdMachineTemplateResource describes the data needed to create a ContainerdMachine from a
+// template, e.g. for the machines of a MachineDeployment or of a control plane.
+type ContainerdMachineTemplateResource struct {
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	ObjectMeta clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the specification of the desired behavior of the machine.
+	Spec ContainerdMachineSpec `json:"spec"`
+}
+
+//+kubebuilder:object:root=true
+
+// ContainerdMachineTemplate is the Schema for the containerdmachinetemplates API
+type ContainerdMachineTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ContainerdMachineTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ContainerdMachineTemplateList contains a list of ContainerdMachineTemplate
+type ContainerdMachineTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ContainerdMachineTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ContainerdMachineTemplate{}, &ContainerdMachineTemplateList{})
+}
@@ -0,0 +1,312 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
+)
+
+// SetupWebhookWithManager registers the validation webhook of ContainerdMachineTemplate with the manager.
+func (c *ContainerdMachineTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(c).Complete()
+}
+
+//+kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-containerdmachinetemplate,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=containerdmachinetemplates,versions=v1beta1,name=validation.containerdmachinetemplate.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1;v1beta1
+
+var _ webhook.Validator = &ContainerdMachineTemplate{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type. The
+// machines created from the template are provisioned, they cannot have a provider ID yet, their
+// resource limits must be enforceable, and their images, mounts, port mappings, static address, isolation
+// profile, kubelet configuration and node metadata valid.
+func (c *ContainerdMachineTemplate) ValidateCreate() error {
+	path := field.NewPath("spec", "template", "spec")
+	var allErrs field.ErrorList
+	if c.Spec.Template.Spec.ProviderID != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("providerID"), "the provider ID is set when the machine is provisioned"))
+	}
+	if c.Spec.Template.Spec.Resources != nil {
+		allErrs = append(allErrs, c.Spec.Template.Spec.Resources.validate(path.Child("resources"))...)
+	}
+	allErrs = append(allErrs, validatePreLoadImages(path.Child("preLoadImages"), c.Spec.Template.Spec.PreLoadImages)...)
+	allErrs = append(allErrs, validateImagePullSecrets(path.Child("imagePullSecrets"), c.Spec.Template.Spec.ImagePullSecrets)...)
+	allErrs = append(allErrs, validateMounts(path.Child("extraMounts"), c.Spec.Template.Spec.ExtraMounts)...)
+	allErrs = append(allErrs, validatePortMappings(path.Child("extraPortMappings"), c.Spec.Template.Spec.ExtraPortMappings)...)
+	if c.Spec.Template.Spec.StaticIP != "" && net.ParseIP(c.Spec.Template.Spec.StaticIP) == nil {
+		allErrs = append(allErrs, field.Invalid(path.Child("staticIP"), c.Spec.Template.Spec.StaticIP, "must be a valid IP address"))
+	}
+	if c.Spec.Template.Spec.MACAddress != "" {
+		if _, err := net.ParseMAC(c.Spec.Template.Spec.MACAddress); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("macAddress"), c.Spec.Template.Spec.MACAddress, "must be a valid MAC address"))
+		}
+	}
+	if c.Spec.Template.Spec.IsolationProfile != nil {
+		allErrs = append(allErrs, c.Spec.Template.Spec.IsolationProfile.validate(path.Child("isolationProfile"))...)
+	}
+	allErrs = append(allErrs, validateKubeletConfig(path, c.Spec.Template.Spec.KubeletExtraArgs, c.Spec.Template.Spec.KubeletConfigPatch)...)
+	allErrs = append(allErrs, metav1validation.ValidateLabels(c.Spec.Template.Spec.NodeLabels, path.Child("nodeLabels"))...)
+	allErrs = append(allErrs, apivalidation.ValidateAnnotations(c.Spec.Template.Spec.NodeAnnotations, path.Child("nodeAnnotations"))...)
+	allErrs = append(allErrs, validateTaints(path.Child("nodeTaints"), c.Spec.Template.Spec.NodeTaints)...)
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("ContainerdMachineTemplate").GroupKind(), c.Name, allErrs)
+	}
+	return nil
+}
+
+// minCPUs is the lowest CPU limit the kernel enforces, its CFS quotas cannot be below 1ms per 100ms.
+var minCPUs = resource.MustParse("10m")
+
+// validate returns the errors of the limits that are negative, or too low to be enforced.
+func (r MachineResources) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if r.CPUs != nil && r.CPUs.Cmp(minCPUs) < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("cpus"), r.CPUs.String(), "must be at least 10m"))
+	}
+	if r.Memory != nil && r.Memory.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("memory"), r.Memory.String(), "must be greater than 0"))
+	}
+	if r.Pids != nil && *r.Pids < 1 {
+		allErrs = append(allErrs, field.Invalid(path.Child("pids"), *r.Pids, "must be greater than 0"))
+	}
+	return allErrs
+}
+
+// validatePreLoadImages returns the errors of image archives without an absolute host path.
+func validatePreLoadImages(path *field.Path, images []string) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, image := range images {
+		for _, prefix := range []string{"oci-archive://", "docker-archive://"} {
+			if strings.HasPrefix(image, prefix) && !filepath.IsAbs(strings.TrimPrefix(image, prefix)) {
+				allErrs = append(allErrs, field.Invalid(path.Index(i), image, "must be the absolute path of an image archive on the host"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateImagePullSecrets returns the errors of image pull Secret references without a name.
+func validateImagePullSecrets(path *field.Path, refs []corev1.LocalObjectReference) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, ref := range refs {
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Index(i).Child("name"), "the name of the Secret is required"))
+		}
+	}
+	return allErrs
+}
+
+// validateMounts returns the errors of mounts without the source of their type, or with the source or
+// propagation of another type.
+func validateMounts(path *field.Path, mounts []Mount) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, m := range mounts {
+		mountPath := path.Index(i)
+		if m.ContainerPath == "" {
+			allErrs = append(allErrs, field.Required(mountPath.Child("containerPath"), "the path of the mount in the machine is required"))
+		}
+		switch m.MountType() {
+		case BindMountType:
+			if m.HostPath == "" {
+				allErrs = append(allErrs, field.Required(mountPath.Child("hostPath"), "the host path is required with a bind mount"))
+			}
+			if m.Volume != "" {
+				allErrs = append(allErrs, field.Forbidden(mountPath.Child("volume"), "must not be set with a bind mount"))
+			}
+		case VolumeMountType:
+			if m.Volume == "" {
+				allErrs = append(allErrs, field.Required(mountPath.Child("volume"), "the volume is required with a volume mount"))
+			}
+			if m.HostPath != "" {
+				allErrs = append(allErrs, field.Forbidden(mountPath.Child("hostPath"), "must not be set with a volume mount"))
+			}
+		case TmpfsMountType:
+			const msg = "must not be set with a tmpfs mount"
+			if m.HostPath != "" {
+				allErrs = append(allErrs, field.Forbidden(mountPath.Child("hostPath"), msg))
+			}
+			if m.Volume != "" {
+				allErrs = append(allErrs, field.Forbidden(mountPath.Child("volume"), msg))
+			}
+			if m.Readonly {
+				allErrs = append(allErrs, field.Forbidden(mountPath.Child("readOnly"), msg))
+			}
+			if m.Propagation != "" {
+				allErrs = append(allErrs, field.Forbidden(mountPath.Child("propagation"), msg))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(mountPath.Child("type"), m.Type,
+				[]string{string(BindMountType), string(TmpfsMountType), string(VolumeMountType)}))
+		}
+		switch m.Propagation {
+		case "", PrivateMountPropagation, SharedMountPropagation, SlaveMountPropagation:
+		default:
+			allErrs = append(allErrs, field.NotSupported(mountPath.Child("propagation"), m.Propagation,
+				[]string{string(PrivateMountPropagation), string(SharedMountPropagation), string(SlaveMountPropagation)}))
+		}
+	}
+	return allErrs
+}
+
+// validatePortMappings returns the errors of invalid port mappings, and of mappings publishing the same
+// host port and protocol.
+func validatePortMappings(path *field.Path, mappings []PortMapping) field.ErrorList {
+	var allErrs field.ErrorList
+	hostPorts := map[string]bool{}
+	for i, pm := range mappings {
+		pmPath := path.Index(i)
+		for _, msg := range validation.IsValidPortNum(int(pm.ContainerPort)) {
+			allErrs = append(allErrs, field.Invalid(pmPath.Child("containerPort"), pm.ContainerPort, msg))
+		}
+		if pm.ListenAddress != "" && net.ParseIP(pm.ListenAddress) == nil {
+			allErrs = append(allErrs, field.Invalid(pmPath.Child("listenAddress"), pm.ListenAddress, "must be a valid IP address"))
+		}
+		switch pm.Protocol {
+		case "", PortMappingProtocolTCP, PortMappingProtocolUDP, PortMappingProtocolSCTP:
+		default:
+			allErrs = append(allErrs, field.NotSupported(pmPath.Child("protocol"), pm.Protocol,
+				[]string{string(PortMappingProtocolTCP), string(PortMappingProtocolUDP), string(PortMappingProtocolSCTP)}))
+		}
+		if pm.HostPort == 0 {
+			continue
+		}
+		for _, msg := range validation.IsValidPortNum(int(pm.HostPort)) {
+			allErrs = append(allErrs, field.Invalid(pmPath.Child("hostPort"), pm.HostPort, msg))
+		}
+		protocol := pm.Protocol
+		if protocol == "" {
+			protocol = PortMappingProtocolTCP
+		}
+		key := fmt.Sprintf("%s/%d/%s", pm.ListenAddress, pm.HostPort, protocol)
+		if hostPorts[key] {
+			allErrs = append(allErrs, field.Duplicate(pmPath.Child("hostPort"), pm.HostPort))
+		}
+		hostPorts[key] = true
+	}
+	return allErrs
+}
+
+// kubeletFlagRegexp matches the name of a flag of the kubelet, without the leading dashes.
+var kubeletFlagRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// validateKubeletConfig returns the errors of invalid kubelet flag names, of flag values with
+// whitespace, which the kubelet service would split, and of a config patch that is not an object.
+func validateKubeletConfig(path *field.Path, extraArgs map[string]string, configPatch string) field.ErrorList {
+	var allErrs field.ErrorList
+	for name, value := range extraArgs {
+		if !kubeletFlagRegexp.MatchString(name) {
+			allErrs = append(allErrs, field.Invalid(path.Child("kubeletExtraArgs"), name, "must be the name of a kubelet flag without the leading dashes"))
+		}
+		if strings.ContainsAny(value, " \t\n") {
+			allErrs = append(allErrs, field.Invalid(path.Child("kubeletExtraArgs").Key(name), value, "must not contain whitespace"))
+		}
+	}
+	if configPatch != "" {
+		var patch map[string]interface{}
+		if err := yaml.Unmarshal([]byte(configPatch), &patch); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("kubeletConfigPatch"), configPatch, "must be a YAML or JSON object: "+err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// capabilityRegexp matches the name of a capability, with or without the "CAP_" prefix.
+var capabilityRegexp = regexp.MustCompile(`^(CAP_)?[A-Z_]+$`)
+
+// validate returns the errors of an unknown mode, of capabilities of privileged machines and of
+// invalid capability names.
+func (p IsolationProfile) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch p.Mode {
+	case "", PrivilegedIsolation:
+		if len(p.Capabilities) > 0 {
+			allErrs = append(allErrs, field.Forbidden(path.Child("capabilities"), "privileged machines have all the capabilities"))
+		}
+	case BaselineIsolation, CustomIsolation:
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("mode"), p.Mode,
+			[]string{string(PrivilegedIsolation), string(BaselineIsolation), string(CustomIsolation)}))
+	}
+	for i, c := range p.Capabilities {
+		if !capabilityRegexp.MatchString(c) {
+			allErrs = append(allErrs, field.Invalid(path.Child("capabilities").Index(i), c, "must be a capability name, e.g. CAP_SYS_PTRACE"))
+		}
+	}
+	return allErrs
+}
+
+// validateTaints returns the errors of invalid taints, and of taints with the same key and effect.
+func validateTaints(path *field.Path, taints []corev1.Taint) field.ErrorList {
+	var allErrs field.ErrorList
+	keys := map[string]bool{}
+	for i, taint := range taints {
+		taintPath := path.Index(i)
+		allErrs = append(allErrs, metav1validation.ValidateLabelName(taint.Key, taintPath.Child("key"))...)
+		for _, msg := range validation.IsValidLabelValue(taint.Value) {
+			allErrs = append(allErrs, field.Invalid(taintPath.Child("value"), taint.Value, msg))
+		}
+		switch taint.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			allErrs = append(allErrs, field.NotSupported(taintPath.Child("effect"), taint.Effect, []string{
+				string(corev1.TaintEffectNoSchedule), string(corev1.TaintEffectPreferNoSchedule), string(corev1.TaintEffectNoExecute),
+			}))
+		}
+		key := fmt.Sprintf("%s:%s", taint.Key, taint.Effect)
+		if keys[key] {
+			allErrs = append(allErrs, field.Duplicate(taintPath, key))
+		}
+		keys[key] = true
+	}
+	return allErrs
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type. The spec of
+// the template is immutable, the machines are rolled out to a new template to change them.
+func (c *ContainerdMachineTemplate) ValidateUpdate(old runtime.Object) error {
+	oldTemplate, ok := old.(*ContainerdMachineTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a ContainerdMachineTemplate but got a %T", old))
+	}
+	if !reflect.DeepEqual(c.Spec.Template.Spec, oldTemplate.Spec.Template.Spec) {
+		return apierrors.NewInvalid(GroupVersion.WithKind("ContainerdMachineTemplate").GroupKind(), c.Name, field.ErrorList{
+			field.Invalid(field.NewPath("spec", "template", "spec"), c.Spec.Template.Spec, "field is immutable"),
+		})
+	}
+	return nil
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+func (c *ContainerdMachineTemplate) ValidateDelete() error {
+	return nil
+}
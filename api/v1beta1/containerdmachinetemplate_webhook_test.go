@@ -0,0 +1,144 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestContainerdMachineTemplateValidate(t *testing.T) {
+	g := NewWithT(t)
+
+	template := &ContainerdMachineTemplate{}
+	template.Spec.Template.Spec.CustomImage = "kindest/node:v1.23.3"
+	g.Expect(template.ValidateCreate()).To(Succeed())
+
+	updated := template.DeepCopy()
+	updated.Labels = map[string]string{"env": "test"}
+	g.Expect(updated.ValidateUpdate(template)).To(Succeed())
+
+	updated.Spec.Template.Spec.CustomImage = "kindest/node:v1.24.0"
+	g.Expect(updated.ValidateUpdate(template)).NotTo(Succeed())
+
+	cpus, memory := resource.MustParse("1m"), resource.MustParse("2Gi")
+	invalid := template.DeepCopy()
+	invalid.Spec.Template.Spec.Resources = &MachineResources{CPUs: &cpus, Memory: &memory}
+	g.Expect(invalid.ValidateCreate()).NotTo(Succeed())
+
+	cpus = resource.MustParse("500m")
+	g.Expect(invalid.ValidateCreate()).To(Succeed())
+
+	images := template.DeepCopy()
+	images.Spec.Template.Spec.PreLoadImages = []string{"docker.io/calico/cni:v3.23.1", "oci-archive:///var/cache/images/cilium.tar", "docker-archive:///srv/kindnetd.tar"}
+	g.Expect(images.ValidateCreate()).To(Succeed())
+
+	images.Spec.Template.Spec.PreLoadImages = []string{"oci-archive://images/cilium.tar"}
+	g.Expect(images.ValidateCreate()).NotTo(Succeed())
+
+	pullSecrets := template.DeepCopy()
+	pullSecrets.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry-credentials"}}
+	g.Expect(pullSecrets.ValidateCreate()).To(Succeed())
+
+	pullSecrets.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{}}
+	g.Expect(pullSecrets.ValidateCreate()).NotTo(Succeed())
+
+	mounts := template.DeepCopy()
+	mounts.Spec.Template.Spec.ExtraMounts = []Mount{
+		{ContainerPath: "/var/lib/kubelet/pods", HostPath: "/srv/pods", Propagation: SharedMountPropagation},
+		{ContainerPath: "/var/lib/etcd", Volume: "etcd"},
+		{ContainerPath: "/var/cache", Type: TmpfsMountType},
+	}
+	g.Expect(mounts.ValidateCreate()).To(Succeed())
+
+	mounts.Spec.Template.Spec.ExtraMounts = []Mount{{ContainerPath: "/var/cache", Type: TmpfsMountType, Propagation: SharedMountPropagation}}
+	g.Expect(mounts.ValidateCreate()).NotTo(Succeed())
+
+	mounts.Spec.Template.Spec.ExtraMounts = []Mount{{ContainerPath: "/data", Type: VolumeMountType, HostPath: "/srv/data"}}
+	g.Expect(mounts.ValidateCreate()).NotTo(Succeed())
+
+	ports := template.DeepCopy()
+	ports.Spec.Template.Spec.ExtraPortMappings = []PortMapping{
+		{ContainerPort: 80, HostPort: 8080},
+		{ContainerPort: 30053, HostPort: 8080, Protocol: PortMappingProtocolUDP},
+		{ContainerPort: 443, ListenAddress: "127.0.0.1"},
+	}
+	g.Expect(ports.ValidateCreate()).To(Succeed())
+
+	ports.Spec.Template.Spec.ExtraPortMappings = append(ports.Spec.Template.Spec.ExtraPortMappings, PortMapping{ContainerPort: 8080, HostPort: 8080})
+	g.Expect(ports.ValidateCreate()).NotTo(Succeed())
+
+	ports.Spec.Template.Spec.ExtraPortMappings = []PortMapping{{ContainerPort: 80, ListenAddress: "localhost"}}
+	g.Expect(ports.ValidateCreate()).NotTo(Succeed())
+
+	address := template.DeepCopy()
+	address.Spec.Template.Spec.StaticIP = "172.18.0.10"
+	address.Spec.Template.Spec.MACAddress = "02:42:ac:12:00:0a"
+	g.Expect(address.ValidateCreate()).To(Succeed())
+
+	address.Spec.Template.Spec.StaticIP = "172.18.0"
+	g.Expect(address.ValidateCreate()).NotTo(Succeed())
+
+	address.Spec.Template.Spec.StaticIP = ""
+	address.Spec.Template.Spec.MACAddress = "02:42:ac"
+	g.Expect(address.ValidateCreate()).NotTo(Succeed())
+
+	kubelet := template.DeepCopy()
+	kubelet.Spec.Template.Spec.KubeletExtraArgs = map[string]string{"eviction-hard": "memory.available<200Mi", "max-pods": "50"}
+	kubelet.Spec.Template.Spec.KubeletConfigPatch = "featureGates:\n  GracefulNodeShutdown: true\n"
+	g.Expect(kubelet.ValidateCreate()).To(Succeed())
+
+	kubelet.Spec.Template.Spec.KubeletExtraArgs = map[string]string{"--max-pods": "50"}
+	g.Expect(kubelet.ValidateCreate()).NotTo(Succeed())
+
+	kubelet.Spec.Template.Spec.KubeletExtraArgs = map[string]string{"node-labels": "a=b c=d"}
+	g.Expect(kubelet.ValidateCreate()).NotTo(Succeed())
+
+	kubelet.Spec.Template.Spec.KubeletExtraArgs = nil
+	kubelet.Spec.Template.Spec.KubeletConfigPatch = "- maxPods: 50"
+	g.Expect(kubelet.ValidateCreate()).NotTo(Succeed())
+
+	node := template.DeepCopy()
+	node.Spec.Template.Spec.NodeLabels = map[string]string{"topology.kubernetes.io/zone": "zone-a"}
+	node.Spec.Template.Spec.NodeAnnotations = map[string]string{"example.com/owner": "test"}
+	node.Spec.Template.Spec.NodeTaints = []corev1.Taint{
+		{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute},
+	}
+	g.Expect(node.ValidateCreate()).To(Succeed())
+
+	node.Spec.Template.Spec.NodeTaints = append(node.Spec.Template.Spec.NodeTaints, corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectNoSchedule})
+	g.Expect(node.ValidateCreate()).NotTo(Succeed())
+
+	node.Spec.Template.Spec.NodeTaints = nil
+	node.Spec.Template.Spec.NodeLabels = map[string]string{"zone": "zone a"}
+	g.Expect(node.ValidateCreate()).NotTo(Succeed())
+
+	isolation := template.DeepCopy()
+	isolation.Spec.Template.Spec.IsolationProfile = &IsolationProfile{Mode: BaselineIsolation, Capabilities: []string{"CAP_SYS_PTRACE"}}
+	g.Expect(isolation.ValidateCreate()).To(Succeed())
+
+	isolation.Spec.Template.Spec.IsolationProfile.Mode = PrivilegedIsolation
+	g.Expect(isolation.ValidateCreate()).NotTo(Succeed())
+
+	providerID := ProviderIDPrefix + "machine"
+	template.Spec.Template.Spec.ProviderID = &providerID
+	g.Expect(template.ValidateCreate()).NotTo(Succeed())
+}
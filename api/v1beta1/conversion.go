@@ -0,0 +1,31 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// The v1beta1 types are the hub the other API versions are converted to and from.
+
+// Hub marks ContainerdCluster as a conversion hub.
+func (*ContainerdCluster) Hub() {}
+
+// Hub marks ContainerdClusterList as a conversion hub.
+func (*ContainerdClusterList) Hub() {}
+
+// Hub marks ContainerdMachine as a conversion hub.
+func (*ContainerdMachine) Hub() {}
+
+// Hub marks ContainerdMachineList as a conversion hub.
+func (*ContainerdMachineList) Hub() {}
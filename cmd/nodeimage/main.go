@@ -0,0 +1,73 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command nodeimage builds a custom node image in containerd from a recipe, to be used as the
+// CustomImage of ContainerdMachines, without Docker or other image build tooling.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/nodeimage"
+)
+
+func main() {
+	var recipePath string
+	var containerdAddress string
+	var namespace string
+	flag.StringVar(&recipePath, "recipe", "", "The path of the YAML recipe of the node image to build.")
+	flag.StringVar(&containerdAddress, "containerd-address", capc.DefaultAddress,
+		"The address of the containerd the image is built in, the path of its socket.")
+	flag.StringVar(&namespace, "namespace", "default",
+		"The containerd namespace of the provider, whose images are shared with the clusters.")
+	opts := zap.Options{
+		Development: true,
+	}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	log := zap.New(zap.UseFlagOptions(&opts))
+	if recipePath == "" {
+		log.Info("The --recipe flag is required")
+		os.Exit(2)
+	}
+
+	recipe, err := nodeimage.LoadRecipe(recipePath)
+	if err != nil {
+		log.Error(err, "Invalid recipe")
+		os.Exit(1)
+	}
+
+	runtime, err := capc.NewContainerdClient(containerdAddress, namespace)
+	if err != nil {
+		log.Error(err, "Failed to connect to containerd", "address", containerdAddress)
+		os.Exit(1)
+	}
+
+	ctx := logr.NewContext(ctrl.SetupSignalHandler(), log)
+	builder := &nodeimage.Builder{Runtime: runtime, Stdout: os.Stdout, Stderr: os.Stderr}
+	if err := builder.Build(ctx, recipe); err != nil {
+		log.Error(err, "Failed to build node image", "image", recipe.Image)
+		os.Exit(1)
+	}
+	log.Info("Built node image", "image", recipe.Image)
+}
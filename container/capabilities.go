@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/pkg/cap"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// AllCapabilities is the capabilities value that runs execs privileged.
+const AllCapabilities = "ALL"
+
+// execPrivilegesKey is the key type for accessing the exec privileges in passed contexts.
+type execPrivilegesKey struct{}
+
+// ExecPrivileges are the privileges exec processes run with.
+type ExecPrivileges struct {
+	// Privileged runs the exec with the capabilities of the container init, which are all of them
+	// for machine containers.
+	Privileged bool
+	// Capabilities are the capabilities granted to the exec when it is not privileged,
+	// e.g. "CAP_NET_ADMIN". No capabilities are granted if empty.
+	Capabilities []string
+}
+
+// PrivilegedExec runs execs with all the capabilities of the container.
+var PrivilegedExec = ExecPrivileges{Privileged: true}
+
+// ParseExecCapabilities parses a comma separated list of capabilities, with or without the "CAP_"
+// prefix, into exec privileges. "ALL" runs execs privileged and an empty list grants no capabilities.
+func ParseExecCapabilities(value string) (ExecPrivileges, error) {
+	if strings.EqualFold(strings.TrimSpace(value), AllCapabilities) {
+		return PrivilegedExec, nil
+	}
+
+	known := map[string]bool{}
+	for _, c := range cap.Known() {
+		known[c] = true
+	}
+
+	privileges := ExecPrivileges{}
+	for _, c := range strings.Split(value, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if !strings.HasPrefix(c, "CAP_") {
+			c = "CAP_" + c
+		}
+		if !known[c] {
+			return ExecPrivileges{}, fmt.Errorf("unknown capability %q", c)
+		}
+		privileges.Capabilities = append(privileges.Capabilities, c)
+	}
+	return privileges, nil
+}
+
+// WithExecPrivileges sets the privileges execs run with when the context does not set them.
+// Execs run privileged by default.
+func WithExecPrivileges(privileges ExecPrivileges) Option {
+	return func(c *containerdRuntime) {
+		c.execPrivileges = privileges
+	}
+}
+
+// ExecPrivilegesInto is used to store the privileges of the execs run with a context, e.g. to grant
+// a single command more capabilities than the runtime default.
+func ExecPrivilegesInto(ctx context.Context, privileges ExecPrivileges) context.Context {
+	return context.WithValue(ctx, execPrivilegesKey{}, privileges)
+}
+
+// execPrivilegesFrom returns the exec privileges stored in the context, or the runtime default.
+func (c *containerdRuntime) execPrivilegesFrom(ctx context.Context) ExecPrivileges {
+	if privileges, ok := ctx.Value(execPrivilegesKey{}).(ExecPrivileges); ok {
+		return privileges
+	}
+	return c.execPrivileges
+}
+
+// apply restricts the process to the privileges. Privileged processes keep the capabilities they
+// have, the others get the capabilities of the allowlist, limited to the ones of the container,
+// and cannot gain privileges through setuid binaries.
+func (p ExecPrivileges) apply(pspec *specs.Process) {
+	if p.Privileged {
+		return
+	}
+
+	allowed := p.Capabilities
+	if pspec.Capabilities != nil {
+		allowed = intersect(p.Capabilities, pspec.Capabilities.Bounding)
+	}
+	pspec.Capabilities = &specs.LinuxCapabilities{
+		Bounding:  allowed,
+		Effective: allowed,
+		Permitted: allowed,
+	}
+	pspec.NoNewPrivileges = true
+}
+
+// intersect returns the values of a that are in b.
+func intersect(a, b []string) []string {
+	in := map[string]bool{}
+	for _, v := range b {
+		in[v] = true
+	}
+	result := []string{}
+	for _, v := range a {
+		if in[v] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
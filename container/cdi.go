@@ -0,0 +1,267 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultCDISpecDirs are the directories of the Container Device Interface specs, in increasing order
+// of precedence, where the GPU vendor tools like nvidia-ctk write them.
+var DefaultCDISpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// cdiDevicesKey is the key type for accessing the CDI devices in passed contexts.
+type cdiDevicesKey struct{}
+
+// CDIDevicesInto is used to store the fully qualified names of the Container Device Interface devices
+// injected into the containers run with a context, e.g. "nvidia.com/gpu=0" or "amd.com/gpu=all".
+func CDIDevicesInto(ctx context.Context, devices []string) context.Context {
+	return context.WithValue(ctx, cdiDevicesKey{}, devices)
+}
+
+// cdiDevicesFrom returns the CDI devices stored in the context, none if not set.
+func cdiDevicesFrom(ctx context.Context) []string {
+	if devices, ok := ctx.Value(cdiDevicesKey{}).([]string); ok {
+		return devices
+	}
+	return nil
+}
+
+// WithCDISpecDirs sets the directories the Container Device Interface specs are read from, in
+// increasing order of precedence.
+func WithCDISpecDirs(dirs ...string) Option {
+	return func(c *containerdRuntime) {
+		c.cdiSpecDirs = dirs
+	}
+}
+
+// cdiSpec is the subset of a Container Device Interface spec the runtime applies.
+type cdiSpec struct {
+	Kind           string            `json:"kind"`
+	Devices        []cdiDevice       `json:"devices"`
+	ContainerEdits cdiContainerEdits `json:"containerEdits,omitempty"`
+}
+
+// cdiDevice is a device of a CDI spec.
+type cdiDevice struct {
+	Name           string            `json:"name"`
+	ContainerEdits cdiContainerEdits `json:"containerEdits"`
+}
+
+// cdiContainerEdits are the changes of the OCI spec of a container injecting a CDI device.
+type cdiContainerEdits struct {
+	Env         []string        `json:"env,omitempty"`
+	DeviceNodes []cdiDeviceNode `json:"deviceNodes,omitempty"`
+	Hooks       []cdiHook       `json:"hooks,omitempty"`
+	Mounts      []cdiMount      `json:"mounts,omitempty"`
+}
+
+// cdiDeviceNode is a device node of the host exposed in a container.
+type cdiDeviceNode struct {
+	Path        string `json:"path"`
+	HostPath    string `json:"hostPath,omitempty"`
+	Permissions string `json:"permissions,omitempty"`
+}
+
+// cdiHook is an OCI hook run at the named point of the lifecycle of a container.
+type cdiHook struct {
+	HookName string   `json:"hookName"`
+	Path     string   `json:"path"`
+	Args     []string `json:"args,omitempty"`
+	Env      []string `json:"env,omitempty"`
+	Timeout  *int     `json:"timeout,omitempty"`
+}
+
+// cdiMount is a mount of a host path, e.g. of the driver libraries, in a container.
+type cdiMount struct {
+	HostPath      string   `json:"hostPath"`
+	ContainerPath string   `json:"containerPath"`
+	Type          string   `json:"type,omitempty"`
+	Options       []string `json:"options,omitempty"`
+}
+
+// cdiSpecDevice is a device of a spec, with the edits of the spec shared by all its devices.
+type cdiSpecDevice struct {
+	spec   *cdiSpec
+	device cdiDevice
+}
+
+// loadCDIDevices returns the devices of the CDI specs of the directories by fully qualified name. The
+// devices of the specs of later directories override the devices with the same name.
+func loadCDIDevices(dirs []string) (map[string]cdiSpecDevice, error) {
+	devices := map[string]cdiSpecDevice{}
+	for _, dir := range dirs {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read CDI spec directory %q: %v", dir, err)
+		}
+		// ReadDir sorts the files by name, the later files take precedence.
+		for _, file := range files {
+			ext := filepath.Ext(file.Name())
+			if file.IsDir() || (ext != ".json" && ext != ".yaml") {
+				continue
+			}
+			path := filepath.Join(dir, file.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CDI spec %q: %v", path, err)
+			}
+			spec := &cdiSpec{}
+			if err := yaml.Unmarshal(data, spec); err != nil {
+				return nil, fmt.Errorf("failed to parse CDI spec %q: %v", path, err)
+			}
+			if !strings.Contains(spec.Kind, "/") {
+				return nil, fmt.Errorf("invalid kind %q of CDI spec %q", spec.Kind, path)
+			}
+			for _, device := range spec.Devices {
+				devices[spec.Kind+"="+device.Name] = cdiSpecDevice{spec: spec, device: device}
+			}
+		}
+	}
+	return devices, nil
+}
+
+// withCDIDevices applies the edits of the CDI devices with the fully qualified names, and the edits of
+// their specs, to the spec. The specs are read from the directories when the container is created, so
+// that the devices of the drivers installed on the host are found.
+func withCDIDevices(dirs []string, names []string) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		devices, err := loadCDIDevices(dirs)
+		if err != nil {
+			return err
+		}
+		if s.Process == nil {
+			s.Process = &specs.Process{}
+		}
+		if s.Linux == nil {
+			s.Linux = &specs.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &specs.LinuxResources{}
+		}
+		if s.Hooks == nil {
+			s.Hooks = &specs.Hooks{}
+		}
+
+		specEdited := map[*cdiSpec]bool{}
+		for _, name := range names {
+			device, ok := devices[name]
+			if !ok {
+				return fmt.Errorf("unknown CDI device %q, its spec must be in one of %s", name, strings.Join(dirs, ", "))
+			}
+			if !specEdited[device.spec] {
+				if err := device.spec.ContainerEdits.apply(s); err != nil {
+					return fmt.Errorf("failed to inject CDI device %q: %v", name, err)
+				}
+				specEdited[device.spec] = true
+			}
+			if err := device.device.ContainerEdits.apply(s); err != nil {
+				return fmt.Errorf("failed to inject CDI device %q: %v", name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// apply applies the edits to the spec, whose process, linux resources and hooks must be set.
+func (e cdiContainerEdits) apply(s *oci.Spec) error {
+	s.Process.Env = mergeEnv(s.Process.Env, e.Env)
+
+	for _, node := range e.DeviceNodes {
+		hostPath := node.HostPath
+		if hostPath == "" {
+			hostPath = node.Path
+		}
+		device, err := linuxDevice(hostPath)
+		if err != nil {
+			return err
+		}
+		device.Path = node.Path
+		permissions := node.Permissions
+		if permissions == "" {
+			permissions = defaultDevicePermissions
+		}
+		addDevice(s, device, permissions)
+	}
+
+	for _, m := range e.Mounts {
+		mountType := m.Type
+		if mountType == "" {
+			mountType = "bind"
+		}
+		s.Mounts = append(s.Mounts, specs.Mount{
+			Source:      m.HostPath,
+			Destination: m.ContainerPath,
+			Type:        mountType,
+			Options:     m.Options,
+		})
+	}
+	// Parent directories must be mounted before their children.
+	sort.SliceStable(s.Mounts, func(i, j int) bool {
+		return strings.Count(filepath.Clean(s.Mounts[i].Destination), "/") < strings.Count(filepath.Clean(s.Mounts[j].Destination), "/")
+	})
+
+	for _, h := range e.Hooks {
+		hook := specs.Hook{Path: h.Path, Args: h.Args, Env: h.Env, Timeout: h.Timeout}
+		switch h.HookName {
+		case "prestart":
+			s.Hooks.Prestart = append(s.Hooks.Prestart, hook)
+		case "createRuntime":
+			s.Hooks.CreateRuntime = append(s.Hooks.CreateRuntime, hook)
+		case "createContainer":
+			s.Hooks.CreateContainer = append(s.Hooks.CreateContainer, hook)
+		case "startContainer":
+			s.Hooks.StartContainer = append(s.Hooks.StartContainer, hook)
+		case "poststart":
+			s.Hooks.Poststart = append(s.Hooks.Poststart, hook)
+		case "poststop":
+			s.Hooks.Poststop = append(s.Hooks.Poststop, hook)
+		default:
+			return fmt.Errorf("unknown hook %q", h.HookName)
+		}
+	}
+	return nil
+}
+
+// mergeEnv returns the environment with the variables set, replacing the ones with the same name.
+func mergeEnv(env, set []string) []string {
+	for _, variable := range set {
+		name := strings.SplitN(variable, "=", 2)[0]
+		replaced := false
+		for i, existing := range env {
+			if strings.SplitN(existing, "=", 2)[0] == name {
+				env[i] = variable
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			env = append(env, variable)
+		}
+	}
+	return env
+}
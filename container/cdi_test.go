@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// testCDISpec is a CDI spec of a fake GPU backed by /dev/null.
+const testCDISpec = `cdiVersion: "0.5.0"
+kind: example.com/gpu
+devices:
+  - name: "0"
+    containerEdits:
+      deviceNodes:
+        - path: /dev/gpu0
+          hostPath: /dev/null
+containerEdits:
+  env:
+    - GPU_VISIBLE=all
+  mounts:
+    - hostPath: /usr/lib/libgpu.so.1
+      containerPath: /usr/lib/libgpu.so.1
+      options: [ro, nosuid, nodev, bind]
+  hooks:
+    - hookName: createContainer
+      path: /usr/bin/gpu-ctk
+      args: [gpu-ctk, hook, update-ldcache]
+`
+
+func TestWithCDIDevices(t *testing.T) {
+	g := NewWithT(t)
+
+	etcDir, runDir := t.TempDir(), t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(etcDir, "gpu.yaml"), []byte(testCDISpec), 0o600)).To(Succeed())
+	dirs := []string{etcDir, runDir}
+
+	s := &oci.Spec{Process: &specs.Process{Env: []string{"PATH=/usr/bin", "GPU_VISIBLE=none"}}}
+	g.Expect(withCDIDevices(dirs, []string{"example.com/gpu=0"})(context.Background(), nil, nil, s)).To(Succeed())
+	g.Expect(s.Process.Env).To(Equal([]string{"PATH=/usr/bin", "GPU_VISIBLE=all"}))
+	g.Expect(s.Linux.Devices).To(HaveLen(1))
+	g.Expect(s.Linux.Devices[0].Path).To(Equal("/dev/gpu0"))
+	g.Expect(s.Linux.Devices[0].Major).To(Equal(int64(1)))
+	g.Expect(s.Linux.Resources.Devices).To(HaveLen(1))
+	g.Expect(s.Linux.Resources.Devices[0].Access).To(Equal("rwm"))
+	g.Expect(s.Mounts).To(ConsistOf(specs.Mount{
+		Source:      "/usr/lib/libgpu.so.1",
+		Destination: "/usr/lib/libgpu.so.1",
+		Type:        "bind",
+		Options:     []string{"ro", "nosuid", "nodev", "bind"},
+	}))
+	g.Expect(s.Hooks.CreateContainer).To(HaveLen(1))
+	g.Expect(s.Hooks.CreateContainer[0].Path).To(Equal("/usr/bin/gpu-ctk"))
+
+	// The specs of later directories take precedence.
+	g.Expect(os.WriteFile(filepath.Join(runDir, "gpu.json"), []byte(`{"cdiVersion": "0.5.0", "kind": "example.com/gpu", "devices": [{"name": "0", "containerEdits": {"deviceNodes": [{"path": "/dev/missing-gpu"}]}}]}`), 0o600)).To(Succeed())
+	g.Expect(withCDIDevices(dirs, []string{"example.com/gpu=0"})(context.Background(), nil, nil, &oci.Spec{})).ToNot(Succeed())
+
+	g.Expect(withCDIDevices(dirs, []string{"example.com/gpu=1"})(context.Background(), nil, nil, &oci.Spec{})).ToNot(Succeed())
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/cgroups"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// cgroupMountPath is where the cgroup filesystem is mounted in the containers.
+const cgroupMountPath = "/sys/fs/cgroup"
+
+// CgroupMode is the cgroup hierarchy of the host the containers run on.
+type CgroupMode string
+
+const (
+	// CgroupModeAuto detects the cgroup hierarchy of the host.
+	CgroupModeAuto CgroupMode = "auto"
+	// CgroupModeV1 is a legacy or hybrid cgroup v1 hierarchy.
+	CgroupModeV1 CgroupMode = "v1"
+	// CgroupModeV2 is a unified cgroup v2 hierarchy.
+	CgroupModeV2 CgroupMode = "v2"
+)
+
+// ParseCgroupMode parses a cgroup mode: auto, v1 or v2.
+func ParseCgroupMode(mode string) (CgroupMode, error) {
+	switch m := CgroupMode(mode); m {
+	case CgroupModeAuto, CgroupModeV1, CgroupModeV2:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unsupported cgroup mode %q, must be one of auto, v1 or v2", mode)
+	}
+}
+
+// detectCgroupMode returns the cgroup mode of the host. Hybrid hosts are v1 hosts for the containers,
+// as the v1 controllers are the ones kubelet uses there.
+func detectCgroupMode() CgroupMode {
+	if cgroups.Mode() == cgroups.Unified {
+		return CgroupModeV2
+	}
+	return CgroupModeV1
+}
+
+// WithCgroupMode sets the cgroup hierarchy of the host instead of detecting it.
+func WithCgroupMode(mode CgroupMode) Option {
+	return func(c *containerdRuntime) {
+		if mode == CgroupModeAuto {
+			mode = detectCgroupMode()
+		}
+		c.cgroupMode = mode
+	}
+}
+
+// cgroupSpecOpts returns the options making the cgroup hierarchy usable by the systemd and kubelet
+// running in the containers. On cgroup v2 hosts each container gets a private cgroup namespace, like
+// docker does, with a writable cgroup2 mount, so that its cgroup is the root of the hierarchy it sees
+// and systemd can manage the subtree delegated to it. On cgroup v1 hosts the containers keep the host
+// cgroup namespace that the kind entrypoint expects there.
+func (c *containerdRuntime) cgroupSpecOpts() []oci.SpecOpts {
+	if c.cgroupMode != CgroupModeV2 {
+		return nil
+	}
+	return []oci.SpecOpts{
+		oci.WithLinuxNamespace(specs.LinuxNamespace{Type: specs.CgroupNamespace}),
+		withCgroup2Mount,
+	}
+}
+
+// withCgroup2Mount replaces the cgroup mount of the spec with a writable cgroup2 mount.
+func withCgroup2Mount(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+	mounts := make([]specs.Mount, 0, len(s.Mounts)+1)
+	for _, m := range s.Mounts {
+		if m.Destination != cgroupMountPath {
+			mounts = append(mounts, m)
+		}
+	}
+	s.Mounts = append(mounts, specs.Mount{
+		Destination: cgroupMountPath,
+		Type:        "cgroup2",
+		Source:      "cgroup2",
+		Options:     []string{"nosuid", "noexec", "nodev", "relatime", "rw"},
+	})
+	return nil
+}
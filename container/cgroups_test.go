@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseCgroupMode(t *testing.T) {
+	g := NewWithT(t)
+
+	for _, mode := range []string{"auto", "v1", "v2"} {
+		parsed, err := ParseCgroupMode(mode)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(string(parsed)).To(Equal(mode))
+	}
+	_, err := ParseCgroupMode("hybrid")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestCgroupSpecOpts(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &containerdRuntime{}
+	WithCgroupMode(CgroupModeV1)(c)
+	g.Expect(c.cgroupSpecOpts()).To(BeEmpty())
+
+	WithCgroupMode(CgroupModeV2)(c)
+	s := &oci.Spec{
+		Linux: &specs.Linux{},
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/sys/fs/cgroup", Type: "cgroup", Source: "cgroup", Options: []string{"ro"}},
+		},
+	}
+	for _, opt := range c.cgroupSpecOpts() {
+		g.Expect(opt(context.Background(), nil, nil, s)).To(Succeed())
+	}
+	g.Expect(s.Linux.Namespaces).To(ConsistOf(specs.LinuxNamespace{Type: specs.CgroupNamespace}))
+	g.Expect(s.Mounts).To(HaveLen(2))
+	g.Expect(s.Mounts[1].Type).To(Equal("cgroup2"))
+	g.Expect(s.Mounts[1].Options).To(ContainElement("rw"))
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// checkpointRefPrefix is the prefix of the names of the checkpoint images.
+	checkpointRefPrefix = "checkpoint.capc.x-k8s.io/"
+	// checkpointLabelPrefix prefixes the container labels stored on a checkpoint image, so that the
+	// restored container gets the network, port and log settings of the checkpointed one.
+	checkpointLabelPrefix = "io.x-k8s.capc.checkpoint/"
+)
+
+// CheckpointRef returns the reference of the checkpoint image of a container with the given name,
+// e.g. "checkpoint.capc.x-k8s.io/my-cluster-control-plane-abcde:suspend".
+func CheckpointRef(containerName, name string) string {
+	return checkpointRefPrefix + containerName + ":" + name
+}
+
+// CheckpointContainer checkpoints the task of a running container with CRIU, together with its
+// writable layer, runtime and spec, into a checkpoint image with the given reference. If exit is
+// set, the task exits once checkpointed, e.g. to suspend the container, otherwise it keeps running.
+// A container checkpointed with exit is not restarted by MonitorRestarts until it is restored.
+// Volumes are not part of the checkpoint, they are kept on the host until the container is deleted.
+func (c *containerdRuntime) CheckpointContainer(ctx context.Context, containerName, ref string, exit bool) error {
+	ctx = c.withNamespace(ctx)
+
+	ctx, releaseLease, err := c.withLease(ctx, "checkpoint/"+containerName)
+	if err != nil {
+		return err
+	}
+	defer releaseLease()
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+	labels, err := cntr.Labels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get labels of container %q: %v", containerName, err)
+	}
+
+	opts := []containerd.CheckpointOpts{
+		containerd.WithCheckpointImage,
+		containerd.WithCheckpointRW,
+		containerd.WithCheckpointTask,
+		containerd.WithCheckpointRuntime,
+	}
+	if exit {
+		opts = append(opts, containerd.WithCheckpointTaskExit)
+		// The container is marked before its task exits, so that the restart monitor does not start
+		// it again until it is restored.
+		if _, err := cntr.SetLabels(ctx, map[string]string{stoppedLabel: "true"}); err != nil {
+			return fmt.Errorf("failed to mark container %q stopped: %v", containerName, err)
+		}
+	}
+	img, err := cntr.Checkpoint(ctx, ref, opts...)
+	if err != nil {
+		if exit {
+			_, _ = cntr.SetLabels(ctx, map[string]string{stoppedLabel: ""})
+		}
+		return fmt.Errorf("failed to checkpoint container %q: %v", containerName, err)
+	}
+
+	if _, err := c.client.ImageService().Update(ctx, images.Image{
+		Name:   img.Name(),
+		Labels: checkpointLabels(labels),
+	}, "labels"); err != nil {
+		return fmt.Errorf("failed to label checkpoint %q: %v", ref, err)
+	}
+
+	if exit {
+		// The exited task is deleted, the container is left without a task until it is restored.
+		if err := c.deleteTask(ctx, cntr); err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to delete task of checkpointed container %q: %v", containerName, err)
+		}
+	}
+	return nil
+}
+
+// RestoreContainer recreates a container from the checkpoint image with the given reference and
+// restores its task. The container must not be running, an existing container is replaced, keeping
+// its volumes and logs. The container is attached to its network again, with the same host ports
+// and, if the IPAM plugin supports it, the same IPs.
+func (c *containerdRuntime) RestoreContainer(ctx context.Context, containerName, ref string) error {
+	ctx = c.withNamespace(ctx)
+
+	ctx, releaseLease, err := c.withLease(ctx, "container/"+containerName)
+	if err != nil {
+		return err
+	}
+	defer releaseLease()
+
+	checkpoint, err := c.client.GetImage(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("failed to get checkpoint %q: %v", ref, err)
+	}
+	labels := labelsFromCheckpoint(checkpoint.Labels())
+
+	if existing, err := c.client.LoadContainer(ctx, containerName); err == nil {
+		status, err := containerStatus(ctx, existing)
+		if err != nil {
+			return err
+		}
+		if status.Status == containerd.Running || status.Status == containerd.Paused || status.Status == containerd.Pausing {
+			return fmt.Errorf("container %q is running, it must be stopped before it is restored", containerName)
+		}
+		if err := c.deleteContainer(ctx, existing); err != nil {
+			return err
+		}
+	} else if !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+
+	ports, err := portMappingsFromLabels(labels)
+	if err != nil {
+		return err
+	}
+	if _, err := c.ports.allocate(ports); err != nil {
+		return fmt.Errorf("failed to reserve the host ports of container %q: %v", containerName, err)
+	}
+	releasePorts := func() { c.ports.release(ports) }
+
+	opts := []containerd.RestoreOpts{
+		containerd.WithRestoreImage,
+		containerd.WithRestoreSpec,
+		containerd.WithRestoreRuntime,
+		containerd.WithRestoreRW,
+	}
+
+	var attachment *networkAttachment
+	network := labels[networkLabel]
+	if labels[netnsLabel] != "" && c.cni != nil {
+		address, err := staticAddressFromLabels(labels)
+		if err != nil {
+			releasePorts()
+			return err
+		}
+		address.IPs, err = containerIPs(labels)
+		if err != nil {
+			releasePorts()
+			return err
+		}
+		attachment, err = c.cni.setup(ctx, c.stateDir, containerName, network, ports, address)
+		if err != nil {
+			releasePorts()
+			return err
+		}
+		networkLabels, err := attachment.labels()
+		if err != nil {
+			_ = c.cni.teardown(ctx, containerName, network, attachment.netnsPath, ports)
+			releasePorts()
+			return err
+		}
+		for key, val := range networkLabels {
+			labels[key] = val
+		}
+		opts = append(opts, withRestoreOpts(containerd.NewContainerOpts(withNetNSUpdate(attachment.netnsPath))))
+	}
+	opts = append(opts, withRestoreOpts(containerd.WithContainerLabels(labels)))
+
+	cleanup := func() {
+		if attachment != nil {
+			_ = c.cni.teardown(ctx, containerName, network, attachment.netnsPath, ports)
+		}
+		releasePorts()
+	}
+
+	cntr, err := c.client.Restore(ctx, containerName, checkpoint, opts...)
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("failed to restore container %q from %q: %v", containerName, ref, err)
+	}
+
+	logConfig, err := c.logConfigFromLabels(labels)
+	if err != nil {
+		logConfig = c.logConfig
+	}
+	ioCreator, err := c.taskLog(containerName, logConfig)
+	if err != nil {
+		_ = cntr.Delete(ctx, containerd.WithSnapshotCleanup)
+		cleanup()
+		return err
+	}
+	task, err := cntr.NewTask(ctx, ioCreator, containerd.WithTaskCheckpoint(checkpoint))
+	if err != nil {
+		_ = cntr.Delete(ctx, containerd.WithSnapshotCleanup)
+		cleanup()
+		return fmt.Errorf("failed to restore task of container %q: %v", containerName, err)
+	}
+	if err := task.Start(ctx); err != nil {
+		_, _ = task.Delete(ctx, containerd.WithProcessKill)
+		_ = cntr.Delete(ctx, containerd.WithSnapshotCleanup)
+		cleanup()
+		return fmt.Errorf("failed to start restored task of container %q: %v", containerName, err)
+	}
+	return nil
+}
+
+// DeleteCheckpoint deletes the checkpoint image with the given reference, its content is garbage
+// collected by containerd. Deleting a checkpoint that does not exist is not an error.
+func (c *containerdRuntime) DeleteCheckpoint(ctx context.Context, ref string) error {
+	ctx = c.withNamespace(ctx)
+
+	if err := c.client.ImageService().Delete(ctx, ref); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to delete checkpoint %q: %v", ref, err)
+	}
+	return nil
+}
+
+// withRestoreOpts applies container options when restoring a container, after the restore options
+// preceding it.
+func withRestoreOpts(opt containerd.NewContainerOpts) containerd.RestoreOpts {
+	return func(context.Context, string, *containerd.Client, containerd.Image, *imagespec.Index) containerd.NewContainerOpts {
+		return opt
+	}
+}
+
+// checkpointLabels returns the labels of a checkpoint image storing the given container labels.
+func checkpointLabels(containerLabels map[string]string) map[string]string {
+	labels := map[string]string{}
+	for key, val := range containerLabels {
+		labels[checkpointLabelPrefix+key] = val
+	}
+	return labels
+}
+
+// labelsFromCheckpoint returns the container labels stored in the labels of a checkpoint image. The
+// restored container runs, it is not marked stopped.
+func labelsFromCheckpoint(checkpointLabels map[string]string) map[string]string {
+	labels := map[string]string{}
+	for key, val := range checkpointLabels {
+		if strings.HasPrefix(key, checkpointLabelPrefix) {
+			labels[strings.TrimPrefix(key, checkpointLabelPrefix)] = val
+		}
+	}
+	delete(labels, stoppedLabel)
+	return labels
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCheckpointLabels(t *testing.T) {
+	g := NewWithT(t)
+
+	containerLabels := map[string]string{
+		networkLabel:       "kind",
+		RestartPolicyLabel: "always",
+	}
+	labels := checkpointLabels(containerLabels)
+	g.Expect(labels).To(HaveKeyWithValue("io.x-k8s.capc.checkpoint/io.x-k8s.capc.network", "kind"))
+
+	// Labels set on the image by containerd are not container labels.
+	labels["containerd.io/gc.ref.content.0"] = "sha256:abc"
+	g.Expect(labelsFromCheckpoint(labels)).To(Equal(containerLabels))
+
+	// A container restored from the checkpoint of a stopped container runs.
+	labels[checkpointLabelPrefix+stoppedLabel] = "true"
+	g.Expect(labelsFromCheckpoint(labels)).To(Equal(containerLabels))
+}
+
+func TestCheckpointRef(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(CheckpointRef("my-cluster-control-plane-abcde", "suspend")).To(Equal("checkpoint.capc.x-k8s.io/my-cluster-control-plane-abcde:suspend"))
+}
+
+func TestRequestedIPsArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	args := requestedIPsArgs([]net.IP{net.ParseIP("10.89.0.5"), net.ParseIP("fd00::5")})
+	g.Expect(args).To(Equal([][2]string{{"IgnoreUnknown", "1"}, {"IP", "10.89.0.5,fd00::5"}}))
+}
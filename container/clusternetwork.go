@@ -0,0 +1,154 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	// maxBridgeNameLength is the maximum length of the name of a network interface on Linux.
+	maxBridgeNameLength = 15
+	// hostLocalDataDir is the directory where the host-local IPAM plugin records the addresses it
+	// allocated, in a directory per network.
+	hostLocalDataDir = "/var/lib/cni/networks"
+)
+
+// networkNameRegexp matches the valid names of CNI networks.
+var networkNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-]*$`)
+
+// networkKey is the key type for accessing the network in passed contexts.
+type networkKey struct{}
+
+// Network is a bridge network with host-local IPAM created by the runtime for the containers of a
+// cluster, so that clusters do not share the default network of the host.
+type Network struct {
+	// Name is the name of the CNI network.
+	Name string
+	// Bridge is the name of the bridge device of the network on the host.
+	Bridge string
+	// Subnets are the subnets the addresses of the containers are allocated from, at most one per IP
+	// family: the containers of a network with an IPv4 and an IPv6 subnet get an address of each.
+	Subnets []string
+	// MTU is the MTU of the bridge and of the interfaces of the containers, the default of the host
+	// if zero.
+	MTU int
+}
+
+// NetworkInto stores in the context the network the containers created with it are attached to,
+// instead of the network of their run configuration. The configuration of the network is written by
+// the runtime when the first container is attached to it, unless the CNI configuration directory
+// has one with the same name, and is removed with DeleteNetwork.
+func NetworkInto(ctx context.Context, network Network) context.Context {
+	return context.WithValue(ctx, networkKey{}, network)
+}
+
+// networkFrom returns the network stored in the context, if any.
+func networkFrom(ctx context.Context) (Network, bool) {
+	network, ok := ctx.Value(networkKey{}).(Network)
+	return network, ok
+}
+
+// validate returns an error if the network cannot be configured.
+func (n Network) validate() error {
+	if !networkNameRegexp.MatchString(n.Name) {
+		return fmt.Errorf("invalid network name %q", n.Name)
+	}
+	if n.Bridge == "" || len(n.Bridge) > maxBridgeNameLength {
+		return fmt.Errorf("invalid bridge name %q of network %q: must be 1 to %d characters", n.Bridge, n.Name, maxBridgeNameLength)
+	}
+	if len(n.Subnets) == 0 {
+		return fmt.Errorf("network %q has no subnet", n.Name)
+	}
+	families := map[bool]bool{}
+	for _, subnet := range n.Subnets {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return fmt.Errorf("invalid subnet of network %q: %v", n.Name, err)
+		}
+		ipv4 := ipNet.IP.To4() != nil
+		if families[ipv4] {
+			return fmt.Errorf("network %q has more than one subnet of the same IP family", n.Name)
+		}
+		families[ipv4] = true
+	}
+	if n.MTU < 0 {
+		return fmt.Errorf("invalid MTU %d of network %q", n.MTU, n.Name)
+	}
+	return nil
+}
+
+// configFile returns the path of the configuration file of the named network written by the runtime.
+func (n *cniNetwork) configFile(network string) string {
+	return filepath.Join(n.networksDir, network+".conflist")
+}
+
+// ensureNetwork writes the configuration of the network, unless it is already written.
+func (n *cniNetwork) ensureNetwork(network Network) error {
+	if err := network.validate(); err != nil {
+		return err
+	}
+	config := bridgeConfig(network)
+	path := n.configFile(network.Name)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, config) {
+		return nil
+	}
+
+	if err := os.MkdirAll(n.networksDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create networks directory: %v", err)
+	}
+	// Write the file atomically, the configuration of the network is read when containers are
+	// attached to it or detached from it concurrently.
+	tmp, err := os.CreateTemp(n.networksDir, network.Name+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write configuration of network %q: %v", network.Name, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(config); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write configuration of network %q: %v", network.Name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write configuration of network %q: %v", network.Name, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write configuration of network %q: %v", network.Name, err)
+	}
+	return nil
+}
+
+// DeleteNetwork removes the configuration of the named network written by the runtime, and the
+// addresses allocated on it. The bridge device of the network is left on the host. Deleting a
+// network that does not exist is not an error.
+func (c *containerdRuntime) DeleteNetwork(ctx context.Context, name string) error {
+	if c.cni == nil {
+		return nil
+	}
+	if !networkNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid network name %q", name)
+	}
+	if err := os.Remove(c.cni.configFile(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove configuration of network %q: %v", name, err)
+	}
+	if err := os.RemoveAll(filepath.Join(c.cni.hostLocalDataDir, name)); err != nil {
+		return fmt.Errorf("failed to remove addresses of network %q: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEnsureNetwork(t *testing.T) {
+	g := NewWithT(t)
+
+	n := &cniNetwork{confDir: t.TempDir(), networksDir: filepath.Join(t.TempDir(), "networks")}
+	network := Network{Name: "capc-default-test", Bridge: "capc-1a2b3c4d5e", Subnets: []string{"10.90.0.0/24"}, MTU: 1400}
+	g.Expect(n.ensureNetwork(network)).To(Succeed())
+	// Writing the same configuration again is a no-op.
+	g.Expect(n.ensureNetwork(network)).To(Succeed())
+
+	confList, err := n.networkConfig("capc-default-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(confList.Name).To(Equal("capc-default-test"))
+	g.Expect(confList.Plugins[0].Network.Type).To(Equal("bridge"))
+	g.Expect(string(confList.Plugins[0].Bytes)).To(ContainSubstring(`"bridge":"capc-1a2b3c4d5e"`))
+	g.Expect(string(confList.Plugins[0].Bytes)).To(ContainSubstring(`"mtu":1400`))
+	g.Expect(string(confList.Plugins[0].Bytes)).To(ContainSubstring(`"subnet":"10.90.0.0/24"`))
+
+	// A dual-stack network gets an address and a default route of each IP family.
+	g.Expect(n.ensureNetwork(Network{Name: "capc-dual", Bridge: "capc1", Subnets: []string{"10.91.0.0/24", "fd00:10:91::/64"}})).To(Succeed())
+	confList, err = n.networkConfig("capc-dual")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(confList.Plugins[0].Bytes)).To(ContainSubstring(`"ranges":[[{"subnet":"10.91.0.0/24"}],[{"subnet":"fd00:10:91::/64"}]]`))
+	g.Expect(string(confList.Plugins[0].Bytes)).To(ContainSubstring(`"routes":[{"dst":"0.0.0.0/0"},{"dst":"::/0"}]`))
+
+	// The other networks still get the default bridge.
+	confList, err = n.networkConfig("kind")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(confList.Plugins[0].Bytes)).To(ContainSubstring(`"bridge":"capc0"`))
+	g.Expect(string(confList.Plugins[0].Bytes)).ToNot(ContainSubstring(`"mtu"`))
+}
+
+func TestEnsureNetworkInvalid(t *testing.T) {
+	n := &cniNetwork{networksDir: t.TempDir()}
+
+	for _, network := range []Network{
+		{Name: "", Bridge: "capc1", Subnets: []string{"10.90.0.0/24"}},
+		{Name: "capc/test", Bridge: "capc1", Subnets: []string{"10.90.0.0/24"}},
+		{Name: "capc-test", Bridge: "", Subnets: []string{"10.90.0.0/24"}},
+		{Name: "capc-test", Bridge: "capc-bridge-too-long", Subnets: []string{"10.90.0.0/24"}},
+		{Name: "capc-test", Bridge: "capc1", Subnets: []string{"10.90.0.0"}},
+		{Name: "capc-test", Bridge: "capc1", Subnets: []string{"10.90.0.0/24"}, MTU: -1},
+		{Name: "capc-test", Bridge: "capc1"},
+		{Name: "capc-test", Bridge: "capc1", Subnets: []string{"10.90.0.0/24", "10.91.0.0/24"}},
+	} {
+		g := NewWithT(t)
+		g.Expect(n.ensureNetwork(network)).ToNot(Succeed(), "network %+v", network)
+	}
+}
+
+func TestDeleteNetwork(t *testing.T) {
+	g := NewWithT(t)
+
+	n := &cniNetwork{networksDir: t.TempDir(), hostLocalDataDir: t.TempDir()}
+	c := &containerdRuntime{cni: n}
+	g.Expect(n.ensureNetwork(Network{Name: "capc-test", Bridge: "capc1", Subnets: []string{"10.90.0.0/24"}})).To(Succeed())
+	g.Expect(os.MkdirAll(filepath.Join(n.hostLocalDataDir, "capc-test"), 0o700)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(n.hostLocalDataDir, "capc-test", "10.90.0.2"), []byte("machine"), 0o600)).To(Succeed())
+
+	g.Expect(c.DeleteNetwork(context.Background(), "capc-test")).To(Succeed())
+	g.Expect(n.configFile("capc-test")).ToNot(BeAnExistingFile())
+	g.Expect(filepath.Join(n.hostLocalDataDir, "capc-test")).ToNot(BeADirectory())
+
+	// Deleting it again is not an error.
+	g.Expect(c.DeleteNetwork(context.Background(), "capc-test")).To(Succeed())
+	g.Expect(c.DeleteNetwork(context.Background(), "../capc-test")).ToNot(Succeed())
+}
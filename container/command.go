@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+// commandOverrideKey is the key type for accessing the command override in passed contexts.
+type commandOverrideKey struct{}
+
+// CommandOverride overrides the process the containers run, e.g. to use node images with another
+// init or to wrap it in a debugger, without rebuilding the images.
+type CommandOverride struct {
+	// Entrypoint replaces the entrypoint of the image, and drops its command like docker run --entrypoint.
+	Entrypoint []string
+	// Command replaces the command of the image, or of the container input.
+	Command []string
+	// ExtraArgs are appended to the arguments of the process, after the command.
+	ExtraArgs []string
+}
+
+// CommandOverrideInto is used to store the command override of the containers run with a context.
+func CommandOverrideInto(ctx context.Context, override CommandOverride) context.Context {
+	return context.WithValue(ctx, commandOverrideKey{}, override)
+}
+
+// commandOverrideFrom returns the command override stored in the context, none if not set.
+func commandOverrideFrom(ctx context.Context) CommandOverride {
+	if override, ok := ctx.Value(commandOverrideKey{}).(CommandOverride); ok {
+		return override
+	}
+	return CommandOverride{}
+}
+
+// apply overrides the entrypoint and command of the run configuration, which must be a copy owned by
+// the caller.
+func (o CommandOverride) apply(runConfig *container.RunContainerInput) {
+	if len(o.Entrypoint) > 0 {
+		runConfig.Entrypoint = o.Entrypoint
+	}
+	if len(o.Command) > 0 {
+		runConfig.CommandArgs = o.Command
+	}
+}
+
+// withExtraArgs appends the arguments to the process of the spec. It must come after the options
+// setting the process arguments.
+func withExtraArgs(args []string) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Process == nil {
+			s.Process = &specs.Process{}
+		}
+		s.Process.Args = append(s.Process.Args, args...)
+		return nil
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+func TestCommandOverride(t *testing.T) {
+	g := NewWithT(t)
+
+	runConfig := &container.RunContainerInput{CommandArgs: []string{"--debug"}}
+	CommandOverride{}.apply(runConfig)
+	g.Expect(runConfig.Entrypoint).To(BeEmpty())
+	g.Expect(runConfig.CommandArgs).To(Equal([]string{"--debug"}))
+
+	CommandOverride{Entrypoint: []string{"/usr/local/bin/entrypoint"}, Command: []string{"/sbin/init"}}.apply(runConfig)
+	g.Expect(runConfig.Entrypoint).To(Equal([]string{"/usr/local/bin/entrypoint"}))
+	g.Expect(runConfig.CommandArgs).To(Equal([]string{"/sbin/init"}))
+
+	s := &oci.Spec{Process: &specs.Process{Args: []string{"/usr/local/bin/entrypoint", "/sbin/init"}}}
+	g.Expect(withExtraArgs([]string{"--log-level=debug"})(context.Background(), nil, nil, s)).To(Succeed())
+	g.Expect(s.Process.Args).To(Equal([]string{"/usr/local/bin/entrypoint", "/sbin/init", "--log-level=debug"}))
+}
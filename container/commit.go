@@ -0,0 +1,178 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/diff"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	refdocker "github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/rootfs"
+	"github.com/opencontainers/go-digest"
+	imagespec "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// CommitContainer creates the image with the given reference from the image of the container and the
+// changes of its writable layer, added as a new layer. The image keeps the configuration of the image
+// of the container, e.g. its entrypoint, whatever the process the container runs. A running container
+// is paused while its changes are captured.
+func (c *containerdRuntime) CommitContainer(ctx context.Context, containerName, ref string) error {
+	ctx = c.withNamespace(ctx)
+
+	named, err := refdocker.ParseDockerRef(ref)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference: %v", err)
+	}
+	ctx, releaseLease, err := c.withLease(ctx, "commit/"+containerName)
+	if err != nil {
+		return err
+	}
+	defer releaseLease()
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+	info, err := cntr.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get info of container %q: %v", containerName, err)
+	}
+	platform, err := platformFrom(ctx)
+	if err != nil {
+		return err
+	}
+	baseImage, err := c.getImage(ctx, info.Image)
+	if err != nil {
+		return err
+	}
+
+	if task, err := cntr.Task(ctx, nil); err == nil {
+		status, err := task.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get status of container %q: %v", containerName, err)
+		}
+		if status.Status == containerd.Running {
+			if err := task.Pause(ctx); err != nil {
+				return fmt.Errorf("failed to pause container %q: %v", containerName, err)
+			}
+			defer func() { _ = task.Resume(ctx) }()
+		}
+	} else if !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to load task of container %q: %v", containerName, err)
+	}
+
+	layer, err := rootfs.CreateDiff(ctx, info.SnapshotKey,
+		c.client.SnapshotService(info.Snapshotter),
+		c.client.DiffService(),
+		diff.WithMediaType(ocispec.MediaTypeImageLayerGzip),
+		diff.WithReference(fmt.Sprintf("commit-%s-%d", containerName, time.Now().UnixNano())),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create layer of the changes of container %q: %v", containerName, err)
+	}
+	diffID, err := images.GetDiffID(ctx, c.client.ContentStore(), layer)
+	if err != nil {
+		return fmt.Errorf("failed to get diff ID of the layer of container %q: %v", containerName, err)
+	}
+
+	target, err := c.writeCommitImage(ctx, baseImage, platforms.Only(platform), layer, diffID, containerName)
+	if err != nil {
+		return err
+	}
+
+	img := images.Image{Name: named.String(), Target: target}
+	if _, err := c.client.ImageService().Create(ctx, img); err != nil {
+		if !errdefs.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create image %q: %v", img.Name, err)
+		}
+		if _, err := c.client.ImageService().Update(ctx, img, "target"); err != nil {
+			return fmt.Errorf("failed to update image %q: %v", img.Name, err)
+		}
+	}
+	return nil
+}
+
+// writeCommitImage writes to the content store the configuration and manifest of the base image with
+// the layer appended, and returns the descriptor of the manifest. The blobs are labelled with the
+// references to the content they use, so that the garbage collector keeps it.
+func (c *containerdRuntime) writeCommitImage(ctx context.Context, baseImage containerd.Image, platform platforms.MatchComparer, layer ocispec.Descriptor, diffID digest.Digest, containerName string) (ocispec.Descriptor, error) {
+	cs := c.client.ContentStore()
+
+	manifest, err := images.Manifest(ctx, cs, baseImage.Target(), platform)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to get manifest of image %q: %v", baseImage.Name(), err)
+	}
+	configBlob, err := content.ReadBlob(ctx, cs, manifest.Config)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to get config of image %q: %v", baseImage.Name(), err)
+	}
+	var config ocispec.Image
+	if err := json.Unmarshal(configBlob, &config); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to parse config of image %q: %v", baseImage.Name(), err)
+	}
+
+	now := time.Now().UTC()
+	config.Created = &now
+	config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+	config.History = append(config.History, ocispec.History{
+		Created:   &now,
+		CreatedBy: fmt.Sprintf("commit of container %s", containerName),
+	})
+	configDesc, err := writeJSONBlob(ctx, cs, ocispec.MediaTypeImageConfig, config, nil)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to write image config: %v", err)
+	}
+
+	commitManifest := ocispec.Manifest{
+		Versioned: imagespec.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    append(append([]ocispec.Descriptor{}, manifest.Layers...), layer),
+	}
+	labels := map[string]string{"containerd.io/gc.ref.content.config": configDesc.Digest.String()}
+	for i, l := range commitManifest.Layers {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.l.%d", i)] = l.Digest.String()
+	}
+	manifestDesc, err := writeJSONBlob(ctx, cs, ocispec.MediaTypeImageManifest, commitManifest, labels)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to write image manifest: %v", err)
+	}
+	return manifestDesc, nil
+}
+
+// writeJSONBlob writes the JSON encoding of v to the content store with the given labels.
+func writeJSONBlob(ctx context.Context, cs content.Store, mediaType string, v interface{}, labels map[string]string) (ocispec.Descriptor, error) {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(blob),
+		Size:      int64(len(blob)),
+	}
+	if err := content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(blob), desc, content.WithLabels(labels)); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return desc, nil
+}
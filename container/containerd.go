@@ -16,88 +16,790 @@ package container
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
 	//"github.com/containerd/containerd/namespaces"
-	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/pkg/netns"
+	"github.com/containerd/containerd/platforms"
 	refdocker "github.com/containerd/containerd/reference/docker"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
 
 	"sigs.k8s.io/cluster-api/test/infrastructure/container"
 )
 
+// DefaultStateDir is the host directory where the provider keeps container state, such as volumes.
+const DefaultStateDir = "/var/lib/cluster-api-provider-containerd"
+
 type containerdRuntime struct {
 	client    *containerd.Client
 	namespace string
+	stateDir  string
+
+	// registryConfigPath is the directory holding the registry hosts configuration.
+	registryConfigPath string
+	// lazyPull enables lazy pulling of eStargz images.
+	lazyPull bool
+	// maxConcurrentDownloads limits the layers downloaded concurrently for each pull.
+	maxConcurrentDownloads int
+	// unpackLimiter limits the images pulled and unpacked concurrently, nil for no limit.
+	unpackLimiter *semaphore.Weighted
+	// cni attaches containers to CNI networks, nil to leave them in an unconnected namespace.
+	cni *cniNetwork
+	// ports allocates the host ports of port mappings that do not set one.
+	ports *portAllocator
+	// execPrivileges are the privileges of execs when the context does not set them.
+	execPrivileges ExecPrivileges
+	// execTimeout is how long execs can run when their context has no deadline, zero for no timeout.
+	execTimeout time.Duration
+	// events keeps the recent events of the containers.
+	events *eventRecorder
+	// logDriver is the logging binary the shims write the task output with, empty to write it as is.
+	logDriver string
+	// logConfig is the log configuration of the containers when the context does not set one.
+	logConfig LogConfig
+	// killGracePeriod is how long a container has to exit after a stop signal before it is killed.
+	killGracePeriod time.Duration
+	// health keeps the health status of the containers with a health check.
+	health *healthTracker
+	// cgroupMode is the cgroup hierarchy of the host, v1 or v2.
+	cgroupMode CgroupMode
+	// tlsConfig is the TLS configuration used to connect to a remote containerd endpoint.
+	tlsConfig *tls.Config
+	// retry bounds the retries of the calls failing while containerd cannot be reached.
+	retry RetryConfig
+	// tracerProvider provides the tracer of the runtime operations and containerd calls.
+	tracerProvider trace.TracerProvider
+	// metrics measure the runtime operations.
+	metrics *operationMetrics
+	// metricsRegisterer registers the metrics of the runtime operations, nil not to register them.
+	metricsRegisterer prometheus.Registerer
+	// cdiSpecDirs are the directories of the Container Device Interface specs.
+	cdiSpecDirs []string
 }
 
-func NewContainerdClient(socketPath string, namespace string) (container.Runtime, error) {
-	client, err := containerd.New(socketPath)
-	if err != nil {
-		return &containerdRuntime{}, fmt.Errorf("failed to create containerd client")
+// NewContainerdClient returns the runtime of the containerd daemon at the address, the path of its
+// local socket or the tcp://host:port endpoint of a remote daemon.
+func NewContainerdClient(address string, namespace string, opts ...Option) (Runtime, error) {
+	runtime := &containerdRuntime{
+		namespace:       namespace,
+		stateDir:        DefaultStateDir,
+		ports:           newPortAllocator(),
+		execPrivileges:  PrivilegedExec,
+		events:          newEventRecorder(),
+		killGracePeriod: DefaultKillGracePeriod,
+		health:          newHealthTracker(),
+		cgroupMode:      detectCgroupMode(),
+		retry:           DefaultRetryConfig,
+		tracerProvider:  otel.GetTracerProvider(),
+		metrics:         newOperationMetrics(),
+		cdiSpecDirs:     DefaultCDISpecDirs,
+	}
+	for _, opt := range opts {
+		opt(runtime)
+	}
+	if runtime.metricsRegisterer != nil {
+		for _, collector := range runtime.metrics.collectors() {
+			if err := runtime.metricsRegisterer.Register(collector); err != nil {
+				return &containerdRuntime{}, fmt.Errorf("failed to register metrics: %v", err)
+			}
+		}
 	}
 
-	return &containerdRuntime{client: client, namespace: namespace}, nil
-}
-
-func (c *containerdRuntime) SaveContainerImage(ctx context.Context, image, dest string) error {
-	return fmt.Errorf("not implemented")
+	client, err := runtime.dial(address)
+	if err != nil {
+		return &containerdRuntime{}, fmt.Errorf("failed to create containerd client: %v", err)
+	}
+	runtime.client = client
+	return newTracedRuntime(runtime), nil
 }
 
+// PullContainerImageIfNotExists pulls the image for the platform in the context, or the host platform,
+// unless the image content for that platform is already available.
 func (c *containerdRuntime) PullContainerImageIfNotExists(ctx context.Context, image string) error {
-	ctx = namespaces.WithNamespace(ctx, c.namespace)
+	ctx = c.withNamespace(ctx)
+	if err := c.ensureNamespace(ctx); err != nil {
+		return err
+	}
 
 	ref, err := refdocker.ParseDockerRef(image)
 	if err != nil {
 		return fmt.Errorf("failed to parse image reference: %v", err)
 	}
 
-	images, err := c.client.ListImages(ctx, fmt.Sprintf("name==%s", ref.String()))
+	platform, err := platformFrom(ctx)
+	if err != nil {
+		return err
+	}
+	matcher := platforms.Only(platform)
+
+	ctx, releaseLease, err := c.withLease(ctx, "pull/"+ref.String())
+	if err != nil {
+		return err
+	}
+	defer releaseLease()
+
+	imgs, err := c.client.ListImages(ctx, fmt.Sprintf("name==%s", ref.String()))
 	if err != nil {
 		return fmt.Errorf("error listing images: %v", err)
 	}
 
-	// image already exists
-	if len(images) > 0 {
-		return nil
+	// image already exists, make sure it has the content for the platform as it might have
+	// been pulled for another one.
+	if len(imgs) > 0 {
+		img := containerd.NewImageWithPlatform(c.client, imgs[0].Metadata(), matcher)
+		available, _, _, missing, err := images.Check(ctx, c.client.ContentStore(), img.Target(), matcher)
+		if err != nil {
+			return fmt.Errorf("error checking image content: %v", err)
+		}
+		if available && len(missing) == 0 {
+			if err := c.ensureUnpacked(ctx, img); err != nil {
+				return fmt.Errorf("error unpacking image: %v", err)
+			}
+			return nil
+		}
+	}
+
+	// Images built or loaded in the namespace of the runtime are shared with the clusters.
+	if imported, err := c.importRuntimeImage(ctx, ref.String(), matcher); err != nil || imported {
+		return err
 	}
 
-	if _, err := c.client.Pull(ctx, image); err != nil {
-		return fmt.Errorf("error pulling image: %v", err)
+	if err := c.checkPlatform(ctx, ref.String(), platform); err != nil {
+		return err
+	}
+
+	release, err := c.acquireUnpack(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var tracker *pullTracker
+	stopTracker := func() {}
+	wrappers := []func(images.Handler) images.Handler{}
+	if report := pullProgressFrom(ctx); report != nil {
+		tracker = newPullTracker(ref.String(), c.client.ContentStore(), report)
+		wrappers = append(wrappers, tracker.handlerWrapper)
+		stopTracker = tracker.start(ctx)
+		defer stopTracker()
+	}
+
+	pullOpts := append(c.pullOpts(ctx, ref.String(), wrappers...), containerd.WithPlatformMatcher(matcher))
+	start := time.Now()
+	_, err = c.client.Pull(ctx, ref.String(), pullOpts...)
+	c.metrics.observePull(start, err)
+	if err != nil {
+		return fmt.Errorf("error pulling image for platform %s: %v", platforms.Format(platform), err)
+	}
+
+	if tracker != nil {
+		stopTracker()
+		tracker.done(ctx)
 	}
 
 	return nil
 }
 
+// GetHostPort returns the host port mapped to the container port given as "port/protocol", e.g. "6443/tcp".
 func (c *containerdRuntime) GetHostPort(ctx context.Context, containerName, portAndProtocol string) (string, error) {
-	return "", fmt.Errorf("not implemented")
+	ctx = c.withNamespace(ctx)
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return "", fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+	labels, err := cntr.Labels(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get labels of container %q: %v", containerName, err)
+	}
+
+	mappings, err := portMappingsFromLabels(labels)
+	if err != nil {
+		return "", fmt.Errorf("failed to get port mappings of container %q: %v", containerName, err)
+	}
+	port, err := hostPort(mappings, portAndProtocol)
+	if err != nil {
+		return "", fmt.Errorf("failed to get host port of container %q: %v", containerName, err)
+	}
+	return port, nil
 }
 
+// GetContainerIPs returns the IPv4 and IPv6 address of the container on its CNI network, the first
+// of each family in the CNI result. Single-stack containers return an empty address for the other family.
 func (c *containerdRuntime) GetContainerIPs(ctx context.Context, containerName string) (string, string, error) {
-	return "", "", fmt.Errorf("not implemented")
+	ctx = c.withNamespace(ctx)
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+	labels, err := cntr.Labels(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get labels of container %q: %v", containerName, err)
+	}
+
+	ips, err := containerIPs(labels)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get IPs of container %q: %v", containerName, err)
+	}
+	if len(ips) == 0 {
+		return "", "", fmt.Errorf("container %q is not attached to a network", containerName)
+	}
+
+	ipv4, ipv6 := firstIPs(ips)
+	return ipv4, ipv6, nil
 }
 
-func (c *containerdRuntime) ExecContainer(ctx context.Context, containerName string, config *container.ExecContainerInput, command string, args ...string) error {
-	return fmt.Errorf("not implemented")
+// RunContainer creates a container from the given settings, translating them into an OCI runtime spec,
+// and starts its task. If output is set, the task output is streamed to it and RunContainer waits for the
+// task to exit, returning an error if the exit code is non-zero.
+func (c *containerdRuntime) RunContainer(ctx context.Context, runConfig *container.RunContainerInput, output io.Writer) (rerr error) {
+	ctx = c.withNamespace(ctx)
+	failure := createFailureImage
+	defer func() {
+		if rerr != nil {
+			c.metrics.countCreateFailure(failure)
+		}
+	}()
+
+	// Hold a lease from the pull until the task is running, otherwise the garbage collector may
+	// delete the image content or the snapshot in between when many containers are created at once.
+	ctx, releaseLease, err := c.withLease(ctx, "container/"+runConfig.Name)
+	if err != nil {
+		return err
+	}
+	defer releaseLease()
+
+	// Make sure we have the image
+	if err := c.PullContainerImageIfNotExists(ctx, runConfig.Image); err != nil {
+		return err
+	}
+
+	image, err := c.getImage(ctx, runConfig.Image)
+	if err != nil {
+		return err
+	}
+
+	failure = createFailureConfig
+	runConfig, err = c.publishPorts(runConfig)
+	if err != nil {
+		return err
+	}
+	// The host ports are released if the container fails to be created or started.
+	defer func() {
+		if rerr != nil {
+			c.ports.release(runConfig.PortMappings)
+		}
+	}()
+
+	// The containers of a cluster with a network of its own are attached to it.
+	network, hasNetwork := networkFrom(ctx)
+	if hasNetwork && runConfig.Network != hostNetwork {
+		runConfig.Network = network.Name
+	}
+
+	platform, err := platformFrom(ctx)
+	if err != nil {
+		return err
+	}
+	windows := platform.OS == windowsOS
+
+	override := commandOverrideFrom(ctx)
+	override.apply(runConfig)
+	generateSpecOpts := c.generateSpecOpts
+	if windows {
+		generateSpecOpts = c.generateWindowsSpecOpts
+	}
+	specOpts, err := generateSpecOpts(runConfig, image)
+	if err != nil {
+		return fmt.Errorf("error generating spec for container %q: %v", runConfig.Name, err)
+	}
+	if isolation := isolationProfileFrom(ctx); !windows {
+		// The privileges are set first, the other options add to them.
+		isolationOpts, err := isolation.specOpts()
+		if err != nil {
+			return fmt.Errorf("invalid isolation profile for container %q: %v", runConfig.Name, err)
+		}
+		specOpts = append(isolationOpts, specOpts...)
+	} else if !isolation.privileged() {
+		return fmt.Errorf("invalid isolation profile for container %q: isolation profiles are not supported by Windows containers", runConfig.Name)
+	}
+	if len(override.ExtraArgs) > 0 {
+		specOpts = append(specOpts, withExtraArgs(override.ExtraArgs))
+	}
+	runtime, err := runtimeFrom(ctx)
+	if err != nil {
+		return fmt.Errorf("invalid runtime handler for container %q: %v", runConfig.Name, err)
+	}
+	if runtime == "" && windows {
+		runtime = windowsRuntime
+	}
+	limits := resourceLimitsFrom(ctx)
+	if err := limits.validate(); err != nil {
+		return fmt.Errorf("invalid resource limits for container %q: %v", runConfig.Name, err)
+	}
+	if windows {
+		specOpts = append(specOpts, limits.windowsResourceOpts()...)
+	} else {
+		specOpts = append(specOpts, limits.specOpts()...)
+	}
+	if devices := devicesFrom(ctx); len(devices) > 0 {
+		if windows {
+			return fmt.Errorf("invalid devices for container %q: device mappings are not supported by Windows containers", runConfig.Name)
+		}
+		specOpts = append(specOpts, withDevices(devices))
+	}
+	if cdiDevices := cdiDevicesFrom(ctx); len(cdiDevices) > 0 {
+		if windows {
+			return fmt.Errorf("invalid CDI devices for container %q: CDI devices are not supported by Windows containers", runConfig.Name)
+		}
+		specOpts = append(specOpts, withCDIDevices(c.cdiSpecDirs, cdiDevices))
+	}
+	if sysctls := sysctlsFrom(ctx); len(sysctls) > 0 {
+		if windows {
+			return fmt.Errorf("invalid sysctls for container %q: sysctls are not supported by Windows containers", runConfig.Name)
+		}
+		if err := validateSysctls(sysctls, runConfig.Network == hostNetwork); err != nil {
+			return fmt.Errorf("invalid sysctls for container %q: %v", runConfig.Name, err)
+		}
+		specOpts = append(specOpts, withSysctls(sysctls))
+	}
+	if propagations := mountPropagationsFrom(ctx); len(propagations) > 0 {
+		if windows {
+			return fmt.Errorf("invalid mount propagations for container %q: mount propagations are not supported by Windows containers", runConfig.Name)
+		}
+		if err := validateMountPropagations(propagations); err != nil {
+			return fmt.Errorf("invalid mount propagations for container %q: %v", runConfig.Name, err)
+		}
+		specOpts = append(specOpts, withMountPropagations(propagations))
+	}
+	if ulimits := ulimitsFrom(ctx); len(ulimits) > 0 {
+		if windows {
+			return fmt.Errorf("invalid ulimits for container %q: ulimits are not supported by Windows containers", runConfig.Name)
+		}
+		specOpts = append(specOpts, withUlimits(ulimits))
+	}
+	if hooks := hooksFrom(ctx); !hooks.empty() {
+		if windows {
+			return fmt.Errorf("invalid hooks for container %q: OCI hooks are not supported by Windows containers", runConfig.Name)
+		}
+		if err := hooks.validate(); err != nil {
+			return fmt.Errorf("invalid hooks for container %q: %v", runConfig.Name, err)
+		}
+		specOpts = append(specOpts, withHooks(hooks))
+	}
+
+	labels, err := containerLabels(runConfig)
+	if err != nil {
+		return err
+	}
+	labels[logConfigLabel], err = c.logConfigFrom(ctx).label()
+	if err != nil {
+		return err
+	}
+	if check, ok := healthCheckFrom(ctx); ok {
+		labels[healthCheckLabel], err = check.label()
+		if err != nil {
+			return err
+		}
+	}
+	// The containers are stopped with the stop signal of their image, e.g. SIGRTMIN+3 for systemd.
+	if signal, err := containerd.GetOCIStopSignal(ctx, image, "SIGTERM"); err == nil {
+		labels[containerd.StopSignalLabel] = signal
+	}
+
+	// Windows containers are attached to networks by HNS endpoints created on their host, not by CNI
+	// network namespaces. The runtime does not create HNS endpoints, they would have no network.
+	if windows {
+		return fmt.Errorf("invalid platform for container %q: Windows containers are not supported, they cannot be attached to HNS networks", runConfig.Name)
+	}
+
+	var attachment *networkAttachment
+	address := staticAddressFrom(ctx)
+	if !address.empty() {
+		if c.cni == nil || runConfig.Network == hostNetwork {
+			return fmt.Errorf("invalid static address for container %q: static addresses are only supported on CNI networks", runConfig.Name)
+		}
+		if err := address.validate(); err != nil {
+			return fmt.Errorf("invalid static address for container %q: %v", runConfig.Name, err)
+		}
+		labels[staticAddressLabel], err = address.label()
+		if err != nil {
+			return err
+		}
+	}
+	if c.cni != nil && runConfig.Network != hostNetwork {
+		failure = createFailureNetwork
+		if hasNetwork {
+			if err := c.cni.ensureNetwork(network); err != nil {
+				return err
+			}
+		}
+		attachment, err = c.cni.setup(ctx, c.stateDir, runConfig.Name, runConfig.Network, runConfig.PortMappings, address)
+		if err != nil {
+			return err
+		}
+		networkLabels, err := attachment.labels()
+		if err != nil {
+			_ = c.cni.teardown(ctx, runConfig.Name, runConfig.Network, attachment.netnsPath, runConfig.PortMappings)
+			return err
+		}
+		for key, val := range networkLabels {
+			labels[key] = val
+		}
+		specOpts = append(specOpts, withNetNS(attachment.netnsPath)...)
+	}
+
+	containerOpts := []containerd.NewContainerOpts{containerd.WithImage(image)}
+	if runtime != "" {
+		containerOpts = append(containerOpts, containerd.WithRuntime(runtime, nil))
+	}
+	if snapshotter := c.snapshotter(ctx); snapshotter != "" {
+		// The snapshotter must be set before the snapshot is created.
+		containerOpts = append(containerOpts, containerd.WithSnapshotter(snapshotter))
+	}
+	newSpec := containerd.WithNewSpec(specOpts...)
+	if windows {
+		newSpec = withNewSpecForPlatform(platform, specOpts...)
+	}
+	containerOpts = append(containerOpts,
+		containerd.WithNewSnapshot(runConfig.Name, image),
+		newSpec,
+		containerd.WithContainerLabels(labels),
+	)
+
+	failure = createFailureCreate
+	cntr, err := c.client.NewContainer(ctx, runConfig.Name, containerOpts...)
+	if err != nil {
+		if attachment != nil {
+			_ = c.cni.teardown(ctx, runConfig.Name, runConfig.Network, attachment.netnsPath, runConfig.PortMappings)
+		}
+		return fmt.Errorf("error creating container %q: %v", runConfig.Name, err)
+	}
+
+	failure = createFailureStart
+	if err := c.startContainer(ctx, cntr, runConfig, output); err != nil {
+		_ = c.deleteTask(ctx, cntr)
+		_ = cntr.Delete(ctx, containerd.WithSnapshotCleanup)
+		if attachment != nil {
+			_ = c.cni.teardown(ctx, runConfig.Name, runConfig.Network, attachment.netnsPath, runConfig.PortMappings)
+		}
+		return err
+	}
+
+	return nil
 }
 
-func (c *containerdRuntime) RunContainer(ctx context.Context, runConfig *container.RunContainerInput, output io.Writer) error {
-	return fmt.Errorf("not implemented")
+// publishPorts returns a copy of the run configuration with the host ports of its port mappings
+// resolved: containers on the host network use the container ports, the others get a free host
+// port allocated for mappings that do not set one.
+func (c *containerdRuntime) publishPorts(runConfig *container.RunContainerInput) (*container.RunContainerInput, error) {
+	resolved := *runConfig
+	if runConfig.Network == hostNetwork {
+		resolved.PortMappings = make([]container.PortMapping, 0, len(runConfig.PortMappings))
+		for _, pm := range runConfig.PortMappings {
+			pm.HostPort = pm.ContainerPort
+			resolved.PortMappings = append(resolved.PortMappings, pm)
+		}
+		return &resolved, nil
+	}
+
+	mappings, err := c.ports.allocate(runConfig.PortMappings)
+	if err != nil {
+		return nil, fmt.Errorf("error publishing ports of container %q: %v", runConfig.Name, err)
+	}
+	resolved.PortMappings = mappings
+	return &resolved, nil
 }
 
+// startContainer populates the container volumes, then creates and starts its task.
+func (c *containerdRuntime) startContainer(ctx context.Context, cntr containerd.Container, runConfig *container.RunContainerInput, output io.Writer) error {
+	if err := c.populateVolumes(ctx, cntr, c.anonymousVolumes(runConfig)); err != nil {
+		return fmt.Errorf("error populating volumes for container %q: %v", runConfig.Name, err)
+	}
+
+	ioCreator, err := c.taskLog(runConfig.Name, c.logConfigFrom(ctx))
+	if err != nil {
+		return err
+	}
+	if output != nil {
+		ioCreator = cio.NewCreator(cio.WithStreams(nil, output, output))
+	}
+
+	task, err := cntr.NewTask(ctx, ioCreator)
+	if err != nil {
+		return fmt.Errorf("error creating task for container %q: %v", runConfig.Name, err)
+	}
+
+	// Wait must be set up before starting the task so the exit status is not missed.
+	var exitCh <-chan containerd.ExitStatus
+	if output != nil {
+		exitCh, err = task.Wait(ctx)
+		if err != nil {
+			return fmt.Errorf("error waiting for container run: %v", err)
+		}
+	}
+
+	if err := task.Start(ctx); err != nil {
+		return fmt.Errorf("error starting container %q: %v", runConfig.Name, err)
+	}
+
+	if output == nil {
+		return nil
+	}
+
+	select {
+	case status := <-exitCh:
+		code, _, err := status.Result()
+		if err != nil {
+			return fmt.Errorf("error waiting for container run: %v", err)
+		}
+		if code != 0 {
+			return fmt.Errorf("error container run failed with exit code %d", code)
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// deleteTask stops and deletes the task of the container, if any. A running task is stopped gracefully
+// with the stop signal of the image of the container, like a killed container, and is not restarted
+// by the restart monitor meanwhile.
+func (c *containerdRuntime) deleteTask(ctx context.Context, cntr containerd.Container) error {
+	task, err := cntr.Task(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if status, err := task.Status(ctx); err == nil {
+		// The processes of a paused task cannot handle the stop signal until they are thawed.
+		if status.Status == containerd.Paused || status.Status == containerd.Pausing {
+			if err := task.Resume(ctx); err != nil && !errdefs.IsNotFound(err) {
+				return err
+			}
+			status.Status = containerd.Running
+		}
+		if status.Status == containerd.Running {
+			labels, err := cntr.SetLabels(ctx, map[string]string{stoppedLabel: "true"})
+			if err != nil {
+				return err
+			}
+			if err := c.stopTask(ctx, cntr.ID(), task, stopSignal(labels)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = task.Delete(ctx, containerd.WithProcessKill)
+	return err
+}
+
+// getImage returns the image matching the given reference from the image store, for the platform
+// in the context.
+func (c *containerdRuntime) getImage(ctx context.Context, image string) (containerd.Image, error) {
+	ref, err := refdocker.ParseDockerRef(image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference: %v", err)
+	}
+
+	platform, err := platformFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := c.client.ImageService().Get(ctx, ref.String())
+	if err != nil {
+		return nil, fmt.Errorf("error getting image %q: %v", ref.String(), err)
+	}
+	return containerd.NewImageWithPlatform(c.client, img, platforms.Only(platform)), nil
+}
+
+// ListContainers returns a list of all containers matching the filters.
 func (c *containerdRuntime) ListContainers(ctx context.Context, filters container.FilterBuilder) ([]container.Container, error) {
-	return nil, fmt.Errorf("not implemented")
+	ctx = c.withNamespace(ctx)
+
+	filter, err := translateFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	cntrs, err := c.client.Containers(ctx, filter.containerdFilters()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	containers := []container.Container{}
+	for _, cntr := range cntrs {
+		info, err := cntr.Info(ctx, containerd.WithoutRefreshedMetadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get info for container %q: %v", cntr.ID(), err)
+		}
+
+		status, err := containerStatus(ctx, cntr)
+		if err != nil {
+			return nil, err
+		}
+
+		if !filter.matchesStatus(status) {
+			continue
+		}
+
+		containers = append(containers, container.Container{
+			Name:   info.ID,
+			Image:  info.Image,
+			Status: dockerStatus(status),
+		})
+	}
+
+	return containers, nil
+}
+
+// InspectContainer returns the details of the given container.
+func (c *containerdRuntime) InspectContainer(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	ctx = c.withNamespace(ctx)
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+
+	info, err := cntr.Info(ctx, containerd.WithoutRefreshedMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info for container %q: %v", containerName, err)
+	}
+
+	status, err := containerStatus(ctx, cntr)
+	if err != nil {
+		return nil, err
+	}
+
+	restartCount, _ := strconv.Atoi(info.Labels[restartCountLabel])
+	containerInfo := &ContainerInfo{
+		Name:         info.ID,
+		Image:        info.Image,
+		Labels:       info.Labels,
+		Status:       dockerStatus(status),
+		State:        string(status.Status),
+		Paused:       status.Status == containerd.Paused || status.Status == containerd.Pausing,
+		RestartCount: restartCount,
+		CreatedAt:    info.CreatedAt,
+	}
+	if _, ok := info.Labels[healthCheckLabel]; ok {
+		health := c.health.status(info.ID)
+		containerInfo.Health = &health
+	}
+	return containerInfo, nil
 }
 
-func (c *containerdRuntime) ContainerDebugInfo(ctx context.Context, containerName string, w io.Writer) error {
-	return fmt.Errorf("not implemented")
+// containerStatus returns the status of the container task. Containers without a task, or whose
+// task has already exited and been cleaned up, are reported as created and stopped respectively.
+func containerStatus(ctx context.Context, cntr containerd.Container) (containerd.Status, error) {
+	task, err := cntr.Task(ctx, nil)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return containerd.Status{Status: containerd.Created}, nil
+		}
+		return containerd.Status{}, fmt.Errorf("failed to get task for container %q: %v", cntr.ID(), err)
+	}
+
+	status, err := task.Status(ctx)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return containerd.Status{Status: containerd.Stopped}, nil
+		}
+		return containerd.Status{}, fmt.Errorf("failed to get task status for container %q: %v", cntr.ID(), err)
+	}
+	return status, nil
 }
 
+// DeleteContainer stops the task of the container and deletes the container, its network attachment
+// and port mappings, its snapshot, leases, volumes and logs. Each step tolerates the resources it
+// deletes being already gone, so that deleting a container that was partially deleted, or partially
+// created, cleans up what is left. Deleting a container that does not exist is not an error.
 func (c *containerdRuntime) DeleteContainer(ctx context.Context, containerName string) error {
-	return fmt.Errorf("not implemented")
+	ctx = c.withNamespace(ctx)
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	switch {
+	case errdefs.IsNotFound(err):
+		// The snapshot is created before the container record, it is left behind if the record
+		// could not be created.
+		snapshotter := c.snapshotter(ctx)
+		if snapshotter == "" {
+			snapshotter = containerd.DefaultSnapshotter
+		}
+		if err := c.client.SnapshotService(snapshotter).Remove(ctx, containerName); err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to delete snapshot of container %q: %v", containerName, err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to load container %q: %v", containerName, err)
+	default:
+		if err := c.deleteContainer(ctx, cntr); err != nil {
+			return err
+		}
+	}
+
+	// The container state kept outside of containerd is only deleted once the container record is,
+	// it is needed to retry the deletion otherwise.
+	if err := c.releaseLeases(ctx, "container/"+containerName); err != nil {
+		return fmt.Errorf("failed to release leases of container %q: %v", containerName, err)
+	}
+	if err := os.RemoveAll(c.volumesDir(containerName)); err != nil {
+		return fmt.Errorf("failed to delete volumes of container %q: %v", containerName, err)
+	}
+	if err := c.removeLogs(containerName); err != nil {
+		return fmt.Errorf("failed to delete logs of container %q: %v", containerName, err)
+	}
+	c.events.forget(containerName)
+
+	return nil
 }
 
-func (c *containerdRuntime) KillContainer(ctx context.Context, containerName, signal string) error {
-	return fmt.Errorf("not implemented")
+// deleteContainer stops the task of the container, tears down its network attachment, releases its
+// host ports and deletes the container record and its snapshot. The record is deleted last, as the
+// network attachment is only known from its labels.
+func (c *containerdRuntime) deleteContainer(ctx context.Context, cntr containerd.Container) error {
+	if err := c.deleteTask(ctx, cntr); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to delete task of container %q: %v", cntr.ID(), err)
+	}
+
+	labels, err := cntr.Labels(ctx)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get labels of container %q: %v", cntr.ID(), err)
+	}
+	ports, err := portMappingsFromLabels(labels)
+	if err != nil {
+		return fmt.Errorf("failed to get port mappings of container %q: %v", cntr.ID(), err)
+	}
+	if netnsPath := labels[netnsLabel]; netnsPath != "" {
+		if c.cni != nil {
+			if err := c.cni.teardown(ctx, cntr.ID(), labels[networkLabel], netnsPath, ports); err != nil {
+				return err
+			}
+		} else if err := netns.LoadNetNS(netnsPath).Remove(); err != nil {
+			// CNI was disabled since the container was created, its network namespace can only be removed.
+			return fmt.Errorf("failed to remove network namespace %q: %v", netnsPath, err)
+		}
+	}
+	c.ports.release(ports)
+
+	if err := cntr.Delete(ctx, containerd.WithSnapshotCleanup); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to delete container %q: %v", cntr.ID(), err)
+	}
+	return nil
 }
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+// copyExecIDPrefix prefixes the IDs of the tar execs copying files, so that their events can be told
+// apart from the ones of the bootstrap commands.
+const copyExecIDPrefix = "copy"
+
+// CopyTo extracts the tar archive read from content into the directory destDir of the running
+// container, like docker cp, e.g. to place bootstrap data, certificates or kubeconfigs as files.
+// The archive is extracted by the tar command of the container, so the files are owned by the user
+// of the container processes, and destDir must exist.
+func (c *containerdRuntime) CopyTo(ctx context.Context, containerName, destDir string, content io.Reader) error {
+	stderr := &bytes.Buffer{}
+	config := &container.ExecContainerInput{InputBuffer: content, ErrorBuffer: stderr}
+	if err := c.ExecContainer(execIDPrefixInto(ctx, copyExecIDPrefix), containerName, config, "tar", "-x", "-f", "-", "-C", destDir); err != nil {
+		return fmt.Errorf("failed to copy to %q in container %q: %v: %s", destDir, containerName, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// CopyFrom writes to w a tar archive of the file or directory at srcPath in the running container,
+// its entries named after the base name of srcPath, like docker cp, e.g. to collect logs or
+// artifacts.
+func (c *containerdRuntime) CopyFrom(ctx context.Context, containerName, srcPath string, w io.Writer) error {
+	stderr := &bytes.Buffer{}
+	config := &container.ExecContainerInput{OutputBuffer: w, ErrorBuffer: stderr}
+	srcPath = path.Clean(srcPath)
+	if err := c.ExecContainer(execIDPrefixInto(ctx, copyExecIDPrefix), containerName, config, "tar", "-c", "-f", "-", "-C", path.Dir(srcPath), path.Base(srcPath)); err != nil {
+		return fmt.Errorf("failed to copy %q from container %q: %v: %s", srcPath, containerName, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// WriteFile writes the file at the absolute path filePath of the running container with the given
+// content and mode, creating its missing parent directories.
+func WriteFile(ctx context.Context, runtime Runtime, containerName, filePath string, content []byte, mode os.FileMode) error {
+	archive, err := fileArchive(strings.TrimPrefix(path.Clean(filePath), "/"), content, mode)
+	if err != nil {
+		return err
+	}
+	return runtime.CopyTo(ctx, containerName, "/", archive)
+}
+
+// ReadFile returns the content of the regular file at filePath in the running container.
+func ReadFile(ctx context.Context, runtime Runtime, containerName, filePath string) ([]byte, error) {
+	archive := &bytes.Buffer{}
+	if err := runtime.CopyFrom(ctx, containerName, filePath, archive); err != nil {
+		return nil, err
+	}
+	return readFileArchive(archive)
+}
+
+// fileArchive returns a tar archive holding a single file.
+func fileArchive(name string, content []byte, mode os.FileMode) (io.Reader, error) {
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(content)),
+		ModTime:  time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return nil, fmt.Errorf("failed to write archive of %q: %v", name, err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return nil, fmt.Errorf("failed to write archive of %q: %v", name, err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive of %q: %v", name, err)
+	}
+	return archive, nil
+}
+
+// readFileArchive returns the content of the first regular file of a tar archive.
+func readFileArchive(r io.Reader) ([]byte, error) {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no regular file in archive")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q from archive: %v", header.Name, err)
+		}
+		return content, nil
+	}
+}
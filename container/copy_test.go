@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFileArchive(t *testing.T) {
+	g := NewWithT(t)
+
+	archive, err := fileArchive("etc/kubernetes/pki/ca.key", []byte("key"), 0o600)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	tr := tar.NewReader(archive)
+	header, err := tr.Next()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(header.Name).To(Equal("etc/kubernetes/pki/ca.key"))
+	g.Expect(header.Mode).To(Equal(int64(0o600)))
+	g.Expect(header.Size).To(Equal(int64(3)))
+}
+
+func TestReadFileArchive(t *testing.T) {
+	g := NewWithT(t)
+
+	// The archive of a file copied from a container may start with directories.
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	g.Expect(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "kubernetes/", Mode: 0o755})).To(Succeed())
+	g.Expect(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "kubernetes/admin.conf", Mode: 0o600, Size: 10})).To(Succeed())
+	_, err := tw.Write([]byte("kubeconfig"))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(tw.Close()).To(Succeed())
+
+	content, err := readFileArchive(archive)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(content)).To(Equal("kubeconfig"))
+
+	empty := &bytes.Buffer{}
+	g.Expect(tar.NewWriter(empty).Close()).To(Succeed())
+	_, err = readFileArchive(empty)
+	g.Expect(err).To(MatchError(ContainSubstring("no regular file")))
+}
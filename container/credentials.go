@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// dockerHubHost is the host the containerd resolver uses for docker.io images.
+const dockerHubHost = "registry-1.docker.io"
+
+// dockerHubServer is the server of the docker.io credentials in docker config files.
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// credentialsKey is the key type for accessing registry credentials in passed contexts.
+type credentialsKey struct{}
+
+// AuthConfig contains the credentials used to authenticate against a registry.
+type AuthConfig struct {
+	// Username is the user name to authenticate with.
+	Username string
+	// Password is the password to authenticate with.
+	Password string
+	// IdentityToken is a token used to get an access token from the registry, if set it
+	// takes precedence over the username and password.
+	IdentityToken string
+}
+
+// RegistryCredentials maps registry hosts to the credentials used to authenticate against them.
+type RegistryCredentials map[string]AuthConfig
+
+// dockerConfigJSON is the format of the .dockerconfigjson key of kubernetes.io/dockerconfigjson secrets.
+type dockerConfigJSON struct {
+	Auths map[string]dockerAuthConfig `json:"auths"`
+}
+
+type dockerAuthConfig struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// ParseDockerConfigJSON parses registry credentials from the content of a docker config.json file.
+func ParseDockerConfigJSON(data []byte) (RegistryCredentials, error) {
+	config := dockerConfigJSON{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse docker config: %v", err)
+	}
+
+	creds := RegistryCredentials{}
+	for server, auth := range config.Auths {
+		authConfig := AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			IdentityToken: auth.IdentityToken,
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode auth for registry %q: %v", server, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid auth for registry %q: expected user:password", server)
+			}
+			authConfig.Username = parts[0]
+			authConfig.Password = parts[1]
+		}
+		creds[registryHost(server)] = authConfig
+	}
+
+	return creds, nil
+}
+
+// DockerConfigJSON returns the content of a docker config.json file holding the registry credentials,
+// as read e.g. by the kubelet from /var/lib/kubelet/config.json.
+func (r RegistryCredentials) DockerConfigJSON() ([]byte, error) {
+	config := dockerConfigJSON{Auths: map[string]dockerAuthConfig{}}
+	for host, auth := range r {
+		server := host
+		if host == dockerHubHost {
+			server = dockerHubServer
+		}
+		entry := dockerAuthConfig{IdentityToken: auth.IdentityToken}
+		if auth.Username != "" || auth.Password != "" {
+			entry.Auth = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		}
+		config.Auths[server] = entry
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal docker config: %v", err)
+	}
+	return data, nil
+}
+
+// RegistryCredentialsInto is used to store the registry credentials used for image pulls into a context.
+func RegistryCredentialsInto(ctx context.Context, creds RegistryCredentials) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, creds)
+}
+
+// registryCredentialsFrom returns the registry credentials stored in the context, if any.
+func registryCredentialsFrom(ctx context.Context) RegistryCredentials {
+	if creds, ok := ctx.Value(credentialsKey{}).(RegistryCredentials); ok {
+		return creds
+	}
+	return nil
+}
+
+// lookup returns the username and secret for the given host, as expected by the containerd authorizer.
+func (r RegistryCredentials) lookup(host string) (string, string, error) {
+	auth, ok := r[registryHost(host)]
+	if !ok {
+		return "", "", nil
+	}
+	if auth.IdentityToken != "" {
+		return "", auth.IdentityToken, nil
+	}
+	return auth.Username, auth.Password, nil
+}
+
+// registryHost normalizes a docker config server entry, which may be a URL, to a registry host.
+func registryHost(server string) string {
+	host := server
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Host
+		}
+	}
+	host = strings.SplitN(host, "/", 2)[0]
+
+	switch host {
+	case "docker.io", "index.docker.io":
+		return dockerHubHost
+	}
+	return host
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseDockerConfigJSON(t *testing.T) {
+	g := NewWithT(t)
+
+	// "dXNlcjpwYXNz" is base64 for "user:pass".
+	creds, err := ParseDockerConfigJSON([]byte(`{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNz"},
+			"registry.example.com:5000": {"username": "admin", "password": "secret"},
+			"gcr.io": {"identitytoken": "token"}
+		}
+	}`))
+
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(creds).To(Equal(RegistryCredentials{
+		"registry-1.docker.io":      {Username: "user", Password: "pass"},
+		"registry.example.com:5000": {Username: "admin", Password: "secret"},
+		"gcr.io":                    {IdentityToken: "token"},
+	}))
+
+	user, secret, err := creds.lookup("gcr.io")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(user).To(BeEmpty())
+	g.Expect(secret).To(Equal("token"))
+
+	user, secret, err = creds.lookup("quay.io")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(user).To(BeEmpty())
+	g.Expect(secret).To(BeEmpty())
+}
+
+func TestParseDockerConfigJSONInvalidAuth(t *testing.T) {
+	g := NewWithT(t)
+
+	// "bm9jb2xvbg==" is base64 for "nocolon".
+	_, err := ParseDockerConfigJSON([]byte(`{"auths": {"docker.io": {"auth": "bm9jb2xvbg=="}}}`))
+
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func TestDockerConfigJSON(t *testing.T) {
+	g := NewWithT(t)
+
+	creds := RegistryCredentials{
+		"registry-1.docker.io":      {Username: "user", Password: "pass"},
+		"registry.example.com:5000": {Username: "admin", Password: "secret"},
+		"gcr.io":                    {IdentityToken: "token"},
+	}
+
+	data, err := creds.DockerConfigJSON()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(data)).To(ContainSubstring(`"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"}`))
+
+	parsed, err := ParseDockerConfigJSON(data)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(parsed).To(Equal(creds))
+}
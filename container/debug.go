@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// debugLogLines is the number of task output lines in the container debug info.
+const debugLogLines = 50
+
+// ContainerDebugInfo writes the details of a container useful to debug it to w: its status and exit
+// code, addresses and published ports, health, recent events, OCI spec and the end of its task output.
+// Details that cannot be retrieved are reported in place, so that as much as possible is written.
+func (c *containerdRuntime) ContainerDebugInfo(ctx context.Context, containerName string, w io.Writer) error {
+	ctx = c.withNamespace(ctx)
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+	info, err := cntr.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get info of container %q: %v", containerName, err)
+	}
+
+	fmt.Fprintf(w, "Container: %s\n", containerName)
+	fmt.Fprintf(w, "Image: %s\n", info.Image)
+	fmt.Fprintf(w, "Created: %s\n", info.CreatedAt)
+	fmt.Fprintf(w, "Runtime: %s\n", info.Runtime.Name)
+	fmt.Fprintf(w, "Snapshotter: %s\n", info.Snapshotter)
+
+	if status, err := containerStatus(ctx, cntr); err != nil {
+		fmt.Fprintf(w, "Status: unknown (%v)\n", err)
+	} else {
+		fmt.Fprintf(w, "Status: %s\n", dockerStatus(status))
+		if !status.ExitTime.IsZero() {
+			fmt.Fprintf(w, "Exit code: %d at %s\n", status.ExitStatus, status.ExitTime)
+		}
+	}
+
+	fmt.Fprintln(w, "Labels:")
+	keys := make([]string, 0, len(info.Labels))
+	for key := range info.Labels {
+		// The network bookkeeping labels are reported below in a readable form.
+		if key == cniResultLabel || key == portsLabel {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s=%s\n", key, info.Labels[key])
+	}
+
+	if ips, err := containerIPs(info.Labels); err != nil {
+		fmt.Fprintf(w, "IPs: unknown (%v)\n", err)
+	} else {
+		addresses := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			addresses = append(addresses, ip.String())
+		}
+		fmt.Fprintf(w, "IPs: %s\n", strings.Join(addresses, ", "))
+	}
+
+	if ports, err := portMappingsFromLabels(info.Labels); err != nil {
+		fmt.Fprintf(w, "Ports: unknown (%v)\n", err)
+	} else {
+		fmt.Fprintln(w, "Ports:")
+		for _, pm := range ports {
+			fmt.Fprintf(w, "  %d/%s -> %s:%d\n", pm.ContainerPort, protocolOrDefault(pm.Protocol), pm.ListenAddress, pm.HostPort)
+		}
+	}
+
+	if _, ok := info.Labels[healthCheckLabel]; ok {
+		fmt.Fprintf(w, "Health: %s\n", c.health.status(containerName))
+	}
+
+	fmt.Fprintln(w, "Events:")
+	for _, event := range c.events.containerEvents(containerName) {
+		fmt.Fprintf(w, "  %s\n", event)
+	}
+
+	if spec, err := cntr.Spec(ctx); err != nil {
+		fmt.Fprintf(w, "Spec: unknown (%v)\n", err)
+	} else if data, err := json.MarshalIndent(spec, "", "  "); err != nil {
+		fmt.Fprintf(w, "Spec: unknown (%v)\n", err)
+	} else {
+		fmt.Fprintf(w, "Spec:\n%s\n", data)
+	}
+
+	fmt.Fprintf(w, "Logs (last %d lines):\n", debugLogLines)
+	lines, err := c.tailLog(containerName, debugLogLines)
+	if err != nil {
+		fmt.Fprintf(w, "  unavailable (%v)\n", err)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+
+	return nil
+}
+
+// tailLog returns the last n lines of the task output logs of the container.
+func (c *containerdRuntime) tailLog(containerName string, n int) ([]string, error) {
+	entries, current, _, err := c.readLog(containerName, n, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, os.ErrNotExist
+	}
+	current.Close()
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		line := strings.TrimSuffix(entry.Log, "\n")
+		if !entry.Time.IsZero() {
+			line = fmt.Sprintf("%s %s %s", entry.Time.Format(time.RFC3339Nano), entry.Stream, line)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
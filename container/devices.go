@@ -0,0 +1,167 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// defaultDevicePermissions are the cgroup permissions of a device mapping that does not set them.
+const defaultDevicePermissions = "rwm"
+
+// devicesKey is the key type for accessing the device mappings in passed contexts.
+type devicesKey struct{}
+
+// DeviceMapping exposes a device of the host in a container, like docker run --device.
+type DeviceMapping struct {
+	// HostPath is the path of the device on the host, e.g. "/dev/kvm".
+	HostPath string
+	// ContainerPath is the path of the device in the container, HostPath if empty.
+	ContainerPath string
+	// Permissions are the cgroup permissions of the container on the device, a combination of r
+	// (read), w (write) and m (mknod), "rwm" if empty.
+	Permissions string
+}
+
+// DevicesInto is used to store the devices of the host mapped into the containers run with a context.
+func DevicesInto(ctx context.Context, devices []DeviceMapping) context.Context {
+	return context.WithValue(ctx, devicesKey{}, devices)
+}
+
+// devicesFrom returns the device mappings stored in the context, none if not set.
+func devicesFrom(ctx context.Context) []DeviceMapping {
+	if devices, ok := ctx.Value(devicesKey{}).([]DeviceMapping); ok {
+		return devices
+	}
+	return nil
+}
+
+// containerPath returns the path of the device in the container.
+func (d DeviceMapping) containerPath() string {
+	if d.ContainerPath == "" {
+		return d.HostPath
+	}
+	return d.ContainerPath
+}
+
+// permissions returns the cgroup permissions of the container on the device.
+func (d DeviceMapping) permissions() string {
+	if d.Permissions == "" {
+		return defaultDevicePermissions
+	}
+	return d.Permissions
+}
+
+// validate returns an error if the paths of the mapping are not absolute or its permissions are
+// not a combination of r, w and m.
+func (d DeviceMapping) validate() error {
+	if !filepath.IsAbs(d.HostPath) {
+		return fmt.Errorf("device path %q is not absolute", d.HostPath)
+	}
+	if !filepath.IsAbs(d.containerPath()) {
+		return fmt.Errorf("container path %q of device %q is not absolute", d.ContainerPath, d.HostPath)
+	}
+	permissions := d.permissions()
+	for _, p := range permissions {
+		if !strings.ContainsRune(defaultDevicePermissions, p) || strings.Count(permissions, string(p)) > 1 {
+			return fmt.Errorf("invalid permissions %q for device %q", d.Permissions, d.HostPath)
+		}
+	}
+	return nil
+}
+
+// withDevices adds the mapped devices to the spec, with the device cgroup rules allowing their use.
+// The mappings replace the devices of the spec at the same container path, e.g. the host devices
+// of a privileged container, so that a device can be exposed at another path or with restricted
+// permissions. A device missing on the host fails the creation of the container, rather than
+// leaving the workload cluster to find it out.
+func withDevices(devices []DeviceMapping) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Linux == nil {
+			s.Linux = &specs.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &specs.LinuxResources{}
+		}
+		for _, mapping := range devices {
+			if err := mapping.validate(); err != nil {
+				return err
+			}
+			device, err := linuxDevice(mapping.HostPath)
+			if err != nil {
+				return err
+			}
+			device.Path = filepath.Clean(mapping.containerPath())
+			addDevice(s, device, mapping.permissions())
+		}
+		return nil
+	}
+}
+
+// addDevice adds the device to the spec, replacing the device at the same path, with a device cgroup
+// rule allowing its use with the permissions.
+func addDevice(s *oci.Spec, device specs.LinuxDevice, permissions string) {
+	linuxDevices := s.Linux.Devices[:0]
+	for _, d := range s.Linux.Devices {
+		if d.Path != device.Path {
+			linuxDevices = append(linuxDevices, d)
+		}
+	}
+	s.Linux.Devices = append(linuxDevices, device)
+	s.Linux.Resources.Devices = append(s.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+		Allow:  true,
+		Type:   device.Type,
+		Major:  &device.Major,
+		Minor:  &device.Minor,
+		Access: permissions,
+	})
+}
+
+// linuxDevice returns the spec device of the character or block device at the host path.
+func linuxDevice(hostPath string) (specs.LinuxDevice, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(hostPath, &stat); err != nil {
+		return specs.LinuxDevice{}, fmt.Errorf("failed to find device %q: %v", hostPath, err)
+	}
+
+	var deviceType string
+	switch stat.Mode & unix.S_IFMT {
+	case unix.S_IFCHR:
+		deviceType = "c"
+	case unix.S_IFBLK:
+		deviceType = "b"
+	default:
+		return specs.LinuxDevice{}, fmt.Errorf("%q is not a device", hostPath)
+	}
+
+	mode := os.FileMode(stat.Mode &^ unix.S_IFMT)
+	return specs.LinuxDevice{
+		Path:     hostPath,
+		Type:     deviceType,
+		Major:    int64(unix.Major(uint64(stat.Rdev))), //nolint:unconvert // Rdev is not a uint64 on all architectures.
+		Minor:    int64(unix.Minor(uint64(stat.Rdev))), //nolint:unconvert // Rdev is not a uint64 on all architectures.
+		FileMode: &mode,
+		UID:      &stat.Uid,
+		GID:      &stat.Gid,
+	}, nil
+}
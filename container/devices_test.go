@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestWithDevices(t *testing.T) {
+	g := NewWithT(t)
+
+	// /dev/null is the character device 1:3.
+	s := &oci.Spec{Linux: &specs.Linux{Devices: []specs.LinuxDevice{{Path: "/dev/fuse", Type: "c", Major: 10, Minor: 229}}}}
+	opt := withDevices([]DeviceMapping{{HostPath: "/dev/null", ContainerPath: "/dev/fuse", Permissions: "rw"}})
+	g.Expect(opt(context.Background(), nil, nil, s)).To(Succeed())
+	g.Expect(s.Linux.Devices).To(HaveLen(1))
+	g.Expect(s.Linux.Devices[0].Path).To(Equal("/dev/fuse"))
+	g.Expect(s.Linux.Devices[0].Type).To(Equal("c"))
+	g.Expect(s.Linux.Devices[0].Major).To(Equal(int64(1)))
+	g.Expect(s.Linux.Devices[0].Minor).To(Equal(int64(3)))
+	g.Expect(s.Linux.Resources.Devices).To(HaveLen(1))
+	g.Expect(s.Linux.Resources.Devices[0].Allow).To(BeTrue())
+	g.Expect(*s.Linux.Resources.Devices[0].Major).To(Equal(int64(1)))
+	g.Expect(*s.Linux.Resources.Devices[0].Minor).To(Equal(int64(3)))
+	g.Expect(s.Linux.Resources.Devices[0].Access).To(Equal("rw"))
+
+	s = &oci.Spec{}
+	g.Expect(withDevices([]DeviceMapping{{HostPath: "/dev/null"}})(context.Background(), nil, nil, s)).To(Succeed())
+	g.Expect(s.Linux.Devices[0].Path).To(Equal("/dev/null"))
+	g.Expect(s.Linux.Resources.Devices[0].Access).To(Equal("rwm"))
+
+	for _, mapping := range []DeviceMapping{
+		{HostPath: "/dev/capc-missing"},
+		{HostPath: "/dev"},
+		{HostPath: "dev/null"},
+		{HostPath: "/dev/null", ContainerPath: "null"},
+		{HostPath: "/dev/null", Permissions: "rx"},
+		{HostPath: "/dev/null", Permissions: "rr"},
+	} {
+		g.Expect(withDevices([]DeviceMapping{mapping})(context.Background(), nil, nil, &oci.Spec{})).ToNot(Succeed(), mapping.HostPath)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/defaults"
+	"github.com/containerd/containerd/pkg/dialer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+const (
+	// DefaultAddress is the address of the local containerd daemon.
+	DefaultAddress = "/var/run/containerd/containerd.sock"
+
+	// unixScheme prefixes the addresses of local containerd sockets, which can also be plain paths.
+	unixScheme = "unix://"
+	// tcpScheme prefixes the addresses of remote containerd daemons, served over TLS.
+	tcpScheme = "tcp://"
+	// npipeScheme prefixes the named pipes of containerd daemons on Windows hosts, the provider is
+	// built for Linux hosts and cannot connect to them.
+	npipeScheme = "npipe://"
+)
+
+// WithTLSConfig sets the TLS configuration used to connect to a remote containerd endpoint, which
+// must present a certificate trusted by it and verify the client certificate.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *containerdRuntime) {
+		c.tlsConfig = config
+	}
+}
+
+// LoadTLSConfig returns the mutual TLS configuration of a remote containerd endpoint: the server
+// certificate is verified against the CA certificates in caFile, or the system roots if empty, and
+// the client authenticates with the certificate and key in certFile and keyFile.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("a client certificate and key are required")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no CA certificate found in %q", caFile)
+		}
+	}
+	return config, nil
+}
+
+// IsRemoteAddress returns whether the containerd address is the tcp://host:port endpoint of a
+// remote daemon, rather than a local socket. The containers of a remote daemon run on another
+// host, so the features relying on the local filesystem do not apply to them: CNI networking,
+// which creates their network namespaces, the log driver, which the shims run from its local path,
+// and the container logs, which the shims write on the remote host.
+func IsRemoteAddress(address string) bool {
+	return strings.HasPrefix(address, tcpScheme)
+}
+
+// dial connects to the containerd daemon at the address: a unix socket path, with or without the
+// unix:// scheme, or the tcp://host:port endpoint of a remote daemon, which requires TLS.
+func (c *containerdRuntime) dial(address string) (*containerd.Client, error) {
+	backoffConfig := backoff.DefaultConfig
+	backoffConfig.MaxDelay = 3 * time.Second
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoffConfig}),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(defaults.DefaultMaxRecvMsgSize),
+			grpc.MaxCallSendMsgSize(defaults.DefaultMaxSendMsgSize),
+		),
+	}
+	// The calls are traced once, however many times they are retried.
+	opts = append(opts, c.tracingDialOptions()...)
+	opts = append(opts, grpc.WithChainUnaryInterceptor(retryUnaryInterceptor(c.retry)))
+
+	if strings.HasPrefix(address, npipeScheme) || strings.HasPrefix(address, `\\.\pipe\`) {
+		return nil, fmt.Errorf("invalid containerd address %q: named pipes are not supported", address)
+	}
+	if !IsRemoteAddress(address) {
+		opts = append(opts,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(dialer.ContextDialer),
+		)
+		return containerd.New(strings.TrimPrefix(address, unixScheme), containerd.WithDialOpts(opts))
+	}
+
+	hostPort := strings.TrimPrefix(address, tcpScheme)
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		return nil, fmt.Errorf("invalid containerd address %q: %v", address, err)
+	}
+	if c.tlsConfig == nil {
+		return nil, fmt.Errorf("a TLS configuration is required to connect to %q", address)
+	}
+	// The containerd client dials its address as a unix socket, resolve it to the TCP address
+	// instead, and verify the daemon certificate against the host name rather than localhost unless
+	// the TLS configuration sets the server name.
+	tcpResolver := manual.NewBuilderWithScheme("unix")
+	tcpResolver.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: hostPort}}})
+	opts = append(opts,
+		grpc.WithTransportCredentials(credentials.NewTLS(c.tlsConfig)),
+		grpc.WithResolvers(tcpResolver),
+	)
+	if c.tlsConfig.ServerName == "" {
+		opts = append(opts, grpc.WithAuthority(hostPort))
+	}
+	return containerd.New(hostPort, containerd.WithDialOpts(opts))
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestIsRemoteAddress(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(IsRemoteAddress(DefaultAddress)).To(BeFalse())
+	g.Expect(IsRemoteAddress("unix:///run/containerd/containerd.sock")).To(BeFalse())
+	g.Expect(IsRemoteAddress("tcp://10.0.0.2:2376")).To(BeTrue())
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(g, dir)
+
+	config, err := LoadTLSConfig(certFile, certFile, keyFile)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(config.Certificates).To(HaveLen(1))
+	g.Expect(config.RootCAs).ToNot(BeNil())
+
+	config, err = LoadTLSConfig("", certFile, keyFile)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(config.RootCAs).To(BeNil())
+
+	_, err = LoadTLSConfig(certFile, "", "")
+	g.Expect(err).To(HaveOccurred())
+	_, err = LoadTLSConfig(keyFile, certFile, keyFile)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestDialRemoteAddress(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &containerdRuntime{}
+	_, err := c.dial("tcp://10.0.0.2:2376")
+	g.Expect(err).To(MatchError(ContainSubstring("TLS configuration is required")))
+	_, err = c.dial("tcp://10.0.0.2")
+	g.Expect(err).To(MatchError(ContainSubstring("invalid containerd address")))
+}
+
+func TestDialNamedPipe(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &containerdRuntime{}
+	_, err := c.dial("npipe:////./pipe/containerd-containerd")
+	g.Expect(err).To(MatchError(ContainSubstring("named pipes are not supported")))
+	_, err = c.dial(`\\.\pipe\containerd-containerd`)
+	g.Expect(err).To(MatchError(ContainSubstring("named pipes are not supported")))
+}
+
+func TestDialTLSEndpoint(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(g, dir)
+	config, err := LoadTLSConfig(certFile, certFile, keyFile)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// The daemon requires the client certificate, signed by itself.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: config.Certificates,
+		ClientCAs:    config.RootCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	c := &containerdRuntime{tlsConfig: config, retry: DefaultRetryConfig}
+	c.client, err = c.dial(tcpScheme + listener.Addr().String())
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer c.client.Close()
+	g.Expect(c.CheckConnection(context.Background())).To(Succeed())
+}
+
+// writeTestCertificate writes a self-signed certificate and its key to dir.
+func writeTestCertificate(g *WithT, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "capc"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	g.Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+	g.Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)).To(Succeed())
+	return certFile, keyFile
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	apievents "github.com/containerd/containerd/api/events"
+	"github.com/containerd/containerd/events"
+	"github.com/containerd/typeurl"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// maxRecordedEvents is the number of events kept for each container.
+	maxRecordedEvents = 20
+	// resubscribeDelay is how long to wait before subscribing again when the event stream fails.
+	resubscribeDelay = 5 * time.Second
+	// subscriberBuffer is the number of events buffered for a subscriber, the events published while
+	// its buffer is full are dropped.
+	subscriberBuffer = 128
+)
+
+// ContainerEvent is a containerd event about a container.
+type ContainerEvent struct {
+	// Namespace is the containerd namespace of the container.
+	Namespace string
+	// Container is the name of the container.
+	Container string
+	// ExecID is the ID of the exec process the event is about, empty if it is about the container
+	// or its init process.
+	ExecID string
+	// Timestamp is the time the event was published.
+	Timestamp time.Time
+	// Topic is the topic of the event, e.g. "/tasks/exit".
+	Topic string
+	// Details describes the event, e.g. the exit status of a task exit.
+	Details string
+}
+
+func (e ContainerEvent) String() string {
+	s := fmt.Sprintf("%s %s", e.Timestamp.Format(time.RFC3339), e.Topic)
+	if e.Details != "" {
+		s += " " + e.Details
+	}
+	return s
+}
+
+// eventRecorder keeps the recent events of each container and publishes them to its subscribers.
+type eventRecorder struct {
+	mu          sync.Mutex
+	events      map[string][]ContainerEvent
+	subscribers map[*eventSubscriber]struct{}
+}
+
+// eventSubscriber receives the events with its topics, all of them if it has none.
+type eventSubscriber struct {
+	topics map[string]bool
+	ch     chan ContainerEvent
+}
+
+func newEventRecorder() *eventRecorder {
+	return &eventRecorder{events: map[string][]ContainerEvent{}, subscribers: map[*eventSubscriber]struct{}{}}
+}
+
+// record adds the event of the envelope to the events of its container, if it is about one, and
+// publishes it to the subscribers.
+func (r *eventRecorder) record(envelope *events.Envelope) {
+	containerID, event, ok := containerEvent(envelope)
+	if !ok {
+		return
+	}
+	// The health check probes would push the other events out.
+	if strings.HasPrefix(event.ExecID, healthExecIDPrefix+"-") {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recorded := append(r.events[containerID], event)
+	if len(recorded) > maxRecordedEvents {
+		recorded = recorded[len(recorded)-maxRecordedEvents:]
+	}
+	r.events[containerID] = recorded
+
+	for s := range r.subscribers {
+		if len(s.topics) > 0 && !s.topics[event.Topic] {
+			continue
+		}
+		select {
+		case s.ch <- event:
+		default:
+		}
+	}
+}
+
+// subscribe returns a subscriber receiving the events with the given topics, all of them if none.
+func (r *eventRecorder) subscribe(topics []string) *eventSubscriber {
+	s := &eventSubscriber{topics: map[string]bool{}, ch: make(chan ContainerEvent, subscriberBuffer)}
+	for _, topic := range topics {
+		s.topics[topic] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers[s] = struct{}{}
+	return s
+}
+
+// unsubscribe stops publishing events to the subscriber and closes its channel.
+func (r *eventRecorder) unsubscribe(s *eventSubscriber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.subscribers[s]; ok {
+		delete(r.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// containerEvents returns the recent events of the container, oldest first.
+func (r *eventRecorder) containerEvents(containerID string) []ContainerEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ContainerEvent{}, r.events[containerID]...)
+}
+
+// forget drops the events of a deleted container.
+func (r *eventRecorder) forget(containerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.events, containerID)
+}
+
+// containerEvent returns the container and the description of the event, false if the event is
+// not about a container.
+func containerEvent(envelope *events.Envelope) (string, ContainerEvent, bool) {
+	if envelope.Event == nil {
+		return "", ContainerEvent{}, false
+	}
+	v, err := typeurl.UnmarshalAny(envelope.Event)
+	if err != nil {
+		return "", ContainerEvent{}, false
+	}
+
+	event := ContainerEvent{Namespace: envelope.Namespace, Timestamp: envelope.Timestamp, Topic: envelope.Topic}
+	var containerID string
+	switch e := v.(type) {
+	case *apievents.TaskCreate:
+		containerID = e.ContainerID
+	case *apievents.TaskStart:
+		containerID = e.ContainerID
+		event.Details = fmt.Sprintf("pid %d", e.Pid)
+	case *apievents.TaskExit:
+		containerID = e.ContainerID
+		event.Details = fmt.Sprintf("exit status %d", e.ExitStatus)
+		if e.ID != e.ContainerID {
+			event.ExecID = e.ID
+			event.Details = fmt.Sprintf("exec %s exit status %d", e.ID, e.ExitStatus)
+		}
+	case *apievents.TaskOOM:
+		containerID = e.ContainerID
+	case *apievents.TaskPaused:
+		containerID = e.ContainerID
+	case *apievents.TaskResumed:
+		containerID = e.ContainerID
+	case *apievents.TaskDelete:
+		containerID = e.ContainerID
+		if e.ID == e.ContainerID {
+			event.Details = fmt.Sprintf("exit status %d", e.ExitStatus)
+		} else {
+			event.ExecID = e.ID
+		}
+	case *apievents.ContainerCreate:
+		containerID = e.ID
+		event.Details = "image " + e.Image
+	case *apievents.ContainerUpdate:
+		containerID = e.ID
+	case *apievents.ContainerDelete:
+		containerID = e.ID
+	default:
+		return "", ContainerEvent{}, false
+	}
+	event.Container = containerID
+	return containerID, event, true
+}
+
+// SubscribeContainerEvents returns a channel receiving the events with the given topics, all of them
+// if none, about the containers of the runtime namespaces, as they are recorded by WatchEvents. The
+// channel is closed once the context is done. Events are dropped while the subscriber falls behind,
+// so it must not rely on receiving all of them.
+func (c *containerdRuntime) SubscribeContainerEvents(ctx context.Context, topics ...string) <-chan ContainerEvent {
+	s := c.events.subscribe(topics)
+	go func() {
+		<-ctx.Done()
+		c.events.unsubscribe(s)
+	}()
+	return s.ch
+}
+
+// WatchEvents records the containerd events about the containers of the runtime namespace and of the
+// cluster namespaces, so that the recent ones are part of the container debug info, until the
+// context is cancelled.
+func (c *containerdRuntime) WatchEvents(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	for {
+		eventCh, errCh := c.client.EventService().Subscribe(ctx,
+			fmt.Sprintf("namespace==%s", c.namespace),
+			fmt.Sprintf("namespace~=^%s", regexp.QuoteMeta(c.namespace+".")),
+		)
+	watch:
+		for {
+			select {
+			case envelope := <-eventCh:
+				c.events.record(envelope)
+			case err := <-errCh:
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Error(err, "Containerd event stream failed, subscribing again", "delay", resubscribeDelay)
+				break watch
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		select {
+		case <-time.After(resubscribeDelay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"testing"
+	"time"
+
+	apievents "github.com/containerd/containerd/api/events"
+	"github.com/containerd/containerd/events"
+	"github.com/containerd/typeurl"
+	. "github.com/onsi/gomega"
+)
+
+func envelope(g *WithT, topic string, event interface{}) *events.Envelope {
+	any, err := typeurl.MarshalAny(event)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	return &events.Envelope{Timestamp: time.Unix(0, 0).UTC(), Namespace: "default", Topic: topic, Event: any}
+}
+
+func TestEventRecorder(t *testing.T) {
+	g := NewWithT(t)
+
+	r := newEventRecorder()
+	r.record(envelope(g, "/tasks/exit", &apievents.TaskExit{ContainerID: "node", ID: "node", ExitStatus: 137}))
+	r.record(envelope(g, "/tasks/exit", &apievents.TaskExit{ContainerID: "node", ID: "exec-1", ExitStatus: 1}))
+	r.record(envelope(g, "/tasks/oom", &apievents.TaskOOM{ContainerID: "other"}))
+	r.record(envelope(g, "/images/create", &apievents.ImageCreate{Name: "kindest/node"}))
+
+	g.Expect(r.containerEvents("node")).To(Equal([]ContainerEvent{
+		{Namespace: "default", Container: "node", Timestamp: time.Unix(0, 0).UTC(), Topic: "/tasks/exit", Details: "exit status 137"},
+		{Namespace: "default", Container: "node", ExecID: "exec-1", Timestamp: time.Unix(0, 0).UTC(), Topic: "/tasks/exit", Details: "exec exec-1 exit status 1"},
+	}))
+	g.Expect(r.containerEvents("other")).To(HaveLen(1))
+	g.Expect(r.events).To(HaveLen(2))
+
+	for i := 0; i < 2*maxRecordedEvents; i++ {
+		r.record(envelope(g, "/tasks/oom", &apievents.TaskOOM{ContainerID: "node"}))
+	}
+	g.Expect(r.containerEvents("node")).To(HaveLen(maxRecordedEvents))
+
+	r.forget("node")
+	g.Expect(r.containerEvents("node")).To(BeEmpty())
+}
+
+func TestEventRecorderSubscribe(t *testing.T) {
+	g := NewWithT(t)
+
+	r := newEventRecorder()
+	exits := r.subscribe([]string{"/tasks/exit"})
+	all := r.subscribe(nil)
+
+	r.record(envelope(g, "/tasks/oom", &apievents.TaskOOM{ContainerID: "node"}))
+	r.record(envelope(g, "/tasks/exit", &apievents.TaskExit{ContainerID: "node", ID: "node", ExitStatus: 137}))
+	g.Expect(exits.ch).To(HaveLen(1))
+	g.Expect((<-exits.ch).Topic).To(Equal("/tasks/exit"))
+	g.Expect(all.ch).To(HaveLen(2))
+
+	// Events are dropped rather than blocking the recorder when a subscriber falls behind.
+	for i := 0; i < 2*subscriberBuffer; i++ {
+		r.record(envelope(g, "/tasks/exit", &apievents.TaskExit{ContainerID: "node", ID: "node"}))
+	}
+	g.Expect(exits.ch).To(HaveLen(subscriberBuffer))
+
+	r.unsubscribe(exits)
+	r.unsubscribe(exits)
+	g.Expect(r.subscribers).To(HaveLen(1))
+	for range exits.ch {
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+// execKillTimeout is how long to wait for an exec process to exit after killing it.
+const execKillTimeout = 10 * time.Second
+
+// ErrExecTimeout is wrapped by the error returned when an exec is killed because its context is done,
+// so that callers can tell a hung command from a failed one.
+var ErrExecTimeout = errors.New("exec timed out")
+
+// ExitError is returned when an exec exits with a non-zero code, so that callers can report the
+// code of a failed command.
+type ExitError struct {
+	Command   string
+	Container string
+	Code      uint32
+}
+
+// Error returns the error string.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command %q in container %q exited with code %d", e.Command, e.Container, e.Code)
+}
+
+// ExecContainer executes a command in a running container, streaming the input and output
+// buffers of the configuration to the process. If the context has terminal settings, the command
+// runs with a terminal resized as requested. It returns an ExitError if the command exits with a
+// non-zero code. If the context is done, or the exec timeout of the runtime expires, before the
+// command exits, the command is killed and an error wrapping ErrExecTimeout is returned.
+func (c *containerdRuntime) ExecContainer(ctx context.Context, containerName string, config *container.ExecContainerInput, command string, args ...string) (rerr error) {
+	defer func(start time.Time) { c.metrics.observeExec(start, rerr) }(time.Now())
+	ctx = c.withNamespace(ctx)
+	if _, ok := ctx.Deadline(); !ok && c.execTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.execTimeout)
+		defer cancel()
+	}
+	// The process must be waited for, killed and deleted after the context is done.
+	bgCtx := namespaces.WithNamespace(context.Background(), c.namespaceFrom(ctx))
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+
+	spec, err := cntr.Spec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get spec of container %q: %v", containerName, err)
+	}
+
+	task, err := cntr.Task(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get task of container %q: %v", containerName, err)
+	}
+
+	execID, err := generateExecID(execIDPrefixFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	// The process is only known once it is created, closing its stdin on EOF has to wait for it.
+	processCh := make(chan containerd.Process, 1)
+	var stdin io.Reader
+	if config.InputBuffer != nil {
+		stdin = &stdinCloser{
+			reader: config.InputBuffer,
+			close: func() {
+				if p, ok := <-processCh; ok {
+					_ = p.CloseIO(ctx, containerd.WithStdinCloser)
+				}
+			},
+		}
+	}
+
+	// The output is copied from the process FIFOs, discard the streams without a buffer so that
+	// the process does not block writing them.
+	stdout, stderr := config.OutputBuffer, config.ErrorBuffer
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	pspec := generateExecProcessSpec(spec.Process, c.execPrivilegesFrom(ctx), config, command, args)
+	tty := execTTYFrom(ctx)
+	ioCreator := cio.NewCreator(cio.WithStreams(stdin, stdout, stderr))
+	if tty != nil {
+		tty.apply(pspec)
+		// A terminal has a single output stream.
+		ioCreator = cio.NewCreator(cio.WithStreams(stdin, stdout, nil), cio.WithTerminal)
+	}
+
+	process, err := task.Exec(ctx, execID, pspec, ioCreator)
+	if err != nil {
+		close(processCh)
+		return fmt.Errorf("failed to exec in container %q: %v", containerName, err)
+	}
+	processCh <- process
+	close(processCh)
+	defer process.Delete(bgCtx, containerd.WithProcessKill) //nolint:errcheck // The process has exited, there is nothing to recover.
+
+	// Wait must be set up before starting the process so the exit status is not missed.
+	statusC, err := process.Wait(bgCtx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for exec in container %q: %v", containerName, err)
+	}
+
+	if err := process.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start exec in container %q: %v", containerName, err)
+	}
+
+	if tty != nil {
+		done := make(chan struct{})
+		defer close(done)
+		tty.forwardResizes(ctx, process, done)
+	}
+
+	var status containerd.ExitStatus
+	select {
+	case status = <-statusC:
+	case <-ctx.Done():
+		cmd := strings.Join(append([]string{command}, args...), " ")
+		if err := killProcess(bgCtx, process, statusC); err != nil {
+			return fmt.Errorf("failed to kill command %q in container %q after %v: %v", cmd, containerName, ctx.Err(), err)
+		}
+		return fmt.Errorf("command %q in container %q killed: %w: %v", cmd, containerName, ErrExecTimeout, ctx.Err())
+	}
+	code, _, err := status.Result()
+	if err != nil {
+		return fmt.Errorf("failed to get exit status of exec in container %q: %v", containerName, err)
+	}
+	if code != 0 {
+		return &ExitError{Command: strings.Join(append([]string{command}, args...), " "), Container: containerName, Code: code}
+	}
+
+	return nil
+}
+
+// killProcess kills the process, e.g. an exec, and waits for it to exit.
+func killProcess(ctx context.Context, process containerd.Process, statusC <-chan containerd.ExitStatus) error {
+	if err := process.Kill(ctx, syscall.SIGKILL); err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	select {
+	case <-statusC:
+		return nil
+	case <-time.After(execKillTimeout):
+		return fmt.Errorf("process did not exit %v after SIGKILL", execKillTimeout)
+	}
+}
+
+// generateExecProcessSpec returns the process spec of an exec, based on the process of the container so
+// that the exec runs with the same user and environment as the container init, and its capabilities
+// unless the privileges restrict them.
+func generateExecProcessSpec(base *specs.Process, privileges ExecPrivileges, config *container.ExecContainerInput, command string, args []string) *specs.Process {
+	pspec := &specs.Process{}
+	if base != nil {
+		*pspec = *base
+	}
+
+	pspec.Terminal = false
+	pspec.Args = append([]string{command}, args...)
+	pspec.Env = append(append([]string{}, pspec.Env...), config.EnvironmentVars...)
+	if pspec.Cwd == "" {
+		pspec.Cwd = "/"
+	}
+	privileges.apply(pspec)
+
+	return pspec
+}
+
+// execIDPrefixKey is the key type for accessing the exec ID prefix in passed contexts.
+type execIDPrefixKey struct{}
+
+// execIDPrefixInto is used to set the prefix of the IDs of the execs run with a context, so that
+// their events can be told apart, e.g. the ones of health check probes.
+func execIDPrefixInto(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, execIDPrefixKey{}, prefix)
+}
+
+// execIDPrefixFrom returns the exec ID prefix stored in the context, "exec" if none.
+func execIDPrefixFrom(ctx context.Context) string {
+	if prefix, ok := ctx.Value(execIDPrefixKey{}).(string); ok {
+		return prefix
+	}
+	return "exec"
+}
+
+// generateExecID returns a random ID for an exec process with the given prefix.
+func generateExecID(prefix string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate exec id: %v", err)
+	}
+	return prefix + "-" + hex.EncodeToString(b), nil
+}
+
+// stdinCloser calls close once the reader is drained, or fails, so that the stdin of the process is
+// closed and commands reading it until EOF, like "sh -" running a bootstrap script, complete instead
+// of waiting for input until the exec times out.
+type stdinCloser struct {
+	reader io.Reader
+	close  func()
+	closed bool
+}
+
+func (s *stdinCloser) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	if err != nil && !s.closed {
+		s.closed = true
+		s.close()
+	}
+	return n, err
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd"
+
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+func TestGenerateExecProcessSpec(t *testing.T) {
+	g := NewWithT(t)
+
+	base := &specs.Process{
+		Args: []string{"/sbin/init"},
+		Env:  []string{"PATH=/usr/bin"},
+		User: specs.User{UID: 0, GID: 0},
+	}
+
+	pspec := generateExecProcessSpec(base, PrivilegedExec, &container.ExecContainerInput{EnvironmentVars: []string{"FOO=bar"}}, "crictl", []string{"ps"})
+
+	g.Expect(pspec.Args).To(Equal([]string{"crictl", "ps"}))
+	g.Expect(pspec.Env).To(Equal([]string{"PATH=/usr/bin", "FOO=bar"}))
+	g.Expect(pspec.Cwd).To(Equal("/"))
+	g.Expect(pspec.Terminal).To(BeFalse())
+
+	// The container process is left untouched.
+	g.Expect(base.Args).To(Equal([]string{"/sbin/init"}))
+	g.Expect(base.Env).To(Equal([]string{"PATH=/usr/bin"}))
+}
+
+func TestGenerateExecProcessSpecUnprivileged(t *testing.T) {
+	g := NewWithT(t)
+
+	all := []string{"CAP_CHOWN", "CAP_NET_ADMIN", "CAP_SYS_ADMIN"}
+	base := &specs.Process{
+		Args: []string{"/sbin/init"},
+		Capabilities: &specs.LinuxCapabilities{
+			Bounding:  all,
+			Effective: all,
+			Permitted: all,
+		},
+	}
+
+	pspec := generateExecProcessSpec(base, ExecPrivileges{Capabilities: []string{"CAP_NET_ADMIN", "CAP_SYS_MODULE"}}, &container.ExecContainerInput{}, "ip", []string{"link"})
+
+	g.Expect(pspec.Capabilities.Bounding).To(Equal([]string{"CAP_NET_ADMIN"}))
+	g.Expect(pspec.Capabilities.Effective).To(Equal([]string{"CAP_NET_ADMIN"}))
+	g.Expect(pspec.Capabilities.Permitted).To(Equal([]string{"CAP_NET_ADMIN"}))
+	g.Expect(pspec.Capabilities.Inheritable).To(BeEmpty())
+	g.Expect(pspec.NoNewPrivileges).To(BeTrue())
+
+	// The container process is left untouched.
+	g.Expect(base.Capabilities.Effective).To(Equal(all))
+
+	pspec = generateExecProcessSpec(base, PrivilegedExec, &container.ExecContainerInput{}, "ip", []string{"link"})
+	g.Expect(pspec.Capabilities.Effective).To(Equal(all))
+	g.Expect(pspec.NoNewPrivileges).To(BeFalse())
+}
+
+func TestParseExecCapabilities(t *testing.T) {
+	g := NewWithT(t)
+
+	privileges, err := ParseExecCapabilities("all")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(privileges).To(Equal(PrivilegedExec))
+
+	privileges, err = ParseExecCapabilities("net_admin, CAP_SYS_ADMIN")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(privileges).To(Equal(ExecPrivileges{Capabilities: []string{"CAP_NET_ADMIN", "CAP_SYS_ADMIN"}}))
+
+	privileges, err = ParseExecCapabilities("")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(privileges).To(Equal(ExecPrivileges{}))
+
+	_, err = ParseExecCapabilities("CAP_FLY")
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func TestStdinCloser(t *testing.T) {
+	g := NewWithT(t)
+
+	closed := 0
+	stdin := &stdinCloser{reader: strings.NewReader("data"), close: func() { closed++ }}
+
+	b, err := io.ReadAll(stdin)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(b)).To(Equal("data"))
+
+	_, err = stdin.Read(make([]byte, 1))
+	g.Expect(err).To(Equal(io.EOF))
+	g.Expect(closed).To(Equal(1))
+
+	// The stdin of the process is closed when the input cannot be read either.
+	closed = 0
+	pr, pw := io.Pipe()
+	pw.CloseWithError(errors.New("connection reset"))
+	stdin = &stdinCloser{reader: pr, close: func() { closed++ }}
+	_, err = io.ReadAll(stdin)
+	g.Expect(err).To(MatchError("connection reset"))
+	g.Expect(closed).To(Equal(1))
+}
+
+func TestExecTTYApply(t *testing.T) {
+	g := NewWithT(t)
+
+	pspec := &specs.Process{Env: []string{"PATH=/usr/bin"}}
+	tty := &ExecTTY{Size: &TerminalSize{Width: 120, Height: 40}}
+	tty.apply(pspec)
+
+	g.Expect(pspec.Terminal).To(BeTrue())
+	g.Expect(pspec.ConsoleSize).To(Equal(&specs.Box{Width: 120, Height: 40}))
+	g.Expect(pspec.Env).To(Equal([]string{"PATH=/usr/bin", "TERM=xterm"}))
+
+	pspec = &specs.Process{Env: []string{"TERM=screen"}}
+	(&ExecTTY{}).apply(pspec)
+
+	g.Expect(pspec.ConsoleSize).To(BeNil())
+	g.Expect(pspec.Env).To(Equal([]string{"TERM=screen"}))
+}
+
+// killableProcess is a process that exits when it is killed.
+type killableProcess struct {
+	containerd.Process
+	statusC chan containerd.ExitStatus
+	signals []syscall.Signal
+}
+
+func (p *killableProcess) Kill(_ context.Context, s syscall.Signal, _ ...containerd.KillOpts) error {
+	p.signals = append(p.signals, s)
+	p.statusC <- *containerd.NewExitStatus(137, time.Now(), nil)
+	return nil
+}
+
+func TestKillExec(t *testing.T) {
+	g := NewWithT(t)
+
+	process := &killableProcess{statusC: make(chan containerd.ExitStatus, 1)}
+	err := killProcess(context.Background(), process, process.statusC)
+
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(process.signals).To(Equal([]syscall.Signal{syscall.SIGKILL}))
+}
+
+func TestExitError(t *testing.T) {
+	g := NewWithT(t)
+
+	err := fmt.Errorf("bootstrap failed: %w", &ExitError{Command: "kubeadm join", Container: "worker-0", Code: 1})
+
+	var exitErr *ExitError
+	g.Expect(errors.As(err, &exitErr)).To(BeTrue())
+	g.Expect(exitErr.Code).To(Equal(uint32(1)))
+	g.Expect(err.Error()).To(Equal(`bootstrap failed: command "kubeadm join" in container "worker-0" exited with code 1`))
+}
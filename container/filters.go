@@ -0,0 +1,184 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/containerd"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+const (
+	filterLabel  = "label"
+	filterName   = "name"
+	filterStatus = "status"
+)
+
+// dockerStates are the container states docker accepts in status filters.
+var dockerStates = map[string]bool{
+	"created":    true,
+	"restarting": true,
+	"running":    true,
+	"removing":   true,
+	"paused":     true,
+	"exited":     true,
+	"dead":       true,
+}
+
+// containerFilter is the translation of a container.FilterBuilder for containerd.
+type containerFilter struct {
+	// selectors are containerd filter expressions that must all match.
+	selectors []string
+	// names are containerd filter expressions of which one must match, like the name filters of
+	// docker.
+	names []string
+	// statuses are the docker-style statuses to keep, any if empty.
+	// Status is a property of the task, not of the container record, so it is matched client-side.
+	statuses []string
+}
+
+// translateFilters converts docker-style filters into containerd list filters, with the docker
+// semantics: all the label filters must match, and one of the name and status filters of each.
+// Label and name filters are translated into containerd filter expressions, status filters are
+// kept to be matched against the task status.
+func translateFilters(filters container.FilterBuilder) (*containerFilter, error) {
+	result := &containerFilter{}
+
+	// Sort the keys so that the generated filter is stable.
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values := filters[key]
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			for _, value := range values[name] {
+				switch key {
+				case filterLabel:
+					if value == "" {
+						result.selectors = append(result.selectors, fmt.Sprintf("labels.%s", strconv.Quote(name)))
+					} else {
+						result.selectors = append(result.selectors, fmt.Sprintf("labels.%s==%s", strconv.Quote(name), strconv.Quote(value)))
+					}
+				case filterName:
+					selector, err := nameSelector(name)
+					if err != nil {
+						return nil, err
+					}
+					result.names = append(result.names, selector)
+				case filterStatus:
+					if !dockerStates[name] {
+						return nil, fmt.Errorf("invalid status filter %q", name)
+					}
+					result.statuses = append(result.statuses, name)
+				default:
+					return nil, fmt.Errorf("unsupported filter %q", key)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// nameSelector returns the containerd filter expression of a name filter. docker matches names with
+// regular expressions, so does containerd, except for the names anchored at both ends without
+// other regular expression syntax, which are matched exactly.
+func nameSelector(name string) (string, error) {
+	if _, err := regexp.Compile(name); err != nil {
+		return "", fmt.Errorf("invalid name filter %q: %v", name, err)
+	}
+	if literal := strings.TrimSuffix(strings.TrimPrefix(name, "^"), "$"); len(literal)+2 == len(name) && regexp.QuoteMeta(literal) == literal {
+		return fmt.Sprintf("id==%s", strconv.Quote(literal)), nil
+	}
+	return fmt.Sprintf("id~=%s", strconv.Quote(name)), nil
+}
+
+// containerdFilters returns the filters to pass to the containerd containers API, which lists the
+// containers matching any of them: the label selectors combined with each of the name selectors.
+func (f *containerFilter) containerdFilters() []string {
+	if len(f.names) == 0 {
+		if len(f.selectors) == 0 {
+			return nil
+		}
+		return []string{strings.Join(f.selectors, ",")}
+	}
+	filters := make([]string, 0, len(f.names))
+	for _, name := range f.names {
+		filters = append(filters, strings.Join(append(append([]string{}, f.selectors...), name), ","))
+	}
+	return filters
+}
+
+// matchesStatus returns true if the status of the task matches the status filters.
+func (f *containerFilter) matchesStatus(status containerd.Status) bool {
+	if len(f.statuses) == 0 {
+		return true
+	}
+	state := dockerState(status)
+	for _, s := range f.statuses {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerState maps a containerd task status to the docker container state names
+// used in status filters.
+func dockerState(status containerd.Status) string {
+	switch status.Status {
+	case containerd.Running:
+		return "running"
+	case containerd.Paused, containerd.Pausing:
+		return "paused"
+	case containerd.Stopped:
+		return "exited"
+	case containerd.Created:
+		return "created"
+	default:
+		return "dead"
+	}
+}
+
+// dockerStatus formats a containerd task status like the docker status column,
+// e.g. "Up" or "Exited (1)".
+func dockerStatus(status containerd.Status) string {
+	switch status.Status {
+	case containerd.Running:
+		return "Up"
+	case containerd.Paused, containerd.Pausing:
+		return "Up (Paused)"
+	case containerd.Stopped:
+		return fmt.Sprintf("Exited (%d)", status.ExitStatus)
+	case containerd.Created:
+		return "Created"
+	default:
+		return "Unknown"
+	}
+}
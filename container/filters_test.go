@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd"
+	containerdfilters "github.com/containerd/containerd/filters"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+func TestTranslateFilters(t *testing.T) {
+	g := NewWithT(t)
+
+	filters := container.FilterBuilder{}
+	filters.AddKeyNameValue("label", "io.x-k8s.kind.cluster", "test")
+	filters.AddKeyValue("label", "io.x-k8s.kind.role")
+	filters.AddKeyValue("name", "^test-cluster-worker$")
+	filters.AddKeyValue("status", "running")
+
+	filter, err := translateFilters(filters)
+
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(filter.containerdFilters()).To(Equal([]string{
+		`labels."io.x-k8s.kind.cluster"=="test",labels."io.x-k8s.kind.role",id=="test-cluster-worker"`,
+	}))
+	_, err = containerdfilters.ParseAll(filter.containerdFilters()...)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(filter.matchesStatus(containerd.Status{Status: containerd.Running})).To(BeTrue())
+	g.Expect(filter.matchesStatus(containerd.Status{Status: containerd.Stopped})).To(BeFalse())
+}
+
+func TestTranslateFiltersNames(t *testing.T) {
+	g := NewWithT(t)
+
+	filters := container.FilterBuilder{}
+	filters.AddKeyNameValue("label", "io.x-k8s.kind.cluster", "test")
+	filters.AddKeyNameValue("label", "io.x-k8s.kind.role", "worker")
+	filters.AddKeyValue("name", "^test-md-0-[a-z0-9]+$")
+	filters.AddKeyValue("name", "^test-lb$")
+	filters.AddKeyValue("status", "running")
+	filters.AddKeyValue("status", "exited")
+
+	filter, err := translateFilters(filters)
+
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(filter.containerdFilters()).To(Equal([]string{
+		`labels."io.x-k8s.kind.cluster"=="test",labels."io.x-k8s.kind.role"=="worker",id=="test-lb"`,
+		`labels."io.x-k8s.kind.cluster"=="test",labels."io.x-k8s.kind.role"=="worker",id~="^test-md-0-[a-z0-9]+$"`,
+	}))
+	parsed, err := containerdfilters.ParseAll(filter.containerdFilters()...)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	labels := map[string]string{"io.x-k8s.kind.cluster": "test", "io.x-k8s.kind.role": "worker"}
+	g.Expect(parsed.Match(testAdaptor{id: "test-md-0-abc12", labels: labels})).To(BeTrue())
+	g.Expect(parsed.Match(testAdaptor{id: "test-lb", labels: labels})).To(BeTrue())
+	g.Expect(parsed.Match(testAdaptor{id: "test-lb-1", labels: labels})).To(BeFalse())
+	g.Expect(parsed.Match(testAdaptor{id: "test-lb", labels: map[string]string{"io.x-k8s.kind.cluster": "test"}})).To(BeFalse())
+	g.Expect(filter.matchesStatus(containerd.Status{Status: containerd.Stopped})).To(BeTrue())
+	g.Expect(filter.matchesStatus(containerd.Status{Status: containerd.Paused})).To(BeFalse())
+}
+
+func TestTranslateFiltersInvalid(t *testing.T) {
+	g := NewWithT(t)
+
+	filters := container.FilterBuilder{}
+	filters.AddKeyValue("name", "test-(")
+	_, err := translateFilters(filters)
+	g.Expect(err).Should(HaveOccurred())
+
+	filters = container.FilterBuilder{}
+	filters.AddKeyValue("status", "up")
+	_, err = translateFilters(filters)
+	g.Expect(err).Should(HaveOccurred())
+}
+
+// testAdaptor matches containerd filters against a container ID and labels.
+type testAdaptor struct {
+	id     string
+	labels map[string]string
+}
+
+func (a testAdaptor) Field(fieldpath []string) (string, bool) {
+	switch fieldpath[0] {
+	case "id":
+		return a.id, true
+	case "labels":
+		value, ok := a.labels[strings.Join(fieldpath[1:], ".")]
+		return value, ok
+	}
+	return "", false
+}
+
+func TestTranslateFiltersUnsupported(t *testing.T) {
+	g := NewWithT(t)
+
+	filters := container.FilterBuilder{}
+	filters.AddKeyValue("ancestor", "kindest/node")
+
+	_, err := translateFilters(filters)
+
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func TestDockerStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(dockerStatus(containerd.Status{Status: containerd.Running})).To(Equal("Up"))
+	g.Expect(dockerStatus(containerd.Status{Status: containerd.Stopped, ExitStatus: 137})).To(Equal("Exited (137)"))
+	g.Expect(dockerStatus(containerd.Status{Status: containerd.Created})).To(Equal("Created"))
+}
@@ -0,0 +1,426 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/go-logr/logr"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+const (
+	// healthCheckLabel is the container label holding the health check of a container, probed by
+	// MonitorHealth.
+	healthCheckLabel = "io.x-k8s.capc.health-check"
+
+	// DefaultHealthCheckInterval, DefaultHealthCheckTimeout and DefaultHealthCheckRetries are used
+	// when a health check does not set them.
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 5 * time.Second
+	DefaultHealthCheckRetries  = 3
+
+	// healthMonitorTick is how often MonitorHealth looks for containers due for a probe.
+	healthMonitorTick = time.Second
+	// maxProbeOutput is the size of the probe output kept in the health status.
+	maxProbeOutput = 4096
+	// healthExecIDPrefix is the prefix of the IDs of the exec probes, whose events are not recorded.
+	healthExecIDPrefix = "health"
+)
+
+// Health statuses of a container with a health check.
+const (
+	// HealthStarting is the status of a container that did not pass its health check yet, and did not
+	// fail it enough times to be unhealthy.
+	HealthStarting = "starting"
+	// Healthy is the status of a container whose last probe succeeded.
+	Healthy = "healthy"
+	// Unhealthy is the status of a container that failed its health check Retries times in a row, or
+	// is not running.
+	Unhealthy = "unhealthy"
+)
+
+// healthCheckKey is the key type for accessing the health check in passed contexts.
+type healthCheckKey struct{}
+
+// HealthCheck configures the probe run against a container by MonitorHealth. Exactly one of Exec and
+// TCPPort must be set.
+type HealthCheck struct {
+	// Exec is the command run in the container, the probe succeeds if it exits with code 0.
+	Exec []string `json:"exec,omitempty"`
+	// TCPPort is the container port connected to, the probe succeeds if the connection is accepted.
+	TCPPort int `json:"tcpPort,omitempty"`
+	// Interval is the time between two probes, DefaultHealthCheckInterval if zero.
+	Interval time.Duration `json:"interval,omitempty"`
+	// Timeout is the time after which a probe fails, DefaultHealthCheckTimeout if zero.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Retries is the number of consecutive failed probes after which the container is unhealthy,
+	// DefaultHealthCheckRetries if zero.
+	Retries int `json:"retries,omitempty"`
+	// StartPeriod is the time after the task started during which failed probes are not counted,
+	// e.g. while a node bootstraps.
+	StartPeriod time.Duration `json:"startPeriod,omitempty"`
+}
+
+// HealthStatus is the result of the health check of a container.
+type HealthStatus struct {
+	// Status is HealthStarting, Healthy or Unhealthy.
+	Status string
+	// FailingStreak is the number of consecutive failed probes.
+	FailingStreak int
+	// LastProbe is the time of the last probe, zero if there was none yet.
+	LastProbe time.Time
+	// LastOutput is the output of the last probe command, or the reason it failed.
+	LastOutput string
+}
+
+func (h HealthStatus) String() string {
+	s := h.Status
+	if h.FailingStreak > 0 {
+		s += fmt.Sprintf(" (%d failed probes)", h.FailingStreak)
+	}
+	if h.LastOutput != "" {
+		s += ": " + h.LastOutput
+	}
+	return s
+}
+
+// HealthCheckInto is used to store the health check of the containers run with a context.
+func HealthCheckInto(ctx context.Context, check HealthCheck) context.Context {
+	return context.WithValue(ctx, healthCheckKey{}, check)
+}
+
+// healthCheckFrom returns the health check stored in the context, if any.
+func healthCheckFrom(ctx context.Context) (HealthCheck, bool) {
+	check, ok := ctx.Value(healthCheckKey{}).(HealthCheck)
+	return check, ok
+}
+
+// validate returns an error if the health check does not set exactly one probe.
+func (h HealthCheck) validate() error {
+	switch {
+	case len(h.Exec) > 0 && h.TCPPort != 0:
+		return fmt.Errorf("health check cannot set both an exec and a TCP probe")
+	case len(h.Exec) == 0 && h.TCPPort == 0:
+		return fmt.Errorf("health check must set an exec or a TCP probe")
+	case h.TCPPort < 0 || h.TCPPort > 65535:
+		return fmt.Errorf("invalid health check TCP port %d", h.TCPPort)
+	}
+	return nil
+}
+
+// withDefaults returns the health check with the unset settings defaulted.
+func (h HealthCheck) withDefaults() HealthCheck {
+	if h.Interval <= 0 {
+		h.Interval = DefaultHealthCheckInterval
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = DefaultHealthCheckTimeout
+	}
+	if h.Retries <= 0 {
+		h.Retries = DefaultHealthCheckRetries
+	}
+	return h
+}
+
+// label returns the value of the health check label.
+func (h HealthCheck) label() (string, error) {
+	if err := h.validate(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal health check: %v", err)
+	}
+	return string(data), nil
+}
+
+// healthCheckFromLabels returns the health check stored in the container labels, false if the
+// container has none.
+func healthCheckFromLabels(labels map[string]string) (HealthCheck, bool, error) {
+	data, ok := labels[healthCheckLabel]
+	if !ok {
+		return HealthCheck{}, false, nil
+	}
+	var check HealthCheck
+	if err := json.Unmarshal([]byte(data), &check); err != nil {
+		return HealthCheck{}, false, fmt.Errorf("failed to parse health check label: %v", err)
+	}
+	return check.withDefaults(), true, nil
+}
+
+// healthTracker keeps the health status of the containers with a health check.
+type healthTracker struct {
+	mu      sync.Mutex
+	entries map[string]*healthEntry
+	probing map[string]bool
+}
+
+// healthEntry is the health status of a container task.
+type healthEntry struct {
+	status HealthStatus
+	// pid is the pid of the task the status is about, zero if the container is not running.
+	pid uint32
+	// startedAt is the time the task was first seen running, its start period begins then.
+	startedAt time.Time
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{entries: map[string]*healthEntry{}, probing: map[string]bool{}}
+}
+
+// status returns the health status of the container, starting if it was not probed yet.
+func (t *healthTracker) status(containerName string) HealthStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if entry, ok := t.entries[containerName]; ok {
+		return entry.status
+	}
+	return HealthStatus{Status: HealthStarting}
+}
+
+// startProbe returns true and marks the container as being probed if its last probe is older than
+// interval and it is not being probed already.
+func (t *healthTracker) startProbe(containerName string, interval time.Duration, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.probing[containerName] {
+		return false
+	}
+	if entry, ok := t.entries[containerName]; ok && now.Sub(entry.status.LastProbe) < interval {
+		return false
+	}
+	t.probing[containerName] = true
+	return true
+}
+
+// observe records that the task of the container with the given pid is running, the container is
+// starting again if it is a new task, e.g. after a restart.
+func (t *healthTracker) observe(containerName string, pid uint32, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if entry, ok := t.entries[containerName]; ok && entry.pid == pid {
+		return
+	}
+	t.entries[containerName] = &healthEntry{status: HealthStatus{Status: HealthStarting}, pid: pid, startedAt: now}
+}
+
+// update records the result of a probe of the container. Failures during the start period of the
+// health check are not counted.
+func (t *healthTracker) update(containerName string, check HealthCheck, now time.Time, output string, probeErr error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.probing, containerName)
+
+	entry, ok := t.entries[containerName]
+	if !ok {
+		entry = &healthEntry{status: HealthStatus{Status: HealthStarting}, startedAt: now}
+		t.entries[containerName] = entry
+	}
+	status := &entry.status
+	status.LastProbe = now
+	status.LastOutput = truncateOutput(output)
+	if probeErr == nil {
+		status.Status = Healthy
+		status.FailingStreak = 0
+		return
+	}
+	if status.LastOutput == "" {
+		status.LastOutput = probeErr.Error()
+	}
+	if now.Before(entry.startedAt.Add(check.StartPeriod)) {
+		return
+	}
+	status.FailingStreak++
+	if status.FailingStreak >= check.Retries {
+		status.Status = Unhealthy
+	}
+}
+
+// notRunning records that the container has no running task, which makes it unhealthy.
+func (t *healthTracker) notRunning(containerName string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.probing, containerName)
+
+	failingStreak := 1
+	if entry, ok := t.entries[containerName]; ok && entry.pid == 0 {
+		failingStreak = entry.status.FailingStreak + 1
+	}
+	t.entries[containerName] = &healthEntry{status: HealthStatus{
+		Status:        Unhealthy,
+		FailingStreak: failingStreak,
+		LastProbe:     now,
+		LastOutput:    "container is not running",
+	}}
+}
+
+// skip records that the container was not probed, e.g. because it is paused, keeping its status.
+func (t *healthTracker) skip(containerName string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.probing, containerName)
+	if entry, ok := t.entries[containerName]; ok {
+		entry.status.LastProbe = now
+	}
+}
+
+// forgetExcept forgets the health status of the containers not in the given set, e.g. deleted ones.
+func (t *healthTracker) forgetExcept(containerNames map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name := range t.entries {
+		if !containerNames[name] {
+			delete(t.entries, name)
+		}
+	}
+}
+
+// MonitorHealth probes the containers of all the runtime namespaces that have a health check at
+// their interval, until the context is cancelled. Paused containers are not probed, and containers
+// that are not running are unhealthy.
+func (c *containerdRuntime) MonitorHealth(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	ticker := time.NewTicker(healthMonitorTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			namespaceNames, err := c.ListNamespaces(ctx)
+			if err != nil {
+				log.Error(err, "Failed to list namespaces")
+				continue
+			}
+			names := map[string]bool{}
+			listed := true
+			for _, namespace := range namespaceNames {
+				nsCtx := namespaces.WithNamespace(ctx, namespace)
+				cntrs, err := c.client.Containers(nsCtx, fmt.Sprintf("labels.%q", healthCheckLabel))
+				if err != nil {
+					log.Error(err, "Failed to list containers", "namespace", namespace)
+					listed = false
+					continue
+				}
+				for _, cntr := range cntrs {
+					names[cntr.ID()] = true
+					if err := c.probeIfDue(nsCtx, cntr); err != nil {
+						log.Error(err, "Failed to check container health", "namespace", namespace, "container", cntr.ID())
+					}
+				}
+			}
+			// The health of the containers that could not be listed is kept until the next tick.
+			if listed {
+				c.health.forgetExcept(names)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// probeIfDue probes the container in the background if its health check interval elapsed.
+func (c *containerdRuntime) probeIfDue(ctx context.Context, cntr containerd.Container) error {
+	labels, err := cntr.Labels(ctx)
+	if err != nil {
+		return err
+	}
+	check, ok, err := healthCheckFromLabels(labels)
+	if err != nil || !ok {
+		return err
+	}
+
+	now := time.Now()
+	if !c.health.startProbe(cntr.ID(), check.Interval, now) {
+		return nil
+	}
+
+	status, err := containerStatus(ctx, cntr)
+	if err != nil {
+		c.health.skip(cntr.ID(), now)
+		return err
+	}
+	switch status.Status {
+	case containerd.Running:
+	case containerd.Paused, containerd.Pausing:
+		// A frozen container is expected not to respond, it keeps the health it had before.
+		c.health.skip(cntr.ID(), now)
+		return nil
+	default:
+		c.health.notRunning(cntr.ID(), now)
+		return nil
+	}
+
+	task, err := cntr.Task(ctx, nil)
+	if err != nil {
+		c.health.skip(cntr.ID(), now)
+		return err
+	}
+	c.health.observe(cntr.ID(), task.Pid(), now)
+
+	go func() {
+		output, err := c.probe(ctx, cntr.ID(), labels, check)
+		c.health.update(cntr.ID(), check, time.Now(), output, err)
+	}()
+	return nil
+}
+
+// probe runs the probe of the health check against the container and returns its output.
+func (c *containerdRuntime) probe(ctx context.Context, containerName string, labels map[string]string, check HealthCheck) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	if len(check.Exec) > 0 {
+		var output bytes.Buffer
+		ctx = execIDPrefixInto(ctx, healthExecIDPrefix)
+		err := c.ExecContainer(ctx, containerName, &container.ExecContainerInput{OutputBuffer: &output, ErrorBuffer: &output}, check.Exec[0], check.Exec[1:]...)
+		return output.String(), err
+	}
+
+	host := "127.0.0.1"
+	ips, err := containerIPs(labels)
+	if err != nil {
+		return "", err
+	}
+	if ipv4, ipv6 := firstIPs(ips); ipv4 != "" {
+		host = ipv4
+	} else if ipv6 != "" {
+		host = ipv6
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(check.TCPPort)))
+	if err != nil {
+		return "", err
+	}
+	return "", conn.Close()
+}
+
+// truncateOutput keeps the end of the probe output, which usually holds the error.
+func truncateOutput(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxProbeOutput {
+		output = "..." + output[len(output)-maxProbeOutput:]
+	}
+	return output
+}
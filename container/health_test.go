@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestHealthCheckLabel(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := HealthCheck{}.label()
+	g.Expect(err).To(HaveOccurred())
+	_, err = HealthCheck{Exec: []string{"true"}, TCPPort: 6443}.label()
+	g.Expect(err).To(HaveOccurred())
+
+	label, err := HealthCheck{TCPPort: 6443, Retries: 5}.label()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	check, ok, err := healthCheckFromLabels(map[string]string{healthCheckLabel: label})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(check).To(Equal(HealthCheck{TCPPort: 6443, Interval: DefaultHealthCheckInterval, Timeout: DefaultHealthCheckTimeout, Retries: 5}))
+
+	_, ok, err = healthCheckFromLabels(map[string]string{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestHealthTracker(t *testing.T) {
+	g := NewWithT(t)
+
+	check := HealthCheck{Exec: []string{"true"}, StartPeriod: time.Minute}.withDefaults()
+	start := time.Unix(0, 0)
+	failed := errors.New("exit code 1")
+
+	tr := newHealthTracker()
+	g.Expect(tr.status("node").Status).To(Equal(HealthStarting))
+	g.Expect(tr.startProbe("node", check.Interval, start)).To(BeTrue())
+	g.Expect(tr.startProbe("node", check.Interval, start)).To(BeFalse())
+	tr.observe("node", 100, start)
+
+	// Failures during the start period are not counted.
+	tr.update("node", check, start.Add(time.Second), "", failed)
+	g.Expect(tr.status("node")).To(Equal(HealthStatus{Status: HealthStarting, LastProbe: start.Add(time.Second), LastOutput: "exit code 1"}))
+	g.Expect(tr.startProbe("node", check.Interval, start.Add(5*time.Second))).To(BeFalse())
+
+	now := start.Add(time.Minute)
+	for i := 0; i < check.Retries; i++ {
+		g.Expect(tr.startProbe("node", check.Interval, now)).To(BeTrue())
+		tr.observe("node", 100, now)
+		tr.update("node", check, now, "connection refused\n", failed)
+		now = now.Add(check.Interval)
+	}
+	g.Expect(tr.status("node").Status).To(Equal(Unhealthy))
+	g.Expect(tr.status("node").FailingStreak).To(Equal(check.Retries))
+	g.Expect(tr.status("node").LastOutput).To(Equal("connection refused"))
+
+	tr.update("node", check, now, "ok", nil)
+	g.Expect(tr.status("node")).To(Equal(HealthStatus{Status: Healthy, LastProbe: now, LastOutput: "ok"}))
+
+	// A container that stopped is unhealthy, and starting again once restarted.
+	tr.notRunning("node", now)
+	g.Expect(tr.status("node").Status).To(Equal(Unhealthy))
+	tr.observe("node", 200, now)
+	g.Expect(tr.status("node").Status).To(Equal(HealthStarting))
+
+	tr.forgetExcept(map[string]bool{})
+	g.Expect(tr.entries).To(BeEmpty())
+}
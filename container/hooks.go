@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// hooksKey is the key type for accessing the OCI hooks in passed contexts.
+type hooksKey struct{}
+
+// Hook is a binary of the host run by the OCI runtime at a point of the lifecycle of a container. It
+// gets the state of the container as JSON on its standard input.
+type Hook struct {
+	// Path is the absolute path of the binary on the host.
+	Path string
+	// Args are the arguments of the binary, including argv[0].
+	Args []string
+	// Env are the environment variables of the binary, in the KEY=value format.
+	Env []string
+	// Timeout is how long the binary can run, zero for no timeout.
+	Timeout time.Duration
+}
+
+// Hooks are the OCI hooks of a container.
+type Hooks struct {
+	// Prestart hooks run after the namespaces of the container are created, before its process starts,
+	// e.g. to plumb its network.
+	Prestart []Hook
+	// Poststop hooks run after the container is deleted, e.g. to clean up after it.
+	Poststop []Hook
+}
+
+// HooksInto is used to store the OCI hooks of the containers run with a context.
+func HooksInto(ctx context.Context, hooks Hooks) context.Context {
+	return context.WithValue(ctx, hooksKey{}, hooks)
+}
+
+// hooksFrom returns the OCI hooks stored in the context, none if not set.
+func hooksFrom(ctx context.Context) Hooks {
+	if hooks, ok := ctx.Value(hooksKey{}).(Hooks); ok {
+		return hooks
+	}
+	return Hooks{}
+}
+
+// empty returns true if there are no hooks.
+func (h Hooks) empty() bool {
+	return len(h.Prestart) == 0 && len(h.Poststop) == 0
+}
+
+// validate returns an error if a hook binary is not an absolute path or its timeout is not a whole
+// positive number of seconds, the precision of the OCI runtime.
+func (h Hooks) validate() error {
+	for _, hook := range append(append([]Hook{}, h.Prestart...), h.Poststop...) {
+		if !filepath.IsAbs(hook.Path) {
+			return fmt.Errorf("hook path %q is not absolute", hook.Path)
+		}
+		if hook.Timeout < 0 || hook.Timeout%time.Second != 0 {
+			return fmt.Errorf("invalid timeout %s of hook %q", hook.Timeout, hook.Path)
+		}
+	}
+	return nil
+}
+
+// withHooks appends the hooks to the ones of the spec.
+func withHooks(hooks Hooks) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Hooks == nil {
+			s.Hooks = &specs.Hooks{}
+		}
+		s.Hooks.Prestart = append(s.Hooks.Prestart, specHooks(hooks.Prestart)...)
+		s.Hooks.Poststop = append(s.Hooks.Poststop, specHooks(hooks.Poststop)...)
+		return nil
+	}
+}
+
+// specHooks returns the OCI spec hooks of the hooks.
+func specHooks(hooks []Hook) []specs.Hook {
+	specHooks := make([]specs.Hook, 0, len(hooks))
+	for _, hook := range hooks {
+		specHook := specs.Hook{Path: hook.Path, Args: hook.Args, Env: hook.Env}
+		if hook.Timeout > 0 {
+			timeout := int(hook.Timeout / time.Second)
+			specHook.Timeout = &timeout
+		}
+		specHooks = append(specHooks, specHook)
+	}
+	return specHooks
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestWithHooks(t *testing.T) {
+	g := NewWithT(t)
+
+	hooks := Hooks{
+		Prestart: []Hook{{Path: "/usr/local/bin/plumb", Args: []string{"plumb", "--bridge=br0"}, Timeout: 10 * time.Second}},
+		Poststop: []Hook{{Path: "/usr/local/bin/audit", Env: []string{"AUDIT_LOG=/var/log/machines.log"}}},
+	}
+	g.Expect(hooks.empty()).To(BeFalse())
+	g.Expect(hooks.validate()).To(Succeed())
+
+	s := &oci.Spec{Hooks: &specs.Hooks{Prestart: []specs.Hook{{Path: "/usr/bin/existing"}}}}
+	g.Expect(withHooks(hooks)(context.Background(), nil, nil, s)).To(Succeed())
+	g.Expect(s.Hooks.Prestart).To(HaveLen(2))
+	g.Expect(s.Hooks.Prestart[1].Path).To(Equal("/usr/local/bin/plumb"))
+	g.Expect(s.Hooks.Prestart[1].Args).To(Equal([]string{"plumb", "--bridge=br0"}))
+	g.Expect(*s.Hooks.Prestart[1].Timeout).To(Equal(10))
+	g.Expect(s.Hooks.Poststop).To(HaveLen(1))
+	g.Expect(s.Hooks.Poststop[0].Env).To(Equal([]string{"AUDIT_LOG=/var/log/machines.log"}))
+	g.Expect(s.Hooks.Poststop[0].Timeout).To(BeNil())
+
+	g.Expect(Hooks{}.empty()).To(BeTrue())
+	g.Expect(Hooks{Prestart: []Hook{{Path: "plumb"}}}.validate()).ToNot(Succeed())
+	g.Expect(Hooks{Poststop: []Hook{{Path: "/bin/true", Timeout: 1500 * time.Millisecond}}}.validate()).ToNot(Succeed())
+}
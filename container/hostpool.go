@@ -0,0 +1,195 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrNoHost is wrapped by the error returned when no host of the pool can run a machine.
+var ErrNoHost = errors.New("no host available")
+
+// HostConfig configures a containerd host of the pool.
+type HostConfig struct {
+	// Name identifies the host, it is recorded in the status of the machines scheduled onto it.
+	Name string `json:"name"`
+	// Address is the address of the containerd daemon, the path of its local socket or the
+	// tcp://host:port endpoint of a remote daemon.
+	Address string `json:"address"`
+	// FailureDomain is the failure domain of the host, the machines of a failure domain are only
+	// scheduled onto its hosts.
+	FailureDomain string `json:"failureDomain,omitempty"`
+	// Labels are matched by the host selectors of the machines.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Capacity is the number of machines the host can run, 0 for no limit.
+	Capacity int `json:"capacity,omitempty"`
+	// TLS is the client certificate configuration of a remote daemon.
+	TLS *HostTLSConfig `json:"tls,omitempty"`
+}
+
+// HostTLSConfig holds the files of the mutual TLS configuration of a remote containerd daemon.
+type HostTLSConfig struct {
+	// CA is the file of the CA certificates verifying the daemon certificate, the system roots if empty.
+	CA string `json:"ca,omitempty"`
+	// Cert is the file of the client certificate.
+	Cert string `json:"cert"`
+	// Key is the file of the client certificate key.
+	Key string `json:"key"`
+}
+
+// hostsConfig is the content of the hosts configuration file.
+type hostsConfig struct {
+	Hosts []HostConfig `json:"hosts"`
+}
+
+// LoadHostsConfig reads the configuration of the hosts of the pool from a YAML file, e.g.
+//
+//	hosts:
+//	- name: lab-1
+//	  address: tcp://10.0.0.11:2376
+//	  failureDomain: rack-a
+//	  capacity: 8
+//	  tls: {ca: /etc/capc/ca.pem, cert: /etc/capc/cert.pem, key: /etc/capc/key.pem}
+func LoadHostsConfig(path string) ([]HostConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hosts configuration: %v", err)
+	}
+	config := hostsConfig{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse hosts configuration: %v", err)
+	}
+	if len(config.Hosts) == 0 {
+		return nil, fmt.Errorf("no host in hosts configuration %q", path)
+	}
+	return config.Hosts, nil
+}
+
+// Host is a containerd daemon the machines can be scheduled onto.
+type Host struct {
+	Name          string
+	FailureDomain string
+	Labels        map[string]string
+	Capacity      int
+	Runtime       Runtime
+}
+
+// HostPool schedules the machines onto a set of containerd hosts.
+type HostPool struct {
+	hosts []*Host
+}
+
+// NewHostPool returns a pool of the given hosts, which must have unique names.
+func NewHostPool(hosts ...*Host) (*HostPool, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("a host pool needs at least one host")
+	}
+	names := map[string]bool{}
+	for _, host := range hosts {
+		switch {
+		case host.Name == "":
+			return nil, fmt.Errorf("host name is required")
+		case names[host.Name]:
+			return nil, fmt.Errorf("duplicate host %q", host.Name)
+		case host.Capacity < 0:
+			return nil, fmt.Errorf("invalid capacity %d of host %q", host.Capacity, host.Name)
+		}
+		names[host.Name] = true
+	}
+	return &HostPool{hosts: hosts}, nil
+}
+
+// Hosts returns the hosts of the pool.
+func (p *HostPool) Hosts() []*Host {
+	return append([]*Host{}, p.hosts...)
+}
+
+// Host returns the host with the given name.
+func (p *HostPool) Host(name string) (*Host, bool) {
+	for _, host := range p.hosts {
+		if host.Name == name {
+			return host, true
+		}
+	}
+	return nil, false
+}
+
+// Placement constrains the hosts a machine can be scheduled onto.
+type Placement struct {
+	// FailureDomain selects the hosts of a failure domain, if set.
+	FailureDomain string
+	// Host selects the host with the name, if set.
+	Host string
+	// Selector selects the hosts by their labels, if set.
+	Selector labels.Selector
+}
+
+// matches returns whether the machines with the placement can run on the host.
+func (p Placement) matches(host *Host) bool {
+	if p.FailureDomain != "" && host.FailureDomain != p.FailureDomain {
+		return false
+	}
+	if p.Host != "" && host.Name != p.Host {
+		return false
+	}
+	return p.Selector == nil || p.Selector.Matches(labels.Set(host.Labels))
+}
+
+// Schedule returns the host a machine with the placement runs on, given the number of machines
+// running on each host: the matching host with capacity left that is the least loaded relative
+// to its capacity, the first one of the pool on ties. Hosts without capacity limit are weighed by
+// their number of machines only.
+func (p *HostPool) Schedule(placement Placement, machines map[string]int) (*Host, error) {
+	var best *Host
+	var bestLoad float64
+	for _, host := range p.hosts {
+		if !placement.matches(host) {
+			continue
+		}
+		count := machines[host.Name]
+		load := float64(count)
+		if host.Capacity > 0 {
+			if count >= host.Capacity {
+				continue
+			}
+			load = float64(count) / float64(host.Capacity)
+		}
+		if best == nil || load < bestLoad {
+			best, bestLoad = host, load
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w matching %s", ErrNoHost, placement)
+	}
+	return best, nil
+}
+
+func (p Placement) String() string {
+	s := "any host"
+	if p.FailureDomain != "" {
+		s = fmt.Sprintf("failure domain %q", p.FailureDomain)
+	}
+	if p.Host != "" {
+		s = fmt.Sprintf("host %q", p.Host)
+	}
+	if p.Selector != nil && !p.Selector.Empty() {
+		s += fmt.Sprintf(" and selector %q", p.Selector)
+	}
+	return s
+}
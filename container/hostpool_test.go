@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestHostPoolSchedule(t *testing.T) {
+	g := NewWithT(t)
+
+	pool, err := NewHostPool(
+		&Host{Name: "a", FailureDomain: "rack-1", Capacity: 2},
+		&Host{Name: "b", FailureDomain: "rack-1", Capacity: 4, Labels: map[string]string{"gpu": "true"}},
+		&Host{Name: "c", FailureDomain: "rack-2"},
+	)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	schedule := func(placement Placement, machines map[string]int) string {
+		host, err := pool.Schedule(placement, machines)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		return host.Name
+	}
+	rack1 := Placement{FailureDomain: "rack-1"}
+	g.Expect(schedule(rack1, nil)).To(Equal("a"))
+	g.Expect(schedule(rack1, map[string]int{"a": 1})).To(Equal("b"))
+	g.Expect(schedule(rack1, map[string]int{"a": 1, "b": 2})).To(Equal("a"))
+	g.Expect(schedule(rack1, map[string]int{"a": 2, "b": 3})).To(Equal("b"))
+	g.Expect(schedule(Placement{FailureDomain: "rack-2"}, map[string]int{"c": 100})).To(Equal("c"))
+	g.Expect(schedule(Placement{Selector: labels.SelectorFromSet(labels.Set{"gpu": "true"})}, nil)).To(Equal("b"))
+	g.Expect(schedule(Placement{Host: "b"}, map[string]int{"a": 0, "b": 3})).To(Equal("b"))
+
+	_, err = pool.Schedule(rack1, map[string]int{"a": 2, "b": 4})
+	g.Expect(errors.Is(err, ErrNoHost)).To(BeTrue())
+	_, err = pool.Schedule(Placement{FailureDomain: "rack-3"}, nil)
+	g.Expect(errors.Is(err, ErrNoHost)).To(BeTrue())
+	_, err = pool.Schedule(Placement{Host: "a"}, map[string]int{"a": 2})
+	g.Expect(errors.Is(err, ErrNoHost)).To(BeTrue())
+}
+
+func TestNewHostPool(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := NewHostPool()
+	g.Expect(err).To(HaveOccurred())
+	_, err = NewHostPool(&Host{Name: "a"}, &Host{Name: "a"})
+	g.Expect(err).To(HaveOccurred())
+	_, err = NewHostPool(&Host{Name: "a", Capacity: -1})
+	g.Expect(err).To(HaveOccurred())
+
+	pool, err := NewHostPool(&Host{Name: "a"}, &Host{Name: "b"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	host, ok := pool.Host("b")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(host.Name).To(Equal("b"))
+	_, ok = pool.Host("c")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestLoadHostsConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "hosts.yaml")
+	g.Expect(os.WriteFile(path, []byte(`hosts:
+- name: local
+  address: /run/containerd/containerd.sock
+- name: lab-1
+  address: tcp://10.0.0.11:2376
+  failureDomain: rack-a
+  labels: {gpu: "true"}
+  capacity: 8
+  tls: {ca: ca.pem, cert: cert.pem, key: key.pem}
+`), 0o600)).To(Succeed())
+	hosts, err := LoadHostsConfig(path)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(hosts).To(Equal([]HostConfig{
+		{Name: "local", Address: "/run/containerd/containerd.sock"},
+		{
+			Name:          "lab-1",
+			Address:       "tcp://10.0.0.11:2376",
+			FailureDomain: "rack-a",
+			Labels:        map[string]string{"gpu": "true"},
+			Capacity:      8,
+			TLS:           &HostTLSConfig{CA: "ca.pem", Cert: "cert.pem", Key: "key.pem"},
+		},
+	}))
+
+	g.Expect(os.WriteFile(path, []byte("hosts: []\n"), 0o600)).To(Succeed())
+	_, err = LoadHostsConfig(path)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(os.WriteFile(path, []byte("hosts:\n- name: a\n  adress: /run/containerd.sock\n"), 0o600)).To(Succeed())
+	_, err = LoadHostsConfig(path)
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	refdocker "github.com/containerd/containerd/reference/docker"
+	"github.com/go-logr/logr"
+)
+
+// DefaultImageGCRepositories are the repositories of the node and load balancer images, the ones
+// piling up on a host as clusters are created with new Kubernetes versions.
+var DefaultImageGCRepositories = []string{"kindest/node", "kindest/haproxy"}
+
+// ImageGCPolicy selects the images removed by the image garbage collection. Only the images of the
+// given repositories that no container uses, and that are not referenced, are removed.
+type ImageGCPolicy struct {
+	// Repositories are the repositories of the images collected, e.g. "kindest/node".
+	Repositories []string
+	// MinAge keeps the unused images pulled more recently, e.g. pulled for a container that is not
+	// created yet. Zero removes them whatever their age.
+	MinAge time.Duration
+	// MaxAge removes the unused images pulled longer ago, zero keeps them whatever their age.
+	MaxAge time.Duration
+	// MaxSize removes the unused images, the least recently pulled first, until the images of the
+	// repositories use no more bytes. Zero keeps them whatever their size.
+	MaxSize int64
+	// ReferencedImages returns the images to keep even if no container uses them, e.g. the images of
+	// the machines to create. Nil keeps only the images used by containers.
+	ReferencedImages func(ctx context.Context) ([]string, error)
+}
+
+// gcImage is an image of a collected repository, in one of the namespaces of the runtime.
+type gcImage struct {
+	namespace string
+	name      string
+	// digest identifies the content of the image, shared by the images with the same content.
+	digest string
+	size   int64
+	// pulledAt is when the image was last pulled or tagged.
+	pulledAt time.Time
+	// used is true if a container of the namespace was created from the image.
+	used bool
+}
+
+// MonitorImages garbage collects the images according to the policy every interval until the context
+// is cancelled, so that a host running clusters of many Kubernetes versions does not fill up with
+// node images no cluster uses anymore.
+func (c *containerdRuntime) MonitorImages(ctx context.Context, policy ImageGCPolicy, interval time.Duration) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.CollectImages(ctx, policy); err != nil {
+				log.Error(err, "Failed to garbage collect images")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// CollectImages removes the images of the namespaces of the runtime and of its clusters selected by
+// the policy. Their content is removed by the containerd garbage collection once no image
+// references it.
+func (c *containerdRuntime) CollectImages(ctx context.Context, policy ImageGCPolicy) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	repositories := map[string]bool{}
+	for _, repository := range policy.Repositories {
+		named, err := refdocker.ParseNormalizedNamed(repository)
+		if err != nil {
+			return fmt.Errorf("invalid image repository %q: %v", repository, err)
+		}
+		repositories[named.Name()] = true
+	}
+
+	namespaceNames, err := c.ListNamespaces(ctx)
+	if err != nil {
+		return err
+	}
+	images := []gcImage{}
+	for _, namespace := range namespaceNames {
+		nsImages, err := c.gcImages(namespaces.WithNamespace(ctx, namespace), repositories)
+		if err != nil {
+			return fmt.Errorf("failed to list images of namespace %q: %v", namespace, err)
+		}
+		images = append(images, nsImages...)
+	}
+
+	if policy.ReferencedImages != nil {
+		referenced, err := policy.ReferencedImages(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the referenced images: %v", err)
+		}
+		markReferenced(images, referenced)
+	}
+
+	for _, image := range selectImagesToCollect(images, policy, time.Now()) {
+		err := c.client.ImageService().Delete(namespaces.WithNamespace(ctx, image.namespace), image.name)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to remove image %q of namespace %q: %v", image.name, image.namespace, err)
+		}
+		log.Info("Removed unused image", "image", image.name, "namespace", image.namespace, "pulledAt", image.pulledAt)
+	}
+	return nil
+}
+
+// gcImages returns the images of the repositories in the namespace of the context.
+func (c *containerdRuntime) gcImages(ctx context.Context, repositories map[string]bool) ([]gcImage, error) {
+	cntrs, err := c.client.Containers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, cntr := range cntrs {
+		info, err := cntr.Info(ctx, containerd.WithoutRefreshedMetadata)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		used[info.Image] = true
+	}
+
+	imgs, err := c.client.ImageService().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log := logr.FromContextOrDiscard(ctx)
+	namespace, _ := namespaces.Namespace(ctx)
+	images := []gcImage{}
+	for _, img := range imgs {
+		named, err := refdocker.ParseNormalizedNamed(img.Name)
+		if err != nil || !repositories[named.Name()] {
+			continue
+		}
+		size, err := img.Size(ctx, c.client.ContentStore(), platforms.Default())
+		if err != nil {
+			// The images without content for the platform of the host, e.g. pulled for another
+			// platform, are not collected.
+			log.V(4).Info("Skipping image without content for the host platform", "image", img.Name, "error", err.Error())
+			continue
+		}
+		images = append(images, gcImage{
+			namespace: namespace,
+			name:      img.Name,
+			digest:    img.Target.Digest.String(),
+			size:      size,
+			pulledAt:  img.UpdatedAt,
+			used:      used[img.Name],
+		})
+	}
+	return images, nil
+}
+
+// markReferenced marks the images with the given references used.
+func markReferenced(images []gcImage, references []string) {
+	referenced := map[string]bool{}
+	for _, reference := range references {
+		ref, err := refdocker.ParseDockerRef(reference)
+		if err != nil {
+			continue
+		}
+		referenced[ref.String()] = true
+	}
+	for i := range images {
+		if referenced[images[i].name] {
+			images[i].used = true
+		}
+	}
+}
+
+// selectImagesToCollect returns the unused images older than the maximum age of the policy, and the
+// least recently pulled other unused images to remove until the images use no more than its maximum
+// size, except the images younger than its minimum age. The content shared by several images is
+// counted once, and only freed by removing all of them.
+func selectImagesToCollect(images []gcImage, policy ImageGCPolicy, now time.Time) []gcImage {
+	sort.SliceStable(images, func(i, j int) bool { return images[i].pulledAt.Before(images[j].pulledAt) })
+
+	var totalSize int64
+	references := map[string]int{}
+	for _, image := range images {
+		if references[image.digest] == 0 {
+			totalSize += image.size
+		}
+		references[image.digest]++
+	}
+
+	selected := []gcImage{}
+	for _, image := range images {
+		if image.used || (policy.MinAge > 0 && now.Sub(image.pulledAt) < policy.MinAge) {
+			continue
+		}
+		expired := policy.MaxAge > 0 && now.Sub(image.pulledAt) > policy.MaxAge
+		oversized := policy.MaxSize > 0 && totalSize > policy.MaxSize
+		if !expired && !oversized {
+			continue
+		}
+		selected = append(selected, image)
+		references[image.digest]--
+		if references[image.digest] == 0 {
+			totalSize -= image.size
+		}
+	}
+	return selected
+}
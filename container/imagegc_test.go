@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSelectImagesToCollect(t *testing.T) {
+	now := time.Now()
+	images := func() []gcImage {
+		return []gcImage{
+			{namespace: "default.a.dev", name: "docker.io/kindest/node:v1.23.6", digest: "sha256:123", size: 400, pulledAt: now.Add(-48 * time.Hour), used: true},
+			{namespace: "default.a.dev", name: "docker.io/kindest/node:v1.22.9", digest: "sha256:122", size: 400, pulledAt: now.Add(-72 * time.Hour)},
+			{namespace: "default.b.dev", name: "docker.io/kindest/node:v1.22.9", digest: "sha256:122", size: 400, pulledAt: now.Add(-24 * time.Hour)},
+			{namespace: "default.b.dev", name: "docker.io/kindest/node:v1.24.0", digest: "sha256:124", size: 400, pulledAt: now.Add(-time.Hour)},
+		}
+	}
+	names := func(images []gcImage) []string {
+		ret := []string{}
+		for _, image := range images {
+			ret = append(ret, image.namespace+"/"+image.name)
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name   string
+		policy ImageGCPolicy
+		want   []string
+	}{
+		{
+			name:   "no limit",
+			policy: ImageGCPolicy{},
+			want:   []string{},
+		},
+		{
+			name:   "max age",
+			policy: ImageGCPolicy{MaxAge: 36 * time.Hour},
+			want:   []string{"default.a.dev/docker.io/kindest/node:v1.22.9"},
+		},
+		{
+			name:   "max size frees shared content once all its images are removed",
+			policy: ImageGCPolicy{MaxSize: 800},
+			want:   []string{"default.a.dev/docker.io/kindest/node:v1.22.9", "default.b.dev/docker.io/kindest/node:v1.22.9"},
+		},
+		{
+			name:   "used images are kept over the max size",
+			policy: ImageGCPolicy{MaxSize: 100},
+			want:   []string{"default.a.dev/docker.io/kindest/node:v1.22.9", "default.b.dev/docker.io/kindest/node:v1.22.9", "default.b.dev/docker.io/kindest/node:v1.24.0"},
+		},
+		{
+			name:   "images younger than the min age are kept over the max size",
+			policy: ImageGCPolicy{MaxSize: 100, MinAge: 2 * time.Hour},
+			want:   []string{"default.a.dev/docker.io/kindest/node:v1.22.9", "default.b.dev/docker.io/kindest/node:v1.22.9"},
+		},
+		{
+			name:   "images younger than the min age are kept over the max age",
+			policy: ImageGCPolicy{MaxAge: 12 * time.Hour, MinAge: 36 * time.Hour},
+			want:   []string{"default.a.dev/docker.io/kindest/node:v1.22.9"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(names(selectImagesToCollect(images(), tt.policy, now))).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestMarkReferenced(t *testing.T) {
+	g := NewWithT(t)
+
+	images := []gcImage{
+		{namespace: "default.a.dev", name: "docker.io/kindest/node:v1.22.9"},
+		{namespace: "default.a.dev", name: "docker.io/kindest/node:v1.24.0"},
+		{namespace: "default.b.dev", name: "docker.io/kindest/node:v1.24.0"},
+		{namespace: "default.b.dev", name: "registry.example.com/kindest/node:v1.24.0"},
+	}
+	markReferenced(images, []string{"kindest/node:v1.24.0", "not a reference"})
+
+	used := []bool{}
+	for _, image := range images {
+		used = append(used, image.used)
+	}
+	g.Expect(used).To(Equal([]bool{false, true, true, false}))
+}
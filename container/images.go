@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images/archive"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	refdocker "github.com/containerd/containerd/reference/docker"
+)
+
+// SaveContainerImage saves the image for the platform in the context, or the host platform, to the
+// file specified by dest.
+func (c *containerdRuntime) SaveContainerImage(ctx context.Context, image, dest string) error {
+	return c.SaveContainerImages(ctx, []string{image}, dest, false)
+}
+
+// SaveContainerImages saves the images to the file specified by dest. The archive is written to a
+// temporary file next to dest and renamed once complete, so dest never contains a partial export.
+func (c *containerdRuntime) SaveContainerImages(ctx context.Context, images []string, dest string, allPlatforms bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), fmt.Sprintf(".%s-*", filepath.Base(dest)))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %q: %v", dest, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // The file no longer exists after a successful rename.
+
+	if err := c.ExportContainerImages(ctx, images, tmp, allPlatforms); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync image data to disk: %v", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failed to move image data to %q: %v", dest, err)
+	}
+
+	return nil
+}
+
+// ExportContainerImages writes an OCI archive of the images to w, for the platform in the context
+// or the host platform unless allPlatforms is set.
+func (c *containerdRuntime) ExportContainerImages(ctx context.Context, images []string, w io.Writer, allPlatforms bool) error {
+	ctx = c.withNamespace(ctx)
+
+	exportOpts := []archive.ExportOpt{}
+	if allPlatforms {
+		exportOpts = append(exportOpts, archive.WithAllPlatforms())
+	} else {
+		platform, err := platformFrom(ctx)
+		if err != nil {
+			return err
+		}
+		exportOpts = append(exportOpts, archive.WithPlatform(platforms.Only(platform)))
+	}
+
+	imageStore := c.client.ImageService()
+	for _, image := range images {
+		ref, err := refdocker.ParseDockerRef(image)
+		if err != nil {
+			return fmt.Errorf("failed to parse image reference: %v", err)
+		}
+
+		if allPlatforms {
+			// Only the content for the host platform is fetched when pulling, make sure
+			// the content for the other platforms is available too.
+			if _, err := c.client.Fetch(ctx, ref.String(), containerd.WithPlatformMatcher(platforms.All), containerd.WithResolver(c.resolver(ctx))); err != nil {
+				return fmt.Errorf("failed to fetch content for all platforms of image %q: %v", ref.String(), err)
+			}
+		}
+
+		exportOpts = append(exportOpts, archive.WithImage(imageStore, ref.String()))
+	}
+
+	if err := c.client.Export(ctx, w, exportOpts...); err != nil {
+		return fmt.Errorf("failure writing image data: %v", err)
+	}
+
+	return nil
+}
+
+// importRuntimeImage imports the image for the platform from the namespace of the runtime into the
+// namespace of the context and unpacks it, e.g. a node image built with the nodeimage command, so that
+// the clusters can use the local images of the runtime without a registry. It returns false if the
+// namespace of the runtime has no such image.
+func (c *containerdRuntime) importRuntimeImage(ctx context.Context, ref string, platform platforms.MatchComparer) (bool, error) {
+	if namespace, _ := namespaces.Namespace(ctx); namespace == c.namespace {
+		return false, nil
+	}
+	runtimeCtx := namespaces.WithNamespace(ctx, c.namespace)
+	if _, err := c.client.ImageService().Get(runtimeCtx, ref); err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get image %q of namespace %q: %v", ref, c.namespace, err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.client.Export(runtimeCtx, pw,
+			archive.WithPlatform(platform),
+			archive.WithImage(c.client.ImageService(), ref),
+		))
+	}()
+	imported, err := c.client.Import(ctx, pr)
+	// Unblock the export if the import stopped reading.
+	pr.CloseWithError(err)
+	if err != nil {
+		return false, fmt.Errorf("failed to import image %q from namespace %q: %v", ref, c.namespace, err)
+	}
+	for _, img := range imported {
+		if err := c.ensureUnpacked(ctx, containerd.NewImageWithPlatform(c.client, img, platform)); err != nil {
+			return false, fmt.Errorf("error unpacking image: %v", err)
+		}
+	}
+	return true, nil
+}
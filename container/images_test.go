@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	"github.com/containerd/containerd/api/types"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"google.golang.org/grpc"
+)
+
+// imagesClient is an images service serving the images it holds, by name. The other operations are
+// not used by the exports.
+type imagesClient struct {
+	imagesapi.ImagesClient
+	images map[string]ocispec.Descriptor
+}
+
+func (c *imagesClient) Get(ctx context.Context, req *imagesapi.GetImageRequest, _ ...grpc.CallOption) (*imagesapi.GetImageResponse, error) {
+	target, ok := c.images[req.Name]
+	if !ok {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "image %q", req.Name)
+	}
+	return &imagesapi.GetImageResponse{Image: &imagesapi.Image{
+		Name:   req.Name,
+		Target: types.Descriptor{MediaType: target.MediaType, Digest: target.Digest, Size_: target.Size},
+	}}, nil
+}
+
+// writeBlob writes the JSON of v to the content store and returns its descriptor.
+func writeBlob(g *WithT, store content.Store, mediaType string, v interface{}) ocispec.Descriptor {
+	data, err := json.Marshal(v)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+	g.Expect(content.WriteBlob(context.Background(), store, desc.Digest.String(), bytes.NewReader(data), desc)).To(Succeed())
+	return desc
+}
+
+// writeImageManifest writes the manifest of an image for the platform, with a config and a layer,
+// to the content store and returns the descriptors of the manifest and its config and layer.
+func writeImageManifest(g *WithT, store content.Store, platform ocispec.Platform) []ocispec.Descriptor {
+	config := writeBlob(g, store, ocispec.MediaTypeImageConfig, ocispec.Image{Architecture: platform.Architecture, OS: platform.OS})
+	layer := writeBlob(g, store, ocispec.MediaTypeImageLayer, "layer of "+platform.Architecture)
+	manifest := writeBlob(g, store, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+	manifest.Platform = &platform
+	return []ocispec.Descriptor{manifest, config, layer}
+}
+
+// archiveBlobs returns the digests of the blobs of the OCI archive in file.
+func archiveBlobs(g *WithT, file string) []digest.Digest {
+	f, err := os.Open(file)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer f.Close()
+
+	blobs := []digest.Digest{}
+	r := tar.NewReader(f)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return blobs
+		}
+		g.Expect(err).ShouldNot(HaveOccurred())
+		if dir, encoded := filepath.Split(header.Name); dir == "blobs/sha256/" && encoded != "" {
+			blobs = append(blobs, digest.NewDigestFromEncoded(digest.SHA256, encoded))
+		}
+	}
+}
+
+func TestSaveContainerImages(t *testing.T) {
+	g := NewWithT(t)
+
+	store, err := local.NewStore(t.TempDir())
+	g.Expect(err).ShouldNot(HaveOccurred())
+	amd64 := writeImageManifest(g, store, ocispec.Platform{OS: "linux", Architecture: "amd64"})
+	arm64 := writeImageManifest(g, store, ocispec.Platform{OS: "linux", Architecture: "arm64"})
+	index := writeBlob(g, store, ocispec.MediaTypeImageIndex, ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{amd64[0], arm64[0]},
+	})
+
+	client, err := containerd.New("", containerd.WithServices(
+		containerd.WithContentStore(store),
+		containerd.WithImageService(&imagesClient{images: map[string]ocispec.Descriptor{"docker.io/kindest/node:v1.23.6": index}}),
+	))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	c := &containerdRuntime{client: client, namespace: "default"}
+	ctx := PlatformInto(context.Background(), "linux/arm64")
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "images.tar")
+
+	// Only the blobs of the platform are saved.
+	g.Expect(c.SaveContainerImages(ctx, []string{"kindest/node:v1.23.6"}, dest, false)).To(Succeed())
+	blobs := archiveBlobs(g, dest)
+	g.Expect(blobs).To(ContainElements(index.Digest, arm64[0].Digest, arm64[1].Digest, arm64[2].Digest))
+	for _, desc := range amd64 {
+		g.Expect(blobs).NotTo(ContainElement(desc.Digest))
+	}
+
+	// A failed export leaves the archive saved previously, and no temporary file.
+	saved, err := os.ReadFile(dest)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = c.SaveContainerImages(ctx, []string{"kindest/node:v1.24.0"}, dest, false)
+	g.Expect(err).To(MatchError(ContainSubstring("failure writing image data")))
+	g.Expect(os.ReadFile(dest)).To(Equal(saved))
+	entries, err := os.ReadDir(dir)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(1))
+
+	// The references are validated before anything is written.
+	err = c.SaveContainerImages(ctx, []string{"Kindest/Node"}, filepath.Join(dir, "invalid.tar"), false)
+	g.Expect(err).To(MatchError(ContainSubstring("failed to parse image reference")))
+	g.Expect(filepath.Join(dir, "invalid.tar")).NotTo(BeAnExistingFile())
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/contrib/seccomp"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/pkg/cap"
+)
+
+// isolationKey is the key type for accessing the isolation profile in passed contexts.
+type isolationKey struct{}
+
+// IsolationMode is how much of the host privileges a container gets.
+type IsolationMode string
+
+const (
+	// PrivilegedIsolation runs the container with all the capabilities and host devices, like docker
+	// --privileged does for kind nodes.
+	PrivilegedIsolation IsolationMode = "Privileged"
+	// BaselineIsolation runs the container with the default capabilities of containerd, and the ones
+	// the kubelet and containerd of a node need, without the host devices and with the default
+	// masked and read-only paths.
+	BaselineIsolation IsolationMode = "Baseline"
+	// CustomIsolation runs the container with the capabilities of the profile only, without the host
+	// devices.
+	CustomIsolation IsolationMode = "Custom"
+)
+
+const (
+	// SeccompUnconfined runs the container without a seccomp profile.
+	SeccompUnconfined = "Unconfined"
+	// SeccompRuntimeDefault runs the container with the default seccomp profile of containerd.
+	SeccompRuntimeDefault = "RuntimeDefault"
+)
+
+// baselineCapabilities are the capabilities of the containerd default spec, with the ones a node needs
+// to mount filesystems, manage cgroups and program the network of its pods.
+var baselineCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+	"CAP_SYS_ADMIN",
+	"CAP_NET_ADMIN",
+	"CAP_SYS_RESOURCE",
+}
+
+// IsolationProfile restricts the privileges of a container. The processes exec'd in the container
+// get at most the capabilities of the container, whatever their exec privileges.
+type IsolationProfile struct {
+	// Mode is how much of the host privileges the container gets, Privileged if empty.
+	Mode IsolationMode
+	// Capabilities are the capabilities of Custom containers, or the ones added to the baseline
+	// capabilities of Baseline containers, with or without the "CAP_" prefix.
+	Capabilities []string
+	// SeccompProfile is Unconfined, RuntimeDefault or the path of a seccomp profile file of the
+	// controller host. Privileged containers are unconfined and the others use the runtime default
+	// if empty.
+	SeccompProfile string
+	// AppArmorProfile is the name of an AppArmor profile loaded on the host the container runs on,
+	// the container is unconfined if empty.
+	AppArmorProfile string
+}
+
+// IsolationProfileInto is used to store the isolation profile of the containers run with a context.
+func IsolationProfileInto(ctx context.Context, profile IsolationProfile) context.Context {
+	return context.WithValue(ctx, isolationKey{}, profile)
+}
+
+// isolationProfileFrom returns the isolation profile stored in the context, privileged if none.
+func isolationProfileFrom(ctx context.Context) IsolationProfile {
+	if profile, ok := ctx.Value(isolationKey{}).(IsolationProfile); ok {
+		return profile
+	}
+	return IsolationProfile{}
+}
+
+// privileged returns whether the profile runs containers privileged, without a seccomp or AppArmor
+// profile.
+func (p IsolationProfile) privileged() bool {
+	return (p.Mode == "" || p.Mode == PrivilegedIsolation) && p.SeccompProfile == "" && p.AppArmorProfile == ""
+}
+
+// capabilities returns the capabilities of the containers of a non privileged profile.
+func (p IsolationProfile) capabilities() ([]string, error) {
+	known := map[string]bool{}
+	for _, c := range cap.Known() {
+		known[c] = true
+	}
+
+	var caps []string
+	if p.Mode == BaselineIsolation {
+		caps = append(caps, baselineCapabilities...)
+	}
+	for _, c := range p.Capabilities {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if !strings.HasPrefix(c, "CAP_") {
+			c = "CAP_" + c
+		}
+		if !known[c] {
+			return nil, fmt.Errorf("unknown capability %q", c)
+		}
+		caps = append(caps, c)
+	}
+	return caps, nil
+}
+
+// validate returns an error if the mode is unknown, or if the capabilities are set on privileged
+// containers or unknown.
+func (p IsolationProfile) validate() error {
+	switch p.Mode {
+	case "", PrivilegedIsolation:
+		if len(p.Capabilities) > 0 {
+			return fmt.Errorf("capabilities cannot be set on privileged containers")
+		}
+	case BaselineIsolation, CustomIsolation:
+		if _, err := p.capabilities(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown isolation mode %q", p.Mode)
+	}
+	return nil
+}
+
+// specOpts returns the options setting the capabilities, devices, seccomp and AppArmor profiles of
+// the OCI spec.
+func (p IsolationProfile) specOpts() ([]oci.SpecOpts, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	var opts []oci.SpecOpts
+	seccompProfile := p.SeccompProfile
+	if p.Mode == "" || p.Mode == PrivilegedIsolation {
+		// Running containers in a container requires privileges.
+		// This mirrors what docker --privileged does for kind nodes: all capabilities,
+		// all devices, and writable sysfs and cgroupfs.
+		opts = append(opts, oci.WithPrivileged, oci.WithAllDevicesAllowed, oci.WithHostDevices)
+		if seccompProfile == "" {
+			seccompProfile = SeccompUnconfined
+		}
+	} else {
+		caps, err := p.capabilities()
+		if err != nil {
+			return nil, err
+		}
+		// The node manages the cgroups of its pods within the cgroup of the container.
+		opts = append(opts, oci.WithCapabilities(caps), oci.WithWriteableCgroupfs)
+		if seccompProfile == "" {
+			seccompProfile = SeccompRuntimeDefault
+		}
+	}
+
+	// The default seccomp profile allows the syscalls of the capabilities, it is set after them.
+	switch seccompProfile {
+	case SeccompUnconfined:
+		opts = append(opts, oci.WithSeccompUnconfined)
+	case SeccompRuntimeDefault:
+		opts = append(opts, seccomp.WithDefaultProfile())
+	default:
+		opts = append(opts, seccomp.WithProfile(seccompProfile))
+	}
+	if p.AppArmorProfile != "" {
+		opts = append(opts, oci.WithApparmorProfile(p.AppArmorProfile))
+	}
+	return opts, nil
+}
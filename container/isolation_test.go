@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestIsolationProfileSpecOpts(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     IsolationProfile
+		wantErr     bool
+		wantCaps    []string
+		wantSeccomp bool
+	}{
+		{
+			name:        "custom",
+			profile:     IsolationProfile{Mode: CustomIsolation, Capabilities: []string{"sys_admin", "CAP_NET_ADMIN"}},
+			wantCaps:    []string{"CAP_SYS_ADMIN", "CAP_NET_ADMIN"},
+			wantSeccomp: true,
+		},
+		{
+			name:        "custom unconfined",
+			profile:     IsolationProfile{Mode: CustomIsolation, Capabilities: []string{"SYS_ADMIN"}, SeccompProfile: SeccompUnconfined},
+			wantCaps:    []string{"CAP_SYS_ADMIN"},
+			wantSeccomp: false,
+		},
+		{
+			name:    "unknown capability",
+			profile: IsolationProfile{Mode: CustomIsolation, Capabilities: []string{"CAP_FLY"}},
+			wantErr: true,
+		},
+		{
+			name:    "privileged with capabilities",
+			profile: IsolationProfile{Capabilities: []string{"CAP_SYS_ADMIN"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			profile: IsolationProfile{Mode: "Restricted"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			opts, err := tt.profile.specOpts()
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			s := &oci.Spec{Process: &specs.Process{}, Linux: &specs.Linux{}}
+			for _, opt := range opts {
+				g.Expect(opt(context.Background(), nil, nil, s)).To(Succeed())
+			}
+			g.Expect(s.Process.Capabilities.Bounding).To(ConsistOf(tt.wantCaps))
+			g.Expect(s.Linux.Seccomp != nil).To(Equal(tt.wantSeccomp))
+		})
+	}
+}
+
+func TestIsolationProfileBaseline(t *testing.T) {
+	g := NewWithT(t)
+
+	opts, err := IsolationProfile{Mode: BaselineIsolation, Capabilities: []string{"SYS_PTRACE"}, AppArmorProfile: "capc-node"}.specOpts()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	s := &oci.Spec{Process: &specs.Process{}, Linux: &specs.Linux{}}
+	for _, opt := range opts {
+		g.Expect(opt(context.Background(), nil, nil, s)).To(Succeed())
+	}
+	g.Expect(s.Process.Capabilities.Bounding).To(ContainElements("CAP_CHOWN", "CAP_SYS_ADMIN", "CAP_SYS_PTRACE"))
+	g.Expect(s.Process.Capabilities.Bounding).ToNot(ContainElement("CAP_SYS_MODULE"))
+	g.Expect(s.Process.ApparmorProfile).To(Equal("capc-node"))
+	g.Expect(IsolationProfile{}.privileged()).To(BeTrue())
+	g.Expect(IsolationProfile{Mode: PrivilegedIsolation, AppArmorProfile: "capc-node"}.privileged()).To(BeFalse())
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/go-logr/logr"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultKillGracePeriod is how long a container has to exit after a stop signal before it is killed.
+	DefaultKillGracePeriod = 10 * time.Second
+
+	// sigRTMin and sigRTMax are the real-time signals range as seen by applications, the first ones
+	// are reserved by the C library.
+	sigRTMin = 34
+	sigRTMax = 64
+)
+
+// stopSignals are the signals asking a container to exit, it is killed if it does not exit within the
+// grace period. SIGRTMIN+3 stops systemd, which runs as the init of node containers.
+var stopSignals = map[syscall.Signal]bool{
+	unix.SIGTERM: true,
+	unix.SIGINT:  true,
+	unix.SIGQUIT: true,
+	sigRTMin + 3: true,
+}
+
+// ParseSignal parses a signal name, with or without the "SIG" prefix and in any case, e.g. "SIGTERM"
+// or "hup", a real-time signal relative to SIGRTMIN or SIGRTMAX, e.g. "SIGRTMIN+3", or a signal number.
+func ParseSignal(value string) (syscall.Signal, error) {
+	name := strings.ToUpper(strings.TrimSpace(value))
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 1 || n > sigRTMax {
+			return 0, fmt.Errorf("invalid signal number %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+
+	name = strings.TrimPrefix(name, "SIG")
+	for prefix, base := range map[string]int{"RTMIN": sigRTMin, "RTMAX": sigRTMax} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		offset := 0
+		if rest := strings.TrimPrefix(name, prefix); rest != "" {
+			var err error
+			if offset, err = strconv.Atoi(rest); err != nil {
+				return 0, fmt.Errorf("invalid signal %q", value)
+			}
+		}
+		if n := base + offset; n >= sigRTMin && n <= sigRTMax {
+			return syscall.Signal(n), nil
+		}
+		return 0, fmt.Errorf("invalid signal %q", value)
+	}
+
+	if sig := unix.SignalNum("SIG" + name); sig != 0 {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal %q", value)
+}
+
+// WithKillGracePeriod sets how long a container has to exit after a stop signal before it is killed.
+func WithKillGracePeriod(gracePeriod time.Duration) Option {
+	return func(c *containerdRuntime) {
+		c.killGracePeriod = gracePeriod
+	}
+}
+
+// KillContainer sends the signal, a name or a number, to the task of a running container. For stop
+// signals, like SIGTERM, it waits for the container to exit and kills it with SIGKILL if it does not
+// exit within the grace period of the runtime or before the context is done. A container stopped by
+// a stop signal or SIGKILL is not restarted by MonitorRestarts.
+func (c *containerdRuntime) KillContainer(ctx context.Context, containerName, signal string) error {
+	sig, err := ParseSignal(signal)
+	if err != nil {
+		return err
+	}
+
+	ctx = c.withNamespace(ctx)
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+	task, err := cntr.Task(ctx, nil)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return fmt.Errorf("container %q is not running", containerName)
+		}
+		return fmt.Errorf("failed to get task of container %q: %v", containerName, err)
+	}
+
+	if stopSignals[sig] || sig == unix.SIGKILL {
+		// The container is marked before it exits, so that the restart monitor does not see it exited.
+		if _, err := cntr.SetLabels(ctx, map[string]string{stoppedLabel: "true"}); err != nil {
+			return fmt.Errorf("failed to mark container %q stopped: %v", containerName, err)
+		}
+	}
+	if !stopSignals[sig] {
+		if err := task.Kill(ctx, sig); err != nil {
+			return fmt.Errorf("failed to send %v to container %q: %v", unix.SignalName(sig), containerName, err)
+		}
+		return nil
+	}
+	return c.stopTask(ctx, containerName, task, sig)
+}
+
+// stopTask sends the stop signal to the task of the container and waits for it to exit, killing it
+// with SIGKILL if it does not exit within the grace period of the runtime or before the context is done.
+func (c *containerdRuntime) stopTask(ctx context.Context, containerName string, task containerd.Task, sig syscall.Signal) error {
+	// The task must be killed with SIGKILL after the context is done.
+	bgCtx := namespaces.WithNamespace(context.Background(), c.namespaceFrom(ctx))
+
+	// Wait must be set up before signaling the task so the exit status is not missed.
+	statusC, err := task.Wait(bgCtx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for task of container %q: %v", containerName, err)
+	}
+
+	if err := task.Kill(ctx, sig); err != nil {
+		return fmt.Errorf("failed to send %v to container %q: %v", unix.SignalName(sig), containerName, err)
+	}
+
+	select {
+	case <-statusC:
+		return nil
+	case <-time.After(c.killGracePeriod):
+	case <-ctx.Done():
+	}
+
+	logr.FromContextOrDiscard(ctx).V(2).Info("Container did not exit after stop signal, killing it",
+		"container", containerName, "signal", sig, "gracePeriod", c.killGracePeriod)
+	if err := killProcess(bgCtx, task, statusC); err != nil {
+		return fmt.Errorf("failed to kill container %q: %v", containerName, err)
+	}
+	return nil
+}
+
+// stopSignal returns the signal stopping the container, the stop signal of its image or else SIGTERM.
+func stopSignal(labels map[string]string) syscall.Signal {
+	if signal, ok := labels[containerd.StopSignalLabel]; ok {
+		if sig, err := ParseSignal(signal); err == nil {
+			return sig
+		}
+	}
+	return unix.SIGTERM
+}
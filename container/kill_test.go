@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/containerd/containerd"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{value: "SIGTERM", want: syscall.SIGTERM},
+		{value: "HUP", want: syscall.SIGHUP},
+		{value: "sigkill", want: syscall.SIGKILL},
+		{value: "15", want: syscall.SIGTERM},
+		{value: "SIGRTMIN+3", want: syscall.Signal(37)},
+		{value: "RTMAX-1", want: syscall.Signal(63)},
+		{value: "RTMAX+1", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "65", wantErr: true},
+		{value: "SIGFOO", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			g := NewWithT(t)
+
+			sig, err := ParseSignal(tt.value)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(sig).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestStopSignal(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(stopSignal(map[string]string{containerd.StopSignalLabel: "SIGRTMIN+3"})).To(Equal(syscall.Signal(37)))
+	g.Expect(stopSignal(map[string]string{containerd.StopSignalLabel: "SIGFOO"})).To(Equal(syscall.SIGTERM))
+	g.Expect(stopSignal(nil)).To(Equal(syscall.SIGTERM))
+}
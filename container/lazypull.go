@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/labels"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// stargzSnapshotter is the name of the stargz remote snapshotter plugin.
+	stargzSnapshotter = "stargz"
+
+	// The labels below are the ones set by the containerd CRI plugin when pulling images, they are
+	// passed to the snapshotter so that remote snapshotters like stargz can fetch layer content
+	// lazily from the registry instead of waiting for the full layer downloads.
+
+	// targetRefLabel contains the image reference.
+	targetRefLabel = "containerd.io/snapshot/cri.image-ref"
+	// targetManifestDigestLabel contains the manifest digest.
+	targetManifestDigestLabel = "containerd.io/snapshot/cri.manifest-digest"
+	// targetLayerDigestLabel contains the layer digest.
+	targetLayerDigestLabel = "containerd.io/snapshot/cri.layer-digest"
+	// targetImageLayersLabel contains the digests of the layers of the image, starting with
+	// the current one, so that the snapshotter can prepare them in parallel.
+	targetImageLayersLabel = "containerd.io/snapshot/cri.image-layers"
+)
+
+// WithLazyPull enables lazy image pulling: images are unpacked with the stargz snapshotter, unless
+// a snapshotter is set in the context, and annotated so that eStargz layers are mounted from the
+// registry and fetched on demand. containerd must be configured with the stargz snapshotter plugin.
+func WithLazyPull() Option {
+	return func(c *containerdRuntime) {
+		c.lazyPull = true
+	}
+}
+
+// appendInfoHandlerWrapper returns an image handler wrapper annotating the layers of the image
+// manifests with the information remote snapshotters need to fetch them.
+func appendInfoHandlerWrapper(ref string) func(images.Handler) images.Handler {
+	return func(f images.Handler) images.Handler {
+		return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+			children, err := f.Handle(ctx, desc)
+			if err != nil {
+				return nil, err
+			}
+			switch desc.MediaType {
+			case ocispec.MediaTypeImageManifest, images.MediaTypeDockerSchema2Manifest:
+				for i := range children {
+					c := &children[i]
+					if !images.IsLayerType(c.MediaType) {
+						continue
+					}
+					if c.Annotations == nil {
+						c.Annotations = map[string]string{}
+					}
+					c.Annotations[targetRefLabel] = ref
+					c.Annotations[targetLayerDigestLabel] = c.Digest.String()
+					c.Annotations[targetImageLayersLabel] = layerDigests(targetImageLayersLabel, children[i:])
+					c.Annotations[targetManifestDigestLabel] = desc.Digest.String()
+				}
+			}
+			return children, nil
+		})
+	}
+}
+
+// layerDigests returns the comma-separated digests of the given layers, truncated so that the
+// value fits into a label. Skipping layers only affects performance.
+func layerDigests(key string, descs []ocispec.Descriptor) string {
+	layers := ""
+	for _, l := range descs {
+		if !images.IsLayerType(l.MediaType) {
+			continue
+		}
+		item := l.Digest.String()
+		if layers != "" {
+			item = "," + item
+		}
+		if err := labels.Validate(key, layers+item); err != nil {
+			break
+		}
+		layers += item
+	}
+	return layers
+}
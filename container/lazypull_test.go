@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/images"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestAppendInfoHandlerWrapper(t *testing.T) {
+	g := NewWithT(t)
+
+	config := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: digest.FromString("config")}
+	layer1 := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("layer1")}
+	layer2 := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("layer2")}
+	manifest := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("manifest")}
+
+	handler := appendInfoHandlerWrapper("docker.io/kindest/node:v1.23.6")(images.HandlerFunc(
+		func(_ context.Context, _ ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+			return []ocispec.Descriptor{config, layer1, layer2}, nil
+		}))
+
+	children, err := handler.Handle(context.Background(), manifest)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(children).To(HaveLen(3))
+
+	g.Expect(children[0].Annotations).To(BeEmpty())
+	g.Expect(children[1].Annotations).To(Equal(map[string]string{
+		targetRefLabel:            "docker.io/kindest/node:v1.23.6",
+		targetLayerDigestLabel:    layer1.Digest.String(),
+		targetImageLayersLabel:    layer1.Digest.String() + "," + layer2.Digest.String(),
+		targetManifestDigestLabel: manifest.Digest.String(),
+	}))
+	g.Expect(children[2].Annotations).To(HaveKeyWithValue(targetImageLayersLabel, layer2.Digest.String()))
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/leases"
+	"github.com/containerd/containerd/namespaces"
+)
+
+const (
+	// leaseExpiration bounds how long the resources of an operation are protected from garbage
+	// collection if its lease could not be released, e.g. because the controller crashed.
+	leaseExpiration = time.Hour
+
+	// leaseOwnerLabel records which operation a lease was created for, for debugging.
+	leaseOwnerLabel = "io.x-k8s.capc.lease.owner"
+)
+
+// withLease attaches a lease to the context so that the content, images and snapshots created
+// with it are not garbage collected by containerd until release is called. If the context
+// already holds a lease, it is reused and release does nothing.
+func (c *containerdRuntime) withLease(ctx context.Context, owner string) (_ context.Context, release func(), _ error) {
+	namespace := c.namespaceFrom(ctx)
+	ctx, done, err := c.client.WithLease(ctx,
+		leases.WithRandomID(),
+		leases.WithExpiration(leaseExpiration),
+		leases.WithLabels(map[string]string{leaseOwnerLabel: owner}),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create lease: %v", err)
+	}
+
+	return ctx, func() {
+		// Release even if the operation context has been cancelled, the lease would otherwise
+		// only go away once it expires.
+		_ = done(namespaces.WithNamespace(context.Background(), namespace))
+	}, nil
+}
+
+// releaseLeases deletes the leases of the operations of the owner that were not released, e.g. because
+// the controller crashed while creating a container, so that their resources can be garbage collected.
+func (c *containerdRuntime) releaseLeases(ctx context.Context, owner string) error {
+	manager := c.client.LeasesService()
+	owned, err := manager.List(ctx, fmt.Sprintf("labels.%q==%q", leaseOwnerLabel, owner))
+	if err != nil {
+		return err
+	}
+	for _, lease := range owned {
+		if err := manager.Delete(ctx, lease); err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/runtime/v2/logging"
+)
+
+const (
+	// logDriverFlag is passed to the provider binary when the containerd shim runs it as the logging
+	// binary of a task, its value is the log format.
+	logDriverFlag = "--log-driver"
+	// logPathFlag is the path of the container log the logging binary writes to.
+	logPathFlag = "--log-path"
+	// logMaxSizeFlag is the size in bytes above which the container log is rotated.
+	logMaxSizeFlag = "--log-max-size"
+	// logMaxFilesFlag is the number of container log files kept, including the current one.
+	logMaxFilesFlag = "--log-max-files"
+	// logCompressFlag compresses the rotated container log files.
+	logCompressFlag = "--log-compress"
+	// jsonFileLogDriver writes each line of output as a JSON object, like the docker json-file driver.
+	jsonFileLogDriver = "json-file"
+	// maxLogLineSize is the size above which a line of output is split across log entries.
+	maxLogLineSize = 16 * 1024
+)
+
+// Log streams of the task output.
+const (
+	stdoutStream = "stdout"
+	stderrStream = "stderr"
+)
+
+// logEntry is a line of task output in the container log.
+type logEntry struct {
+	// Log is the output, including the trailing newline unless the line was split.
+	Log string `json:"log"`
+	// Stream is the stream the output was written to, stdout or stderr.
+	Stream string `json:"stream"`
+	// Time is when the output was read from the task.
+	Time time.Time `json:"time"`
+}
+
+// WithLogDriver makes the shims of the tasks run the given binary, which must be the provider binary,
+// as their logging binary, so that the output of the containers is logged with timestamps.
+// Without it the shims write the output as is, and it cannot be filtered by time.
+func WithLogDriver(binary string) Option {
+	return func(c *containerdRuntime) {
+		c.logDriver = binary
+	}
+}
+
+// IsLogDriverCommand returns whether the provider binary is run by a containerd shim as the logging
+// binary of a task, with the given arguments, rather than as the controller manager.
+func IsLogDriverCommand(args []string) bool {
+	for _, arg := range args {
+		if arg == logDriverFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// RunLogDriver logs the output of a task, following the containerd logging binary protocol, until
+// the task exits. It exits the process.
+func RunLogDriver(args []string) {
+	fs := flag.NewFlagSet("log-driver", flag.ExitOnError)
+	driver := fs.String(logDriverFlag[2:], jsonFileLogDriver, "The format of the container log.")
+	path := fs.String(logPathFlag[2:], "", "The path of the container log.")
+	logConfig := LogConfig{}
+	fs.Int64Var(&logConfig.MaxSize, logMaxSizeFlag[2:], 0, "The size in bytes above which the container log is rotated, 0 to never rotate it.")
+	fs.IntVar(&logConfig.MaxFiles, logMaxFilesFlag[2:], 1, "The number of container log files kept, including the current one.")
+	fs.BoolVar(&logConfig.Compress, logCompressFlag[2:], false, "Compress the rotated container log files.")
+	_ = fs.Parse(args)
+
+	logging.Run(func(ctx context.Context, config *logging.Config, ready func() error) error {
+		if *driver != jsonFileLogDriver {
+			return fmt.Errorf("unsupported log driver %q", *driver)
+		}
+		return runJSONFileLogger(ctx, config, ready, *path, logConfig)
+	})
+}
+
+// runJSONFileLogger appends the output of the task to the log at path, rotating it according to the
+// log configuration, until both output streams are closed or the context is cancelled.
+func runJSONFileLogger(ctx context.Context, config *logging.Config, ready func() error, path string, logConfig LogConfig) error {
+	f, err := openRotatingFile(path, logConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open container log: %v", err)
+	}
+	defer f.Close()
+
+	if err := ready(); err != nil {
+		return fmt.Errorf("failed to signal log driver readiness: %v", err)
+	}
+
+	w := &jsonLogWriter{w: f}
+	errCh := make(chan error, 2)
+	go func() { errCh <- copyLogStream(w, stdoutStream, config.Stdout) }()
+	go func() { errCh <- copyLogStream(w, stderrStream, config.Stderr) }()
+
+	var errs []error
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// jsonLogWriter writes log entries as JSON lines, it is shared by the copies of both streams.
+type jsonLogWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *jsonLogWriter) write(stream string, line []byte) error {
+	data, err := json.Marshal(logEntry{Log: string(line), Stream: stream, Time: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(data, '\n'))
+	return err
+}
+
+// copyLogStream logs each line read from r, splitting the lines longer than maxLogLineSize, until r
+// is closed.
+func copyLogStream(w *jsonLogWriter, stream string, r io.Reader) error {
+	br := bufio.NewReaderSize(r, maxLogLineSize)
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			if err := w.write(stream, line); err != nil {
+				return fmt.Errorf("failed to write %s to container log: %v", stream, err)
+			}
+		}
+		switch {
+		case err == nil, errors.Is(err, bufio.ErrBufferFull):
+		case errors.Is(err, io.EOF), errors.Is(err, os.ErrClosed):
+			return nil
+		default:
+			return fmt.Errorf("failed to read %s: %v", stream, err)
+		}
+	}
+}
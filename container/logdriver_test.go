@@ -0,0 +1,47 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCopyLogStream(t *testing.T) {
+	g := NewWithT(t)
+
+	log := &bytes.Buffer{}
+	long := strings.Repeat("x", maxLogLineSize+10)
+	g.Expect(copyLogStream(&jsonLogWriter{w: log}, stderrStream, strings.NewReader("one\n"+long+"\nlast"))).To(Succeed())
+
+	entries, err := newLogReader(log).tailInto(nil, 0, time.Time{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(4))
+	g.Expect(entries[0].Log).To(Equal("one\n"))
+	g.Expect(entries[0].Stream).To(Equal(stderrStream))
+	g.Expect(entries[0].Time).ToNot(BeZero())
+	g.Expect(entries[1].Log + entries[2].Log).To(Equal(long + "\n"))
+	g.Expect(entries[3].Log).To(Equal("last"))
+}
+
+func TestIsLogDriverCommand(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(IsLogDriverCommand([]string{logPathFlag, "/var/log/c.log", logDriverFlag, jsonFileLogDriver})).To(BeTrue())
+	g.Expect(IsLogDriverCommand([]string{"--leader-elect"})).To(BeFalse())
+}
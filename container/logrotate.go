@@ -0,0 +1,280 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// logConfigLabel is the container label holding the log configuration of a container, so that the
+	// tasks created by the restart monitor log the same way.
+	logConfigLabel = "io.x-k8s.capc.log-config"
+	// compressedLogSuffix is the suffix of the compressed rotated log files.
+	compressedLogSuffix = ".gz"
+)
+
+// logConfigKey is the key type for accessing the log configuration in passed contexts.
+type logConfigKey struct{}
+
+// LogConfig configures the rotation of a container log by the log driver, which keeps the current
+// log file at <state dir>/logs/<container>.log and the rotated ones next to it, numbered from the
+// most recent: <container>.log.1, <container>.log.2, ...
+type LogConfig struct {
+	// MaxSize is the size in bytes above which the log is rotated, 0 to never rotate it.
+	MaxSize int64 `json:"maxSize,omitempty"`
+	// MaxFiles is the number of log files kept, including the current one. The current file is
+	// truncated on rotation if it is 1 or less.
+	MaxFiles int `json:"maxFiles,omitempty"`
+	// Compress compresses the rotated log files with gzip.
+	Compress bool `json:"compress,omitempty"`
+}
+
+// WithLogConfig sets the log configuration of the containers when the context does not set one.
+func WithLogConfig(config LogConfig) Option {
+	return func(c *containerdRuntime) {
+		c.logConfig = config
+	}
+}
+
+// LogConfigInto is used to store the log configuration of the containers run with a context.
+func LogConfigInto(ctx context.Context, config LogConfig) context.Context {
+	return context.WithValue(ctx, logConfigKey{}, config)
+}
+
+// logConfigFrom returns the log configuration stored in the context, or the runtime default.
+func (c *containerdRuntime) logConfigFrom(ctx context.Context) LogConfig {
+	if config, ok := ctx.Value(logConfigKey{}).(LogConfig); ok {
+		return config
+	}
+	return c.logConfig
+}
+
+// logConfigFromLabels returns the log configuration stored in the container labels, or the runtime
+// default for containers created without one.
+func (c *containerdRuntime) logConfigFromLabels(labels map[string]string) (LogConfig, error) {
+	data, ok := labels[logConfigLabel]
+	if !ok {
+		return c.logConfig, nil
+	}
+	var config LogConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return LogConfig{}, fmt.Errorf("failed to parse log configuration label: %v", err)
+	}
+	return config, nil
+}
+
+// label returns the value of the log configuration label.
+func (l LogConfig) label() (string, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal log configuration: %v", err)
+	}
+	return string(data), nil
+}
+
+// args returns the log driver arguments of the configuration.
+func (l LogConfig) args() map[string]string {
+	return map[string]string{
+		logMaxSizeFlag:  strconv.FormatInt(l.MaxSize, 10),
+		logMaxFilesFlag: strconv.Itoa(l.MaxFiles),
+		logCompressFlag: strconv.FormatBool(l.Compress),
+	}
+}
+
+// rotatingFile is a log file rotated when it would grow above the maximum size.
+type rotatingFile struct {
+	path   string
+	config LogConfig
+	f      *os.File
+	size   int64
+}
+
+// openRotatingFile opens the log file at path for appending.
+func openRotatingFile(path string, config LogConfig) (*rotatingFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, config: config, f: f, size: fi.Size()}, nil
+}
+
+// Write writes p to the log file, rotating it first if p does not fit. Writes are not split across
+// files, so that a log entry is never split.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.config.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.config.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate container log: %v", err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
+
+// rotate shifts the rotated log files, dropping the oldest one, moves the current file to
+// <path>.1, compressing it if configured, and starts a new current file. With a single file,
+// the current file is truncated.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	if r.config.MaxFiles > 1 {
+		for _, suffix := range []string{"", compressedLogSuffix} {
+			if err := removeIfExists(rotatedLogPath(r.path, r.config.MaxFiles-1) + suffix); err != nil {
+				return err
+			}
+		}
+		for i := r.config.MaxFiles - 1; i > 1; i-- {
+			for _, suffix := range []string{"", compressedLogSuffix} {
+				if err := renameIfExists(rotatedLogPath(r.path, i-1)+suffix, rotatedLogPath(r.path, i)+suffix); err != nil {
+					return err
+				}
+			}
+		}
+		if err := os.Rename(r.path, rotatedLogPath(r.path, 1)); err != nil {
+			return err
+		}
+		if r.config.Compress {
+			if err := compressFile(rotatedLogPath(r.path, 1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	r.f, r.size = f, 0
+	return nil
+}
+
+// rotatedLogPath returns the path of the i-th most recent rotated log file, without compression suffix.
+func rotatedLogPath(path string, i int) string {
+	return path + "." + strconv.Itoa(i)
+}
+
+// compressFile replaces the file at path with its gzip compressed copy at <path>.gz. The copy is
+// written to a temporary file first, so that readers never see a partial copy.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + compressedLogSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path+compressedLogSuffix); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// rotatedLogFiles returns the rotated log files of the log at path, oldest first.
+func rotatedLogFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	indexes := map[string]int{}
+	files := []string{}
+	for _, match := range matches {
+		i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(match, path+"."), compressedLogSuffix))
+		if err != nil || i < 1 {
+			continue
+		}
+		indexes[match] = i
+		files = append(files, match)
+	}
+	sort.Slice(files, func(a, b int) bool { return indexes[files[a]] > indexes[files[b]] })
+	return files, nil
+}
+
+// openLogFile opens a log file for reading, decompressing it if it is compressed.
+func openLogFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, compressedLogSuffix) {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: zr, f: f}, nil
+}
+
+// gzipFile closes both the gzip reader and its file.
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	_ = g.Reader.Close()
+	return g.f.Close()
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func renameIfExists(from, to string) error {
+	if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRotatingFile(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &containerdRuntime{stateDir: t.TempDir()}
+	g.Expect(os.MkdirAll(c.logsDir(), 0o750)).To(Succeed())
+	path := c.logPath("machine")
+
+	f, err := openRotatingFile(path, LogConfig{MaxSize: 100, MaxFiles: 3, Compress: true})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	w := &jsonLogWriter{w: f}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		g.Expect(w.write(stdoutStream, []byte(line))).To(Succeed())
+	}
+	g.Expect(f.Close()).To(Succeed())
+
+	// Each entry is above half the maximum size, so each one is in its own file and the oldest
+	// one is dropped.
+	rotated, err := rotatedLogFiles(path)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(rotated).To(Equal([]string{path + ".2.gz", path + ".1.gz"}))
+
+	entries, current, _, err := c.readLog("machine", 0, time.Time{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	current.Close()
+	logs := []string{}
+	for _, entry := range entries {
+		logs = append(logs, entry.Log)
+	}
+	g.Expect(logs).To(Equal([]string{"two\n", "three\n", "four\n"}))
+
+	entries, current, _, err = c.readLog("machine", 2, time.Time{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	current.Close()
+	g.Expect(entries).To(HaveLen(2))
+	g.Expect(entries[0].Log).To(Equal("three\n"))
+
+	g.Expect(c.removeLogs("machine")).To(Succeed())
+	remaining, err := filepath.Glob(filepath.Join(c.logsDir(), "*"))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(remaining).To(BeEmpty())
+}
+
+func TestRotatingFileTruncatesSingleFile(t *testing.T) {
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "machine.log")
+	f, err := openRotatingFile(path, LogConfig{MaxSize: 10, MaxFiles: 1})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = f.Write([]byte("0123456789\n"))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = f.Write([]byte("last\n"))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(f.Close()).To(Succeed())
+
+	data, err := os.ReadFile(path)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal("last\n"))
+	rotated, err := rotatedLogFiles(path)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(rotated).To(BeEmpty())
+}
+
+func TestOpenLogFileDecompresses(t *testing.T) {
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "machine.log.1")
+	g.Expect(os.WriteFile(path, []byte("output\n"), 0o600)).To(Succeed())
+	g.Expect(compressFile(path)).To(Succeed())
+	_, err := os.Stat(path)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+
+	f, err := openLogFile(path + compressedLogSuffix)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal("output\n"))
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+)
+
+// logFollowInterval is how often a followed container log is checked for new output.
+const logFollowInterval = 250 * time.Millisecond
+
+// LogsOptions selects the output of a container returned by ContainerLogs.
+type LogsOptions struct {
+	// Follow keeps streaming the output written after the current end of the log, until the
+	// container stops or the context is done.
+	Follow bool
+	// Tail is the number of lines from the end of the log to return, all of them if zero or less.
+	Tail int
+	// Since only returns the output written at or after this time, if set.
+	Since time.Time
+	// Timestamps prefixes each line with the time it was written, in RFC3339Nano format.
+	Timestamps bool
+}
+
+// logsDir returns the directory holding the task output logs of the containers.
+func (c *containerdRuntime) logsDir() string {
+	return filepath.Join(c.stateDir, "logs")
+}
+
+// logPath returns the path of the task output log of a container.
+func (c *containerdRuntime) logPath(containerName string) string {
+	return filepath.Join(c.logsDir(), containerName+".log")
+}
+
+// taskLog returns the IO of a detached task. The output is written to the container log by the log
+// driver, rotated according to the log configuration, or by the shim when there is no log driver,
+// so that it is kept after the process that created the task exits.
+func (c *containerdRuntime) taskLog(containerName string, config LogConfig) (cio.Creator, error) {
+	if err := os.MkdirAll(c.logsDir(), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create logs directory: %v", err)
+	}
+	if c.logDriver == "" {
+		return cio.LogFile(c.logPath(containerName)), nil
+	}
+	args := config.args()
+	args[logDriverFlag] = jsonFileLogDriver
+	args[logPathFlag] = c.logPath(containerName)
+	return cio.BinaryIO(c.logDriver, args), nil
+}
+
+// removeLogs deletes the current and rotated log files of a container.
+func (c *containerdRuntime) removeLogs(containerName string) error {
+	rotated, err := rotatedLogFiles(c.logPath(containerName))
+	if err != nil {
+		return err
+	}
+	for _, path := range append(rotated, c.logPath(containerName)) {
+		if err := removeIfExists(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContainerLogs writes the output of the container selected by the options to stdout and stderr,
+// according to the stream it was written to. A container that never ran has no output.
+func (c *containerdRuntime) ContainerLogs(ctx context.Context, containerName string, opts LogsOptions, stdout, stderr io.Writer) error {
+	ctx = c.withNamespace(ctx)
+
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+
+	entries, current, r, err := c.readLog(containerName, opts.Tail, opts.Since)
+	if err != nil {
+		return fmt.Errorf("failed to read log of container %q: %v", containerName, err)
+	}
+	if current == nil {
+		return nil
+	}
+	defer func() { current.Close() }()
+
+	out := &logWriter{stdout: stdout, stderr: stderr, timestamps: opts.Timestamps}
+	for _, entry := range entries {
+		if err := out.write(entry); err != nil {
+			return err
+		}
+	}
+	if !opts.Follow {
+		return nil
+	}
+
+	// The output written after the container stopped is drained before returning.
+	path := c.logPath(containerName)
+	running := true
+	for {
+		entry, err := r.next()
+		switch {
+		case err == nil:
+			if !entry.Time.Before(opts.Since) {
+				if err := out.write(entry); err != nil {
+					return err
+				}
+			}
+			continue
+		case !errors.Is(err, io.EOF):
+			return fmt.Errorf("failed to read log of container %q: %v", containerName, err)
+		}
+
+		// The log driver closes the current file before renaming it, so once a rotation is seen the
+		// file is read to its end one last time before following the new current file.
+		rotated, err := logRotated(current, path)
+		if err != nil {
+			return fmt.Errorf("failed to check rotation of log of container %q: %v", containerName, err)
+		}
+		if rotated {
+			for entry, err := r.next(); err == nil; entry, err = r.next() {
+				if err := out.write(entry); err != nil {
+					return err
+				}
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("failed to open log of container %q: %v", containerName, err)
+			}
+			current.Close()
+			current, r = f, newLogReader(f)
+			continue
+		}
+		if !running {
+			return nil
+		}
+
+		select {
+		case <-time.After(logFollowInterval):
+		case <-ctx.Done():
+			return nil
+		}
+		status, err := containerStatus(ctx, cntr)
+		if err != nil {
+			return err
+		}
+		running = status.Status == containerd.Running || status.Status == containerd.Paused || status.Status == containerd.Pausing
+	}
+}
+
+// readLog returns the last n entries of the container log written at or after since, all of them
+// if n is zero or less, reading the rotated log files then the current one, which is returned open
+// with its reader at its current end. The current file is nil if the container has no log.
+func (c *containerdRuntime) readLog(containerName string, n int, since time.Time) ([]logEntry, *os.File, *logReader, error) {
+	path := c.logPath(containerName)
+	current, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil, nil
+		}
+		return nil, nil, nil, err
+	}
+
+	// The current file is opened first so that a rotation while reading the rotated files does not
+	// skip entries, they may be returned twice instead.
+	rotated, err := rotatedLogFiles(path)
+	if err != nil {
+		current.Close()
+		return nil, nil, nil, err
+	}
+	var entries []logEntry
+	for _, file := range rotated {
+		f, err := openLogFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			current.Close()
+			return nil, nil, nil, err
+		}
+		entries, err = newLogReader(f).tailInto(entries, n, since)
+		f.Close()
+		if err != nil {
+			current.Close()
+			return nil, nil, nil, err
+		}
+	}
+
+	r := newLogReader(current)
+	entries, err = r.tailInto(entries, n, since)
+	if err != nil {
+		current.Close()
+		return nil, nil, nil, err
+	}
+	return entries, current, r, nil
+}
+
+// logRotated returns whether the log file at path is no longer the open file f.
+func logRotated(f *os.File, path string) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !os.SameFile(fi, current), nil
+}
+
+// logReader reads the entries of a container log, which can be written while it is read.
+type logReader struct {
+	r *bufio.Reader
+	// partial is the beginning of a line whose end is not written yet.
+	partial []byte
+}
+
+func newLogReader(r io.Reader) *logReader {
+	return &logReader{r: bufio.NewReader(r)}
+}
+
+// next returns the next entry of the log, io.EOF if no complete line follows the last entry yet.
+func (l *logReader) next() (logEntry, error) {
+	data, err := l.r.ReadBytes('\n')
+	l.partial = append(l.partial, data...)
+	if err != nil {
+		return logEntry{}, err
+	}
+	line := l.partial
+	l.partial = nil
+	return parseLogEntry(line), nil
+}
+
+// tailInto appends the entries written at or after since to entries, keeping the last n of them,
+// all of them if n is zero or less, reading the log to its current end.
+func (l *logReader) tailInto(entries []logEntry, n int, since time.Time) ([]logEntry, error) {
+	for {
+		entry, err := l.next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Time.Before(since) {
+			continue
+		}
+		if n > 0 && len(entries) == n {
+			entries = append(entries[:0], entries[1:]...)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// parseLogEntry parses a line of a container log. Lines written by the shim rather than the log
+// driver are output as is, without a timestamp.
+func parseLogEntry(line []byte) logEntry {
+	var entry logEntry
+	if err := json.Unmarshal(line, &entry); err != nil || entry.Stream == "" {
+		return logEntry{Log: string(line), Stream: stdoutStream}
+	}
+	return entry
+}
+
+// logWriter writes log entries to the writer of their stream.
+type logWriter struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	timestamps bool
+}
+
+func (w *logWriter) write(entry logEntry) error {
+	out := w.stdout
+	if entry.Stream == stderrStream {
+		out = w.stderr
+	}
+	if out == nil {
+		return nil
+	}
+
+	line := entry.Log
+	if w.timestamps && !entry.Time.IsZero() {
+		line = entry.Time.Format(time.RFC3339Nano) + " " + line
+	}
+	_, err := io.WriteString(out, line)
+	return err
+}
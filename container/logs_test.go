@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestLogReaderTail(t *testing.T) {
+	g := NewWithT(t)
+
+	log := `{"log":"one\n","stream":"stdout","time":"2022-06-01T10:00:00Z"}
+{"log":"two\n","stream":"stderr","time":"2022-06-01T10:00:01Z"}
+{"log":"three\n","stream":"stdout","time":"2022-06-01T10:00:02Z"}
+{"log":"four\n","stream":"stdout","time":"2022-06-01T10:00:03Z"}
+`
+	entries, err := newLogReader(strings.NewReader(log)).tailInto(nil, 2, time.Time{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(2))
+	g.Expect(entries[0].Log).To(Equal("three\n"))
+	g.Expect(entries[1].Log).To(Equal("four\n"))
+
+	entries, err = newLogReader(strings.NewReader(log)).tailInto(nil, 0, time.Date(2022, 6, 1, 10, 0, 1, 0, time.UTC))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(3))
+	g.Expect(entries[0].Stream).To(Equal(stderrStream))
+
+	// Lines written by the shim without log driver are returned as stdout, without timestamp.
+	entries, err = newLogReader(strings.NewReader("raw output\n")).tailInto(nil, 0, time.Time{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(entries).To(Equal([]logEntry{{Log: "raw output\n", Stream: stdoutStream}}))
+}
+
+func TestLogReaderPartialLine(t *testing.T) {
+	g := NewWithT(t)
+
+	log := &bytes.Buffer{}
+	log.WriteString(`{"log":"one\n","stream":"stdout",`)
+	r := newLogReader(log)
+
+	_, err := r.next()
+	g.Expect(err).To(Equal(io.EOF))
+
+	log.WriteString(`"time":"2022-06-01T10:00:00Z"}` + "\n")
+	entry, err := r.next()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(entry.Log).To(Equal("one\n"))
+	g.Expect(entry.Time).To(Equal(time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)))
+}
+
+func TestLogWriter(t *testing.T) {
+	g := NewWithT(t)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	w := &logWriter{stdout: stdout, stderr: stderr, timestamps: true}
+	g.Expect(w.write(logEntry{Log: "out\n", Stream: stdoutStream, Time: time.Date(2022, 6, 1, 10, 0, 0, 5, time.UTC)})).To(Succeed())
+	g.Expect(w.write(logEntry{Log: "err\n", Stream: stderrStream})).To(Succeed())
+
+	g.Expect(stdout.String()).To(Equal("2022-06-01T10:00:00.000000005Z out\n"))
+	g.Expect(stderr.String()).To(Equal("err\n"))
+}
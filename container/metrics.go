@@ -0,0 +1,225 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/namespaces"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+const (
+	// kindClusterLabel and kindRoleLabel are the labels of the machine and load balancer containers
+	// holding their cluster and node role.
+	kindClusterLabel = "io.x-k8s.kind.cluster"
+	kindRoleLabel    = "io.x-k8s.kind.role"
+	// statsCollectTimeout bounds the time spent reading the stats of all containers on a scrape.
+	statsCollectTimeout = 10 * time.Second
+)
+
+var (
+	statsLabels = []string{"cluster", "container", "role"}
+
+	cpuUsageDesc = prometheus.NewDesc("capc_container_cpu_usage_seconds_total",
+		"CPU time used by the container since it started.", statsLabels, nil)
+	memoryWorkingSetDesc = prometheus.NewDesc("capc_container_memory_working_set_bytes",
+		"Memory used by the container, excluding the reclaimable page cache.", statsLabels, nil)
+	memoryLimitDesc = prometheus.NewDesc("capc_container_memory_limit_bytes",
+		"Memory limit of the container, not reported if it has none.", statsLabels, nil)
+	ioReadDesc = prometheus.NewDesc("capc_container_io_read_bytes_total",
+		"Bytes read from block devices by the container.", statsLabels, nil)
+	ioWriteDesc = prometheus.NewDesc("capc_container_io_write_bytes_total",
+		"Bytes written to block devices by the container.", statsLabels, nil)
+	processesDesc = prometheus.NewDesc("capc_container_processes",
+		"Number of processes in the container.", statsLabels, nil)
+
+	runningContainersDesc = prometheus.NewDesc("capc_containers_running",
+		"Number of running machine and load balancer containers of the cluster.", []string{"cluster"}, nil)
+
+	statsDescs = []*prometheus.Desc{cpuUsageDesc, memoryWorkingSetDesc, memoryLimitDesc, ioReadDesc, ioWriteDesc, processesDesc, runningContainersDesc}
+)
+
+// The results and failure reasons the runtime operations are counted by.
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultTimeout = "timeout"
+
+	createFailureImage   = "image"
+	createFailureConfig  = "config"
+	createFailureNetwork = "network"
+	createFailureCreate  = "create"
+	createFailureStart   = "start"
+)
+
+// operationMetrics measure the operations of a runtime, so that operators can alert on slow pulls,
+// hung bootstrap commands or containers failing to be created.
+type operationMetrics struct {
+	pullDuration   *prometheus.HistogramVec
+	execDuration   *prometheus.HistogramVec
+	createFailures *prometheus.CounterVec
+}
+
+func newOperationMetrics() *operationMetrics {
+	return &operationMetrics{
+		pullDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "capc_image_pull_duration_seconds",
+			Help:    "Time taken to pull the images missing on the host, by result.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		}, []string{"result"}),
+		execDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "capc_exec_duration_seconds",
+			Help:    "Time taken by the commands run in containers, e.g. kubeadm, by result.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+		}, []string{"result"}),
+		createFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "capc_container_create_failures_total",
+			Help: "Number of containers that failed to be created, by the step that failed: image, config, network, create or start.",
+		}, []string{"reason"}),
+	}
+}
+
+func (m *operationMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.pullDuration, m.execDuration, m.createFailures}
+}
+
+// observePull records the duration of a pull started at start that failed with err, if not nil.
+func (m *operationMetrics) observePull(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	result := resultSuccess
+	if err != nil {
+		result = resultError
+	}
+	m.pullDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// observeExec records the duration of an exec started at start that failed with err, if not nil.
+func (m *operationMetrics) observeExec(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	result := resultSuccess
+	switch {
+	case errors.Is(err, ErrExecTimeout):
+		result = resultTimeout
+	case err != nil:
+		result = resultError
+	}
+	m.execDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// countCreateFailure counts a container that failed to be created at the given step.
+func (m *operationMetrics) countCreateFailure(reason string) {
+	if m == nil {
+		return
+	}
+	m.createFailures.WithLabelValues(reason).Inc()
+}
+
+// WithMetricsRegisterer registers the metrics of the runtime operations with the registerer.
+func WithMetricsRegisterer(registerer prometheus.Registerer) Option {
+	return func(c *containerdRuntime) {
+		c.metricsRegisterer = registerer
+	}
+}
+
+// statsCollector reports the resource usage of the running machine and load balancer containers,
+// labelled with their cluster, on each scrape.
+type statsCollector struct {
+	runtime Runtime
+}
+
+// NewStatsCollector returns a Prometheus collector of the resource usage of the running machine and
+// load balancer containers of the runtime, so that the workload clusters using most of a shared host
+// can be found.
+func NewStatsCollector(runtime Runtime) prometheus.Collector {
+	return &statsCollector{runtime: runtime}
+}
+
+func (s *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range statsDescs {
+		ch <- desc
+	}
+}
+
+// Collect reports the stats of the containers that can be read, the containers that are not running
+// or are deleted during the scrape are skipped, and the number of running containers of each cluster.
+func (s *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsCollectTimeout)
+	defer cancel()
+
+	namespaceNames, err := s.runtime.ListNamespaces(ctx)
+	if err != nil {
+		for _, desc := range statsDescs {
+			ch <- prometheus.NewInvalidMetric(desc, err)
+		}
+		return
+	}
+
+	filters := container.FilterBuilder{}
+	filters.AddKeyValue("label", kindClusterLabel)
+	running := map[string]int{}
+	for _, namespace := range namespaceNames {
+		nsCtx := namespaces.WithNamespace(ctx, namespace)
+		containers, err := s.runtime.ListContainers(nsCtx, filters)
+		if err != nil {
+			continue
+		}
+		for _, cntr := range containers {
+			info, err := s.runtime.InspectContainer(nsCtx, cntr.Name)
+			if err != nil {
+				continue
+			}
+			if strings.HasPrefix(info.Status, "Up") {
+				running[info.Labels[kindClusterLabel]]++
+			}
+			stats, err := s.runtime.ContainerStats(nsCtx, cntr.Name)
+			if err != nil {
+				continue
+			}
+			collectStats(ch, stats, info.Labels[kindClusterLabel], cntr.Name, info.Labels[kindRoleLabel])
+		}
+	}
+	for cluster, count := range running {
+		ch <- prometheus.MustNewConstMetric(runningContainersDesc, prometheus.GaugeValue, float64(count), cluster)
+	}
+}
+
+// collectStats reports the stats of a container with the given label values.
+func collectStats(ch chan<- prometheus.Metric, stats *ContainerStats, labelValues ...string) {
+	metric := func(desc *prometheus.Desc, valueType prometheus.ValueType, value float64) {
+		m := prometheus.MustNewConstMetric(desc, valueType, value, labelValues...)
+		if !stats.Timestamp.IsZero() {
+			m = prometheus.NewMetricWithTimestamp(stats.Timestamp, m)
+		}
+		ch <- m
+	}
+
+	metric(cpuUsageDesc, prometheus.CounterValue, stats.CPUUsage.Seconds())
+	metric(memoryWorkingSetDesc, prometheus.GaugeValue, float64(stats.MemoryWorkingSet))
+	if stats.MemoryLimit > 0 {
+		metric(memoryLimitDesc, prometheus.GaugeValue, float64(stats.MemoryLimit))
+	}
+	metric(ioReadDesc, prometheus.CounterValue, float64(stats.IOReadBytes))
+	metric(ioWriteDesc, prometheus.CounterValue, float64(stats.IOWriteBytes))
+	metric(processesDesc, prometheus.GaugeValue, float64(stats.Processes))
+}
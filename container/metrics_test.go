@@ -0,0 +1,47 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOperationMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	m := newOperationMetrics()
+	start := time.Now()
+	m.observeExec(start, nil)
+	m.observeExec(start, fmt.Errorf("command %q: %w", "kubeadm", ErrExecTimeout))
+	m.observeExec(start, errors.New("exit code 1"))
+	m.observePull(start, nil)
+	m.countCreateFailure(createFailureNetwork)
+	m.countCreateFailure(createFailureNetwork)
+
+	g.Expect(testutil.CollectAndCount(m.execDuration)).To(Equal(3))
+	g.Expect(testutil.CollectAndCount(m.pullDuration)).To(Equal(1))
+	g.Expect(testutil.ToFloat64(m.createFailures.WithLabelValues(createFailureNetwork))).To(Equal(2.0))
+	g.Expect(testutil.ToFloat64(m.createFailures.WithLabelValues(createFailureStart))).To(Equal(0.0))
+
+	// The runtimes created without metrics do not record them.
+	var none *operationMetrics
+	none.observeExec(start, nil)
+	none.countCreateFailure(createFailureStart)
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/continuity/fs"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+// mountPropagationsKey is the key type for accessing the mount propagations in passed contexts.
+type mountPropagationsKey struct{}
+
+// mountPropagations are the supported propagations of bind mounts, by their precedence in the
+// propagation of the root filesystem.
+var mountPropagations = map[string]int{"rprivate": 0, "rslave": 1, "rshared": 2}
+
+// propagationOptions are the mount options setting the propagation of a mount.
+var propagationOptions = map[string]bool{
+	"private": true, "rprivate": true, "slave": true, "rslave": true, "shared": true, "rshared": true,
+}
+
+// MountPropagationsInto is used to store the propagation of the bind mounts of the containers run
+// with a context, rprivate, rshared or rslave by container path. The mounts not listed are rprivate.
+func MountPropagationsInto(ctx context.Context, propagations map[string]string) context.Context {
+	return context.WithValue(ctx, mountPropagationsKey{}, propagations)
+}
+
+// mountPropagationsFrom returns the mount propagations stored in the context, none if not set.
+func mountPropagationsFrom(ctx context.Context) map[string]string {
+	if propagations, ok := ctx.Value(mountPropagationsKey{}).(map[string]string); ok {
+		return propagations
+	}
+	return nil
+}
+
+// validateMountPropagations returns an error if a propagation is not rprivate, rshared or rslave.
+func validateMountPropagations(propagations map[string]string) error {
+	for target, propagation := range propagations {
+		if _, ok := mountPropagations[propagation]; !ok {
+			return fmt.Errorf("unsupported propagation %q of mount %q", propagation, target)
+		}
+	}
+	return nil
+}
+
+// withMountPropagations sets the propagation of the bind mounts of the spec at the given container
+// paths. Like docker, the root filesystem is made rshared or rslave for the mounts to propagate.
+func withMountPropagations(propagations map[string]string) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		rootfsPropagation := "rprivate"
+		for i, m := range s.Mounts {
+			propagation, ok := propagations[filepath.Clean(m.Destination)]
+			if !ok || m.Type != "bind" {
+				continue
+			}
+			options := make([]string, 0, len(m.Options))
+			for _, option := range m.Options {
+				if !propagationOptions[option] {
+					options = append(options, option)
+				}
+			}
+			s.Mounts[i].Options = append(options, propagation)
+			if mountPropagations[propagation] > mountPropagations[rootfsPropagation] {
+				rootfsPropagation = propagation
+			}
+		}
+		if rootfsPropagation != "rprivate" {
+			if s.Linux == nil {
+				s.Linux = &specs.Linux{}
+			}
+			s.Linux.RootfsPropagation = rootfsPropagation
+		}
+		return nil
+	}
+}
+
+// anonymousVolume is a volume without a host source, backed by a directory owned by the provider.
+type anonymousVolume struct {
+	// hostPath is the directory on the host backing the volume.
+	hostPath string
+	// containerPath is where the volume is mounted in the container.
+	containerPath string
+}
+
+// generateMounts translates the mounts, volumes and tmpfs entries of the run configuration into OCI mounts.
+func (c *containerdRuntime) generateMounts(runConfig *container.RunContainerInput) ([]specs.Mount, error) {
+	mounts := []specs.Mount{}
+
+	for _, m := range runConfig.Mounts {
+		mounts = append(mounts, bindMount(m.Source, m.Target, m.ReadOnly))
+	}
+
+	for source, dest := range runConfig.Volumes {
+		if dest != "" {
+			mounts = append(mounts, bindMount(source, dest, false))
+		}
+	}
+
+	for _, v := range c.anonymousVolumes(runConfig) {
+		if err := os.MkdirAll(v.hostPath, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create volume directory %q: %v", v.hostPath, err)
+		}
+		mounts = append(mounts, bindMount(v.hostPath, v.containerPath, false))
+	}
+
+	for target, options := range runConfig.Tmpfs {
+		opts := []string{"nosuid", "nodev"}
+		if options != "" {
+			opts = strings.Split(options, ",")
+		}
+		mounts = append(mounts, specs.Mount{
+			Destination: target,
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     opts,
+		})
+	}
+
+	// Map iteration order is random, sort to keep parent directories mounted before their children.
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(filepath.Clean(mounts[i].Destination)) < len(filepath.Clean(mounts[j].Destination))
+	})
+
+	return mounts, nil
+}
+
+// anonymousVolumes returns the volumes of the run configuration that do not have a host source
+// (docker's "-v /var" form).
+func (c *containerdRuntime) anonymousVolumes(runConfig *container.RunContainerInput) []anonymousVolume {
+	volumes := []anonymousVolume{}
+	for source, dest := range runConfig.Volumes {
+		if dest != "" {
+			continue
+		}
+		volumes = append(volumes, anonymousVolume{
+			hostPath:      filepath.Join(c.volumesDir(runConfig.Name), volumeDirName(source)),
+			containerPath: source,
+		})
+	}
+	return volumes
+}
+
+// volumesDir returns the directory holding the anonymous volumes of a container.
+func (c *containerdRuntime) volumesDir(containerName string) string {
+	return filepath.Join(c.stateDir, "volumes", containerName)
+}
+
+// populateVolumes copies the content the image has at the anonymous volume paths into the
+// volumes, like docker does when a volume is first mounted.
+func (c *containerdRuntime) populateVolumes(ctx context.Context, cntr containerd.Container, volumes []anonymousVolume) error {
+	if len(volumes) == 0 {
+		return nil
+	}
+
+	info, err := cntr.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get container info: %v", err)
+	}
+
+	mounts, err := c.client.SnapshotService(info.Snapshotter).Mounts(ctx, info.SnapshotKey)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot mounts: %v", err)
+	}
+
+	return mount.WithTempMount(ctx, mounts, func(root string) error {
+		for _, v := range volumes {
+			src, err := fs.RootPath(root, v.containerPath)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(src); os.IsNotExist(err) {
+				continue
+			}
+			if err := fs.CopyDir(v.hostPath, src); err != nil {
+				return fmt.Errorf("failed to copy image content into volume %q: %v", v.containerPath, err)
+			}
+		}
+		return nil
+	})
+}
+
+func bindMount(source, target string, readOnly bool) specs.Mount {
+	mode := "rw"
+	if readOnly {
+		mode = "ro"
+	}
+	return specs.Mount{
+		Destination: target,
+		Type:        "bind",
+		Source:      source,
+		Options:     []string{"rbind", "rprivate", mode},
+	}
+}
+
+// volumeDirName turns a container path into a directory name, e.g. "/var/lib" becomes "var-lib".
+func volumeDirName(containerPath string) string {
+	return strings.ReplaceAll(strings.Trim(filepath.Clean(containerPath), "/"), "/", "-")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+func TestGenerateMounts(t *testing.T) {
+	g := NewWithT(t)
+	stateDir := t.TempDir()
+	runtime := &containerdRuntime{stateDir: stateDir}
+
+	mounts, err := runtime.generateMounts(&container.RunContainerInput{
+		Name:    "test-node",
+		Volumes: map[string]string{"/var": ""},
+		Mounts: []container.Mount{{
+			Source:   "/lib/modules",
+			Target:   "/lib/modules",
+			ReadOnly: true,
+		}},
+		Tmpfs: map[string]string{"/tmp": ""},
+	})
+
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(mounts).To(ConsistOf(
+		specs.Mount{
+			Destination: "/var",
+			Type:        "bind",
+			Source:      filepath.Join(stateDir, "volumes", "test-node", "var"),
+			Options:     []string{"rbind", "rprivate", "rw"},
+		},
+		specs.Mount{
+			Destination: "/tmp",
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     []string{"nosuid", "nodev"},
+		},
+		specs.Mount{
+			Destination: "/lib/modules",
+			Type:        "bind",
+			Source:      "/lib/modules",
+			Options:     []string{"rbind", "rprivate", "ro"},
+		},
+	))
+	g.Expect(filepath.Join(stateDir, "volumes", "test-node", "var")).To(BeADirectory())
+}
+
+func TestMountPropagations(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(validateMountPropagations(map[string]string{"/var/lib/kubelet": "rshared", "/mnt": "rslave"})).To(Succeed())
+	g.Expect(validateMountPropagations(map[string]string{"/mnt": "shared"})).NotTo(Succeed())
+
+	s := &specs.Spec{Mounts: []specs.Mount{
+		bindMount("/var/lib/kubelet", "/var/lib/kubelet", false),
+		bindMount("/mnt", "/mnt", true),
+		{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "nodev"}},
+	}}
+	g.Expect(withMountPropagations(map[string]string{"/var/lib/kubelet": "rshared", "/mnt": "rslave", "/tmp": "rshared"})(context.Background(), nil, nil, s)).To(Succeed())
+	g.Expect(s.Mounts[0].Options).To(Equal([]string{"rbind", "rw", "rshared"}))
+	g.Expect(s.Mounts[1].Options).To(Equal([]string{"rbind", "ro", "rslave"}))
+	g.Expect(s.Mounts[2].Options).To(Equal([]string{"nosuid", "nodev"}))
+	g.Expect(s.Linux.RootfsPropagation).To(Equal("rshared"))
+}
+
+func TestVolumeDirName(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(volumeDirName("/var")).To(Equal("var"))
+	g.Expect(volumeDirName("/var/lib/etcd/")).To(Equal("var-lib-etcd"))
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/leases"
+	"github.com/containerd/containerd/namespaces"
+)
+
+const (
+	// clusterNamespaceLabel and clusterNameLabel record the cluster a containerd namespace was
+	// created for.
+	clusterNamespaceLabel = "io.x-k8s.capc.cluster.namespace"
+	clusterNameLabel      = "io.x-k8s.capc.cluster.name"
+
+	// maxNamespaceLength is the maximum length of a containerd namespace name.
+	maxNamespaceLength = 76
+	// namespaceHashLength is the length of the hash suffixing the names of the namespaces that
+	// would be too long otherwise.
+	namespaceHashLength = 8
+)
+
+// clusterKey identifies a ContainerdCluster.
+type clusterKey struct {
+	namespace, name string
+}
+
+type clusterKeyType struct{}
+
+// ClusterInto stores in the context the ContainerdCluster whose containers the runtime calls made
+// with it operate on. The containers, images and leases of each cluster live in a containerd
+// namespace of their own, named after the namespace of the runtime and the cluster, so that
+// clusters do not collide on container names and are deleted at once with DeleteClusterNamespace.
+// The calls made without a cluster use the namespace of the runtime.
+func ClusterInto(ctx context.Context, namespace, name string) context.Context {
+	return context.WithValue(ctx, clusterKeyType{}, clusterKey{namespace: namespace, name: name})
+}
+
+func clusterFrom(ctx context.Context) (clusterKey, bool) {
+	key, ok := ctx.Value(clusterKeyType{}).(clusterKey)
+	return key, ok
+}
+
+// namespaceFrom returns the containerd namespace the calls made with the context operate on: the
+// namespace of its cluster, if any, else the namespace already set by the runtime while going
+// through all its namespaces, else the namespace of the runtime.
+func (c *containerdRuntime) namespaceFrom(ctx context.Context) string {
+	if cluster, ok := clusterFrom(ctx); ok {
+		return c.clusterNamespace(cluster)
+	}
+	if namespace, ok := namespaces.Namespace(ctx); ok && c.ownsNamespace(namespace) {
+		return namespace
+	}
+	return c.namespace
+}
+
+// withNamespace returns the context of the containerd calls made with ctx.
+func (c *containerdRuntime) withNamespace(ctx context.Context) context.Context {
+	return namespaces.WithNamespace(ctx, c.namespaceFrom(ctx))
+}
+
+// clusterNamespace returns the name of the containerd namespace of the cluster. Kubernetes
+// namespaces have no dots, so the names are unique, the ones too long for containerd are truncated
+// and suffixed with the hash of the full name.
+func (c *containerdRuntime) clusterNamespace(cluster clusterKey) string {
+	name := fmt.Sprintf("%s.%s.%s", c.namespace, cluster.namespace, cluster.name)
+	if len(name) <= maxNamespaceLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	prefix := strings.TrimRight(name[:maxNamespaceLength-namespaceHashLength-1], ".-_")
+	return prefix + "-" + hex.EncodeToString(sum[:])[:namespaceHashLength]
+}
+
+// ownsNamespace returns whether the containerd namespace is the namespace of the runtime or of one
+// of its clusters.
+func (c *containerdRuntime) ownsNamespace(namespace string) bool {
+	return namespace == c.namespace || strings.HasPrefix(namespace, c.namespace+".")
+}
+
+// ListNamespaces returns the containerd namespaces of the runtime, its own namespace and the
+// namespaces of its clusters, so that the containers of all the clusters can be found.
+func (c *containerdRuntime) ListNamespaces(ctx context.Context) ([]string, error) {
+	all, err := c.client.NamespaceService().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %v", err)
+	}
+	owned := []string{c.namespace}
+	for _, namespace := range all {
+		if namespace != c.namespace && c.ownsNamespace(namespace) {
+			owned = append(owned, namespace)
+		}
+	}
+	sort.Strings(owned[1:])
+	return owned, nil
+}
+
+// ClusterNamespace returns the containerd namespace of the containers of the cluster in the context.
+func (c *containerdRuntime) ClusterNamespace(ctx context.Context) string {
+	if cluster, ok := clusterFrom(ctx); ok {
+		return c.clusterNamespace(cluster)
+	}
+	return c.namespace
+}
+
+// ensureNamespace creates the containerd namespace of the cluster in the context, labelled with
+// the cluster, unless it exists. containerd would create it on first use otherwise, without labels.
+func (c *containerdRuntime) ensureNamespace(ctx context.Context) error {
+	cluster, ok := clusterFrom(ctx)
+	if !ok {
+		return nil
+	}
+	namespace := c.clusterNamespace(cluster)
+	labels := map[string]string{clusterNamespaceLabel: cluster.namespace, clusterNameLabel: cluster.name}
+	if err := c.client.NamespaceService().Create(ctx, namespace, labels); err != nil && !errdefs.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %q: %v", namespace, err)
+	}
+	return nil
+}
+
+// DeleteClusterNamespace deletes the containerd namespace of the cluster in the context with all it
+// holds: its containers, with their state kept by the runtime, its images and leases, the content
+// and snapshots only they reference being garbage collected, and the named volumes of the cluster.
+// Deleting the namespace of a cluster that never ran a container is not an error.
+func (c *containerdRuntime) DeleteClusterNamespace(ctx context.Context) error {
+	if _, ok := clusterFrom(ctx); !ok {
+		return fmt.Errorf("no cluster set in the context")
+	}
+	namespace := c.namespaceFrom(ctx)
+	ctx = namespaces.WithNamespace(ctx, namespace)
+
+	if _, err := c.client.NamespaceService().Labels(ctx, namespace); err != nil {
+		if errdefs.IsNotFound(err) {
+			return c.deleteNamedVolumes(ctx)
+		}
+		return fmt.Errorf("failed to get namespace %q: %v", namespace, err)
+	}
+
+	cntrs, err := c.client.Containers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list containers of namespace %q: %v", namespace, err)
+	}
+	for _, cntr := range cntrs {
+		if err := c.DeleteContainer(ctx, cntr.ID()); err != nil {
+			return err
+		}
+	}
+
+	// The namespace must be empty to be deleted, the last image or lease deletion garbage collects
+	// the content and snapshots left unreferenced before returning.
+	imageStore := c.client.ImageService()
+	imgs, err := imageStore.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list images of namespace %q: %v", namespace, err)
+	}
+	leaseManager := c.client.LeasesService()
+	ls, err := leaseManager.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list leases of namespace %q: %v", namespace, err)
+	}
+	for i, img := range imgs {
+		var opts []images.DeleteOpt
+		if i == len(imgs)-1 && len(ls) == 0 {
+			opts = append(opts, images.SynchronousDelete())
+		}
+		if err := imageStore.Delete(ctx, img.Name, opts...); err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to delete image %q: %v", img.Name, err)
+		}
+	}
+	for i, lease := range ls {
+		var opts []leases.DeleteOpt
+		if i == len(ls)-1 {
+			opts = append(opts, leases.SynchronousDelete)
+		}
+		if err := leaseManager.Delete(ctx, lease, opts...); err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to delete lease %q: %v", lease.ID, err)
+		}
+	}
+
+	if err := c.client.NamespaceService().Delete(ctx, namespace); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to delete namespace %q: %v", namespace, err)
+	}
+	return c.deleteNamedVolumes(ctx)
+}
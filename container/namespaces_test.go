@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/identifiers"
+	"github.com/containerd/containerd/namespaces"
+	. "github.com/onsi/gomega"
+)
+
+func TestClusterNamespace(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &containerdRuntime{namespace: "default"}
+	g.Expect(c.clusterNamespace(clusterKey{namespace: "team-a", name: "dev"})).To(Equal("default.team-a.dev"))
+
+	long := c.clusterNamespace(clusterKey{namespace: "team-a", name: strings.Repeat("cluster-", 10) + "x"})
+	g.Expect(long).To(HaveLen(maxNamespaceLength))
+	g.Expect(identifiers.Validate(long)).To(Succeed())
+	g.Expect(long).ToNot(Equal(c.clusterNamespace(clusterKey{namespace: "team-a", name: strings.Repeat("cluster-", 10) + "y"})))
+
+	// The truncated prefix must not end with a separator.
+	truncated := c.clusterNamespace(clusterKey{namespace: "team-a", name: strings.Repeat("a", 51) + "-" + strings.Repeat("b", 20)})
+	g.Expect(identifiers.Validate(truncated)).To(Succeed())
+}
+
+func TestNamespaceFrom(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &containerdRuntime{namespace: "default"}
+	ctx := context.Background()
+	g.Expect(c.namespaceFrom(ctx)).To(Equal("default"))
+	g.Expect(c.namespaceFrom(ClusterInto(ctx, "team-a", "dev"))).To(Equal("default.team-a.dev"))
+
+	// The namespaces of the runtime set while going through them are kept, the others are not.
+	g.Expect(c.namespaceFrom(namespaces.WithNamespace(ctx, "default.team-b.prod"))).To(Equal("default.team-b.prod"))
+	g.Expect(c.namespaceFrom(namespaces.WithNamespace(ctx, "k8s.io"))).To(Equal("default"))
+	g.Expect(c.namespaceFrom(namespaces.WithNamespace(ctx, "defaultx"))).To(Equal("default"))
+
+	// The namespace of a cluster does not depend on the namespace set in the context.
+	g.Expect(c.ClusterNamespace(ClusterInto(namespaces.WithNamespace(ctx, "k8s.io"), "team-a", "dev"))).To(Equal("default.team-a.dev"))
+	g.Expect(c.ClusterNamespace(namespaces.WithNamespace(ctx, "default.team-b.prod"))).To(Equal("default"))
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/pkg/netns"
+	"github.com/containernetworking/cni/libcni"
+	current "github.com/containernetworking/cni/pkg/types/100"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+const (
+	// DefaultCNIBinDir is the directory where CNI plugins are usually installed.
+	DefaultCNIBinDir = "/opt/cni/bin"
+
+	// netnsLabel stores the path of the network namespace a container is attached to.
+	netnsLabel = "io.x-k8s.capc.netns"
+	// cniResultLabel stores the result of the CNI ADD of a container as JSON.
+	cniResultLabel = "io.x-k8s.capc.cni-result"
+
+	// cniInterfaceName is the name of the interface created in the container network namespace.
+	cniInterfaceName = "eth0"
+	// defaultBridgeSubnet is the subnet of the bridge network used when no configuration exists
+	// for a network.
+	defaultBridgeSubnet = "10.89.0.0/16"
+)
+
+// WithCNI attaches containers that do not use the host network to CNI networks, using the plugins
+// in binDir. The configuration of a network is loaded from the file of the same name in confDir,
+// else from the configuration written by the runtime for the network of a cluster, if there is
+// none a bridge network with host-local IPAM is used.
+func WithCNI(binDir, confDir string) Option {
+	return func(c *containerdRuntime) {
+		c.cni = &cniNetwork{
+			config:           libcni.NewCNIConfigWithCacheDir([]string{binDir}, filepath.Join(c.stateDir, "cni"), nil),
+			confDir:          confDir,
+			networksDir:      filepath.Join(c.stateDir, "networks"),
+			hostLocalDataDir: hostLocalDataDir,
+		}
+	}
+}
+
+// cniNetwork attaches containers to CNI networks.
+type cniNetwork struct {
+	config  *libcni.CNIConfig
+	confDir string
+	// networksDir holds the configuration of the networks written by the runtime.
+	networksDir string
+	// hostLocalDataDir is where the host-local IPAM plugin records the allocated addresses.
+	hostLocalDataDir string
+}
+
+// networkAttachment is a container network namespace attached to a CNI network.
+type networkAttachment struct {
+	// netnsPath is the path of the network namespace.
+	netnsPath string
+	// result is the result of the CNI ADD.
+	result *current.Result
+}
+
+// labels returns the container labels used to find the attachment again on delete and for IP lookups.
+func (a *networkAttachment) labels() (map[string]string, error) {
+	result, err := json.Marshal(a.result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CNI result: %v", err)
+	}
+	return map[string]string{
+		netnsLabel:     a.netnsPath,
+		cniResultLabel: string(result),
+	}, nil
+}
+
+// networkConfig returns the configuration of the named network.
+func (n *cniNetwork) networkConfig(network string) (*libcni.NetworkConfigList, error) {
+	confList, err := libcni.LoadConfList(n.confDir, network)
+	if err == nil {
+		return confList, nil
+	}
+	var notFound libcni.NotFoundError
+	var noConfigs libcni.NoConfigsFoundError
+	if !errors.As(err, &notFound) && !errors.As(err, &noConfigs) {
+		return nil, fmt.Errorf("failed to load CNI configuration for network %q: %v", network, err)
+	}
+	if n.networksDir != "" {
+		confList, err := libcni.ConfListFromFile(n.configFile(network))
+		if err == nil {
+			return confList, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to load CNI configuration for network %q: %v", network, err)
+		}
+	}
+	return libcni.ConfListFromBytes(defaultBridgeConfig(network))
+}
+
+// setup creates a network namespace and attaches it to the network, publishing the port mappings
+// through the portmap plugin if the network configuration has it. The given address, if any, is
+// requested from the plugins.
+func (n *cniNetwork) setup(ctx context.Context, stateDir, containerName, network string, ports []container.PortMapping, address StaticAddress) (*networkAttachment, error) {
+	ns, err := netns.NewNetNS(filepath.Join(stateDir, "netns"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network namespace: %v", err)
+	}
+
+	result, err := n.attach(ctx, containerName, network, ns.GetPath(), ports, address)
+	if err != nil {
+		_ = ns.Remove()
+		return nil, err
+	}
+
+	return &networkAttachment{netnsPath: ns.GetPath(), result: result}, nil
+}
+
+// attach attaches an existing network namespace to the network, requesting the given address if any.
+func (n *cniNetwork) attach(ctx context.Context, containerName, network, netnsPath string, ports []container.PortMapping, address StaticAddress) (*current.Result, error) {
+	confList, err := n.networkConfig(network)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := runtimeConf(containerName, netnsPath, ports)
+	rt.Args = address.cniArgs()
+	res, err := n.config.AddNetworkList(ctx, confList, rt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach container %q to network %q: %v", containerName, network, err)
+	}
+	result, err := current.NewResultFromResult(res)
+	if err != nil {
+		_ = n.config.DelNetworkList(ctx, confList, runtimeConf(containerName, netnsPath, ports))
+		return nil, fmt.Errorf("failed to convert CNI result: %v", err)
+	}
+	return result, nil
+}
+
+// republish programs the port mappings again with the portmap plugins of the network, using the
+// result of the attachment. The plugin replaces the forwarding rules of the container, so this can
+// be done while the attachment is in place, e.g. after the firewall rules were flushed.
+func (n *cniNetwork) republish(ctx context.Context, containerName, network, netnsPath string, ports []container.PortMapping, result *current.Result) error {
+	confList, err := n.networkConfig(network)
+	if err != nil {
+		return err
+	}
+
+	for _, plugin := range confList.Plugins {
+		if plugin.Network.Type != "portmap" {
+			continue
+		}
+		conf, err := libcni.InjectConf(plugin, map[string]interface{}{
+			"name":       confList.Name,
+			"cniVersion": confList.CNIVersion,
+			"prevResult": result,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to build portmap configuration: %v", err)
+		}
+		if _, err := n.config.AddNetwork(ctx, conf, runtimeConf(containerName, netnsPath, ports)); err != nil {
+			return fmt.Errorf("failed to publish ports of container %q: %v", containerName, err)
+		}
+	}
+	return nil
+}
+
+// detach detaches the network namespace from the network, releasing its addresses and port mappings.
+func (n *cniNetwork) detach(ctx context.Context, containerName, network, netnsPath string, ports []container.PortMapping) error {
+	confList, err := n.networkConfig(network)
+	if err != nil {
+		return err
+	}
+
+	if err := n.config.DelNetworkList(ctx, confList, runtimeConf(containerName, netnsPath, ports)); err != nil {
+		return fmt.Errorf("failed to detach container %q from network %q: %v", containerName, network, err)
+	}
+	return nil
+}
+
+// teardown detaches the network namespace from the network and removes it. Tearing down an
+// attachment that is already gone is not an error.
+func (n *cniNetwork) teardown(ctx context.Context, containerName, network, netnsPath string, ports []container.PortMapping) error {
+	if err := n.detach(ctx, containerName, network, netnsPath, ports); err != nil {
+		return err
+	}
+
+	if err := netns.LoadNetNS(netnsPath).Remove(); err != nil {
+		return fmt.Errorf("failed to remove network namespace %q: %v", netnsPath, err)
+	}
+	return nil
+}
+
+func runtimeConf(containerName, netnsPath string, ports []container.PortMapping) *libcni.RuntimeConf {
+	rt := &libcni.RuntimeConf{
+		ContainerID: containerName,
+		NetNS:       netnsPath,
+		IfName:      cniInterfaceName,
+	}
+	if len(ports) > 0 {
+		rt.CapabilityArgs = map[string]interface{}{
+			"portMappings": cniPortMappings(ports),
+		}
+	}
+	return rt
+}
+
+// requestedIPsArgs returns the CNI_ARGS requesting the IPs from the IPAM plugin, as supported by host-local.
+// Plugins that do not know the argument ignore it.
+func requestedIPsArgs(ips []net.IP) [][2]string {
+	values := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		values = append(values, ip.String())
+	}
+	return [][2]string{{"IgnoreUnknown", "1"}, {"IP", strings.Join(values, ",")}}
+}
+
+// cniResultFromLabels returns the CNI result stored in the labels, nil if there is none.
+func cniResultFromLabels(labels map[string]string) (*current.Result, error) {
+	data, ok := labels[cniResultLabel]
+	if !ok {
+		return nil, nil
+	}
+	result := &current.Result{}
+	if err := json.Unmarshal([]byte(data), result); err != nil {
+		return nil, fmt.Errorf("failed to parse CNI result: %v", err)
+	}
+	return result, nil
+}
+
+// containerIPs returns the addresses of the container interface from the CNI result stored in the labels.
+func containerIPs(labels map[string]string) ([]net.IP, error) {
+	result, err := cniResultFromLabels(labels)
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	ips := []net.IP{}
+	for _, ipConfig := range result.IPs {
+		// Skip addresses of the host side interfaces created by the plugins.
+		if ipConfig.Interface != nil && *ipConfig.Interface < len(result.Interfaces) &&
+			result.Interfaces[*ipConfig.Interface].Sandbox == "" {
+			continue
+		}
+		ips = append(ips, ipConfig.Address.IP)
+	}
+	return ips, nil
+}
+
+// firstIPs returns the first IPv4 and the first IPv6 address of the list, empty if there is none.
+func firstIPs(ips []net.IP) (ipv4 string, ipv6 string) {
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			if ipv4 == "" {
+				ipv4 = ip.String()
+			}
+		} else if ipv6 == "" {
+			ipv6 = ip.String()
+		}
+	}
+	return ipv4, ipv6
+}
+
+// defaultBridgeConfig returns the configuration of a bridge network with host-local IPAM, publishing
+// ports with the portmap plugin.
+func defaultBridgeConfig(network string) []byte {
+	return bridgeConfig(Network{Name: network, Bridge: "capc0", Subnets: []string{defaultBridgeSubnet}})
+}
+
+// bridgeConfig returns the configuration of the bridge network with host-local IPAM, publishing
+// ports with the portmap plugin. The containers get an address and a default route for each subnet.
+func bridgeConfig(network Network) []byte {
+	type ipamRange struct {
+		Subnet string `json:"subnet"`
+	}
+	type route struct {
+		Dst string `json:"dst"`
+	}
+	ranges := [][]ipamRange{}
+	routes := []route{}
+	for _, subnet := range network.Subnets {
+		ranges = append(ranges, []ipamRange{{Subnet: subnet}})
+		if ip, _, err := net.ParseCIDR(subnet); err == nil && ip.To4() == nil {
+			routes = append(routes, route{Dst: "::/0"})
+		} else {
+			routes = append(routes, route{Dst: "0.0.0.0/0"})
+		}
+	}
+	rangesJSON, _ := json.Marshal(ranges)
+	routesJSON, _ := json.Marshal(routes)
+
+	mtu := ""
+	if network.MTU > 0 {
+		mtu = fmt.Sprintf(`
+      "mtu": %d,`, network.MTU)
+	}
+	return []byte(fmt.Sprintf(`{
+  "cniVersion": "1.0.0",
+  "name": %q,
+  "plugins": [
+    {
+      "type": "bridge",
+      "bridge": %q,
+      "isGateway": true,
+      "ipMasq": true,
+      "hairpinMode": true,%s
+      "ipam": {
+        "type": "host-local",
+        "ranges": %s,
+        "routes": %s
+      }
+    },
+    {
+      "type": "portmap",
+      "capabilities": {"portMappings": true}
+    },
+    {
+      "type": "firewall"
+    }
+  ]
+}`, network.Name, network.Bridge, mtu, rangesJSON, routesJSON))
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
+	. "github.com/onsi/gomega"
+)
+
+func TestNetworkConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	confDir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(confDir, "10-custom.conflist"), []byte(`{
+		"cniVersion": "1.0.0",
+		"name": "custom",
+		"plugins": [{"type": "macvlan", "master": "eth0", "ipam": {"type": "dhcp"}}]
+	}`), 0o600)).To(Succeed())
+
+	n := &cniNetwork{confDir: confDir}
+
+	confList, err := n.networkConfig("custom")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(confList.Plugins).To(HaveLen(1))
+	g.Expect(confList.Plugins[0].Network.Type).To(Equal("macvlan"))
+
+	confList, err = n.networkConfig("kind")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(confList.Name).To(Equal("kind"))
+	g.Expect(confList.Plugins[0].Network.Type).To(Equal("bridge"))
+	g.Expect(confList.Plugins[0].Network.IPAM.Type).To(Equal("host-local"))
+}
+
+func TestContainerIPs(t *testing.T) {
+	g := NewWithT(t)
+
+	hostIface, containerIface := 0, 1
+	_, ipv4, _ := net.ParseCIDR("10.89.0.2/16")
+	ipv4.IP = net.ParseIP("10.89.0.2")
+	_, gateway, _ := net.ParseCIDR("10.89.0.1/16")
+	gateway.IP = net.ParseIP("10.89.0.1")
+
+	attachment := &networkAttachment{
+		netnsPath: "/var/run/netns/cni-1234",
+		result: &current.Result{
+			CNIVersion: current.ImplementedSpecVersion,
+			Interfaces: []*current.Interface{
+				{Name: "capc0"},
+				{Name: "eth0", Sandbox: "/var/run/netns/cni-1234"},
+			},
+			IPs: []*current.IPConfig{
+				{Interface: &hostIface, Address: *gateway},
+				{Interface: &containerIface, Address: *ipv4, Gateway: gateway.IP},
+			},
+		},
+	}
+	labels, err := attachment.labels()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(labels).To(HaveKeyWithValue(netnsLabel, "/var/run/netns/cni-1234"))
+
+	ips, err := containerIPs(labels)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(ips).To(HaveLen(1))
+	g.Expect(ips[0].String()).To(Equal("10.89.0.2"))
+
+	ips, err = containerIPs(map[string]string{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(ips).To(BeEmpty())
+}
+
+func TestFirstIPs(t *testing.T) {
+	g := NewWithT(t)
+
+	ipv4, ipv6 := firstIPs([]net.IP{
+		net.ParseIP("fd00:10:89::2"),
+		net.ParseIP("10.89.0.2"),
+		net.ParseIP("10.89.0.3"),
+		net.ParseIP("fd00:10:89::3"),
+	})
+	g.Expect(ipv4).To(Equal("10.89.0.2"))
+	g.Expect(ipv6).To(Equal("fd00:10:89::2"))
+
+	ipv4, ipv6 = firstIPs([]net.IP{net.ParseIP("10.89.0.2")})
+	g.Expect(ipv4).To(Equal("10.89.0.2"))
+	g.Expect(ipv6).To(BeEmpty())
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Option configures the containerd runtime client.
+type Option func(*containerdRuntime)
+
+// WithRegistryConfigPath sets the directory holding the registry hosts configuration, laid out
+// like containerd's config_path: <path>/<host>/hosts.toml plus certificates.
+func WithRegistryConfigPath(path string) Option {
+	return func(c *containerdRuntime) {
+		c.registryConfigPath = path
+	}
+}
+
+// WithMaxConcurrentDownloads limits the number of layers downloaded concurrently for each image pull.
+// Zero or less means no limit.
+func WithMaxConcurrentDownloads(max int) Option {
+	return func(c *containerdRuntime) {
+		c.maxConcurrentDownloads = max
+	}
+}
+
+// WithMaxConcurrentUnpacks limits the number of images pulled and unpacked concurrently by the client.
+// containerd unpacks layers while it downloads them, so this bounds whole pulls. Zero or less means
+// no limit.
+func WithMaxConcurrentUnpacks(max int) Option {
+	return func(c *containerdRuntime) {
+		c.unpackLimiter = nil
+		if max > 0 {
+			c.unpackLimiter = semaphore.NewWeighted(int64(max))
+		}
+	}
+}
+
+// WithExecTimeout sets how long execs can run when their context has no deadline, after which they are
+// killed. Zero or less means no timeout.
+func WithExecTimeout(timeout time.Duration) Option {
+	return func(c *containerdRuntime) {
+		c.execTimeout = timeout
+	}
+}
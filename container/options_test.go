@@ -0,0 +1,50 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMaxConcurrentUnpacks(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &containerdRuntime{}
+	WithMaxConcurrentUnpacks(1)(c)
+
+	release, err := c.acquireUnpack(context.Background())
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// A second pull waits for the first one to complete.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.acquireUnpack(ctx)
+	g.Expect(err).Should(HaveOccurred())
+
+	release()
+	release, err = c.acquireUnpack(context.Background())
+	g.Expect(err).ShouldNot(HaveOccurred())
+	release()
+
+	// No limit.
+	WithMaxConcurrentUnpacks(0)(c)
+	for i := 0; i < 3; i++ {
+		_, err := c.acquireUnpack(context.Background())
+		g.Expect(err).ShouldNot(HaveOccurred())
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+)
+
+// PauseContainer freezes all the processes of a running container with the cgroup freezer, keeping
+// their state until the container is resumed. Pausing a paused container is not an error.
+func (c *containerdRuntime) PauseContainer(ctx context.Context, containerName string) error {
+	ctx = c.withNamespace(ctx)
+
+	task, status, err := c.loadTask(ctx, containerName)
+	if err != nil {
+		return err
+	}
+	switch status.Status {
+	case containerd.Paused, containerd.Pausing:
+		return nil
+	case containerd.Running:
+	default:
+		return fmt.Errorf("container %q is not running", containerName)
+	}
+
+	if err := task.Pause(ctx); err != nil {
+		return fmt.Errorf("failed to pause container %q: %v", containerName, err)
+	}
+	return nil
+}
+
+// ResumeContainer thaws the processes of a paused container. Resuming a running container is not
+// an error.
+func (c *containerdRuntime) ResumeContainer(ctx context.Context, containerName string) error {
+	ctx = c.withNamespace(ctx)
+
+	task, status, err := c.loadTask(ctx, containerName)
+	if err != nil {
+		return err
+	}
+	switch status.Status {
+	case containerd.Running:
+		return nil
+	case containerd.Paused, containerd.Pausing:
+	default:
+		return fmt.Errorf("container %q is not running", containerName)
+	}
+
+	if err := task.Resume(ctx); err != nil {
+		return fmt.Errorf("failed to resume container %q: %v", containerName, err)
+	}
+	return nil
+}
+
+// loadTask returns the task of a container and its status.
+func (c *containerdRuntime) loadTask(ctx context.Context, containerName string) (containerd.Task, containerd.Status, error) {
+	cntr, err := c.client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return nil, containerd.Status{}, fmt.Errorf("failed to load container %q: %v", containerName, err)
+	}
+	task, err := cntr.Task(ctx, nil)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, containerd.Status{}, fmt.Errorf("container %q is not running", containerName)
+		}
+		return nil, containerd.Status{}, fmt.Errorf("failed to get task of container %q: %v", containerName, err)
+	}
+	status, err := task.Status(ctx)
+	if err != nil {
+		return nil, containerd.Status{}, fmt.Errorf("failed to get task status of container %q: %v", containerName, err)
+	}
+	return task, status, nil
+}
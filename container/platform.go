@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// maxIndexSize is the maximum size of an image index read when checking image platforms.
+const maxIndexSize = 4 << 20
+
+// platformKey is the key type for accessing the image platform in passed contexts.
+type platformKey struct{}
+
+// PlatformInto is used to store the platform of the images to pull into a context, e.g. "linux/arm64".
+func PlatformInto(ctx context.Context, platform string) context.Context {
+	return context.WithValue(ctx, platformKey{}, platform)
+}
+
+// platformFrom returns the platform stored in the context, defaulting to the host platform.
+func platformFrom(ctx context.Context) (ocispec.Platform, error) {
+	platform, ok := ctx.Value(platformKey{}).(string)
+	if !ok || platform == "" {
+		return platforms.DefaultSpec(), nil
+	}
+	p, err := platforms.Parse(platform)
+	if err != nil {
+		return ocispec.Platform{}, fmt.Errorf("invalid platform %q: %v", platform, err)
+	}
+	return p, nil
+}
+
+// checkPlatform verifies that the image, if it is a multi-platform image, has a manifest for the
+// platform, so that a missing architecture is reported before anything is downloaded.
+// Single-platform images are checked against their configuration when unpacking.
+func (c *containerdRuntime) checkPlatform(ctx context.Context, ref string, platform ocispec.Platform) error {
+	resolver := c.resolver(ctx)
+	name, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("failed to resolve image %q: %v", ref, err)
+	}
+
+	if desc.MediaType != ocispec.MediaTypeImageIndex && desc.MediaType != images.MediaTypeDockerSchema2ManifestList {
+		return nil
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to get fetcher for image %q: %v", ref, err)
+	}
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return fmt.Errorf("failed to fetch manifest list of image %q: %v", ref, err)
+	}
+	defer rc.Close()
+
+	var index ocispec.Index
+	if err := json.NewDecoder(io.LimitReader(rc, maxIndexSize)).Decode(&index); err != nil {
+		return fmt.Errorf("failed to decode manifest list of image %q: %v", ref, err)
+	}
+
+	return matchPlatform(ref, index, platform)
+}
+
+// matchPlatform returns an error listing the available platforms if none of the manifests of the
+// index match the platform.
+func matchPlatform(ref string, index ocispec.Index, platform ocispec.Platform) error {
+	matcher := platforms.Only(platform)
+	available := []string{}
+	for _, m := range index.Manifests {
+		if m.Platform == nil {
+			continue
+		}
+		if matcher.Match(*m.Platform) {
+			return nil
+		}
+		available = append(available, platforms.Format(*m.Platform))
+	}
+	return fmt.Errorf("image %q is not available for platform %s, available platforms: %s",
+		ref, platforms.Format(platform), strings.Join(available, ", "))
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/platforms"
+	. "github.com/onsi/gomega"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPlatformFrom(t *testing.T) {
+	g := NewWithT(t)
+
+	platform, err := platformFrom(context.Background())
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(platform).To(Equal(platforms.DefaultSpec()))
+
+	platform, err = platformFrom(PlatformInto(context.Background(), "linux/arm64"))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(platform).To(Equal(ocispec.Platform{OS: "linux", Architecture: "arm64"}))
+
+	_, err = platformFrom(PlatformInto(context.Background(), "linux/arm64/v8/extra"))
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func TestMatchPlatform(t *testing.T) {
+	g := NewWithT(t)
+
+	index := ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			{Platform: &ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+			{Platform: &ocispec.Platform{OS: "linux", Architecture: "arm64"}},
+		},
+	}
+
+	g.Expect(matchPlatform("kindest/node", index, ocispec.Platform{OS: "linux", Architecture: "arm64"})).To(Succeed())
+
+	err := matchPlatform("kindest/node", index, ocispec.Platform{OS: "linux", Architecture: "s390x"})
+	g.Expect(err).Should(MatchError(ContainSubstring("available platforms: linux/amd64, linux/arm64")))
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+// portAllocator hands out free host ports for port mappings that do not request one.
+// The allocated ports are only reserved in memory, as the portmap plugin programs
+// forwarding rules without listening on them.
+type portAllocator struct {
+	mu       sync.Mutex
+	reserved map[string]bool
+}
+
+func newPortAllocator() *portAllocator {
+	return &portAllocator{reserved: map[string]bool{}}
+}
+
+// allocate returns the port mappings with a free host port set on those without one. The host
+// ports requested by the mappings must not be reserved for another container.
+func (a *portAllocator) allocate(mappings []container.PortMapping) ([]container.PortMapping, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]container.PortMapping, 0, len(mappings))
+	for _, pm := range mappings {
+		if pm.HostPort == 0 {
+			port, err := a.freePort(pm.ListenAddress, pm.Protocol)
+			if err != nil {
+				a.releaseLocked(result)
+				return nil, fmt.Errorf("failed to allocate host port for container port %d: %v", pm.ContainerPort, err)
+			}
+			pm.HostPort = port
+		} else if a.reserved[portKey(pm)] {
+			a.releaseLocked(result)
+			return nil, fmt.Errorf("host port %s is already allocated", portKey(pm))
+		}
+		a.reserved[portKey(pm)] = true
+		result = append(result, pm)
+	}
+	return result, nil
+}
+
+// release makes the host ports of the mappings available again.
+func (a *portAllocator) release(mappings []container.PortMapping) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.releaseLocked(mappings)
+}
+
+func (a *portAllocator) releaseLocked(mappings []container.PortMapping) {
+	for _, pm := range mappings {
+		delete(a.reserved, portKey(pm))
+	}
+}
+
+// freePort asks the kernel for a free port on the address, retrying while it returns
+// one that is reserved for another container.
+func (a *portAllocator) freePort(address, protocol string) (int32, error) {
+	for i := 0; i < 10; i++ {
+		port, err := freePort(address, protocol)
+		if err != nil {
+			return 0, err
+		}
+		if !a.reserved[portKey(container.PortMapping{HostPort: port, Protocol: protocol})] {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port found")
+}
+
+func freePort(address, protocol string) (int32, error) {
+	hostPort := net.JoinHostPort(address, "0")
+	if protocol == "udp" {
+		conn, err := net.ListenPacket("udp", hostPort)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		return int32(conn.LocalAddr().(*net.UDPAddr).Port), nil
+	}
+	// SCTP ports share the TCP number space in practice, use a TCP listener for both.
+	listener, err := net.Listen("tcp", hostPort)
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return int32(listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+// portKey identifies a host port, ports are reserved across all addresses.
+func portKey(pm container.PortMapping) string {
+	return fmt.Sprintf("%d/%s", pm.HostPort, protocolOrDefault(pm.Protocol))
+}
+
+func protocolOrDefault(protocol string) string {
+	if protocol == "" {
+		return "tcp"
+	}
+	return strings.ToLower(protocol)
+}
+
+// portMappingsFromLabels returns the port mappings recorded in the container labels.
+func portMappingsFromLabels(labels map[string]string) ([]container.PortMapping, error) {
+	data, ok := labels[portsLabel]
+	if !ok {
+		return nil, nil
+	}
+	mappings := []container.PortMapping{}
+	if err := json.Unmarshal([]byte(data), &mappings); err != nil {
+		return nil, fmt.Errorf("failed to parse port mappings: %v", err)
+	}
+	return mappings, nil
+}
+
+// hostPort returns the host port mapped to the container port given as "port/protocol",
+// the protocol defaulting to tcp.
+func hostPort(mappings []container.PortMapping, portAndProtocol string) (string, error) {
+	parts := strings.SplitN(portAndProtocol, "/", 2)
+	port, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid port %q: %v", portAndProtocol, err)
+	}
+	protocol := "tcp"
+	if len(parts) == 2 {
+		protocol = protocolOrDefault(parts[1])
+	}
+
+	for _, pm := range mappings {
+		if pm.ContainerPort == int32(port) && protocolOrDefault(pm.Protocol) == protocol {
+			return strconv.Itoa(int(pm.HostPort)), nil
+		}
+	}
+	return "", fmt.Errorf("no host port mapped to %s", portAndProtocol)
+}
+
+// cniPortMapping is the entry format of the portMappings capability of the CNI portmap plugin.
+type cniPortMapping struct {
+	HostPort      int32  `json:"hostPort"`
+	ContainerPort int32  `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+	HostIP        string `json:"hostIP,omitempty"`
+}
+
+// cniPortMappings translates the port mappings into the portmap plugin capability arguments.
+func cniPortMappings(mappings []container.PortMapping) []cniPortMapping {
+	result := make([]cniPortMapping, 0, len(mappings))
+	for _, pm := range mappings {
+		hostIP := pm.ListenAddress
+		// The plugin forwards all addresses when no host IP is set.
+		if ip := net.ParseIP(hostIP); ip != nil && ip.IsUnspecified() {
+			hostIP = ""
+		}
+		result = append(result, cniPortMapping{
+			HostPort:      pm.HostPort,
+			ContainerPort: pm.ContainerPort,
+			Protocol:      protocolOrDefault(pm.Protocol),
+			HostIP:        hostIP,
+		})
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+func TestPortAllocator(t *testing.T) {
+	g := NewWithT(t)
+
+	a := newPortAllocator()
+	mappings, err := a.allocate([]container.PortMapping{
+		{ContainerPort: 6443, ListenAddress: "127.0.0.1", Protocol: "tcp"},
+		{ContainerPort: 53, HostPort: 5353, Protocol: "udp"},
+	})
+
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(mappings).To(HaveLen(2))
+	g.Expect(mappings[0].HostPort).ToNot(BeZero())
+	g.Expect(mappings[1].HostPort).To(Equal(int32(5353)))
+	g.Expect(a.reserved).To(HaveLen(2))
+
+	a.release(mappings)
+	g.Expect(a.reserved).To(BeEmpty())
+}
+
+func TestPortAllocatorConflict(t *testing.T) {
+	g := NewWithT(t)
+
+	a := newPortAllocator()
+	_, err := a.allocate([]container.PortMapping{{ContainerPort: 53, HostPort: 5353, Protocol: "udp"}})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	_, err = a.allocate([]container.PortMapping{
+		{ContainerPort: 6443, HostPort: 6443},
+		{ContainerPort: 53, HostPort: 5353, Protocol: "UDP"},
+	})
+	g.Expect(err).Should(MatchError(ContainSubstring("5353/udp")))
+	// The ports reserved before the conflict are released.
+	g.Expect(a.reserved).To(HaveLen(1))
+
+	_, err = a.allocate([]container.PortMapping{{ContainerPort: 53, HostPort: 5353, Protocol: "tcp"}})
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestHostPort(t *testing.T) {
+	mappings := []container.PortMapping{
+		{ContainerPort: 6443, HostPort: 32768, Protocol: "tcp"},
+		{ContainerPort: 53, HostPort: 5353, Protocol: "udp"},
+	}
+
+	tests := []struct {
+		name            string
+		portAndProtocol string
+		want            string
+		wantErr         bool
+	}{
+		{name: "tcp", portAndProtocol: "6443/tcp", want: "32768"},
+		{name: "default protocol", portAndProtocol: "6443", want: "32768"},
+		{name: "udp", portAndProtocol: "53/UDP", want: "5353"},
+		{name: "protocol mismatch", portAndProtocol: "53/tcp", wantErr: true},
+		{name: "invalid port", portAndProtocol: "http/tcp", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			port, err := hostPort(mappings, tt.portAndProtocol)
+			if tt.wantErr {
+				g.Expect(err).Should(HaveOccurred())
+				return
+			}
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(port).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestCNIPortMappings(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(cniPortMappings([]container.PortMapping{
+		{ContainerPort: 6443, HostPort: 32768, ListenAddress: "0.0.0.0", Protocol: "tcp"},
+		{ContainerPort: 6443, HostPort: 32769, ListenAddress: "::"},
+		{ContainerPort: 53, HostPort: 5353, ListenAddress: "127.0.0.1", Protocol: "udp"},
+	})).To(Equal([]cniPortMapping{
+		{HostPort: 32768, ContainerPort: 6443, Protocol: "tcp"},
+		{HostPort: 32769, ContainerPort: 6443, Protocol: "tcp"},
+		{HostPort: 5353, ContainerPort: 53, Protocol: "udp", HostIP: "127.0.0.1"},
+	}))
+}
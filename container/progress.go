@@ -0,0 +1,212 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	units "github.com/docker/go-units"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// pullProgressInterval is how often the progress of a pull is reported.
+const pullProgressInterval = time.Second
+
+// PullStatus is the phase an image pull is in.
+type PullStatus string
+
+const (
+	// PullStatusResolving means the image manifests are being fetched.
+	PullStatusResolving PullStatus = "Resolving"
+	// PullStatusDownloading means the image layers are being downloaded.
+	PullStatusDownloading PullStatus = "Downloading"
+	// PullStatusUnpacking means all the layers are downloaded and being unpacked.
+	PullStatusUnpacking PullStatus = "Unpacking"
+	// PullStatusDone means the image is pulled and unpacked.
+	PullStatusDone PullStatus = "Done"
+)
+
+// PullProgress is the progress of an image pull.
+type PullProgress struct {
+	// Image is the reference of the image being pulled.
+	Image string
+	// Status is the phase the pull is in.
+	Status PullStatus
+	// LayersDone is the number of layers downloaded.
+	LayersDone int
+	// LayersTotal is the number of layers of the image.
+	LayersTotal int
+	// BytesDone is the number of layer bytes downloaded, including partial downloads.
+	BytesDone int64
+	// BytesTotal is the size of the layers of the image.
+	BytesTotal int64
+}
+
+// String formats the progress for humans, e.g. to be used as a condition message.
+func (p PullProgress) String() string {
+	switch p.Status {
+	case PullStatusDownloading:
+		return fmt.Sprintf("Pulling image %s: %d/%d layers, %s/%s", p.Image, p.LayersDone, p.LayersTotal,
+			units.HumanSize(float64(p.BytesDone)), units.HumanSize(float64(p.BytesTotal)))
+	case PullStatusUnpacking:
+		return fmt.Sprintf("Unpacking image %s: %d layers, %s", p.Image, p.LayersTotal, units.HumanSize(float64(p.BytesTotal)))
+	case PullStatusDone:
+		return fmt.Sprintf("Pulled image %s", p.Image)
+	default:
+		return fmt.Sprintf("Resolving image %s", p.Image)
+	}
+}
+
+// PullProgressFunc is called with the progress of image pulls. It is called from a separate goroutine.
+type PullProgressFunc func(PullProgress)
+
+// pullProgressKey is the key type for accessing the pull progress callback in passed contexts.
+type pullProgressKey struct{}
+
+// PullProgressInto is used to store a callback receiving the progress of image pulls into a context.
+func PullProgressInto(ctx context.Context, fn PullProgressFunc) context.Context {
+	return context.WithValue(ctx, pullProgressKey{}, fn)
+}
+
+// pullProgressFrom returns the pull progress callback stored in the context, if any.
+func pullProgressFrom(ctx context.Context) PullProgressFunc {
+	if fn, ok := ctx.Value(pullProgressKey{}).(PullProgressFunc); ok {
+		return fn
+	}
+	return nil
+}
+
+// pullTracker computes the progress of a pull from the layers of the image manifest and the
+// state of the content store.
+type pullTracker struct {
+	image  string
+	store  content.Store
+	report PullProgressFunc
+
+	mu     sync.Mutex
+	layers map[digest.Digest]int64
+}
+
+func newPullTracker(image string, store content.Store, report PullProgressFunc) *pullTracker {
+	return &pullTracker{
+		image:  image,
+		store:  store,
+		report: report,
+		layers: map[digest.Digest]int64{},
+	}
+}
+
+// handlerWrapper records the layers of the image manifests as they are fetched.
+func (t *pullTracker) handlerWrapper(f images.Handler) images.Handler {
+	return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		children, err := f.Handle(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		switch desc.MediaType {
+		case ocispec.MediaTypeImageManifest, images.MediaTypeDockerSchema2Manifest:
+			t.mu.Lock()
+			for _, c := range children {
+				if images.IsLayerType(c.MediaType) {
+					t.layers[c.Digest] = c.Size
+				}
+			}
+			t.mu.Unlock()
+		}
+		return children, nil
+	})
+}
+
+// start reports the progress periodically until the returned function is called. Calling the
+// returned function more than once is safe.
+func (t *pullTracker) start(ctx context.Context) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(pullProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.report(t.progress(ctx))
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// progress returns the current progress of the pull.
+func (t *pullTracker) progress(ctx context.Context) PullProgress {
+	t.mu.Lock()
+	layers := make(map[digest.Digest]int64, len(t.layers))
+	for dgst, size := range t.layers {
+		layers[dgst] = size
+	}
+	t.mu.Unlock()
+
+	p := PullProgress{Image: t.image, Status: PullStatusResolving, LayersTotal: len(layers)}
+	if len(layers) == 0 {
+		return p
+	}
+
+	// Partial downloads are tracked as active ingests.
+	active := map[digest.Digest]int64{}
+	if statuses, err := t.store.ListStatuses(ctx); err == nil {
+		for _, s := range statuses {
+			active[s.Expected] = s.Offset
+		}
+	}
+
+	for dgst, size := range layers {
+		p.BytesTotal += size
+		if _, err := t.store.Info(ctx, dgst); err == nil {
+			p.LayersDone++
+			p.BytesDone += size
+			continue
+		}
+		p.BytesDone += active[dgst]
+	}
+
+	p.Status = PullStatusDownloading
+	if p.LayersDone == p.LayersTotal {
+		p.Status = PullStatusUnpacking
+	}
+	return p
+}
+
+// done reports the pull as completed.
+func (t *pullTracker) done(ctx context.Context) {
+	p := t.progress(ctx)
+	p.Status = PullStatusDone
+	p.LayersDone = p.LayersTotal
+	p.BytesDone = p.BytesTotal
+	t.report(p)
+}
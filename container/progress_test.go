@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/images"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPullTrackerProgress(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	store, err := local.NewStore(t.TempDir())
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	layer1 := []byte("layer one")
+	layer2 := []byte("layer two, a bit longer")
+	desc1 := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromBytes(layer1), Size: int64(len(layer1))}
+	desc2 := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromBytes(layer2), Size: int64(len(layer2))}
+
+	tracker := newPullTracker("docker.io/kindest/node:v1.23.6", store, func(PullProgress) {})
+	g.Expect(tracker.progress(ctx).Status).To(Equal(PullStatusResolving))
+
+	handler := tracker.handlerWrapper(images.HandlerFunc(func(_ context.Context, _ ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		return []ocispec.Descriptor{{MediaType: ocispec.MediaTypeImageConfig}, desc1, desc2}, nil
+	}))
+	_, err = handler.Handle(ctx, ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Expect(content.WriteBlob(ctx, store, "layer1", bytes.NewReader(layer1), desc1)).To(Succeed())
+
+	g.Expect(tracker.progress(ctx)).To(Equal(PullProgress{
+		Image:       "docker.io/kindest/node:v1.23.6",
+		Status:      PullStatusDownloading,
+		LayersDone:  1,
+		LayersTotal: 2,
+		BytesDone:   desc1.Size,
+		BytesTotal:  desc1.Size + desc2.Size,
+	}))
+
+	g.Expect(content.WriteBlob(ctx, store, "layer2", bytes.NewReader(layer2), desc2)).To(Succeed())
+	g.Expect(tracker.progress(ctx).Status).To(Equal(PullStatusUnpacking))
+}
+
+func TestPullProgressString(t *testing.T) {
+	g := NewWithT(t)
+
+	p := PullProgress{
+		Image:       "docker.io/kindest/node:v1.23.6",
+		Status:      PullStatusDownloading,
+		LayersDone:  3,
+		LayersTotal: 9,
+		BytesDone:   120 * 1000 * 1000,
+		BytesTotal:  400 * 1000 * 1000,
+	}
+	g.Expect(p.String()).To(Equal("Pulling image docker.io/kindest/node:v1.23.6: 3/9 layers, 120MB/400MB"))
+}
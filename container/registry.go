@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/containerd/containerd/remotes/docker/config"
+)
+
+// mirrorsKey is the key type for accessing registry mirrors in passed contexts.
+type mirrorsKey struct{}
+
+// RegistryMirror configures the endpoints used to pull images from a registry.
+type RegistryMirror struct {
+	// Registry is the registry host the configuration applies to, e.g. "docker.io".
+	Registry string
+	// Endpoints are the mirrors to try, in order, before the registry itself,
+	// e.g. "https://mirror.example.com:5000".
+	Endpoints []string
+	// Insecure allows plain HTTP for endpoints without a scheme and skips TLS verification.
+	Insecure bool
+	// CACert is a PEM encoded CA bundle used to verify the endpoints and the registry.
+	CACert []byte
+}
+
+// RegistryMirrorsInto is used to store registry mirrors into a context. Mirrors in the context take
+// precedence over the registry hosts configuration of the runtime client.
+func RegistryMirrorsInto(ctx context.Context, mirrors []RegistryMirror) context.Context {
+	byRegistry := map[string]RegistryMirror{}
+	for _, m := range mirrors {
+		byRegistry[m.Registry] = m
+	}
+	return context.WithValue(ctx, mirrorsKey{}, byRegistry)
+}
+
+// registryMirrorsFrom returns the registry mirrors stored in the context, indexed by registry.
+func registryMirrorsFrom(ctx context.Context) map[string]RegistryMirror {
+	if mirrors, ok := ctx.Value(mirrorsKey{}).(map[string]RegistryMirror); ok {
+		return mirrors
+	}
+	return nil
+}
+
+// resolver returns the resolver used to pull images, honoring the registry configuration and
+// the credentials and mirrors in the context.
+func (c *containerdRuntime) resolver(ctx context.Context) remotes.Resolver {
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: c.registryHosts(ctx),
+	})
+}
+
+// registryHosts returns the function resolving the endpoints to use for a registry.
+func (c *containerdRuntime) registryHosts(ctx context.Context) docker.RegistryHosts {
+	creds := registryCredentialsFrom(ctx)
+
+	options := config.HostOptions{
+		Credentials: creds.lookup,
+	}
+	if c.registryConfigPath != "" {
+		options.HostDir = config.HostDirFromRoot(c.registryConfigPath)
+	}
+	configuredHosts := config.ConfigureHosts(ctx, options)
+
+	mirrors := registryMirrorsFrom(ctx)
+	return func(host string) ([]docker.RegistryHost, error) {
+		if mirror, ok := mirrors[host]; ok {
+			return mirror.registryHosts(creds)
+		}
+		return configuredHosts(host)
+	}
+}
+
+// registryHosts returns the mirror endpoints followed by the registry itself.
+func (m RegistryMirror) registryHosts(creds RegistryCredentials) ([]docker.RegistryHost, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: m.Insecure, //nolint:gosec // Explicitly requested for insecure registries.
+	}
+	if len(m.CACert) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(m.CACert) {
+			return nil, fmt.Errorf("failed to load CA certificate for registry %q", m.Registry)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport}
+	authorizer := docker.NewDockerAuthorizer(docker.WithAuthClient(client), docker.WithAuthCreds(creds.lookup))
+
+	defaultScheme := "https"
+	if m.Insecure {
+		defaultScheme = "http"
+	}
+
+	hosts := []docker.RegistryHost{}
+	for _, endpoint := range m.Endpoints {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = fmt.Sprintf("%s://%s", defaultScheme, endpoint)
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror endpoint %q for registry %q: %v", endpoint, m.Registry, err)
+		}
+		path := strings.TrimSuffix(u.Path, "/")
+		if path == "" {
+			path = "/v2"
+		}
+		hosts = append(hosts, docker.RegistryHost{
+			Client:       client,
+			Authorizer:   authorizer,
+			Host:         u.Host,
+			Scheme:       u.Scheme,
+			Path:         path,
+			Capabilities: docker.HostCapabilityPull | docker.HostCapabilityResolve,
+		})
+	}
+
+	registry := m.Registry
+	if registry == "docker.io" {
+		registry = dockerHubHost
+	}
+	hosts = append(hosts, docker.RegistryHost{
+		Client:       client,
+		Authorizer:   authorizer,
+		Host:         registry,
+		Scheme:       "https",
+		Path:         "/v2",
+		Capabilities: docker.HostCapabilityPull | docker.HostCapabilityResolve | docker.HostCapabilityPush,
+	})
+
+	return hosts, nil
+}
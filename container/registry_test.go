@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRegistryHosts(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := RegistryMirrorsInto(context.Background(), []RegistryMirror{
+		{
+			Registry:  "docker.io",
+			Endpoints: []string{"mirror.example.com:5000", "https://proxy.example.com/v2/kindest"},
+			Insecure:  true,
+		},
+	})
+	c := &containerdRuntime{}
+
+	hosts, err := c.registryHosts(ctx)("docker.io")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(hosts).To(HaveLen(3))
+
+	g.Expect(hosts[0].Scheme).To(Equal("http"))
+	g.Expect(hosts[0].Host).To(Equal("mirror.example.com:5000"))
+	g.Expect(hosts[0].Path).To(Equal("/v2"))
+
+	g.Expect(hosts[1].Scheme).To(Equal("https"))
+	g.Expect(hosts[1].Host).To(Equal("proxy.example.com"))
+	g.Expect(hosts[1].Path).To(Equal("/v2/kindest"))
+
+	g.Expect(hosts[2].Scheme).To(Equal("https"))
+	g.Expect(hosts[2].Host).To(Equal(dockerHubHost))
+
+	// Registries without mirrors use the default configuration.
+	hosts, err = c.registryHosts(ctx)("quay.io")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(hosts).To(HaveLen(1))
+	g.Expect(hosts[0].Host).To(Equal("quay.io"))
+}
+
+func TestRegistryHostsInvalidCACert(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := RegistryMirrorsInto(context.Background(), []RegistryMirror{
+		{Registry: "registry.example.com", CACert: []byte("not a certificate")},
+	})
+
+	_, err := (&containerdRuntime{}).registryHosts(ctx)("registry.example.com")
+	g.Expect(err).Should(HaveOccurred())
+}
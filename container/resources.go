@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// cpuPeriod is the CFS scheduler period in microseconds the CPU limits are enforced over.
+const cpuPeriod = 100000
+
+// resourceLimitsKey is the key type for accessing the resource limits in passed contexts.
+type resourceLimitsKey struct{}
+
+// ResourceLimits limits the host resources a container can use. Zero values set no limit.
+type ResourceLimits struct {
+	// MilliCPUs is the CPU time the container can use, in thousandths of a CPU.
+	MilliCPUs int64
+	// Memory is the memory the container can use in bytes, without swap.
+	Memory int64
+	// Pids is the number of processes the container can run.
+	Pids int64
+}
+
+// ResourceLimitsInto is used to store the resource limits of the containers run with a context.
+func ResourceLimitsInto(ctx context.Context, limits ResourceLimits) context.Context {
+	return context.WithValue(ctx, resourceLimitsKey{}, limits)
+}
+
+// resourceLimitsFrom returns the resource limits stored in the context, no limits if none.
+func resourceLimitsFrom(ctx context.Context) ResourceLimits {
+	if limits, ok := ctx.Value(resourceLimitsKey{}).(ResourceLimits); ok {
+		return limits
+	}
+	return ResourceLimits{}
+}
+
+// validate returns an error if a limit is negative, or too low for a process to run.
+func (r ResourceLimits) validate() error {
+	switch {
+	case r.MilliCPUs < 0:
+		return fmt.Errorf("invalid CPU limit %dm", r.MilliCPUs)
+	case r.MilliCPUs > 0 && r.MilliCPUs*cpuPeriod/1000 < 1000:
+		// The kernel rejects CFS quotas below 1ms.
+		return fmt.Errorf("CPU limit %dm is below the minimum of 10m", r.MilliCPUs)
+	case r.Memory < 0:
+		return fmt.Errorf("invalid memory limit %d", r.Memory)
+	case r.Pids < 0:
+		return fmt.Errorf("invalid pids limit %d", r.Pids)
+	}
+	return nil
+}
+
+// specOpts returns the options setting the limits in the linux resources of the OCI spec.
+func (r ResourceLimits) specOpts() []oci.SpecOpts {
+	var opts []oci.SpecOpts
+	if r.MilliCPUs > 0 {
+		opts = append(opts, oci.WithCPUCFS(r.MilliCPUs*cpuPeriod/1000, cpuPeriod))
+	}
+	if r.Memory > 0 {
+		opts = append(opts, oci.WithMemoryLimit(uint64(r.Memory)), withMemorySwap(r.Memory))
+	}
+	if r.Pids > 0 {
+		opts = append(opts, oci.WithPidsLimit(r.Pids))
+	}
+	return opts
+}
+
+// withMemorySwap sets the memory and swap limit of the container, equal to its memory limit so that
+// it cannot swap, like the kubelet requires.
+func withMemorySwap(limit int64) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Linux == nil {
+			s.Linux = &specs.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &specs.LinuxResources{}
+		}
+		if s.Linux.Resources.Memory == nil {
+			s.Linux.Resources.Memory = &specs.LinuxMemory{}
+		}
+		s.Linux.Resources.Memory.Swap = &limit
+		return nil
+	}
+}
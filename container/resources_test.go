@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestResourceLimitsSpecOpts(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ResourceLimits{}.specOpts()).To(BeEmpty())
+
+	limits := ResourceLimits{MilliCPUs: 1500, Memory: 2 << 30, Pids: 4096}
+	g.Expect(limits.validate()).To(Succeed())
+	s := &oci.Spec{Linux: &specs.Linux{}}
+	for _, opt := range limits.specOpts() {
+		g.Expect(opt(context.Background(), nil, nil, s)).To(Succeed())
+	}
+	g.Expect(*s.Linux.Resources.CPU.Quota).To(Equal(int64(150000)))
+	g.Expect(*s.Linux.Resources.CPU.Period).To(Equal(uint64(100000)))
+	g.Expect(*s.Linux.Resources.Memory.Limit).To(Equal(int64(2 << 30)))
+	g.Expect(*s.Linux.Resources.Memory.Swap).To(Equal(int64(2 << 30)))
+	g.Expect(s.Linux.Resources.Pids.Limit).To(Equal(int64(4096)))
+
+	g.Expect(ResourceLimits{MilliCPUs: 5}.validate()).ToNot(Succeed())
+	g.Expect(ResourceLimits{Memory: -1}.validate()).ToNot(Succeed())
+}
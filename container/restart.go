@@ -0,0 +1,203 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// RestartPolicyLabel is the container label holding the restart policy of a container:
+	// "no", "always" or "on-failure[:max-retries]". containerd has no restart policies, containers
+	// with this label are restarted by MonitorRestarts, unless they were stopped on purpose.
+	RestartPolicyLabel = "io.x-k8s.capc.restart-policy"
+
+	// RestartPolicyNo never restarts the container.
+	RestartPolicyNo = "no"
+	// RestartPolicyAlways restarts the container whenever it exits.
+	RestartPolicyAlways = "always"
+	// RestartPolicyOnFailure restarts the container when it exits with a non-zero code.
+	RestartPolicyOnFailure = "on-failure"
+
+	// restartCountLabel is the container label holding the number of times the container was restarted.
+	restartCountLabel = "io.x-k8s.capc.restart-count"
+
+	// stoppedLabel is the container label marking a container stopped on purpose, e.g. killed with a
+	// stop signal, which is not restarted whatever its restart policy.
+	stoppedLabel = "io.x-k8s.capc.stopped"
+
+	// restartGracePeriod is the time after creation during which a container without a task is
+	// considered as being started by RunContainer rather than dead.
+	restartGracePeriod = time.Minute
+)
+
+// restartPolicy is a parsed restart policy.
+type restartPolicy struct {
+	name       string
+	maxRetries int
+}
+
+// parseRestartPolicy parses a restart policy label value.
+func parseRestartPolicy(policy string) (restartPolicy, error) {
+	parts := strings.SplitN(policy, ":", 2)
+	p := restartPolicy{name: parts[0]}
+	switch p.name {
+	case RestartPolicyNo, RestartPolicyAlways:
+		if len(parts) > 1 {
+			return restartPolicy{}, fmt.Errorf("restart policy %q does not accept a maximum retry count", p.name)
+		}
+	case RestartPolicyOnFailure:
+		if len(parts) > 1 {
+			retries, err := strconv.Atoi(parts[1])
+			if err != nil || retries < 0 {
+				return restartPolicy{}, fmt.Errorf("invalid maximum retry count in restart policy %q", policy)
+			}
+			p.maxRetries = retries
+		}
+	default:
+		return restartPolicy{}, fmt.Errorf("unsupported restart policy %q", policy)
+	}
+	return p, nil
+}
+
+// shouldRestart returns true if a container that exited with the given code and was already
+// restarted restartCount times must be restarted.
+func (p restartPolicy) shouldRestart(exitCode uint32, restartCount int) bool {
+	switch p.name {
+	case RestartPolicyAlways:
+		return true
+	case RestartPolicyOnFailure:
+		return exitCode != 0 && (p.maxRetries == 0 || restartCount < p.maxRetries)
+	default:
+		return false
+	}
+}
+
+// MonitorRestarts checks the containers with a restart policy of all the runtime namespaces every
+// interval and restarts the ones that exited, until the context is cancelled.
+func (c *containerdRuntime) MonitorRestarts(ctx context.Context, interval time.Duration) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			namespaceNames, err := c.ListNamespaces(ctx)
+			if err != nil {
+				log.Error(err, "Failed to list namespaces")
+				continue
+			}
+			for _, namespace := range namespaceNames {
+				c.restartExited(namespaces.WithNamespace(ctx, namespace), log.WithValues("namespace", namespace))
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// restartExited restarts the exited containers of the namespace in the context that have a restart
+// policy requiring it.
+func (c *containerdRuntime) restartExited(ctx context.Context, log logr.Logger) {
+	cntrs, err := c.client.Containers(ctx, fmt.Sprintf("labels.%q", RestartPolicyLabel))
+	if err != nil {
+		log.Error(err, "Failed to list containers")
+		return
+	}
+	for _, cntr := range cntrs {
+		restarted, err := c.restartIfExited(ctx, cntr)
+		if err != nil {
+			log.Error(err, "Failed to restart container", "container", cntr.ID())
+			continue
+		}
+		if restarted {
+			log.Info("Restarted exited container", "container", cntr.ID())
+		}
+	}
+}
+
+// restartIfExited restarts the container if it exited and its restart policy requires it, unless it
+// was stopped on purpose.
+func (c *containerdRuntime) restartIfExited(ctx context.Context, cntr containerd.Container) (bool, error) {
+	info, err := cntr.Info(ctx, containerd.WithoutRefreshedMetadata)
+	if err != nil {
+		return false, err
+	}
+
+	if info.Labels[stoppedLabel] == "true" {
+		return false, nil
+	}
+	policy, err := parseRestartPolicy(info.Labels[RestartPolicyLabel])
+	if err != nil {
+		return false, err
+	}
+
+	status, err := containerStatus(ctx, cntr)
+	if err != nil {
+		return false, err
+	}
+
+	switch status.Status {
+	case containerd.Stopped:
+	case containerd.Created:
+		// Without a task, the container is either being started or its task was lost,
+		// e.g. because containerd or the host restarted.
+		if time.Since(info.CreatedAt) < restartGracePeriod {
+			return false, nil
+		}
+	default:
+		return false, nil
+	}
+
+	restartCount, _ := strconv.Atoi(info.Labels[restartCountLabel])
+	if !policy.shouldRestart(status.ExitStatus, restartCount) {
+		return false, nil
+	}
+
+	if err := c.deleteTask(ctx, cntr); err != nil && !errdefs.IsNotFound(err) {
+		return false, fmt.Errorf("failed to delete exited task: %v", err)
+	}
+
+	logConfig, err := c.logConfigFromLabels(info.Labels)
+	if err != nil {
+		return false, err
+	}
+	ioCreator, err := c.taskLog(cntr.ID(), logConfig)
+	if err != nil {
+		return false, err
+	}
+	task, err := cntr.NewTask(ctx, ioCreator)
+	if err != nil {
+		return false, fmt.Errorf("failed to create task: %v", err)
+	}
+	if err := task.Start(ctx); err != nil {
+		_, _ = task.Delete(ctx, containerd.WithProcessKill)
+		return false, fmt.Errorf("failed to start task: %v", err)
+	}
+
+	if _, err := cntr.SetLabels(ctx, map[string]string{restartCountLabel: strconv.Itoa(restartCount + 1)}); err != nil {
+		return true, fmt.Errorf("failed to update restart count: %v", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/errdefs"
+	. "github.com/onsi/gomega"
+)
+
+func TestRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy       string
+		exitCode     uint32
+		restartCount int
+		want         bool
+	}{
+		{policy: "no", exitCode: 1, want: false},
+		{policy: "always", exitCode: 0, want: true},
+		{policy: "always", exitCode: 1, restartCount: 100, want: true},
+		{policy: "on-failure", exitCode: 0, want: false},
+		{policy: "on-failure", exitCode: 137, restartCount: 100, want: true},
+		{policy: "on-failure:3", exitCode: 1, restartCount: 2, want: true},
+		{policy: "on-failure:3", exitCode: 1, restartCount: 3, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p, err := parseRestartPolicy(tt.policy)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(p.shouldRestart(tt.exitCode, tt.restartCount)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestParseRestartPolicyInvalid(t *testing.T) {
+	for _, policy := range []string{"", "unless-stopped", "always:3", "on-failure:-1", "on-failure:x"} {
+		t.Run(policy, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := parseRestartPolicy(policy)
+			g.Expect(err).Should(HaveOccurred())
+		})
+	}
+}
+
+// exitedContainer is a container whose task exited, or that has no task if status is nil. Restarting
+// it records the new task without starting it.
+type exitedContainer struct {
+	containerd.Container
+	info    containers.Container
+	status  *containerd.Status
+	newTask bool
+}
+
+func (c *exitedContainer) ID() string {
+	return c.info.ID
+}
+
+func (c *exitedContainer) Info(ctx context.Context, opts ...containerd.InfoOpts) (containers.Container, error) {
+	return c.info, nil
+}
+
+func (c *exitedContainer) Task(ctx context.Context, attach cio.Attach) (containerd.Task, error) {
+	if c.status == nil {
+		return nil, errdefs.ErrNotFound
+	}
+	return &exitedTask{status: *c.status}, nil
+}
+
+func (c *exitedContainer) NewTask(ctx context.Context, ioCreate cio.Creator, opts ...containerd.NewTaskOpts) (containerd.Task, error) {
+	c.newTask = true
+	return nil, errors.New("not started")
+}
+
+type exitedTask struct {
+	containerd.Task
+	status containerd.Status
+}
+
+func (t *exitedTask) Status(ctx context.Context) (containerd.Status, error) {
+	return t.status, nil
+}
+
+func (t *exitedTask) Delete(ctx context.Context, opts ...containerd.ProcessDeleteOpts) (*containerd.ExitStatus, error) {
+	return containerd.NewExitStatus(t.status.ExitStatus, t.status.ExitTime, nil), nil
+}
+
+func TestRestartIfExited(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		labels    map[string]string
+		createdAt time.Time
+		status    *containerd.Status
+		want      bool
+	}{
+		{
+			name:      "exited",
+			labels:    map[string]string{RestartPolicyLabel: RestartPolicyAlways},
+			createdAt: old,
+			status:    &containerd.Status{Status: containerd.Stopped, ExitStatus: 137},
+			want:      true,
+		},
+		{
+			name:      "exited without restart policy",
+			labels:    map[string]string{RestartPolicyLabel: RestartPolicyNo},
+			createdAt: old,
+			status:    &containerd.Status{Status: containerd.Stopped, ExitStatus: 137},
+		},
+		{
+			name:      "running",
+			labels:    map[string]string{RestartPolicyLabel: RestartPolicyAlways},
+			createdAt: old,
+			status:    &containerd.Status{Status: containerd.Running},
+		},
+		{
+			name:      "task lost",
+			labels:    map[string]string{RestartPolicyLabel: RestartPolicyAlways},
+			createdAt: old,
+			want:      true,
+		},
+		{
+			name:      "being started",
+			labels:    map[string]string{RestartPolicyLabel: RestartPolicyAlways},
+			createdAt: time.Now(),
+		},
+		{
+			name:      "killed",
+			labels:    map[string]string{RestartPolicyLabel: RestartPolicyAlways, stoppedLabel: "true"},
+			createdAt: old,
+			status:    &containerd.Status{Status: containerd.Stopped, ExitStatus: 143},
+		},
+		{
+			// CheckpointContainer with exit deletes the exited task of the container.
+			name:      "checkpointed with exit",
+			labels:    map[string]string{RestartPolicyLabel: RestartPolicyAlways, stoppedLabel: "true"},
+			createdAt: old,
+		},
+		{
+			name:      "restored from a checkpoint",
+			labels:    labelsFromCheckpoint(checkpointLabels(map[string]string{RestartPolicyLabel: RestartPolicyAlways, stoppedLabel: "true"})),
+			createdAt: old,
+			status:    &containerd.Status{Status: containerd.Stopped, ExitStatus: 1},
+			want:      true,
+		},
+		{
+			name:      "deleted task of a killed container",
+			labels:    map[string]string{RestartPolicyLabel: RestartPolicyAlways, stoppedLabel: "true"},
+			createdAt: old,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := &containerdRuntime{stateDir: t.TempDir()}
+			cntr := &exitedContainer{
+				info:   containers.Container{ID: "test-md-0-abc12", Labels: tt.labels, CreatedAt: tt.createdAt},
+				status: tt.status,
+			}
+			_, err := c.restartIfExited(context.Background(), cntr)
+			if tt.want {
+				g.Expect(err).To(MatchError(ContainSubstring("not started")))
+			} else {
+				g.Expect(err).ShouldNot(HaveOccurred())
+			}
+			g.Expect(cntr.newTask).To(Equal(tt.want))
+		})
+	}
+}
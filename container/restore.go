@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/pkg/netns"
+	"github.com/containerd/typeurl"
+	"github.com/go-logr/logr"
+)
+
+// RestoreNetworks brings the network attachments and port mappings recorded in the container labels
+// back in place. The labels are stored by containerd and survive restarts, while the port reservations
+// of the provider, the forwarding rules of the portmap plugin and the network namespaces may not:
+//   - the host ports of all containers are reserved again so they are not handed out twice,
+//   - the forwarding rules of the port mappings are programmed again, as they are lost when the
+//     firewall rules are reloaded,
+//   - containers whose network namespace is gone after a host reboot get a new one, attached to the
+//     same network with the same port mappings, before their task is started again.
+func (c *containerdRuntime) RestoreNetworks(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	namespaceNames, err := c.ListNamespaces(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, namespace := range namespaceNames {
+		nsCtx := namespaces.WithNamespace(ctx, namespace)
+		cntrs, err := c.client.Containers(nsCtx, networkLabelFilters()...)
+		if err != nil {
+			return fmt.Errorf("failed to list containers of namespace %q: %v", namespace, err)
+		}
+
+		for _, cntr := range cntrs {
+			restored, err := c.restoreNetwork(nsCtx, cntr)
+			if err != nil {
+				log.Error(err, "Failed to restore container network", "namespace", namespace, "container", cntr.ID())
+				failed++
+				continue
+			}
+			if restored {
+				log.Info("Restored container network", "namespace", namespace, "container", cntr.ID())
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to restore the network of %d containers", failed)
+	}
+	return nil
+}
+
+// networkLabelFilters returns the filters of the containers with port mappings or a network
+// namespace. containerd matches the containers matching any of the filters, so a container
+// carrying only one of the two labels is listed as well.
+func networkLabelFilters() []string {
+	return []string{fmt.Sprintf("labels.%q", portsLabel), fmt.Sprintf("labels.%q", netnsLabel)}
+}
+
+// restoreNetwork reserves the host ports of the container and restores its network attachment
+// if it is not in place anymore.
+func (c *containerdRuntime) restoreNetwork(ctx context.Context, cntr containerd.Container) (bool, error) {
+	labels, err := cntr.Labels(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get labels: %v", err)
+	}
+
+	ports, err := portMappingsFromLabels(labels)
+	if err != nil {
+		return false, err
+	}
+	if _, err := c.ports.allocate(ports); err != nil {
+		return false, err
+	}
+
+	netnsPath, network := labels[netnsLabel], labels[networkLabel]
+	if netnsPath == "" || c.cni == nil {
+		return false, nil
+	}
+
+	closed, err := netns.LoadNetNS(netnsPath).Closed()
+	if err != nil {
+		return false, fmt.Errorf("failed to check network namespace %q: %v", netnsPath, err)
+	}
+
+	if !closed {
+		// The attachment survived, make sure the forwarding rules of its ports did too.
+		if len(ports) == 0 {
+			return false, nil
+		}
+		result, err := cniResultFromLabels(labels)
+		if err != nil || result == nil {
+			return false, fmt.Errorf("failed to get the CNI result of the attachment: %v", err)
+		}
+		return true, c.cni.republish(ctx, cntr.ID(), network, netnsPath, ports, result)
+	}
+
+	// Release what the previous attachment may still hold, e.g. its IPAM allocation.
+	_ = c.cni.detach(ctx, cntr.ID(), network, netnsPath, ports)
+
+	// A static address is requested again, the others are allocated anew.
+	address, err := staticAddressFromLabels(labels)
+	if err != nil {
+		return false, err
+	}
+	attachment, err := c.cni.setup(ctx, c.stateDir, cntr.ID(), network, ports, address)
+	if err != nil {
+		return false, err
+	}
+	if err := cntr.Update(ctx, withNetNSUpdate(attachment.netnsPath)); err != nil {
+		_ = c.cni.teardown(ctx, cntr.ID(), network, attachment.netnsPath, ports)
+		return false, fmt.Errorf("failed to update network namespace in spec: %v", err)
+	}
+
+	networkLabels, err := attachment.labels()
+	if err != nil {
+		return true, err
+	}
+	if _, err := cntr.SetLabels(ctx, networkLabels); err != nil {
+		return true, fmt.Errorf("failed to update network labels: %v", err)
+	}
+	return true, nil
+}
+
+// withNetNSUpdate updates the spec of the container to join the given network namespace.
+func withNetNSUpdate(netnsPath string) containerd.UpdateContainerOpts {
+	return func(ctx context.Context, client *containerd.Client, c *containers.Container) error {
+		v, err := typeurl.UnmarshalAny(c.Spec)
+		if err != nil {
+			return err
+		}
+		spec, ok := v.(*oci.Spec)
+		if !ok {
+			return fmt.Errorf("unexpected spec type %T", v)
+		}
+		return containerd.WithSpec(spec, withNetNS(netnsPath)...)(ctx, client, c)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/containers"
+	containerdfilters "github.com/containerd/containerd/filters"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/typeurl"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestWithNetNSUpdate(t *testing.T) {
+	g := NewWithT(t)
+
+	spec, err := typeurl.MarshalAny(&oci.Spec{
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.NetworkNamespace, Path: "/var/lib/cluster-api-provider-containerd/netns/cni-old"},
+			},
+		},
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	c := &containers.Container{ID: "test", Spec: spec}
+
+	err = withNetNSUpdate("/var/lib/cluster-api-provider-containerd/netns/cni-new")(context.Background(), nil, c)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	v, err := typeurl.UnmarshalAny(c.Spec)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(v.(*oci.Spec).Linux.Namespaces).To(Equal([]specs.LinuxNamespace{
+		{Type: specs.PIDNamespace},
+		{Type: specs.NetworkNamespace, Path: "/var/lib/cluster-api-provider-containerd/netns/cni-new"},
+	}))
+}
+
+func TestNetworkLabelFilters(t *testing.T) {
+	g := NewWithT(t)
+
+	filter, err := containerdfilters.ParseAll(networkLabelFilters()...)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(filter.Match(testAdaptor{labels: map[string]string{portsLabel: "[]"}})).To(BeTrue())
+	g.Expect(filter.Match(testAdaptor{labels: map[string]string{netnsLabel: "/var/run/netns/cni-test"}})).To(BeTrue())
+	g.Expect(filter.Match(testAdaptor{labels: map[string]string{portsLabel: "[]", netnsLabel: "/var/run/netns/cni-test"}})).To(BeTrue())
+	g.Expect(filter.Match(testAdaptor{labels: map[string]string{networkLabel: "kind"}})).To(BeFalse())
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// connectionCheckInterval is how often the connection to containerd is checked.
+	connectionCheckInterval = 10 * time.Second
+	// connectionCheckTimeout is how long the health service of containerd has to answer a check.
+	connectionCheckTimeout = 5 * time.Second
+)
+
+// RetryConfig bounds the retries of the containerd calls failing with a transient error, e.g. while
+// containerd restarts.
+type RetryConfig struct {
+	// Attempts is the number of times a call is made, 1 to never retry it.
+	Attempts int
+	// InitialDelay is the delay before the first retry, doubled for each following one.
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between retries.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryConfig retries the calls for about 10 seconds, long enough for containerd to restart.
+var DefaultRetryConfig = RetryConfig{Attempts: 6, InitialDelay: 250 * time.Millisecond, MaxDelay: 4 * time.Second}
+
+// WithRetryConfig sets how the containerd calls failing with a transient error are retried.
+func WithRetryConfig(config RetryConfig) Option {
+	return func(c *containerdRuntime) {
+		c.retry = config
+	}
+}
+
+// delay returns the delay before the given retry, the first one being 1.
+func (r RetryConfig) delay(retry int) time.Duration {
+	delay := r.InitialDelay
+	for i := 1; i < retry && delay < r.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxDelay {
+		return r.MaxDelay
+	}
+	return delay
+}
+
+// isTransient returns whether the error of a call means that containerd could not be reached,
+// so that the call can be made again once it is back.
+func isTransient(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+// retryUnaryInterceptor retries the unary calls failing with a transient error with exponential
+// backoff, so that the runtime methods survive a containerd restart. Streams, e.g. the event
+// subscription, are not retried, their users subscribe again. A call whose connection was lost
+// after it reached containerd may be made twice, the second one then fails, e.g. with an
+// already exists error.
+func retryUnaryInterceptor(config RetryConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= config.Attempts || !isTransient(err) {
+				return err
+			}
+			select {
+			case <-time.After(config.delay(attempt)):
+			case <-ctx.Done():
+				return err
+			}
+		}
+	}
+}
+
+// CheckConnection returns an error if containerd does not answer a health check.
+func (c *containerdRuntime) CheckConnection(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, connectionCheckTimeout)
+	defer cancel()
+	serving, err := c.client.IsServing(ctx)
+	if err != nil {
+		return fmt.Errorf("containerd health check failed: %v", err)
+	}
+	if !serving {
+		return fmt.Errorf("containerd is not serving")
+	}
+	return nil
+}
+
+// MonitorConnection checks the connection to containerd periodically, until the context is
+// cancelled. The connection is re-established when containerd stops answering, e.g. after it
+// restarted with a new socket.
+func (c *containerdRuntime) MonitorConnection(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	ticker := time.NewTicker(connectionCheckInterval)
+	defer ticker.Stop()
+	healthy := true
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+
+		err := c.CheckConnection(ctx)
+		switch {
+		case err == nil:
+			if !healthy {
+				log.Info("Containerd connection restored")
+			}
+			healthy = true
+			continue
+		case ctx.Err() != nil:
+			return nil
+		}
+		healthy = false
+		log.Error(err, "Containerd is unreachable, reconnecting")
+		if err := c.client.Reconnect(); err != nil {
+			log.Error(err, "Failed to reconnect to containerd")
+		}
+	}
+}
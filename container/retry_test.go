@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryConfigDelay(t *testing.T) {
+	g := NewWithT(t)
+
+	config := RetryConfig{Attempts: 10, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	g.Expect(config.delay(1)).To(Equal(100 * time.Millisecond))
+	g.Expect(config.delay(2)).To(Equal(200 * time.Millisecond))
+	g.Expect(config.delay(4)).To(Equal(800 * time.Millisecond))
+	g.Expect(config.delay(5)).To(Equal(time.Second))
+	g.Expect(config.delay(50)).To(Equal(time.Second))
+}
+
+func TestRetryUnaryInterceptor(t *testing.T) {
+	g := NewWithT(t)
+
+	interceptor := retryUnaryInterceptor(RetryConfig{Attempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	invoke := func(errs ...error) (int, error) {
+		calls := 0
+		err := interceptor(context.Background(), "/containerd.services.tasks.v1.Tasks/Get", nil, nil, nil,
+			func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				calls++
+				if calls > len(errs) {
+					return nil
+				}
+				return errs[calls-1]
+			})
+		return calls, err
+	}
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+
+	calls, err := invoke(unavailable, unavailable)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(calls).To(Equal(3))
+
+	calls, err = invoke(unavailable, unavailable, unavailable, unavailable)
+	g.Expect(status.Code(err)).To(Equal(codes.Unavailable))
+	g.Expect(calls).To(Equal(3))
+
+	calls, err = invoke(status.Error(codes.NotFound, "not found"))
+	g.Expect(status.Code(err)).To(Equal(codes.NotFound))
+	g.Expect(calls).To(Equal(1))
+}
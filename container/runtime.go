@@ -0,0 +1,178 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+// Runtime extends the Cluster API container runtime interface with operations
+// that are specific to containerd.
+type Runtime interface {
+	container.Runtime
+
+	// SaveContainerImages saves the given images into a single tarball at dest.
+	// If allPlatforms is set, the content for every platform of the images is exported,
+	// otherwise only the content for the platform in the context, or the host platform.
+	SaveContainerImages(ctx context.Context, images []string, dest string, allPlatforms bool) error
+
+	// ExportContainerImages streams the given images as a single tarball to w, e.g. to import
+	// them into the containerd of a node container without staging them on disk.
+	ExportContainerImages(ctx context.Context, images []string, w io.Writer, allPlatforms bool) error
+
+	// InspectContainer returns the details of the given container.
+	InspectContainer(ctx context.Context, containerName string) (*ContainerInfo, error)
+
+	// MonitorRestarts restarts the containers that exited according to their restart policy label,
+	// checking them every interval until the context is cancelled.
+	MonitorRestarts(ctx context.Context, interval time.Duration) error
+
+	// CollectImages removes the unused images of the namespaces of the runtime and of its clusters
+	// selected by the policy.
+	CollectImages(ctx context.Context, policy ImageGCPolicy) error
+
+	// MonitorImages garbage collects the images according to the policy every interval until the
+	// context is cancelled.
+	MonitorImages(ctx context.Context, policy ImageGCPolicy, interval time.Duration) error
+
+	// MonitorHealth probes the containers according to their health check, reported in their details,
+	// until the context is cancelled.
+	MonitorHealth(ctx context.Context) error
+
+	// RestoreNetworks restores the network attachments and port mappings of the containers that were
+	// lost when containerd or the host restarted.
+	RestoreNetworks(ctx context.Context) error
+
+	// WatchEvents records the containerd events about the containers, reported in their debug info,
+	// until the context is cancelled.
+	WatchEvents(ctx context.Context) error
+
+	// SubscribeContainerEvents returns a channel receiving the container events with the given topics
+	// recorded by WatchEvents, until the context is done.
+	SubscribeContainerEvents(ctx context.Context, topics ...string) <-chan ContainerEvent
+
+	// ContainerLogs writes the output of the given container selected by the options to stdout and
+	// stderr, following it until the container stops or the context is done if requested.
+	ContainerLogs(ctx context.Context, containerName string, opts LogsOptions, stdout, stderr io.Writer) error
+
+	// PauseContainer freezes the processes of the given container until it is resumed.
+	PauseContainer(ctx context.Context, containerName string) error
+
+	// ResumeContainer thaws the processes of the given paused container.
+	ResumeContainer(ctx context.Context, containerName string) error
+
+	// CheckpointContainer checkpoints the given running container into a checkpoint image with the
+	// given reference, stopping it if exit is set.
+	CheckpointContainer(ctx context.Context, containerName, ref string, exit bool) error
+
+	// RestoreContainer recreates the given container from the checkpoint image with the given reference
+	// and restores its task.
+	RestoreContainer(ctx context.Context, containerName, ref string) error
+
+	// DeleteCheckpoint deletes the checkpoint image with the given reference.
+	DeleteCheckpoint(ctx context.Context, ref string) error
+
+	// CommitContainer creates the image with the given reference from the image of the given
+	// container and the changes of its writable layer.
+	CommitContainer(ctx context.Context, containerName, ref string) error
+
+	// ContainerStats returns the resource usage of the given running container.
+	ContainerStats(ctx context.Context, containerName string) (*ContainerStats, error)
+
+	// CheckConnection returns an error if containerd cannot be reached.
+	CheckConnection(ctx context.Context) error
+
+	// CopyTo extracts the tar archive read from content into the directory destDir of the given
+	// running container.
+	CopyTo(ctx context.Context, containerName, destDir string, content io.Reader) error
+
+	// CopyFrom writes to w a tar archive of the file or directory at srcPath in the given running
+	// container.
+	CopyFrom(ctx context.Context, containerName, srcPath string, w io.Writer) error
+
+	// CreateVolume creates the named volume of the cluster in the context, unless it exists.
+	CreateVolume(ctx context.Context, name string, labels map[string]string) (*VolumeInfo, error)
+
+	// InspectVolume returns the named volume of the cluster in the context.
+	InspectVolume(ctx context.Context, name string) (*VolumeInfo, error)
+
+	// ListVolumes returns the named volumes of the cluster in the context.
+	ListVolumes(ctx context.Context) ([]VolumeInfo, error)
+
+	// DeleteVolume deletes the named volume of the cluster in the context and its data.
+	DeleteVolume(ctx context.Context, name string) error
+
+	// ListNamespaces returns the containerd namespaces of the runtime and of its clusters.
+	ListNamespaces(ctx context.Context) ([]string, error)
+
+	// ClusterNamespace returns the containerd namespace of the containers of the cluster in the
+	// context, the namespace of the runtime without a cluster.
+	ClusterNamespace(ctx context.Context) string
+
+	// DeleteClusterNamespace deletes the containerd namespace of the cluster in the context, with
+	// its containers, images and leases.
+	DeleteClusterNamespace(ctx context.Context) error
+
+	// DeleteNetwork removes the named network written by the runtime for the containers of a
+	// cluster, once they are all deleted.
+	DeleteNetwork(ctx context.Context, name string) error
+
+	// MonitorConnection checks the connection to containerd and re-establishes it when containerd
+	// stops answering, until the context is cancelled.
+	MonitorConnection(ctx context.Context) error
+}
+
+// ContainerInfo contains the details of a container.
+type ContainerInfo struct {
+	// Name is the name of the container.
+	Name string
+	// Image is the image the container was created from.
+	Image string
+	// Labels are the labels of the container.
+	Labels map[string]string
+	// Status is the docker-style status of the container, e.g. "Up" or "Exited (1)".
+	Status string
+	// State is the state of the container task, i.e. "created", "running", "paused", "pausing",
+	// "stopped" or "unknown".
+	State string
+	// Paused is true if the processes of the container are frozen.
+	Paused bool
+	// RestartCount is the number of times the container was restarted by the restart monitor.
+	RestartCount int
+	// Health is the health status of the container, nil if it has no health check.
+	Health *HealthStatus
+	// CreatedAt is the time the container was created.
+	CreatedAt time.Time
+}
+
+var _ Runtime = &containerdRuntime{}
+
+// RuntimeFrom is used to extract the containerd runtime client from a context.
+// It returns an error if there is no runtime present, or if the runtime is not a containerd runtime.
+func RuntimeFrom(ctx context.Context) (Runtime, error) {
+	runtime, err := container.RuntimeFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	containerdRuntime, ok := runtime.(Runtime)
+	if !ok {
+		return nil, fmt.Errorf("container runtime %T is not a containerd runtime", runtime)
+	}
+	return containerdRuntime, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// runtimeHandlers maps the short names of the well-known runtime handlers to their containerd shim.
+var runtimeHandlers = map[string]string{
+	"runc":   "io.containerd.runc.v2",
+	"kata":   "io.containerd.kata.v2",
+	"gvisor": "io.containerd.runsc.v1",
+	"runsc":  "io.containerd.runsc.v1",
+	"runhcs": windowsRuntime,
+}
+
+// runtimeHandlerKey is the key type for accessing the runtime handler in passed contexts.
+type runtimeHandlerKey struct{}
+
+// RuntimeHandlerInto is used to store the runtime handler of the containers run with a context:
+// "runc", "kata", "gvisor", "runhcs", or the name of a containerd shim, e.g. "io.containerd.kata-qemu.v2".
+// An empty handler uses the containerd default runtime, or runhcs for Windows containers.
+func RuntimeHandlerInto(ctx context.Context, handler string) context.Context {
+	return context.WithValue(ctx, runtimeHandlerKey{}, handler)
+}
+
+// runtimeFrom returns the containerd runtime of the handler stored in the context, empty to use
+// the containerd default runtime.
+func runtimeFrom(ctx context.Context) (string, error) {
+	handler, _ := ctx.Value(runtimeHandlerKey{}).(string)
+	return parseRuntimeHandler(handler)
+}
+
+// parseRuntimeHandler returns the containerd runtime of the handler.
+func parseRuntimeHandler(handler string) (string, error) {
+	if handler == "" {
+		return "", nil
+	}
+	if runtime, ok := runtimeHandlers[handler]; ok {
+		return runtime, nil
+	}
+	// containerd shims are named io.containerd.<name>.<version>.
+	if parts := strings.Split(handler, "."); len(parts) >= 4 && parts[0] == "io" && parts[1] == "containerd" {
+		return handler, nil
+	}
+	return "", fmt.Errorf("unknown runtime handler %q, must be runc, kata, gvisor, runhcs or a containerd shim name like io.containerd.runc.v2", handler)
+}
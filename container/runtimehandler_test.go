@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRuntimeFrom(t *testing.T) {
+	g := NewWithT(t)
+
+	runtime, err := runtimeFrom(context.Background())
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(runtime).To(BeEmpty())
+
+	for handler, expected := range map[string]string{
+		"runc":                       "io.containerd.runc.v2",
+		"kata":                       "io.containerd.kata.v2",
+		"gvisor":                     "io.containerd.runsc.v1",
+		"runhcs":                     "io.containerd.runhcs.v1",
+		"io.containerd.kata-qemu.v2": "io.containerd.kata-qemu.v2",
+	} {
+		runtime, err := runtimeFrom(RuntimeHandlerInto(context.Background(), handler))
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(runtime).To(Equal(expected))
+	}
+
+	_, err = runtimeFrom(RuntimeHandlerInto(context.Background(), "firecracker"))
+	g.Expect(err).To(HaveOccurred())
+}
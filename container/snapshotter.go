@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/images"
+)
+
+// snapshotterKey is the key type for accessing the snapshotter in passed contexts.
+type snapshotterKey struct{}
+
+// SnapshotterInto is used to store the name of the snapshotter used to unpack images and create
+// container root filesystems into a context, e.g. "native" on hosts that cannot run overlayfs.
+func SnapshotterInto(ctx context.Context, snapshotter string) context.Context {
+	return context.WithValue(ctx, snapshotterKey{}, snapshotter)
+}
+
+// snapshotterFrom returns the snapshotter stored in the context, or an empty string to use
+// the containerd default.
+func snapshotterFrom(ctx context.Context) string {
+	if snapshotter, ok := ctx.Value(snapshotterKey{}).(string); ok {
+		return snapshotter
+	}
+	return ""
+}
+
+// snapshotter returns the snapshotter to use, or an empty string to use the containerd default.
+func (c *containerdRuntime) snapshotter(ctx context.Context) string {
+	if snapshotter := snapshotterFrom(ctx); snapshotter != "" {
+		return snapshotter
+	}
+	if c.lazyPull {
+		return stargzSnapshotter
+	}
+	return ""
+}
+
+// pullOpts returns the options used to pull and unpack the image, the given handler wrappers
+// are applied after the ones of the runtime configuration.
+func (c *containerdRuntime) pullOpts(ctx context.Context, ref string, wrappers ...func(images.Handler) images.Handler) []containerd.RemoteOpt {
+	opts := []containerd.RemoteOpt{
+		containerd.WithPullUnpack,
+		containerd.WithResolver(c.resolver(ctx)),
+	}
+	if snapshotter := c.snapshotter(ctx); snapshotter != "" {
+		opts = append(opts, containerd.WithPullSnapshotter(snapshotter))
+	}
+	if c.maxConcurrentDownloads > 0 {
+		opts = append(opts, containerd.WithMaxConcurrentDownloads(c.maxConcurrentDownloads))
+	}
+	if c.lazyPull {
+		wrappers = append([]func(images.Handler) images.Handler{appendInfoHandlerWrapper(ref)}, wrappers...)
+	}
+	if len(wrappers) > 0 {
+		// Only one wrapper can be set on the pull, chain them.
+		opts = append(opts, containerd.WithImageHandlerWrapper(func(h images.Handler) images.Handler {
+			for _, w := range wrappers {
+				h = w(h)
+			}
+			return h
+		}))
+	}
+	return opts
+}
+
+// ensureUnpacked unpacks the image for the snapshotter in use if it is not already, which
+// happens when an image pulled for a machine is reused by a machine with a different snapshotter.
+func (c *containerdRuntime) ensureUnpacked(ctx context.Context, image containerd.Image) error {
+	snapshotter := c.snapshotter(ctx)
+	unpacked, err := image.IsUnpacked(ctx, snapshotter)
+	if err != nil {
+		return err
+	}
+	if unpacked {
+		return nil
+	}
+
+	release, err := c.acquireUnpack(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return image.Unpack(ctx, snapshotter)
+}
+
+// acquireUnpack waits until the number of concurrent pulls and unpacks allows another one.
+func (c *containerdRuntime) acquireUnpack(ctx context.Context) (release func(), err error) {
+	if c.unpackLimiter == nil {
+		return func() {}, nil
+	}
+	if err := c.unpackLimiter.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return func() { c.unpackLimiter.Release(1) }, nil
+}
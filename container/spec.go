@@ -0,0 +1,154 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+const (
+	// hostNetwork is the network name that makes a container share the host network namespace.
+	hostNetwork = "host"
+
+	// portsLabel stores the requested port mappings of a container as JSON.
+	portsLabel = "io.x-k8s.capc.ports"
+	// networkLabel stores the name of the network a container is attached to.
+	networkLabel = "io.x-k8s.capc.network"
+)
+
+// generateSpecOpts translates the run configuration into the options used to build the OCI runtime spec.
+func (c *containerdRuntime) generateSpecOpts(runConfig *container.RunContainerInput, image containerd.Image) ([]oci.SpecOpts, error) {
+	opts := []oci.SpecOpts{
+		oci.WithDefaultUnixDevices,
+		oci.WithImageConfigArgs(image, runConfig.CommandArgs),
+		oci.WithHostname(runConfig.Name), // make hostname match container name
+	}
+	opts = append(opts, c.cgroupSpecOpts()...)
+
+	if len(runConfig.Entrypoint) > 0 {
+		args := append(append([]string{}, runConfig.Entrypoint...), runConfig.CommandArgs...)
+		opts = append(opts, oci.WithProcessArgs(args...))
+	}
+
+	if user := ownerAndGroup(runConfig); user != "" {
+		opts = append(opts, oci.WithUser(user))
+	}
+
+	if env := environmentVariables(runConfig); len(env) > 0 {
+		opts = append(opts, oci.WithEnv(env))
+	}
+
+	mounts, err := c.generateMounts(runConfig)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, oci.WithMounts(mounts))
+
+	if runConfig.Network == hostNetwork {
+		opts = append(opts,
+			oci.WithHostNamespace(specs.NetworkNamespace),
+			oci.WithHostHostsFile,
+			oci.WithHostResolvconf,
+		)
+	}
+
+	if runConfig.IPFamily == clusterv1.IPv6IPFamily || runConfig.IPFamily == clusterv1.DualStackIPFamily {
+		opts = append(opts, withSysctls(map[string]string{
+			"net.ipv6.conf.all.disable_ipv6": "0",
+			"net.ipv6.conf.all.forwarding":   "1",
+		}))
+	}
+
+	return opts, nil
+}
+
+// withNetNS joins the given network namespace, using the host resolver configuration as the
+// namespace has no DNS of its own.
+func withNetNS(netnsPath string) []oci.SpecOpts {
+	return []oci.SpecOpts{
+		oci.WithLinuxNamespace(specs.LinuxNamespace{Type: specs.NetworkNamespace, Path: netnsPath}),
+		oci.WithHostResolvconf,
+	}
+}
+
+// containerLabels returns the labels to set on the container record, including the
+// bookkeeping labels used to recover the network and port configuration later on.
+func containerLabels(runConfig *container.RunContainerInput) (map[string]string, error) {
+	labels := map[string]string{}
+	for key, val := range runConfig.Labels {
+		labels[key] = val
+	}
+
+	if runConfig.Network != "" {
+		labels[networkLabel] = runConfig.Network
+	}
+
+	if len(runConfig.PortMappings) > 0 {
+		ports, err := json.Marshal(runConfig.PortMappings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal port mappings: %v", err)
+		}
+		labels[portsLabel] = string(ports)
+	}
+
+	return labels, nil
+}
+
+// withSysctls sets the given kernel parameters in the spec.
+func withSysctls(sysctls map[string]string) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Linux == nil {
+			s.Linux = &specs.Linux{}
+		}
+		if s.Linux.Sysctl == nil {
+			s.Linux.Sysctl = make(map[string]string)
+		}
+		for key, val := range sysctls {
+			s.Linux.Sysctl[key] = val
+		}
+		return nil
+	}
+}
+
+// ownerAndGroup gets the user configuration for the container (user:group).
+func ownerAndGroup(crc *container.RunContainerInput) string {
+	if crc.User != "" {
+		if crc.Group != "" {
+			return fmt.Sprintf("%s:%s", crc.User, crc.Group)
+		}
+
+		return crc.User
+	}
+
+	return ""
+}
+
+// environmentVariables gets the collection of environment variables for the container.
+func environmentVariables(crc *container.RunContainerInput) []string {
+	envVars := []string{}
+	for key, val := range crc.EnvironmentVars {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", key, val))
+	}
+	return envVars
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// staticAddressLabel stores the static address of a container as JSON, requested again when the
+// container is attached to its network after a restart.
+const staticAddressLabel = "io.x-k8s.capc.static-address"
+
+// staticAddressKey is the key type for accessing the static address in passed contexts.
+type staticAddressKey struct{}
+
+// StaticAddress is the address of the containers run with a context, requested from the IPAM plugin
+// of their network instead of a free one, e.g. so that a node keeps its IP when its container is
+// recreated. The host-local IPAM plugin allocates the IPs, and the bridge plugin sets the MAC address.
+type StaticAddress struct {
+	// IPs are the IPs of the container, at most one per IP family. The IPs of the other families of
+	// the network are allocated as usual.
+	IPs []net.IP `json:"ips,omitempty"`
+	// MAC is the MAC address of the interface of the container, a random one if empty.
+	MAC string `json:"mac,omitempty"`
+}
+
+// StaticAddressInto is used to store the static address of the containers run with a context.
+func StaticAddressInto(ctx context.Context, address StaticAddress) context.Context {
+	return context.WithValue(ctx, staticAddressKey{}, address)
+}
+
+// staticAddressFrom returns the static address stored in the context, an empty one if not set.
+func staticAddressFrom(ctx context.Context) StaticAddress {
+	if address, ok := ctx.Value(staticAddressKey{}).(StaticAddress); ok {
+		return address
+	}
+	return StaticAddress{}
+}
+
+// empty returns true if neither IPs nor a MAC address are requested.
+func (a StaticAddress) empty() bool {
+	return len(a.IPs) == 0 && a.MAC == ""
+}
+
+// validate returns an error if the MAC address is invalid or if several IPs are of the same family.
+func (a StaticAddress) validate() error {
+	if a.MAC != "" {
+		if _, err := net.ParseMAC(a.MAC); err != nil {
+			return fmt.Errorf("invalid MAC address %q: %v", a.MAC, err)
+		}
+	}
+	families := map[bool]bool{}
+	for _, ip := range a.IPs {
+		if ip == nil {
+			return fmt.Errorf("invalid static IP")
+		}
+		ipv4 := ip.To4() != nil
+		if families[ipv4] {
+			return fmt.Errorf("static IPs %v have more than one IP of the same family", a.IPs)
+		}
+		families[ipv4] = true
+	}
+	return nil
+}
+
+// cniArgs returns the CNI_ARGS requesting the address, the IPs as supported by host-local and the
+// MAC address as supported by the bridge plugin. Plugins that do not know the arguments ignore them.
+func (a StaticAddress) cniArgs() [][2]string {
+	if a.empty() {
+		return nil
+	}
+	args := [][2]string{{"IgnoreUnknown", "1"}}
+	if len(a.IPs) > 0 {
+		args = requestedIPsArgs(a.IPs)
+	}
+	if a.MAC != "" {
+		args = append(args, [2]string{"MAC", a.MAC})
+	}
+	return args
+}
+
+// label returns the value of the label storing the static address.
+func (a StaticAddress) label() (string, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal static address: %v", err)
+	}
+	return string(data), nil
+}
+
+// staticAddressFromLabels returns the static address stored in the labels, an empty one if none.
+func staticAddressFromLabels(labels map[string]string) (StaticAddress, error) {
+	var address StaticAddress
+	data, ok := labels[staticAddressLabel]
+	if !ok {
+		return address, nil
+	}
+	if err := json.Unmarshal([]byte(data), &address); err != nil {
+		return address, fmt.Errorf("failed to parse static address: %v", err)
+	}
+	return address, nil
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStaticAddress(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(staticAddressFrom(context.Background()).empty()).To(BeTrue())
+	g.Expect(StaticAddress{}.cniArgs()).To(BeNil())
+
+	address := StaticAddress{IPs: []net.IP{net.ParseIP("10.89.0.10")}, MAC: "02:42:ac:11:00:0a"}
+	g.Expect(staticAddressFrom(StaticAddressInto(context.Background(), address))).To(Equal(address))
+	g.Expect(address.validate()).To(Succeed())
+	g.Expect(address.cniArgs()).To(Equal([][2]string{{"IgnoreUnknown", "1"}, {"IP", "10.89.0.10"}, {"MAC", "02:42:ac:11:00:0a"}}))
+	g.Expect(StaticAddress{MAC: "02:42:ac:11:00:0a"}.cniArgs()).To(Equal([][2]string{{"IgnoreUnknown", "1"}, {"MAC", "02:42:ac:11:00:0a"}}))
+
+	label, err := address.label()
+	g.Expect(err).NotTo(HaveOccurred())
+	restored, err := staticAddressFromLabels(map[string]string{staticAddressLabel: label})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(restored.MAC).To(Equal(address.MAC))
+	g.Expect(restored.IPs[0].Equal(address.IPs[0])).To(BeTrue())
+
+	g.Expect(StaticAddress{MAC: "02:42:ac"}.validate()).NotTo(Succeed())
+	g.Expect(StaticAddress{IPs: []net.IP{net.ParseIP("10.89.0.10"), net.ParseIP("10.89.0.11")}}.validate()).NotTo(Succeed())
+	g.Expect(StaticAddress{IPs: []net.IP{net.ParseIP("10.89.0.10"), net.ParseIP("fd00::a")}}.validate()).To(Succeed())
+}
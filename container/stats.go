@@ -0,0 +1,134 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "github.com/containerd/cgroups/stats/v1"
+	v2 "github.com/containerd/cgroups/v2/stats"
+	"github.com/containerd/typeurl"
+)
+
+// unlimitedMemory is the memory limit above which a container is considered to have no limit, the
+// cgroup reports the maximum page aligned value instead.
+const unlimitedMemory = 1 << 62
+
+// ContainerStats is the resource usage of a container, read from its cgroup.
+type ContainerStats struct {
+	// Timestamp is the time the stats were read.
+	Timestamp time.Time
+	// CPUUsage is the CPU time used by the container since it started.
+	CPUUsage time.Duration
+	// MemoryWorkingSet is the memory used by the container in bytes, excluding the inactive page
+	// cache that can be reclaimed, like the working set reported by the kubelet.
+	MemoryWorkingSet uint64
+	// MemoryLimit is the memory limit of the container in bytes, zero if it has none.
+	MemoryLimit uint64
+	// IOReadBytes and IOWriteBytes are the bytes read from and written to block devices.
+	IOReadBytes  uint64
+	IOWriteBytes uint64
+	// Processes is the number of processes in the container.
+	Processes uint64
+}
+
+// ContainerStats returns the resource usage of a running container, for both cgroup v1 and v2 hosts.
+func (c *containerdRuntime) ContainerStats(ctx context.Context, containerName string) (*ContainerStats, error) {
+	ctx = c.withNamespace(ctx)
+
+	task, _, err := c.loadTask(ctx, containerName)
+	if err != nil {
+		return nil, err
+	}
+	metric, err := task.Metrics(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics of container %q: %v", containerName, err)
+	}
+	data, err := typeurl.UnmarshalAny(metric.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metrics of container %q: %v", containerName, err)
+	}
+
+	stats, err := statsFromMetrics(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics of container %q: %v", containerName, err)
+	}
+	stats.Timestamp = metric.Timestamp
+	return stats, nil
+}
+
+// statsFromMetrics converts the cgroup metrics of a task.
+func statsFromMetrics(data interface{}) (*ContainerStats, error) {
+	stats := &ContainerStats{}
+	switch m := data.(type) {
+	case *v1.Metrics:
+		if m.CPU != nil && m.CPU.Usage != nil {
+			stats.CPUUsage = time.Duration(m.CPU.Usage.Total)
+		}
+		if m.Memory != nil && m.Memory.Usage != nil {
+			stats.MemoryWorkingSet = workingSet(m.Memory.Usage.Usage, m.Memory.TotalInactiveFile)
+			stats.MemoryLimit = memoryLimit(m.Memory.Usage.Limit)
+		}
+		if m.Blkio != nil {
+			for _, entry := range m.Blkio.IoServiceBytesRecursive {
+				switch strings.ToLower(entry.Op) {
+				case "read":
+					stats.IOReadBytes += entry.Value
+				case "write":
+					stats.IOWriteBytes += entry.Value
+				}
+			}
+		}
+		if m.Pids != nil {
+			stats.Processes = m.Pids.Current
+		}
+	case *v2.Metrics:
+		if m.CPU != nil {
+			stats.CPUUsage = time.Duration(m.CPU.UsageUsec) * time.Microsecond
+		}
+		if m.Memory != nil {
+			stats.MemoryWorkingSet = workingSet(m.Memory.Usage, m.Memory.InactiveFile)
+			stats.MemoryLimit = memoryLimit(m.Memory.UsageLimit)
+		}
+		if m.Io != nil {
+			for _, entry := range m.Io.Usage {
+				stats.IOReadBytes += entry.Rbytes
+				stats.IOWriteBytes += entry.Wbytes
+			}
+		}
+		if m.Pids != nil {
+			stats.Processes = m.Pids.Current
+		}
+	default:
+		return nil, fmt.Errorf("unsupported metrics type %T", data)
+	}
+	return stats, nil
+}
+
+func workingSet(usage, inactiveFile uint64) uint64 {
+	if inactiveFile > usage {
+		return 0
+	}
+	return usage - inactiveFile
+}
+
+func memoryLimit(limit uint64) uint64 {
+	if limit >= unlimitedMemory {
+		return 0
+	}
+	return limit
+}
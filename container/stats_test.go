@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	v1 "github.com/containerd/cgroups/stats/v1"
+	v2 "github.com/containerd/cgroups/v2/stats"
+	. "github.com/onsi/gomega"
+)
+
+func TestStatsFromMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	stats, err := statsFromMetrics(&v1.Metrics{
+		CPU:    &v1.CPUStat{Usage: &v1.CPUUsage{Total: uint64(2 * time.Second)}},
+		Memory: &v1.MemoryStat{Usage: &v1.MemoryEntry{Usage: 300, Limit: 9223372036854771712}, TotalInactiveFile: 100},
+		Blkio: &v1.BlkIOStat{IoServiceBytesRecursive: []*v1.BlkIOEntry{
+			{Op: "Read", Value: 10},
+			{Op: "Write", Value: 20},
+			{Op: "Total", Value: 30},
+		}},
+		Pids: &v1.PidsStat{Current: 42},
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(*stats).To(Equal(ContainerStats{
+		CPUUsage:         2 * time.Second,
+		MemoryWorkingSet: 200,
+		IOReadBytes:      10,
+		IOWriteBytes:     20,
+		Processes:        42,
+	}))
+
+	stats, err = statsFromMetrics(&v2.Metrics{
+		CPU:    &v2.CPUStat{UsageUsec: 1500},
+		Memory: &v2.MemoryStat{Usage: 300, UsageLimit: 1024, InactiveFile: 400},
+		Io:     &v2.IOStat{Usage: []*v2.IOEntry{{Rbytes: 1, Wbytes: 2}, {Rbytes: 3, Wbytes: 4}}},
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(*stats).To(Equal(ContainerStats{
+		CPUUsage:     1500 * time.Microsecond,
+		MemoryLimit:  1024,
+		IOReadBytes:  4,
+		IOWriteBytes: 6,
+	}))
+
+	stats, err = statsFromMetrics(&v2.Metrics{Memory: &v2.MemoryStat{UsageLimit: math.MaxUint64}})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(stats.MemoryLimit).To(BeZero())
+
+	_, err = statsFromMetrics("unexpected")
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// sysctlsKey is the key type for accessing the sysctls in passed contexts.
+type sysctlsKey struct{}
+
+// ipcSysctls are the sysctls of the IPC namespace, namespaced per container.
+var ipcSysctls = map[string]bool{
+	"kernel.msgmax":          true,
+	"kernel.msgmnb":          true,
+	"kernel.msgmni":          true,
+	"kernel.sem":             true,
+	"kernel.shmall":          true,
+	"kernel.shmmax":          true,
+	"kernel.shmmni":          true,
+	"kernel.shm_rmid_forced": true,
+}
+
+// SysctlsInto is used to store the kernel parameters set in the containers run with a context.
+func SysctlsInto(ctx context.Context, sysctls map[string]string) context.Context {
+	return context.WithValue(ctx, sysctlsKey{}, sysctls)
+}
+
+// sysctlsFrom returns the sysctls stored in the context, none if not set.
+func sysctlsFrom(ctx context.Context) map[string]string {
+	if sysctls, ok := ctx.Value(sysctlsKey{}).(map[string]string); ok {
+		return sysctls
+	}
+	return nil
+}
+
+// validateSysctls returns an error if a sysctl is not namespaced, and so would change the kernel
+// parameters of the host and of all its containers, e.g. fs.inotify.max_user_watches. The net
+// sysctls are only namespaced if the container does not share the host network.
+func validateSysctls(sysctls map[string]string, hostNetwork bool) error {
+	for name := range sysctls {
+		switch {
+		case ipcSysctls[name] || strings.HasPrefix(name, "fs.mqueue."):
+		case strings.HasPrefix(name, "net."):
+			if hostNetwork {
+				return fmt.Errorf("sysctl %q cannot be set in a container of the host network", name)
+			}
+		default:
+			return fmt.Errorf("sysctl %q is not namespaced, it must be set on the host", name)
+		}
+	}
+	return nil
+}
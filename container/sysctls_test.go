@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestSysctls(t *testing.T) {
+	g := NewWithT(t)
+
+	sysctls := map[string]string{
+		"net.ipv4.ip_forward":                       "1",
+		"net.netfilter.nf_conntrack_tcp_be_liberal": "1",
+		"kernel.shmmax":                             "68719476736",
+		"fs.mqueue.msg_max":                         "100",
+	}
+	g.Expect(validateSysctls(sysctls, false)).To(Succeed())
+	g.Expect(validateSysctls(sysctls, true)).ToNot(Succeed())
+	g.Expect(validateSysctls(map[string]string{"fs.inotify.max_user_watches": "524288"}, false)).ToNot(Succeed())
+	g.Expect(validateSysctls(map[string]string{"kernel.pid_max": "4194304"}, false)).ToNot(Succeed())
+
+	s := &oci.Spec{Linux: &specs.Linux{Sysctl: map[string]string{"net.ipv4.ip_forward": "0", "kernel.sem": "250"}}}
+	g.Expect(withSysctls(sysctls)(context.Background(), nil, nil, s)).To(Succeed())
+	g.Expect(s.Linux.Sysctl).To(HaveLen(5))
+	g.Expect(s.Linux.Sysctl).To(HaveKeyWithValue("net.ipv4.ip_forward", "1"))
+	g.Expect(s.Linux.Sysctl).To(HaveKeyWithValue("kernel.sem", "250"))
+}
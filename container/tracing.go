@@ -0,0 +1,284 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+const (
+	// tracerName is the name of the tracer of the runtime spans.
+	tracerName = "github.com/raminenia/cluster-api-provider-containerd/container"
+	// spanPrefix prefixes the names of the runtime spans, e.g. "containerd.RunContainer".
+	spanPrefix = "containerd."
+
+	// namespaceAttributeKey records the containerd namespace of the cluster a span is about.
+	namespaceAttributeKey = attribute.Key("containerd.namespace")
+)
+
+// WithTracerProvider sets the provider of the tracer recording the spans of the runtime operations
+// and of the containerd calls they make, the global one by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *containerdRuntime) {
+		c.tracerProvider = provider
+	}
+}
+
+// tracingDialOptions return the dial options recording a span for each containerd call, a child of
+// the span of the runtime operation making it.
+func (c *containerdRuntime) tracingDialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(otelgrpc.UnaryClientInterceptor(otelgrpc.WithTracerProvider(c.tracerProvider))),
+		grpc.WithChainStreamInterceptor(otelgrpc.StreamClientInterceptor(otelgrpc.WithTracerProvider(c.tracerProvider))),
+	}
+}
+
+// tracedRuntime records a span for each operation of the runtime, a child of the span in the context,
+// e.g. the one of the reconciliation making it, so that slow provisioning can be traced down to the
+// containerd calls taking the time. The operations running until their context is cancelled, like
+// the monitors, are not traced, their containerd calls are.
+type tracedRuntime struct {
+	*containerdRuntime
+	tracer trace.Tracer
+}
+
+// newTracedRuntime returns the runtime recording the spans of its operations.
+func newTracedRuntime(c *containerdRuntime) *tracedRuntime {
+	return &tracedRuntime{containerdRuntime: c, tracer: c.tracerProvider.Tracer(tracerName)}
+}
+
+// start starts the span of the runtime operation with the given name.
+func (t *tracedRuntime) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, namespaceAttributeKey.String(t.namespaceFrom(ctx)))
+	return t.tracer.Start(ctx, spanPrefix+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// end ends the span of a runtime operation, recording the error it failed with.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func containerAttribute(containerName string) attribute.KeyValue {
+	return semconv.ContainerNameKey.String(containerName)
+}
+
+func imageAttribute(image string) attribute.KeyValue {
+	return semconv.ContainerImageNameKey.String(image)
+}
+
+func (t *tracedRuntime) SaveContainerImage(ctx context.Context, image, dest string) (err error) {
+	ctx, span := t.start(ctx, "SaveContainerImage", imageAttribute(image))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.SaveContainerImage(ctx, image, dest)
+}
+
+func (t *tracedRuntime) SaveContainerImages(ctx context.Context, images []string, dest string, allPlatforms bool) (err error) {
+	ctx, span := t.start(ctx, "SaveContainerImages", attribute.StringSlice("container.image.names", images))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.SaveContainerImages(ctx, images, dest, allPlatforms)
+}
+
+func (t *tracedRuntime) ExportContainerImages(ctx context.Context, images []string, w io.Writer, allPlatforms bool) (err error) {
+	ctx, span := t.start(ctx, "ExportContainerImages", attribute.StringSlice("container.image.names", images))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ExportContainerImages(ctx, images, w, allPlatforms)
+}
+
+func (t *tracedRuntime) PullContainerImageIfNotExists(ctx context.Context, image string) (err error) {
+	ctx, span := t.start(ctx, "PullContainerImageIfNotExists", imageAttribute(image))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.PullContainerImageIfNotExists(ctx, image)
+}
+
+func (t *tracedRuntime) GetHostPort(ctx context.Context, containerName, portAndProtocol string) (_ string, err error) {
+	ctx, span := t.start(ctx, "GetHostPort", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.GetHostPort(ctx, containerName, portAndProtocol)
+}
+
+func (t *tracedRuntime) GetContainerIPs(ctx context.Context, containerName string) (_ string, _ string, err error) {
+	ctx, span := t.start(ctx, "GetContainerIPs", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.GetContainerIPs(ctx, containerName)
+}
+
+func (t *tracedRuntime) ExecContainer(ctx context.Context, containerName string, config *container.ExecContainerInput, command string, args ...string) (err error) {
+	ctx, span := t.start(ctx, "ExecContainer", containerAttribute(containerName), attribute.String("process.command", command))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ExecContainer(ctx, containerName, config, command, args...)
+}
+
+func (t *tracedRuntime) RunContainer(ctx context.Context, runConfig *container.RunContainerInput, output io.Writer) (err error) {
+	ctx, span := t.start(ctx, "RunContainer", containerAttribute(runConfig.Name), imageAttribute(runConfig.Image))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.RunContainer(ctx, runConfig, output)
+}
+
+func (t *tracedRuntime) ListContainers(ctx context.Context, filters container.FilterBuilder) (_ []container.Container, err error) {
+	ctx, span := t.start(ctx, "ListContainers")
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ListContainers(ctx, filters)
+}
+
+func (t *tracedRuntime) ContainerDebugInfo(ctx context.Context, containerName string, w io.Writer) (err error) {
+	ctx, span := t.start(ctx, "ContainerDebugInfo", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ContainerDebugInfo(ctx, containerName, w)
+}
+
+func (t *tracedRuntime) DeleteContainer(ctx context.Context, containerName string) (err error) {
+	ctx, span := t.start(ctx, "DeleteContainer", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.DeleteContainer(ctx, containerName)
+}
+
+func (t *tracedRuntime) KillContainer(ctx context.Context, containerName, signal string) (err error) {
+	ctx, span := t.start(ctx, "KillContainer", containerAttribute(containerName), attribute.String("process.signal", signal))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.KillContainer(ctx, containerName, signal)
+}
+
+func (t *tracedRuntime) InspectContainer(ctx context.Context, containerName string) (_ *ContainerInfo, err error) {
+	ctx, span := t.start(ctx, "InspectContainer", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.InspectContainer(ctx, containerName)
+}
+
+func (t *tracedRuntime) RestoreNetworks(ctx context.Context) (err error) {
+	ctx, span := t.start(ctx, "RestoreNetworks")
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.RestoreNetworks(ctx)
+}
+
+func (t *tracedRuntime) CollectImages(ctx context.Context, policy ImageGCPolicy) (err error) {
+	ctx, span := t.start(ctx, "CollectImages")
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.CollectImages(ctx, policy)
+}
+
+func (t *tracedRuntime) ContainerLogs(ctx context.Context, containerName string, opts LogsOptions, stdout, stderr io.Writer) (err error) {
+	ctx, span := t.start(ctx, "ContainerLogs", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ContainerLogs(ctx, containerName, opts, stdout, stderr)
+}
+
+func (t *tracedRuntime) PauseContainer(ctx context.Context, containerName string) (err error) {
+	ctx, span := t.start(ctx, "PauseContainer", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.PauseContainer(ctx, containerName)
+}
+
+func (t *tracedRuntime) ResumeContainer(ctx context.Context, containerName string) (err error) {
+	ctx, span := t.start(ctx, "ResumeContainer", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ResumeContainer(ctx, containerName)
+}
+
+func (t *tracedRuntime) CheckpointContainer(ctx context.Context, containerName, ref string, exit bool) (err error) {
+	ctx, span := t.start(ctx, "CheckpointContainer", containerAttribute(containerName), imageAttribute(ref))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.CheckpointContainer(ctx, containerName, ref, exit)
+}
+
+func (t *tracedRuntime) RestoreContainer(ctx context.Context, containerName, ref string) (err error) {
+	ctx, span := t.start(ctx, "RestoreContainer", containerAttribute(containerName), imageAttribute(ref))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.RestoreContainer(ctx, containerName, ref)
+}
+
+func (t *tracedRuntime) DeleteCheckpoint(ctx context.Context, ref string) (err error) {
+	ctx, span := t.start(ctx, "DeleteCheckpoint", imageAttribute(ref))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.DeleteCheckpoint(ctx, ref)
+}
+
+func (t *tracedRuntime) CommitContainer(ctx context.Context, containerName, ref string) (err error) {
+	ctx, span := t.start(ctx, "CommitContainer", containerAttribute(containerName), imageAttribute(ref))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.CommitContainer(ctx, containerName, ref)
+}
+
+func (t *tracedRuntime) ContainerStats(ctx context.Context, containerName string) (_ *ContainerStats, err error) {
+	ctx, span := t.start(ctx, "ContainerStats", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ContainerStats(ctx, containerName)
+}
+
+func (t *tracedRuntime) CopyTo(ctx context.Context, containerName, destDir string, content io.Reader) (err error) {
+	ctx, span := t.start(ctx, "CopyTo", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.CopyTo(ctx, containerName, destDir, content)
+}
+
+func (t *tracedRuntime) CopyFrom(ctx context.Context, containerName, srcPath string, w io.Writer) (err error) {
+	ctx, span := t.start(ctx, "CopyFrom", containerAttribute(containerName))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.CopyFrom(ctx, containerName, srcPath, w)
+}
+
+func (t *tracedRuntime) CreateVolume(ctx context.Context, name string, labels map[string]string) (_ *VolumeInfo, err error) {
+	ctx, span := t.start(ctx, "CreateVolume", attribute.String("volume.name", name))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.CreateVolume(ctx, name, labels)
+}
+
+func (t *tracedRuntime) InspectVolume(ctx context.Context, name string) (_ *VolumeInfo, err error) {
+	ctx, span := t.start(ctx, "InspectVolume", attribute.String("volume.name", name))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.InspectVolume(ctx, name)
+}
+
+func (t *tracedRuntime) ListVolumes(ctx context.Context) (_ []VolumeInfo, err error) {
+	ctx, span := t.start(ctx, "ListVolumes")
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ListVolumes(ctx)
+}
+
+func (t *tracedRuntime) DeleteVolume(ctx context.Context, name string) (err error) {
+	ctx, span := t.start(ctx, "DeleteVolume", attribute.String("volume.name", name))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.DeleteVolume(ctx, name)
+}
+
+func (t *tracedRuntime) ListNamespaces(ctx context.Context) (_ []string, err error) {
+	ctx, span := t.start(ctx, "ListNamespaces")
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.ListNamespaces(ctx)
+}
+
+func (t *tracedRuntime) DeleteClusterNamespace(ctx context.Context) (err error) {
+	ctx, span := t.start(ctx, "DeleteClusterNamespace")
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.DeleteClusterNamespace(ctx)
+}
+
+func (t *tracedRuntime) DeleteNetwork(ctx context.Context, name string) (err error) {
+	ctx, span := t.start(ctx, "DeleteNetwork", attribute.String("network.name", name))
+	defer func() { end(span, err) }()
+	return t.containerdRuntime.DeleteNetwork(ctx, name)
+}
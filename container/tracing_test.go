@@ -0,0 +1,48 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedRuntime(t *testing.T) {
+	g := NewWithT(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	runtime := newTracedRuntime(&containerdRuntime{namespace: "default", stateDir: t.TempDir(), tracerProvider: provider})
+
+	ctx, parent := provider.Tracer("test").Start(ClusterInto(context.Background(), "team-a", "dev"), "Reconcile")
+	_, err := runtime.CreateVolume(ctx, "etcd-0", nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = runtime.InspectVolume(ctx, "etcd-1")
+	g.Expect(err).To(MatchError(ErrVolumeNotFound))
+	parent.End()
+
+	spans := recorder.Ended()
+	g.Expect(spans).To(HaveLen(3))
+	g.Expect(spans[0].Name()).To(Equal("containerd.CreateVolume"))
+	g.Expect(spans[0].Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()))
+	g.Expect(spans[0].Attributes()).To(ContainElement(namespaceAttributeKey.String("default.team-a.dev")))
+	g.Expect(spans[0].Status().Code).To(Equal(codes.Unset))
+	g.Expect(spans[1].Name()).To(Equal("containerd.InspectVolume"))
+	g.Expect(spans[1].Status().Code).To(Equal(codes.Error))
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/go-logr/logr"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// defaultTerm is the TERM set for execs with a terminal when the environment does not set one.
+const defaultTerm = "TERM=xterm"
+
+// execTTYKey is the key type for accessing the exec terminal settings in passed contexts.
+type execTTYKey struct{}
+
+// TerminalSize is the size of a terminal in characters.
+type TerminalSize struct {
+	Width  uint32
+	Height uint32
+}
+
+// ExecTTY runs execs with a terminal, like nerdctl exec -it. The output of the terminal is written
+// to the output buffer of the exec, there is no separate error stream.
+type ExecTTY struct {
+	// Size is the initial size of the terminal, the runtime default if nil.
+	Size *TerminalSize
+	// Resize receives the new sizes of the terminal, e.g. on SIGWINCH, until the exec exits.
+	Resize <-chan TerminalSize
+}
+
+// ExecTTYInto is used to store the terminal settings of the execs run with a context.
+func ExecTTYInto(ctx context.Context, tty ExecTTY) context.Context {
+	return context.WithValue(ctx, execTTYKey{}, tty)
+}
+
+// execTTYFrom returns the terminal settings stored in the context, nil for execs without terminal.
+func execTTYFrom(ctx context.Context) *ExecTTY {
+	if tty, ok := ctx.Value(execTTYKey{}).(ExecTTY); ok {
+		return &tty
+	}
+	return nil
+}
+
+// apply configures the process to run with a terminal.
+func (t *ExecTTY) apply(pspec *specs.Process) {
+	pspec.Terminal = true
+	if t.Size != nil {
+		pspec.ConsoleSize = &specs.Box{Width: uint(t.Size.Width), Height: uint(t.Size.Height)}
+	}
+	for _, env := range pspec.Env {
+		if strings.HasPrefix(env, "TERM=") {
+			return
+		}
+	}
+	pspec.Env = append(pspec.Env, defaultTerm)
+}
+
+// forwardResizes resizes the terminal of the process with the sizes received, until the channel
+// is closed or done is.
+func (t *ExecTTY) forwardResizes(ctx context.Context, process containerd.Process, done <-chan struct{}) {
+	if t.Size != nil {
+		t.resize(ctx, process, *t.Size)
+	}
+	if t.Resize == nil {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case size, ok := <-t.Resize:
+				if !ok {
+					return
+				}
+				t.resize(ctx, process, size)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func (t *ExecTTY) resize(ctx context.Context, process containerd.Process, size TerminalSize) {
+	if err := process.Resize(ctx, size.Width, size.Height); err != nil {
+		logr.FromContextOrDiscard(ctx).V(4).Info("Failed to resize exec terminal", "exec", process.ID(), "error", err.Error())
+	}
+}
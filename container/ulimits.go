@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// ulimitsKey is the key type for accessing the ulimits in passed contexts.
+type ulimitsKey struct{}
+
+// rlimitTypes are the names of the resource limits, as used by docker run --ulimit, with their
+// POSIX type.
+var rlimitTypes = map[string]string{
+	"as":         "RLIMIT_AS",
+	"core":       "RLIMIT_CORE",
+	"cpu":        "RLIMIT_CPU",
+	"data":       "RLIMIT_DATA",
+	"fsize":      "RLIMIT_FSIZE",
+	"locks":      "RLIMIT_LOCKS",
+	"memlock":    "RLIMIT_MEMLOCK",
+	"msgqueue":   "RLIMIT_MSGQUEUE",
+	"nice":       "RLIMIT_NICE",
+	"nofile":     "RLIMIT_NOFILE",
+	"nproc":      "RLIMIT_NPROC",
+	"rss":        "RLIMIT_RSS",
+	"rtprio":     "RLIMIT_RTPRIO",
+	"rttime":     "RLIMIT_RTTIME",
+	"sigpending": "RLIMIT_SIGPENDING",
+	"stack":      "RLIMIT_STACK",
+}
+
+// Ulimit is a resource limit of the processes of a container.
+type Ulimit struct {
+	// Name is the name of the limit, e.g. "nofile", "nproc" or "memlock".
+	Name string
+	// Soft is the limit enforced by the kernel.
+	Soft uint64
+	// Hard is the ceiling the processes can raise the soft limit to.
+	Hard uint64
+}
+
+// UlimitsInto is used to store the resource limits of the processes of the containers run with a context.
+func UlimitsInto(ctx context.Context, ulimits []Ulimit) context.Context {
+	return context.WithValue(ctx, ulimitsKey{}, ulimits)
+}
+
+// ulimitsFrom returns the ulimits stored in the context, none if not set.
+func ulimitsFrom(ctx context.Context) []Ulimit {
+	if ulimits, ok := ctx.Value(ulimitsKey{}).([]Ulimit); ok {
+		return ulimits
+	}
+	return nil
+}
+
+// validate returns an error if the limit is unknown or its soft limit is above its hard limit.
+func (u Ulimit) validate() error {
+	if _, ok := rlimitTypes[strings.ToLower(u.Name)]; !ok {
+		return fmt.Errorf("unknown ulimit %q", u.Name)
+	}
+	if u.Soft > u.Hard {
+		return fmt.Errorf("soft limit %d of ulimit %q is above its hard limit %d", u.Soft, u.Name, u.Hard)
+	}
+	return nil
+}
+
+// withUlimits sets the resource limits of the process of the spec, replacing its limits of the same
+// type, e.g. the default RLIMIT_NOFILE of containerd.
+func withUlimits(ulimits []Ulimit) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Process == nil {
+			s.Process = &specs.Process{}
+		}
+		for _, ulimit := range ulimits {
+			if err := ulimit.validate(); err != nil {
+				return err
+			}
+			rlimitType := rlimitTypes[strings.ToLower(ulimit.Name)]
+
+			rlimits := s.Process.Rlimits[:0]
+			for _, rlimit := range s.Process.Rlimits {
+				if rlimit.Type != rlimitType {
+					rlimits = append(rlimits, rlimit)
+				}
+			}
+			s.Process.Rlimits = append(rlimits, specs.POSIXRlimit{
+				Type: rlimitType,
+				Soft: ulimit.Soft,
+				Hard: ulimit.Hard,
+			})
+		}
+		return nil
+	}
+}
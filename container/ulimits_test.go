@@ -0,0 +1,41 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestWithUlimits(t *testing.T) {
+	g := NewWithT(t)
+
+	s := &oci.Spec{Process: &specs.Process{Rlimits: []specs.POSIXRlimit{{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024}}}}
+	opt := withUlimits([]Ulimit{
+		{Name: "nofile", Soft: 1048576, Hard: 1048576},
+		{Name: "MEMLOCK", Soft: 65536, Hard: 131072},
+	})
+	g.Expect(opt(context.Background(), nil, nil, s)).To(Succeed())
+	g.Expect(s.Process.Rlimits).To(ConsistOf(
+		specs.POSIXRlimit{Type: "RLIMIT_NOFILE", Soft: 1048576, Hard: 1048576},
+		specs.POSIXRlimit{Type: "RLIMIT_MEMLOCK", Soft: 65536, Hard: 131072},
+	))
+
+	g.Expect(withUlimits([]Ulimit{{Name: "files", Soft: 1, Hard: 1}})(context.Background(), nil, nil, &oci.Spec{})).ToNot(Succeed())
+	g.Expect(withUlimits([]Ulimit{{Name: "nproc", Soft: 2, Hard: 1}})(context.Background(), nil, nil, &oci.Spec{})).ToNot(Succeed())
+}
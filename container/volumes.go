@@ -0,0 +1,149 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/identifiers"
+)
+
+const (
+	// volumeDataDir is the directory of a named volume mounted into the containers, next to its
+	// metadata file.
+	volumeDataDir = "_data"
+	// volumeMetadataFile holds the VolumeInfo of a named volume.
+	volumeMetadataFile = "volume.json"
+)
+
+// ErrVolumeNotFound is wrapped by the error returned when a named volume does not exist.
+var ErrVolumeNotFound = errors.New("volume not found")
+
+// VolumeInfo describes a named volume.
+type VolumeInfo struct {
+	// Name is the name of the volume, unique in the containerd namespace of its cluster.
+	Name string `json:"name"`
+	// Labels are the labels the volume was created with.
+	Labels map[string]string `json:"labels,omitempty"`
+	// CreatedAt is when the volume was created.
+	CreatedAt time.Time `json:"createdAt"`
+	// Mountpoint is the directory on the host bind mounted into the containers using the volume.
+	Mountpoint string `json:"-"`
+}
+
+// namedVolumesDir returns the directory holding the named volumes of the namespace of the context.
+// The volumes of each cluster are apart, like its containers.
+func (c *containerdRuntime) namedVolumesDir(ctx context.Context) string {
+	return filepath.Join(c.stateDir, "named-volumes", c.namespaceFrom(ctx))
+}
+
+// CreateVolume creates the named volume, a directory owned by the provider that outlives the
+// containers mounting it, e.g. to keep the etcd data of a machine across the recreation of its
+// container. Creating a volume that exists returns it unchanged.
+func (c *containerdRuntime) CreateVolume(ctx context.Context, name string, labels map[string]string) (*VolumeInfo, error) {
+	if err := identifiers.Validate(name); err != nil {
+		return nil, fmt.Errorf("invalid volume name: %v", err)
+	}
+	if info, err := c.InspectVolume(ctx, name); !errors.Is(err, ErrVolumeNotFound) {
+		return info, err
+	}
+
+	dir := filepath.Join(c.namedVolumesDir(ctx), name)
+	if err := os.MkdirAll(filepath.Join(dir, volumeDataDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create volume %q: %v", name, err)
+	}
+	info := &VolumeInfo{Name: name, Labels: labels, CreatedAt: time.Now().UTC()}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal volume %q: %v", name, err)
+	}
+	// The metadata is written last, a volume without it is not listed and is created again.
+	if err := os.WriteFile(filepath.Join(dir, volumeMetadataFile), data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write volume %q: %v", name, err)
+	}
+	info.Mountpoint = filepath.Join(dir, volumeDataDir)
+	return info, nil
+}
+
+// InspectVolume returns the named volume, or an error wrapping ErrVolumeNotFound.
+func (c *containerdRuntime) InspectVolume(ctx context.Context, name string) (*VolumeInfo, error) {
+	if err := identifiers.Validate(name); err != nil {
+		return nil, fmt.Errorf("invalid volume name: %v", err)
+	}
+	dir := filepath.Join(c.namedVolumesDir(ctx), name)
+	data, err := os.ReadFile(filepath.Join(dir, volumeMetadataFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %q", ErrVolumeNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to read volume %q: %v", name, err)
+	}
+	info := &VolumeInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal volume %q: %v", name, err)
+	}
+	info.Mountpoint = filepath.Join(dir, volumeDataDir)
+	return info, nil
+}
+
+// ListVolumes returns the named volumes, sorted by name.
+func (c *containerdRuntime) ListVolumes(ctx context.Context) ([]VolumeInfo, error) {
+	entries, err := os.ReadDir(c.namedVolumesDir(ctx))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list volumes: %v", err)
+	}
+	volumes := []VolumeInfo{}
+	for _, entry := range entries {
+		info, err := c.InspectVolume(ctx, entry.Name())
+		if errors.Is(err, ErrVolumeNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, *info)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+// deleteNamedVolumes deletes all the named volumes of the namespace of the context.
+func (c *containerdRuntime) deleteNamedVolumes(ctx context.Context) error {
+	if err := os.RemoveAll(c.namedVolumesDir(ctx)); err != nil {
+		return fmt.Errorf("failed to delete volumes of namespace %q: %v", c.namespaceFrom(ctx), err)
+	}
+	return nil
+}
+
+// DeleteVolume deletes the named volume and its data. The containers mounting it must be deleted
+// first. Deleting a volume that does not exist is not an error.
+func (c *containerdRuntime) DeleteVolume(ctx context.Context, name string) error {
+	if err := identifiers.Validate(name); err != nil {
+		return fmt.Errorf("invalid volume name: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(c.namedVolumesDir(ctx), name)); err != nil {
+		return fmt.Errorf("failed to delete volume %q: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNamedVolumes(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &containerdRuntime{namespace: "default", stateDir: t.TempDir()}
+	ctx := ClusterInto(context.Background(), "team-a", "dev")
+
+	volume, err := c.CreateVolume(ctx, "etcd-0", map[string]string{"role": "etcd"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(volume.Mountpoint).To(BeADirectory())
+	g.Expect(os.WriteFile(filepath.Join(volume.Mountpoint, "member"), []byte("data"), 0o600)).To(Succeed())
+
+	// Creating the volume again keeps its data.
+	again, err := c.CreateVolume(ctx, "etcd-0", nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(again.Labels).To(HaveKeyWithValue("role", "etcd"))
+	g.Expect(filepath.Join(again.Mountpoint, "member")).To(BeARegularFile())
+
+	_, err = c.CreateVolume(ctx, "etcd-1", nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	volumes, err := c.ListVolumes(ctx)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(volumes).To(HaveLen(2))
+	g.Expect(volumes[0].Name).To(Equal("etcd-0"))
+
+	// The volumes of each cluster are apart.
+	volumes, err = c.ListVolumes(ClusterInto(context.Background(), "team-b", "dev"))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(volumes).To(BeEmpty())
+
+	g.Expect(c.DeleteVolume(ctx, "etcd-0")).To(Succeed())
+	g.Expect(c.DeleteVolume(ctx, "etcd-0")).To(Succeed())
+	_, err = c.InspectVolume(ctx, "etcd-0")
+	g.Expect(err).To(MatchError(ErrVolumeNotFound))
+
+	_, err = c.CreateVolume(ctx, "../etcd", nil)
+	g.Expect(err).To(MatchError(ContainSubstring("invalid volume name")))
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/typeurl"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+const (
+	// windowsOS is the OS of the platform of Windows containers.
+	windowsOS = "windows"
+	// windowsRuntime is the containerd shim running Windows containers with hcsshim, used when the
+	// context does not set a runtime handler.
+	windowsRuntime = "io.containerd.runhcs.v1"
+)
+
+// IsWindowsPlatform returns whether the containers run with the context are Windows containers,
+// i.e. whether the platform stored in the context is a Windows platform. Windows containers must be
+// run by a containerd daemon on a Windows host.
+func IsWindowsPlatform(ctx context.Context) bool {
+	platform, err := platformFrom(ctx)
+	return err == nil && platform.OS == windowsOS
+}
+
+// generateWindowsSpecOpts translates the run configuration into the options used to build the OCI
+// runtime spec of a Windows container. Windows containers are isolated by the host compute service,
+// they are not privileged and have no Linux devices, namespaces or sysctls.
+func (c *containerdRuntime) generateWindowsSpecOpts(runConfig *container.RunContainerInput, image containerd.Image) ([]oci.SpecOpts, error) {
+	opts := []oci.SpecOpts{
+		oci.WithImageConfigArgs(image, runConfig.CommandArgs),
+		oci.WithHostname(runConfig.Name), // make hostname match container name
+	}
+
+	if len(runConfig.Entrypoint) > 0 {
+		args := append(append([]string{}, runConfig.Entrypoint...), runConfig.CommandArgs...)
+		opts = append(opts, oci.WithProcessArgs(args...))
+	}
+
+	// Windows users are names, e.g. ContainerAdministrator, groups are not supported.
+	if runConfig.User != "" {
+		opts = append(opts, oci.WithUsername(runConfig.User))
+	}
+
+	if env := environmentVariables(runConfig); len(env) > 0 {
+		opts = append(opts, oci.WithEnv(env))
+	}
+
+	mounts, err := generateWindowsMounts(runConfig)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, oci.WithMounts(mounts))
+
+	return opts, nil
+}
+
+// generateWindowsMounts returns the bind mounts of a Windows container. Windows has no tmpfs, and
+// the anonymous volumes live in the state directory of the provider host, which is not the host
+// of the container.
+func generateWindowsMounts(runConfig *container.RunContainerInput) ([]specs.Mount, error) {
+	if len(runConfig.Tmpfs) > 0 {
+		return nil, fmt.Errorf("tmpfs mounts are not supported by Windows containers")
+	}
+	mounts := []specs.Mount{}
+	for _, m := range runConfig.Mounts {
+		mounts = append(mounts, windowsBindMount(m.Source, m.Target, m.ReadOnly))
+	}
+	for source, dest := range runConfig.Volumes {
+		if dest == "" {
+			return nil, fmt.Errorf("anonymous volume %q is not supported by Windows containers", source)
+		}
+		mounts = append(mounts, windowsBindMount(source, dest, false))
+	}
+	return mounts, nil
+}
+
+// windowsBindMount returns a bind mount of a host directory into a Windows container. hcsshim
+// treats the mounts without a type as bind mounts.
+func windowsBindMount(source, target string, readOnly bool) specs.Mount {
+	mode := "rw"
+	if readOnly {
+		mode = "ro"
+	}
+	return specs.Mount{Destination: target, Source: source, Options: []string{mode}}
+}
+
+// windowsResourceOpts returns the options setting the limits in the Windows resources of the OCI
+// spec. The number of CPUs of the container host is not known, so the CPU limit is rounded up to a
+// number of CPUs. Windows cannot limit the number of processes.
+func (r ResourceLimits) windowsResourceOpts() []oci.SpecOpts {
+	var opts []oci.SpecOpts
+	if r.MilliCPUs > 0 {
+		opts = append(opts, withWindowsCPUCount(uint64((r.MilliCPUs+999)/1000)))
+	}
+	if r.Memory > 0 {
+		opts = append(opts, oci.WithMemoryLimit(uint64(r.Memory)))
+	}
+	return opts
+}
+
+// withWindowsCPUCount sets the number of CPUs of a Windows container, oci.WithWindowsCPUCount is
+// only built for Windows.
+func withWindowsCPUCount(count uint64) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Windows == nil {
+			s.Windows = &specs.Windows{}
+		}
+		if s.Windows.Resources == nil {
+			s.Windows.Resources = &specs.WindowsResources{}
+		}
+		if s.Windows.Resources.CPU == nil {
+			s.Windows.Resources.CPU = &specs.WindowsCPUResources{}
+		}
+		s.Windows.Resources.CPU.Count = &count
+		return nil
+	}
+}
+
+// withNewSpecForPlatform generates the spec of the container for the given platform, rather than
+// for the platform of the containerd client.
+func withNewSpecForPlatform(platform ocispec.Platform, opts ...oci.SpecOpts) containerd.NewContainerOpts {
+	return func(ctx context.Context, client *containerd.Client, c *containers.Container) error {
+		s, err := oci.GenerateSpecWithPlatform(ctx, client, platforms.Format(platform), c, opts...)
+		if err != nil {
+			return err
+		}
+		c.Spec, err = typeurl.MarshalAny(s)
+		return err
+	}
+}
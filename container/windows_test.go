@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	. "github.com/onsi/gomega"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+func TestIsWindowsPlatform(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(IsWindowsPlatform(PlatformInto(context.Background(), "windows/amd64"))).To(BeTrue())
+	g.Expect(IsWindowsPlatform(PlatformInto(context.Background(), "linux/arm64"))).To(BeFalse())
+}
+
+func TestGenerateWindowsMounts(t *testing.T) {
+	g := NewWithT(t)
+
+	mounts, err := generateWindowsMounts(&container.RunContainerInput{
+		Mounts:  []container.Mount{{Source: `C:\data`, Target: `C:\data`, ReadOnly: true}},
+		Volumes: map[string]string{`C:\logs`: `C:\var\log`},
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(mounts).To(ConsistOf(
+		specs.Mount{Destination: `C:\data`, Source: `C:\data`, Options: []string{"ro"}},
+		specs.Mount{Destination: `C:\var\log`, Source: `C:\logs`, Options: []string{"rw"}},
+	))
+
+	_, err = generateWindowsMounts(&container.RunContainerInput{Tmpfs: map[string]string{"/tmp": ""}})
+	g.Expect(err).To(HaveOccurred())
+	_, err = generateWindowsMounts(&container.RunContainerInput{Volumes: map[string]string{"/var": ""}})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestResourceLimitsWindowsResourceOpts(t *testing.T) {
+	g := NewWithT(t)
+
+	limits := ResourceLimits{MilliCPUs: 1500, Memory: 2 << 30, Pids: 4096}
+	s := &oci.Spec{Windows: &specs.Windows{}}
+	for _, opt := range limits.windowsResourceOpts() {
+		g.Expect(opt(context.Background(), nil, nil, s)).To(Succeed())
+	}
+	g.Expect(*s.Windows.Resources.CPU.Count).To(Equal(uint64(2)))
+	g.Expect(*s.Windows.Resources.Memory.Limit).To(Equal(uint64(2 << 30)))
+}
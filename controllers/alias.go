@@ -19,11 +19,14 @@ package controllers
 
 import (
 	"context"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
 	ccontrollers "github.com/raminenia/cluster-api-provider-containerd/internal/controllers"
 	"sigs.k8s.io/cluster-api/test/infrastructure/container"
 )
@@ -31,10 +34,16 @@ import (
 // Following types provides access to reconcilers implemented in internal/controllers, thus
 // allowing users to provide a single binary "batteries included" with Cluster API and providers of choice.
 
+// OperationTimeouts bounds the operations on the containers of the machines, each one if set.
+type OperationTimeouts = ccontrollers.OperationTimeouts
+
 // ContainerdMachineReconciler reconciles a ContainerdMachine object.
 type ContainerdMachineReconciler struct {
 	Client           client.Client
 	ContainerRuntime container.Runtime
+	Hosts            *capc.HostPool
+	ReconcileTimeout time.Duration
+	Timeouts         OperationTimeouts
 }
 
 // SetupWithManager sets up the reconciler with the Manager.
@@ -42,6 +51,9 @@ func (r *ContainerdMachineReconciler) SetupWithManager(ctx context.Context, mgr
 	return (&ccontrollers.ContainerdMachineReconciler{
 		Client:           r.Client,
 		ContainerRuntime: r.ContainerRuntime,
+		Hosts:            r.Hosts,
+		ReconcileTimeout: r.ReconcileTimeout,
+		Timeouts:         r.Timeouts,
 	}).SetupWithManager(ctx, mgr, options)
 }
 
@@ -49,6 +61,8 @@ func (r *ContainerdMachineReconciler) SetupWithManager(ctx context.Context, mgr
 type ContainerdClusterReconciler struct {
 	Client           client.Client
 	ContainerRuntime container.Runtime
+	Hosts            *capc.HostPool
+	ReconcileTimeout time.Duration
 }
 
 // SetupWithManager sets up the reconciler with the Manager.
@@ -56,5 +70,64 @@ func (r *ContainerdClusterReconciler) SetupWithManager(ctx context.Context, mgr
 	return (&ccontrollers.ContainerdClusterReconciler{
 		Client:           r.Client,
 		ContainerRuntime: r.ContainerRuntime,
+		Hosts:            r.Hosts,
+		ReconcileTimeout: r.ReconcileTimeout,
+	}).SetupWithManager(ctx, mgr, options)
+}
+
+// ContainerdMachinePoolReconciler reconciles a ContainerdMachinePool object.
+type ContainerdMachinePoolReconciler struct {
+	Client           client.Client
+	ContainerRuntime container.Runtime
+	ReconcileTimeout time.Duration
+	Timeouts         OperationTimeouts
+}
+
+// SetupWithManager sets up the reconciler with the Manager.
+func (r *ContainerdMachinePoolReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	return (&ccontrollers.ContainerdMachinePoolReconciler{
+		Client:           r.Client,
+		ContainerRuntime: r.ContainerRuntime,
+		ReconcileTimeout: r.ReconcileTimeout,
+		Timeouts:         r.Timeouts,
 	}).SetupWithManager(ctx, mgr, options)
 }
+
+// StorageVersionMigrator migrates the stored ContainerdClusters and ContainerdMachines to the storage
+// version of their CRDs.
+type StorageVersionMigrator struct {
+	Client    client.Client
+	APIReader client.Reader
+}
+
+// SetupWithManager runs the migration once the manager is elected leader.
+func (m *StorageVersionMigrator) SetupWithManager(mgr ctrl.Manager) error {
+	return (&ccontrollers.StorageVersionMigrator{
+		Client:    m.Client,
+		APIReader: m.APIReader,
+	}).SetupWithManager(mgr)
+}
+
+// OrphanCollector deletes the containers of a containerd host whose objects no longer exist.
+type OrphanCollector struct {
+	APIReader        client.Reader
+	ContainerRuntime capc.Runtime
+	Host             string
+	Interval         time.Duration
+}
+
+// SetupWithManager runs the collector once the manager is elected leader.
+func (c *OrphanCollector) SetupWithManager(mgr ctrl.Manager) error {
+	return (&ccontrollers.OrphanCollector{
+		APIReader:        c.APIReader,
+		ContainerRuntime: c.ContainerRuntime,
+		Host:             c.Host,
+		Interval:         c.Interval,
+	}).SetupWithManager(mgr)
+}
+
+// RegisterMetrics registers the metrics of the reconciliations with the registerer, and a collector
+// of the ContainerdMachines read from the reader by phase.
+func RegisterMetrics(registerer prometheus.Registerer, reader client.Reader) error {
+	return ccontrollers.RegisterMetrics(registerer, reader)
+}
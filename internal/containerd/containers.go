@@ -0,0 +1,106 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/containerd/namespaces"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+)
+
+// ProviderContainer is a container created by the provider, with the objects it was created for
+// recorded in its labels.
+type ProviderContainer struct {
+	// Namespace is the containerd namespace of the container.
+	Namespace string
+	// Name is the name of the container.
+	Name string
+	// CreatedAt is the time the container was created.
+	CreatedAt time.Time
+	// ClusterNamespace is the namespace of the Cluster of the container.
+	ClusterNamespace string
+	// ClusterName is the name of the Cluster of the container.
+	ClusterName string
+	// Machine is the name of the Machine of a machine container, or of the instance of a machine
+	// pool. It is empty for a load balancer.
+	Machine string
+	// MachinePool is the name of the ContainerdMachinePool of an instance of a machine pool.
+	MachinePool string
+}
+
+// IsLoadBalancer returns true if the container is the load balancer of its cluster.
+func (c ProviderContainer) IsLoadBalancer() bool {
+	return c.Machine == ""
+}
+
+// ListProviderContainers returns the machine and load balancer containers created by the provider in
+// the containerd namespaces of the runtime and of its clusters.
+func ListProviderContainers(ctx context.Context) ([]ProviderContainer, error) {
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to container runtime")
+	}
+
+	namespaceNames, err := containerRuntime.ListNamespaces(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list containerd namespaces")
+	}
+
+	providerContainers := []ProviderContainer{}
+	for _, namespace := range namespaceNames {
+		nsCtx := namespaces.WithNamespace(ctx, namespace)
+		filters := container.FilterBuilder{}
+		filters.AddKeyValue(filterLabel, clusterNameLabelKey)
+		containers, err := containerRuntime.ListContainers(nsCtx, filters)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list containers of namespace %q", namespace)
+		}
+
+		for _, c := range containers {
+			info, err := containerRuntime.InspectContainer(nsCtx, c.Name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to inspect container %q of namespace %q", c.Name, namespace)
+			}
+			providerContainers = append(providerContainers, ProviderContainer{
+				Namespace:        namespace,
+				Name:             info.Name,
+				CreatedAt:        info.CreatedAt,
+				ClusterNamespace: info.Labels[clusterNamespaceLabelKey],
+				ClusterName:      info.Labels[clusterNameLabelKey],
+				Machine:          info.Labels[machineNameLabelKey],
+				MachinePool:      info.Labels[MachinePoolLabelKey],
+			})
+		}
+	}
+	return providerContainers, nil
+}
+
+// DeleteProviderContainer deletes a container created by the provider in the given containerd
+// namespace, e.g. one whose objects no longer exist.
+func DeleteProviderContainer(ctx context.Context, namespace, name string) error {
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to container runtime")
+	}
+	err = containerRuntime.DeleteContainer(namespaces.WithNamespace(ctx, namespace), name)
+	return errors.Wrapf(err, "failed to delete container %q of namespace %q", name, namespace)
+}
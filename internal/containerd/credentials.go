@@ -0,0 +1,117 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+)
+
+// RegistryCredentials returns the registry credentials held by the Secrets referenced by the
+// ContainerdCluster, its RegistryCredentialsRef and its ImagePullSecrets, and by the given image pull
+// Secrets of a machine, in this order of precedence, or nil if none is referenced.
+func RegistryCredentials(ctx context.Context, c client.Client, containerdCluster *infrav1.ContainerdCluster, imagePullSecrets []corev1.LocalObjectReference) (capc.RegistryCredentials, error) {
+	refs := make([]corev1.LocalObjectReference, 0, 1+len(containerdCluster.Spec.ImagePullSecrets)+len(imagePullSecrets))
+	if ref := containerdCluster.Spec.RegistryCredentialsRef; ref != nil {
+		refs = append(refs, *ref)
+	}
+	refs = append(refs, containerdCluster.Spec.ImagePullSecrets...)
+	refs = append(refs, imagePullSecrets...)
+
+	var creds capc.RegistryCredentials
+	for _, ref := range refs {
+		if ref.Name == "" {
+			continue
+		}
+		secretCreds, err := secretRegistryCredentials(ctx, c, client.ObjectKey{Namespace: containerdCluster.Namespace, Name: ref.Name})
+		if err != nil {
+			return nil, err
+		}
+		if creds == nil {
+			creds = capc.RegistryCredentials{}
+		}
+		for host, auth := range secretCreds {
+			creds[host] = auth
+		}
+	}
+	return creds, nil
+}
+
+// secretRegistryCredentials returns the registry credentials held by the Secret of type
+// kubernetes.io/dockerconfigjson of the given key.
+func secretRegistryCredentials(ctx context.Context, c client.Client, key client.ObjectKey) (capc.RegistryCredentials, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return nil, errors.Wrapf(err, "failed to get registry credentials secret %s", key)
+	}
+
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		return nil, errors.Errorf("registry credentials secret %s must be of type %s", key, corev1.SecretTypeDockerConfigJson)
+	}
+
+	data, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return nil, errors.Errorf("registry credentials secret %s has no %s key", key, corev1.DockerConfigJsonKey)
+	}
+
+	creds, err := capc.ParseDockerConfigJSON(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse registry credentials secret %s", key)
+	}
+	return creds, nil
+}
+
+// RegistryMirrors returns the registry mirrors configured on the ContainerdCluster.
+func RegistryMirrors(containerdCluster *infrav1.ContainerdCluster) []capc.RegistryMirror {
+	mirrors := make([]capc.RegistryMirror, 0, len(containerdCluster.Spec.RegistryMirrors))
+	for _, m := range containerdCluster.Spec.RegistryMirrors {
+		mirrors = append(mirrors, capc.RegistryMirror{
+			Registry:  m.Registry,
+			Endpoints: m.Endpoints,
+			Insecure:  m.Insecure,
+			CACert:    []byte(m.CACert),
+		})
+	}
+	return mirrors
+}
+
+// RegistryHosts returns the hosts.toml of the registries by certs.d directory held by the ConfigMap
+// referenced by the ContainerdCluster, or nil if the ContainerdCluster does not reference any.
+func RegistryHosts(ctx context.Context, c client.Client, containerdCluster *infrav1.ContainerdCluster) (map[string]string, error) {
+	ref := containerdCluster.Spec.RegistryHostsRef
+	if ref == nil || ref.Name == "" {
+		return nil, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: containerdCluster.Namespace, Name: ref.Name}
+	if err := c.Get(ctx, key, configMap); err != nil {
+		return nil, errors.Wrapf(err, "failed to get registry hosts configmap %s", key)
+	}
+	for dir := range configMap.Data {
+		if dir == "." || dir == ".." {
+			return nil, errors.Errorf("registry hosts configmap %s has an invalid registry host directory %q", key, dir)
+		}
+	}
+	return configMap.Data, nil
+}
@@ -16,7 +16,14 @@ limitations under the License.
 
 package containerd
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+)
 
 // ContainerNotRunningError is returned when trying to patch a container that is not running.
 type ContainerNotRunningError struct {
@@ -27,3 +34,53 @@ type ContainerNotRunningError struct {
 func (cse ContainerNotRunningError) Error() string {
 	return fmt.Sprintf("container with name %q is not running", cse.Name)
 }
+
+// maxCommandOutputLines is the number of output lines kept in a BootstrapCommandError.
+const maxCommandOutputLines = 10
+
+// BootstrapCommandError is returned when a bootstrap command fails, with the end of its output
+// so that the failure can be reported without access to the controller logs.
+type BootstrapCommandError struct {
+	Command string
+	Stdout  string
+	Stderr  string
+	Err     error
+}
+
+// Error returns the error string.
+func (e BootstrapCommandError) Error() string {
+	msg := fmt.Sprintf("bootstrap command %q failed: %v", e.Command, e.Err)
+	if out := tailLines(e.Stderr, maxCommandOutputLines); out != "" {
+		msg += ": " + out
+	}
+	return msg
+}
+
+// Unwrap returns the error of the command.
+func (e BootstrapCommandError) Unwrap() error {
+	return e.Err
+}
+
+// BootstrapExitCode returns the exit code of the bootstrap command that failed with the error, false
+// if the error is not the exit of a command, e.g. a timeout.
+func BootstrapExitCode(err error) (int32, bool) {
+	var exitErr *capc.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, false
+	}
+	return int32(exitErr.Code), true
+}
+
+// tailLines returns the last n non-empty lines of the output, joined with "; ".
+func tailLines(output string, n int) string {
+	lines := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd/types"
+)
+
+const (
+	// etcdPKIDir is the directory of the etcd certificates written by kubeadm, mounted in the etcd
+	// static pods.
+	etcdPKIDir = "/etc/kubernetes/pki/etcd"
+	// kubeadmClusterStatusKey is the key of the API endpoints of the control plane machines in the
+	// kubeadm-config ConfigMap, written by the kubeadm versions older than v1.22.
+	kubeadmClusterStatusKey = "ClusterStatus"
+)
+
+// RemoveEtcdMember removes the etcd member of the control plane machine, and its API endpoint from the
+// kubeadm-config ConfigMap, from another running control plane machine of the cluster, so that etcd
+// keeps its quorum once the machine is deleted. It does nothing without another running control plane
+// machine, or if the machine is not a member of the etcd cluster, e.g. with an external etcd or once
+// the control plane provider removed it.
+func (m *Machine) RemoveEtcdMember(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if m.container == nil {
+		return nil
+	}
+	node, err := m.otherControlPlaneNode(ctx)
+	if err != nil || node == nil {
+		return err
+	}
+
+	etcdContainer, err := runOutput(ctx, node, "crictl", "ps", "--quiet", "--state", "running", "--name", "^etcd$")
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the etcd container of %s", node.String())
+	}
+	if etcdContainer = strings.TrimSpace(etcdContainer); etcdContainer != "" {
+		etcdContainer = strings.Fields(etcdContainer)[0]
+		members, err := m.etcdctl(ctx, node, etcdContainer, "member", "list")
+		if err != nil {
+			return errors.Wrap(err, "failed to list the etcd members")
+		}
+		if id := etcdMemberID(members, m.ContainerName()); id != "" {
+			log.Info("Removing etcd member", "member", id)
+			if _, err := m.etcdctl(ctx, node, etcdContainer, "member", "remove", id); err != nil {
+				return errors.Wrapf(err, "failed to remove the etcd member %s", id)
+			}
+		}
+	}
+
+	return m.removeKubeadmAPIEndpoint(ctx, node)
+}
+
+// otherControlPlaneNode returns a running control plane node of the cluster other than the machine, if
+// any.
+func (m *Machine) otherControlPlaneNode(ctx context.Context) (*types.Node, error) {
+	nodes, err := listContainers(ctx, clusterFilters(m.namespace, m.cluster, controlPlaneRole))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, n := range nodes {
+		if n.Name != m.container.Name && n.IsRunning() {
+			return n, nil
+		}
+	}
+	return nil, nil
+}
+
+// etcdctl runs etcdctl in the etcd container of the node, against its local member.
+func (m *Machine) etcdctl(ctx context.Context, node *types.Node, etcdContainer string, args ...string) (string, error) {
+	endpoint := "https://127.0.0.1:2379"
+	if m.ipFamily == clusterv1.IPv6IPFamily {
+		endpoint = "https://[::1]:2379"
+	}
+	return runOutput(ctx, node, "crictl", append([]string{
+		"exec", etcdContainer, "etcdctl",
+		"--endpoints", endpoint,
+		"--cacert", etcdPKIDir + "/ca.crt",
+		"--cert", etcdPKIDir + "/healthcheck-client.crt",
+		"--key", etcdPKIDir + "/healthcheck-client.key",
+	}, args...)...)
+}
+
+// etcdMemberID returns the ID of the etcd member of the given name in the output of etcdctl member
+// list, one "ID, status, name, peer URLs, client URLs, is learner" line per member, or an empty
+// string if there is none. The members that did not start yet have no name.
+func etcdMemberID(members, name string) string {
+	if name == "" {
+		return ""
+	}
+	for _, line := range strings.Split(members, "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) >= 3 && strings.TrimSpace(fields[2]) == name {
+			return strings.TrimSpace(fields[0])
+		}
+	}
+	return ""
+}
+
+// removeKubeadmAPIEndpoint removes the API endpoint of the machine from the ClusterStatus of the
+// kubeadm-config ConfigMap, if any.
+func (m *Machine) removeKubeadmAPIEndpoint(ctx context.Context, node *types.Node) error {
+	kubectl := []string{"--kubeconfig", "/etc/kubernetes/admin.conf", "--namespace", "kube-system"}
+	data, err := runOutput(ctx, node, "kubectl", append(kubectl, "get", "configmap", "kubeadm-config", "--output", "jsonpath={.data."+kubeadmClusterStatusKey+"}")...)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the kubeadm-config ConfigMap")
+	}
+	if strings.TrimSpace(data) == "" {
+		return nil
+	}
+
+	updated, removed, err := removeAPIEndpoint(data, m.ContainerName())
+	if err != nil || !removed {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{"data": map[string]string{kubeadmClusterStatusKey: updated}})
+	if err != nil {
+		return errors.Wrap(err, "failed to generate the kubeadm-config ConfigMap patch")
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Removing the machine from the kubeadm cluster status")
+	if _, err := runOutput(ctx, node, "kubectl", append(kubectl, "patch", "configmap", "kubeadm-config", "--type", "merge", "--patch", string(patch))...); err != nil {
+		return errors.Wrap(err, "failed to patch the kubeadm-config ConfigMap")
+	}
+	return nil
+}
+
+// removeAPIEndpoint returns the kubeadm ClusterStatus without the API endpoint of the given node,
+// and whether it had one.
+func removeAPIEndpoint(clusterStatus, name string) (string, bool, error) {
+	status := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(clusterStatus), &status); err != nil {
+		return "", false, errors.Wrap(err, "failed to parse the kubeadm cluster status")
+	}
+	endpoints, ok := status["apiEndpoints"].(map[string]interface{})
+	if !ok {
+		return clusterStatus, false, nil
+	}
+	if _, ok := endpoints[name]; !ok {
+		return clusterStatus, false, nil
+	}
+	delete(endpoints, name)
+	updated, err := yaml.Marshal(status)
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to marshal the kubeadm cluster status")
+	}
+	return string(updated), true, nil
+}
+
+// runOutput runs the command in the node and returns its output.
+func runOutput(ctx context.Context, node *types.Node, command string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := node.Commander.Command(command, args...)
+	cmd.SetStdout(&stdout)
+	cmd.SetStderr(&stderr)
+	if err := cmd.Run(ctx); err != nil {
+		return "", errors.Wrapf(err, "%s: %s", command, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
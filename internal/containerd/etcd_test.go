@@ -0,0 +1,125 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+)
+
+func TestEtcdMemberID(t *testing.T) {
+	members := `8e9e05c52164694d, started, test-control-plane-abc12, https://172.18.0.3:2380, https://172.18.0.3:2379, false
+91bc3c398fb3c146, started, test-control-plane-abc12-1, https://172.18.0.4:2380, https://172.18.0.4:2379, false
+
+fd422379fda50e48, started, test-control-plane-def34, https://172.18.0.5:2380, https://172.18.0.5:2379, true
+`
+
+	tests := []struct {
+		name    string
+		members string
+		member  string
+		want    string
+	}{
+		{name: "member", members: members, member: "test-control-plane-abc12", want: "8e9e05c52164694d"},
+		{name: "name prefixed by another", members: members, member: "test-control-plane-abc12-1", want: "91bc3c398fb3c146"},
+		{name: "learner", members: members, member: "test-control-plane-def34", want: "fd422379fda50e48"},
+		{name: "no match", members: members, member: "test-control-plane"},
+		{name: "blank lines", members: "\n\n", member: "test-control-plane-abc12"},
+		{name: "unstarted member", members: "a8266ecf031671f3, unstarted, , https://172.18.0.6:2380, , false\n", member: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(etcdMemberID(tt.members, tt.member)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestRemoveAPIEndpoint(t *testing.T) {
+	clusterStatus := `apiEndpoints:
+  test-control-plane-abc12:
+    advertiseAddress: 172.18.0.3
+    bindPort: 6443
+  test-control-plane-def34:
+    advertiseAddress: 172.18.0.5
+    bindPort: 6443
+apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterStatus
+`
+
+	tests := []struct {
+		name          string
+		clusterStatus string
+		node          string
+		wantRemoved   bool
+		wantEndpoints []string
+		wantErr       bool
+	}{
+		{
+			name:          "endpoint",
+			clusterStatus: clusterStatus,
+			node:          "test-control-plane-abc12",
+			wantRemoved:   true,
+			wantEndpoints: []string{"test-control-plane-def34"},
+		},
+		{
+			name:          "no endpoint",
+			clusterStatus: clusterStatus,
+			node:          "test-control-plane",
+			wantEndpoints: []string{"test-control-plane-abc12", "test-control-plane-def34"},
+		},
+		{
+			name:          "no endpoints",
+			clusterStatus: "apiVersion: kubeadm.k8s.io/v1beta2\nkind: ClusterStatus\n",
+			node:          "test-control-plane-abc12",
+		},
+		{
+			name:          "invalid",
+			clusterStatus: "apiEndpoints: [",
+			node:          "test-control-plane-abc12",
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			updated, removed, err := removeAPIEndpoint(tt.clusterStatus, tt.node)
+			if tt.wantErr {
+				g.Expect(err).Should(HaveOccurred())
+				return
+			}
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(removed).To(Equal(tt.wantRemoved))
+
+			status := struct {
+				APIEndpoints map[string]interface{} `json:"apiEndpoints"`
+				Kind         string                 `json:"kind"`
+			}{}
+			g.Expect(yaml.Unmarshal([]byte(updated), &status)).To(Succeed())
+			g.Expect(status.Kind).To(Equal("ClusterStatus"))
+			endpoints := []string{}
+			for name := range status.APIEndpoints {
+				endpoints = append(endpoints, name)
+			}
+			g.Expect(endpoints).To(ConsistOf(tt.wantEndpoints))
+		})
+	}
+}
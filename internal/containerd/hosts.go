@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// hostsPath is the path of the hosts file of the machines.
+	hostsPath = "/etc/hosts"
+
+	// localHosts are the loopback entries of the hosts file of the machines.
+	localHosts = `127.0.0.1	localhost
+::1	localhost ip6-localhost ip6-loopback
+fe00::0	ip6-localnet
+ff00::0	ip6-mcastprefix
+ff02::1	ip6-allnodes
+ff02::2	ip6-allrouters
+`
+)
+
+// UpdateHosts writes the hosts file of the machine with entries for the load balancer and the other
+// machines of the cluster running on the same containerd, and the given host aliases, so that kubeadm
+// and the kubelet can reach them by name. The hosts file is only written if its entries changed, and
+// not while the machine is paused.
+func (m *Machine) UpdateHosts(ctx context.Context, aliases []infrav1.HostAlias) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if m.container == nil {
+		return errors.New("unable to update hosts. the container hosting this machine does not exists")
+	}
+	if paused, err := m.IsPaused(ctx); err != nil || paused {
+		return err
+	}
+
+	nodes, err := listContainers(ctx, clusterFilters(m.namespace, m.cluster, ""))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	entries := map[string][]string{}
+	for _, n := range nodes {
+		if !n.IsRunning() {
+			continue
+		}
+		ipv4, ipv6, err := n.IP(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get IP for container %s", n.String())
+		}
+		ip := ipv4
+		if m.ipFamily == clusterv1.IPv6IPFamily {
+			ip = ipv6
+		}
+		if ip != "" {
+			entries[ip] = append(entries[ip], n.String())
+		}
+	}
+	for _, alias := range aliases {
+		entries[alias.IP] = append(entries[alias.IP], alias.Hostnames...)
+	}
+	hosts := hostsFile(entries)
+
+	var current bytes.Buffer
+	cmd := m.container.Commander.Command("cat", hostsPath)
+	cmd.SetStdout(&current)
+	if err := cmd.Run(ctx); err == nil && current.String() == hosts {
+		return nil
+	}
+
+	log.Info("Updating machine hosts file")
+	// The hosts file is overwritten in place rather than replaced, as it may be a bind mount.
+	return errors.Wrap(m.container.WriteFile(ctx, hostsPath, hosts), "failed to write the machine hosts file")
+}
+
+// hostsFile returns the content of a hosts file with the loopback entries and the given host names
+// by IP address, sorted to only change when the entries do.
+func hostsFile(entries map[string][]string) string {
+	ips := make([]string, 0, len(entries))
+	for ip := range entries {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	var b strings.Builder
+	b.WriteString(localHosts)
+	b.WriteString("# Entries managed by cluster-api-provider-containerd\n")
+	for _, ip := range ips {
+		names := append([]string{}, entries[ip]...)
+		sort.Strings(names)
+		fmt.Fprintf(&b, "%s\t%s\n", ip, strings.Join(names, " "))
+	}
+	return b.String()
+}
+
+// registryHostsDir is the directory of the registry hosts configuration of the containerd of the
+// machines.
+const registryHostsDir = "/etc/containerd/certs.d"
+
+// UpdateRegistryHosts writes the given hosts.toml of the registries, by directory under
+// /etc/containerd/certs.d, into the machine. The containerd of the machine reads them on each pull,
+// a file is only written if it changed, and not while the machine is paused.
+func (m *Machine) UpdateRegistryHosts(ctx context.Context, hosts map[string]string) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if m.container == nil {
+		return errors.New("unable to update registry hosts. the container hosting this machine does not exists")
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	if paused, err := m.IsPaused(ctx); err != nil || paused {
+		return err
+	}
+
+	dirs := make([]string, 0, len(hosts))
+	for dir := range hosts {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		hostsPath := path.Join(registryHostsDir, dir, "hosts.toml")
+		var current bytes.Buffer
+		cmd := m.container.Commander.Command("cat", hostsPath)
+		cmd.SetStdout(&current)
+		if err := cmd.Run(ctx); err == nil && current.String() == hosts[dir] {
+			continue
+		}
+
+		log.Info("Updating machine registry hosts", "registry", dir)
+		if err := m.container.WriteFile(ctx, hostsPath, hosts[dir]); err != nil {
+			return errors.Wrapf(err, "failed to write the registry hosts of %s", dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"context"
+	"strings"
+
+	refdocker "github.com/containerd/containerd/reference/docker"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+)
+
+const (
+	// ociArchivePrefix prefixes the host path of an OCI image archive to preload into the machines.
+	ociArchivePrefix = "oci-archive://"
+	// dockerArchivePrefix prefixes the host path of a docker save archive to preload into the machines.
+	dockerArchivePrefix = "docker-archive://"
+)
+
+// imageArchivePath returns the host path of an image to preload given as an image archive, false if
+// the image is a reference pulled from a registry.
+func imageArchivePath(image string) (string, bool) {
+	for _, prefix := range []string{ociArchivePrefix, dockerArchivePrefix} {
+		if strings.HasPrefix(image, prefix) {
+			return strings.TrimPrefix(image, prefix), true
+		}
+	}
+	return "", false
+}
+
+// imageRepository returns the repository replacing the registry of the images of the cluster, empty
+// if none.
+func imageRepository(containerdCluster *infrav1.ContainerdCluster) string {
+	if containerdCluster == nil {
+		return ""
+	}
+	return containerdCluster.Spec.ImageRepository
+}
+
+// imageInRepository returns the image reference with its registry replaced by the repository, keeping
+// its path, tag and digest. The image is returned unchanged if no repository is set.
+func imageInRepository(image, repository string) (string, error) {
+	if repository == "" {
+		return image, nil
+	}
+	named, err := refdocker.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	ref := repository + "/" + refdocker.Path(named)
+	if tagged, ok := named.(refdocker.Tagged); ok {
+		ref += ":" + tagged.Tag()
+	}
+	if digested, ok := named.(refdocker.Digested); ok {
+		ref += "@" + digested.Digest().String()
+	}
+	return ref, nil
+}
+
+// ReferencedImages returns the images of the host referenced by the ContainerdMachines,
+// ContainerdMachineTemplates and ContainerdMachinePools, in the image repository of their cluster, so
+// that the images of the machines to create are not garbage collected.
+func ReferencedImages(ctx context.Context, c client.Reader) ([]string, error) {
+	type specImages struct {
+		namespace, cluster string
+		spec               infrav1.ContainerdMachineSpec
+	}
+	specs := []specImages{}
+
+	machines := &infrav1.ContainerdMachineList{}
+	if err := c.List(ctx, machines); err != nil {
+		return nil, errors.Wrap(err, "failed to list ContainerdMachines")
+	}
+	for _, machine := range machines.Items {
+		specs = append(specs, specImages{machine.Namespace, machine.Labels[clusterv1.ClusterLabelName], machine.Spec})
+	}
+	templates := &infrav1.ContainerdMachineTemplateList{}
+	if err := c.List(ctx, templates); err != nil {
+		return nil, errors.Wrap(err, "failed to list ContainerdMachineTemplates")
+	}
+	for _, template := range templates.Items {
+		specs = append(specs, specImages{template.Namespace, template.Labels[clusterv1.ClusterLabelName], template.Spec.Template.Spec})
+	}
+	pools := &infrav1.ContainerdMachinePoolList{}
+	if err := c.List(ctx, pools); err != nil {
+		return nil, errors.Wrap(err, "failed to list ContainerdMachinePools")
+	}
+	for _, pool := range pools.Items {
+		specs = append(specs, specImages{pool.Namespace, pool.Labels[clusterv1.ClusterLabelName], infrav1.ContainerdMachineSpec{
+			CustomImage:   pool.Spec.Template.CustomImage,
+			PreLoadImages: pool.Spec.Template.PreLoadImages,
+		}})
+	}
+
+	repositories := map[client.ObjectKey]string{}
+	images := []string{}
+	for _, s := range specs {
+		key := client.ObjectKey{Namespace: s.namespace, Name: s.cluster}
+		repository, ok := repositories[key]
+		if !ok && s.cluster != "" {
+			var err error
+			if repository, err = clusterImageRepository(ctx, c, key); err != nil {
+				return nil, err
+			}
+			repositories[key] = repository
+		}
+		for _, image := range append([]string{s.spec.CustomImage}, s.spec.PreLoadImages...) {
+			if _, ok := imageArchivePath(image); ok || image == "" {
+				continue
+			}
+			image, err := imageInRepository(image, repository)
+			if err != nil {
+				continue
+			}
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// clusterImageRepository returns the image repository of the ContainerdCluster of the cluster, empty
+// if none or if the cluster does not exist.
+func clusterImageRepository(ctx context.Context, c client.Reader, key client.ObjectKey) (string, error) {
+	cluster := &clusterv1.Cluster{}
+	if err := c.Get(ctx, key, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "failed to get Cluster %s", key)
+	}
+	if cluster.Spec.InfrastructureRef == nil {
+		return "", nil
+	}
+	containerdCluster := &infrav1.ContainerdCluster{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: key.Namespace, Name: cluster.Spec.InfrastructureRef.Name}, containerdCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "failed to get ContainerdCluster %s", cluster.Spec.InfrastructureRef.Name)
+	}
+	return imageRepository(containerdCluster), nil
+}
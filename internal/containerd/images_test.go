@@ -0,0 +1,83 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+)
+
+func TestReferencedImages(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	clusterLabels := map[string]string{clusterv1.ClusterLabelName: "test"}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: clusterv1.ClusterSpec{
+				InfrastructureRef: &corev1.ObjectReference{Name: "test-abc12"},
+			},
+		},
+		&infrav1.ContainerdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-abc12"},
+			Spec:       infrav1.ContainerdClusterSpec{ImageRepository: "registry.example.com"},
+		},
+		&infrav1.ContainerdMachine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-md-0-abc12", Labels: clusterLabels},
+			Spec: infrav1.ContainerdMachineSpec{
+				CustomImage:   "kindest/node:v1.24.0",
+				PreLoadImages: []string{"nginx:1.23", "oci-archive:///var/lib/images/app.tar"},
+			},
+		},
+		&infrav1.ContainerdMachineTemplate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-md-0"},
+			Spec: infrav1.ContainerdMachineTemplateSpec{
+				Template: infrav1.ContainerdMachineTemplateResource{
+					Spec: infrav1.ContainerdMachineSpec{CustomImage: "kindest/node:v1.23.6"},
+				},
+			},
+		},
+		&infrav1.ContainerdMachinePool{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-mp-0", Labels: map[string]string{clusterv1.ClusterLabelName: "deleted"}},
+			Spec: infrav1.ContainerdMachinePoolSpec{
+				Template: infrav1.ContainerdMachinePoolMachineTemplate{CustomImage: "kindest/node:v1.22.9"},
+			},
+		},
+	).Build()
+
+	images, err := ReferencedImages(context.Background(), c)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(images).To(ConsistOf(
+		"registry.example.com/kindest/node:v1.24.0",
+		"registry.example.com/library/nginx:1.23",
+		"kindest/node:v1.23.6",
+		"kindest/node:v1.22.9",
+	))
+}
@@ -19,13 +19,13 @@ package containerd
 import (
 	"context"
 	"fmt"
-	"net"
+	"path"
 
-	"github.com/pkg/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
 	"sigs.k8s.io/kind/pkg/cluster/constants"
 
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
 	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd/types"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/test/infrastructure/container"
@@ -56,16 +56,7 @@ type nodeCreateOpts struct {
 
 // CreateControlPlaneNode will create a new control plane container.
 func (m *Manager) CreateControlPlaneNode(ctx context.Context, name, image, clusterName, listenAddress string, port int32, mounts []v1alpha4.Mount, portMappings []v1alpha4.PortMapping, labels map[string]string, ipFamily clusterv1.ClusterIPFamily) (*types.Node, error) {
-	// gets a random host port for the API server
-	if port == 0 {
-		p, err := getPort()
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to get port for API server")
-		}
-		port = p
-	}
-
-	// add api server port mapping
+	// add api server port mapping, the runtime allocates a free host port if none is set
 	portMappingsWithAPIServer := append(portMappings, v1alpha4.PortMapping{
 		ListenAddress: listenAddress,
 		HostPort:      port,
@@ -106,30 +97,22 @@ func (m *Manager) CreateWorkerNode(ctx context.Context, name, image, clusterName
 }
 
 // CreateExternalLoadBalancerNode will create a new container to act as the load balancer for external access.
-func (m *Manager) CreateExternalLoadBalancerNode(ctx context.Context, name, image, clusterName, listenAddress string, port int32, ipFamily clusterv1.ClusterIPFamily) (*types.Node, error) {
-	// gets a random host port for control-plane load balancer
-	// gets a random host port for the API server
-	if port == 0 {
-		p, err := getPort()
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to get port for API server")
-		}
-		port = p
-	}
-
-	// load balancer port mapping
-	portMappings := []v1alpha4.PortMapping{{
+// The control plane port of the load balancer is published with the given port mappings.
+func (m *Manager) CreateExternalLoadBalancerNode(ctx context.Context, name, image, clusterName, listenAddress string, port, containerPort int32, portMappings []v1alpha4.PortMapping, labels map[string]string, ipFamily clusterv1.ClusterIPFamily) (*types.Node, error) {
+	// load balancer port mapping, the runtime allocates a free host port if none is set
+	portMappingsWithControlPlane := append(portMappings, v1alpha4.PortMapping{
 		ListenAddress: listenAddress,
 		HostPort:      port,
-		ContainerPort: ControlPlanePort,
+		ContainerPort: containerPort,
 		Protocol:      v1alpha4.PortMappingProtocolTCP,
-	}}
+	})
 	createOpts := &nodeCreateOpts{
 		Name:         name,
 		Image:        image,
 		ClusterName:  clusterName,
 		Role:         constants.ExternalLoadBalancerNodeRoleValue,
-		PortMappings: portMappings,
+		PortMappings: portMappingsWithControlPlane,
+		Labels:       labels,
 	}
 	node, err := createNode(ctx, createOpts)
 	if err != nil {
@@ -146,6 +129,8 @@ func createNode(ctx context.Context, opts *nodeCreateOpts) (*types.Node, error)
 	containerLabels := map[string]string{
 		clusterLabelKey:  opts.ClusterName,
 		nodeRoleLabelKey: opts.Role,
+		// containerd does not restart exited containers, let the provider do it.
+		capc.RestartPolicyLabel: capc.RestartPolicyAlways,
 	}
 	for name, value := range opts.Labels {
 		containerLabels[name] = value
@@ -157,10 +142,10 @@ func createNode(ctx context.Context, opts *nodeCreateOpts) (*types.Node, error)
 		Labels: containerLabels,
 		// runtime persistent storage
 		// this ensures that E.G. pods, logs etc. are not on the container
- 		// running kind in kind for "party tricks"
+		// running kind in kind for "party tricks"
 		// (please don't depend on doing this though!)
 		Volumes:      map[string]string{"/var": ""},
-		Mounts:       generateMountInfo(opts.Mounts),
+		Mounts:       generateMountInfo(opts.Mounts, true),
 		PortMappings: generatePortMappings(opts.PortMappings),
 		Network:      DefaultNetwork,
 		Tmpfs: map[string]string{
@@ -169,6 +154,35 @@ func createNode(ctx context.Context, opts *nodeCreateOpts) (*types.Node, error)
 		},
 		IPFamily: opts.IPFamily,
 	}
+	if capc.IsWindowsPlatform(ctx) {
+		// Windows containers have neither tmpfs nor anonymous volumes, and no kernel modules to read.
+		runOptions.Volumes = nil
+		runOptions.Tmpfs = nil
+		runOptions.Mounts = generateMountInfo(opts.Mounts, false)
+	}
+	// The given mounts override the default ones at the same path.
+	propagations := map[string]string{}
+	for _, mount := range opts.Mounts {
+		target := path.Clean(mount.ContainerPath)
+		delete(runOptions.Volumes, target)
+		delete(runOptions.Tmpfs, target)
+		if mount.HostPath == "" {
+			if runOptions.Tmpfs == nil {
+				return nil, fmt.Errorf("tmpfs mount %q is not supported by Windows containers", target)
+			}
+			runOptions.Tmpfs[target] = ""
+			continue
+		}
+		switch mount.Propagation {
+		case v1alpha4.MountPropagationBidirectional:
+			propagations[target] = "rshared"
+		case v1alpha4.MountPropagationHostToContainer:
+			propagations[target] = "rslave"
+		}
+	}
+	if len(propagations) > 0 {
+		ctx = capc.MountPropagationsInto(ctx, propagations)
+	}
 	log.V(6).Info("Container run options: %+v", runOptions)
 
 	containerRuntime, err := container.RuntimeFrom(ctx)
@@ -184,28 +198,28 @@ func createNode(ctx context.Context, opts *nodeCreateOpts) (*types.Node, error)
 	return types.NewNode(opts.Name, opts.Image, opts.Role), nil
 }
 
-// helper used to get a free TCP port for the API server.
-func getPort() (int32, error) {
-	listener, err := net.Listen("tcp", ":0") //nolint:gosec
-	if err != nil {
-		return 0, err
-	}
-	port := listener.Addr().(*net.TCPAddr).Port
-	if err := listener.Close(); err != nil {
-		return 0, err
-	}
-	return int32(port), nil
-}
-
-func generateMountInfo(mounts []v1alpha4.Mount) []container.Mount {
+// generateMountInfo returns the bind mounts of the given mounts, the ones without host path are tmpfs
+// mounts, and of the kernel modules of the host unless they are mounted.
+func generateMountInfo(mounts []v1alpha4.Mount, kernelModules bool) []container.Mount {
 	mountInfo := []container.Mount{}
 	for _, mount := range mounts {
+		if mount.HostPath == "" {
+			continue
+		}
 		mountInfo = append(mountInfo, container.Mount{
 			Source:   mount.HostPath,
 			Target:   mount.ContainerPath,
 			ReadOnly: mount.Readonly,
 		})
 	}
+	if !kernelModules {
+		return mountInfo
+	}
+	for _, mount := range mounts {
+		if path.Clean(mount.ContainerPath) == "/lib/modules" {
+			return mountInfo
+		}
+	}
 	// some k8s things want to read /lib/modules
 	mountInfo = append(mountInfo, container.Mount{
 		Source:   "/lib/modules",
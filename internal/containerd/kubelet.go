@@ -0,0 +1,151 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/provisioning"
+)
+
+const (
+	// kubeletDefaultsPath is the environment file of the kubelet service of the kind node images,
+	// whose KUBELET_EXTRA_ARGS come last on the command line of the kubelet.
+	kubeletDefaultsPath = "/etc/default/kubelet"
+	// kubeadmPatchesDir is the directory of the patches kubeadm applies to the configurations it writes.
+	kubeadmPatchesDir = "/etc/kubernetes/capc-patches"
+	// kubeletConfigPatchFile is the strategic merge patch of the kubeletconfiguration patch target.
+	kubeletConfigPatchFile = "kubeletconfiguration+strategic.yaml"
+	// kubeadmScriptPath is the script running kubeadm written by the Ignition bootstrap data.
+	kubeadmScriptPath = "/etc/kubeadm.sh"
+	// kubeletCredentialsPath is the docker config file the kubelet reads the credentials of the
+	// registries from.
+	kubeletCredentialsPath = "/var/lib/kubelet/config.json"
+)
+
+// KubeletConfig is the configuration of the kubelet of a machine, written into the machine before it
+// is bootstrapped.
+type KubeletConfig struct {
+	// ExtraArgs are the extra flags of the kubelet, by name without the leading dashes.
+	ExtraArgs map[string]string
+	// ConfigPatch is a strategic merge patch of the KubeletConfiguration written by kubeadm.
+	ConfigPatch string
+}
+
+// write writes the extra flags of the kubelet into its environment file and the patch of its
+// configuration into the patches directory of kubeadm.
+func (k KubeletConfig) write(ctx context.Context, m *Machine) error {
+	if len(k.ExtraArgs) > 0 {
+		if err := m.container.WriteFile(ctx, kubeletDefaultsPath, kubeletExtraArgs(k.ExtraArgs)); err != nil {
+			return errors.Wrap(err, "failed to write the extra args of the kubelet")
+		}
+	}
+	if k.ConfigPatch != "" {
+		if err := m.container.WriteFile(ctx, path.Join(kubeadmPatchesDir, kubeletConfigPatchFile), k.ConfigPatch); err != nil {
+			return errors.Wrap(err, "failed to write the patch of the kubelet configuration")
+		}
+	}
+	return nil
+}
+
+// UpdateKubeletCredentials writes the given registry credentials into the docker config file of the
+// kubelet of the machine, readable by root only, so that the images of the pods are pulled with them
+// without any credentials in flags or in the environment. The file is only written if the credentials
+// changed, and not while the machine is paused.
+func (m *Machine) UpdateKubeletCredentials(ctx context.Context, creds capc.RegistryCredentials) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if m.container == nil {
+		return errors.New("unable to update kubelet credentials. the container hosting this machine does not exists")
+	}
+	if len(creds) == 0 {
+		return nil
+	}
+	if paused, err := m.IsPaused(ctx); err != nil || paused {
+		return err
+	}
+
+	data, err := creds.DockerConfigJSON()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var current bytes.Buffer
+	cmd := m.container.Commander.Command("cat", kubeletCredentialsPath)
+	cmd.SetStdout(&current)
+	if err := cmd.Run(ctx); err == nil && bytes.Equal(current.Bytes(), data) {
+		return nil
+	}
+
+	log.Info("Updating machine kubelet credentials")
+	if err := m.container.WriteFile(ctx, kubeletCredentialsPath, string(data)); err != nil {
+		return errors.Wrap(err, "failed to write the kubelet credentials")
+	}
+	return errors.Wrap(m.container.Commander.Command("chmod", "0600", kubeletCredentialsPath).Run(ctx), "failed to restrict the kubelet credentials")
+}
+
+// kubeletExtraArgs returns the content of the environment file of the kubelet setting its extra flags,
+// sorted by name.
+func kubeletExtraArgs(args map[string]string) string {
+	flags := make([]string, 0, len(args))
+	for name, value := range args {
+		flags = append(flags, fmt.Sprintf("--%s=%s", name, value))
+	}
+	sort.Strings(flags)
+	return fmt.Sprintf("KUBELET_EXTRA_ARGS=%s\n", strings.Join(flags, " "))
+}
+
+// withKubeadmPatches adds the patches directory of the provider to the `kubeadm init` and `kubeadm
+// join` commands of the bootstrap data, the same way the provisioning adapters add the preflight
+// errors to ignore. It replaces the patches directory of the kubeadm configuration.
+func withKubeadmPatches(commands []provisioning.Cmd) []provisioning.Cmd {
+	patches := make([]provisioning.Cmd, 0, len(commands))
+	for _, c := range commands {
+		// case kubeadm commands are defined as a string, or in the script of the Ignition bootstrap data
+		if c.Cmd == "/bin/sh" && len(c.Args) >= 2 && c.Args[0] == "-c" {
+			args := append([]string{}, c.Args...)
+			args[1] = addKubeadmPatches(args[1])
+			c.Args = args
+			if strings.HasPrefix(c.Args[1], "cat > "+kubeadmScriptPath+" ") {
+				c.Stdin = addKubeadmPatches(c.Stdin)
+			}
+		}
+
+		// case kubeadm commands are defined as a list
+		if c.Cmd == "kubeadm" && len(c.Args) >= 1 && (c.Args[0] == "init" || c.Args[0] == "join") {
+			c.Args = append([]string{c.Args[0], "--patches", kubeadmPatchesDir}, c.Args[1:]...)
+		}
+		patches = append(patches, c)
+	}
+	return patches
+}
+
+// addKubeadmPatches adds the patches directory to the `kubeadm init` and `kubeadm join` commands of
+// the shell script.
+func addKubeadmPatches(script string) string {
+	script = strings.ReplaceAll(script, "kubeadm init", "kubeadm init --patches "+kubeadmPatchesDir)
+	return strings.ReplaceAll(script, "kubeadm join", "kubeadm join --patches "+kubeadmPatchesDir)
+}
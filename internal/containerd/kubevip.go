@@ -0,0 +1,191 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"text/template"
+
+	"github.com/pkg/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// kubeVIPManifestPath is the path of the static pod manifest of kube-vip on the control plane machines.
+const kubeVIPManifestPath = "/etc/kubernetes/manifests/kube-vip.yaml"
+
+// kubeVIPImage is the default image of kube-vip.
+var kubeVIPImage = loadBalancerImage{name: "kube-vip", repository: "ghcr.io/kube-vip", tag: "v0.5.0"}
+
+// kubeVIPManifestTemplate is the static pod of kube-vip, announcing the address of the control plane
+// endpoint with ARP from the leader of the control plane machines. The kubeconfig is created empty
+// on the machines joining the control plane until kubeadm writes it, so that it is not created as
+// a directory.
+var kubeVIPManifestTemplate = template.Must(template.New("kube-vip").Parse(`apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-vip
+  namespace: kube-system
+spec:
+  containers:
+  - name: kube-vip
+    image: {{ .Image }}
+    args:
+    - manager
+    env:
+    - name: vip_arp
+      value: "true"
+    - name: address
+      value: "{{ .Address }}"
+    - name: port
+      value: "{{ .Port }}"
+    - name: vip_interface
+      value: eth0
+    - name: vip_cidr
+      value: "{{ .CIDR }}"
+    - name: cp_enable
+      value: "true"
+    - name: cp_namespace
+      value: kube-system
+    - name: vip_leaderelection
+      value: "true"
+    - name: vip_leaseduration
+      value: "5"
+    - name: vip_renewdeadline
+      value: "3"
+    - name: vip_retryperiod
+      value: "1"
+    securityContext:
+      capabilities:
+        add:
+        - NET_ADMIN
+        - NET_RAW
+    volumeMounts:
+    - mountPath: /etc/kubernetes/admin.conf
+      name: kubeconfig
+  hostAliases:
+  - hostnames:
+    - kubernetes
+    ip: 127.0.0.1
+  hostNetwork: true
+  volumes:
+  - name: kubeconfig
+    hostPath:
+      path: /etc/kubernetes/admin.conf
+      type: FileOrCreate
+`))
+
+// kubeVIPLoadBalancer announces the control plane endpoint of a cluster from kube-vip static pods of
+// its control plane machines, there is no load balancer container.
+type kubeVIPLoadBalancer struct {
+	namespace string
+	name      string
+	image     string
+	endpoint  infrav1.APIEndpoint
+}
+
+// newKubeVIPLoadBalancer returns a new helper for managing the kube-vip static pods of the control
+// plane machines of the cluster.
+func newKubeVIPLoadBalancer(cluster *clusterv1.Cluster, containerdCluster *infrav1.ContainerdCluster) (*kubeVIPLoadBalancer, error) {
+	image, err := getLoadBalancerImage(containerdCluster, kubeVIPImage)
+	if err != nil {
+		return nil, errors.Wrap(err, "create load balancer")
+	}
+	return &kubeVIPLoadBalancer{
+		namespace: cluster.Namespace,
+		name:      cluster.Name,
+		image:     image,
+		endpoint:  containerdCluster.Spec.ControlPlaneEndpoint,
+	}, nil
+}
+
+// Create does nothing, kube-vip runs on the control plane machines.
+func (s *kubeVIPLoadBalancer) Create(ctx context.Context) error {
+	return nil
+}
+
+// Endpoint returns the control plane endpoint set by the user, whose address kube-vip announces.
+func (s *kubeVIPLoadBalancer) Endpoint(ctx context.Context) (infrav1.APIEndpoint, error) {
+	if s.endpoint.IsZero() {
+		return infrav1.APIEndpoint{}, errors.New("the control plane endpoint announced by kube-vip is not set")
+	}
+	return s.endpoint, nil
+}
+
+// IsRunning returns true, kube-vip runs with the API servers of the control plane machines.
+func (s *kubeVIPLoadBalancer) IsRunning(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+// UpdateConfiguration writes the kube-vip static pod manifest on the control plane machines, before
+// they are bootstrapped so that the kubelet starts it with the API server. kube-vip is not reloaded, the
+// kubelet restarts the static pods whose manifest changed.
+func (s *kubeVIPLoadBalancer) UpdateConfiguration(ctx context.Context) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	manifest, err := s.manifest()
+	if err != nil {
+		return false, err
+	}
+
+	controlPlaneNodes, err := listContainers(ctx, clusterFilters(s.namespace, s.name, controlPlaneRole))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	log.Info("Updating kube-vip static pods")
+	for _, n := range controlPlaneNodes {
+		if !n.IsRunning() {
+			continue
+		}
+		if err := n.WriteFile(ctx, kubeVIPManifestPath, manifest); err != nil {
+			return false, errors.Wrapf(err, "failed to write the kube-vip manifest of %s", n.String())
+		}
+	}
+	return false, nil
+}
+
+// manifest returns the kube-vip static pod manifest of the control plane machines.
+func (s *kubeVIPLoadBalancer) manifest() (string, error) {
+	ip := net.ParseIP(s.endpoint.Host)
+	if ip == nil {
+		return "", errors.Errorf("the control plane endpoint host %q announced by kube-vip is not an IP address", s.endpoint.Host)
+	}
+	cidr := 32
+	if ip.To4() == nil {
+		cidr = 128
+	}
+
+	var buff bytes.Buffer
+	if err := kubeVIPManifestTemplate.Execute(&buff, struct {
+		Image   string
+		Address string
+		Port    int
+		CIDR    int
+	}{s.image, s.endpoint.Host, s.endpoint.Port, cidr}); err != nil {
+		return "", errors.Wrap(err, "failed to generate the kube-vip manifest")
+	}
+	return buff.String(), nil
+}
+
+// Delete does nothing, the kube-vip static pods are deleted with the control plane machines.
+func (s *kubeVIPLoadBalancer) Delete(ctx context.Context) error {
+	return nil
+}
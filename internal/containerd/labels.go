@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+// The Cluster API metadata labels stamped on every container at creation. The containers are looked
+// up by these labels rather than by their names.
+const (
+	clusterNameLabelKey      = "io.x-k8s.capc.cluster.name"
+	clusterNamespaceLabelKey = "io.x-k8s.capc.cluster.namespace"
+	machineNameLabelKey      = "io.x-k8s.capc.machine.name"
+	roleLabelKey             = "io.x-k8s.capc.role"
+	providerVersionLabelKey  = "io.x-k8s.capc.provider.version"
+
+	// The values of the role label.
+	controlPlaneRole = "control-plane"
+	workerRole       = "worker"
+	loadBalancerRole = "lb"
+)
+
+// MachinePoolLabelKey labels the containers of the instances of a ContainerdMachinePool with the name
+// of the pool.
+const MachinePoolLabelKey = "io.x-k8s.capc.machine.pool"
+
+// ProviderVersion is the version of the provider recorded on the containers it creates, set at
+// build time with -ldflags "-X <module>/internal/containerd.ProviderVersion=<version>".
+var ProviderVersion = "dev"
+
+// metadataLabels returns the Cluster API metadata labels of a container of the cluster with the given
+// kind node role. The load balancer has no machine.
+func metadataLabels(clusterNamespace, clusterName, machine, kindRole string) map[string]string {
+	labels := map[string]string{
+		clusterNameLabelKey:      clusterName,
+		clusterNamespaceLabelKey: clusterNamespace,
+		roleLabelKey:             role(kindRole),
+		providerVersionLabelKey:  ProviderVersion,
+	}
+	if machine != "" {
+		labels[machineNameLabelKey] = machine
+	}
+	return labels
+}
+
+// role returns the value of the role label for a kind node role.
+func role(kindRole string) string {
+	switch kindRole {
+	case constants.ControlPlaneNodeRoleValue:
+		return controlPlaneRole
+	case constants.ExternalLoadBalancerNodeRoleValue:
+		return loadBalancerRole
+	default:
+		return workerRole
+	}
+}
+
+// kindRole returns the kind node role of a value of the role label.
+func kindRole(role string) string {
+	switch role {
+	case controlPlaneRole:
+		return constants.ControlPlaneNodeRoleValue
+	case loadBalancerRole:
+		return constants.ExternalLoadBalancerNodeRoleValue
+	default:
+		return constants.WorkerNodeRoleValue
+	}
+}
+
+// clusterFilters returns the filters selecting the containers of the cluster, only those with the
+// given role if set.
+func clusterFilters(clusterNamespace, clusterName, role string) container.FilterBuilder {
+	filters := container.FilterBuilder{}
+	filters.AddKeyNameValue(filterLabel, clusterNameLabelKey, clusterName)
+	filters.AddKeyNameValue(filterLabel, clusterNamespaceLabelKey, clusterNamespace)
+	if role != "" {
+		filters.AddKeyNameValue(filterLabel, roleLabelKey, role)
+	}
+	return filters
+}
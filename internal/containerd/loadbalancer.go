@@ -17,75 +17,195 @@ limitations under the License.
 package containerd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/pkg/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
 	"sigs.k8s.io/kind/pkg/cluster/constants"
 
-	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1alpha3"
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
 	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd/types"
 	"github.com/raminenia/cluster-api-provider-containerd/internal/third_party/forked/loadbalancer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
-	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+)
+
+// LoadBalancer manages the load balancer of the control plane endpoint of a cluster.
+type LoadBalancer interface {
+	// Create creates the load balancer of the cluster, unless it exists.
+	Create(ctx context.Context) error
+	// IsRunning returns true if the load balancer serves the control plane endpoint, always for the
+	// load balancers without a container.
+	IsRunning(ctx context.Context) (bool, error)
+	// Endpoint returns the control plane endpoint of the cluster served by the load balancer.
+	Endpoint(ctx context.Context) (infrav1.APIEndpoint, error)
+	// UpdateConfiguration updates the load balancer with the control plane machines of the cluster,
+	// and returns true if the load balancer was reloaded with a new configuration.
+	UpdateConfiguration(ctx context.Context) (bool, error)
+	// Delete deletes the load balancer of the cluster.
+	Delete(ctx context.Context) error
+}
+
+// loadBalancerImage is the default image of a load balancer type.
+type loadBalancerImage struct {
+	name       string
+	repository string
+	tag        string
+}
+
+// loadBalancerFlavor is a load balancer running in a container of the cluster, reloading the
+// configuration file written at configPath on SIGHUP.
+type loadBalancerFlavor struct {
+	image          loadBalancerImage
+	configPath     string
+	configTemplate string
+}
+
+var (
+	haproxyFlavor = loadBalancerFlavor{
+		image:          loadBalancerImage{name: loadbalancer.Image, repository: loadbalancer.DefaultImageRepository, tag: loadbalancer.DefaultImageTag},
+		configPath:     loadbalancer.ConfigPath,
+		configTemplate: loadbalancer.DefaultConfigTemplate,
+	}
+	nginxFlavor = loadBalancerFlavor{
+		image:          loadBalancerImage{name: "nginx", repository: "docker.io/library", tag: "1.23.1-alpine"},
+		configPath:     nginxConfigPath,
+		configTemplate: nginxConfigTemplate,
+	}
 )
 
 type lbCreator interface {
-	CreateExternalLoadBalancerNode(ctx context.Context, name, image, clusterName, listenAddress string, port int32, ipFamily clusterv1.ClusterIPFamily) (*types.Node, error)
+	CreateExternalLoadBalancerNode(ctx context.Context, name, image, clusterName, listenAddress string, port, containerPort int32, portMappings []v1alpha4.PortMapping, labels map[string]string, ipFamily clusterv1.ClusterIPFamily) (*types.Node, error)
 }
 
-// LoadBalancer manages the load balancer for a specific docker cluster.
-type LoadBalancer struct {
+// containerLoadBalancer manages the load balancer container of a cluster, running haproxy or nginx.
+type containerLoadBalancer struct {
+	flavor    loadBalancerFlavor
+	namespace string
 	name      string
 	image     string
 	container *types.Node
 	ipFamily  clusterv1.ClusterIPFamily
 	lbCreator lbCreator
+	// port is the port the load balancer listens on for the API servers.
+	port int32
+	// hostAddress is the address of the host the port of the load balancer is published on for the
+	// control plane endpoint, if set, instead of the address of the container.
+	hostAddress string
+	// hostPort is the port of the host the port of the load balancer is published on, a free port
+	// if zero.
+	hostPort int32
+	// backendPort is the port of the API servers on the control plane nodes.
+	backendPort int32
+	// frontends are the additional ports the load balancer forwards to the nodes.
+	frontends []infrav1.LoadBalancerFrontend
+	// configTemplate is the template of the load balancer configuration, the one of the flavor if empty.
+	configTemplate string
 }
 
-// NewLoadBalancer returns a new helper for managing a docker loadbalancer with a given name.
-func NewLoadBalancer(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrav1.ContainerdCluster) (*LoadBalancer, error) {
+// NewLoadBalancer returns a new helper for managing the load balancer of the cluster, of the type of
+// its spec.
+func NewLoadBalancer(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrav1.ContainerdCluster) (LoadBalancer, error) {
 	if cluster.Name == "" {
 		return nil, errors.New("create load balancer: cluster name is empty")
 	}
 
+	var lbType infrav1.LoadBalancerType
+	if containerdCluster != nil {
+		lbType = containerdCluster.Spec.LoadBalancer.Type
+		if containerdCluster.Spec.LoadBalancer.ExternallyManaged {
+			lbType = infrav1.NoneLoadBalancerType
+		}
+	}
+	switch lbType {
+	case "", infrav1.HAProxyLoadBalancerType:
+		return newContainerLoadBalancer(ctx, cluster, containerdCluster, haproxyFlavor)
+	case infrav1.NginxLoadBalancerType:
+		return newContainerLoadBalancer(ctx, cluster, containerdCluster, nginxFlavor)
+	case infrav1.KubeVIPLoadBalancerType:
+		return newKubeVIPLoadBalancer(cluster, containerdCluster)
+	case infrav1.NoneLoadBalancerType:
+		return &externalLoadBalancer{endpoint: containerdCluster.Spec.ControlPlaneEndpoint}, nil
+	default:
+		return nil, errors.Errorf("create load balancer: unknown load balancer type %q", lbType)
+	}
+}
+
+// newContainerLoadBalancer returns a new helper for managing the load balancer container of the
+// cluster, of the given flavor.
+func newContainerLoadBalancer(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrav1.ContainerdCluster, flavor loadBalancerFlavor) (*containerLoadBalancer, error) {
 	// Look for the container that is hosting the loadbalancer for the cluster.
 	// Filter based on the label and the roles regardless of whether or not it is running.
 	// If non-running container is chosen, then it will not have an IP address associated with it.
-	filters := container.FilterBuilder{}
-	filters.AddKeyNameValue(filterLabel, clusterLabelKey, cluster.Name)
-	filters.AddKeyNameValue(filterLabel, nodeRoleLabelKey, constants.ExternalLoadBalancerNodeRoleValue)
+	filters := clusterFilters(cluster.Namespace, cluster.Name, loadBalancerRole)
 
 	container, err := getContainer(ctx, filters)
 	if err != nil {
 		return nil, err
 	}
 
-	ipFamily, err := cluster.GetIPFamily()
+	ipFamily, err := IPFamily(cluster, containerdCluster)
 	if err != nil {
 		return nil, fmt.Errorf("create load balancer: %s", err)
 	}
 
-	image := getLoadBalancerImage(containerdCluster)
+	image, err := getLoadBalancerImage(containerdCluster, flavor.image)
+	if err != nil {
+		return nil, errors.Wrap(err, "create load balancer")
+	}
 
-	return &LoadBalancer{
-		name:      cluster.Name,
-		image:     image,
-		container: container,
-		ipFamily:  ipFamily,
-		lbCreator: &Manager{},
+	port, backendPort := int32(ControlPlanePort), int32(KubeadmContainerPort)
+	var hostAddress string
+	var hostPort int32
+	var frontends []infrav1.LoadBalancerFrontend
+	var configTemplate string
+	if containerdCluster != nil {
+		// The port of a control plane endpoint on the host of the load balancer is kept when its
+		// container is created again.
+		hostAddress = containerdCluster.Spec.LoadBalancer.HostAddress
+		if hostAddress != "" && !containerdCluster.Spec.ControlPlaneEndpoint.IsZero() {
+			hostPort = int32(containerdCluster.Spec.ControlPlaneEndpoint.Port)
+		}
+		if containerdCluster.Spec.LoadBalancer.Port != 0 {
+			port = containerdCluster.Spec.LoadBalancer.Port
+		}
+		if containerdCluster.Spec.LoadBalancer.BackendPort != 0 {
+			backendPort = containerdCluster.Spec.LoadBalancer.BackendPort
+		}
+		frontends = containerdCluster.Spec.LoadBalancer.Frontends
+		configTemplate = containerdCluster.Spec.LoadBalancer.CustomConfigTemplate
+	}
+
+	return &containerLoadBalancer{
+		flavor:         flavor,
+		namespace:      cluster.Namespace,
+		name:           cluster.Name,
+		image:          image,
+		container:      container,
+		ipFamily:       ipFamily,
+		lbCreator:      &Manager{},
+		port:           port,
+		hostAddress:    hostAddress,
+		hostPort:       hostPort,
+		backendPort:    backendPort,
+		frontends:      frontends,
+		configTemplate: configTemplate,
 	}, nil
 }
 
 // getLoadBalancerImage will return the image (e.g. "kindest/haproxy:2.1.1-alpine") to use for
-// the load balancer.
-func getLoadBalancerImage(containerdCluster *infrav1.ContainerdCluster) string {
+// the load balancer, the given default image unless the cluster sets another repository or tag. The
+// image repository of the cluster replaces the registry of the default image.
+func getLoadBalancerImage(containerdCluster *infrav1.ContainerdCluster, defaultImage loadBalancerImage) (string, error) {
 	// Check if a non-default image was provided
-	image := loadbalancer.Image
-	imageRepo := loadbalancer.DefaultImageRepository
-	imageTag := loadbalancer.DefaultImageTag
+	image := defaultImage.name
+	imageRepo := defaultImage.repository
+	imageTag := defaultImage.tag
 
 	if containerdCluster != nil {
 		if containerdCluster.Spec.LoadBalancer.ImageRepository != "" {
@@ -96,16 +216,20 @@ func getLoadBalancerImage(containerdCluster *infrav1.ContainerdCluster) string {
 		}
 	}
 
-	return fmt.Sprintf("%s/%s:%s", imageRepo, image, imageTag)
+	ref := fmt.Sprintf("%s/%s:%s", imageRepo, image, imageTag)
+	if containerdCluster != nil && containerdCluster.Spec.LoadBalancer.ImageRepository != "" {
+		return ref, nil
+	}
+	return imageInRepository(ref, imageRepository(containerdCluster))
 }
 
 // ContainerName is the name of the docker container with the load balancer.
-func (s *LoadBalancer) containerName() string {
+func (s *containerLoadBalancer) containerName() string {
 	return fmt.Sprintf("%s-lb", s.name)
 }
 
 // Create creates a docker container hosting a load balancer for the cluster.
-func (s *LoadBalancer) Create(ctx context.Context) error {
+func (s *containerLoadBalancer) Create(ctx context.Context) error {
 	log := ctrl.LoggerFrom(ctx)
 	log = log.WithValues("cluster", s.name, "ipFamily", s.ipFamily)
 
@@ -117,13 +241,27 @@ func (s *LoadBalancer) Create(ctx context.Context) error {
 	if s.container == nil {
 		var err error
 		log.Info("Creating load balancer container")
+		// The load balancer is healthy as long as it accepts connections on the control plane port.
+		ctx = capc.HealthCheckInto(ctx, capc.HealthCheck{TCPPort: int(s.port)})
+		portMappings := make([]v1alpha4.PortMapping, 0, len(s.frontends))
+		for _, frontend := range s.frontends {
+			portMappings = append(portMappings, v1alpha4.PortMapping{
+				ListenAddress: listenAddr,
+				HostPort:      frontend.HostPort,
+				ContainerPort: frontend.Port,
+				Protocol:      v1alpha4.PortMappingProtocolTCP,
+			})
+		}
 		s.container, err = s.lbCreator.CreateExternalLoadBalancerNode(
 			ctx,
 			s.containerName(),
 			s.image,
 			s.name,
 			listenAddr,
-			0,
+			s.hostPort,
+			s.port,
+			portMappings,
+			metadataLabels(s.namespace, s.name, "", constants.ExternalLoadBalancerNodeRoleValue),
 			s.ipFamily,
 		)
 		if err != nil {
@@ -134,56 +272,138 @@ func (s *LoadBalancer) Create(ctx context.Context) error {
 	return nil
 }
 
-// UpdateConfiguration updates the external load balancer configuration with new control plane nodes.
-func (s *LoadBalancer) UpdateConfiguration(ctx context.Context) error {
+// UpdateConfiguration updates the external load balancer configuration with new control plane nodes,
+// and the nodes the additional frontends forward to. The load balancer is reloaded if its configuration
+// changed.
+func (s *containerLoadBalancer) UpdateConfiguration(ctx context.Context) (bool, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	if s.container == nil {
-		return errors.New("unable to configure load balancer: load balancer container does not exists")
+		return false, errors.New("unable to configure load balancer: load balancer container does not exists")
 	}
 
 	// collect info about the existing controlplane nodes
-	filters := container.FilterBuilder{}
-	filters.AddKeyNameValue(filterLabel, clusterLabelKey, s.name)
-	filters.AddKeyNameValue(filterLabel, nodeRoleLabelKey, constants.ControlPlaneNodeRoleValue)
+	filters := clusterFilters(s.namespace, s.name, controlPlaneRole)
 
 	controlPlaneNodes, err := listContainers(ctx, filters)
 	if err != nil {
-		return errors.WithStack(err)
+		return false, errors.WithStack(err)
 	}
 
-	var backendServers = map[string]string{}
-	for _, n := range controlPlaneNodes {
-		controlPlaneIPv4, controlPlaneIPv6, err := n.IP(ctx)
-		if err != nil {
-			return errors.Wrapf(err, "failed to get IP for container %s", n.String())
+	backendServers, err := s.backendServers(ctx, controlPlaneNodes, s.backendPort)
+	if err != nil {
+		return false, err
+	}
+
+	var workerNodes []*types.Node
+	var listedWorkers bool
+	frontends := make([]loadbalancer.Frontend, 0, len(s.frontends))
+	for _, frontend := range s.frontends {
+		nodes := controlPlaneNodes
+		if frontend.BackendRole == infrav1.WorkerBackendRole {
+			if !listedWorkers {
+				workerNodes, err = listContainers(ctx, clusterFilters(s.namespace, s.name, workerRole))
+				if err != nil {
+					return false, errors.WithStack(err)
+				}
+				listedWorkers = true
+			}
+			nodes = workerNodes
 		}
-		if s.ipFamily == clusterv1.IPv6IPFamily {
-			backendServers[n.String()] = net.JoinHostPort(controlPlaneIPv6, "6443")
-		} else {
-			backendServers[n.String()] = net.JoinHostPort(controlPlaneIPv4, "6443")
+		frontendServers, err := s.backendServers(ctx, nodes, frontend.BackendPort)
+		if err != nil {
+			return false, err
 		}
+		frontends = append(frontends, loadbalancer.Frontend{
+			Name:           frontend.Name,
+			Port:           int(frontend.Port),
+			BackendServers: frontendServers,
+		})
 	}
 
+	configTemplate := s.configTemplate
+	if configTemplate == "" {
+		configTemplate = s.flavor.configTemplate
+	}
 	loadBalancerConfig, err := loadbalancer.Config(&loadbalancer.ConfigData{
-		ControlPlanePort: 6443,
+		ControlPlanePort: int(s.port),
 		BackendServers:   backendServers,
 		IPv6:             s.ipFamily == clusterv1.IPv6IPFamily,
-	})
+		Frontends:        frontends,
+	}, configTemplate)
 	if err != nil {
-		return errors.WithStack(err)
+		return false, errors.WithStack(err)
+	}
+
+	// The load balancer is only reloaded when its backends or frontends changed.
+	var current bytes.Buffer
+	cmd := s.container.Commander.Command("cat", s.flavor.configPath)
+	cmd.SetStdout(&current)
+	if err := cmd.Run(ctx); err == nil && current.String() == loadBalancerConfig {
+		return false, nil
 	}
 
 	log.Info("Updating load balancer configuration")
-	if err := s.container.WriteFile(ctx, loadbalancer.ConfigPath, loadBalancerConfig); err != nil {
-		return errors.WithStack(err)
+	if err := s.container.WriteFile(ctx, s.flavor.configPath, loadBalancerConfig); err != nil {
+		return false, errors.WithStack(err)
 	}
 
-	return errors.WithStack(s.container.Kill(ctx, "SIGHUP"))
+	if err := s.container.Kill(ctx, "SIGHUP"); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return true, nil
+}
+
+// backendServers returns the addresses of the given port of the nodes, by node name.
+func (s *containerLoadBalancer) backendServers(ctx context.Context, nodes []*types.Node, port int32) (map[string]string, error) {
+	servers := map[string]string{}
+	for _, n := range nodes {
+		ipv4, ipv6, err := n.IP(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get IP for container %s", n.String())
+		}
+		if s.ipFamily == clusterv1.IPv6IPFamily {
+			servers[n.String()] = net.JoinHostPort(ipv6, strconv.Itoa(int(port)))
+		} else {
+			servers[n.String()] = net.JoinHostPort(ipv4, strconv.Itoa(int(port)))
+		}
+	}
+	return servers, nil
+}
+
+// Endpoint returns the IP address of the load balancer container, and the port it listens on for
+// the API servers, or the host address of the load balancer and the port of the host its port is
+// published on.
+func (s *containerLoadBalancer) Endpoint(ctx context.Context) (infrav1.APIEndpoint, error) {
+	if s.container == nil {
+		return infrav1.APIEndpoint{}, errors.New("unable to get load balancer endpoint: load balancer container does not exists")
+	}
+	if s.hostAddress != "" {
+		hostPort, err := s.HostPort(ctx)
+		if err != nil {
+			return infrav1.APIEndpoint{}, err
+		}
+		return infrav1.APIEndpoint{Host: s.hostAddress, Port: int(hostPort)}, nil
+	}
+	ip, err := s.IP(ctx)
+	if err != nil {
+		return infrav1.APIEndpoint{}, err
+	}
+	return infrav1.APIEndpoint{Host: ip, Port: int(s.port)}, nil
+}
+
+// IsRunning returns true if the load balancer container is running.
+func (s *containerLoadBalancer) IsRunning(ctx context.Context) (bool, error) {
+	// The container status is read again, a container just created has none.
+	container, err := getContainer(ctx, clusterFilters(s.namespace, s.name, loadBalancerRole))
+	if err != nil {
+		return false, err
+	}
+	return container != nil && container.IsRunning(), nil
 }
 
 // IP returns the load balancer IP address.
-func (s *LoadBalancer) IP(ctx context.Context) (string, error) {
+func (s *containerLoadBalancer) IP(ctx context.Context) (string, error) {
 	lbIPv4, lbIPv6, err := s.container.IP(ctx)
 	if err != nil {
 		return "", errors.WithStack(err)
@@ -201,8 +421,24 @@ func (s *LoadBalancer) IP(ctx context.Context) (string, error) {
 	return lbIP, nil
 }
 
+// HostPort returns the host port published for the load balancer control plane port.
+func (s *containerLoadBalancer) HostPort(ctx context.Context) (int32, error) {
+	if s.container == nil {
+		return 0, errors.New("unable to get load balancer host port: load balancer container does not exists")
+	}
+	hostPort, err := s.container.HostPort(ctx, s.port)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	port, err := strconv.ParseInt(hostPort, 10, 32)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid load balancer host port %q", hostPort)
+	}
+	return int32(port), nil
+}
+
 // Delete the docker container hosting the cluster load balancer.
-func (s *LoadBalancer) Delete(ctx context.Context) error {
+func (s *containerLoadBalancer) Delete(ctx context.Context) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	if s.container != nil {
@@ -214,3 +450,37 @@ func (s *LoadBalancer) Delete(ctx context.Context) error {
 	}
 	return nil
 }
+
+// externalLoadBalancer is a load balancer managed outside of the provider, serving the control plane
+// endpoint set by the user.
+type externalLoadBalancer struct {
+	endpoint infrav1.APIEndpoint
+}
+
+// Create does nothing, the load balancer is managed by the user.
+func (s *externalLoadBalancer) Create(ctx context.Context) error {
+	return nil
+}
+
+// Endpoint returns the control plane endpoint set by the user.
+func (s *externalLoadBalancer) Endpoint(ctx context.Context) (infrav1.APIEndpoint, error) {
+	if s.endpoint.IsZero() {
+		return infrav1.APIEndpoint{}, errors.New("the control plane endpoint of an externally managed load balancer is not set")
+	}
+	return s.endpoint, nil
+}
+
+// IsRunning returns true, the load balancer is managed by the user.
+func (s *externalLoadBalancer) IsRunning(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+// UpdateConfiguration does nothing, the load balancer is configured by the user.
+func (s *externalLoadBalancer) UpdateConfiguration(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// Delete does nothing, the load balancer is managed by the user.
+func (s *externalLoadBalancer) Delete(ctx context.Context) error {
+	return nil
+}
@@ -21,19 +21,26 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	refdocker "github.com/containerd/containerd/reference/docker"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
 	"sigs.k8s.io/kind/pkg/cluster/constants"
 
-	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1alpha3"
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
 	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd/types"
 	"github.com/raminenia/cluster-api-provider-containerd/internal/provisioning"
 	"github.com/raminenia/cluster-api-provider-containerd/internal/provisioning/cloudinit"
@@ -41,13 +48,17 @@ import (
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
 	"sigs.k8s.io/cluster-api/test/infrastructure/container"
-	clusterapicontainer "sigs.k8s.io/cluster-api/util/container"
 )
 
-const (
-	defaultImageName = "kindest/node"
-	defaultImageTag  = "v1.23.3"
-)
+// defaultImageTag is the tag of the image of the machines without a Kubernetes version.
+const defaultImageTag = "v1.23.3"
+
+// kubectlDrainTimeout is how long a kubectl drain of the node of a machine waits for its pods to be
+// evicted, the drain is retried by the next reconciliation.
+const kubectlDrainTimeout = 30 * time.Second
+
+// kubeadmResetTimeout is how long the deletion of a machine waits for kubeadm reset.
+const kubeadmResetTimeout = time.Minute
 
 type nodeCreator interface {
 	CreateControlPlaneNode(ctx context.Context, name, image, clusterName, listenAddress string, port int32, mounts []v1alpha4.Mount, portMappings []v1alpha4.PortMapping, labels map[string]string, ipFamily clusterv1.ClusterIPFamily) (node *types.Node, err error)
@@ -56,16 +67,19 @@ type nodeCreator interface {
 
 // Machine implement a service for managing the docker containers hosting a kubernetes nodes.
 type Machine struct {
+	namespace string
 	cluster   string
 	machine   string
 	ipFamily  clusterv1.ClusterIPFamily
 	container *types.Node
+	// imageRepository replaces the registry of the machine image and of the preloaded images.
+	imageRepository string
 
 	nodeCreator nodeCreator
 }
 
-// NewMachine returns a new Machine service for the given Cluster/DockerCluster pair.
-func NewMachine(ctx context.Context, cluster *clusterv1.Cluster, machine string, filterLabels map[string]string) (*Machine, error) {
+// NewMachine returns a new Machine service for the given Cluster/ContainerdCluster pair.
+func NewMachine(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrav1.ContainerdCluster, machine string, filterLabels map[string]string) (*Machine, error) {
 	if cluster == nil {
 		return nil, errors.New("cluster is required when creating a docker.Machine")
 	}
@@ -76,9 +90,8 @@ func NewMachine(ctx context.Context, cluster *clusterv1.Cluster, machine string,
 		return nil, errors.New("machine is required when creating a docker.Machine")
 	}
 
-	filters := container.FilterBuilder{}
-	filters.AddKeyNameValue(filterLabel, clusterLabelKey, cluster.Name)
-	filters.AddKeyValue(filterName, fmt.Sprintf("^%s$", machineContainerName(cluster.Name, machine)))
+	filters := clusterFilters(cluster.Namespace, cluster.Name, "")
+	filters.AddKeyNameValue(filterLabel, machineNameLabelKey, machine)
 	for key, val := range filterLabels {
 		filters.AddKeyNameValue(filterLabel, key, val)
 	}
@@ -88,22 +101,24 @@ func NewMachine(ctx context.Context, cluster *clusterv1.Cluster, machine string,
 		return nil, err
 	}
 
-	ipFamily, err := cluster.GetIPFamily()
+	ipFamily, err := IPFamily(cluster, containerdCluster)
 	if err != nil {
 		return nil, fmt.Errorf("create docker machine: %s", err)
 	}
 
 	return &Machine{
-		cluster:     cluster.Name,
-		machine:     machine,
-		ipFamily:    ipFamily,
-		container:   newContainer,
-		nodeCreator: &Manager{},
+		namespace:       cluster.Namespace,
+		cluster:         cluster.Name,
+		machine:         machine,
+		ipFamily:        ipFamily,
+		container:       newContainer,
+		imageRepository: imageRepository(containerdCluster),
+		nodeCreator:     &Manager{},
 	}, nil
 }
 
 // ListMachinesByCluster will retrieve a list of all machines that are part of the given cluster.
-func ListMachinesByCluster(ctx context.Context, cluster *clusterv1.Cluster, labels map[string]string) ([]*Machine, error) {
+func ListMachinesByCluster(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrav1.ContainerdCluster, labels map[string]string) ([]*Machine, error) {
 	if cluster == nil {
 		return nil, errors.New("cluster is required when listing machines in the cluster")
 	}
@@ -111,8 +126,7 @@ func ListMachinesByCluster(ctx context.Context, cluster *clusterv1.Cluster, labe
 		return nil, errors.New("cluster name is required when listing machines in the cluster")
 	}
 
-	filters := container.FilterBuilder{}
-	filters.AddKeyNameValue(filterLabel, clusterLabelKey, cluster.Name)
+	filters := clusterFilters(cluster.Namespace, cluster.Name, "")
 	for key, val := range labels {
 		filters.AddKeyNameValue(filterLabel, key, val)
 	}
@@ -122,20 +136,27 @@ func ListMachinesByCluster(ctx context.Context, cluster *clusterv1.Cluster, labe
 		return nil, err
 	}
 
-	ipFamily, err := cluster.GetIPFamily()
+	ipFamily, err := IPFamily(cluster, containerdCluster)
 	if err != nil {
 		return nil, fmt.Errorf("list docker machines by cluster: %s", err)
 	}
 
-	machines := make([]*Machine, len(containers))
-	for i, containerNode := range containers {
-		machines[i] = &Machine{
-			cluster:     cluster.Name,
-			machine:     machineFromContainerName(cluster.Name, containerNode.Name),
-			ipFamily:    ipFamily,
-			container:   containerNode,
-			nodeCreator: &Manager{},
+	machines := []*Machine{}
+	for _, containerNode := range containers {
+		// The load balancer is not a machine.
+		machine, ok := containerNode.Labels[machineNameLabelKey]
+		if !ok {
+			continue
 		}
+		machines = append(machines, &Machine{
+			namespace:       cluster.Namespace,
+			cluster:         cluster.Name,
+			machine:         machine,
+			ipFamily:        ipFamily,
+			container:       containerNode,
+			imageRepository: imageRepository(containerdCluster),
+			nodeCreator:     &Manager{},
+		})
 	}
 
 	return machines, nil
@@ -166,7 +187,7 @@ func (m *Machine) ContainerName() string {
 
 // ProviderID return the provider identifier for this machine.
 func (m *Machine) ProviderID() string {
-	return fmt.Sprintf("docker:////%s", m.ContainerName())
+	return infrav1.ProviderIDPrefix + m.ContainerName()
 }
 
 // Address will get the IP address of the machine. If IPv6 is enabled, it will return
@@ -183,6 +204,15 @@ func (m *Machine) Address(ctx context.Context) (string, error) {
 	return ipv4, nil
 }
 
+// Addresses returns the IPv4 and IPv6 addresses of the machine, either is empty if the machine
+// network is single-stack.
+func (m *Machine) Addresses(ctx context.Context) (ipv4 string, ipv6 string, err error) {
+	if m.container == nil {
+		return "", "", errors.New("container for the machine does not exist")
+	}
+	return m.container.IP(ctx)
+}
+
 // ContainerImage return the image of the container for this machine
 // or empty string if the container does not exist yet.
 func (m *Machine) ContainerImage() string {
@@ -192,19 +222,169 @@ func (m *Machine) ContainerImage() string {
 	return m.container.Image
 }
 
+// RestartCount returns the number of times the container hosting the machine was restarted after exiting.
+func (m *Machine) RestartCount(ctx context.Context) (int, error) {
+	if m.container == nil {
+		return 0, errors.New("unable to get restart count. the container hosting this machine does not exists")
+	}
+
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to connect to container runtime")
+	}
+
+	info, err := containerRuntime.InspectContainer(ctx, m.ContainerName())
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to inspect container %q", m.ContainerName())
+	}
+	return info.RestartCount, nil
+}
+
+// IsPaused returns true if the processes of the container hosting the machine are frozen.
+func (m *Machine) IsPaused(ctx context.Context) (bool, error) {
+	if m.container == nil {
+		return false, errors.New("unable to get paused state. the container hosting this machine does not exists")
+	}
+
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to connect to container runtime")
+	}
+
+	info, err := containerRuntime.InspectContainer(ctx, m.ContainerName())
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to inspect container %q", m.ContainerName())
+	}
+	return info.Paused, nil
+}
+
+// State returns the state of the task of the container hosting the machine, e.g. "running".
+func (m *Machine) State(ctx context.Context) (string, error) {
+	if m.container == nil {
+		return "", errors.New("unable to get state. the container hosting this machine does not exists")
+	}
+
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to connect to container runtime")
+	}
+
+	info, err := containerRuntime.InspectContainer(ctx, m.ContainerName())
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to inspect container %q", m.ContainerName())
+	}
+	return info.State, nil
+}
+
+// Health returns the health status of the container hosting the machine, nil if it has no health check.
+func (m *Machine) Health(ctx context.Context) (*capc.HealthStatus, error) {
+	if m.container == nil {
+		return nil, errors.New("unable to get health. the container hosting this machine does not exists")
+	}
+
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to container runtime")
+	}
+
+	info, err := containerRuntime.InspectContainer(ctx, m.ContainerName())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to inspect container %q", m.ContainerName())
+	}
+	return info.Health, nil
+}
+
+// Pause freezes the processes of the container hosting the machine, the node keeps its state
+// but stops responding, like a node outage.
+func (m *Machine) Pause(ctx context.Context) error {
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to container runtime")
+	}
+	return errors.Wrapf(containerRuntime.PauseContainer(ctx, m.ContainerName()), "failed to pause container %q", m.ContainerName())
+}
+
+// Resume thaws the processes of the container hosting the machine.
+func (m *Machine) Resume(ctx context.Context) error {
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to container runtime")
+	}
+	return errors.Wrapf(containerRuntime.ResumeContainer(ctx, m.ContainerName()), "failed to resume container %q", m.ContainerName())
+}
+
+// Stats returns the resource usage of the container hosting the machine.
+func (m *Machine) Stats(ctx context.Context) (*capc.ContainerStats, error) {
+	if m.container == nil {
+		return nil, errors.New("unable to get stats. the container hosting this machine does not exists")
+	}
+
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to container runtime")
+	}
+
+	stats, err := containerRuntime.ContainerStats(ctx, m.ContainerName())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get stats of container %q", m.ContainerName())
+	}
+	return stats, nil
+}
+
+// PullImage pulls the image of the container hosting the machine onto its host, unless it is
+// already there: the given image or else the kind node image of the Kubernetes version.
+func (m *Machine) PullImage(ctx context.Context, image string, version *string) error {
+	machineImage, err := m.image(image, version)
+	if err != nil {
+		return err
+	}
+
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to container runtime")
+	}
+	if err := containerRuntime.PullContainerImageIfNotExists(ctx, machineImage); err != nil {
+		return errors.Wrapf(err, "failed to pull image %q", machineImage)
+	}
+	return nil
+}
+
+// image returns the image of the container hosting the machine, the given image or else the kind
+// node image of the Kubernetes version, in the image repository of the cluster.
+func (m *Machine) image(image string, version *string) (string, error) {
+	machineImage := m.machineImage(version)
+	if image != "" {
+		machineImage = image
+	}
+	return imageInRepository(machineImage, m.imageRepository)
+}
+
 // Create creates a docker container hosting a Kubernetes node.
-func (m *Machine) Create(ctx context.Context, image string, role string, version *string, labels map[string]string, mounts []infrav1.Mount) error {
+func (m *Machine) Create(ctx context.Context, image string, role string, version *string, labels map[string]string, mounts []infrav1.Mount, portMappings []infrav1.PortMapping) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	// Create if not exists.
 	if m.container == nil {
-		var err error
+		machineImage, err := m.image(image, version)
+		if err != nil {
+			return err
+		}
 
-		machineImage := m.machineImage(version)
-		if image != "" {
-			machineImage = image
+		// The metadata labels the machine is looked up by take precedence over the given labels.
+		containerLabels := map[string]string{}
+		for key, val := range labels {
+			containerLabels[key] = val
+		}
+		for key, val := range metadataLabels(m.namespace, m.cluster, m.machine, role) {
+			containerLabels[key] = val
 		}
 
+		nodeMounts, err := kindMounts(ctx, mounts)
+		if err != nil {
+			return err
+		}
+		nodePortMappings := kindPortMappings(portMappings)
+
 		switch role {
 		case constants.ControlPlaneNodeRoleValue:
 			log.Info("Creating control plane machine container")
@@ -215,9 +395,9 @@ func (m *Machine) Create(ctx context.Context, image string, role string, version
 				m.cluster,
 				"127.0.0.1",
 				0,
-				kindMounts(mounts),
-				nil,
-				labels,
+				nodeMounts,
+				nodePortMappings,
+				containerLabels,
 				m.ipFamily,
 			)
 			if err != nil {
@@ -230,9 +410,9 @@ func (m *Machine) Create(ctx context.Context, image string, role string, version
 				m.ContainerName(),
 				machineImage,
 				m.cluster,
-				kindMounts(mounts),
-				nil,
-				labels,
+				nodeMounts,
+				nodePortMappings,
+				containerLabels,
 				m.ipFamily,
 			)
 			if err != nil {
@@ -257,62 +437,185 @@ func (m *Machine) Create(ctx context.Context, image string, role string, version
 	return nil
 }
 
-func kindMounts(mounts []infrav1.Mount) []v1alpha4.Mount {
+// kindMounts returns the kind mounts of the machine, creating the named volumes they mount. A tmpfs
+// mount is a kind mount without host path.
+func kindMounts(ctx context.Context, mounts []infrav1.Mount) ([]v1alpha4.Mount, error) {
 	if len(mounts) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	ret := make([]v1alpha4.Mount, 0, len(mounts))
 	for _, m := range mounts {
+		hostPath := m.HostPath
+		switch m.MountType() {
+		case infrav1.VolumeMountType:
+			volume, err := createVolume(ctx, m.Volume)
+			if err != nil {
+				return nil, err
+			}
+			hostPath = volume.Mountpoint
+		case infrav1.TmpfsMountType:
+			hostPath = ""
+		}
+		propagation := v1alpha4.MountPropagationNone
+		switch m.Propagation {
+		case infrav1.SharedMountPropagation:
+			propagation = v1alpha4.MountPropagationBidirectional
+		case infrav1.SlaveMountPropagation:
+			propagation = v1alpha4.MountPropagationHostToContainer
+		}
 		ret = append(ret, v1alpha4.Mount{
 			ContainerPath: m.ContainerPath,
-			HostPath:      m.HostPath,
+			HostPath:      hostPath,
 			Readonly:      m.Readonly,
-			Propagation:   v1alpha4.MountPropagationNone,
+			Propagation:   propagation,
+		})
+	}
+	return ret, nil
+}
+
+func kindPortMappings(portMappings []infrav1.PortMapping) []v1alpha4.PortMapping {
+	if len(portMappings) == 0 {
+		return nil
+	}
+
+	ret := make([]v1alpha4.PortMapping, 0, len(portMappings))
+	for _, pm := range portMappings {
+		ret = append(ret, v1alpha4.PortMapping{
+			ContainerPort: pm.ContainerPort,
+			HostPort:      pm.HostPort,
+			ListenAddress: pm.ListenAddress,
+			Protocol:      v1alpha4.PortMappingProtocol(pm.Protocol),
 		})
 	}
 	return ret
 }
 
+// createVolume returns the named volume of the cluster, created unless it exists.
+func createVolume(ctx context.Context, name string) (*capc.VolumeInfo, error) {
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to container runtime")
+	}
+	volume, err := containerRuntime.CreateVolume(ctx, name, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create volume %q", name)
+	}
+	return volume, nil
+}
+
 // PreloadLoadImages takes a list of container images and imports them into a machine.
+// The images are pulled on the host if needed and streamed into the containerd of the node container,
+// images the node already has are skipped. The image archives of the host in the list are imported
+// as they are, without a registry.
 func (m *Machine) PreloadLoadImages(ctx context.Context, images []string) error {
-	// Save the image into a tar
-	dir, err := os.MkdirTemp("", "image-tar")
-	if err != nil {
-		return errors.Wrap(err, "failed to create tempdir")
+	log := ctrl.LoggerFrom(ctx)
+
+	if m.container == nil {
+		return errors.New("unable to preload images. the container hosting this machine does not exists")
 	}
-	defer os.RemoveAll(dir)
 
-	containerRuntime, err := container.RuntimeFrom(ctx)
+	containerRuntime, err := capc.RuntimeFrom(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to connect to container runtime")
 	}
 
-	for i, image := range images {
-		imageTarPath := filepath.Clean(filepath.Join(dir, fmt.Sprintf("image-%d.tar", i)))
+	existing, err := m.nodeImages(ctx)
+	if err != nil {
+		return err
+	}
 
-		err = containerRuntime.SaveContainerImage(ctx, image, imageTarPath)
+	missing := []string{}
+	archives := []string{}
+	for _, image := range images {
+		if archive, ok := imageArchivePath(image); ok {
+			archives = append(archives, archive)
+			continue
+		}
+		image, err := imageInRepository(image, m.imageRepository)
 		if err != nil {
-			return errors.Wrap(err, "failed to save image")
+			return err
 		}
-
-		f, err := os.Open(imageTarPath)
+		ref, err := refdocker.ParseDockerRef(image)
 		if err != nil {
-			return errors.Wrap(err, "failed to open image")
+			return errors.Wrapf(err, "invalid image reference %q", image)
 		}
-		defer f.Close() //nolint:gocritic // No resource leak.
+		if existing.Has(ref.String()) {
+			continue
+		}
+		if err := containerRuntime.PullContainerImageIfNotExists(ctx, ref.String()); err != nil {
+			return errors.Wrapf(err, "failed to pull image %q", ref.String())
+		}
+		missing = append(missing, ref.String())
+	}
 
-		ps := m.container.Commander.Command("ctr", "--namespace=k8s.io", "images", "import", "-")
-		ps.SetStdin(f)
-		if err := ps.Run(ctx); err != nil {
-			return errors.Wrap(err, "failed to load image")
+	for _, archive := range archives {
+		if err := m.importImageArchive(ctx, archive); err != nil {
+			return err
 		}
 	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	log.Info("Preloading images into machine container", "images", missing)
+
+	// Stream the images into the node container instead of staging them on disk.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(containerRuntime.ExportContainerImages(ctx, missing, pw, false))
+	}()
+
+	err = m.importImages(ctx, pr)
+	// Unblock the export if the import stopped reading.
+	pr.CloseWithError(err)
+	return err
+}
+
+// importImageArchive imports the OCI or docker save archive at the path of the host into the
+// containerd of the node container, under the image names recorded in the archive.
+func (m *Machine) importImageArchive(ctx context.Context, archive string) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open image archive %q", archive)
+	}
+	defer f.Close()
+
+	log.Info("Importing image archive into machine container", "archive", archive)
+	return errors.Wrapf(m.importImages(ctx, f), "failed to import image archive %q", archive)
+}
+
+// importImages imports the image archive streamed by the reader into the containerd of the node
+// container.
+func (m *Machine) importImages(ctx context.Context, r io.Reader) error {
+	var stderr bytes.Buffer
+	ps := m.container.Commander.Command("ctr", "--namespace=k8s.io", "images", "import", "-")
+	ps.SetStdin(r)
+	ps.SetStderr(&stderr)
+	if err := ps.Run(ctx); err != nil {
+		return errors.Wrapf(err, "failed to load images: %s", stderr.String())
+	}
 	return nil
 }
 
-// ExecBootstrap runs bootstrap on a node, this is generally `kubeadm <init|join>`.
-func (m *Machine) ExecBootstrap(ctx context.Context, data string, format bootstrapv1.Format) error {
+// nodeImages returns the references of the images in the containerd of the node container.
+func (m *Machine) nodeImages(ctx context.Context) (sets.String, error) {
+	var stdout, stderr bytes.Buffer
+	ps := m.container.Commander.Command("ctr", "--namespace=k8s.io", "images", "list", "--quiet")
+	ps.SetStdout(&stdout)
+	ps.SetStderr(&stderr)
+	if err := ps.Run(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to list images in machine container: %s", stderr.String())
+	}
+	return sets.NewString(strings.Fields(stdout.String())...), nil
+}
+
+// ExecBootstrap runs bootstrap on a node, this is generally `kubeadm <init|join>`, after writing the
+// configuration of its kubelet.
+func (m *Machine) ExecBootstrap(ctx context.Context, data string, format bootstrapv1.Format, kubelet KubeletConfig) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	if m.container == nil {
@@ -340,9 +643,25 @@ func (m *Machine) ExecBootstrap(ctx context.Context, data string, format bootstr
 		return errors.Wrap(err, "failed to join a control plane node with kubeadm")
 	}
 
-	var outErr bytes.Buffer
-	var outStd bytes.Buffer
+	if err := kubelet.write(ctx, m); err != nil {
+		return err
+	}
+	if kubelet.ConfigPatch != "" {
+		commands = withKubeadmPatches(commands)
+	}
+
 	for _, command := range commands {
+		if command.File != nil {
+			if err := m.writeFile(ctx, command.File); err != nil {
+				logContainerDebugInfo(ctx, log, m.ContainerName())
+				return errors.Wrap(err, "failed to run cloud config")
+			}
+			log.V(4).Info("Wrote file", "path", command.File.Path)
+			continue
+		}
+
+		var outErr bytes.Buffer
+		var outStd bytes.Buffer
 		cmd := m.container.Commander.Command(command.Cmd, command.Args...)
 		cmd.SetStderr(&outErr)
 		cmd.SetStdout(&outStd)
@@ -353,10 +672,48 @@ func (m *Machine) ExecBootstrap(ctx context.Context, data string, format bootstr
 		if err != nil {
 			log.Info("Failed running command", "command", command, "stdout", outStd.String(), "stderr", outErr.String(), "bootstrap data", data)
 			logContainerDebugInfo(ctx, log, m.ContainerName())
-			return errors.Wrap(errors.WithStack(err), "failed to run cloud config")
+			return errors.Wrap(BootstrapCommandError{
+				Command: strings.Join(append([]string{command.Cmd}, command.Args...), " "),
+				Stdout:  outStd.String(),
+				Stderr:  outErr.String(),
+				Err:     err,
+			}, "failed to run cloud config")
+		}
+		log.V(4).Info("Ran command", "command", command.Cmd, "stdout", outStd.String(), "stderr", outErr.String())
+	}
+
+	return nil
+}
+
+// writeFile copies the file of the bootstrap data into the container of the machine, creating its
+// missing parent directories, and sets its owner.
+func (m *Machine) writeFile(ctx context.Context, file *provisioning.File) error {
+	containerRuntime, err := capc.RuntimeFrom(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to container runtime")
+	}
+
+	content := []byte(file.Content)
+	if file.Append {
+		// Only an existing file is read, a missing one is created.
+		if m.container.Commander.Command("test", "-e", file.Path).Run(ctx) == nil {
+			existing, err := capc.ReadFile(ctx, containerRuntime, m.ContainerName(), file.Path)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read %s", file.Path)
+			}
+			content = append(existing, content...)
 		}
 	}
+	if err := capc.WriteFile(ctx, containerRuntime, m.ContainerName(), file.Path, content, file.Mode); err != nil {
+		return errors.Wrapf(err, "failed to write %s", file.Path)
+	}
 
+	if file.Owner != "" {
+		cmd := m.container.Commander.Command("chown", file.Owner, file.Path)
+		if lines, err := cmd.RunLoggingOutputOnFail(ctx); err != nil {
+			return errors.Wrapf(err, "failed to set the owner of %s: %s", file.Path, strings.Join(lines, "\n"))
+		}
+	}
 	return nil
 }
 
@@ -380,46 +737,133 @@ func (m *Machine) CheckForBootstrapSuccess(ctx context.Context) error {
 	return nil
 }
 
-// SetNodeProviderID sets the docker provider ID for the kubernetes node.
-func (m *Machine) SetNodeProviderID(ctx context.Context) error {
+// SetNodeProviderID sets the provider ID of the kubernetes node of the machine, named after its
+// container, to the containerd provider ID of the machine, infrav1.ProviderIDPrefix followed by the
+// name of its container. The node is patched with the client of the workload cluster.
+func (m *Machine) SetNodeProviderID(ctx context.Context, c client.Client) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	node := &corev1.Node{}
+	if err := c.Get(ctx, client.ObjectKey{Name: m.ContainerName()}, node); err != nil {
+		return errors.Wrapf(err, "unable to set NodeProviderID. error getting node %s", m.ContainerName())
+	}
+	if node.Spec.ProviderID == m.ProviderID() {
+		return nil
+	}
+
+	log.Info("Setting Kubernetes node providerID")
+	patch := client.MergeFrom(node.DeepCopy())
+	node.Spec.ProviderID = m.ProviderID()
+	if err := c.Patch(ctx, node, patch); err != nil {
+		return errors.Wrap(err, "failed update providerID")
+	}
+	return nil
+}
+
+// SetNodeMetadata sets the labels and annotations, and adds the taints, of the kubernetes node.
+// The taints replace the ones of the node with the same key and effect.
+func (m *Machine) SetNodeMetadata(ctx context.Context, labels, annotations map[string]string, taints []corev1.Taint) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	kubectlNode, err := m.getKubectlNode(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "unable to set NodeProviderID. error getting a kubectl node")
+		return errors.Wrapf(err, "unable to set node metadata. error getting a kubectl node")
 	}
 	if kubectlNode == nil {
-		return errors.New("unable to set NodeProviderID. there are no kubectl node available")
+		return errors.New("unable to set node metadata. there are no kubectl node available")
 	}
 	if !kubectlNode.IsRunning() {
-		return errors.Wrapf(ContainerNotRunningError{Name: kubectlNode.Name}, "unable to set NodeProviderID")
+		return errors.Wrapf(ContainerNotRunningError{Name: kubectlNode.Name}, "unable to set node metadata")
 	}
 
-	log.Info("Setting Kubernetes node providerID")
-	patch := fmt.Sprintf(`{"spec": {"providerID": %q}}`, m.ProviderID())
-	cmd := kubectlNode.Commander.Command(
-		"kubectl",
+	var commands [][]string
+	if len(labels) > 0 {
+		commands = append(commands, append([]string{"label", "node", m.ContainerName(), "--overwrite"}, keyValues(labels)...))
+	}
+	if len(annotations) > 0 {
+		commands = append(commands, append([]string{"annotate", "node", m.ContainerName(), "--overwrite"}, keyValues(annotations)...))
+	}
+	if len(taints) > 0 {
+		args := []string{"taint", "node", m.ContainerName(), "--overwrite"}
+		for _, taint := range taints {
+			args = append(args, taint.ToString())
+		}
+		commands = append(commands, args)
+	}
+
+	log.Info("Setting Kubernetes node metadata")
+	for _, args := range commands {
+		cmd := kubectlNode.Commander.Command("kubectl", append([]string{"--kubeconfig", "/etc/kubernetes/admin.conf"}, args...)...)
+		lines, err := cmd.RunLoggingOutputOnFail(ctx)
+		if err != nil {
+			for _, line := range lines {
+				log.Info(line)
+			}
+			return errors.Wrapf(err, "failed to %s node", args[0])
+		}
+	}
+	return nil
+}
+
+// DrainNode cordons the kubernetes node and evicts its pods, with the termination grace period of the
+// pods unless gracePeriodSeconds is set. It returns an error while pods are left after the timeout of
+// a kubectl drain, and does nothing if the node is not registered.
+func (m *Machine) DrainNode(ctx context.Context, gracePeriodSeconds *int32) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	kubectlNode, err := m.getKubectlNode(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "unable to drain node. error getting a kubectl node")
+	}
+	if kubectlNode == nil {
+		return errors.New("unable to drain node. there are no kubectl node available")
+	}
+	if !kubectlNode.IsRunning() {
+		return errors.Wrapf(ContainerNotRunningError{Name: kubectlNode.Name}, "unable to drain node")
+	}
+
+	node, err := runOutput(ctx, kubectlNode, "kubectl", "--kubeconfig", "/etc/kubernetes/admin.conf",
+		"get", "node", m.ContainerName(), "--ignore-not-found", "--output", "name")
+	if err != nil {
+		return errors.Wrap(err, "failed to get node")
+	}
+	if strings.TrimSpace(node) == "" {
+		return nil
+	}
+
+	log.Info("Draining Kubernetes node")
+	args := []string{
 		"--kubeconfig", "/etc/kubernetes/admin.conf",
-		"patch",
-		"node", m.ContainerName(),
-		"--patch", patch,
-	)
-	lines, err := cmd.RunLoggingOutputOnFail(ctx)
+		"drain", m.ContainerName(),
+		"--ignore-daemonsets", "--delete-emptydir-data", "--force",
+		"--timeout", kubectlDrainTimeout.String(),
+	}
+	if gracePeriodSeconds != nil {
+		args = append(args, "--grace-period", strconv.Itoa(int(*gracePeriodSeconds)))
+	}
+	lines, err := kubectlNode.Commander.Command("kubectl", args...).RunLoggingOutputOnFail(ctx)
 	if err != nil {
 		for _, line := range lines {
 			log.Info(line)
 		}
-		return errors.Wrap(err, "failed update providerID")
+		return errors.Wrap(err, "failed to drain node")
 	}
-
 	return nil
 }
 
+// keyValues returns the key=value arguments of kubectl for the map, sorted by key.
+func keyValues(m map[string]string) []string {
+	args := make([]string, 0, len(m))
+	for key, value := range m {
+		args = append(args, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(args)
+	return args
+}
+
 func (m *Machine) getKubectlNode(ctx context.Context) (*types.Node, error) {
 	// collect info about the existing controlplane nodes
-	filters := container.FilterBuilder{}
-	filters.AddKeyNameValue(filterLabel, clusterLabelKey, m.cluster)
-	filters.AddKeyNameValue(filterLabel, nodeRoleLabelKey, constants.ControlPlaneNodeRoleValue)
+	filters := clusterFilters(m.namespace, m.cluster, controlPlaneRole)
 
 	kubectlNodes, err := listContainers(ctx, filters)
 	if err != nil {
@@ -440,6 +884,59 @@ func (m *Machine) getKubectlNode(ctx context.Context) (*types.Node, error) {
 	return kubectlNodes[0], nil
 }
 
+// ResetKubeadm runs kubeadm reset in the running container hosting the machine before it is deleted,
+// so that kubeadm cleans up after the node, then deletes the Node of the machine from another running
+// control plane node, as kubeadm reset leaves it in the workload cluster. The bootstrap token the
+// machine joined with is left to the bootstrap provider owning it, it may be shared with other
+// machines, e.g. the instances of a machine pool.
+// It is best effort: the errors are logged, and kubeadm is given up on after kubeadmResetTimeout.
+func (m *Machine) ResetKubeadm(ctx context.Context) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if m.container == nil {
+		return
+	}
+
+	resetCtx, cancel := context.WithTimeout(ctx, kubeadmResetTimeout)
+	defer cancel()
+
+	if m.container.IsRunning() {
+		if paused, err := m.IsPaused(ctx); err == nil && !paused {
+			log.Info("Resetting kubeadm on the machine")
+			cmd := m.container.Commander.Command("kubeadm", "reset", "--force")
+			lines, err := cmd.RunLoggingOutputOnFail(resetCtx)
+			if err != nil {
+				for _, line := range lines {
+					log.Info(line)
+				}
+				log.Error(err, "failed to reset kubeadm on the machine, deleting it anyway")
+			}
+		}
+	}
+
+	m.deleteNode(resetCtx)
+}
+
+// deleteNode deletes the Node of the machine from another running control plane node of the cluster,
+// if any.
+func (m *Machine) deleteNode(ctx context.Context) {
+	log := ctrl.LoggerFrom(ctx)
+
+	node, err := m.otherControlPlaneNode(ctx)
+	if err != nil {
+		log.Error(err, "failed to find another control plane node to delete the Node of the machine from")
+		return
+	}
+	if node == nil {
+		return
+	}
+
+	log.Info("Deleting the Node of the machine")
+	if _, err := runOutput(ctx, node, "kubectl", "--kubeconfig", "/etc/kubernetes/admin.conf", "delete", "node", m.ContainerName(), "--ignore-not-found"); err != nil {
+		log.Error(err, "failed to delete the Node of the machine")
+	}
+}
+
 // Delete deletes a docker container hosting a Kubernetes node.
 func (m *Machine) Delete(ctx context.Context) error {
 	log := ctrl.LoggerFrom(ctx)
@@ -457,21 +954,9 @@ func (m *Machine) Delete(ctx context.Context) error {
 // machineImage is the image of the container node with the machine.
 func (m *Machine) machineImage(version *string) string {
 	if version == nil {
-		defaultImage := fmt.Sprintf("%s:%s", defaultImageName, defaultImageTag)
-		return defaultImage
+		return fmt.Sprintf("%s:%s", infrav1.DefaultImageName, defaultImageTag)
 	}
-
-	// TODO(fp) make this smarter
-	// - allows usage of custom docker repository & image names
-	// - add v only for semantic versions
-	versionString := *version
-	if !strings.HasPrefix(versionString, "v") {
-		versionString = fmt.Sprintf("v%s", versionString)
-	}
-
-	versionString = clusterapicontainer.SemverToOCIImageTag(versionString)
-
-	return fmt.Sprintf("%s:%s", defaultImageName, versionString)
+	return infrav1.MachineImage(*version)
 }
 
 func logContainerDebugInfo(ctx context.Context, log logr.Logger, name string) {
@@ -0,0 +1,148 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd/types"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/provisioning"
+)
+
+func TestSetNodeProviderID(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	workloadClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-md-0-abc12"}},
+	).Build()
+	ctx := context.Background()
+
+	// The node of the machine is looked up by the name of its container.
+	m := &Machine{cluster: "test", machine: "md-0-abc12"}
+	g.Expect(m.SetNodeProviderID(ctx, workloadClient)).To(Succeed())
+	node := &corev1.Node{}
+	g.Expect(workloadClient.Get(ctx, client.ObjectKey{Name: "test-md-0-abc12"}, node)).To(Succeed())
+	g.Expect(node.Spec.ProviderID).To(Equal("containerd:////test-md-0-abc12"))
+
+	// Setting it again is a no-op.
+	g.Expect(m.SetNodeProviderID(ctx, workloadClient)).To(Succeed())
+
+	// The node of a machine that did not register yet is waited for.
+	m = &Machine{cluster: "test", machine: "md-0-def34"}
+	g.Expect(m.SetNodeProviderID(ctx, workloadClient)).To(MatchError(ContainSubstring("error getting node test-md-0-def34")))
+}
+
+// filesRuntime is a containerd runtime whose containers only hold the files copied into them, the
+// commands executed in them are recorded and only "test -e" is run.
+type filesRuntime struct {
+	capc.Runtime
+	files map[string]string
+	modes map[string]os.FileMode
+	execs []string
+}
+
+func (r *filesRuntime) CopyTo(ctx context.Context, containerName, destDir string, content io.Reader) error {
+	tr := tar.NewReader(content)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		name := path.Join(destDir, header.Name)
+		r.files[name] = string(data)
+		r.modes[name] = os.FileMode(header.Mode)
+	}
+}
+
+func (r *filesRuntime) CopyFrom(ctx context.Context, containerName, srcPath string, w io.Writer) error {
+	data, ok := r.files[srcPath]
+	if !ok {
+		return errors.Errorf("%s not found", srcPath)
+	}
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: path.Base(srcPath), Mode: int64(r.modes[srcPath]), Size: int64(len(data))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write([]byte(data)); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (r *filesRuntime) ExecContainer(ctx context.Context, containerName string, config *container.ExecContainerInput, command string, args ...string) error {
+	r.execs = append(r.execs, strings.Join(append([]string{command}, args...), " "))
+	if command == "test" {
+		if _, ok := r.files[args[1]]; !ok {
+			return errors.New("exit status 1")
+		}
+	}
+	return nil
+}
+
+func TestWriteFile(t *testing.T) {
+	g := NewWithT(t)
+
+	containerRuntime := &filesRuntime{
+		files: map[string]string{"/etc/hosts": "127.0.0.1 localhost\n"},
+		modes: map[string]os.FileMode{"/etc/hosts": 0644},
+	}
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+	m := &Machine{cluster: "test", machine: "md-0-abc12", container: types.NewNode("test-md-0-abc12", "", workerRole)}
+
+	// The files are copied into the container, with their permissions, rather than written by shell
+	// commands.
+	g.Expect(m.writeFile(ctx, &provisioning.File{Path: "/etc/kubernetes/pki/ca.key", Content: "key", Mode: 0600})).To(Succeed())
+	g.Expect(containerRuntime.files).To(HaveKeyWithValue("/etc/kubernetes/pki/ca.key", "key"))
+	g.Expect(containerRuntime.modes).To(HaveKeyWithValue("/etc/kubernetes/pki/ca.key", os.FileMode(0600)))
+	g.Expect(containerRuntime.execs).To(BeEmpty())
+
+	// The content of the files appended to is added to the existing one, a missing file is created.
+	g.Expect(m.writeFile(ctx, &provisioning.File{Path: "/etc/hosts", Content: "172.18.0.2 test\n", Mode: 0644, Append: true})).To(Succeed())
+	g.Expect(containerRuntime.files).To(HaveKeyWithValue("/etc/hosts", "127.0.0.1 localhost\n172.18.0.2 test\n"))
+	g.Expect(m.writeFile(ctx, &provisioning.File{Path: "/etc/motd", Content: "test\n", Mode: 0644, Append: true})).To(Succeed())
+	g.Expect(containerRuntime.files).To(HaveKeyWithValue("/etc/motd", "test\n"))
+
+	// A different owner is set once the file is written.
+	containerRuntime.execs = nil
+	g.Expect(m.writeFile(ctx, &provisioning.File{Path: "/home/capc/.ssh/authorized_keys", Content: "ssh-ed25519 AAAA", Mode: 0600, Owner: "capc:capc"})).To(Succeed())
+	g.Expect(containerRuntime.execs).To(Equal([]string{"chown capc:capc /home/capc/.ssh/authorized_keys"}))
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	infrav1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+)
+
+// bridgeHashLength is the length of the hash of the network name in the default bridge names,
+// which fit the 15 characters of a Linux interface name.
+const bridgeHashLength = 10
+
+// dualStackNetwork is the network shared by the IPv6 and dual-stack clusters without a network of
+// their own. Their machines get an IPv4 and an IPv6 address, like the nodes of kind, so that they
+// can still reach IPv4 registries.
+var dualStackNetwork = capc.Network{
+	Name:    "kind-dualstack",
+	Bridge:  "capc1",
+	Subnets: []string{"10.86.0.0/16", "fd00:10:86::/64"},
+}
+
+// IPFamily returns the IP family of the cluster: the one set on the ContainerdCluster, else the
+// family of the pod and service CIDRs of the Cluster.
+func IPFamily(cluster *clusterv1.Cluster, containerdCluster *infrav1.ContainerdCluster) (clusterv1.ClusterIPFamily, error) {
+	if containerdCluster != nil {
+		switch containerdCluster.Spec.IPFamily {
+		case infrav1.IPv4IPFamily:
+			return clusterv1.IPv4IPFamily, nil
+		case infrav1.IPv6IPFamily:
+			return clusterv1.IPv6IPFamily, nil
+		case infrav1.DualStackIPFamily:
+			return clusterv1.DualStackIPFamily, nil
+		}
+	}
+	return cluster.GetIPFamily()
+}
+
+// ClusterNetwork returns the network the machines of the ContainerdCluster with the given IP family
+// are attached to, false if they are attached to the IPv4 network shared by the clusters. The
+// network dedicated to the cluster is named after it and its bridge after the network by default.
+func ClusterNetwork(containerdCluster *infrav1.ContainerdCluster, ipFamily clusterv1.ClusterIPFamily) (capc.Network, bool) {
+	spec := containerdCluster.Spec.Network
+	if spec == nil {
+		if ipFamily == clusterv1.IPv6IPFamily || ipFamily == clusterv1.DualStackIPFamily {
+			return dualStackNetwork, true
+		}
+		return capc.Network{}, false
+	}
+
+	name, _ := OwnedNetwork(containerdCluster)
+	network := capc.Network{
+		Name:   name,
+		Bridge: spec.Bridge,
+		MTU:    int(spec.MTU),
+	}
+	for _, subnet := range strings.Split(spec.NodeSubnet, ",") {
+		network.Subnets = append(network.Subnets, strings.TrimSpace(subnet))
+	}
+	if network.Bridge == "" {
+		sum := sha256.Sum256([]byte(network.Name))
+		network.Bridge = "capc-" + hex.EncodeToString(sum[:])[:bridgeHashLength]
+	}
+	return network, true
+}
+
+// OwnedNetwork returns the name of the network dedicated to the ContainerdCluster, which is deleted
+// with it, false if it has none.
+func OwnedNetwork(containerdCluster *infrav1.ContainerdCluster) (string, bool) {
+	spec := containerdCluster.Spec.Network
+	if spec == nil {
+		return "", false
+	}
+	if spec.Name != "" {
+		return spec.Name, true
+	}
+	return fmt.Sprintf("capc-%s-%s", containerdCluster.Namespace, containerdCluster.Name), true
+}
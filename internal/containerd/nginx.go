@@ -0,0 +1,62 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerd
+
+// nginxConfigPath is the path of the configuration of the nginx load balancer in its image.
+const nginxConfigPath = "/etc/nginx/nginx.conf"
+
+// nginxConfigTemplate is the configuration of the nginx load balancer, proxying the TCP connections
+// of the control plane port and of the frontends to their backend servers. An upstream without
+// servers is invalid, so it gets one marked down until the machines are there.
+const nginxConfigTemplate = `# generated by cluster-api-provider-containerd
+worker_processes auto;
+events {
+  worker_connections 1024;
+}
+stream {
+  upstream kube-apiservers {
+    {{- range $server, $address := .BackendServers }}
+    server {{ $address }};
+    {{- else }}
+    server 127.0.0.1:1 down;
+    {{- end }}
+  }
+  server {
+    listen {{ .ControlPlanePort }};
+    {{- if .IPv6 }}
+    listen [::]:{{ .ControlPlanePort }};
+    {{- end }}
+    proxy_pass kube-apiservers;
+  }
+  {{- range .Frontends }}
+  upstream {{ .Name }} {
+    {{- range $server, $address := .BackendServers }}
+    server {{ $address }};
+    {{- else }}
+    server 127.0.0.1:1 down;
+    {{- end }}
+  }
+  server {
+    listen {{ .Port }};
+    {{- if $.IPv6 }}
+    listen [::]:{{ .Port }};
+    {{- end }}
+    proxy_pass {{ .Name }};
+  }
+  {{- end }}
+}
+`
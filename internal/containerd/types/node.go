@@ -21,6 +21,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"path/filepath"
 	"strings"
@@ -37,6 +38,7 @@ type Node struct {
 	ClusterRole string
 	InternalIP  string
 	Image       string
+	Labels      map[string]string
 	status      string
 	Commander   *ContainerCmder
 }
@@ -57,6 +59,12 @@ func (n *Node) WithStatus(status string) *Node {
 	return n
 }
 
+// WithLabels sets the labels of the container and returns the node.
+func (n *Node) WithLabels(labels map[string]string) *Node {
+	n.Labels = labels
+	return n
+}
+
 // String returns the name of the node.
 func (n Node) String() string {
 	return n.Name
@@ -84,6 +92,21 @@ func (n *Node) IP(ctx context.Context) (ipv4 string, ipv6 string, err error) {
 	return ipv4, ipv6, nil
 }
 
+// HostPort gets the host port mapped to the given TCP port of the node.
+func (n *Node) HostPort(ctx context.Context, containerPort int32) (string, error) {
+	containerRuntime, err := container.RuntimeFrom(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to connect to container runtime")
+	}
+
+	hostPort, err := containerRuntime.GetHostPort(ctx, n.Name, fmt.Sprintf("%d/tcp", containerPort))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get node host port from runtime")
+	}
+
+	return hostPort, nil
+}
+
 // IsRunning returns if the container is running.
 func (n *Node) IsRunning() bool {
 	return strings.HasPrefix(n.status, "Up")
@@ -18,6 +18,7 @@ package types
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -41,6 +42,41 @@ func TestIP(t *testing.T) {
 	g.Expect(ipv6).To(Equal("TestNodeIPv6"))
 }
 
+// portsRuntime is a fake runtime publishing the container ports of its port mappings, keyed by
+// container name and port and protocol, e.g. "TestNode 6443/tcp".
+type portsRuntime struct {
+	container.FakeRuntime
+	hostPorts map[string]string
+}
+
+func (r *portsRuntime) GetHostPort(ctx context.Context, containerName, portAndProtocol string) (string, error) {
+	hostPort, ok := r.hostPorts[containerName+" "+portAndProtocol]
+	if !ok {
+		return "", fmt.Errorf("no host port published for %s of container %s", portAndProtocol, containerName)
+	}
+	return hostPort, nil
+}
+
+func TestHostPort(t *testing.T) {
+	g := NewWithT(t)
+	containerRuntime := &portsRuntime{hostPorts: map[string]string{"TestNode 6443/tcp": "32768"}}
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+
+	node := &Node{
+		Name: "TestNode",
+	}
+
+	hostPort, err := node.HostPort(ctx, 6443)
+
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(hostPort).To(Equal("32768"))
+
+	// A container port without a port mapping has no host port.
+	_, err = node.HostPort(ctx, 80)
+
+	g.Expect(err).To(MatchError(ContainSubstring("no host port published for 80/tcp of container TestNode")))
+}
+
 func TestDeleteContainer(t *testing.T) {
 	g := NewWithT(t)
 	containerRuntime := &container.FakeRuntime{}
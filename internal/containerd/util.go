@@ -23,6 +23,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
 	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd/types"
 	"sigs.k8s.io/cluster-api/test/infrastructure/container"
 )
@@ -44,6 +45,11 @@ func FailureDomainLabel(failureDomain *string) map[string]string {
 	return nil
 }
 
+// MachineContainerName returns the name of the container hosting the given machine of the cluster.
+func MachineContainerName(cluster, machine string) string {
+	return machineContainerName(cluster, machine)
+}
+
 func machineContainerName(cluster, machine string) string {
 	if strings.HasPrefix(machine, cluster) {
 		return machine
@@ -51,11 +57,6 @@ func machineContainerName(cluster, machine string) string {
 	return fmt.Sprintf("%s-%s", cluster, machine)
 }
 
-func machineFromContainerName(cluster, containerName string) string {
-	machine := strings.TrimPrefix(containerName, cluster)
-	return strings.TrimPrefix(machine, "-")
-}
-
 // listContainers returns the list of docker containers matching filters.
 func listContainers(ctx context.Context, filters container.FilterBuilder) ([]*types.Node, error) {
 	n, err := List(ctx, filters)
@@ -99,8 +100,8 @@ func list(ctx context.Context, visit func(context.Context, string, *types.Node),
 		return errors.Wrap(err, "failed to connect to container runtime")
 	}
 
-	// We also need our cluster label key to the list of filter
-	filters.AddKeyValue("label", clusterLabelKey)
+	// Only list the containers of the clusters
+	filters.AddKeyValue(filterLabel, clusterNameLabelKey)
 
 	containers, err := containerRuntime.ListContainers(ctx, filters)
 	if err != nil {
@@ -108,12 +109,18 @@ func list(ctx context.Context, visit func(context.Context, string, *types.Node),
 	}
 
 	for _, cntr := range containers {
-		name := cntr.Name
-		cluster := clusterLabelKey
-		image := cntr.Image
-		status := cntr.Status
-
-		visit(ctx, cluster, types.NewNode(name, image, "undetermined").WithStatus(status))
+		node := types.NewNode(cntr.Name, cntr.Image, "undetermined").WithStatus(cntr.Status)
+		// The role and machine of the node are read from the metadata labels of its container.
+		if runtime, ok := containerRuntime.(capc.Runtime); ok {
+			info, err := runtime.InspectContainer(ctx, cntr.Name)
+			if err != nil {
+				return errors.Wrapf(err, "failed to inspect container %q", cntr.Name)
+			}
+			node.ClusterRole = kindRole(info.Labels[roleLabelKey])
+			node.WithLabels(info.Labels)
+		}
+
+		visit(ctx, node.Labels[clusterNameLabelKey], node)
 	}
 
 	return nil
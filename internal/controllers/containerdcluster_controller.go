@@ -19,48 +19,462 @@ package controllers
 
 import (
 	"context"
+	"net"
+	"sort"
+	"strconv"
+	"time"
 
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	infrastructurev1alpha3 "github.com/raminenia/cluster-api-provider-containerd/api/v1alpha3"
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd"
 )
 
+// loadBalancerRetryInterval is the interval the status of a load balancer container that is not
+// running is checked again at.
+const loadBalancerRetryInterval = 10 * time.Second
+
 // ContainerdClusterReconciler reconciles a ContainerdCluster object
 type ContainerdClusterReconciler struct {
 	client.Client
 	ContainerRuntime container.Runtime
-	Scheme           *runtime.Scheme
+	// Hosts is the pool of containerd hosts the machines are scheduled onto, if set, each host has
+	// a namespace of the cluster to delete.
+	Hosts  *capc.HostPool
+	Scheme *runtime.Scheme
+	// ReconcileTimeout bounds the operations of a reconciliation, if set. The patch of the reconciled
+	// object is not bounded, so that the progress of a reconciliation that timed out is recorded.
+	ReconcileTimeout time.Duration
+
+	recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdclusters,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdclusters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdclusters/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdmachines,verbs=get;list;watch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdmachines/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile handles ContainerdCluster events: the load balancer of the cluster is created, unless it
+// is externally managed, and the failure domains of the cluster are published in its status, and
+// the load balancer and the containerd namespaces the containers of the cluster live in are deleted
+// with it.
+func (r *ContainerdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, rerr error) {
+	ctx, span := startReconcileSpan(ctx, "ContainerdCluster", req)
+	defer func() { endReconcileSpan(span, rerr) }()
+	log := ctrl.LoggerFrom(ctx)
+
+	// Fetch the ContainerdCluster instance.
+	containerdCluster := &infrastructurev1beta1.ContainerdCluster{}
+	if err := r.Client.Get(ctx, req.NamespacedName, containerdCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// The rest of the reconciliation is bounded by the timeout, except the patch of the
+	// ContainerdCluster, so that the progress of a reconciliation that timed out is recorded.
+	patchCtx := ctx
+	ctx, cancel := withTimeout(ctx, r.ReconcileTimeout)
+	defer cancel()
+
+	// Fetch the Cluster.
+	cluster, err := util.GetOwnerCluster(ctx, r.Client, containerdCluster.ObjectMeta)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if cluster == nil {
+		log.Info("Waiting for Cluster Controller to set OwnerRef on ContainerdCluster")
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("cluster", cluster.Name)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	// Return early if the object or Cluster is paused.
+	if annotations.IsPaused(cluster, containerdCluster) {
+		log.Info("Reconciliation is paused for this object")
+		return ctrl.Result{}, nil
+	}
+
+	// An externally managed ContainerdCluster is provisioned by another controller, which also writes
+	// its status, e.g. its ready status and its failure domains.
+	if annotations.IsExternallyManaged(containerdCluster) {
+		log.Info("ContainerdCluster is externally managed, skipping reconciliation")
+		return ctrl.Result{}, nil
+	}
+
+	// Initialize the patch helper
+	patchHelper, err := patch.NewHelper(containerdCluster, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Always attempt to Patch the ContainerdCluster object after each reconciliation.
+	defer func() {
+		if err := patchContainerdCluster(patchCtx, patchHelper, containerdCluster); err != nil {
+			log.Error(err, "failed to patch ContainerdCluster")
+			if rerr == nil {
+				rerr = err
+			}
+		}
+	}()
+
+	// The load balancer of the cluster runs on the runtime of the provider.
+	ctx = container.RuntimeInto(ctx, r.ContainerRuntime)
+	ctx = capc.ClusterInto(ctx, containerdCluster.Namespace, containerdCluster.Name)
+
+	// Handle deleted clusters
+	if !containerdCluster.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, cluster, containerdCluster)
+	}
+
+	// Add finalizer first if not exist to avoid the race condition between init and delete
+	if !controllerutil.ContainsFinalizer(containerdCluster, infrastructurev1beta1.ClusterFinalizer) {
+		controllerutil.AddFinalizer(containerdCluster, infrastructurev1beta1.ClusterFinalizer)
+		return ctrl.Result{}, nil
+	}
+
+	// Handle non-deleted clusters
+	return r.reconcileNormal(ctx, cluster, containerdCluster)
+}
+
+// patchContainerdCluster patches the ContainerdCluster, with a Ready condition summarizing the
+// availability of its load balancer.
+func patchContainerdCluster(ctx context.Context, patchHelper *patch.Helper, containerdCluster *infrastructurev1beta1.ContainerdCluster) error {
+	// Always update the readyCondition by summarizing the state of other conditions.
+	// A step counter is added to represent progress during the provisioning process (instead we are
+	// hiding it during the deletion process).
+	conditions.SetSummary(containerdCluster,
+		conditions.WithConditions(infrastructurev1beta1.LoadBalancerAvailableCondition),
+		conditions.WithStepCounterIf(containerdCluster.ObjectMeta.DeletionTimestamp.IsZero()),
+	)
+
+	// Patch the object, ignoring conflicts on the conditions owned by this controller.
+	return patchHelper.Patch(
+		ctx,
+		containerdCluster,
+		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrastructurev1beta1.LoadBalancerAvailableCondition,
+		}},
+	)
+}
+
+// reconcileNormal creates the load balancer of the cluster, whose endpoint is the control plane
+// endpoint of the cluster, and publishes the failure domains of the cluster.
+func (r *ContainerdClusterReconciler) reconcileNormal(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster) (ctrl.Result, error) {
+	// Let Cluster API spread the machines over the failure domains.
+	containerdCluster.Status.FailureDomains = r.failureDomains(containerdCluster)
+
+	if containerdCluster.Spec.LoadBalancer.IsExternallyManaged() {
+		return r.reconcileExternalLoadBalancer(ctx, cluster, containerdCluster)
+	}
+
+	ctx, err := clusterRuntimeContext(ctx, r.Client, cluster, containerdCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Create a helper for managing a containerd container hosting the loadbalancer.
+	externalLoadBalancer, err := containerd.NewLoadBalancer(ctx, cluster, containerdCluster)
+	if err != nil {
+		conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+		return ctrl.Result{}, errors.Wrap(err, "failed to create helper for managing the externalLoadBalancer")
+	}
+
+	// A port of the host of the load balancer is the control plane endpoint of a single cluster.
+	hostAddress := containerdCluster.Spec.LoadBalancer.HostAddress
+	if hostAddress != "" && !containerdCluster.Spec.ControlPlaneEndpoint.IsZero() {
+		if err := r.checkEndpointConflict(ctx, containerdCluster, containerdCluster.Spec.ControlPlaneEndpoint); err != nil {
+			conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Create the container hosting the load balancer.
+	if err := externalLoadBalancer.Create(ctx); err != nil {
+		countContainerdError(cluster, operationCreate)
+		conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+		r.recorder.Eventf(containerdCluster, corev1.EventTypeWarning, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, "Failed to create the load balancer: %v", err)
+		return ctrl.Result{}, errors.Wrap(err, "failed to create load balancer")
+	}
+
+	// The cluster is ready once the load balancer serves the control plane endpoint.
+	running, err := externalLoadBalancer.IsRunning(ctx)
+	if err != nil {
+		conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+		return ctrl.Result{}, errors.Wrap(err, "failed to get the status of the load balancer")
+	}
+	if !running {
+		conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerNotRunningReason, clusterv1.ConditionSeverityWarning, "The load balancer container is not running")
+		return ctrl.Result{RequeueAfter: loadBalancerRetryInterval}, nil
+	}
+
+	// Set APIEndpoints with the load balancer endpoint so the Cluster API Cluster Controller can pull it
+	endpoint, err := externalLoadBalancer.Endpoint(ctx)
+	if err != nil {
+		conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+		return ctrl.Result{}, errors.Wrap(err, "failed to get the endpoint of the load balancer")
+	}
+	if containerdCluster.Spec.ControlPlaneEndpoint.IsZero() {
+		if hostAddress != "" {
+			if err := r.checkEndpointConflict(ctx, containerdCluster, endpoint); err != nil {
+				// The free port of the host may be the endpoint of a cluster whose load balancer is
+				// stopped, create the load balancer again on another one.
+				if deleteErr := externalLoadBalancer.Delete(ctx); deleteErr != nil {
+					err = errors.Wrapf(deleteErr, "failed to delete the load balancer: %s", err)
+				}
+				conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+				return ctrl.Result{}, err
+			}
+		}
+		containerdCluster.Spec.ControlPlaneEndpoint = endpoint
+	}
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the ContainerdCluster object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.2/pkg/reconcile
-func (r *ContainerdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	// Follow the control plane machines created or deleted since the last reconcile, or restarted with
+	// another address. kube-vip follows the API servers by itself.
+	if containerdCluster.Spec.LoadBalancer.Type != infrastructurev1beta1.KubeVIPLoadBalancerType {
+		if err := r.reconcileLoadBalancerBackends(ctx, cluster, containerdCluster, externalLoadBalancer); err != nil {
+			conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+			return ctrl.Result{}, err
+		}
+	}
 
-	// TODO(user): your logic here
+	// Mark the containerdCluster ready
+	containerdCluster.Status.Ready = true
+	conditions.MarkTrue(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition)
+	return ctrl.Result{}, nil
+}
+
+// checkEndpointConflict returns an error if the given control plane endpoint is the one of another
+// ContainerdCluster.
+func (r *ContainerdClusterReconciler) checkEndpointConflict(ctx context.Context, containerdCluster *infrastructurev1beta1.ContainerdCluster, endpoint infrastructurev1beta1.APIEndpoint) error {
+	containerdClusters := &infrastructurev1beta1.ContainerdClusterList{}
+	if err := r.Client.List(ctx, containerdClusters); err != nil {
+		return errors.Wrap(err, "failed to list ContainerdClusters")
+	}
+	for i := range containerdClusters.Items {
+		other := &containerdClusters.Items[i]
+		if other.Namespace == containerdCluster.Namespace && other.Name == containerdCluster.Name {
+			continue
+		}
+		if other.Spec.ControlPlaneEndpoint == endpoint {
+			return errors.Errorf("the control plane endpoint %s is the one of the ContainerdCluster %s",
+				net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port)), client.ObjectKeyFromObject(other))
+		}
+	}
+	return nil
+}
+
+// failureDomains returns the failure domains of the cluster, the ones of its spec or else the ones
+// of the hosts of the pool, which can all run control plane machines.
+func (r *ContainerdClusterReconciler) failureDomains(containerdCluster *infrastructurev1beta1.ContainerdCluster) clusterv1.FailureDomains {
+	if len(containerdCluster.Spec.FailureDomains) > 0 || r.Hosts == nil {
+		return containerdCluster.Spec.FailureDomains
+	}
+	var failureDomains clusterv1.FailureDomains
+	for _, host := range r.Hosts.Hosts() {
+		if host.FailureDomain == "" {
+			continue
+		}
+		if failureDomains == nil {
+			failureDomains = clusterv1.FailureDomains{}
+		}
+		failureDomains[host.FailureDomain] = clusterv1.FailureDomainSpec{ControlPlane: true}
+	}
+	return failureDomains
+}
+
+// reconcileExternalLoadBalancer publishes the addresses of the API servers of the control plane
+// machines that the load balancer provided by the user is expected to forward to. Its control plane
+// endpoint is set by the user, there is no load balancer container to create.
+func (r *ContainerdClusterReconciler) reconcileExternalLoadBalancer(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster) (ctrl.Result, error) {
+	if containerdCluster.Spec.ControlPlaneEndpoint.IsZero() {
+		err := errors.New("the control plane endpoint of an externally managed load balancer is not set")
+		conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, infrastructurev1beta1.LoadBalancerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	backends, err := r.loadBalancerBackends(ctx, cluster, containerdCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	containerdCluster.Status.LoadBalancerBackends = backends
+
+	containerdCluster.Status.Ready = true
+	conditions.MarkTrue(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition)
+	return ctrl.Result{}, nil
+}
+
+// reconcileLoadBalancerBackends updates the configuration of the load balancer with the control plane
+// machines of the cluster, and marks the load balancer configured on the ones it forwards to.
+func (r *ContainerdClusterReconciler) reconcileLoadBalancerBackends(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster, externalLoadBalancer containerd.LoadBalancer) error {
+	reloaded, err := externalLoadBalancer.UpdateConfiguration(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to update the load balancer configuration")
+	}
+	if reloaded {
+		countLoadBalancerReload(cluster)
+		r.recorder.Event(containerdCluster, corev1.EventTypeNormal, loadBalancerReloadedReason, "Reloaded the load balancer with the control plane machines")
+	}
+
+	containerdMachines, err := r.controlPlaneMachines(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	for i := range containerdMachines {
+		containerdMachine := &containerdMachines[i]
+		if !containerdMachine.DeletionTimestamp.IsZero() || len(containerdMachine.Status.Addresses) == 0 || containerdMachine.Status.LoadBalancerConfigured {
+			continue
+		}
+		patch := client.MergeFrom(containerdMachine.DeepCopy())
+		containerdMachine.Status.LoadBalancerConfigured = true
+		if err := r.Client.Status().Patch(ctx, containerdMachine, patch); err != nil {
+			return errors.Wrapf(err, "failed to patch ContainerdMachine %s", client.ObjectKeyFromObject(containerdMachine))
+		}
+	}
+	return nil
+}
+
+// controlPlaneMachines returns the control plane ContainerdMachines of the cluster.
+func (r *ContainerdClusterReconciler) controlPlaneMachines(ctx context.Context, cluster *clusterv1.Cluster) ([]infrastructurev1beta1.ContainerdMachine, error) {
+	containerdMachines := &infrastructurev1beta1.ContainerdMachineList{}
+	if err := r.Client.List(ctx, containerdMachines, client.InNamespace(cluster.Namespace), client.MatchingLabels{clusterv1.ClusterLabelName: cluster.Name}, client.HasLabels{clusterv1.MachineControlPlaneLabelName}); err != nil {
+		return nil, errors.Wrap(err, "failed to list the control plane ContainerdMachines")
+	}
+	return containerdMachines.Items, nil
+}
+
+// loadBalancerBackends returns the sorted addresses of the API servers of the control plane machines
+// of the cluster.
+func (r *ContainerdClusterReconciler) loadBalancerBackends(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster) ([]string, error) {
+	containerdMachines, err := r.controlPlaneMachines(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
 
+	backendPort := containerdCluster.Spec.LoadBalancer.BackendPort
+	if backendPort == 0 {
+		backendPort = containerd.KubeadmContainerPort
+	}
+	var backends []string
+	for _, containerdMachine := range containerdMachines {
+		if !containerdMachine.DeletionTimestamp.IsZero() {
+			continue
+		}
+		for _, address := range containerdMachine.Status.Addresses {
+			if address.Type == clusterv1.MachineInternalIP {
+				backends = append(backends, net.JoinHostPort(address.Address, strconv.Itoa(int(backendPort))))
+			}
+		}
+	}
+	sort.Strings(backends)
+	return backends, nil
+}
+
+// containerdMachineToContainerdCluster returns the request of the ContainerdCluster of the cluster of
+// a ContainerdMachine, so that the load balancer backends follow the control plane machines.
+func (r *ContainerdClusterReconciler) containerdMachineToContainerdCluster(ctx context.Context) handler.MapFunc {
+	return func(o client.Object) []ctrl.Request {
+		clusterName, ok := o.GetLabels()[clusterv1.ClusterLabelName]
+		if !ok {
+			return nil
+		}
+		if _, ok := o.GetLabels()[clusterv1.MachineControlPlaneLabelName]; !ok {
+			return nil
+		}
+		cluster := &clusterv1.Cluster{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: o.GetNamespace(), Name: clusterName}, cluster); err != nil {
+			return nil
+		}
+		ref := cluster.Spec.InfrastructureRef
+		if ref == nil || ref.Kind != "ContainerdCluster" {
+			return nil
+		}
+		return []ctrl.Request{{NamespacedName: client.ObjectKey{Namespace: cluster.Namespace, Name: ref.Name}}}
+	}
+}
+
+// reconcileDelete deletes the container hosting the load balancer of the cluster, then the
+// containerd namespaces of the cluster, with the containers, images and leases left in them, and the
+// network of the cluster, on all the hosts. The machines of the cluster are deleted before it, so the
+// namespaces only hold what was not cleaned up with them.
+func (r *ContainerdClusterReconciler) reconcileDelete(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster) (ctrl.Result, error) {
+	// Set the LoadBalancerAvailableCondition reporting delete is started.
+	conditions.MarkFalse(containerdCluster, infrastructurev1beta1.LoadBalancerAvailableCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo, "")
+
+	if !containerdCluster.Spec.LoadBalancer.IsExternallyManaged() {
+		externalLoadBalancer, err := containerd.NewLoadBalancer(ctx, cluster, containerdCluster)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to create helper for managing the externalLoadBalancer")
+		}
+		if err := externalLoadBalancer.Delete(ctx); err != nil {
+			countContainerdError(cluster, operationDelete)
+			return ctrl.Result{}, errors.Wrap(err, "failed to delete load balancer")
+		}
+	}
+
+	for _, runtime := range r.runtimes() {
+		runtime, ok := runtime.(capc.Runtime)
+		if !ok {
+			continue
+		}
+		if err := runtime.DeleteClusterNamespace(ctx); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to delete the containerd namespace of the cluster")
+		}
+		if network, ok := containerd.OwnedNetwork(containerdCluster); ok {
+			if err := runtime.DeleteNetwork(ctx, network); err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "failed to delete the network of the cluster")
+			}
+		}
+	}
+
+	// The namespaces are deleted so remove the finalizer.
+	controllerutil.RemoveFinalizer(containerdCluster, infrastructurev1beta1.ClusterFinalizer)
 	return ctrl.Result{}, nil
 }
 
+// runtimes returns the runtimes of all the hosts the machines of the cluster can run on.
+func (r *ContainerdClusterReconciler) runtimes() []container.Runtime {
+	return hostRuntimes(r.ContainerRuntime, r.Hosts)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ContainerdClusterReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	r.recorder = mgr.GetEventRecorderFor("containerdcluster-controller")
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&infrastructurev1alpha3.ContainerdCluster{}).
+		For(&infrastructurev1beta1.ContainerdCluster{}).
+		WithOptions(options).
+		WithEventFilter(predicates.ResourceIsNotExternallyManaged(ctrl.LoggerFrom(ctx))).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(util.ClusterToInfrastructureMapFuncWithExternallyManagedCheck(
+				ctx, infrastructurev1beta1.GroupVersion.WithKind("ContainerdCluster"), r.Client, &infrastructurev1beta1.ContainerdCluster{})),
+		).
+		Watches(
+			&source.Kind{Type: &infrastructurev1beta1.ContainerdMachine{}},
+			handler.EnqueueRequestsFromMapFunc(r.containerdMachineToContainerdCluster(ctx)),
+		).
 		Complete(r)
 }
@@ -18,15 +18,66 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"time"
 
+	containerdruntime "github.com/containerd/containerd/runtime"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/remote"
 	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/kind/pkg/cluster/constants"
 
-	infrastructurev1alpha3 "github.com/raminenia/cluster-api-provider-containerd/api/v1alpha3"
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd"
+)
+
+const (
+	// resourceUsageInterval is how often the resource usage in the status of a provisioned machine is refreshed.
+	resourceUsageInterval = time.Minute
+	// nodeMetadataRetryInterval is how often applying the node metadata of a provisioned machine is
+	// retried until its node registers in the workload cluster.
+	nodeMetadataRetryInterval = 10 * time.Second
+	// nodeProviderIDRetryInterval is how often setting the provider ID on the node of a bootstrapped
+	// machine is retried until the node registers in the workload cluster.
+	nodeProviderIDRetryInterval = 10 * time.Second
+	// nodeDrainRetryInterval is how often the drain of the node of a deleted machine is retried until
+	// its pods are evicted or its drain timeout expires.
+	nodeDrainRetryInterval = 10 * time.Second
+	// defaultWindowsPlatform is the platform of the image of Windows machines that do not set one.
+	defaultWindowsPlatform = "windows/amd64"
+)
+
+// The reasons of the events of the ContainerdMachines and ContainerdClusters, besides the reasons of
+// their conditions.
+const (
+	containerCreatedReason     = "ContainerCreated"
+	containerDeletedReason     = "ContainerDeleted"
+	bootstrapSucceededReason   = "BootstrapSucceeded"
+	loadBalancerReloadedReason = "LoadBalancerReloaded"
 )
 
 // ContainerdMachineReconciler reconciles a ContainerdMachine object
@@ -34,32 +85,1136 @@ type ContainerdMachineReconciler struct {
 	client.Client
 	Scheme           *runtime.Scheme
 	ContainerRuntime container.Runtime
+	// Hosts schedules the machines onto a pool of containerd hosts, if set. ContainerRuntime is
+	// used for all the machines otherwise.
+	Hosts *capc.HostPool
+	// ReconcileTimeout bounds the operations of a reconciliation, if set. The patch of the reconciled
+	// object is not bounded, so that the progress of a reconciliation that timed out is recorded.
+	ReconcileTimeout time.Duration
+	// Timeouts bound the operations on the containers of the machines, within ReconcileTimeout.
+	Timeouts OperationTimeouts
+
+	recorder record.EventRecorder
+	// remoteClientGetter returns the client of the workload cluster the provider IDs of the nodes
+	// are set with.
+	remoteClientGetter remote.ClusterClientGetter
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdmachines,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdmachines/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdmachines/finalizers,verbs=update
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdclusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;machines,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile handles ContainerdMachine events.
+func (r *ContainerdMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, rerr error) {
+	ctx, span := startReconcileSpan(ctx, "ContainerdMachine", req)
+	defer func() { endReconcileSpan(span, rerr) }()
+	log := ctrl.LoggerFrom(ctx)
+	ctx = container.RuntimeInto(ctx, r.ContainerRuntime)
+
+	// Fetch the ContainerdMachine instance.
+	containerdMachine := &infrastructurev1beta1.ContainerdMachine{}
+	if err := r.Client.Get(ctx, req.NamespacedName, containerdMachine); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// The rest of the reconciliation is bounded by the timeout, except the patch of the
+	// ContainerdMachine, so that the progress of a reconciliation that timed out is recorded.
+	patchCtx := ctx
+	ctx, cancel := withTimeout(ctx, r.ReconcileTimeout)
+	defer cancel()
+
+	// Fetch the Machine.
+	machine, err := util.GetOwnerMachine(ctx, r.Client, containerdMachine.ObjectMeta)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if machine == nil {
+		log.Info("Waiting for Machine Controller to set OwnerRef on ContainerdMachine")
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("machine", machine.Name)
+
+	// Fetch the Cluster.
+	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, machine.ObjectMeta)
+	if err != nil {
+		log.Info("ContainerdMachine owner Machine is missing cluster label or cluster does not exist")
+		return ctrl.Result{}, err
+	}
+	if cluster == nil {
+		log.Info(fmt.Sprintf("Please associate this machine with a cluster using the label %s: <name of cluster>", clusterv1.ClusterLabelName))
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("cluster", cluster.Name)
+
+	// Return early if the object or Cluster is paused.
+	if annotations.IsPaused(cluster, containerdMachine) {
+		log.Info("Reconciliation is paused for this object")
+		return ctrl.Result{}, nil
+	}
+
+	// Fetch the Containerd Cluster.
+	containerdCluster := &infrastructurev1beta1.ContainerdCluster{}
+	containerdClusterName := client.ObjectKey{
+		Namespace: containerdMachine.Namespace,
+		Name:      cluster.Spec.InfrastructureRef.Name,
+	}
+	if err := r.Client.Get(ctx, containerdClusterName, containerdCluster); err != nil {
+		log.Info("ContainerdCluster is not available yet")
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("containerd-cluster", containerdCluster.Name)
+	ctx = ctrl.LoggerInto(ctx, log)
+	// The containers of the machines live in the containerd namespace of their cluster.
+	ctx = capc.ClusterInto(ctx, containerdCluster.Namespace, containerdCluster.Name)
+
+	// Initialize the patch helper
+	patchHelper, err := patch.NewHelper(containerdMachine, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Always attempt to Patch the ContainerdMachine object and status after each reconciliation.
+	defer func() {
+		if err := patchContainerdMachine(patchCtx, patchHelper, containerdMachine); err != nil {
+			log.Error(err, "failed to patch ContainerdMachine")
+			if rerr == nil {
+				rerr = err
+			}
+		}
+	}()
+
+	// Add finalizer first if not exist to avoid the race condition between init and delete
+	if !controllerutil.ContainsFinalizer(containerdMachine, infrastructurev1beta1.MachineFinalizer) {
+		controllerutil.AddFinalizer(containerdMachine, infrastructurev1beta1.MachineFinalizer)
+		return ctrl.Result{}, nil
+	}
+
+	runtime, err := r.machineRuntime(ctx, machine, containerdCluster, containerdMachine)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	ctx = container.RuntimeInto(ctx, runtime)
+
+	// Create a helper for managing the containerd container hosting the machine.
+	externalMachine, err := containerd.NewMachine(ctx, cluster, containerdCluster, machine.Name, nil)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to create helper for managing the externalMachine")
+	}
+
+	// Handle deleted machines
+	if !containerdMachine.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, cluster, machine, containerdCluster, containerdMachine, externalMachine)
+	}
+
+	// Check if the infrastructure is ready, otherwise return and wait for the cluster object to be updated
+	if !cluster.Status.InfrastructureReady {
+		log.Info("Waiting for ContainerdCluster Controller to create cluster infrastructure")
+		conditions.MarkFalse(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition, infrastructurev1beta1.WaitingForClusterInfrastructureReason, clusterv1.ConditionSeverityInfo, "")
+		return ctrl.Result{}, nil
+	}
+
+	ctx, err = r.runtimeContext(ctx, cluster, containerdCluster, containerdMachine)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Handle non-deleted machines
+	return r.reconcileNormal(ctx, patchHelper, cluster, machine, containerdCluster, containerdMachine, externalMachine)
+}
+
+// patchContainerdMachine patches the ContainerdMachine, with a Ready condition summarizing the
+// provisioning of the machine.
+func patchContainerdMachine(ctx context.Context, patchHelper *patch.Helper, containerdMachine *infrastructurev1beta1.ContainerdMachine) error {
+	// Always update the readyCondition by summarizing the state of other conditions.
+	// A step counter is added to represent progress during the provisioning process (instead we are
+	// hiding the step counter during the deletion process).
+	conditions.SetSummary(containerdMachine,
+		conditions.WithConditions(
+			infrastructurev1beta1.ImagePulledCondition,
+			infrastructurev1beta1.ContainerProvisionedCondition,
+			infrastructurev1beta1.BootstrapExecSucceededCondition,
+			infrastructurev1beta1.NodeProvisionedCondition,
+		),
+		conditions.WithStepCounterIf(containerdMachine.ObjectMeta.DeletionTimestamp.IsZero() && containerdMachine.Spec.ProviderID == nil),
+	)
+
+	// Patch the object, ignoring conflicts on the conditions owned by this controller.
+	return patchHelper.Patch(
+		ctx,
+		containerdMachine,
+		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrastructurev1beta1.ImagePulledCondition,
+			infrastructurev1beta1.ContainerProvisionedCondition,
+			infrastructurev1beta1.BootstrapExecSucceededCondition,
+			infrastructurev1beta1.NodeProvisionedCondition,
+			clusterv1.PreDrainDeleteHookSucceededCondition,
+			clusterv1.PreTerminateDeleteHookSucceededCondition,
+			infrastructurev1beta1.NodeDrainedCondition,
+		}},
+	)
+}
+
+// machineRuntime returns the runtime of the containerd host of the machine. Machines that have no
+// host yet are scheduled onto one of the pool, if any, and the host is recorded in their status.
+func (r *ContainerdMachineReconciler) machineRuntime(ctx context.Context, machine *clusterv1.Machine, containerdCluster *infrastructurev1beta1.ContainerdCluster, containerdMachine *infrastructurev1beta1.ContainerdMachine) (container.Runtime, error) {
+	if r.Hosts == nil {
+		return r.ContainerRuntime, nil
+	}
+	if containerdMachine.Status.Host != "" {
+		host, ok := r.Hosts.Host(containerdMachine.Status.Host)
+		if !ok {
+			return nil, errors.Errorf("host %q of the machine is not in the host pool", containerdMachine.Status.Host)
+		}
+		return host.Runtime, nil
+	}
+	// A machine deleted before it was scheduled has no container to delete.
+	if !containerdMachine.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.ContainerRuntime, nil
+	}
+
+	placement := capc.Placement{}
+	if machine.Spec.FailureDomain != nil {
+		placement = failureDomainPlacement(containerdCluster, *machine.Spec.FailureDomain)
+	}
+	if containerdMachine.Spec.HostSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(containerdMachine.Spec.HostSelector)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid host selector")
+		}
+		if placement.Selector != nil {
+			requirements, _ := selector.Requirements()
+			selector = placement.Selector.Add(requirements...)
+		}
+		placement.Selector = selector
+	}
+	machines, err := r.hostMachines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	host, err := r.Hosts.Schedule(placement, machines)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to schedule the machine")
+	}
+	ctrl.LoggerFrom(ctx).Info("Scheduled machine onto host", "host", host.Name)
+	containerdMachine.Status.Host = host.Name
+	return host.Runtime, nil
+}
+
+// failureDomainPlacement returns the placement of the machines of a failure domain: on the host and
+// the hosts with the labels of its attributes if the cluster defines some, else on the hosts of the
+// failure domain of the same name.
+func failureDomainPlacement(containerdCluster *infrastructurev1beta1.ContainerdCluster, failureDomain string) capc.Placement {
+	spec, ok := containerdCluster.Spec.FailureDomains[failureDomain]
+	if !ok || len(spec.Attributes) == 0 {
+		return capc.Placement{FailureDomain: failureDomain}
+	}
+
+	placement := capc.Placement{}
+	hostLabels := labels.Set{}
+	for key, value := range spec.Attributes {
+		if key == infrastructurev1beta1.FailureDomainHostAttribute {
+			placement.Host = value
+			continue
+		}
+		hostLabels[key] = value
+	}
+	if len(hostLabels) > 0 {
+		placement.Selector = labels.SelectorFromSet(hostLabels)
+	}
+	return placement
+}
+
+// hostMachines returns the number of machines scheduled onto each host of the pool.
+func (r *ContainerdMachineReconciler) hostMachines(ctx context.Context) (map[string]int, error) {
+	containerdMachines := &infrastructurev1beta1.ContainerdMachineList{}
+	if err := r.Client.List(ctx, containerdMachines); err != nil {
+		return nil, errors.Wrap(err, "failed to list ContainerdMachines")
+	}
+	machines := map[string]int{}
+	for _, containerdMachine := range containerdMachines.Items {
+		if containerdMachine.Status.Host != "" {
+			machines[containerdMachine.Status.Host]++
+		}
+	}
+	return machines, nil
+}
+
+// machinePlatform returns the platform of the machine image, windows/amd64 by default for Windows
+// machines so that they do not get the platform of the host.
+func machinePlatform(containerdMachine *infrastructurev1beta1.ContainerdMachine) string {
+	if containerdMachine.Spec.Platform == "" && containerdMachine.Spec.OS == infrastructurev1beta1.WindowsOS {
+		return defaultWindowsPlatform
+	}
+	return containerdMachine.Spec.Platform
+}
+
+// imagePullReportInterval is how often the progress of the pull of the image of a machine is patched
+// into its ImagePulled condition.
+const imagePullReportInterval = 10 * time.Second
+
+// imagePullReporter surfaces the progress of the pull of the image of a machine as the reason and
+// message of its ImagePulled condition, patching the ContainerdMachine at most every interval.
+type imagePullReporter struct {
+	containerdMachine *infrastructurev1beta1.ContainerdMachine
+	patch             func(ctx context.Context) error
+	interval          time.Duration
+	now               func() time.Time
+	lastReport        time.Time
+}
+
+// report returns the callback receiving the progress of the pull. The callback is not called
+// concurrently, and not after the pull returns.
+func (p *imagePullReporter) report(ctx context.Context) capc.PullProgressFunc {
+	log := ctrl.LoggerFrom(ctx)
+	return func(progress capc.PullProgress) {
+		log.Info(progress.String())
+		// The condition is marked true by the reconciliation once the image is pulled.
+		if progress.Status == capc.PullStatusDone || p.now().Sub(p.lastReport) < p.interval {
+			return
+		}
+		p.lastReport = p.now()
+		conditions.MarkFalse(p.containerdMachine, infrastructurev1beta1.ImagePulledCondition, infrastructurev1beta1.ImagePullingReason, clusterv1.ConditionSeverityInfo, "%s", progress.String())
+		if err := p.patch(ctx); err != nil {
+			log.Error(err, "Failed to patch the image pull progress")
+		}
+	}
+}
+
+// clusterRuntimeContext returns a context carrying the per cluster settings used by the container
+// runtime when pulling images and attaching the machine containers to the network.
+func clusterRuntimeContext(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster) (context.Context, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	creds, err := containerd.RegistryCredentials(ctx, c, containerdCluster, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = capc.RegistryCredentialsInto(ctx, creds)
+	ctx = capc.RegistryMirrorsInto(ctx, containerd.RegistryMirrors(containerdCluster))
+	ipFamily, err := containerd.IPFamily(cluster, containerdCluster)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid IP family of the cluster")
+	}
+	if network, ok := containerd.ClusterNetwork(containerdCluster, ipFamily); ok {
+		ctx = capc.NetworkInto(ctx, network)
+	}
+	ctx = capc.PullProgressInto(ctx, func(progress capc.PullProgress) {
+		log.Info(progress.String())
+	})
+	return ctx, nil
+}
+
+// runtimeContext returns a context carrying the per cluster and per machine settings used by the
+// container runtime when pulling images and creating the machine container.
+func (r *ContainerdMachineReconciler) runtimeContext(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster, containerdMachine *infrastructurev1beta1.ContainerdMachine) (context.Context, error) {
+	ctx, err := clusterRuntimeContext(ctx, r.Client, cluster, containerdCluster)
+	if err != nil {
+		return nil, err
+	}
+	if len(containerdMachine.Spec.ImagePullSecrets) > 0 {
+		creds, err := containerd.RegistryCredentials(ctx, r.Client, containerdCluster, containerdMachine.Spec.ImagePullSecrets)
+		if err != nil {
+			return nil, err
+		}
+		ctx = capc.RegistryCredentialsInto(ctx, creds)
+	}
+
+	ctx = capc.SnapshotterInto(ctx, containerdMachine.Spec.Snapshotter)
+	ctx = capc.PlatformInto(ctx, machinePlatform(containerdMachine))
+	ctx = capc.RuntimeHandlerInto(ctx, containerdMachine.Spec.RuntimeHandler)
+	if containerdMachine.Spec.HealthCheck != nil {
+		ctx = capc.HealthCheckInto(ctx, healthCheck(containerdMachine.Spec.HealthCheck))
+	}
+	if containerdMachine.Spec.Resources != nil {
+		ctx = capc.ResourceLimitsInto(ctx, resourceLimits(containerdMachine.Spec.Resources))
+	}
+	if len(containerdMachine.Spec.Devices) > 0 {
+		ctx = capc.DevicesInto(ctx, deviceMappings(containerdMachine.Spec.Devices))
+	}
+	if len(containerdMachine.Spec.CDIDevices) > 0 {
+		ctx = capc.CDIDevicesInto(ctx, containerdMachine.Spec.CDIDevices)
+	}
+	if len(containerdMachine.Spec.Sysctls) > 0 {
+		ctx = capc.SysctlsInto(ctx, containerdMachine.Spec.Sysctls)
+	}
+	if len(containerdMachine.Spec.Ulimits) > 0 {
+		ctx = capc.UlimitsInto(ctx, ulimits(containerdMachine.Spec.Ulimits))
+	}
+	if containerdMachine.Spec.StaticIP != "" || containerdMachine.Spec.MACAddress != "" {
+		ctx = capc.StaticAddressInto(ctx, staticAddress(containerdMachine))
+	}
+	ctx = capc.CommandOverrideInto(ctx, capc.CommandOverride{
+		Entrypoint: containerdMachine.Spec.Entrypoint,
+		Command:    containerdMachine.Spec.Command,
+		ExtraArgs:  containerdMachine.Spec.ExtraArgs,
+	})
+	if profile := containerdMachine.Spec.IsolationProfile; profile != nil {
+		ctx = capc.IsolationProfileInto(ctx, capc.IsolationProfile{
+			Mode:            capc.IsolationMode(profile.Mode),
+			Capabilities:    profile.Capabilities,
+			SeccompProfile:  profile.SeccompProfile,
+			AppArmorProfile: profile.AppArmorProfile,
+		})
+	}
+	if containerdMachine.Spec.Hooks != nil {
+		ctx = capc.HooksInto(ctx, capc.Hooks{
+			Prestart: hooks(containerdMachine.Spec.Hooks.Prestart),
+			Poststop: hooks(containerdMachine.Spec.Hooks.Poststop),
+		})
+	}
+	return ctx, nil
+}
+
+func (r *ContainerdMachineReconciler) reconcileNormal(ctx context.Context, patchHelper *patch.Helper, cluster *clusterv1.Cluster, machine *clusterv1.Machine, containerdCluster *infrastructurev1beta1.ContainerdCluster, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// if the machine is already provisioned, return
+	if containerdMachine.Spec.ProviderID != nil {
+		// ensure ready state is set.
+		// This is required after move, because status is not moved to the target cluster.
+		containerdMachine.Status.Ready = true
+
+		if err := setContainerStatus(ctx, containerdMachine, externalMachine); err != nil {
+			return ctrl.Result{}, err
+		}
+		if externalMachine.Exists() {
+			if err := setRestartCount(ctx, containerdMachine, externalMachine); err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := setMachineAddresses(ctx, containerdMachine, externalMachine); err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := externalMachine.UpdateHosts(ctx, containerdCluster.Spec.HostAliases); err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "failed to update the hosts of the ContainerdMachine")
+			}
+			if err := updateRegistryHosts(ctx, r.Client, containerdCluster, externalMachine); err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "failed to update the registry hosts of the ContainerdMachine")
+			}
+			if err := updateKubeletCredentials(ctx, r.Client, containerdCluster, containerdMachine.Spec.ImagePullSecrets, externalMachine); err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "failed to update the kubelet credentials of the ContainerdMachine")
+			}
+			if err := reconcileFrozen(ctx, containerdMachine, externalMachine); err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := setMachineHealthy(ctx, containerdMachine, externalMachine); err != nil {
+				return ctrl.Result{}, err
+			}
+			requeueAfter := setResourceUsage(ctx, containerdMachine, externalMachine)
+			if !setNodeMetadata(ctx, containerdMachine, externalMachine) && nodeMetadataRetryInterval < requeueAfter {
+				requeueAfter = nodeMetadataRetryInterval
+			}
+			if check := containerdMachine.Spec.HealthCheck; check != nil {
+				if interval := healthCheck(check).Interval; interval > 0 && interval < requeueAfter {
+					requeueAfter = interval
+				}
+			}
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		// The event is emitted once, when the container is found missing, not on every reconcile after.
+		if conditions.GetReason(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition) != infrastructurev1beta1.ContainerDeletedReason {
+			r.recorder.Eventf(containerdMachine, corev1.EventTypeWarning, infrastructurev1beta1.ContainerDeletedReason, "Container %s does not exist anymore", externalMachine.ContainerName())
+		}
+		conditions.MarkFalse(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition, infrastructurev1beta1.ContainerDeletedReason, clusterv1.ConditionSeverityError, "Container %s does not exist anymore", externalMachine.ContainerName())
+		return ctrl.Result{}, nil
+	}
+
+	// Make sure bootstrap data is available and populated.
+	if machine.Spec.Bootstrap.DataSecretName == nil {
+		if !util.IsControlPlaneMachine(machine) && !conditions.IsTrue(cluster, clusterv1.ControlPlaneInitializedCondition) {
+			log.Info("Waiting for the control plane to be initialized")
+			return ctrl.Result{}, nil
+		}
+
+		log.Info("Waiting for the Bootstrap provider controller to set bootstrap data")
+		conditions.MarkFalse(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition, infrastructurev1beta1.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo, "")
+		return ctrl.Result{}, nil
+	}
+
+	// Create the containerd container hosting the machine
+	role := constants.WorkerNodeRoleValue
+	if util.IsControlPlaneMachine(machine) {
+		role = constants.ControlPlaneNodeRoleValue
+	}
+
+	// Create the machine if not existing yet
+	if !externalMachine.Exists() {
+		reporter := &imagePullReporter{
+			containerdMachine: containerdMachine,
+			patch: func(ctx context.Context) error {
+				return patchContainerdMachine(ctx, patchHelper, containerdMachine)
+			},
+			interval: imagePullReportInterval,
+			now:      time.Now,
+		}
+		pullCtx, cancel := withTimeout(ctx, r.Timeouts.Pull)
+		err := externalMachine.PullImage(capc.PullProgressInto(pullCtx, reporter.report(ctx)), containerdMachine.Spec.CustomImage, machine.Spec.Version)
+		cancel()
+		if err != nil {
+			countContainerdError(cluster, operationPull)
+			conditions.MarkFalse(containerdMachine, infrastructurev1beta1.ImagePulledCondition, infrastructurev1beta1.ImagePullFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+			r.recorder.Eventf(containerdMachine, corev1.EventTypeWarning, infrastructurev1beta1.ImagePullFailedReason, "Failed to pull the machine image: %v", err)
+			return ctrl.Result{}, errors.Wrap(err, "failed to pull the image of the ContainerdMachine")
+		}
+		containerdMachine.Status.ImagePulled = true
+		conditions.MarkTrue(containerdMachine, infrastructurev1beta1.ImagePulledCondition)
+
+		createCtx, cancel := withTimeout(ctx, r.Timeouts.Create)
+		err = externalMachine.Create(createCtx, containerdMachine.Spec.CustomImage, role, machine.Spec.Version, nil, containerdMachine.Spec.ExtraMounts, containerdMachine.Spec.ExtraPortMappings)
+		cancel()
+		if err != nil {
+			countContainerdError(cluster, operationCreate)
+			conditions.MarkFalse(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition, infrastructurev1beta1.ContainerProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+			r.recorder.Eventf(containerdMachine, corev1.EventTypeWarning, infrastructurev1beta1.ContainerProvisioningFailedReason, "Failed to create the machine container: %v", err)
+			return ctrl.Result{}, errors.Wrap(err, "failed to create worker ContainerdMachine")
+		}
+		r.recorder.Eventf(containerdMachine, corev1.EventTypeNormal, containerCreatedReason, "Created container %s", externalMachine.ContainerName())
+	}
+	conditions.MarkTrue(containerdMachine, infrastructurev1beta1.ImagePulledCondition)
+	conditions.MarkTrue(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition)
+
+	if err := setContainerStatus(ctx, containerdMachine, externalMachine); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := setRestartCount(ctx, containerdMachine, externalMachine); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := setMachineAddresses(ctx, containerdMachine, externalMachine); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Let the machine reach the load balancer and the other machines of the cluster by name.
+	if err := externalMachine.UpdateHosts(ctx, containerdCluster.Spec.HostAliases); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to update the hosts of the ContainerdMachine")
+	}
+
+	// Let the images pulled in the workload cluster use the registry mirrors, before kubelet starts.
+	if err := updateRegistryHosts(ctx, r.Client, containerdCluster, externalMachine); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to update the registry hosts of the ContainerdMachine")
+	}
+	if err := updateKubeletCredentials(ctx, r.Client, containerdCluster, containerdMachine.Spec.ImagePullSecrets, externalMachine); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to update the kubelet credentials of the ContainerdMachine")
+	}
+
+	if err := setMachineHealthy(ctx, containerdMachine, externalMachine); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Preload images into the container, until it is bootstrapped: the image archives are imported
+	// again each time.
+	if len(containerdMachine.Spec.PreLoadImages) > 0 && !containerdMachine.Spec.Bootstrapped {
+		preloadCtx, cancel := withTimeout(ctx, r.Timeouts.Bootstrap)
+		err := externalMachine.PreloadLoadImages(preloadCtx, containerdMachine.Spec.PreLoadImages)
+		cancel()
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to pre-load images into the ContainerdMachine")
+		}
+	}
+
+	// kubeadm reaches the control plane endpoint during the bootstrap of a control plane machine: wait
+	// for the ContainerdCluster controller to add the machine, once its addresses are set, to the
+	// load balancer.
+	if util.IsControlPlaneMachine(machine) && loadBalancerForwardsToMachines(containerdCluster) && !containerdMachine.Status.LoadBalancerConfigured {
+		log.Info("Waiting for the load balancer to forward to the ContainerdMachine")
+		return ctrl.Result{}, nil
+	}
+
+	if !containerdMachine.Spec.Bootstrapped {
+		bootstrapCtx, cancel := withTimeout(ctx, r.Timeouts.Bootstrap)
+		err := r.bootstrap(bootstrapCtx, patchHelper, cluster, machine, containerdMachine, externalMachine)
+		cancel()
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The node registers itself after the bootstrap, its provider ID is set on a later reconcile if
+	// it is not there yet.
+	if !conditions.IsTrue(containerdMachine, infrastructurev1beta1.NodeProvisionedCondition) {
+		workloadClient, err := r.remoteClientGetter(ctx, "containerdmachine-controller", r.Client, util.ObjectKey(cluster))
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to create a client to the workload cluster")
+		}
+		if err := externalMachine.SetNodeProviderID(ctx, workloadClient); err != nil {
+			log.Info("Waiting for the node of the ContainerdMachine to set its provider ID", "error", err.Error())
+			conditions.MarkFalse(containerdMachine, infrastructurev1beta1.NodeProvisionedCondition, infrastructurev1beta1.WaitingForNodeReason, clusterv1.ConditionSeverityInfo, "")
+			return ctrl.Result{RequeueAfter: nodeProviderIDRetryInterval}, nil
+		}
+	}
+	providerID := externalMachine.ProviderID()
+	containerdMachine.Spec.ProviderID = &providerID
+	conditions.MarkTrue(containerdMachine, infrastructurev1beta1.NodeProvisionedCondition)
+	containerdMachine.Status.Ready = true
+	return ctrl.Result{}, nil
+}
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the ContainerdMachine object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.2/pkg/reconcile
-func (r *ContainerdMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+// loadBalancerForwardsToMachines returns true if the load balancer of the cluster is a container
+// whose configuration is updated by the ContainerdCluster controller with the control plane machines.
+func loadBalancerForwardsToMachines(containerdCluster *infrastructurev1beta1.ContainerdCluster) bool {
+	return !containerdCluster.Spec.LoadBalancer.IsExternallyManaged() && !annotations.IsExternallyManaged(containerdCluster) &&
+		containerdCluster.Spec.LoadBalancer.Type != infrastructurev1beta1.KubeVIPLoadBalancerType
+}
+
+// bootstrap runs the bootstrap data of the machine in its container and records the exit code of
+// the bootstrap in the status of the ContainerdMachine.
+func (r *ContainerdMachineReconciler) bootstrap(ctx context.Context, patchHelper *patch.Helper, cluster *clusterv1.Cluster, machine *clusterv1.Machine, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) error {
+	// A bootstrap interrupted after it succeeded, e.g. by a restart of the controller, is not run again.
+	if externalMachine.CheckForBootstrapSuccess(ctx) != nil {
+		bootstrapData, format, err := getBootstrapData(ctx, r.Client, machine.Namespace, *machine.Spec.Bootstrap.DataSecretName)
+		if err != nil {
+			return err
+		}
+
+		// Update the BootstrapExecSucceededCondition reporting the bootstrap is starting, the
+		// bootstrap commands can take minutes to run.
+		conditions.MarkFalse(containerdMachine, infrastructurev1beta1.BootstrapExecSucceededCondition, infrastructurev1beta1.BootstrappingReason, clusterv1.ConditionSeverityInfo, "")
+		if err := patchContainerdMachine(ctx, patchHelper, containerdMachine); err != nil {
+			return errors.Wrap(err, "failed to patch ContainerdMachine")
+		}
+		start := time.Now()
+		if err := externalMachine.ExecBootstrap(ctx, bootstrapData, format, containerd.KubeletConfig{
+			ExtraArgs:   containerdMachine.Spec.KubeletExtraArgs,
+			ConfigPatch: containerdMachine.Spec.KubeletConfigPatch,
+		}); err != nil {
+			containerdMachine.Status.BootstrapExitCode = nil
+			if code, ok := containerd.BootstrapExitCode(err); ok {
+				containerdMachine.Status.BootstrapExitCode = &code
+			} else {
+				countContainerdError(cluster, operationExec)
+			}
+			conditions.MarkFalse(containerdMachine, infrastructurev1beta1.BootstrapExecSucceededCondition, infrastructurev1beta1.BootstrapFailedReason, clusterv1.ConditionSeverityWarning, "Repeating bootstrap")
+			r.recorder.Eventf(containerdMachine, corev1.EventTypeWarning, infrastructurev1beta1.BootstrapFailedReason, "Failed to bootstrap the machine: %v", err)
+			return errors.Wrap(err, "failed to exec the bootstrap of the ContainerdMachine")
+		}
+		if err := externalMachine.CheckForBootstrapSuccess(ctx); err != nil {
+			conditions.MarkFalse(containerdMachine, infrastructurev1beta1.BootstrapExecSucceededCondition, infrastructurev1beta1.BootstrapFailedReason, clusterv1.ConditionSeverityWarning, "Repeating bootstrap")
+			r.recorder.Eventf(containerdMachine, corev1.EventTypeWarning, infrastructurev1beta1.BootstrapFailedReason, "Failed to bootstrap the machine: %v", err)
+			return errors.Wrap(err, "failed to check the bootstrap of the ContainerdMachine")
+		}
+		observeBootstrap(cluster, start)
+		r.recorder.Event(containerdMachine, corev1.EventTypeNormal, bootstrapSucceededReason, "Bootstrapped the machine")
+	}
+	exitCode := int32(0)
+	containerdMachine.Status.BootstrapExitCode = &exitCode
+	containerdMachine.Spec.Bootstrapped = true
+	conditions.MarkTrue(containerdMachine, infrastructurev1beta1.BootstrapExecSucceededCondition)
+	return nil
+}
+
+func (r *ContainerdMachineReconciler) reconcileDelete(ctx context.Context, cluster *clusterv1.Cluster, machine *clusterv1.Machine, containerdCluster *infrastructurev1beta1.ContainerdCluster, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) (ctrl.Result, error) {
+	// The node is drained once the pre-drain hooks of the ContainerdMachine are removed, e.g. by the
+	// jobs moving workloads off the node.
+	if waitForDeletionHook(containerdMachine, clusterv1.PreDrainDeleteHookAnnotationPrefix, clusterv1.PreDrainDeleteHookSucceededCondition) {
+		ctrl.LoggerFrom(ctx).Info("Waiting for the pre-drain hooks of the ContainerdMachine to be removed")
+		return ctrl.Result{}, nil
+	}
+
+	// Cordon and drain the node before its container is deleted, unless the whole cluster is deleted.
+	if cluster.DeletionTimestamp.IsZero() && !drainNode(ctx, containerdMachine, externalMachine) {
+		return ctrl.Result{RequeueAfter: nodeDrainRetryInterval}, nil
+	}
+
+	// The etcd member and the container are kept until the pre-terminate hooks of the ContainerdMachine
+	// are removed, e.g. by the jobs snapshotting etcd or detaching volumes from the drained node.
+	if waitForDeletionHook(containerdMachine, clusterv1.PreTerminateDeleteHookAnnotationPrefix, clusterv1.PreTerminateDeleteHookSucceededCondition) {
+		ctrl.LoggerFrom(ctx).Info("Waiting for the pre-terminate hooks of the ContainerdMachine to be removed")
+		return ctrl.Result{}, nil
+	}
+
+	// Set the ContainerProvisionedCondition reporting delete is started.
+	conditions.MarkFalse(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo, "")
+
+	// Remove the etcd member of a control plane machine from the rest of the control plane before its
+	// container is deleted, so that etcd keeps its quorum. The whole cluster is deleted otherwise.
+	if util.IsControlPlaneMachine(machine) && containerdMachine.Spec.Bootstrapped && cluster.DeletionTimestamp.IsZero() {
+		if err := externalMachine.RemoveEtcdMember(ctx); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to remove the etcd member of the ContainerdMachine")
+		}
+	}
 
-	// TODO(user): your logic here
+	// Let kubeadm clean up after the node, and delete the Node, before its container is killed.
+	deleteCtx, cancel := withTimeout(ctx, r.Timeouts.Delete)
+	defer cancel()
+	if containerdMachine.Spec.Bootstrapped && cluster.DeletionTimestamp.IsZero() {
+		externalMachine.ResetKubeadm(deleteCtx)
+	}
 
+	// delete the machine
+	if err := externalMachine.Delete(deleteCtx); err != nil {
+		countContainerdError(cluster, operationDelete)
+		return ctrl.Result{}, errors.Wrap(err, "failed to delete ContainerdMachine")
+	}
+	if externalMachine.Exists() {
+		r.recorder.Eventf(containerdMachine, corev1.EventTypeNormal, containerDeletedReason, "Deleted container %s", externalMachine.ContainerName())
+	}
+
+	// Machine is deleted so remove the finalizer.
+	controllerutil.RemoveFinalizer(containerdMachine, infrastructurev1beta1.MachineFinalizer)
 	return ctrl.Result{}, nil
 }
 
+// waitForDeletionHook reports the deletion hooks of the ContainerdMachine with the annotation prefix
+// in the condition, and returns true while any of them is set.
+func waitForDeletionHook(containerdMachine *infrastructurev1beta1.ContainerdMachine, prefix string, condition clusterv1.ConditionType) bool {
+	switch {
+	case annotations.HasWithPrefix(prefix, containerdMachine.Annotations):
+		conditions.MarkFalse(containerdMachine, condition, clusterv1.WaitingExternalHookReason, clusterv1.ConditionSeverityInfo, "")
+		return true
+	case conditions.Has(containerdMachine, condition):
+		conditions.MarkTrue(containerdMachine, condition)
+	}
+	return false
+}
+
+// setContainerStatus records the ID and the state of the container hosting the machine, and whether
+// the image of the machine was pulled.
+func setContainerStatus(ctx context.Context, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) error {
+	if !externalMachine.Exists() {
+		containerdMachine.Status.ContainerID = ""
+		containerdMachine.Status.ContainerState = ""
+		return nil
+	}
+	state, err := externalMachine.State(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the machine container state")
+	}
+	// Containerd identifies the containers of a namespace by their name, and a container is only
+	// created once its image is pulled.
+	containerdMachine.Status.ContainerID = externalMachine.ContainerName()
+	containerdMachine.Status.ContainerState = state
+	containerdMachine.Status.ImagePulled = true
+	return nil
+}
+
+// setRestartCount records the number of times the machine container was restarted by the runtime restart monitor.
+func setRestartCount(ctx context.Context, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) error {
+	restartCount, err := externalMachine.RestartCount(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the machine restart count")
+	}
+	containerdMachine.Status.RestartCount = int32(restartCount)
+	return nil
+}
+
+// reconcileFrozen freezes or thaws the processes of the machine container according to the frozen annotation.
+func reconcileFrozen(ctx context.Context, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	frozen := containerdMachine.Annotations[infrastructurev1beta1.FrozenAnnotation] == "true"
+	paused, err := externalMachine.IsPaused(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case frozen && !paused:
+		log.Info("Freezing the machine container")
+		if err := externalMachine.Pause(ctx); err != nil {
+			return errors.Wrap(err, "failed to freeze the machine")
+		}
+	case !frozen && paused:
+		log.Info("Thawing the machine container")
+		if err := externalMachine.Resume(ctx); err != nil {
+			return errors.Wrap(err, "failed to thaw the machine")
+		}
+	}
+	containerdMachine.Status.Frozen = frozen
+	return nil
+}
+
+// resourceLimits returns the runtime resource limits of the machine resources.
+func resourceLimits(resources *infrastructurev1beta1.MachineResources) capc.ResourceLimits {
+	limits := capc.ResourceLimits{}
+	if resources.CPUs != nil {
+		limits.MilliCPUs = resources.CPUs.MilliValue()
+	}
+	if resources.Memory != nil {
+		limits.Memory = resources.Memory.Value()
+	}
+	if resources.Pids != nil {
+		limits.Pids = *resources.Pids
+	}
+	return limits
+}
+
+// deviceMappings returns the runtime device mappings of the machine devices.
+func deviceMappings(devices []infrastructurev1beta1.Device) []capc.DeviceMapping {
+	mappings := make([]capc.DeviceMapping, 0, len(devices))
+	for _, device := range devices {
+		mappings = append(mappings, capc.DeviceMapping{
+			HostPath:      device.HostPath,
+			ContainerPath: device.ContainerPath,
+			Permissions:   device.Permissions,
+		})
+	}
+	return mappings
+}
+
+// ulimits returns the runtime ulimits of the machine ulimits.
+func ulimits(machineUlimits []infrastructurev1beta1.Ulimit) []capc.Ulimit {
+	limits := make([]capc.Ulimit, 0, len(machineUlimits))
+	for _, ulimit := range machineUlimits {
+		hard := ulimit.Soft
+		if ulimit.Hard != nil {
+			hard = *ulimit.Hard
+		}
+		limits = append(limits, capc.Ulimit{Name: ulimit.Name, Soft: uint64(ulimit.Soft), Hard: uint64(hard)})
+	}
+	return limits
+}
+
+// staticAddress returns the runtime static address of the machine, an invalid IP is left to the
+// runtime to reject.
+func staticAddress(containerdMachine *infrastructurev1beta1.ContainerdMachine) capc.StaticAddress {
+	address := capc.StaticAddress{MAC: containerdMachine.Spec.MACAddress}
+	if containerdMachine.Spec.StaticIP != "" {
+		address.IPs = []net.IP{net.ParseIP(containerdMachine.Spec.StaticIP)}
+	}
+	return address
+}
+
+// hooks returns the runtime OCI hooks of the machine hooks.
+func hooks(machineHooks []infrastructurev1beta1.Hook) []capc.Hook {
+	hooks := make([]capc.Hook, 0, len(machineHooks))
+	for _, hook := range machineHooks {
+		h := capc.Hook{Path: hook.Path, Args: hook.Args, Env: hook.Env}
+		if hook.Timeout != nil {
+			h.Timeout = hook.Timeout.Duration
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks
+}
+
+// healthCheck returns the runtime health check of the machine health check.
+func healthCheck(check *infrastructurev1beta1.HealthCheck) capc.HealthCheck {
+	hc := capc.HealthCheck{
+		Exec:    check.Exec,
+		TCPPort: int(check.TCPPort),
+		Retries: int(check.Retries),
+	}
+	if check.Interval != nil {
+		hc.Interval = check.Interval.Duration
+	}
+	if check.Timeout != nil {
+		hc.Timeout = check.Timeout.Duration
+	}
+	if check.StartPeriod != nil {
+		hc.StartPeriod = check.StartPeriod.Duration
+	}
+	return hc
+}
+
+// setMachineHealthy sets the MachineHealthy condition from the health status of the machine
+// container, if it has a health check.
+func setMachineHealthy(ctx context.Context, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) error {
+	health, err := externalMachine.Health(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the machine health")
+	}
+	if health == nil {
+		return nil
+	}
+
+	switch health.Status {
+	case capc.HealthStarting:
+		conditions.MarkFalse(containerdMachine, infrastructurev1beta1.MachineHealthyCondition, infrastructurev1beta1.HealthCheckStartingReason,
+			clusterv1.ConditionSeverityInfo, "%s", health.String())
+	case capc.Unhealthy:
+		conditions.MarkFalse(containerdMachine, infrastructurev1beta1.MachineHealthyCondition, infrastructurev1beta1.HealthCheckFailedReason,
+			clusterv1.ConditionSeverityError, "%s", health.String())
+	default:
+		conditions.MarkTrue(containerdMachine, infrastructurev1beta1.MachineHealthyCondition)
+	}
+	return nil
+}
+
+// setNodeMetadata applies the node labels, annotations and taints of the machine to its node once, and
+// returns whether they are applied. The node may not have registered yet, failures are retried.
+func setNodeMetadata(ctx context.Context, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) bool {
+	log := ctrl.LoggerFrom(ctx)
+
+	spec := containerdMachine.Spec
+	if len(spec.NodeLabels) == 0 && len(spec.NodeAnnotations) == 0 && len(spec.NodeTaints) == 0 {
+		return true
+	}
+	if conditions.IsTrue(containerdMachine, infrastructurev1beta1.NodeMetadataAppliedCondition) {
+		return true
+	}
+
+	if err := externalMachine.SetNodeMetadata(ctx, spec.NodeLabels, spec.NodeAnnotations, spec.NodeTaints); err != nil {
+		log.V(4).Info("Failed to set the node metadata", "error", err.Error())
+		conditions.MarkFalse(containerdMachine, infrastructurev1beta1.NodeMetadataAppliedCondition, infrastructurev1beta1.WaitingForNodeReason,
+			clusterv1.ConditionSeverityInfo, "%s", err.Error())
+		return false
+	}
+	conditions.MarkTrue(containerdMachine, infrastructurev1beta1.NodeMetadataAppliedCondition)
+	return true
+}
+
+// drainNode drains the node of a deleted machine with a drain, and returns true once the node is drained
+// or its drain timeout expired, so that the machine container can be deleted.
+func drainNode(ctx context.Context, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) bool {
+	log := ctrl.LoggerFrom(ctx)
+
+	drain := containerdMachine.Spec.Drain
+	if drain == nil || !containerdMachine.Spec.Bootstrapped || !externalMachine.Exists() {
+		return true
+	}
+	if conditions.IsTrue(containerdMachine, infrastructurev1beta1.NodeDrainedCondition) ||
+		conditions.GetReason(containerdMachine, infrastructurev1beta1.NodeDrainedCondition) == infrastructurev1beta1.NodeDrainTimeoutReason {
+		return true
+	}
+
+	// The drain starts with the condition, its last transition time is when the drain started. The
+	// condition is left as is while the drain is retried, to keep that time.
+	if !conditions.Has(containerdMachine, infrastructurev1beta1.NodeDrainedCondition) {
+		conditions.MarkFalse(containerdMachine, infrastructurev1beta1.NodeDrainedCondition, clusterv1.DrainingReason, clusterv1.ConditionSeverityInfo, "")
+	}
+	if drain.Timeout != nil {
+		if started := conditions.GetLastTransitionTime(containerdMachine, infrastructurev1beta1.NodeDrainedCondition); started != nil && time.Since(started.Time) >= drain.Timeout.Duration {
+			log.Info("Node drain timed out, deleting the machine container anyway", "timeout", drain.Timeout.Duration.String())
+			conditions.MarkFalse(containerdMachine, infrastructurev1beta1.NodeDrainedCondition, infrastructurev1beta1.NodeDrainTimeoutReason,
+				clusterv1.ConditionSeverityWarning, "the node was not drained within %s", drain.Timeout.Duration.String())
+			return true
+		}
+	}
+
+	if err := externalMachine.DrainNode(ctx, drain.GracePeriodSeconds); err != nil {
+		log.Info("Failed to drain the node, retrying", "error", err.Error())
+		return false
+	}
+	conditions.MarkTrue(containerdMachine, infrastructurev1beta1.NodeDrainedCondition)
+	return true
+}
+
+// setResourceUsage refreshes the resource usage of the machine container if it is older than
+// resourceUsageInterval, and returns when it should be refreshed next. The usage changes on every
+// read, so it is not refreshed on every reconcile to not requeue the machine on its own status updates.
+func setResourceUsage(ctx context.Context, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) time.Duration {
+	log := ctrl.LoggerFrom(ctx)
+
+	if usage := containerdMachine.Status.ResourceUsage; usage != nil {
+		if age := time.Since(usage.LastUpdated.Time); age >= 0 && age < resourceUsageInterval {
+			return resourceUsageInterval - age
+		}
+	}
+
+	stats, err := externalMachine.Stats(ctx)
+	if err != nil {
+		// The machine container may be restarting, its usage is unknown until it runs again.
+		log.V(4).Info("Failed to get the machine resource usage", "error", err.Error())
+		containerdMachine.Status.ResourceUsage = nil
+		return resourceUsageInterval
+	}
+
+	usage := &infrastructurev1beta1.ResourceUsage{
+		CPU:         metav1.Duration{Duration: stats.CPUUsage},
+		Memory:      *resource.NewQuantity(int64(stats.MemoryWorkingSet), resource.BinarySI),
+		IORead:      *resource.NewQuantity(int64(stats.IOReadBytes), resource.BinarySI),
+		IOWrite:     *resource.NewQuantity(int64(stats.IOWriteBytes), resource.BinarySI),
+		Processes:   int64(stats.Processes),
+		LastUpdated: metav1.NewTime(stats.Timestamp),
+	}
+	if stats.MemoryLimit > 0 {
+		usage.MemoryLimit = resource.NewQuantity(int64(stats.MemoryLimit), resource.BinarySI)
+	}
+	if usage.LastUpdated.IsZero() {
+		usage.LastUpdated = metav1.Now()
+	}
+	containerdMachine.Status.ResourceUsage = usage
+	return resourceUsageInterval
+}
+
+// updateRegistryHosts writes the registry hosts configuration of the cluster, if any, into the
+// machine.
+func updateRegistryHosts(ctx context.Context, c client.Client, containerdCluster *infrastructurev1beta1.ContainerdCluster, externalMachine *containerd.Machine) error {
+	hosts, err := containerd.RegistryHosts(ctx, c, containerdCluster)
+	if err != nil {
+		return err
+	}
+	return externalMachine.UpdateRegistryHosts(ctx, hosts)
+}
+
+// updateKubeletCredentials writes the registry credentials of the cluster and of the given image pull
+// Secrets, if any, into the machine.
+func updateKubeletCredentials(ctx context.Context, c client.Client, containerdCluster *infrastructurev1beta1.ContainerdCluster, imagePullSecrets []corev1.LocalObjectReference, externalMachine *containerd.Machine) error {
+	creds, err := containerd.RegistryCredentials(ctx, c, containerdCluster, imagePullSecrets)
+	if err != nil {
+		return err
+	}
+	return externalMachine.UpdateKubeletCredentials(ctx, creds)
+}
+
+// setMachineAddresses sets the host name and the addresses of the machine, both the IPv4 and the IPv6
+// one on dual-stack networks.
+func setMachineAddresses(ctx context.Context, containerdMachine *infrastructurev1beta1.ContainerdMachine, externalMachine *containerd.Machine) error {
+	ipv4, ipv6, err := externalMachine.Addresses(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the machine addresses")
+	}
+
+	addresses := clusterv1.MachineAddresses{
+		{Type: clusterv1.MachineHostName, Address: externalMachine.ContainerName()},
+	}
+	for _, ip := range []string{ipv4, ipv6} {
+		if ip == "" {
+			continue
+		}
+		addresses = append(addresses,
+			clusterv1.MachineAddress{Type: clusterv1.MachineInternalIP, Address: ip},
+			clusterv1.MachineAddress{Type: clusterv1.MachineExternalIP, Address: ip},
+		)
+	}
+	containerdMachine.Status.Addresses = addresses
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ContainerdMachineReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&infrastructurev1alpha3.ContainerdMachine{}).
-		Complete(r)
+	// The ContainerdMachines are reconciled as soon as their Machine changes, e.g. when its bootstrap
+	// data is ready, and as soon as their Cluster is unpaused or its infrastructure gets ready.
+	clusterToContainerdMachines, err := util.ClusterToObjectsMapper(mgr.GetClient(), &infrastructurev1beta1.ContainerdMachineList{}, mgr.GetScheme())
+	if err != nil {
+		return errors.Wrap(err, "failed to create mapper for Cluster to ContainerdMachines")
+	}
+	r.recorder = mgr.GetEventRecorderFor("containerdmachine-controller")
+	if r.remoteClientGetter == nil {
+		r.remoteClientGetter = remote.NewClusterClient
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&infrastructurev1beta1.ContainerdMachine{}).
+		WithOptions(options).
+		Watches(
+			&source.Kind{Type: &clusterv1.Machine{}},
+			handler.EnqueueRequestsFromMapFunc(util.MachineToInfrastructureMapFunc(infrastructurev1beta1.GroupVersion.WithKind("ContainerdMachine"))),
+		).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(clusterToContainerdMachines),
+			builder.WithPredicates(predicates.ClusterUnpausedAndInfrastructureReady(ctrl.LoggerFrom(ctx))),
+		)
+
+	// Task exits, OOMs and deletions of the machine containers are reconciled as they happen rather
+	// than on the next resync, when the runtime publishes its container events.
+	var runtimes []capc.Runtime
+	for _, runtime := range r.runtimes() {
+		if runtime, ok := runtime.(capc.Runtime); ok {
+			runtimes = append(runtimes, runtime)
+		}
+	}
+	if len(runtimes) > 0 {
+		machineEvents := make(chan event.GenericEvent)
+		for _, runtime := range runtimes {
+			runtime := runtime
+			if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+				return r.forwardContainerEvents(ctx, runtime, machineEvents)
+			})); err != nil {
+				return errors.Wrap(err, "failed to set up container event forwarding")
+			}
+		}
+		b = b.Watches(&source.Channel{Source: machineEvents}, &handler.EnqueueRequestForObject{})
+	}
+	return b.Complete(r)
+}
+
+// runtimes returns the runtimes of all the hosts the machines can run on.
+func (r *ContainerdMachineReconciler) runtimes() []container.Runtime {
+	return hostRuntimes(r.ContainerRuntime, r.Hosts)
+}
+
+// OperationTimeouts bounds the operations on the container of a machine, each one if set.
+type OperationTimeouts struct {
+	// Pull bounds the pull of the image of a machine.
+	Pull time.Duration
+	// Create bounds the creation of the container of a machine.
+	Create time.Duration
+	// Bootstrap bounds the pre-load of the images into a machine, and separately its bootstrap.
+	Bootstrap time.Duration
+	// Delete bounds the deletion of a machine, including the reset of kubeadm.
+	Delete time.Duration
+}
+
+// withTimeout returns the context of an operation, e.g. a reconciliation or the bootstrap of a machine,
+// bounded by the timeout if set.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// hostRuntimes returns the runtimes of the hosts of the pool, or the given runtime without pool.
+func hostRuntimes(runtime container.Runtime, hosts *capc.HostPool) []container.Runtime {
+	if hosts == nil {
+		return []container.Runtime{runtime}
+	}
+	runtimes := []container.Runtime{}
+	for _, host := range hosts.Hosts() {
+		runtimes = append(runtimes, host.Runtime)
+	}
+	return runtimes
+}
+
+// forwardContainerEvents sends the ContainerdMachine hosted by the container of each task exit, OOM
+// and delete event to machineEvents, until the context is done.
+func (r *ContainerdMachineReconciler) forwardContainerEvents(ctx context.Context, runtime capc.Runtime, machineEvents chan<- event.GenericEvent) error {
+	log := ctrl.LoggerFrom(ctx).WithName("container-events")
+
+	containerEvents := runtime.SubscribeContainerEvents(ctx, containerdruntime.TaskExitEventTopic, containerdruntime.TaskOOMEventTopic, containerdruntime.TaskDeleteEventTopic)
+	for e := range containerEvents {
+		// The exits of execs, e.g. the bootstrap commands, do not change the machine.
+		if e.ExecID != "" {
+			continue
+		}
+		containerdMachine, err := r.machineForContainer(ctx, runtime, e.Namespace, e.Container)
+		if err != nil {
+			log.Error(err, "Failed to find the ContainerdMachine of the container", "namespace", e.Namespace, "container", e.Container, "topic", e.Topic)
+			continue
+		}
+		if containerdMachine == nil {
+			continue
+		}
+		select {
+		case machineEvents <- event.GenericEvent{Object: containerdMachine}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// machineForContainer returns the ContainerdMachine hosted by the given container of the containerd
+// namespace, nil if the container does not host one, e.g. a load balancer. The containers of
+// different clusters may have the same name in their own namespaces.
+func (r *ContainerdMachineReconciler) machineForContainer(ctx context.Context, runtime capc.Runtime, namespace, containerName string) (*infrastructurev1beta1.ContainerdMachine, error) {
+	containerdMachines := &infrastructurev1beta1.ContainerdMachineList{}
+	if err := r.Client.List(ctx, containerdMachines); err != nil {
+		return nil, errors.Wrap(err, "failed to list ContainerdMachines")
+	}
+	for i := range containerdMachines.Items {
+		containerdMachine := &containerdMachines.Items[i]
+		cluster := containerdMachine.Labels[clusterv1.ClusterLabelName]
+		if cluster == "" || runtime.ClusterNamespace(capc.ClusterInto(ctx, containerdMachine.Namespace, cluster)) != namespace {
+			continue
+		}
+		for _, ref := range containerdMachine.OwnerReferences {
+			if ref.Kind == "Machine" && containerd.MachineContainerName(cluster, ref.Name) == containerName {
+				return containerdMachine, nil
+			}
+		}
+	}
+	return nil, nil
 }
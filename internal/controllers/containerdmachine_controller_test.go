@@ -0,0 +1,486 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd"
+)
+
+// machineRuntime is a containerd runtime whose containers run no processes: the commands executed
+// in them are recorded and succeed, unless exec fails them. The operations it does not implement
+// are not used by the machines.
+type machineRuntime struct {
+	capc.Runtime
+	containers map[string]*capc.ContainerInfo
+	// execs are the commands executed in the containers, "<container>: <command> <args>".
+	execs []string
+	// exec returns the output of the command executed in the container, or its error.
+	exec    func(containerName, command string, args ...string) (string, error)
+	created []string
+	deleted []string
+}
+
+func newMachineRuntime(containers ...capc.ContainerInfo) *machineRuntime {
+	r := &machineRuntime{containers: map[string]*capc.ContainerInfo{}}
+	for i := range containers {
+		r.containers[containers[i].Name] = &containers[i]
+	}
+	return r
+}
+
+func (r *machineRuntime) RunContainer(ctx context.Context, runConfig *container.RunContainerInput, output io.Writer) error {
+	r.created = append(r.created, runConfig.Name)
+	r.containers[runConfig.Name] = &capc.ContainerInfo{
+		Name:   runConfig.Name,
+		Image:  runConfig.Image,
+		Labels: runConfig.Labels,
+		Status: "Up",
+		State:  "running",
+	}
+	return nil
+}
+
+func (r *machineRuntime) ListContainers(ctx context.Context, filters container.FilterBuilder) ([]container.Container, error) {
+	containers := []container.Container{}
+	for _, info := range r.containers {
+		if matchesFilters(info, filters) {
+			containers = append(containers, container.Container{Name: info.Name, Image: info.Image, Status: info.Status})
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	return containers, nil
+}
+
+// matchesFilters returns true if the container has the labels and name of the filters.
+func matchesFilters(info *capc.ContainerInfo, filters container.FilterBuilder) bool {
+	for key, values := range filters["label"] {
+		for _, value := range values {
+			labelValue, ok := info.Labels[key]
+			if !ok || (value != "" && labelValue != value) {
+				return false
+			}
+		}
+	}
+	for name := range filters["name"] {
+		if !regexp.MustCompile(name).MatchString(info.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *machineRuntime) InspectContainer(ctx context.Context, containerName string) (*capc.ContainerInfo, error) {
+	info, ok := r.containers[containerName]
+	if !ok {
+		return nil, errors.Errorf("container %q not found", containerName)
+	}
+	return info, nil
+}
+
+func (r *machineRuntime) ExecContainer(ctx context.Context, containerName string, config *container.ExecContainerInput, command string, args ...string) error {
+	r.execs = append(r.execs, fmt.Sprintf("%s: %s", containerName, strings.Join(append([]string{command}, args...), " ")))
+	if r.exec == nil {
+		return nil
+	}
+	output, err := r.exec(containerName, command, args...)
+	if config.OutputBuffer != nil {
+		fmt.Fprint(config.OutputBuffer, output)
+	}
+	return err
+}
+
+func (r *machineRuntime) GetContainerIPs(ctx context.Context, containerName string) (string, string, error) {
+	return "172.18.0.2", "", nil
+}
+
+func (r *machineRuntime) PauseContainer(ctx context.Context, containerName string) error {
+	r.containers[containerName].Paused = true
+	return nil
+}
+
+func (r *machineRuntime) ResumeContainer(ctx context.Context, containerName string) error {
+	r.containers[containerName].Paused = false
+	return nil
+}
+
+func (r *machineRuntime) DeleteContainer(ctx context.Context, containerName string) error {
+	r.deleted = append(r.deleted, containerName)
+	delete(r.containers, containerName)
+	return nil
+}
+
+// execsWith returns the recorded commands containing the given string.
+func (r *machineRuntime) execsWith(s string) []string {
+	var execs []string
+	for _, exec := range r.execs {
+		if strings.Contains(exec, s) {
+			execs = append(execs, exec)
+		}
+	}
+	return execs
+}
+
+// machineContainer returns the running container of the machine of the test cluster, with the labels
+// the machines are looked up by.
+func machineContainer(name, role string, labels map[string]string) capc.ContainerInfo {
+	containerLabels := map[string]string{
+		"io.x-k8s.capc.cluster.namespace": "default",
+		"io.x-k8s.capc.cluster.name":      "test",
+		"io.x-k8s.capc.machine.name":      name,
+		"io.x-k8s.capc.role":              role,
+	}
+	for key, value := range labels {
+		containerLabels[key] = value
+	}
+	return capc.ContainerInfo{Name: name, Labels: containerLabels, Status: "Up", State: "running"}
+}
+
+func TestImagePullReporter(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	containerdMachine := &infrastructurev1beta1.ContainerdMachine{}
+	patches := []string{}
+	reporter := &imagePullReporter{
+		containerdMachine: containerdMachine,
+		patch: func(ctx context.Context) error {
+			patches = append(patches, conditions.GetMessage(containerdMachine, infrastructurev1beta1.ImagePulledCondition))
+			return nil
+		},
+		interval: 10 * time.Second,
+		now:      func() time.Time { return now },
+	}
+	report := reporter.report(context.Background())
+
+	progress := func(layersDone int, bytesDone int64) capc.PullProgress {
+		return capc.PullProgress{
+			Image:       "docker.io/kindest/node:v1.24.0",
+			Status:      capc.PullStatusDownloading,
+			LayersDone:  layersDone,
+			LayersTotal: 4,
+			BytesDone:   bytesDone,
+			BytesTotal:  400000000,
+		}
+	}
+
+	// The first progress is patched into the condition.
+	report(progress(0, 1000000))
+	g.Expect(conditions.GetReason(containerdMachine, infrastructurev1beta1.ImagePulledCondition)).To(Equal(infrastructurev1beta1.ImagePullingReason))
+	g.Expect(patches).To(Equal([]string{"Pulling image docker.io/kindest/node:v1.24.0: 0/4 layers, 1MB/400MB"}))
+
+	// The progress reported within the interval is not.
+	now = now.Add(5 * time.Second)
+	report(progress(1, 100000000))
+	g.Expect(patches).To(HaveLen(1))
+
+	// The progress reported after the interval is.
+	now = now.Add(5 * time.Second)
+	report(progress(2, 200000000))
+	g.Expect(patches).To(Equal([]string{
+		"Pulling image docker.io/kindest/node:v1.24.0: 0/4 layers, 1MB/400MB",
+		"Pulling image docker.io/kindest/node:v1.24.0: 2/4 layers, 200MB/400MB",
+	}))
+
+	// The end of the pull is left to the reconciliation, which marks the condition true.
+	now = now.Add(time.Minute)
+	report(capc.PullProgress{Image: "docker.io/kindest/node:v1.24.0", Status: capc.PullStatusDone})
+	g.Expect(patches).To(HaveLen(2))
+}
+
+// deletedMachine returns the bootstrapped worker ContainerdMachine being deleted of the test cluster,
+// its container and the control plane one, from which its node is drained, with the helper managing it.
+func deletedMachine(g *WithT, ctx context.Context, cluster *clusterv1.Cluster) (*infrastructurev1beta1.ContainerdMachine, *containerd.Machine) {
+	now := metav1.Now()
+	containerdMachine := &infrastructurev1beta1.ContainerdMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "test-md-0-abc12",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{infrastructurev1beta1.MachineFinalizer},
+		},
+		Spec: infrastructurev1beta1.ContainerdMachineSpec{
+			Bootstrapped: true,
+			Drain:        &infrastructurev1beta1.NodeDrain{},
+		},
+	}
+	externalMachine, err := containerd.NewMachine(ctx, cluster, &infrastructurev1beta1.ContainerdCluster{}, containerdMachine.Name, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(externalMachine.Exists()).To(BeTrue())
+	return containerdMachine, externalMachine
+}
+
+// drainRuntime returns a runtime with the containers of the control plane machine and of the deleted
+// machine, whose node exists.
+func drainRuntime() *machineRuntime {
+	containerRuntime := newMachineRuntime(
+		machineContainer("test-control-plane-abc12", "control-plane", nil),
+		machineContainer("test-md-0-abc12", "worker", nil),
+	)
+	containerRuntime.exec = func(containerName, command string, args ...string) (string, error) {
+		if strings.Contains(strings.Join(args, " "), "get node test-md-0-abc12") {
+			return "node/test-md-0-abc12\n", nil
+		}
+		return "", nil
+	}
+	return containerRuntime
+}
+
+func TestContainerdMachineReconcileDeleteHooks(t *testing.T) {
+	g := NewWithT(t)
+
+	containerRuntime := drainRuntime()
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-md-0-abc12"}}
+	containerdMachine, externalMachine := deletedMachine(g, ctx, cluster)
+	containerdMachine.Annotations = map[string]string{
+		clusterv1.PreDrainDeleteHookAnnotationPrefix + "/move-workloads":     "",
+		clusterv1.PreTerminateDeleteHookAnnotationPrefix + "/detach-volumes": "",
+	}
+	r := &ContainerdMachineReconciler{recorder: record.NewFakeRecorder(10)}
+	drains := func() []string {
+		return containerRuntime.execsWith("kubectl --kubeconfig /etc/kubernetes/admin.conf drain")
+	}
+
+	// The pre-drain hook blocks the drain, and everything after it.
+	result, err := r.reconcileDelete(ctx, cluster, machine, nil, containerdMachine, externalMachine)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(conditions.IsFalse(containerdMachine, clusterv1.PreDrainDeleteHookSucceededCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(containerdMachine, clusterv1.PreDrainDeleteHookSucceededCondition)).To(Equal(clusterv1.WaitingExternalHookReason))
+	g.Expect(conditions.Has(containerdMachine, infrastructurev1beta1.NodeDrainedCondition)).To(BeFalse())
+	g.Expect(containerRuntime.execs).To(BeEmpty())
+	g.Expect(containerRuntime.deleted).To(BeEmpty())
+
+	// Once the pre-drain hook is removed, the node is drained, then the pre-terminate hook blocks the
+	// deletion of the container.
+	delete(containerdMachine.Annotations, clusterv1.PreDrainDeleteHookAnnotationPrefix+"/move-workloads")
+	result, err = r.reconcileDelete(ctx, cluster, machine, nil, containerdMachine, externalMachine)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(conditions.IsTrue(containerdMachine, clusterv1.PreDrainDeleteHookSucceededCondition)).To(BeTrue())
+	g.Expect(conditions.IsTrue(containerdMachine, infrastructurev1beta1.NodeDrainedCondition)).To(BeTrue())
+	g.Expect(drains()).To(HaveLen(1))
+	g.Expect(drains()[0]).To(HavePrefix("test-control-plane-abc12: kubectl --kubeconfig /etc/kubernetes/admin.conf drain test-md-0-abc12 "))
+	g.Expect(conditions.IsFalse(containerdMachine, clusterv1.PreTerminateDeleteHookSucceededCondition)).To(BeTrue())
+	g.Expect(containerRuntime.execsWith("kubeadm reset")).To(BeEmpty())
+	g.Expect(containerRuntime.deleted).To(BeEmpty())
+	g.Expect(containerdMachine.Finalizers).To(ContainElement(infrastructurev1beta1.MachineFinalizer))
+
+	// Once the pre-terminate hook is removed, kubeadm is reset and the container deleted, without
+	// draining the node again.
+	delete(containerdMachine.Annotations, clusterv1.PreTerminateDeleteHookAnnotationPrefix+"/detach-volumes")
+	result, err = r.reconcileDelete(ctx, cluster, machine, nil, containerdMachine, externalMachine)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(conditions.IsTrue(containerdMachine, clusterv1.PreTerminateDeleteHookSucceededCondition)).To(BeTrue())
+	g.Expect(drains()).To(HaveLen(1))
+	g.Expect(containerRuntime.execsWith("kubeadm reset")).To(ConsistOf("test-md-0-abc12: kubeadm reset --force"))
+	g.Expect(containerRuntime.deleted).To(ConsistOf("test-md-0-abc12"))
+	g.Expect(containerdMachine.Finalizers).To(BeEmpty())
+}
+
+func TestContainerdMachineReconcileDeleteDrain(t *testing.T) {
+	drainFailure := func(containerName, command string, args ...string) (string, error) {
+		cmd := strings.Join(args, " ")
+		switch {
+		case strings.Contains(cmd, "get node test-md-0-abc12"):
+			return "node/test-md-0-abc12\n", nil
+		case strings.Contains(cmd, "drain test-md-0-abc12"):
+			return "", errors.New("cannot evict pod as it would violate the pod's disruption budget")
+		}
+		return "", nil
+	}
+
+	tests := []struct {
+		name           string
+		exec           func(containerName, command string, args ...string) (string, error)
+		timeout        time.Duration
+		drainStarted   time.Duration
+		clusterDeleted bool
+		wantResult     ctrl.Result
+		wantDrains     int
+		wantDeleted    bool
+		wantReason     string
+	}{
+		{
+			name:        "drained node",
+			wantDrains:  1,
+			wantDeleted: true,
+		},
+		{
+			name:       "drain failing is retried before the container is deleted",
+			exec:       drainFailure,
+			wantResult: ctrl.Result{RequeueAfter: nodeDrainRetryInterval},
+			wantDrains: 1,
+			wantReason: clusterv1.DrainingReason,
+		},
+		{
+			name:         "drain failing within the timeout is retried",
+			exec:         drainFailure,
+			timeout:      time.Minute,
+			drainStarted: 30 * time.Second,
+			wantResult:   ctrl.Result{RequeueAfter: nodeDrainRetryInterval},
+			wantDrains:   1,
+			wantReason:   clusterv1.DrainingReason,
+		},
+		{
+			name:         "drain timed out",
+			exec:         drainFailure,
+			timeout:      time.Minute,
+			drainStarted: 2 * time.Minute,
+			wantDeleted:  true,
+			wantReason:   infrastructurev1beta1.NodeDrainTimeoutReason,
+		},
+		{
+			name:           "nodes of a deleted cluster are not drained",
+			exec:           drainFailure,
+			clusterDeleted: true,
+			wantDeleted:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			containerRuntime := drainRuntime()
+			if tt.exec != nil {
+				containerRuntime.exec = tt.exec
+			}
+			ctx := container.RuntimeInto(context.Background(), containerRuntime)
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+			if tt.clusterDeleted {
+				now := metav1.Now()
+				cluster.DeletionTimestamp = &now
+			}
+			machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-md-0-abc12"}}
+			containerdMachine, externalMachine := deletedMachine(g, ctx, cluster)
+			if tt.timeout > 0 {
+				containerdMachine.Spec.Drain.Timeout = &metav1.Duration{Duration: tt.timeout}
+			}
+			if tt.drainStarted > 0 {
+				conditions.Set(containerdMachine, &clusterv1.Condition{
+					Type:               infrastructurev1beta1.NodeDrainedCondition,
+					Status:             corev1.ConditionFalse,
+					Severity:           clusterv1.ConditionSeverityInfo,
+					Reason:             clusterv1.DrainingReason,
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-tt.drainStarted)),
+				})
+			}
+			r := &ContainerdMachineReconciler{recorder: record.NewFakeRecorder(10)}
+
+			result, err := r.reconcileDelete(ctx, cluster, machine, nil, containerdMachine, externalMachine)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.wantResult))
+			g.Expect(containerRuntime.execsWith(" drain test-md-0-abc12")).To(HaveLen(tt.wantDrains))
+			if tt.wantDeleted {
+				g.Expect(containerRuntime.deleted).To(ConsistOf("test-md-0-abc12"))
+			} else {
+				g.Expect(containerRuntime.deleted).To(BeEmpty())
+				g.Expect(containerRuntime.execsWith("kubeadm reset")).To(BeEmpty())
+			}
+			if tt.wantReason != "" {
+				g.Expect(conditions.GetReason(containerdMachine, infrastructurev1beta1.NodeDrainedCondition)).To(Equal(tt.wantReason))
+			}
+		})
+	}
+}
+
+func TestReconcileFrozen(t *testing.T) {
+	g := NewWithT(t)
+
+	containerRuntime := newMachineRuntime(machineContainer("test-md-0-abc12", "worker", nil))
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	externalMachine, err := containerd.NewMachine(ctx, cluster, &infrastructurev1beta1.ContainerdCluster{}, "test-md-0-abc12", nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	containerdMachine := &infrastructurev1beta1.ContainerdMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-md-0-abc12"}}
+
+	// Without the annotation, the container is left running.
+	g.Expect(reconcileFrozen(ctx, containerdMachine, externalMachine)).To(Succeed())
+	g.Expect(containerRuntime.containers["test-md-0-abc12"].Paused).To(BeFalse())
+	g.Expect(containerdMachine.Status.Frozen).To(BeFalse())
+
+	// The annotation freezes the container, whatever other value leaves it running.
+	containerdMachine.Annotations = map[string]string{infrastructurev1beta1.FrozenAnnotation: "yes"}
+	g.Expect(reconcileFrozen(ctx, containerdMachine, externalMachine)).To(Succeed())
+	g.Expect(containerRuntime.containers["test-md-0-abc12"].Paused).To(BeFalse())
+	containerdMachine.Annotations[infrastructurev1beta1.FrozenAnnotation] = "true"
+	g.Expect(reconcileFrozen(ctx, containerdMachine, externalMachine)).To(Succeed())
+	g.Expect(containerRuntime.containers["test-md-0-abc12"].Paused).To(BeTrue())
+	g.Expect(containerdMachine.Status.Frozen).To(BeTrue())
+
+	// Reconciling a frozen machine again leaves it frozen.
+	g.Expect(reconcileFrozen(ctx, containerdMachine, externalMachine)).To(Succeed())
+	g.Expect(containerRuntime.containers["test-md-0-abc12"].Paused).To(BeTrue())
+
+	// Removing the annotation thaws the container.
+	delete(containerdMachine.Annotations, infrastructurev1beta1.FrozenAnnotation)
+	g.Expect(reconcileFrozen(ctx, containerdMachine, externalMachine)).To(Succeed())
+	g.Expect(containerRuntime.containers["test-md-0-abc12"].Paused).To(BeFalse())
+	g.Expect(containerdMachine.Status.Frozen).To(BeFalse())
+}
+
+func TestContainerdMachineReconcileNormalDeletedContainer(t *testing.T) {
+	g := NewWithT(t)
+
+	containerRuntime := newMachineRuntime()
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-md-0-abc12"}}
+	providerID := "containerd:////test-md-0-abc12"
+	containerdMachine := &infrastructurev1beta1.ContainerdMachine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-md-0-abc12"},
+		Spec:       infrastructurev1beta1.ContainerdMachineSpec{ProviderID: &providerID},
+	}
+	conditions.MarkTrue(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition)
+	externalMachine, err := containerd.NewMachine(ctx, cluster, &infrastructurev1beta1.ContainerdCluster{}, containerdMachine.Name, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	recorder := record.NewFakeRecorder(10)
+	r := &ContainerdMachineReconciler{recorder: recorder}
+
+	// The deletion of the container of a provisioned machine is reported by the condition, and once
+	// by an event, however many times the machine is reconciled.
+	for i := 0; i < 3; i++ {
+		_, err := r.reconcileNormal(ctx, nil, cluster, machine, &infrastructurev1beta1.ContainerdCluster{}, containerdMachine, externalMachine)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(conditions.GetReason(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition)).To(Equal(infrastructurev1beta1.ContainerDeletedReason))
+	}
+	g.Expect(recorder.Events).To(HaveLen(1))
+	g.Expect(<-recorder.Events).To(Equal("Warning ContainerDeleted Container test-md-0-abc12 does not exist anymore"))
+}
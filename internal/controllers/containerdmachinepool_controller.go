@@ -0,0 +1,476 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	utilexp "sigs.k8s.io/cluster-api/exp/util"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd"
+)
+
+// instanceRequeueInterval is how often a pool is reconciled while some of its instances are not ready.
+const instanceRequeueInterval = 10 * time.Second
+
+// ContainerdMachinePoolReconciler reconciles a ContainerdMachinePool object. The instances of the
+// pools all run on ContainerRuntime, they are not scheduled onto a pool of containerd hosts.
+type ContainerdMachinePoolReconciler struct {
+	client.Client
+	Scheme           *runtime.Scheme
+	ContainerRuntime container.Runtime
+	// ReconcileTimeout bounds the operations of a reconciliation, if set. The patch of the reconciled
+	// object is not bounded, so that the progress of a reconciliation that timed out is recorded.
+	ReconcileTimeout time.Duration
+	// Timeouts bound the operations on the containers of the instances, within ReconcileTimeout.
+	Timeouts OperationTimeouts
+
+	// remoteClientGetter returns the client of the workload cluster the provider IDs of the nodes
+	// are set with.
+	remoteClientGetter remote.ClusterClientGetter
+}
+
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdmachinepools,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdmachinepools/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=containerdmachinepools/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinepools,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// Reconcile handles ContainerdMachinePool events: the pool keeps as many machine containers as the
+// replicas of its MachinePool, and bootstraps them as nodes of the cluster.
+func (r *ContainerdMachinePoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, rerr error) {
+	ctx, span := startReconcileSpan(ctx, "ContainerdMachinePool", req)
+	defer func() { endReconcileSpan(span, rerr) }()
+	log := ctrl.LoggerFrom(ctx)
+	ctx = container.RuntimeInto(ctx, r.ContainerRuntime)
+
+	// Fetch the ContainerdMachinePool instance.
+	containerdMachinePool := &infrastructurev1beta1.ContainerdMachinePool{}
+	if err := r.Client.Get(ctx, req.NamespacedName, containerdMachinePool); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// The rest of the reconciliation is bounded by the timeout, except the patch of the
+	// ContainerdMachinePool, so that the progress of a reconciliation that timed out is recorded.
+	patchCtx := ctx
+	ctx, cancel := withTimeout(ctx, r.ReconcileTimeout)
+	defer cancel()
+
+	// Fetch the MachinePool.
+	machinePool, err := utilexp.GetOwnerMachinePool(ctx, r.Client, containerdMachinePool.ObjectMeta)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if machinePool == nil {
+		log.Info("Waiting for MachinePool Controller to set OwnerRef on ContainerdMachinePool")
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("machine-pool", machinePool.Name)
+
+	// Fetch the Cluster.
+	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, machinePool.ObjectMeta)
+	if err != nil {
+		log.Info("ContainerdMachinePool owner MachinePool is missing cluster label or cluster does not exist")
+		return ctrl.Result{}, err
+	}
+	if cluster == nil {
+		log.Info(fmt.Sprintf("Please associate this machine pool with a cluster using the label %s: <name of cluster>", clusterv1.ClusterLabelName))
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("cluster", cluster.Name)
+
+	// Return early if the object or Cluster is paused.
+	if annotations.IsPaused(cluster, containerdMachinePool) {
+		log.Info("Reconciliation is paused for this object")
+		return ctrl.Result{}, nil
+	}
+
+	// Fetch the Containerd Cluster.
+	containerdCluster := &infrastructurev1beta1.ContainerdCluster{}
+	containerdClusterName := client.ObjectKey{
+		Namespace: containerdMachinePool.Namespace,
+		Name:      cluster.Spec.InfrastructureRef.Name,
+	}
+	if err := r.Client.Get(ctx, containerdClusterName, containerdCluster); err != nil {
+		log.Info("ContainerdCluster is not available yet")
+		return ctrl.Result{}, nil
+	}
+
+	log = log.WithValues("containerd-cluster", containerdCluster.Name)
+	ctx = ctrl.LoggerInto(ctx, log)
+	// The containers of the instances live in the containerd namespace of their cluster.
+	ctx = capc.ClusterInto(ctx, containerdCluster.Namespace, containerdCluster.Name)
+
+	// Initialize the patch helper
+	patchHelper, err := patch.NewHelper(containerdMachinePool, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Always attempt to Patch the ContainerdMachinePool object and status after each reconciliation.
+	defer func() {
+		if err := patchHelper.Patch(patchCtx, containerdMachinePool); err != nil {
+			log.Error(err, "failed to patch ContainerdMachinePool")
+			if rerr == nil {
+				rerr = err
+			}
+		}
+	}()
+
+	// Handle deleted machine pools
+	if !containerdMachinePool.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, cluster, containerdCluster, containerdMachinePool)
+	}
+
+	// Add finalizer first if not exist to avoid the race condition between init and delete
+	if !controllerutil.ContainsFinalizer(containerdMachinePool, infrastructurev1beta1.MachinePoolFinalizer) {
+		controllerutil.AddFinalizer(containerdMachinePool, infrastructurev1beta1.MachinePoolFinalizer)
+		return ctrl.Result{}, nil
+	}
+
+	// Check if the infrastructure is ready, otherwise return and wait for the cluster object to be updated
+	if !cluster.Status.InfrastructureReady {
+		log.Info("Waiting for ContainerdCluster Controller to create cluster infrastructure")
+		return ctrl.Result{}, nil
+	}
+
+	ctx, err = clusterRuntimeContext(ctx, r.Client, cluster, containerdCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if imagePullSecrets := containerdMachinePool.Spec.Template.ImagePullSecrets; len(imagePullSecrets) > 0 {
+		creds, err := containerd.RegistryCredentials(ctx, r.Client, containerdCluster, imagePullSecrets)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		ctx = capc.RegistryCredentialsInto(ctx, creds)
+	}
+
+	// Handle non-deleted machine pools
+	return r.reconcileNormal(ctx, cluster, machinePool, containerdCluster, containerdMachinePool)
+}
+
+func (r *ContainerdMachinePoolReconciler) reconcileNormal(ctx context.Context, cluster *clusterv1.Cluster, machinePool *expv1.MachinePool, containerdCluster *infrastructurev1beta1.ContainerdCluster, containerdMachinePool *infrastructurev1beta1.ContainerdMachinePool) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// Make sure bootstrap data is available and populated.
+	dataSecretName := machinePool.Spec.Template.Spec.Bootstrap.DataSecretName
+	if dataSecretName == nil {
+		log.Info("Waiting for the Bootstrap provider controller to set bootstrap data")
+		return ctrl.Result{}, nil
+	}
+	bootstrapData, format, err := getBootstrapData(ctx, r.Client, machinePool.Namespace, *dataSecretName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	replicas := int32(1)
+	if machinePool.Spec.Replicas != nil {
+		replicas = *machinePool.Spec.Replicas
+	}
+	version := machinePool.Spec.Template.Spec.Version
+
+	instances, err := r.scaleInstances(ctx, cluster, containerdCluster, containerdMachinePool, int(replicas), version)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The status of the instances is rebuilt from their containers, keeping what was recorded of
+	// the bootstrap of the instances that still exist.
+	previous := map[string]infrastructurev1beta1.ContainerdMachinePoolInstanceStatus{}
+	for _, instance := range containerdMachinePool.Status.Instances {
+		previous[instance.InstanceName] = instance
+	}
+	var statuses []infrastructurev1beta1.ContainerdMachinePoolInstanceStatus
+	var errs []error
+	for _, instance := range instances {
+		status, ok := previous[instance.Name()]
+		if !ok {
+			status = infrastructurev1beta1.ContainerdMachinePoolInstanceStatus{InstanceName: instance.Name(), Version: version}
+		}
+		if err := r.reconcileInstance(ctx, cluster, containerdCluster, containerdMachinePool, instance, &status, bootstrapData, format); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to reconcile instance %s", instance.Name()))
+		}
+		statuses = append(statuses, status)
+	}
+
+	containerdMachinePool.Status.Instances = statuses
+	containerdMachinePool.Status.Replicas = int32(len(statuses))
+	containerdMachinePool.Status.ObservedGeneration = containerdMachinePool.Generation
+	containerdMachinePool.Spec.ProviderIDList = instanceProviderIDs(statuses)
+	containerdMachinePool.Status.Ready = containerdMachinePool.Status.Replicas == replicas &&
+		int32(len(containerdMachinePool.Spec.ProviderIDList)) == replicas
+
+	if len(errs) > 0 {
+		return ctrl.Result{}, kerrors.NewAggregate(errs)
+	}
+	if !containerdMachinePool.Status.Ready {
+		return ctrl.Result{RequeueAfter: instanceRequeueInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// scaleInstances creates or deletes instances of the pool so that it has the given number of them,
+// and returns the instances left. The instances that are not bootstrapped yet are deleted first.
+func (r *ContainerdMachinePoolReconciler) scaleInstances(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster, containerdMachinePool *infrastructurev1beta1.ContainerdMachinePool, replicas int, version *string) ([]*containerd.Machine, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	poolLabels := map[string]string{containerd.MachinePoolLabelKey: containerdMachinePool.Name}
+	instances, err := containerd.ListMachinesByCluster(ctx, cluster, containerdCluster, poolLabels)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the instances of the ContainerdMachinePool")
+	}
+
+	if len(instances) > replicas {
+		bootstrapped := map[string]bool{}
+		for _, instance := range containerdMachinePool.Status.Instances {
+			bootstrapped[instance.InstanceName] = instance.Bootstrapped
+		}
+		sort.SliceStable(instances, func(i, j int) bool {
+			return !bootstrapped[instances[i].Name()] && bootstrapped[instances[j].Name()]
+		})
+		for _, instance := range instances[replicas:] {
+			log.Info("Deleting instance of the machine pool", "instance", instance.Name())
+			if err := r.deleteInstance(ctx, instance, bootstrapped[instance.Name()]); err != nil {
+				countContainerdError(cluster, operationDelete)
+				return nil, errors.Wrapf(err, "failed to delete instance %s", instance.Name())
+			}
+		}
+		instances = instances[:replicas]
+	}
+
+	template := containerdMachinePool.Spec.Template
+	if template.Resources != nil {
+		ctx = capc.ResourceLimitsInto(ctx, resourceLimits(template.Resources))
+	}
+	for len(instances) < replicas {
+		name := fmt.Sprintf("%s-%s", containerdMachinePool.Name, util.RandomString(6))
+		instance, err := containerd.NewMachine(ctx, cluster, containerdCluster, name, poolLabels)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create helper for managing instance %s", name)
+		}
+		log.Info("Creating instance of the machine pool", "instance", name)
+		createCtx, cancel := withTimeout(ctx, r.Timeouts.Create)
+		err = instance.Create(createCtx, template.CustomImage, constants.WorkerNodeRoleValue, version, poolLabels, template.ExtraMounts, nil)
+		cancel()
+		if err != nil {
+			countContainerdError(cluster, operationCreate)
+			return nil, errors.Wrapf(err, "failed to create instance %s", name)
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// reconcileInstance bootstraps an instance of the pool as a node of the cluster and sets the provider
+// ID of the node, recording the progress in the status of the instance.
+func (r *ContainerdMachinePoolReconciler) reconcileInstance(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster, containerdMachinePool *infrastructurev1beta1.ContainerdMachinePool, instance *containerd.Machine, status *infrastructurev1beta1.ContainerdMachinePoolInstanceStatus, bootstrapData string, format bootstrapv1.Format) error {
+	log := ctrl.LoggerFrom(ctx).WithValues("instance", instance.Name())
+
+	ipv4, ipv6, err := instance.Addresses(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the instance addresses")
+	}
+	status.Addresses = []clusterv1.MachineAddress{{Type: clusterv1.MachineHostName, Address: instance.ContainerName()}}
+	for _, ip := range []string{ipv4, ipv6} {
+		if ip != "" {
+			status.Addresses = append(status.Addresses,
+				clusterv1.MachineAddress{Type: clusterv1.MachineInternalIP, Address: ip},
+				clusterv1.MachineAddress{Type: clusterv1.MachineExternalIP, Address: ip},
+			)
+		}
+	}
+
+	if err := instance.UpdateHosts(ctx, containerdCluster.Spec.HostAliases); err != nil {
+		return errors.Wrap(err, "failed to update the hosts of the instance")
+	}
+	if err := updateRegistryHosts(ctx, r.Client, containerdCluster, instance); err != nil {
+		return errors.Wrap(err, "failed to update the registry hosts of the instance")
+	}
+	if err := updateKubeletCredentials(ctx, r.Client, containerdCluster, containerdMachinePool.Spec.Template.ImagePullSecrets, instance); err != nil {
+		return errors.Wrap(err, "failed to update the kubelet credentials of the instance")
+	}
+
+	if !status.Bootstrapped {
+		bootstrapCtx, cancel := withTimeout(ctx, r.Timeouts.Bootstrap)
+		err := r.bootstrapInstance(bootstrapCtx, cluster, containerdMachinePool, instance, bootstrapData, format)
+		cancel()
+		if err != nil {
+			return err
+		}
+		status.Bootstrapped = true
+	}
+
+	if status.ProviderID == nil {
+		// The node registers itself after the bootstrap, its provider ID is set on a later
+		// reconcile if it is not there yet.
+		workloadClient, err := r.remoteClientGetter(ctx, "containerdmachinepool-controller", r.Client, util.ObjectKey(cluster))
+		if err != nil {
+			return errors.Wrap(err, "failed to create a client to the workload cluster")
+		}
+		if err := instance.SetNodeProviderID(ctx, workloadClient); err != nil {
+			log.Info("Waiting for the node of the instance to set its provider ID", "error", err.Error())
+			return nil
+		}
+		providerID := instance.ProviderID()
+		status.ProviderID = &providerID
+	}
+	status.Ready = true
+	return nil
+}
+
+// bootstrapInstance pre-loads the images into an instance of the pool and runs its bootstrap data.
+func (r *ContainerdMachinePoolReconciler) bootstrapInstance(ctx context.Context, cluster *clusterv1.Cluster, containerdMachinePool *infrastructurev1beta1.ContainerdMachinePool, instance *containerd.Machine, bootstrapData string, format bootstrapv1.Format) error {
+	if images := containerdMachinePool.Spec.Template.PreLoadImages; len(images) > 0 {
+		if err := instance.PreloadLoadImages(ctx, images); err != nil {
+			return errors.Wrap(err, "failed to pre-load images into the instance")
+		}
+	}
+	// A bootstrap interrupted after it succeeded, e.g. by a restart of the controller, is not run again.
+	if instance.CheckForBootstrapSuccess(ctx) == nil {
+		return nil
+	}
+	start := time.Now()
+	if err := instance.ExecBootstrap(ctx, bootstrapData, format, containerd.KubeletConfig{}); err != nil {
+		if isContainerdError(err) {
+			countContainerdError(cluster, operationExec)
+		}
+		return errors.Wrap(err, "failed to exec the bootstrap of the instance")
+	}
+	if err := instance.CheckForBootstrapSuccess(ctx); err != nil {
+		return errors.Wrap(err, "failed to check the bootstrap of the instance")
+	}
+	observeBootstrap(cluster, start)
+	return nil
+}
+
+// deleteInstance deletes the container of an instance of the pool, letting kubeadm clean up after
+// the node first if it is bootstrapped.
+func (r *ContainerdMachinePoolReconciler) deleteInstance(ctx context.Context, instance *containerd.Machine, bootstrapped bool) error {
+	ctx, cancel := withTimeout(ctx, r.Timeouts.Delete)
+	defer cancel()
+	if bootstrapped {
+		instance.ResetKubeadm(ctx)
+	}
+	return instance.Delete(ctx)
+}
+
+// reconcileDelete deletes the containers of all the instances of the pool.
+func (r *ContainerdMachinePoolReconciler) reconcileDelete(ctx context.Context, cluster *clusterv1.Cluster, containerdCluster *infrastructurev1beta1.ContainerdCluster, containerdMachinePool *infrastructurev1beta1.ContainerdMachinePool) (ctrl.Result, error) {
+	instances, err := containerd.ListMachinesByCluster(ctx, cluster, containerdCluster, map[string]string{containerd.MachinePoolLabelKey: containerdMachinePool.Name})
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to list the instances of the ContainerdMachinePool")
+	}
+	for _, instance := range instances {
+		if err := r.deleteInstance(ctx, instance, false); err != nil {
+			countContainerdError(cluster, operationDelete)
+			return ctrl.Result{}, errors.Wrapf(err, "failed to delete instance %s", instance.Name())
+		}
+	}
+
+	// The instances are deleted so remove the finalizer.
+	controllerutil.RemoveFinalizer(containerdMachinePool, infrastructurev1beta1.MachinePoolFinalizer)
+	return ctrl.Result{}, nil
+}
+
+// getBootstrapData returns the base64 encoded bootstrap data of the secret with the given name, and
+// its format.
+func getBootstrapData(ctx context.Context, c client.Reader, namespace, name string) (string, bootstrapv1.Format, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+		return "", "", errors.Wrapf(err, "failed to retrieve bootstrap data secret %s", name)
+	}
+
+	value, ok := secret.Data["value"]
+	if !ok {
+		return "", "", errors.Errorf("bootstrap data secret %s has no value key", name)
+	}
+	format := bootstrapv1.Format(secret.Data["format"])
+	if format == "" {
+		format = bootstrapv1.CloudConfig
+	}
+	return base64.StdEncoding.EncodeToString(value), format, nil
+}
+
+// instanceProviderIDs returns the sorted provider IDs of the ready instances.
+func instanceProviderIDs(instances []infrastructurev1beta1.ContainerdMachinePoolInstanceStatus) []string {
+	var providerIDs []string
+	for _, instance := range instances {
+		if instance.Ready && instance.ProviderID != nil {
+			providerIDs = append(providerIDs, *instance.ProviderID)
+		}
+	}
+	sort.Strings(providerIDs)
+	return providerIDs
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ContainerdMachinePoolReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	if r.remoteClientGetter == nil {
+		r.remoteClientGetter = remote.NewClusterClient
+	}
+	clusterToContainerdMachinePools, err := util.ClusterToObjectsMapper(mgr.GetClient(), &infrastructurev1beta1.ContainerdMachinePoolList{}, mgr.GetScheme())
+	if err != nil {
+		return errors.Wrap(err, "failed to create mapper for Cluster to ContainerdMachinePools")
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrastructurev1beta1.ContainerdMachinePool{}).
+		WithOptions(options).
+		Watches(
+			&source.Kind{Type: &expv1.MachinePool{}},
+			handler.EnqueueRequestsFromMapFunc(utilexp.MachinePoolToInfrastructureMapFunc(
+				infrastructurev1beta1.GroupVersion.WithKind("ContainerdMachinePool"), ctrl.LoggerFrom(ctx))),
+		).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(clusterToContainerdMachinePools),
+			builder.WithPredicates(predicates.ClusterUnpausedAndInfrastructureReady(ctrl.LoggerFrom(ctx))),
+		).
+		Complete(r)
+}
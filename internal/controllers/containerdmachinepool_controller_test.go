@@ -0,0 +1,267 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+)
+
+func TestContainerdMachinePoolScaleInstances(t *testing.T) {
+	g := NewWithT(t)
+
+	poolLabels := map[string]string{"io.x-k8s.capc.machine.pool": "test-mp-0"}
+	containerRuntime := newMachineRuntime(
+		machineContainer("test-control-plane-abc12", "control-plane", nil),
+		machineContainer("test-mp-0-abc12", "worker", poolLabels),
+		machineContainer("test-mp-0-def34", "worker", poolLabels),
+	)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	containerdCluster := &infrastructurev1beta1.ContainerdCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	containerdMachinePool := &infrastructurev1beta1.ContainerdMachinePool{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-mp-0"},
+		Status: infrastructurev1beta1.ContainerdMachinePoolStatus{
+			Instances: []infrastructurev1beta1.ContainerdMachinePoolInstanceStatus{
+				{InstanceName: "test-mp-0-abc12", Bootstrapped: true},
+				{InstanceName: "test-mp-0-def34", Bootstrapped: true},
+			},
+		},
+	}
+	r := &ContainerdMachinePoolReconciler{}
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+
+	// Scaling down resets kubeadm on the deleted instance and deletes its Node, the bootstrap token
+	// the instances join with is shared with the other ones.
+	instances, err := r.scaleInstances(ctx, cluster, containerdCluster, containerdMachinePool, 1, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(instances).To(HaveLen(1))
+	g.Expect(containerRuntime.deleted).To(HaveLen(1))
+	deleted := containerRuntime.deleted[0]
+	g.Expect(containerRuntime.execsWith("kubeadm reset")).To(ConsistOf(deleted + ": kubeadm reset --force"))
+	g.Expect(containerRuntime.execsWith("kubectl")).To(ConsistOf(
+		"test-control-plane-abc12: kubectl --kubeconfig /etc/kubernetes/admin.conf delete node " + deleted + " --ignore-not-found",
+	))
+	g.Expect(containerRuntime.execsWith("bootstrap-token")).To(BeEmpty())
+	g.Expect(containerRuntime.execsWith("secret")).To(BeEmpty())
+
+	// Scaling up again creates a new instance, which joins with the same bootstrap data.
+	instances, err = r.scaleInstances(ctx, cluster, containerdCluster, containerdMachinePool, 2, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(instances).To(HaveLen(2))
+	g.Expect(containerRuntime.created).To(HaveLen(1))
+	g.Expect(containerRuntime.created[0]).To(HavePrefix("test-mp-0-"))
+	g.Expect(containerRuntime.containers[containerRuntime.created[0]].Labels).To(HaveKeyWithValue("io.x-k8s.capc.machine.pool", "test-mp-0"))
+	g.Expect(containerRuntime.deleted).To(HaveLen(1))
+}
+
+func TestContainerdMachinePoolReconcileNormal(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := testScheme(g)
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(expv1.AddToScheme(scheme)).To(Succeed())
+
+	// The instances are bootstrapped by running the commands of the bootstrap data, which write the
+	// bootstrap success sentinel.
+	bootstrapData := `#cloud-config
+runcmd:
+- kubeadm join --config /run/kubeadm/kubeadm-join-config.yaml
+- mkdir -p /run/cluster-api && echo success > /run/cluster-api/bootstrap-success.complete
+`
+	containerRuntime := newMachineRuntime()
+	bootstrapped := map[string]bool{}
+	containerRuntime.exec = func(containerName, command string, args ...string) (string, error) {
+		cmd := strings.Join(append([]string{command}, args...), " ")
+		switch {
+		case strings.Contains(cmd, "test -f /run/cluster-api/bootstrap-success.complete"):
+			if !bootstrapped[containerName] {
+				return "", errors.New("exit status 1")
+			}
+		case strings.Contains(cmd, "> /run/cluster-api/bootstrap-success.complete"):
+			bootstrapped[containerName] = true
+		}
+		return "", nil
+	}
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Status:     clusterv1.ClusterStatus{InfrastructureReady: true},
+	}
+	containerdCluster := &infrastructurev1beta1.ContainerdCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	replicas := int32(2)
+	machinePool := &expv1.MachinePool{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-mp-0"},
+		Spec: expv1.MachinePoolSpec{
+			Replicas: &replicas,
+			Template: clusterv1.MachineTemplateSpec{
+				Spec: clusterv1.MachineSpec{Bootstrap: clusterv1.Bootstrap{}},
+			},
+		},
+	}
+	containerdMachinePool := &infrastructurev1beta1.ContainerdMachinePool{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-mp-0"},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-mp-0-bootstrap"},
+			Data:       map[string][]byte{"value": []byte(bootstrapData)},
+		},
+	).Build()
+	workloadClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &ContainerdMachinePoolReconciler{
+		Client: c,
+		remoteClientGetter: func(ctx context.Context, sourceName string, c client.Client, cluster client.ObjectKey) (client.Client, error) {
+			return workloadClient, nil
+		},
+	}
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+
+	// Without bootstrap data, no instance is created.
+	result, err := r.reconcileNormal(ctx, cluster, machinePool, containerdCluster, containerdMachinePool)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(containerRuntime.created).To(BeEmpty())
+
+	// The instances are created and bootstrapped, the pool is not ready until their nodes register.
+	dataSecretName := "test-mp-0-bootstrap"
+	machinePool.Spec.Template.Spec.Bootstrap.DataSecretName = &dataSecretName
+	result, err = r.reconcileNormal(ctx, cluster, machinePool, containerdCluster, containerdMachinePool)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(instanceRequeueInterval))
+	g.Expect(containerRuntime.created).To(HaveLen(2))
+	g.Expect(containerRuntime.execsWith("kubeadm join")).To(HaveLen(2))
+	g.Expect(containerdMachinePool.Status.Replicas).To(Equal(int32(2)))
+	g.Expect(containerdMachinePool.Status.Ready).To(BeFalse())
+	g.Expect(containerdMachinePool.Spec.ProviderIDList).To(BeEmpty())
+	for _, instance := range containerdMachinePool.Status.Instances {
+		g.Expect(instance.Bootstrapped).To(BeTrue())
+		g.Expect(instance.Ready).To(BeFalse())
+	}
+
+	// Once their nodes register, their provider IDs are set and the pool is ready. The instances are
+	// not bootstrapped again.
+	for _, name := range containerRuntime.created {
+		g.Expect(workloadClient.Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})).To(Succeed())
+	}
+	result, err = r.reconcileNormal(ctx, cluster, machinePool, containerdCluster, containerdMachinePool)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(containerRuntime.execsWith("kubeadm join")).To(HaveLen(2))
+	g.Expect(containerdMachinePool.Status.Ready).To(BeTrue())
+	providerIDs := []string{}
+	for _, name := range containerRuntime.created {
+		providerIDs = append(providerIDs, "containerd:////"+name)
+		node := &corev1.Node{}
+		g.Expect(workloadClient.Get(ctx, client.ObjectKey{Name: name}, node)).To(Succeed())
+		g.Expect(node.Spec.ProviderID).To(Equal("containerd:////" + name))
+	}
+	g.Expect(containerdMachinePool.Spec.ProviderIDList).To(ConsistOf(providerIDs))
+
+	// Scaling the MachinePool down deletes an instance and removes it from the status.
+	replicas = 1
+	result, err = r.reconcileNormal(ctx, cluster, machinePool, containerdCluster, containerdMachinePool)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(containerRuntime.deleted).To(HaveLen(1))
+	g.Expect(containerdMachinePool.Status.Replicas).To(Equal(int32(1)))
+	g.Expect(containerdMachinePool.Status.Instances).To(HaveLen(1))
+	g.Expect(containerdMachinePool.Status.Instances[0].InstanceName).NotTo(Equal(containerRuntime.deleted[0]))
+	g.Expect(containerdMachinePool.Spec.ProviderIDList).To(Equal([]string{"containerd:////" + containerdMachinePool.Status.Instances[0].InstanceName}))
+	g.Expect(containerdMachinePool.Status.Ready).To(BeTrue())
+}
+
+func TestContainerdMachinePoolReconcileDelete(t *testing.T) {
+	g := NewWithT(t)
+
+	poolLabels := map[string]string{"io.x-k8s.capc.machine.pool": "test-mp-0"}
+	containerRuntime := newMachineRuntime(
+		machineContainer("test-md-0-abc12", "worker", nil),
+		machineContainer("test-mp-0-abc12", "worker", poolLabels),
+		machineContainer("test-mp-0-def34", "worker", poolLabels),
+		machineContainer("test-mp-1-abc12", "worker", map[string]string{"io.x-k8s.capc.machine.pool": "test-mp-1"}),
+	)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	containerdCluster := &infrastructurev1beta1.ContainerdCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	containerdMachinePool := &infrastructurev1beta1.ContainerdMachinePool{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "test-mp-0",
+			Finalizers: []string{infrastructurev1beta1.MachinePoolFinalizer},
+		},
+	}
+	r := &ContainerdMachinePoolReconciler{}
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+
+	// Only the instances of the pool are deleted, then the finalizer is removed.
+	result, err := r.reconcileDelete(ctx, cluster, containerdCluster, containerdMachinePool)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(containerRuntime.deleted).To(ConsistOf("test-mp-0-abc12", "test-mp-0-def34"))
+	g.Expect(containerdMachinePool.Finalizers).To(BeEmpty())
+}
+
+// deadlineRuntime is a machineRuntime recording the time left before the deadline of the context of
+// the deletions of containers, zero without deadline.
+type deadlineRuntime struct {
+	*machineRuntime
+	deleteDeadlines []time.Duration
+}
+
+func (r *deadlineRuntime) DeleteContainer(ctx context.Context, containerName string) error {
+	var left time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		left = time.Until(deadline)
+	}
+	r.deleteDeadlines = append(r.deleteDeadlines, left)
+	return r.machineRuntime.DeleteContainer(ctx, containerName)
+}
+
+func TestContainerdMachinePoolDeleteTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	poolLabels := map[string]string{"io.x-k8s.capc.machine.pool": "test-mp-0"}
+	containerRuntime := &deadlineRuntime{machineRuntime: newMachineRuntime(
+		machineContainer("test-mp-0-abc12", "worker", poolLabels),
+	)}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	containerdCluster := &infrastructurev1beta1.ContainerdCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	containerdMachinePool := &infrastructurev1beta1.ContainerdMachinePool{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-mp-0"}}
+	r := &ContainerdMachinePoolReconciler{Timeouts: OperationTimeouts{Delete: time.Minute}}
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+
+	// The deletion of the instances is bounded by the delete timeout.
+	_, err := r.reconcileDelete(ctx, cluster, containerdCluster, containerdMachinePool)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(containerRuntime.deleteDeadlines).To(HaveLen(1))
+	g.Expect(containerRuntime.deleteDeadlines[0]).To(BeNumerically(">", 0))
+	g.Expect(containerRuntime.deleteDeadlines[0]).To(BeNumerically("<=", time.Minute))
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd"
+)
+
+// machinesCollectTimeout bounds the time spent listing the ContainerdMachines on a scrape.
+const machinesCollectTimeout = 10 * time.Second
+
+// The phases the ContainerdMachines are counted by.
+const (
+	machinePhasePending       = "Pending"
+	machinePhaseProvisioning  = "Provisioning"
+	machinePhaseBootstrapping = "Bootstrapping"
+	machinePhaseRunning       = "Running"
+	machinePhaseFailed        = "Failed"
+	machinePhaseDeleting      = "Deleting"
+)
+
+// The containerd operations whose failures are counted.
+const (
+	operationPull   = "pull"
+	operationCreate = "create"
+	operationExec   = "exec"
+	operationDelete = "delete"
+)
+
+var (
+	clusterLabels = []string{"namespace", "cluster"}
+
+	machinesDesc = prometheus.NewDesc("capc_machines",
+		"Number of ContainerdMachines of the cluster, by phase.", append(clusterLabels, "phase"), nil)
+
+	bootstrapDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "capc_machine_bootstrap_duration_seconds",
+		Help:    "Time taken by the successful bootstraps of the machines of the cluster, from the start of the bootstrap commands.",
+		Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+	}, clusterLabels)
+	loadBalancerReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "capc_load_balancer_reloads_total",
+		Help: "Number of times the load balancer of the cluster was reloaded with a new configuration.",
+	}, clusterLabels)
+	containerdErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "capc_containerd_errors_total",
+		Help: "Number of containerd operations on the machines and load balancer of the cluster that failed, by operation: pull, create, exec or delete.",
+	}, append(clusterLabels, "operation"))
+)
+
+// RegisterMetrics registers the metrics of the reconciliations with the registerer, and a collector
+// of the ContainerdMachines read from the reader by phase.
+func RegisterMetrics(registerer prometheus.Registerer, reader client.Reader) error {
+	for _, collector := range []prometheus.Collector{bootstrapDuration, loadBalancerReloads, containerdErrors, &machinesCollector{reader: reader}} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeBootstrap records the duration of a successful bootstrap of a machine of the cluster
+// started at start.
+func observeBootstrap(cluster *clusterv1.Cluster, start time.Time) {
+	bootstrapDuration.WithLabelValues(cluster.Namespace, cluster.Name).Observe(time.Since(start).Seconds())
+}
+
+// countLoadBalancerReload counts a reload of the load balancer of the cluster.
+func countLoadBalancerReload(cluster *clusterv1.Cluster) {
+	loadBalancerReloads.WithLabelValues(cluster.Namespace, cluster.Name).Inc()
+}
+
+// countContainerdError counts a containerd operation on a container of the cluster that failed.
+func countContainerdError(cluster *clusterv1.Cluster, operation string) {
+	containerdErrors.WithLabelValues(cluster.Namespace, cluster.Name, operation).Inc()
+}
+
+// machinesCollector reports the number of ContainerdMachines of each cluster by phase on each
+// scrape, so that the machines of deleted clusters are not reported anymore.
+type machinesCollector struct {
+	reader client.Reader
+}
+
+func (m *machinesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- machinesDesc
+}
+
+func (m *machinesCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), machinesCollectTimeout)
+	defer cancel()
+
+	containerdMachines := &infrastructurev1beta1.ContainerdMachineList{}
+	if err := m.reader.List(ctx, containerdMachines); err != nil {
+		ch <- prometheus.NewInvalidMetric(machinesDesc, err)
+		return
+	}
+
+	type key struct {
+		namespace, cluster, phase string
+	}
+	counts := map[key]int{}
+	for i := range containerdMachines.Items {
+		containerdMachine := &containerdMachines.Items[i]
+		counts[key{containerdMachine.Namespace, containerdMachine.Labels[clusterv1.ClusterLabelName], machinePhase(containerdMachine)}]++
+	}
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(machinesDesc, prometheus.GaugeValue, float64(count), k.namespace, k.cluster, k.phase)
+	}
+}
+
+// machinePhase returns the phase of the ContainerdMachine in its lifecycle.
+func machinePhase(containerdMachine *infrastructurev1beta1.ContainerdMachine) string {
+	switch {
+	case !containerdMachine.DeletionTimestamp.IsZero():
+		return machinePhaseDeleting
+	case conditions.GetReason(containerdMachine, infrastructurev1beta1.ContainerProvisionedCondition) == infrastructurev1beta1.ContainerDeletedReason,
+		containerdMachine.Status.BootstrapExitCode != nil && *containerdMachine.Status.BootstrapExitCode != 0:
+		return machinePhaseFailed
+	case containerdMachine.Status.Ready:
+		return machinePhaseRunning
+	case containerdMachine.Status.ContainerID != "":
+		return machinePhaseBootstrapping
+	case containerdMachine.Status.ImagePulled || conditions.Has(containerdMachine, infrastructurev1beta1.ImagePulledCondition):
+		return machinePhaseProvisioning
+	default:
+		return machinePhasePending
+	}
+}
+
+// isContainerdError returns true if the error of a bootstrap is not the failure of a bootstrap command,
+// but of the exec of the commands in the container.
+func isContainerdError(err error) bool {
+	_, ok := containerd.BootstrapExitCode(err)
+	return !ok
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+)
+
+func exitCode(code int32) *int32 {
+	return &code
+}
+
+func TestMachinePhase(t *testing.T) {
+	now := metav1.Now()
+	deletedContainer := &infrastructurev1beta1.ContainerdMachine{}
+	conditions.MarkFalse(deletedContainer, infrastructurev1beta1.ContainerProvisionedCondition, infrastructurev1beta1.ContainerDeletedReason, clusterv1.ConditionSeverityError, "")
+	imagePullFailed := &infrastructurev1beta1.ContainerdMachine{}
+	conditions.MarkFalse(imagePullFailed, infrastructurev1beta1.ImagePulledCondition, infrastructurev1beta1.ImagePullFailedReason, clusterv1.ConditionSeverityWarning, "")
+
+	tests := []struct {
+		name              string
+		containerdMachine *infrastructurev1beta1.ContainerdMachine
+		want              string
+	}{
+		{
+			name:              "new",
+			containerdMachine: &infrastructurev1beta1.ContainerdMachine{},
+			want:              machinePhasePending,
+		},
+		{
+			name:              "image pull failed",
+			containerdMachine: imagePullFailed,
+			want:              machinePhaseProvisioning,
+		},
+		{
+			name: "image pulled",
+			containerdMachine: &infrastructurev1beta1.ContainerdMachine{
+				Status: infrastructurev1beta1.ContainerdMachineStatus{ImagePulled: true},
+			},
+			want: machinePhaseProvisioning,
+		},
+		{
+			name: "container created",
+			containerdMachine: &infrastructurev1beta1.ContainerdMachine{
+				Status: infrastructurev1beta1.ContainerdMachineStatus{ImagePulled: true, ContainerID: "test-md-0-abc12"},
+			},
+			want: machinePhaseBootstrapping,
+		},
+		{
+			name: "ready",
+			containerdMachine: &infrastructurev1beta1.ContainerdMachine{
+				Status: infrastructurev1beta1.ContainerdMachineStatus{ContainerID: "test-md-0-abc12", Ready: true, BootstrapExitCode: exitCode(0)},
+			},
+			want: machinePhaseRunning,
+		},
+		{
+			name: "bootstrap failed",
+			containerdMachine: &infrastructurev1beta1.ContainerdMachine{
+				Status: infrastructurev1beta1.ContainerdMachineStatus{ContainerID: "test-md-0-abc12", BootstrapExitCode: exitCode(1)},
+			},
+			want: machinePhaseFailed,
+		},
+		{
+			name:              "container deleted",
+			containerdMachine: deletedContainer,
+			want:              machinePhaseFailed,
+		},
+		{
+			name: "deleting",
+			containerdMachine: &infrastructurev1beta1.ContainerdMachine{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Status:     infrastructurev1beta1.ContainerdMachineStatus{Ready: true, BootstrapExitCode: exitCode(1)},
+			},
+			want: machinePhaseDeleting,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(machinePhase(tt.containerdMachine)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestMachinesCollector(t *testing.T) {
+	g := NewWithT(t)
+
+	containerdMachine := func(namespace, cluster, name string, status infrastructurev1beta1.ContainerdMachineStatus) client.Object {
+		return &infrastructurev1beta1.ContainerdMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels:    map[string]string{clusterv1.ClusterLabelName: cluster},
+			},
+			Status: status,
+		}
+	}
+	reader := fake.NewClientBuilder().WithScheme(testScheme(g)).WithObjects(
+		containerdMachine("default", "test", "test-md-0-abc12", infrastructurev1beta1.ContainerdMachineStatus{Ready: true}),
+		containerdMachine("default", "test", "test-md-0-def34", infrastructurev1beta1.ContainerdMachineStatus{Ready: true}),
+		containerdMachine("default", "test", "test-md-0-ghi56", infrastructurev1beta1.ContainerdMachineStatus{ContainerID: "test-md-0-ghi56", BootstrapExitCode: exitCode(2)}),
+		containerdMachine("default", "other", "other-md-0-abc12", infrastructurev1beta1.ContainerdMachineStatus{}),
+		containerdMachine("team-a", "test", "test-md-0-abc12", infrastructurev1beta1.ContainerdMachineStatus{ContainerID: "test-md-0-abc12"}),
+	).Build()
+
+	g.Expect(testutil.CollectAndCompare(&machinesCollector{reader: reader}, strings.NewReader(`
+# HELP capc_machines Number of ContainerdMachines of the cluster, by phase.
+# TYPE capc_machines gauge
+capc_machines{cluster="other",namespace="default",phase="Pending"} 1
+capc_machines{cluster="test",namespace="default",phase="Failed"} 1
+capc_machines{cluster="test",namespace="default",phase="Running"} 2
+capc_machines{cluster="test",namespace="team-a",phase="Bootstrapping"} 1
+`), "capc_machines")).To(Succeed())
+}
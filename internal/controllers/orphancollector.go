@@ -0,0 +1,134 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd"
+)
+
+// OrphanCollector deletes the machine and load balancer containers of a containerd host whose objects
+// no longer exist, e.g. the leftovers of a controller that crashed while creating a machine or of an
+// interrupted deletion.
+type OrphanCollector struct {
+	// APIReader reads the objects of the containers without caching them, so that a container is
+	// not deleted because of a stale cache.
+	APIReader        client.Reader
+	ContainerRuntime capc.Runtime
+	// Host is the name of the containerd host of the runtime, in the logs.
+	Host string
+	// Interval is the time between two collections. The containers younger than it are kept, their
+	// objects may not be readable yet.
+	Interval time.Duration
+}
+
+// SetupWithManager runs the collector once the manager is elected leader.
+func (c *OrphanCollector) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(c)
+}
+
+// Start collects the orphaned containers every interval until the context is cancelled.
+func (c *OrphanCollector) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("orphan-gc").WithValues("host", c.Host)
+	ctx = container.RuntimeInto(ctrl.LoggerInto(ctx, log), c.ContainerRuntime)
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Collect(ctx); err != nil {
+				log.Error(err, "Failed to garbage collect orphaned containers")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Collect deletes the containers of all the containerd namespaces of the runtime older than the
+// interval whose Cluster, or whose Machine and ContainerdMachine or ContainerdMachinePool, no longer
+// exist.
+func (c *OrphanCollector) Collect(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	containers, err := containerd.ListProviderContainers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, cntr := range containers {
+		if time.Since(cntr.CreatedAt) < c.Interval {
+			continue
+		}
+		orphaned, err := c.isOrphaned(ctx, cntr)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the objects of container %q of namespace %q", cntr.Name, cntr.Namespace)
+		}
+		if !orphaned {
+			continue
+		}
+		log.Info("Deleting orphaned container", "namespace", cntr.Namespace, "container", cntr.Name, "cluster", cntr.ClusterNamespace+"/"+cntr.ClusterName)
+		if err := containerd.DeleteProviderContainer(ctx, cntr.Namespace, cntr.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isOrphaned returns true if an object the container was created for no longer exists.
+func (c *OrphanCollector) isOrphaned(ctx context.Context, cntr containerd.ProviderContainer) (bool, error) {
+	key := client.ObjectKey{Namespace: cntr.ClusterNamespace, Name: cntr.ClusterName}
+	if err := c.APIReader.Get(ctx, key, &clusterv1.Cluster{}); err != nil {
+		return apierrors.IsNotFound(err), client.IgnoreNotFound(err)
+	}
+
+	switch {
+	case cntr.IsLoadBalancer():
+		return false, nil
+	case cntr.MachinePool != "":
+		key := client.ObjectKey{Namespace: cntr.ClusterNamespace, Name: cntr.MachinePool}
+		if err := c.APIReader.Get(ctx, key, &infrastructurev1beta1.ContainerdMachinePool{}); err != nil {
+			return apierrors.IsNotFound(err), client.IgnoreNotFound(err)
+		}
+		return false, nil
+	}
+
+	machine := &clusterv1.Machine{}
+	if err := c.APIReader.Get(ctx, client.ObjectKey{Namespace: cntr.ClusterNamespace, Name: cntr.Machine}, machine); err != nil {
+		return apierrors.IsNotFound(err), client.IgnoreNotFound(err)
+	}
+	ref := machine.Spec.InfrastructureRef
+	if ref.Kind != "ContainerdMachine" {
+		return false, nil
+	}
+	key = client.ObjectKey{Namespace: machine.Namespace, Name: ref.Name}
+	if err := c.APIReader.Get(ctx, key, &infrastructurev1beta1.ContainerdMachine{}); err != nil {
+		return apierrors.IsNotFound(err), client.IgnoreNotFound(err)
+	}
+	return false, nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/namespaces"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd"
+)
+
+// orphanRuntime is a containerd runtime with the containers of its namespaces. The container
+// operations it does not implement are those of container.FakeRuntime.
+type orphanRuntime struct {
+	capc.Runtime
+	fake       *container.FakeRuntime
+	containers map[string][]capc.ContainerInfo
+	deleted    []string
+}
+
+func (r *orphanRuntime) ListNamespaces(ctx context.Context) ([]string, error) {
+	names := []string{}
+	for namespace := range r.containers {
+		names = append(names, namespace)
+	}
+	return names, nil
+}
+
+func (r *orphanRuntime) ListContainers(ctx context.Context, filters container.FilterBuilder) ([]container.Container, error) {
+	namespace, _ := namespaces.Namespace(ctx)
+	containers := []container.Container{}
+	for _, info := range r.containers[namespace] {
+		containers = append(containers, container.Container{Name: info.Name})
+	}
+	return containers, nil
+}
+
+func (r *orphanRuntime) InspectContainer(ctx context.Context, containerName string) (*capc.ContainerInfo, error) {
+	namespace, _ := namespaces.Namespace(ctx)
+	for _, info := range r.containers[namespace] {
+		if info.Name == containerName {
+			info := info
+			return &info, nil
+		}
+	}
+	return nil, errors.Errorf("container %q not found", containerName)
+}
+
+func (r *orphanRuntime) DeleteContainer(ctx context.Context, containerName string) error {
+	namespace, _ := namespaces.Namespace(ctx)
+	r.deleted = append(r.deleted, namespace+"/"+containerName)
+	return r.fake.DeleteContainer(ctx, containerName)
+}
+
+func testScheme(g *WithT) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrastructurev1beta1.AddToScheme(scheme)).To(Succeed())
+	return scheme
+}
+
+func orphanObjects() []client.Object {
+	machine := func(name string, ref corev1.ObjectReference) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       clusterv1.MachineSpec{ClusterName: "test", InfrastructureRef: ref},
+		}
+	}
+	return []client.Object{
+		&clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}},
+		machine("test-md-0-abc12", corev1.ObjectReference{Kind: "ContainerdMachine", Name: "test-md-0-def34"}),
+		machine("test-md-0-ghi56", corev1.ObjectReference{Kind: "ContainerdMachine", Name: "test-md-0-jkl78"}),
+		machine("test-other-abc12", corev1.ObjectReference{Kind: "DockerMachine", Name: "test-other-abc12"}),
+		&infrastructurev1beta1.ContainerdMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-md-0-def34"}},
+		&infrastructurev1beta1.ContainerdMachinePool{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-mp-0"}},
+	}
+}
+
+func TestOrphanCollectorIsOrphaned(t *testing.T) {
+	tests := []struct {
+		name      string
+		container containerd.ProviderContainer
+		want      bool
+	}{
+		{
+			name:      "load balancer",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "test"},
+		},
+		{
+			name:      "load balancer of a deleted cluster",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "deleted"},
+			want:      true,
+		},
+		{
+			name:      "machine",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "test", Machine: "test-md-0-abc12"},
+		},
+		{
+			name:      "machine of a deleted cluster",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "deleted", Machine: "test-md-0-abc12"},
+			want:      true,
+		},
+		{
+			name:      "deleted machine",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "test", Machine: "test-md-0-mno90"},
+			want:      true,
+		},
+		{
+			name:      "deleted ContainerdMachine",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "test", Machine: "test-md-0-ghi56"},
+			want:      true,
+		},
+		{
+			name:      "machine of another provider",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "test", Machine: "test-other-abc12"},
+		},
+		{
+			name:      "machine pool instance",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "test", Machine: "test-mp-0-abc12", MachinePool: "test-mp-0"},
+		},
+		{
+			name:      "instance of a deleted machine pool",
+			container: containerd.ProviderContainer{ClusterNamespace: "default", ClusterName: "test", Machine: "test-mp-1-abc12", MachinePool: "test-mp-1"},
+			want:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := &OrphanCollector{
+				APIReader: fake.NewClientBuilder().WithScheme(testScheme(g)).WithObjects(orphanObjects()...).Build(),
+			}
+			orphaned, err := c.isOrphaned(context.Background(), tt.container)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(orphaned).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestOrphanCollectorCollect(t *testing.T) {
+	g := NewWithT(t)
+
+	old := time.Now().Add(-time.Hour)
+	labels := func(namespace, machine string) map[string]string {
+		return map[string]string{
+			"io.x-k8s.capc.cluster.namespace": namespace,
+			"io.x-k8s.capc.cluster.name":      "test",
+			"io.x-k8s.capc.machine.name":      machine,
+		}
+	}
+	containerRuntime := &orphanRuntime{
+		fake: &container.FakeRuntime{},
+		containers: map[string][]capc.ContainerInfo{
+			"capc": {},
+			// The containers of different clusters have the same names in their own namespaces.
+			"capc.default.test": {
+				{Name: "test-lb", Labels: labels("default", ""), CreatedAt: old},
+				{Name: "test-md-0-abc12", Labels: labels("default", "test-md-0-abc12"), CreatedAt: old},
+				{Name: "test-md-0-ghi56", Labels: labels("default", "test-md-0-ghi56"), CreatedAt: old},
+				{Name: "test-md-0-mno90", Labels: labels("default", "test-md-0-mno90"), CreatedAt: time.Now()},
+			},
+			"capc.other.test": {
+				{Name: "test-lb", Labels: labels("other", ""), CreatedAt: old},
+				{Name: "test-md-0-abc12", Labels: labels("other", "test-md-0-abc12"), CreatedAt: old},
+			},
+		},
+	}
+	c := &OrphanCollector{
+		APIReader: fake.NewClientBuilder().WithScheme(testScheme(g)).WithObjects(orphanObjects()...).Build(),
+		Interval:  time.Minute,
+	}
+
+	ctx := container.RuntimeInto(context.Background(), containerRuntime)
+	g.Expect(c.Collect(ctx)).To(Succeed())
+
+	// The containers younger than the interval are kept, their objects may not be readable yet.
+	g.Expect(containerRuntime.deleted).To(ConsistOf(
+		"capc.default.test/test-md-0-ghi56",
+		"capc.other.test/test-lb",
+		"capc.other.test/test-md-0-abc12",
+	))
+}
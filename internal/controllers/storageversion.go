@@ -0,0 +1,94 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
+)
+
+// StorageVersionMigrator migrates the stored ContainerdClusters and ContainerdMachines to the storage
+// version of their CRDs, v1beta1, so that the older versions can be removed from the CRDs.
+type StorageVersionMigrator struct {
+	Client client.Client
+	// APIReader reads the CRDs and the objects migrated without caching them.
+	APIReader client.Reader
+}
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update;patch
+
+// SetupWithManager runs the migration once the manager is elected leader.
+func (m *StorageVersionMigrator) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(m)
+}
+
+// Start migrates the objects of the CRDs still storing other versions than the storage version: every
+// object is rewritten, which stores it in the storage version, and the other versions are removed from
+// the stored versions of the CRD.
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("storage-version-migrator")
+
+	migrations := []struct {
+		crd  string
+		list client.ObjectList
+	}{
+		{crd: "containerdclusters." + infrastructurev1beta1.GroupVersion.Group, list: &infrastructurev1beta1.ContainerdClusterList{}},
+		{crd: "containerdmachines." + infrastructurev1beta1.GroupVersion.Group, list: &infrastructurev1beta1.ContainerdMachineList{}},
+	}
+	version := infrastructurev1beta1.GroupVersion.Version
+	for _, migration := range migrations {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := m.APIReader.Get(ctx, client.ObjectKey{Name: migration.crd}, crd); err != nil {
+			return errors.Wrapf(err, "failed to get CRD %s", migration.crd)
+		}
+		if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == version {
+			continue
+		}
+
+		log.Info("Migrating objects to the storage version", "crd", crd.Name, "storedVersions", crd.Status.StoredVersions, "version", version)
+		if err := m.APIReader.List(ctx, migration.list); err != nil {
+			return errors.Wrapf(err, "failed to list %s", crd.Spec.Names.Plural)
+		}
+		items, err := meta.ExtractList(migration.list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			// An update without changes is enough for the API server to store the object in the storage
+			// version, an object updated or deleted meanwhile does not need it.
+			obj := item.(client.Object)
+			if err := m.Client.Update(ctx, obj); err != nil && !apierrors.IsConflict(err) && !apierrors.IsNotFound(err) {
+				return errors.Wrapf(err, "failed to migrate %s %s", crd.Spec.Names.Kind, client.ObjectKeyFromObject(obj))
+			}
+		}
+
+		crd.Status.StoredVersions = []string{version}
+		if err := m.Client.Status().Update(ctx, crd); err != nil {
+			return errors.Wrapf(err, "failed to update stored versions of CRD %s", crd.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// tracer records the spans of the reconciliations, the parents of the spans of the container runtime
+// operations they make.
+var tracer = otel.Tracer("github.com/raminenia/cluster-api-provider-containerd/internal/controllers")
+
+// startReconcileSpan starts the span of the reconciliation of the object of the given kind.
+func startReconcileSpan(ctx context.Context, kind string, req ctrl.Request) (context.Context, trace.Span) {
+	return tracer.Start(ctx, kind+".Reconcile", trace.WithAttributes(
+		semconv.K8SNamespaceNameKey.String(req.Namespace),
+		attribute.String("k8s.object.kind", kind),
+		attribute.String("k8s.object.name", req.Name),
+	))
+}
+
+// endReconcileSpan ends the span of a reconciliation, recording the error it failed with.
+func endReconcileSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeimage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/cluster-api/test/infrastructure/container"
+
+	capc "github.com/raminenia/cluster-api-provider-containerd/container"
+)
+
+const (
+	// buildContainerPrefix prefixes the names of the containers the images are built in.
+	buildContainerPrefix = "capc-nodeimage-"
+
+	// containerdStartTimeout is how long the containerd of the build container has to start.
+	containerdStartTimeout = 30 * time.Second
+)
+
+// Builder builds node images in the containerd of a runtime.
+type Builder struct {
+	// Runtime is the runtime the images are built with, in its namespace, where the machines of all
+	// its clusters can use them.
+	Runtime capc.Runtime
+	// Stdout and Stderr receive the output of the build steps, discarded if nil.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Build builds the image of the recipe. The base image is run in a build container on the host
+// network, the packages are installed in it, the images are imported into its containerd, and its
+// changes are committed as the image of the recipe. The build container is deleted afterwards.
+func (b *Builder) Build(ctx context.Context, recipe *Recipe) (rerr error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	if err := recipe.Validate(); err != nil {
+		return err
+	}
+
+	name := buildContainerPrefix + rand.String(6)
+	log.Info("Starting build container", "container", name, "baseImage", recipe.BaseImage)
+	if err := b.Runtime.RunContainer(ctx, &container.RunContainerInput{
+		Name:  name,
+		Image: recipe.BaseImage,
+		// Keep the container up without booting the node.
+		Entrypoint:  []string{"sleep"},
+		CommandArgs: []string{"infinity"},
+		// apt-get needs to reach the package repositories.
+		Network: "host",
+		Tmpfs: map[string]string{
+			"/tmp": "",
+			"/run": "",
+		},
+	}, nil); err != nil {
+		return errors.Wrapf(err, "failed to run build container from image %q", recipe.BaseImage)
+	}
+	defer func() {
+		if err := b.Runtime.DeleteContainer(ctx, name); err != nil && rerr == nil {
+			rerr = errors.Wrapf(err, "failed to delete build container %q", name)
+		}
+	}()
+
+	if len(recipe.Packages) > 0 {
+		log.Info("Installing packages", "packages", recipe.Packages)
+		if err := b.installPackages(ctx, name, recipe.Packages); err != nil {
+			return err
+		}
+	}
+
+	if len(recipe.Images) > 0 {
+		log.Info("Preloading images", "images", recipe.Images)
+		if err := b.preloadImages(ctx, name, recipe.Images); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Committing image", "image", recipe.Image)
+	return errors.Wrapf(b.Runtime.CommitContainer(ctx, name, recipe.Image), "failed to commit image %q", recipe.Image)
+}
+
+// installPackages installs the Debian packages in the build container, without leaving the package
+// lists behind.
+func (b *Builder) installPackages(ctx context.Context, name string, packages []string) error {
+	script := fmt.Sprintf("apt-get update && apt-get install -y --no-install-recommends %s && apt-get clean && rm -rf /var/lib/apt/lists/*",
+		strings.Join(packages, " "))
+	err := b.exec(ctx, name, nil, []string{"DEBIAN_FRONTEND=noninteractive"}, "bash", "-c", script)
+	return errors.Wrap(err, "failed to install packages")
+}
+
+// preloadImages imports the images, pulled on the host if needed, into the containerd of the build
+// container. The images are not unpacked, as the snapshotter of the node cannot run on the layers of
+// the build container; the nodes unpack them on first use.
+func (b *Builder) preloadImages(ctx context.Context, name string, images []string) error {
+	for _, image := range images {
+		if err := b.Runtime.PullContainerImageIfNotExists(ctx, image); err != nil {
+			return errors.Wrapf(err, "failed to pull image %q", image)
+		}
+	}
+
+	if err := b.exec(ctx, name, nil, nil, "bash", "-c", "nohup containerd > /dev/null 2>&1 &"); err != nil {
+		return errors.Wrap(err, "failed to start containerd in build container")
+	}
+	if err := wait.PollImmediate(time.Second, containerdStartTimeout, func() (bool, error) {
+		return b.exec(ctx, name, nil, nil, "ctr", "version") == nil, nil
+	}); err != nil {
+		return errors.Wrap(err, "containerd of build container did not start")
+	}
+
+	// Stream the images into the build container instead of staging them on disk.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(b.Runtime.ExportContainerImages(ctx, images, pw, false))
+	}()
+	err := b.exec(ctx, name, pr, nil, "ctr", "--namespace=k8s.io", "images", "import", "--no-unpack", "-")
+	// Unblock the export if the import stopped reading.
+	pr.CloseWithError(err)
+	if err != nil {
+		return errors.Wrap(err, "failed to import images")
+	}
+
+	// Stop containerd so that its metadata is consistent when committed.
+	err = b.exec(ctx, name, nil, nil, "bash", "-c", "pkill -x containerd; while pgrep -x containerd > /dev/null; do sleep 0.1; done")
+	return errors.Wrap(err, "failed to stop containerd in build container")
+}
+
+// exec runs the command in the build container.
+func (b *Builder) exec(ctx context.Context, name string, stdin io.Reader, env []string, command string, args ...string) error {
+	return b.Runtime.ExecContainer(ctx, name, &container.ExecContainerInput{
+		InputBuffer:     stdin,
+		OutputBuffer:    b.Stdout,
+		ErrorBuffer:     b.Stderr,
+		EnvironmentVars: env,
+	}, command, args...)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nodeimage builds custom node images from a kindest/node base image with containerd alone.
+package nodeimage
+
+import (
+	"os"
+	"regexp"
+
+	refdocker "github.com/containerd/containerd/reference/docker"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// packageName matches the names of Debian packages, optionally pinned to a version.
+var packageName = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+(=[A-Za-z0-9.+:~-]+)?$`)
+
+// Recipe describes a node image to build, e.g.
+//
+//	baseImage: kindest/node:v1.23.3
+//	image: example.com/node:v1.23.3-nfs
+//	packages: [nfs-common]
+//	images: [registry.k8s.io/sig-storage/nfs-subdir-external-provisioner:v4.0.2]
+type Recipe struct {
+	// BaseImage is the node image the image is built from, e.g. "kindest/node:v1.23.3".
+	BaseImage string `json:"baseImage"`
+
+	// Image is the reference of the image built, used as the CustomImage of the machines.
+	Image string `json:"image"`
+
+	// Packages are the Debian packages installed in the image, with apt-get.
+	// +optional
+	Packages []string `json:"packages,omitempty"`
+
+	// Images are the container images preloaded into the containerd of the image, so that the
+	// nodes do not pull them.
+	// +optional
+	Images []string `json:"images,omitempty"`
+}
+
+// LoadRecipe reads the recipe from the YAML file at the path.
+func LoadRecipe(path string) (*Recipe, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read recipe %q", path)
+	}
+	recipe := &Recipe{}
+	if err := yaml.UnmarshalStrict(data, recipe); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse recipe %q", path)
+	}
+	return recipe, nil
+}
+
+// Validate returns an error if an image reference or a package name of the recipe is invalid.
+func (r *Recipe) Validate() error {
+	if r.BaseImage == "" {
+		return errors.New("the base image of the recipe is required")
+	}
+	if r.Image == "" {
+		return errors.New("the image of the recipe is required")
+	}
+	for _, image := range append([]string{r.BaseImage, r.Image}, r.Images...) {
+		if _, err := refdocker.ParseDockerRef(image); err != nil {
+			return errors.Wrapf(err, "invalid image reference %q", image)
+		}
+	}
+	for _, pkg := range r.Packages {
+		if !packageName.MatchString(pkg) {
+			return errors.Errorf("invalid package name %q", pkg)
+		}
+	}
+	return nil
+}
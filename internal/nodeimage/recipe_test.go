@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeimage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestLoadRecipe(t *testing.T) {
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "recipe.yaml")
+	g.Expect(os.WriteFile(path, []byte(`baseImage: kindest/node:v1.23.3
+image: example.com/node:v1.23.3-nfs
+packages: [nfs-common, open-iscsi=2.1.3-5]
+images: [registry.k8s.io/pause:3.6]
+`), 0o600)).To(Succeed())
+	recipe, err := LoadRecipe(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(recipe.Packages).To(Equal([]string{"nfs-common", "open-iscsi=2.1.3-5"}))
+	g.Expect(recipe.Validate()).To(Succeed())
+
+	g.Expect(os.WriteFile(path, []byte("baseImage: kindest/node:v1.23.3\nbase: typo\n"), 0o600)).To(Succeed())
+	_, err = LoadRecipe(path)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestRecipeValidate(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect((&Recipe{Image: "example.com/node:v1"}).Validate()).ToNot(Succeed())
+	g.Expect((&Recipe{BaseImage: "kindest/node:v1.23.3"}).Validate()).ToNot(Succeed())
+	g.Expect((&Recipe{BaseImage: "kindest/node:v1.23.3", Image: "Example/Node"}).Validate()).ToNot(Succeed())
+	g.Expect((&Recipe{BaseImage: "kindest/node:v1.23.3", Image: "example.com/node:v1", Packages: []string{"curl; rm -rf /"}}).Validate()).ToNot(Succeed())
+}
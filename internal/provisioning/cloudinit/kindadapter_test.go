@@ -106,49 +106,34 @@ write_files:
     permissions: '0640'
 `)
 
-	expectedCmds := []provisioning.Cmd{
-		// ca
-		{Cmd: "mkdir", Args: []string{"-p", "/etc/kubernetes/pki"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /etc/kubernetes/pki/ca.crt /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0640", "/etc/kubernetes/pki/ca.crt"}},
-		{Cmd: "mkdir", Args: []string{"-p", "/etc/kubernetes/pki"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /etc/kubernetes/pki/ca.key /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0600", "/etc/kubernetes/pki/ca.key"}},
-		// etcd/ca
-		{Cmd: "mkdir", Args: []string{"-p", "/etc/kubernetes/pki/etcd"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /etc/kubernetes/pki/etcd/ca.crt /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0640", "/etc/kubernetes/pki/etcd/ca.crt"}},
-		{Cmd: "mkdir", Args: []string{"-p", "/etc/kubernetes/pki/etcd"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /etc/kubernetes/pki/etcd/ca.key /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0600", "/etc/kubernetes/pki/etcd/ca.key"}},
-		// front-proxy-ca
-		{Cmd: "mkdir", Args: []string{"-p", "/etc/kubernetes/pki"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /etc/kubernetes/pki/front-proxy-ca.crt /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0640", "/etc/kubernetes/pki/front-proxy-ca.crt"}},
-		{Cmd: "mkdir", Args: []string{"-p", "/etc/kubernetes/pki"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /etc/kubernetes/pki/front-proxy-ca.key /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0600", "/etc/kubernetes/pki/front-proxy-ca.key"}},
-		// sa
-		{Cmd: "mkdir", Args: []string{"-p", "/etc/kubernetes/pki"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /etc/kubernetes/pki/sa.pub /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0640", "/etc/kubernetes/pki/sa.pub"}},
-		{Cmd: "mkdir", Args: []string{"-p", "/etc/kubernetes/pki"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /etc/kubernetes/pki/sa.key /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0600", "/etc/kubernetes/pki/sa.key"}},
-		// /run/kubeadm/kubeadm.yaml
-		{Cmd: "mkdir", Args: []string{"-p", "/run/kubeadm"}},
-		{Cmd: "/bin/sh", Args: []string{"-c", "cat > /run/kubeadm/kubeadm.yaml /dev/stdin"}},
-		{Cmd: "chmod", Args: []string{"0640", "/run/kubeadm/kubeadm.yaml"}},
+	expectedFiles := []provisioning.File{
+		{Path: "/etc/kubernetes/pki/ca.crt", Mode: 0640},
+		{Path: "/etc/kubernetes/pki/ca.key", Mode: 0600},
+		{Path: "/etc/kubernetes/pki/etcd/ca.crt", Mode: 0640},
+		{Path: "/etc/kubernetes/pki/etcd/ca.key", Mode: 0600},
+		{Path: "/etc/kubernetes/pki/front-proxy-ca.crt", Mode: 0640},
+		{Path: "/etc/kubernetes/pki/front-proxy-ca.key", Mode: 0600},
+		{Path: "/etc/kubernetes/pki/sa.pub", Mode: 0640},
+		{Path: "/etc/kubernetes/pki/sa.key", Mode: 0600},
+		{Path: "/run/kubeadm/kubeadm.yaml", Mode: 0640},
 	}
 
 	commands, err := RawCloudInitToProvisioningCommands(cloudData)
 
 	g.Expect(err).NotTo(HaveOccurred())
-	g.Expect(commands).To(HaveLen(len(expectedCmds)))
+	g.Expect(commands).To(HaveLen(len(expectedFiles)))
 
+	// The files are written rather than created by shell commands, with the permissions and the
+	// decoded content of the bootstrap data.
 	for i, cmd := range commands {
-		expected := expectedCmds[i]
-		g.Expect(cmd.Cmd).To(Equal(expected.Cmd))
-		g.Expect(cmd.Args).To(ConsistOf(expected.Args))
+		expected := expectedFiles[i]
+		g.Expect(cmd.Cmd).To(BeEmpty())
+		g.Expect(cmd.File).NotTo(BeNil())
+		g.Expect(cmd.File.Path).To(Equal(expected.Path))
+		g.Expect(cmd.File.Mode).To(Equal(expected.Mode))
+		g.Expect(cmd.File.Owner).To(BeEmpty())
 	}
+	g.Expect(commands[0].File.Content).To(HavePrefix("-----BEGIN CERTIFICATE-----"))
+	g.Expect(commands[8].File.Content).To(ContainSubstring("kind: InitConfiguration"))
+	g.Expect(commands[8].File.Content).To(HaveSuffix(kubeproxyComponentConfig))
 }
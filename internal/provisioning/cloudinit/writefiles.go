@@ -20,9 +20,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
-	"fmt"
 	"io"
-	"path/filepath"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -70,7 +70,7 @@ func (a *writeFilesAction) Unmarshal(userData []byte) error {
 }
 
 // Commands return a list of commands to run on the node.
-// Each command defines the parameters of a shell command necessary to generate a file replicating the cloud-init write_files module.
+// Each command defines a file to write, replicating the cloud-init write_files module.
 func (a *writeFilesAction) Commands() ([]provisioning.Cmd, error) {
 	commands := make([]provisioning.Cmd, 0)
 	for _, f := range a.Files {
@@ -86,28 +86,17 @@ func (a *writeFilesAction) Commands() ([]provisioning.Cmd, error) {
 		if err != nil {
 			return commands, errors.Wrapf(err, "error decoding content for %s", path)
 		}
-
-		// Make the directory so cat + redirection will work
-		directory := filepath.Dir(path)
-		commands = append(commands, provisioning.Cmd{Cmd: "mkdir", Args: []string{"-p", directory}})
-
-		redirects := ">"
-		if f.Append {
-			redirects = ">>"
-		}
-
-		// generate a command that will create a file with the expected contents.
-		commands = append(commands, provisioning.Cmd{Cmd: "/bin/sh", Args: []string{"-c", fmt.Sprintf("cat %s %s /dev/stdin", redirects, path)}, Stdin: content})
-
-		// if permissions are different than default ownership, add a command to modify the permissions.
-		if permissions != "0644" {
-			commands = append(commands, provisioning.Cmd{Cmd: "chmod", Args: []string{permissions, path}})
+		mode, err := strconv.ParseUint(permissions, 8, 32)
+		if err != nil {
+			return commands, errors.Wrapf(err, "invalid permissions for %s", path)
 		}
 
-		// if ownership is different than default ownership, add a command to modify file ownerhsip.
+		file := &provisioning.File{Path: path, Content: content, Mode: os.FileMode(mode), Append: f.Append}
+		// the files are written by root, only a different ownership is set.
 		if owner != "root:root" {
-			commands = append(commands, provisioning.Cmd{Cmd: "chown", Args: []string{owner, path}})
+			file.Owner = owner
 		}
+		commands = append(commands, provisioning.Cmd{File: file})
 	}
 	return commands, nil
 }
@@ -41,10 +41,8 @@ func TestWriteFiles(t *testing.T) {
 				},
 			},
 			expectedCmds: []provisioning.Cmd{
-				{Cmd: "mkdir", Args: []string{"-p", "."}},
-				{Cmd: "/bin/sh", Args: []string{"-c", "cat > foo /dev/stdin"}, Stdin: "bar"},
-				{Cmd: "mkdir", Args: []string{"-p", "."}},
-				{Cmd: "/bin/sh", Args: []string{"-c", "cat > baz /dev/stdin"}, Stdin: "qux"},
+				{File: &provisioning.File{Path: "foo", Content: "bar", Mode: 0644}},
+				{File: &provisioning.File{Path: "baz", Content: "qux", Mode: 0644}},
 			},
 		},
 		{
@@ -55,9 +53,7 @@ func TestWriteFiles(t *testing.T) {
 				},
 			},
 			expectedCmds: []provisioning.Cmd{
-				{Cmd: "mkdir", Args: []string{"-p", "."}},
-				{Cmd: "/bin/sh", Args: []string{"-c", "cat > foo /dev/stdin"}, Stdin: "bar"},
-				{Cmd: "chown", Args: []string{"baz:baz", "foo"}},
+				{File: &provisioning.File{Path: "foo", Content: "bar", Mode: 0644, Owner: "baz:baz"}},
 			},
 		},
 		{
@@ -68,9 +64,7 @@ func TestWriteFiles(t *testing.T) {
 				},
 			},
 			expectedCmds: []provisioning.Cmd{
-				{Cmd: "mkdir", Args: []string{"-p", "."}},
-				{Cmd: "/bin/sh", Args: []string{"-c", "cat > foo /dev/stdin"}, Stdin: "bar"},
-				{Cmd: "chmod", Args: []string{"755", "foo"}},
+				{File: &provisioning.File{Path: "foo", Content: "bar", Mode: 0755}},
 			},
 		},
 		{
@@ -81,8 +75,18 @@ func TestWriteFiles(t *testing.T) {
 				},
 			},
 			expectedCmds: []provisioning.Cmd{
-				{Cmd: "mkdir", Args: []string{"-p", "."}},
-				{Cmd: "/bin/sh", Args: []string{"-c", "cat >> foo /dev/stdin"}, Stdin: "bar"},
+				{File: &provisioning.File{Path: "foo", Content: "bar", Mode: 0644, Append: true}},
+			},
+		},
+		{
+			name: "base64 content",
+			w: writeFilesAction{
+				Files: []files{
+					{Path: "foo", Content: "YmFy", Encoding: "b64"},
+				},
+			},
+			expectedCmds: []provisioning.Cmd{
+				{File: &provisioning.File{Path: "foo", Content: "bar", Mode: 0644}},
 			},
 		},
 	}
@@ -98,6 +102,14 @@ func TestWriteFiles(t *testing.T) {
 	}
 }
 
+func TestWriteFilesInvalidPermissions(t *testing.T) {
+	g := NewWithT(t)
+
+	w := writeFilesAction{Files: []files{{Path: "foo", Content: "bar", Permissions: "rwx"}}}
+	_, err := w.Commands()
+	g.Expect(err).To(HaveOccurred())
+}
+
 func TestFixContent(t *testing.T) {
 	v := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
 	gv, _ := gZipData([]byte(v))
@@ -20,15 +20,28 @@ package provisioning
 
 import (
 	"encoding/json"
+	"os"
 
 	"github.com/pkg/errors"
 )
 
-// Cmd defines a shell command.
+// Cmd defines a shell command, or a file to write if File is set.
 type Cmd struct {
 	Cmd   string
 	Args  []string
 	Stdin string
+	File  *File
+}
+
+// File defines a file written to the machine, rather than created by a shell command.
+type File struct {
+	Path    string
+	Content string
+	Mode    os.FileMode
+	// Owner is the "user:group" owning the file, the user of the machine processes if empty.
+	Owner string
+	// Append appends the content to the file, if it exists, rather than replacing it.
+	Append bool
 }
 
 // UnmarshalJSON a runcmd command
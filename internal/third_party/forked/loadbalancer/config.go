@@ -28,6 +28,15 @@ type ConfigData struct {
 	ControlPlanePort int
 	BackendServers   map[string]string
 	IPv6             bool
+	// Frontends are the additional ports the load balancer forwards to the nodes
+	Frontends []Frontend
+}
+
+// Frontend is an additional port of the loadbalancer, forwarding TCP connections to its backend servers
+type Frontend struct {
+	Name           string
+	Port           int
+	BackendServers map[string]string
 }
 
 // DefaultConfigTemplate is the loadbalancer config template
@@ -56,12 +65,25 @@ backend kube-apiservers
   {{range $server, $address := .BackendServers}}
   server {{ $server }} {{ $address }} check check-ssl verify none
   {{- end}}
+{{- range .Frontends }}
+listen {{ .Name }}
+  bind *:{{ .Port }}
+  {{ if $.IPv6 -}}
+  bind :::{{ .Port }};
+  {{- end }}
+  {{- range $server, $address := .BackendServers }}
+  server {{ $server }} {{ $address }} check
+  {{- end }}
+{{- end }}
 `
 
 // Config returns a kubeadm config generated from config data, in particular
-// the kubernetes version
-func Config(data *ConfigData) (config string, err error) {
-	t, err := template.New("loadbalancer-config").Parse(DefaultConfigTemplate)
+// the kubernetes version, with the given config template or DefaultConfigTemplate if empty
+func Config(data *ConfigData, configTemplate string) (config string, err error) {
+	if configTemplate == "" {
+		configTemplate = DefaultConfigTemplate
+	}
+	t, err := template.New("loadbalancer-config").Parse(configTemplate)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to parse config template")
 	}
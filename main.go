@@ -19,23 +19,44 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"golang.org/x/time/rate"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	infrastructurev1alpha3 "github.com/raminenia/cluster-api-provider-containerd/api/v1alpha3"
+	infrastructurev1beta1 "github.com/raminenia/cluster-api-provider-containerd/api/v1beta1"
 	capc "github.com/raminenia/cluster-api-provider-containerd/container"
 	"github.com/raminenia/cluster-api-provider-containerd/controllers"
+	"github.com/raminenia/cluster-api-provider-containerd/internal/containerd"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -46,21 +67,154 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(clusterv1.AddToScheme(scheme))
+	utilruntime.Must(expv1.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 
 	utilruntime.Must(infrastructurev1alpha3.AddToScheme(scheme))
+	utilruntime.Must(infrastructurev1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 
 }
 
 func main() {
+	// The containerd shims run the provider binary as the logging binary of the containers.
+	if capc.IsLogDriverCommand(os.Args[1:]) {
+		capc.RunLogDriver(os.Args[1:])
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var registryConfigPath string
+	var lazyPull bool
+	var maxConcurrentDownloads int
+	var maxConcurrentUnpacks int
+	var restartMonitorInterval time.Duration
+	var cniBinDir string
+	var cniConfDir string
+	var execCapabilities string
+	var execTimeout time.Duration
+	var containerLogMaxSize string
+	var containerLogMaxFiles int
+	var containerLogCompress bool
+	var killGracePeriod time.Duration
+	var cgroupMode string
+	var containerdAddress string
+	var containerdTLSCA string
+	var containerdTLSCert string
+	var containerdTLSKey string
+	var hostsConfigPath string
+	var imageGCInterval time.Duration
+	var orphanGCInterval time.Duration
+	var imageGCMinAge time.Duration
+	var imageGCMaxAge time.Duration
+	var imageGCMaxSize string
+	var imageGCRepositories string
+	var tracingEndpoint string
+	var tracingInsecure bool
+	var cdiSpecDirs string
+	var webhookPort int
+	var webhookCertDir string
+	var reconcilerOpts reconcilerOptions
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&registryConfigPath, "registry-config-path", "",
+		"Directory holding the registry hosts configuration (<host>/hosts.toml and certificates), "+
+			"in the same layout as the containerd config_path, e.g. /etc/containerd/certs.d.")
+	flag.BoolVar(&lazyPull, "lazy-pull", false,
+		"Pull images lazily with the stargz snapshotter, which must be configured in containerd.")
+	flag.IntVar(&maxConcurrentDownloads, "max-concurrent-downloads", 3,
+		"The maximum number of layers downloaded concurrently for each image pull, 0 for no limit.")
+	flag.IntVar(&maxConcurrentUnpacks, "max-concurrent-unpacks", 0,
+		"The maximum number of images pulled and unpacked concurrently, 0 for no limit.")
+	flag.DurationVar(&restartMonitorInterval, "restart-monitor-interval", 10*time.Second,
+		"The interval at which exited machine and load balancer containers are checked for restart.")
+	flag.StringVar(&cniBinDir, "cni-bin-dir", capc.DefaultCNIBinDir,
+		"Directory holding the CNI plugins used to attach containers to their network, empty to disable CNI networking.")
+	flag.StringVar(&cniConfDir, "cni-conf-dir", "/etc/cluster-api-provider-containerd/net.d",
+		"Directory holding the CNI configuration of the container networks, a bridge network is used for networks without one.")
+	flag.StringVar(&execCapabilities, "exec-capabilities", capc.AllCapabilities,
+		"Comma separated list of the capabilities granted to commands run in machine containers, e.g. CAP_NET_ADMIN,CAP_SYS_ADMIN. "+
+			"ALL runs them with all the capabilities of the container, an empty list grants none.")
+	flag.DurationVar(&execTimeout, "exec-timeout", 15*time.Minute,
+		"How long commands run in machine containers, e.g. kubeadm, can run before they are killed. 0 for no timeout.")
+	flag.StringVar(&containerLogMaxSize, "container-log-max-size", "10Mi",
+		"The size above which the log of a container is rotated, e.g. 10Mi. 0 to never rotate it.")
+	flag.IntVar(&containerLogMaxFiles, "container-log-max-files", 5,
+		"The number of log files kept for each container, including the current one.")
+	flag.BoolVar(&containerLogCompress, "container-log-compress", true,
+		"Compress the rotated log files of the containers.")
+	flag.DurationVar(&killGracePeriod, "kill-grace-period", capc.DefaultKillGracePeriod,
+		"How long containers have to exit after a stop signal, e.g. SIGTERM, before they are killed with SIGKILL.")
+	flag.StringVar(&cgroupMode, "cgroup-mode", string(capc.CgroupModeAuto),
+		"The cgroup hierarchy of the host, v1 or v2, used to configure the cgroups of the containers. auto detects it.")
+	flag.StringVar(&containerdAddress, "containerd-address", capc.DefaultAddress,
+		"The address of the containerd daemon: the path of its local socket, or tcp://host:port for a remote daemon "+
+			"served over TLS, in which case CNI networking and the container log driver are disabled.")
+	flag.StringVar(&containerdTLSCA, "containerd-tls-ca", "",
+		"The CA certificates verifying the certificate of a remote containerd daemon, the system roots if empty.")
+	flag.StringVar(&containerdTLSCert, "containerd-tls-cert", "",
+		"The client certificate authenticating the provider to a remote containerd daemon.")
+	flag.StringVar(&containerdTLSKey, "containerd-tls-key", "",
+		"The key of the client certificate authenticating the provider to a remote containerd daemon.")
+	flag.StringVar(&hostsConfigPath, "hosts-config", "",
+		"The YAML file configuring a pool of containerd hosts the machines are scheduled onto by failure domain, "+
+			"capacity and labels. If not set, all the machines run on the containerd daemon at --containerd-address.")
+	flag.DurationVar(&imageGCInterval, "image-gc-interval", time.Hour,
+		"The interval at which the node and load balancer images no container uses are garbage collected. 0 to disable it.")
+	flag.DurationVar(&imageGCMinAge, "image-gc-min-age", time.Hour,
+		"How long after they were pulled the images no container uses are kept whatever the max age and size, "+
+			"e.g. while the containers using them are created.")
+	flag.DurationVar(&imageGCMaxAge, "image-gc-max-age", 7*24*time.Hour,
+		"How long after they were pulled the images no container uses are removed. 0 to keep them whatever their age.")
+	flag.StringVar(&imageGCMaxSize, "image-gc-max-size", "0",
+		"The size above which the images no container uses are removed, the least recently pulled first, e.g. 50Gi. 0 for no limit.")
+	flag.StringVar(&imageGCRepositories, "image-gc-repositories", strings.Join(capc.DefaultImageGCRepositories, ","),
+		"Comma separated list of the repositories of the images garbage collected.")
+	flag.DurationVar(&orphanGCInterval, "orphan-gc-interval", 0,
+		"The interval at which the machine and load balancer containers whose objects no longer exist are deleted. "+
+			"0 to disable it, it must stay disabled if the containerd namespace is shared with another management cluster.")
+	flag.StringVar(&tracingEndpoint, "tracing-endpoint", "",
+		"The host:port of the OTLP gRPC endpoint the traces of the reconciliations and containerd operations are exported to. "+
+			"Empty to disable tracing.")
+	flag.BoolVar(&tracingInsecure, "tracing-insecure", false,
+		"Export the traces to the OTLP endpoint without TLS.")
+	flag.StringVar(&cdiSpecDirs, "cdi-spec-dirs", strings.Join(capc.DefaultCDISpecDirs, ","),
+		"Comma separated list of the directories of the Container Device Interface specs of the devices injected into machines, "+
+			"in increasing order of precedence.")
+	flag.IntVar(&reconcilerOpts.clusterConcurrency, "containerdcluster-concurrency", 1,
+		"Number of ContainerdClusters to process simultaneously.")
+	flag.IntVar(&reconcilerOpts.machineConcurrency, "containerdmachine-concurrency", 1,
+		"Number of ContainerdMachines to process simultaneously.")
+	flag.IntVar(&reconcilerOpts.machinePoolConcurrency, "containerdmachinepool-concurrency", 1,
+		"Number of ContainerdMachinePools to process simultaneously.")
+	flag.DurationVar(&reconcilerOpts.rateLimiterBaseDelay, "rate-limiter-base-delay", 5*time.Millisecond,
+		"The delay of the first retry of a failed reconciliation, doubled on every retry.")
+	flag.DurationVar(&reconcilerOpts.rateLimiterMaxDelay, "rate-limiter-max-delay", 1000*time.Second,
+		"The maximum delay of the retries of a failed reconciliation.")
+	flag.Float64Var(&reconcilerOpts.rateLimiterQPS, "rate-limiter-qps", 10,
+		"The overall rate of the reconciliations of each controller, in reconciliations per second.")
+	flag.IntVar(&reconcilerOpts.rateLimiterBurst, "rate-limiter-burst", 100,
+		"The number of reconciliations of each controller allowed above the rate limiter QPS in a burst.")
+	flag.DurationVar(&reconcilerOpts.reconcileTimeout, "reconcile-timeout", 0,
+		"The maximum duration of the operations of a reconciliation, e.g. the bootstrap of a machine. "+
+			"0 for no limit besides --exec-timeout.")
+	flag.DurationVar(&reconcilerOpts.timeouts.Pull, "pull-timeout", 0,
+		"The maximum duration of the pull of the image of a machine, within --reconcile-timeout. 0 for no limit.")
+	flag.DurationVar(&reconcilerOpts.timeouts.Create, "create-timeout", 0,
+		"The maximum duration of the creation of the container of a machine, within --reconcile-timeout. 0 for no limit.")
+	flag.DurationVar(&reconcilerOpts.timeouts.Bootstrap, "bootstrap-timeout", 0,
+		"The maximum duration of the bootstrap of a machine, within --reconcile-timeout. 0 for no limit besides --exec-timeout.")
+	flag.DurationVar(&reconcilerOpts.timeouts.Delete, "delete-timeout", 0,
+		"The maximum duration of the deletion of a machine, within --reconcile-timeout. 0 for no limit.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443,
+		"The port the conversion webhook server serves at. 0 to disable the webhooks, e.g. when running the manager out of the cluster.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs/",
+		"The directory holding the certificate and key of the webhook server, tls.crt and tls.key.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -72,7 +226,8 @@ func main() {
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
+		Port:                   webhookPort,
+		CertDir:                webhookCertDir,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "c39a2ff0.cluster.x-k8s.io",
@@ -83,7 +238,120 @@ func main() {
 	}
 	// Setup the context that's going to be used in controllers and for the manager.
 	ctx := ctrl.SetupSignalHandler()
-	setupReconcilers(ctx, mgr)
+	if tracingEndpoint != "" {
+		shutdownTracing, err := setupTracing(ctx, tracingEndpoint, tracingInsecure)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				setupLog.Error(err, "unable to flush traces")
+			}
+		}()
+	}
+	execPrivileges, err := capc.ParseExecCapabilities(execCapabilities)
+	if err != nil {
+		setupLog.Error(err, "invalid exec capabilities")
+		os.Exit(1)
+	}
+	parsedCgroupMode, err := capc.ParseCgroupMode(cgroupMode)
+	if err != nil {
+		setupLog.Error(err, "invalid cgroup mode")
+		os.Exit(1)
+	}
+	logMaxSize, err := resource.ParseQuantity(containerLogMaxSize)
+	if err != nil {
+		setupLog.Error(err, "invalid container log max size")
+		os.Exit(1)
+	}
+	gcMaxSize, err := resource.ParseQuantity(imageGCMaxSize)
+	if err != nil {
+		setupLog.Error(err, "invalid image GC max size")
+		os.Exit(1)
+	}
+	imageGCPolicy := capc.ImageGCPolicy{
+		Repositories: strings.Split(imageGCRepositories, ","),
+		MinAge:       imageGCMinAge,
+		MaxAge:       imageGCMaxAge,
+		MaxSize:      gcMaxSize.Value(),
+	}
+	runtimeOpts := []capc.Option{
+		capc.WithLogConfig(capc.LogConfig{
+			MaxSize:  logMaxSize.Value(),
+			MaxFiles: containerLogMaxFiles,
+			Compress: containerLogCompress,
+		}),
+		capc.WithExecPrivileges(execPrivileges),
+		capc.WithExecTimeout(execTimeout),
+		capc.WithKillGracePeriod(killGracePeriod),
+		capc.WithCgroupMode(parsedCgroupMode),
+		capc.WithRegistryConfigPath(registryConfigPath),
+		capc.WithMaxConcurrentDownloads(maxConcurrentDownloads),
+		capc.WithMaxConcurrentUnpacks(maxConcurrentUnpacks),
+		capc.WithCDISpecDirs(strings.Split(cdiSpecDirs, ",")...),
+	}
+	if lazyPull {
+		runtimeOpts = append(runtimeOpts, capc.WithLazyPull())
+	}
+	hostConfigs := []capc.HostConfig{{Name: "default", Address: containerdAddress}}
+	if capc.IsRemoteAddress(containerdAddress) {
+		hostConfigs[0].TLS = &capc.HostTLSConfig{CA: containerdTLSCA, Cert: containerdTLSCert, Key: containerdTLSKey}
+	}
+	if hostsConfigPath != "" {
+		hostConfigs, err = capc.LoadHostsConfig(hostsConfigPath)
+		if err != nil {
+			setupLog.Error(err, "invalid hosts configuration")
+			os.Exit(1)
+		}
+	}
+	hosts := []*capc.Host{}
+	for _, config := range hostConfigs {
+		// The metrics of the hosts of a pool are told apart by a host label.
+		var registerer prometheus.Registerer = metrics.Registry
+		if hostsConfigPath != "" {
+			registerer = prometheus.WrapRegistererWith(prometheus.Labels{"host": config.Name}, metrics.Registry)
+		}
+		runtimeClient, err := newRuntimeClient(config, runtimeOpts, registerer, cniBinDir, cniConfDir)
+		if err != nil {
+			setupLog.Error(err, "unable to establish container runtime connection", "host", config.Name, "controller", "reconciler")
+			os.Exit(1)
+		}
+		registerer.MustRegister(capc.NewStatsCollector(runtimeClient))
+		hosts = append(hosts, &capc.Host{
+			Name:          config.Name,
+			FailureDomain: config.FailureDomain,
+			Labels:        config.Labels,
+			Capacity:      config.Capacity,
+			Runtime:       runtimeClient,
+		})
+	}
+	var hostPool *capc.HostPool
+	if hostsConfigPath != "" {
+		hostPool, err = capc.NewHostPool(hosts...)
+		if err != nil {
+			setupLog.Error(err, "invalid hosts configuration")
+			os.Exit(1)
+		}
+	}
+
+	setupReconcilers(ctx, mgr, hosts[0].Runtime, hostPool, reconcilerOpts)
+	if webhookPort != 0 {
+		setupWebhooks(mgr)
+	}
+	setupStorageVersionMigrator(mgr)
+	for _, host := range hosts {
+		setupRestartMonitor(mgr, host, restartMonitorInterval)
+		setupHealthMonitor(mgr, host)
+		setupEventWatcher(mgr, host)
+		setupConnectionMonitor(mgr, host)
+		if imageGCInterval > 0 {
+			setupImageGC(mgr, host, imageGCPolicy, imageGCInterval)
+		}
+		if orphanGCInterval > 0 {
+			setupOrphanGC(mgr, host, orphanGCInterval)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -94,28 +362,113 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	for _, host := range hosts {
+		if err := mgr.AddReadyzCheck("containerd-"+host.Name, containerdChecker(host)); err != nil {
+			setupLog.Error(err, "unable to set up containerd ready check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
 
-func setupReconcilers(ctx context.Context, mgr ctrl.Manager) {
-	// Set our runtime client into the context for later use
-	runtimeClient, err := capc.NewContainerdClient("/var/run/containerd/containerd.sock", "default")
+// setupTracing exports the spans of the reconciliations and of the containerd operations they make to
+// the OTLP gRPC endpoint, and returns the function flushing the remaining ones.
+func setupTracing(ctx context.Context, endpoint string, insecure bool) (func(context.Context) error, error) {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+	res, err := sdkresource.Merge(sdkresource.Default(), sdkresource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String("cluster-api-provider-containerd"),
+		semconv.ServiceVersionKey.String(containerd.ProviderVersion),
+	))
 	if err != nil {
-		setupLog.Error(err, "unable to establish container runtime connection", "controller", "reconciler")
+		return nil, fmt.Errorf("failed to create tracing resource: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	// containerd joins the traces of the calls it gets when it is traced too.
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// newRuntimeClient connects to the containerd daemon of the host, registering the metrics of its
+// operations with the registerer. The containers of remote daemons are not attached to CNI networks
+// and their output is logged without the log driver.
+func newRuntimeClient(config capc.HostConfig, runtimeOpts []capc.Option, registerer prometheus.Registerer, cniBinDir, cniConfDir string) (capc.Runtime, error) {
+	opts := append([]capc.Option{capc.WithMetricsRegisterer(registerer)}, runtimeOpts...)
+	if capc.IsRemoteAddress(config.Address) {
+		if config.TLS == nil {
+			return nil, fmt.Errorf("a client certificate is required to connect to %q", config.Address)
+		}
+		tlsConfig, err := capc.LoadTLSConfig(config.TLS.CA, config.TLS.Cert, config.TLS.Key)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, capc.WithTLSConfig(tlsConfig))
+		setupLog.Info("remote containerd daemon, container output is logged without timestamps", "host", config.Name, "address", config.Address)
+		return capc.NewContainerdClient(config.Address, "default", opts...)
+	}
+
+	if cniBinDir != "" {
+		opts = append(opts, capc.WithCNI(cniBinDir, cniConfDir))
+	}
+	if executable, err := os.Executable(); err != nil {
+		setupLog.Error(err, "unable to find the provider binary, container output is logged without timestamps")
+	} else {
+		opts = append(opts, capc.WithLogDriver(executable))
+	}
+	return capc.NewContainerdClient(config.Address, "default", opts...)
+}
+
+// reconcilerOptions tunes the concurrency, the rate limiting and the timeouts of the reconciliations,
+// e.g. for tests running dozens of clusters, or to throttle the provider on a laptop.
+type reconcilerOptions struct {
+	clusterConcurrency     int
+	machineConcurrency     int
+	machinePoolConcurrency int
+	rateLimiterBaseDelay   time.Duration
+	rateLimiterMaxDelay    time.Duration
+	rateLimiterQPS         float64
+	rateLimiterBurst       int
+	reconcileTimeout       time.Duration
+	timeouts               controllers.OperationTimeouts
+}
+
+// controllerOptions returns the options of a controller processing concurrency objects simultaneously.
+// Every controller gets a rate limiter of its own, like the default one of controller-runtime.
+func (o reconcilerOptions) controllerOptions(concurrency int) controller.Options {
+	return controller.Options{
+		MaxConcurrentReconciles: concurrency,
+		RateLimiter: workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(o.rateLimiterBaseDelay, o.rateLimiterMaxDelay),
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(o.rateLimiterQPS), o.rateLimiterBurst)},
+		),
+	}
+}
+
+func setupReconcilers(ctx context.Context, mgr ctrl.Manager, runtimeClient capc.Runtime, hostPool *capc.HostPool, opts reconcilerOptions) {
+	if err := controllers.RegisterMetrics(metrics.Registry, mgr.GetClient()); err != nil {
+		setupLog.Error(err, "unable to register the metrics of the controllers")
 		os.Exit(1)
 	}
 
 	if err := (&controllers.ContainerdMachineReconciler{
 		Client:           mgr.GetClient(),
 		ContainerRuntime: runtimeClient,
-	}).SetupWithManager(ctx, mgr, controller.Options{
-		//MaxConcurrentReconciles: concurrency,
-	}); err != nil {
+		Hosts:            hostPool,
+		ReconcileTimeout: opts.reconcileTimeout,
+		Timeouts:         opts.timeouts,
+	}).SetupWithManager(ctx, mgr, opts.controllerOptions(opts.machineConcurrency)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DockerMachine")
 		os.Exit(1)
 	}
@@ -123,8 +476,140 @@ func setupReconcilers(ctx context.Context, mgr ctrl.Manager) {
 	if err := (&controllers.ContainerdClusterReconciler{
 		Client:           mgr.GetClient(),
 		ContainerRuntime: runtimeClient,
-	}).SetupWithManager(ctx, mgr, controller.Options{}); err != nil {
+		Hosts:            hostPool,
+		ReconcileTimeout: opts.reconcileTimeout,
+	}).SetupWithManager(ctx, mgr, opts.controllerOptions(opts.clusterConcurrency)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DockerCluster")
 		os.Exit(1)
 	}
+
+	if err := (&controllers.ContainerdMachinePoolReconciler{
+		Client:           mgr.GetClient(),
+		ContainerRuntime: runtimeClient,
+		ReconcileTimeout: opts.reconcileTimeout,
+		Timeouts:         opts.timeouts,
+	}).SetupWithManager(ctx, mgr, opts.controllerOptions(opts.machinePoolConcurrency)); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ContainerdMachinePool")
+		os.Exit(1)
+	}
+}
+
+// setupWebhooks registers the webhooks of the v1beta1 types, which convert the objects of the older
+// API versions, and validate or default the objects created and updated.
+func setupWebhooks(mgr ctrl.Manager) {
+	if err := (&infrastructurev1beta1.ContainerdCluster{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ContainerdCluster")
+		os.Exit(1)
+	}
+	if err := (&infrastructurev1beta1.ContainerdMachine{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ContainerdMachine")
+		os.Exit(1)
+	}
+	if err := (&infrastructurev1beta1.ContainerdClusterTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ContainerdClusterTemplate")
+		os.Exit(1)
+	}
+	if err := (&infrastructurev1beta1.ContainerdMachineTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ContainerdMachineTemplate")
+		os.Exit(1)
+	}
+}
+
+// setupStorageVersionMigrator migrates the objects stored in older API versions to v1beta1 once the
+// manager is elected leader.
+func setupStorageVersionMigrator(mgr ctrl.Manager) {
+	if err := (&controllers.StorageVersionMigrator{
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to set up storage version migrator")
+		os.Exit(1)
+	}
+}
+
+// setupRestartMonitor runs the restart monitor of the host runtime with the manager, containerd
+// has no restart policies so exited machine and load balancer containers are restarted by the provider.
+// The container networks are restored first, so that containers restarted after a reboot are reachable.
+func setupRestartMonitor(mgr ctrl.Manager, host *capc.Host, interval time.Duration) {
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		log := ctrl.Log.WithName("restart-monitor").WithValues("host", host.Name)
+		ctx = ctrl.LoggerInto(ctx, log)
+		if err := host.Runtime.RestoreNetworks(ctx); err != nil {
+			log.Error(err, "Failed to restore container networks")
+		}
+		return host.Runtime.MonitorRestarts(ctx, interval)
+	})); err != nil {
+		setupLog.Error(err, "unable to set up restart monitor")
+		os.Exit(1)
+	}
+}
+
+// setupHealthMonitor runs the health monitor of the host runtime with the manager, which probes the
+// machine and load balancer containers with a health check.
+func setupHealthMonitor(mgr ctrl.Manager, host *capc.Host) {
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return host.Runtime.MonitorHealth(ctrl.LoggerInto(ctx, ctrl.Log.WithName("health-monitor").WithValues("host", host.Name)))
+	})); err != nil {
+		setupLog.Error(err, "unable to set up health monitor")
+		os.Exit(1)
+	}
+}
+
+// setupEventWatcher records the containerd events of the host runtime with the manager, so that the
+// recent events of a container are part of its debug info.
+func setupEventWatcher(mgr ctrl.Manager, host *capc.Host) {
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return host.Runtime.WatchEvents(ctrl.LoggerInto(ctx, ctrl.Log.WithName("event-watcher").WithValues("host", host.Name)))
+	})); err != nil {
+		setupLog.Error(err, "unable to set up event watcher")
+		os.Exit(1)
+	}
+}
+
+// setupConnectionMonitor checks the connection to the containerd daemon of the host with the manager,
+// reconnecting when containerd stops answering, e.g. after a restart.
+func setupConnectionMonitor(mgr ctrl.Manager, host *capc.Host) {
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return host.Runtime.MonitorConnection(ctrl.LoggerInto(ctx, ctrl.Log.WithName("connection-monitor").WithValues("host", host.Name)))
+	})); err != nil {
+		setupLog.Error(err, "unable to set up connection monitor")
+		os.Exit(1)
+	}
+}
+
+// setupImageGC garbage collects the images of the host runtime no container uses with the manager,
+// so that the node images of the Kubernetes versions no cluster runs anymore do not fill up the host.
+// The images referenced by the machine specs are kept.
+func setupImageGC(mgr ctrl.Manager, host *capc.Host, policy capc.ImageGCPolicy, interval time.Duration) {
+	policy.ReferencedImages = func(ctx context.Context) ([]string, error) {
+		return containerd.ReferencedImages(ctx, mgr.GetClient())
+	}
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return host.Runtime.MonitorImages(ctrl.LoggerInto(ctx, ctrl.Log.WithName("image-gc").WithValues("host", host.Name)), policy, interval)
+	})); err != nil {
+		setupLog.Error(err, "unable to set up image garbage collection")
+		os.Exit(1)
+	}
+}
+
+// setupOrphanGC deletes the containers of the host runtime whose objects no longer exist with the
+// manager, e.g. the ones left behind by a controller that crashed.
+func setupOrphanGC(mgr ctrl.Manager, host *capc.Host, interval time.Duration) {
+	if err := (&controllers.OrphanCollector{
+		APIReader:        mgr.GetAPIReader(),
+		ContainerRuntime: host.Runtime,
+		Host:             host.Name,
+		Interval:         interval,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to set up orphaned container garbage collection")
+		os.Exit(1)
+	}
+}
+
+// containerdChecker reports the provider as not ready while the containerd daemon of the host
+// cannot be reached.
+func containerdChecker(host *capc.Host) healthz.Checker {
+	return func(req *http.Request) error {
+		return host.Runtime.CheckConnection(req.Context())
+	}
 }